@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/home/unixify/internal/agent"
+	"github.com/home/unixify/internal/client"
+	"github.com/home/unixify/internal/idrange"
+	"github.com/home/unixify/internal/models"
+	"github.com/home/unixify/internal/validator"
+	"github.com/sirupsen/logrus"
+)
+
+func main() {
+	hostname, _ := os.Hostname()
+
+	// Parse command line arguments
+	var server, token, hostToken, root, cache, ranges string
+	var once, dryRun, asJSON bool
+	settings := agent.New(nil, "", "/", nil)
+	flag.StringVar(&server, "server", os.Getenv("UNIXIFY_SERVER"), "Unixify server URL (default $UNIXIFY_SERVER)")
+	flag.StringVar(&token, "token", os.Getenv("UNIXIFY_TOKEN"), "API token used to send sync reports (default $UNIXIFY_TOKEN)")
+	flag.StringVar(&hostToken, "host-token", os.Getenv("UNIXIFY_HOST_TOKEN"), "Host token; limits the host to what its access rules allow (default $UNIXIFY_HOST_TOKEN)")
+	flag.StringVar(&hostname, "hostname", hostname, "Name the host reports under")
+	flag.StringVar(&root, "root", "/", "Directory holding the host's etc/")
+	flag.StringVar(&cache, "cache", "", "Local registry cache (default ROOT/var/lib/unixify-agent/cache.json)")
+	flag.StringVar(&ranges, "ranges", fmt.Sprintf("%d-%d", validator.MinUserUID, validator.MaxUserUID), "UID and GID ranges to manage, e.g. 1000-60000,70000-79999")
+	flag.StringVar(&settings.Home, "home", settings.Home, "Parent directory of home directories")
+	flag.StringVar(&settings.Shell, "shell", settings.Shell, "Login shell of active accounts")
+	flag.StringVar(&settings.InactiveShell, "inactive-shell", settings.InactiveShell, "Login shell of inactive accounts")
+	flag.IntVar(&settings.DefaultGID, "default-gid", settings.DefaultGID, "Primary GID of accounts without a primary group")
+	flag.DurationVar(&settings.Interval, "interval", settings.Interval, "Time between syncs")
+	flag.BoolVar(&once, "once", false, "Sync once and exit")
+	flag.BoolVar(&dryRun, "dry-run", false, "Show what would change without writing anything (implies -once)")
+	flag.BoolVar(&asJSON, "json", false, "Print the sync report as JSON (with -once)")
+	flag.Parse()
+
+	if server == "" {
+		log.Fatal("No server given: use -server or UNIXIFY_SERVER")
+	}
+	managed, err := idrange.Parse(ranges)
+	if err != nil {
+		log.Fatalf("Invalid -ranges: %v", err)
+	}
+
+	api := client.New(server, token)
+	api.HostToken = hostToken
+	a := agent.New(api, hostname, root, logrus.StandardLogger())
+	a.Ranges = managed
+	a.Home, a.Shell, a.InactiveShell = settings.Home, settings.Shell, settings.InactiveShell
+	a.DefaultGID, a.Interval = settings.DefaultGID, settings.Interval
+	a.DryRun = dryRun
+	if cache != "" {
+		a.CachePath = cache
+	}
+
+	if !once && !dryRun {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		a.Run(ctx)
+		return
+	}
+
+	report, err := a.Sync()
+	if err != nil {
+		log.Fatalf("Sync failed: %v", err)
+	}
+	if asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			log.Fatalf("Failed to encode report: %v", err)
+		}
+	}
+
+	// Exit non-zero while drift remains that the agent does not repair
+	for _, finding := range report.Drift {
+		if finding.Kind == models.DriftUnmanaged || finding.Kind == models.DriftConflict {
+			os.Exit(1)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/home/unixify/internal/config"
+	"github.com/home/unixify/internal/doctor"
+	"github.com/home/unixify/internal/repository"
+	"github.com/joho/godotenv"
+	"gorm.io/gorm"
+)
+
+func main() {
+	// Parse command line arguments
+	var fix, asJSON bool
+	flag.BoolVar(&fix, "fix", false, "Apply safe repairs (orphaned/duplicate memberships, dangling primary groups)")
+	flag.BoolVar(&asJSON, "json", false, "Print findings as JSON")
+	flag.Parse()
+
+	// Load environment variables
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found, using environment variables")
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	db, err := repository.InitDB(cfg)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	var findings []doctor.Finding
+	err = db.Transaction(func(tx *gorm.DB) error {
+		repos := repository.NewRepositories(tx)
+
+		registry, err := doctor.Load(repos)
+		if err != nil {
+			return err
+		}
+		findings = doctor.Diagnose(registry)
+
+		if fix {
+			return doctor.Fix(repos, findings, "doctor")
+		}
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("Doctor failed: %v", err)
+	}
+
+	// Print the findings
+	if asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(findings); err != nil {
+			log.Fatalf("Failed to encode findings: %v", err)
+		}
+	} else {
+		printFindings(findings, fix)
+	}
+
+	// Exit non-zero while problems remain so the doctor can gate deployments
+	for _, finding := range findings {
+		if !finding.Fixed {
+			os.Exit(1)
+		}
+	}
+}
+
+// printFindings prints findings in a human-readable form
+func printFindings(findings []doctor.Finding, fix bool) {
+	if len(findings) == 0 {
+		fmt.Println("No problems found.")
+		return
+	}
+
+	var errors, warnings, fixable, fixed int
+	for _, finding := range findings {
+		status := ""
+		switch {
+		case finding.Fixed:
+			status = " [fixed]"
+			fixed++
+		case finding.Fixable:
+			status = " [fixable]"
+			fixable++
+		}
+		if finding.Severity == doctor.SeverityError {
+			errors++
+		} else {
+			warnings++
+		}
+		fmt.Printf("%-7s %-24s %s%s\n", finding.Severity, finding.Check, finding.Message, status)
+	}
+
+	fmt.Printf("\n%d errors, %d warnings", errors, warnings)
+	if fixed > 0 {
+		fmt.Printf(", %d fixed", fixed)
+	}
+	fmt.Println()
+	if !fix && fixable > 0 {
+		fmt.Printf("Run with -fix to repair %d fixable problems.\n", fixable)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/home/unixify/internal/agent"
+	"github.com/home/unixify/internal/client"
+	"github.com/home/unixify/internal/drift"
+	"github.com/home/unixify/internal/idrange"
+	"github.com/home/unixify/internal/validator"
+)
+
+func main() {
+	// Parse command line arguments
+	var server, token, root, passwd, group, shadow, ranges string
+	var asJSON bool
+	flag.StringVar(&server, "server", os.Getenv("UNIXIFY_SERVER"), "Unixify server URL (default $UNIXIFY_SERVER)")
+	flag.StringVar(&token, "token", os.Getenv("UNIXIFY_TOKEN"), "API token (default $UNIXIFY_TOKEN)")
+	flag.StringVar(&root, "root", "/", "Directory holding the host's etc/")
+	flag.StringVar(&passwd, "passwd", "", "passwd file to compare (default ROOT/etc/passwd)")
+	flag.StringVar(&group, "group", "", "group file to compare (default ROOT/etc/group)")
+	flag.StringVar(&shadow, "shadow", "", "shadow file to compare (default ROOT/etc/shadow; skipped if it cannot be read)")
+	flag.StringVar(&ranges, "ranges", fmt.Sprintf("%d-%d", validator.MinUserUID, validator.MaxUserUID), "UID and GID ranges the registry manages; unknown entries in them are warnings")
+	flag.BoolVar(&asJSON, "json", false, "Print the report as JSON")
+	flag.Parse()
+
+	if server == "" {
+		log.Fatal("No server given: use -server or UNIXIFY_SERVER")
+	}
+	managed, err := idrange.Parse(ranges)
+	if err != nil {
+		log.Fatalf("Invalid -ranges: %v", err)
+	}
+
+	// Read the host's files; only shadow may be missing, as it needs root
+	etc := filepath.Join(root, "etc")
+	var files drift.Files
+	if files.Passwd, err = os.ReadFile(orDefault(passwd, filepath.Join(etc, "passwd"))); err != nil {
+		log.Fatalf("Failed to read passwd: %v", err)
+	}
+	if files.Group, err = os.ReadFile(orDefault(group, filepath.Join(etc, "group"))); err != nil {
+		log.Fatalf("Failed to read group: %v", err)
+	}
+	if files.Shadow, err = os.ReadFile(orDefault(shadow, filepath.Join(etc, "shadow"))); err != nil {
+		if shadow != "" || !errors.Is(err, os.ErrPermission) && !errors.Is(err, os.ErrNotExist) {
+			log.Fatalf("Failed to read shadow: %v", err)
+		}
+		log.Printf("Skipping shadow: %v", err)
+	}
+
+	// Fetch the registry from the change feed and compare locally, so the
+	// shadow file never leaves the host
+	cache := agent.NewCache()
+	if err := cache.Pull(client.New(server, token), 500); err != nil {
+		log.Fatalf("Failed to fetch the registry: %v", err)
+	}
+	registry := &drift.Registry{}
+	for _, account := range cache.Accounts {
+		registry.Accounts = append(registry.Accounts, account)
+	}
+	for _, group := range cache.Groups {
+		registry.Groups = append(registry.Groups, group)
+	}
+	for _, membership := range cache.Memberships {
+		registry.Memberships = append(registry.Memberships, membership)
+	}
+	report := drift.Compare(files, registry, managed.Contains)
+
+	// Print the report
+	if asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			log.Fatalf("Failed to encode report: %v", err)
+		}
+	} else if err := report.WriteText(os.Stdout); err != nil {
+		log.Fatalf("Failed to print report: %v", err)
+	}
+
+	// Exit non-zero on errors so the report can gate enrolling the host
+	if report.Errors > 0 {
+		os.Exit(1)
+	}
+}
+
+// orDefault returns path, or fallback when path is empty
+func orDefault(path, fallback string) string {
+	if path == "" {
+		return fallback
+	}
+	return path
+}
@@ -2,13 +2,11 @@ package main
 
 import (
 	"flag"
-	"fmt"
 	"log"
-	"os"
 
 	"github.com/golang-migrate/migrate/v4"
-	_ "github.com/golang-migrate/migrate/v4/database/postgres"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/home/unixify/db/migrations"
+	"github.com/home/unixify/internal/config"
 	"github.com/joho/godotenv"
 )
 
@@ -25,20 +23,14 @@ func main() {
 		log.Println("No .env file found, using environment variables")
 	}
 
-	// Get database connection string from environment variables
-	dbHost := getEnvOrDefault("DB_HOST", "localhost")
-	dbPort := getEnvOrDefault("DB_PORT", "5432")
-	dbUser := getEnvOrDefault("DB_USER", "postgres")
-	dbPassword := getEnvOrDefault("DB_PASSWORD", "postgres")
-	dbName := getEnvOrDefault("DB_NAME", "unixify")
-	dbSSLMode := getEnvOrDefault("DB_SSLMODE", "disable")
-
-	// Create database URL
-	dbURL := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=%s",
-		dbUser, dbPassword, dbHost, dbPort, dbName, dbSSLMode)
+	// Load the database configuration (DB_DRIVER selects postgres or sqlite)
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
 
-	// Create a new migrate instance
-	m, err := migrate.New("file://db/migrations", dbURL)
+	// Create a new migrate instance from the embedded migrations
+	m, err := migrations.New(cfg.Database.GetURL())
 	if err != nil {
 		log.Fatalf("Migration failed to initialize: %v", err)
 	}
@@ -68,10 +60,3 @@ func main() {
 		log.Fatalf("Invalid direction: %s. Use 'up' or 'down'", direction)
 	}
 }
-
-func getEnvOrDefault(key, defaultValue string) string {
-	if value, exists := os.LookupEnv(key); exists {
-		return value
-	}
-	return defaultValue
-}
\ No newline at end of file
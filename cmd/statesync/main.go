@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/home/unixify/internal/config"
+	"github.com/home/unixify/internal/repository"
+	"github.com/home/unixify/internal/service"
+	"github.com/home/unixify/internal/state"
+	"github.com/joho/godotenv"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: statesync <plan|apply> -file state.yaml [-prune] [-json]\n")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	command := os.Args[1]
+	if command != "plan" && command != "apply" {
+		usage()
+	}
+
+	// Parse command line arguments
+	var file, actor string
+	var prune, asJSON bool
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	flags.StringVar(&file, "file", "unixify.yaml", "Desired state document (.yaml, .yml or .json)")
+	flags.BoolVar(&prune, "prune", false, "Delete groups, accounts, memberships and reservations that are not declared")
+	flags.BoolVar(&asJSON, "json", false, "Print the plan as JSON")
+	flags.StringVar(&actor, "actor", "statesync", "Username recorded in audit entries")
+	flags.Parse(os.Args[2:])
+
+	// Load environment variables
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found, using environment variables")
+	}
+
+	// Load the desired state before touching the database
+	desired, err := state.LoadFile(file)
+	if err != nil {
+		log.Fatalf("Failed to load desired state: %v", err)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	db, err := repository.InitDB(cfg)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	services := service.NewServices(service.Deps{
+		Repos:  repository.NewRepositories(db),
+		DB:     db,
+		SubIDs: service.SubIDPool{Start: cfg.SubIDs.Start, End: cfg.SubIDs.End},
+		Names:  cfg.Names,
+	})
+
+	var plan *state.Plan
+	if command == "plan" {
+		plan, err = services.State.Plan(desired, prune)
+	} else {
+		plan, err = services.State.Apply(desired, prune, 0, actor, "local")
+	}
+	if err != nil {
+		log.Fatalf("Failed to %s desired state: %v", command, err)
+	}
+
+	// Print the result
+	if asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(plan); err != nil {
+			log.Fatalf("Failed to encode plan: %v", err)
+		}
+		return
+	}
+
+	if err := plan.Write(os.Stdout); err != nil {
+		log.Fatalf("Failed to print plan: %v", err)
+	}
+	if command == "apply" && !plan.IsEmpty() {
+		fmt.Println("Apply complete.")
+	}
+}
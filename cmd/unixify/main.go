@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/home/unixify/db/migrations"
+	"github.com/home/unixify/internal/api"
+	"github.com/home/unixify/internal/config"
+	"github.com/home/unixify/internal/events"
+	"github.com/home/unixify/internal/repository"
+	"github.com/home/unixify/internal/service"
+	"github.com/home/unixify/internal/webhook"
+	"github.com/joho/godotenv"
+	"github.com/sirupsen/logrus"
+)
+
+func main() {
+	// Load environment variables
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found, using environment variables")
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	// Bring the schema up to date before anything touches it
+	if cfg.Database.AutoMigrate {
+		log.Println("Applying database migrations")
+		if err := migrations.Up(cfg.Database.GetURL()); err != nil {
+			log.Fatalf("Migration up failed: %v", err)
+		}
+	}
+
+	// Refuse to start against a schema this build does not understand
+	if err := migrations.Check(cfg.Database.GetURL()); err != nil {
+		log.Fatalf("Incompatible database schema: %v", err)
+	}
+
+	db, err := repository.InitDB(cfg)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	// Wire repositories, services and the API server
+	repos := repository.NewRepositories(db)
+	services := service.NewServices(service.Deps{
+		Repos:          repos,
+		DB:             db,
+		SubIDs:         service.SubIDPool{Start: cfg.SubIDs.Start, End: cfg.SubIDs.End},
+		Names:          cfg.Names,
+		WebhookTargets: webhook.NewTargetPolicy(cfg.Webhooks.AllowedTargets),
+	})
+
+	// Feed the live event stream from the event log
+	broker := events.NewBroker(repos.Event, logrus.StandardLogger())
+	if err := broker.Start(); err != nil {
+		log.Fatalf("Failed to read the event log: %v", err)
+	}
+	if cfg.Database.Driver == config.DriverPostgres {
+		go broker.Listen(context.Background(), cfg.Database.GetURL())
+	} else {
+		broker.PollInterval = cfg.Events.PollInterval
+		go broker.Poll(context.Background())
+	}
+
+	server := api.NewServer(cfg, services, broker)
+
+	// Send queued webhook deliveries in the background
+	if cfg.Webhooks.Dispatch {
+		dispatcher := webhook.NewDispatcher(repos.Webhook, logrus.StandardLogger())
+		dispatcher.PollInterval = cfg.Webhooks.PollInterval
+		dispatcher.MaxAttempts = cfg.Webhooks.MaxAttempts
+		dispatcher.Targets = webhook.NewTargetPolicy(cfg.Webhooks.AllowedTargets)
+		go dispatcher.Run(context.Background())
+	}
+
+	if err := server.Run(); err != nil {
+		log.Fatalf("Server stopped: %v", err)
+	}
+}
@@ -0,0 +1,683 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/home/unixify/internal/client"
+	"github.com/home/unixify/internal/models"
+	"golang.org/x/term"
+)
+
+const usageText = `Usage: unixifyctl [-server URL] [-o table|json|passwd] <command> [arguments]
+
+Commands:
+  login [-username NAME]                 Authenticate (prompts for password and TOTP code)
+  logout                                 End the session and forget the stored token
+
+  accounts list [-type TYPE]
+  accounts get <id|username>
+  accounts create (-username NAME | -username-template T) -type TYPE [-uid UID] [-primary-group GROUP] [-firstname F] [-surname S]
+  accounts update <id|username> [-username NAME] [-uid UID] [-type TYPE] [-primary-group GROUP] [-firstname F] [-surname S]
+  accounts delete <id|username>
+  accounts groups <id|username>
+
+  groups list [-type TYPE]
+  groups get <id|groupname>
+  groups create -groupname NAME -type TYPE [-gid GID] [-description TEXT]
+  groups update <id|groupname> [-groupname NAME] [-gid GID] [-type TYPE] [-description TEXT]
+  groups delete <id|groupname>
+  groups members <id|groupname>
+
+  memberships add <account> <group>
+  memberships remove <account> <group>
+
+  search <query>                         Search accounts and groups, best match first
+  search accounts <query>
+  search groups <query>
+
+  audit list [-entity-type TYPE] [-action ACTION] [-entity-id ID] [-user-id ID]
+  audit get <id>
+
+  next-uid <type>
+  next-gid <type>
+
+Without -uid or -gid, create uses the next free ID for the type.
+Queries can filter on fields, such as: search accounts type:service active:false gid:>60000 member-of:dba
+The server and token can also be set with UNIXIFY_SERVER and UNIXIFY_TOKEN.
+`
+
+// app holds the state shared by all commands
+type app struct {
+	client *client.Client
+	out    *printer
+	creds  *credentials
+	server string
+}
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// run parses global options and dispatches to a command
+func run(args []string) error {
+	creds, err := loadCredentials()
+	if err != nil {
+		return fmt.Errorf("failed to load credentials: %w", err)
+	}
+
+	a := &app{creds: creds, out: &printer{w: os.Stdout, format: formatTable}}
+
+	// Parse global options
+	global := flag.NewFlagSet("unixifyctl", flag.ContinueOnError)
+	global.Usage = func() { fmt.Fprint(os.Stderr, usageText) }
+	global.StringVar(&a.server, "server", "", "Unixify server URL")
+	global.StringVar(&a.out.format, "o", formatTable, "Output format: table, json or passwd")
+	if err := global.Parse(args); err != nil {
+		return err
+	}
+	args = global.Args()
+	if len(args) == 0 {
+		global.Usage()
+		os.Exit(2)
+	}
+
+	// Resolve server and token
+	if a.server == "" {
+		a.server = os.Getenv("UNIXIFY_SERVER")
+	}
+	if a.server == "" {
+		a.server = creds.Server
+	}
+	if a.server == "" {
+		a.server = "http://localhost:8080"
+	}
+	token := os.Getenv("UNIXIFY_TOKEN")
+	stored := token == "" && strings.TrimRight(creds.Server, "/") == strings.TrimRight(a.server, "/")
+	if stored {
+		token = creds.Token
+	}
+	a.client = client.New(a.server, token)
+	if stored {
+		// Keep the stored tokens current as the access token expires
+		a.client.RefreshToken = creds.RefreshToken
+		a.client.OnRefresh = func(token, refreshToken string) {
+			creds.Token, creds.RefreshToken = token, refreshToken
+			if err := saveCredentials(creds); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to store refreshed token: %v\n", err)
+			}
+		}
+	}
+
+	command, rest := args[0], args[1:]
+	switch command {
+	case "login":
+		return a.login(rest)
+	case "logout":
+		return a.logout()
+	case "accounts":
+		return a.accounts(rest)
+	case "groups":
+		return a.groups(rest)
+	case "memberships":
+		return a.memberships(rest)
+	case "search":
+		return a.search(rest)
+	case "audit":
+		return a.audit(rest)
+	case "next-uid":
+		if len(rest) != 1 {
+			return fmt.Errorf("usage: unixifyctl next-uid <type>")
+		}
+		uid, err := a.client.NextUID(models.AccountType(rest[0]))
+		if err != nil {
+			return err
+		}
+		return a.out.value("uid", uid)
+	case "next-gid":
+		if len(rest) != 1 {
+			return fmt.Errorf("usage: unixifyctl next-gid <type>")
+		}
+		gid, err := a.client.NextGID(models.GroupType(rest[0]))
+		if err != nil {
+			return err
+		}
+		return a.out.value("gid", gid)
+	case "help":
+		fmt.Print(usageText)
+		return nil
+	}
+
+	return fmt.Errorf("unknown command %q (see unixifyctl help)", command)
+}
+
+// flags creates a flag set for a sub-command that also accepts -o
+func (a *app) flags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.StringVar(&a.out.format, "o", a.out.format, "Output format: table, json or passwd")
+	return fs
+}
+
+// login authenticates and stores the resulting token
+func (a *app) login(args []string) error {
+	fs := a.flags("login")
+	username := fs.String("username", "", "Username")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	if *username == "" {
+		*username = prompt(reader, "Username: ")
+	}
+	password, err := promptSecret(reader, "Password: ")
+	if err != nil {
+		return err
+	}
+
+	result, err := a.client.Login(*username, password)
+	if err != nil {
+		return err
+	}
+
+	// Second factor; anything but a 6-digit code is taken as a recovery code
+	if result.RequiresTOTP {
+		code := prompt(reader, "TOTP code or recovery code: ")
+		if len(code) == 6 && strings.Trim(code, "0123456789") == "" {
+			result, err = a.client.VerifyTOTP(result.TOTPToken, code)
+		} else {
+			result, err = a.client.VerifyRecoveryCode(result.TOTPToken, code)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if result.Token == "" {
+		return fmt.Errorf("server did not return a token")
+	}
+
+	a.creds.Server = a.server
+	a.creds.Username = result.User.Username
+	a.creds.Token = result.Token
+	a.creds.RefreshToken = result.RefreshToken
+	if err := saveCredentials(a.creds); err != nil {
+		return fmt.Errorf("failed to store token: %w", err)
+	}
+
+	fmt.Printf("Logged in to %s as %s (%s)\n", a.server, result.User.Username, result.User.Role)
+	return nil
+}
+
+// logout ends the session of the stored token and removes it
+func (a *app) logout() error {
+	if a.client.Token != "" {
+		if err := a.client.Logout(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: the server did not end the session: %v\n", err)
+		}
+	}
+	if err := removeCredentials(); err != nil {
+		return err
+	}
+	fmt.Println("Logged out")
+	return nil
+}
+
+// accounts dispatches account sub-commands
+func (a *app) accounts(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: unixifyctl accounts <list|get|create|update|delete|groups>")
+	}
+	verb, args := args[0], args[1:]
+
+	switch verb {
+	case "list":
+		fs := a.flags("accounts list")
+		accountType := fs.String("type", "", "Account type")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		accounts, err := a.client.Accounts(models.AccountType(*accountType))
+		if err != nil {
+			return err
+		}
+		return a.out.accounts(accounts)
+
+	case "get", "delete", "groups":
+		fs := a.flags("accounts " + verb)
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		if fs.NArg() != 1 {
+			return fmt.Errorf("usage: unixifyctl accounts %s <id|username>", verb)
+		}
+		account, err := a.resolveAccount(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		switch verb {
+		case "get":
+			return a.out.accounts([]models.Account{*account})
+		case "delete":
+			if err := a.client.DeleteAccount(account.ID, account.Version); err != nil {
+				return err
+			}
+			fmt.Printf("Deleted account %s\n", account.Username)
+			return nil
+		default:
+			groups, err := a.client.AccountGroups(account.ID)
+			if err != nil {
+				return err
+			}
+			return a.out.groups(groups, nil)
+		}
+
+	case "create", "update":
+		fs := a.flags("accounts " + verb)
+		username := fs.String("username", "", "Username")
+		uid := fs.Int("uid", -1, "UID (default: next free UID for the type)")
+		accountType := fs.String("type", "", "Account type: people, system, database or service")
+		primaryGroup := fs.String("primary-group", "", "Primary group ID or groupname")
+		firstname := fs.String("firstname", "", "First name")
+		surname := fs.String("surname", "", "Surname")
+		var usernameTemplate *string
+		if verb == "create" {
+			usernameTemplate = fs.String("username-template", "", "Generate the username from -firstname and -surname, e.g. {f}{surname}")
+		}
+
+		var existing *models.Account
+		if verb == "update" {
+			if len(args) == 0 {
+				return fmt.Errorf("usage: unixifyctl accounts update <id|username> [flags]")
+			}
+			var err error
+			if existing, err = a.resolveAccount(args[0]); err != nil {
+				return err
+			}
+			args = args[1:]
+		}
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+
+		// Start from the existing account so update only changes what was given
+		input := client.AccountInput{UID: -1}
+		if existing != nil {
+			input = client.AccountInput{
+				UID:            existing.UnixUID,
+				Username:       existing.Username,
+				Type:           existing.Type,
+				PrimaryGroupID: existing.PrimaryGroupID,
+				Firstname:      existing.Firstname,
+				Surname:        existing.Surname,
+			}
+		}
+		set := setFlags(fs)
+		if set["username"] {
+			input.Username = *username
+		}
+		if set["uid"] {
+			input.UID = *uid
+		}
+		if set["type"] {
+			input.Type = models.AccountType(*accountType)
+		}
+		if set["firstname"] {
+			input.Firstname = *firstname
+		}
+		if set["surname"] {
+			input.Surname = *surname
+		}
+		if set["primary-group"] {
+			input.PrimaryGroupID = 0
+			if *primaryGroup != "" {
+				group, err := a.resolveGroup(*primaryGroup)
+				if err != nil {
+					return err
+				}
+				input.PrimaryGroupID = group.ID
+			}
+		}
+
+		if usernameTemplate != nil && input.Username == "" {
+			input.UsernameTemplate = *usernameTemplate
+		}
+		if input.Username == "" && input.UsernameTemplate == "" || input.Type == "" {
+			return fmt.Errorf("-username (or -username-template) and -type are required")
+		}
+		if input.UID < 0 {
+			next, err := a.client.NextUID(input.Type)
+			if err != nil {
+				return fmt.Errorf("failed to look up next free UID: %w", err)
+			}
+			input.UID = next
+		}
+
+		var account *models.Account
+		var err error
+		if existing != nil {
+			account, err = a.client.UpdateAccount(existing.ID, existing.Version, input)
+		} else {
+			account, err = a.client.CreateAccount(input)
+		}
+		if err != nil {
+			return err
+		}
+		return a.out.accounts([]models.Account{*account})
+	}
+
+	return fmt.Errorf("unknown accounts command %q", verb)
+}
+
+// groups dispatches group sub-commands
+func (a *app) groups(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: unixifyctl groups <list|get|create|update|delete|members>")
+	}
+	verb, args := args[0], args[1:]
+
+	switch verb {
+	case "list":
+		fs := a.flags("groups list")
+		groupType := fs.String("type", "", "Group type")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		groups, err := a.client.Groups(models.GroupType(*groupType))
+		if err != nil {
+			return err
+		}
+		members, err := a.membersForPasswd(groups)
+		if err != nil {
+			return err
+		}
+		return a.out.groups(groups, members)
+
+	case "get", "delete", "members":
+		fs := a.flags("groups " + verb)
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		if fs.NArg() != 1 {
+			return fmt.Errorf("usage: unixifyctl groups %s <id|groupname>", verb)
+		}
+		group, err := a.resolveGroup(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		switch verb {
+		case "get":
+			members, err := a.membersForPasswd([]models.Group{*group})
+			if err != nil {
+				return err
+			}
+			return a.out.groups([]models.Group{*group}, members)
+		case "delete":
+			if err := a.client.DeleteGroup(group.ID, group.Version); err != nil {
+				return err
+			}
+			fmt.Printf("Deleted group %s\n", group.Groupname)
+			return nil
+		default:
+			accounts, err := a.client.GroupMembers(group.ID)
+			if err != nil {
+				return err
+			}
+			return a.out.accounts(accounts)
+		}
+
+	case "create", "update":
+		fs := a.flags("groups " + verb)
+		groupname := fs.String("groupname", "", "Groupname")
+		gid := fs.Int("gid", -1, "GID (default: next free GID for the type)")
+		groupType := fs.String("type", "", "Group type: people, system, database or service")
+		description := fs.String("description", "", "Description")
+
+		var existing *models.Group
+		if verb == "update" {
+			if len(args) == 0 {
+				return fmt.Errorf("usage: unixifyctl groups update <id|groupname> [flags]")
+			}
+			var err error
+			if existing, err = a.resolveGroup(args[0]); err != nil {
+				return err
+			}
+			args = args[1:]
+		}
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+
+		// Start from the existing group so update only changes what was given
+		input := client.GroupInput{GID: -1}
+		if existing != nil {
+			input = client.GroupInput{
+				GID:         existing.UnixGID,
+				Groupname:   existing.Groupname,
+				Description: existing.Description,
+				Type:        existing.Type,
+			}
+		}
+		set := setFlags(fs)
+		if set["groupname"] {
+			input.Groupname = *groupname
+		}
+		if set["gid"] {
+			input.GID = *gid
+		}
+		if set["type"] {
+			input.Type = models.GroupType(*groupType)
+		}
+		if set["description"] {
+			input.Description = *description
+		}
+
+		if input.Groupname == "" || input.Type == "" {
+			return fmt.Errorf("-groupname and -type are required")
+		}
+		if input.GID < 0 {
+			next, err := a.client.NextGID(input.Type)
+			if err != nil {
+				return fmt.Errorf("failed to look up next free GID: %w", err)
+			}
+			input.GID = next
+		}
+
+		var group *models.Group
+		var err error
+		if existing != nil {
+			group, err = a.client.UpdateGroup(existing.ID, existing.Version, input)
+		} else {
+			group, err = a.client.CreateGroup(input)
+		}
+		if err != nil {
+			return err
+		}
+		return a.out.groups([]models.Group{*group}, nil)
+	}
+
+	return fmt.Errorf("unknown groups command %q", verb)
+}
+
+// memberships dispatches membership sub-commands
+func (a *app) memberships(args []string) error {
+	if len(args) != 3 || (args[0] != "add" && args[0] != "remove") {
+		return fmt.Errorf("usage: unixifyctl memberships <add|remove> <account> <group>")
+	}
+
+	account, err := a.resolveAccount(args[1])
+	if err != nil {
+		return err
+	}
+	group, err := a.resolveGroup(args[2])
+	if err != nil {
+		return err
+	}
+
+	if args[0] == "add" {
+		if err := a.client.AddMembership(account.ID, group.ID); err != nil {
+			return err
+		}
+		fmt.Printf("Added %s to %s\n", account.Username, group.Groupname)
+		return nil
+	}
+
+	if err := a.client.RemoveMembership(account.ID, group.ID); err != nil {
+		return err
+	}
+	fmt.Printf("Removed %s from %s\n", account.Username, group.Groupname)
+	return nil
+}
+
+// search dispatches search sub-commands
+func (a *app) search(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: unixifyctl search [accounts|groups] <query>")
+	}
+	if len(args) == 1 || args[0] != "accounts" && args[0] != "groups" {
+		results, err := a.client.Search(strings.Join(args, " "), 0)
+		if err != nil {
+			return err
+		}
+		return a.out.searchResults(results)
+	}
+	query := strings.Join(args[1:], " ")
+
+	switch args[0] {
+	case "accounts":
+		accounts, err := a.client.SearchAccounts(query)
+		if err != nil {
+			return err
+		}
+		return a.out.accounts(accounts)
+	case "groups":
+		groups, err := a.client.SearchGroups(query)
+		if err != nil {
+			return err
+		}
+		members, err := a.membersForPasswd(groups)
+		if err != nil {
+			return err
+		}
+		return a.out.groups(groups, members)
+	}
+
+	return fmt.Errorf("unknown search target %q", args[0])
+}
+
+// audit dispatches audit sub-commands
+func (a *app) audit(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: unixifyctl audit <list|get>")
+	}
+	verb, args := args[0], args[1:]
+
+	switch verb {
+	case "list":
+		fs := a.flags("audit list")
+		var filter client.AuditFilter
+		var entityID, userID uint
+		fs.StringVar(&filter.EntityType, "entity-type", "", "Entity type (account, group, account_group, ...)")
+		fs.StringVar(&filter.Action, "action", "", "Action (create, update, delete, assign, remove, ...)")
+		fs.UintVar(&entityID, "entity-id", 0, "Entity ID")
+		fs.UintVar(&userID, "user-id", 0, "User ID")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		filter.EntityID = entityID
+		filter.UserID = userID
+		entries, err := a.client.AuditEntries(filter)
+		if err != nil {
+			return err
+		}
+		return a.out.audit(entries)
+
+	case "get":
+		fs := a.flags("audit get")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		id, err := strconv.ParseUint(fs.Arg(0), 10, 64)
+		if fs.NArg() != 1 || err != nil {
+			return fmt.Errorf("usage: unixifyctl audit get <id>")
+		}
+		entry, err := a.client.AuditEntry(uint(id))
+		if err != nil {
+			return err
+		}
+		return a.out.audit([]models.AuditEntry{*entry})
+	}
+
+	return fmt.Errorf("unknown audit command %q", verb)
+}
+
+// resolveAccount looks an account up by numeric ID or username
+func (a *app) resolveAccount(ref string) (*models.Account, error) {
+	if id, err := strconv.ParseUint(ref, 10, 64); err == nil {
+		return a.client.Account(uint(id))
+	}
+	return a.client.AccountByUsername(ref)
+}
+
+// resolveGroup looks a group up by numeric ID or groupname
+func (a *app) resolveGroup(ref string) (*models.Group, error) {
+	if id, err := strconv.ParseUint(ref, 10, 64); err == nil {
+		return a.client.Group(uint(id))
+	}
+	return a.client.GroupByGroupname(ref)
+}
+
+// membersForPasswd fetches group members, which only the passwd format needs
+func (a *app) membersForPasswd(groups []models.Group) (map[uint][]models.Account, error) {
+	if a.out.format != formatPasswd {
+		return nil, nil
+	}
+	members := make(map[uint][]models.Account, len(groups))
+	for _, group := range groups {
+		accounts, err := a.client.GroupMembers(group.ID)
+		if err != nil {
+			return nil, err
+		}
+		members[group.ID] = accounts
+	}
+	return members, nil
+}
+
+// setFlags returns the names of the flags given on the command line
+func setFlags(fs *flag.FlagSet) map[string]bool {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	return set
+}
+
+// prompt reads a line from the terminal
+func prompt(reader *bufio.Reader, label string) string {
+	fmt.Fprint(os.Stderr, label)
+	line, _ := reader.ReadString('\n')
+	return strings.TrimSpace(line)
+}
+
+// promptSecret reads a line without echo when stdin is a terminal
+func promptSecret(reader *bufio.Reader, label string) (string, error) {
+	if password := os.Getenv("UNIXIFY_PASSWORD"); password != "" {
+		return password, nil
+	}
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return prompt(reader, label), nil
+	}
+	fmt.Fprint(os.Stderr, label)
+	secret, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	return string(secret), nil
+}
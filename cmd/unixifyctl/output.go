@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/home/unixify/internal/models"
+)
+
+// Output formats
+const (
+	formatTable  = "table"
+	formatJSON   = "json"
+	formatPasswd = "passwd"
+)
+
+// printer renders API results in the selected output format
+type printer struct {
+	w      io.Writer
+	format string
+}
+
+// check rejects unknown output formats before anything is printed
+func (p *printer) check() error {
+	if p.format != formatTable && p.format != formatJSON && p.format != formatPasswd {
+		return fmt.Errorf("unknown output format %q (expected table, json or passwd)", p.format)
+	}
+	return nil
+}
+
+// json prints any value as indented JSON
+func (p *printer) json(v interface{}) error {
+	encoder := json.NewEncoder(p.w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// accounts prints a list of accounts
+func (p *printer) accounts(accounts []models.Account) error {
+	if err := p.check(); err != nil {
+		return err
+	}
+
+	switch p.format {
+	case formatJSON:
+		return p.json(accounts)
+	case formatPasswd:
+		for _, account := range accounts {
+			if _, err := fmt.Fprintln(p.w, passwdLine(account)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(p.w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tUSERNAME\tUID\tTYPE\tPRIMARY GROUP\tACTIVE\tNAME")
+	for _, account := range accounts {
+		primaryGroup := "-"
+		if account.PrimaryGroup != nil {
+			primaryGroup = fmt.Sprintf("%s (%d)", account.PrimaryGroup.Groupname, account.PrimaryGroup.UnixGID)
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%d\t%s\t%s\t%t\t%s\n", account.ID, account.Username, account.UnixUID,
+			account.Type, primaryGroup, account.Active, strings.TrimSpace(account.Firstname+" "+account.Surname))
+	}
+	return tw.Flush()
+}
+
+// groups prints a list of groups; members is only used for the passwd format
+func (p *printer) groups(groups []models.Group, members map[uint][]models.Account) error {
+	if err := p.check(); err != nil {
+		return err
+	}
+
+	switch p.format {
+	case formatJSON:
+		return p.json(groups)
+	case formatPasswd:
+		for _, group := range groups {
+			if _, err := fmt.Fprintln(p.w, groupLine(group, members[group.ID])); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(p.w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tGROUPNAME\tGID\tTYPE\tACTIVE\tDESCRIPTION")
+	for _, group := range groups {
+		fmt.Fprintf(tw, "%d\t%s\t%d\t%s\t%t\t%s\n", group.ID, group.Groupname, group.UnixGID, group.Type, group.Active, group.Description)
+	}
+	return tw.Flush()
+}
+
+// searchResults prints mixed account and group search results
+func (p *printer) searchResults(results []models.SearchResult) error {
+	if err := p.check(); err != nil {
+		return err
+	}
+
+	switch p.format {
+	case formatJSON:
+		return p.json(results)
+	case formatPasswd:
+		return fmt.Errorf("passwd output is only available for accounts and groups")
+	}
+
+	tw := tabwriter.NewWriter(p.w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "KIND\tID\tNAME\tUID/GID\tTYPE\tMATCHED\tSCORE")
+	for _, result := range results {
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%d\t%s\t%s\t%.2f\n", result.Kind, result.ID, result.Name, result.UnixID,
+			result.Type, result.Field, result.Score)
+	}
+	return tw.Flush()
+}
+
+// audit prints a list of audit entries
+func (p *printer) audit(entries []models.AuditEntry) error {
+	if err := p.check(); err != nil {
+		return err
+	}
+
+	switch p.format {
+	case formatJSON:
+		return p.json(entries)
+	case formatPasswd:
+		return fmt.Errorf("passwd output is only available for accounts and groups")
+	}
+
+	tw := tabwriter.NewWriter(p.w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tTIMESTAMP\tUSER\tACTION\tENTITY\tDETAILS")
+	for _, entry := range entries {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s/%d\t%s\n", entry.ID, entry.Timestamp.Format("2006-01-02 15:04:05"),
+			entry.Username, entry.Action, entry.EntityType, entry.EntityID, entry.Details)
+	}
+	return tw.Flush()
+}
+
+// value prints a single named value such as a next free ID
+func (p *printer) value(name string, value int) error {
+	if err := p.check(); err != nil {
+		return err
+	}
+
+	switch p.format {
+	case formatJSON:
+		return p.json(map[string]int{name: value})
+	case formatPasswd:
+		return fmt.Errorf("passwd output is only available for accounts and groups")
+	}
+	_, err := fmt.Fprintln(p.w, value)
+	return err
+}
+
+// passwdLine formats an account as an /etc/passwd entry
+func passwdLine(account models.Account) string {
+	gid := 0
+	if account.PrimaryGroup != nil {
+		gid = account.PrimaryGroup.UnixGID
+	}
+	gecos := strings.TrimSpace(account.Firstname + " " + account.Surname)
+	return fmt.Sprintf("%s:x:%d:%d:%s:/home/%s:/bin/bash", account.Username, account.UnixUID, gid, gecos, account.Username)
+}
+
+// groupLine formats a group as an /etc/group entry
+func groupLine(group models.Group, members []models.Account) string {
+	names := make([]string, 0, len(members))
+	for _, member := range members {
+		names = append(names, member.Username)
+	}
+	return fmt.Sprintf("%s:x:%d:%s", group.Groupname, group.UnixGID, strings.Join(names, ","))
+}
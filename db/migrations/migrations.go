@@ -0,0 +1,125 @@
+// Package migrations embeds the versioned SQL schema so every binary carries
+// the migrations it was built against. Each database dialect has its own
+// directory, and both must define the same versions.
+package migrations
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	_ "github.com/golang-migrate/migrate/v4/database/sqlite"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+)
+
+//go:embed postgres/*.sql sqlite/*.sql
+var files embed.FS
+
+// open returns the embedded migrations for the dialect of databaseURL
+func open(databaseURL string) (source.Driver, error) {
+	u, err := url.Parse(databaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid database URL: %w", err)
+	}
+
+	var dir string
+	switch u.Scheme {
+	case "postgres", "postgresql":
+		dir = "postgres"
+	case "sqlite":
+		dir = "sqlite"
+	default:
+		return nil, fmt.Errorf("no migrations for database scheme %q", u.Scheme)
+	}
+
+	driver, err := iofs.New(files, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load embedded migrations: %w", err)
+	}
+	return driver, nil
+}
+
+// New creates a migrate instance for the embedded migrations
+func New(databaseURL string) (*migrate.Migrate, error) {
+	driver, err := open(databaseURL)
+	if err != nil {
+		return nil, err
+	}
+	return migrate.NewWithSourceInstance("iofs", driver, databaseURL)
+}
+
+// Latest returns the highest embedded migration version for the dialect of databaseURL
+func Latest(databaseURL string) (uint, error) {
+	driver, err := open(databaseURL)
+	if err != nil {
+		return 0, err
+	}
+	defer driver.Close()
+
+	version, err := driver.First()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		next, err := driver.Next(version)
+		if errors.Is(err, fs.ErrNotExist) {
+			return version, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		version = next
+	}
+}
+
+// Up applies all pending migrations
+func Up(databaseURL string) error {
+	m, err := New(databaseURL)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
+		return err
+	}
+	return nil
+}
+
+// Check verifies that the database schema is exactly the version this build expects.
+// A missing, dirty, older or newer schema is reported as an error.
+func Check(databaseURL string) error {
+	latest, err := Latest(databaseURL)
+	if err != nil {
+		return err
+	}
+
+	m, err := New(databaseURL)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	version, dirty, err := m.Version()
+	if err == migrate.ErrNilVersion {
+		return fmt.Errorf("database has no schema; run the migrate tool or set DB_AUTO_MIGRATE=true")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+	if dirty {
+		return fmt.Errorf("schema version %d is dirty; a migration failed part-way and must be fixed and forced with the migrate tool", version)
+	}
+	if version < latest {
+		return fmt.Errorf("schema version %d is older than version %d required by this build; run the migrate tool or set DB_AUTO_MIGRATE=true", version, latest)
+	}
+	if version > latest {
+		return fmt.Errorf("schema version %d is newer than version %d supported by this build; upgrade unixify", version, latest)
+	}
+	return nil
+}
@@ -0,0 +1,9 @@
+DROP TRIGGER IF EXISTS registered_users_hash_password ON registered_users;
+DROP FUNCTION IF EXISTS hash_registered_user_password();
+
+DROP TABLE IF EXISTS registered_users;
+DROP TABLE IF EXISTS users;
+DROP TABLE IF EXISTS audit_entries;
+DROP TABLE IF EXISTS account_groups;
+DROP TABLE IF EXISTS accounts;
+DROP TABLE IF EXISTS groups;
@@ -0,0 +1,114 @@
+-- Initial Unixify schema: the account registry, the audit log and both user tables
+
+CREATE EXTENSION IF NOT EXISTS pgcrypto;
+
+CREATE TABLE groups (
+    id          BIGSERIAL PRIMARY KEY,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    deleted_at  TIMESTAMPTZ,
+    groupname   TEXT NOT NULL UNIQUE,
+    unixgid     INTEGER NOT NULL UNIQUE,
+    type        TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    active      BOOLEAN NOT NULL DEFAULT TRUE,
+    created_by  TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX idx_groups_deleted_at ON groups (deleted_at);
+CREATE INDEX idx_groups_type ON groups (type);
+
+COMMENT ON COLUMN groups.created_by IS 'Username of the person who created this group';
+
+CREATE TABLE accounts (
+    id               BIGSERIAL PRIMARY KEY,
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    deleted_at       TIMESTAMPTZ,
+    username         TEXT NOT NULL UNIQUE,
+    unixuid          INTEGER NOT NULL UNIQUE,
+    type             TEXT NOT NULL,
+    primary_group_id BIGINT NOT NULL DEFAULT 0,
+    active           BOOLEAN NOT NULL DEFAULT TRUE,
+    firstname        TEXT NOT NULL DEFAULT '',
+    surname          TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX idx_accounts_deleted_at ON accounts (deleted_at);
+CREATE INDEX idx_accounts_type ON accounts (type);
+CREATE INDEX idx_accounts_primary_group_id ON accounts (primary_group_id);
+
+-- Memberships are not foreign keys on purpose: accounts and groups are
+-- hard-deleted by the services, and the doctor repairs anything left behind
+CREATE TABLE account_groups (
+    id         BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    account_id BIGINT NOT NULL,
+    group_id   BIGINT NOT NULL
+);
+
+CREATE INDEX idx_account_groups_account_id ON account_groups (account_id);
+CREATE INDEX idx_account_groups_group_id ON account_groups (group_id);
+
+CREATE TABLE audit_entries (
+    id            BIGSERIAL PRIMARY KEY,
+    timestamp     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    action        TEXT NOT NULL DEFAULT '',
+    resource_id   BIGINT NOT NULL DEFAULT 0,
+    resource_type TEXT NOT NULL DEFAULT '',
+    entity_id     BIGINT NOT NULL DEFAULT 0,
+    entity_type   TEXT NOT NULL DEFAULT '',
+    user_id       BIGINT NOT NULL DEFAULT 0,
+    username      TEXT NOT NULL DEFAULT '',
+    details       TEXT NOT NULL DEFAULT '',
+    section       TEXT NOT NULL DEFAULT '',
+    ip_address    TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX idx_audit_entries_timestamp ON audit_entries (timestamp);
+CREATE INDEX idx_audit_entries_entity ON audit_entries (entity_type, entity_id);
+
+CREATE TABLE users (
+    id           BIGSERIAL PRIMARY KEY,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    username     TEXT NOT NULL UNIQUE,
+    password     TEXT NOT NULL,
+    email        TEXT NOT NULL UNIQUE,
+    role         TEXT NOT NULL DEFAULT 'user',
+    totp_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    totp_secret  TEXT NOT NULL DEFAULT '',
+    last_login   TIMESTAMPTZ
+);
+
+CREATE TABLE registered_users (
+    id            BIGSERIAL PRIMARY KEY,
+    username      TEXT NOT NULL UNIQUE,
+    email         TEXT NOT NULL UNIQUE,
+    password_hash TEXT NOT NULL,
+    first_name    TEXT NOT NULL,
+    last_name     TEXT NOT NULL,
+    department    TEXT NOT NULL DEFAULT '',
+    role          TEXT NOT NULL DEFAULT 'user',
+    totp_enabled  BOOLEAN NOT NULL DEFAULT FALSE,
+    totp_secret   TEXT NOT NULL DEFAULT '',
+    is_active     BOOLEAN NOT NULL DEFAULT TRUE,
+    last_login    TIMESTAMPTZ,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- The repository stores the plain password and relies on this trigger to hash
+-- it, so VerifyPassword can compare with crypt(password, password_hash)
+CREATE FUNCTION hash_registered_user_password() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'INSERT' OR NEW.password_hash IS DISTINCT FROM OLD.password_hash THEN
+        NEW.password_hash := crypt(NEW.password_hash, gen_salt('bf', 10));
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER registered_users_hash_password
+    BEFORE INSERT OR UPDATE OF password_hash ON registered_users
+    FOR EACH ROW EXECUTE FUNCTION hash_registered_user_password();
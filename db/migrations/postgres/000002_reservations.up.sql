@@ -0,0 +1,15 @@
+-- UID and GID ranges held back from allocation
+
+CREATE TABLE reservations (
+    id          BIGSERIAL PRIMARY KEY,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    name        TEXT NOT NULL UNIQUE,
+    kind        TEXT NOT NULL,
+    start       INTEGER NOT NULL,
+    "end"       INTEGER NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    CHECK (start <= "end")
+);
+
+CREATE INDEX idx_reservations_kind ON reservations (kind);
@@ -0,0 +1,10 @@
+-- Event log behind the live event stream. Each event keeps the ID of the
+-- audit entry recorded for the change, so IDs increase with every change.
+
+CREATE TABLE event_records (
+    id         BIGINT PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    type       TEXT NOT NULL,
+    section    TEXT NOT NULL DEFAULT '',
+    payload    TEXT NOT NULL
+);
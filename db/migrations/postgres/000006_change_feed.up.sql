@@ -0,0 +1,39 @@
+-- Change feed: every change to an account, group or membership takes the next
+-- number from change_sequence and stores it in change_seq. Deletions leave a
+-- tombstone with their number instead.
+
+CREATE TABLE change_sequence (
+    id    INTEGER PRIMARY KEY,
+    value BIGINT NOT NULL
+);
+
+ALTER TABLE groups ADD COLUMN change_seq BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE accounts ADD COLUMN change_seq BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE account_groups ADD COLUMN change_seq BIGINT NOT NULL DEFAULT 0;
+
+-- Number the existing records so a full sync from 0 includes them
+UPDATE groups SET change_seq = id;
+UPDATE accounts SET change_seq = id + (SELECT COALESCE(MAX(id), 0) FROM groups);
+UPDATE account_groups SET change_seq = id + (SELECT COALESCE(MAX(id), 0) FROM groups) + (SELECT COALESCE(MAX(id), 0) FROM accounts);
+
+INSERT INTO change_sequence (id, value) VALUES (1,
+    (SELECT COALESCE(MAX(id), 0) FROM groups) +
+    (SELECT COALESCE(MAX(id), 0) FROM accounts) +
+    (SELECT COALESCE(MAX(id), 0) FROM account_groups));
+
+CREATE INDEX idx_groups_change_seq ON groups (change_seq);
+CREATE INDEX idx_accounts_change_seq ON accounts (change_seq);
+CREATE INDEX idx_account_groups_change_seq ON account_groups (change_seq);
+
+CREATE TABLE tombstones (
+    id         BIGSERIAL PRIMARY KEY,
+    change_seq BIGINT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    kind       TEXT NOT NULL,
+    entity_id  BIGINT NOT NULL,
+    name       TEXT NOT NULL DEFAULT '',
+    account_id BIGINT NOT NULL DEFAULT 0,
+    group_id   BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE INDEX idx_tombstones_change_seq ON tombstones (change_seq);
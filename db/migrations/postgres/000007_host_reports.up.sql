@@ -0,0 +1,16 @@
+-- Sync reports sent by host agents, including the drift they found
+
+CREATE TABLE host_reports (
+    id         BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    hostname   TEXT NOT NULL,
+    sequence   BIGINT NOT NULL DEFAULT 0,
+    offline    BOOLEAN NOT NULL DEFAULT FALSE,
+    accounts   INTEGER NOT NULL DEFAULT 0,
+    groups     INTEGER NOT NULL DEFAULT 0,
+    drift      TEXT NOT NULL DEFAULT '[]'
+);
+
+COMMENT ON COLUMN host_reports.drift IS 'JSON array of drift findings';
+
+CREATE INDEX idx_host_reports_hostname ON host_reports (hostname, id);
@@ -0,0 +1,15 @@
+-- NIS netgroups. Triples and nested netgroup names are stored as JSON lists;
+-- the service checks usernames and nested names when a netgroup is saved.
+
+CREATE TABLE netgroups (
+    id          BIGSERIAL PRIMARY KEY,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    name        TEXT NOT NULL UNIQUE,
+    description TEXT NOT NULL DEFAULT '',
+    triples     TEXT NOT NULL DEFAULT '[]',
+    netgroups   TEXT NOT NULL DEFAULT '[]'
+);
+
+COMMENT ON COLUMN netgroups.triples IS 'JSON array of (host, user, domain) triples';
+COMMENT ON COLUMN netgroups.netgroups IS 'JSON array of nested netgroup names';
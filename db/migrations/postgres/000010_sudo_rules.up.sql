@@ -0,0 +1,21 @@
+-- Sudo rules granted to groups or accounts. Like access rules, the group and
+-- account references are not foreign keys; exports skip rules whose group or
+-- account is gone.
+
+CREATE TABLE sudo_rules (
+    id            BIGSERIAL PRIMARY KEY,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    name          TEXT NOT NULL UNIQUE,
+    description   TEXT NOT NULL DEFAULT '',
+    group_id      BIGINT NOT NULL DEFAULT 0,
+    account_id    BIGINT NOT NULL DEFAULT 0,
+    hosts         TEXT NOT NULL DEFAULT '[]',
+    run_as_users  TEXT NOT NULL DEFAULT '[]',
+    run_as_groups TEXT NOT NULL DEFAULT '[]',
+    commands      TEXT NOT NULL DEFAULT '[]',
+    no_passwd     BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+COMMENT ON COLUMN sudo_rules.hosts IS 'JSON array of host names, addresses or +netgroups';
+COMMENT ON COLUMN sudo_rules.commands IS 'JSON array of commands';
@@ -0,0 +1,13 @@
+-- Subordinate UID/GID blocks of people accounts. The same block is used for
+-- /etc/subuid and /etc/subgid. Blocks outlive their account so the IDs are
+-- not handed to someone else while files on hosts still use them.
+
+CREATE TABLE sub_id_ranges (
+    id         BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    account_id BIGINT NOT NULL UNIQUE,
+    start      BIGINT NOT NULL UNIQUE,
+    count      BIGINT NOT NULL
+);
+
+COMMENT ON COLUMN sub_id_ranges.start IS 'First subordinate UID and GID of the block';
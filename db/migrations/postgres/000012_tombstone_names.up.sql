@@ -0,0 +1,4 @@
+-- Look up deleted usernames and groupnames, so generated names are not
+-- handed out again while hosts may still have files owned by them
+
+CREATE INDEX idx_tombstones_kind_name ON tombstones (kind, name);
@@ -0,0 +1,6 @@
+-- pg_trgm stays installed, other objects may depend on it
+
+DROP INDEX IF EXISTS idx_groups_description_trgm;
+DROP INDEX IF EXISTS idx_groups_groupname_trgm;
+DROP INDEX IF EXISTS idx_accounts_name_trgm;
+DROP INDEX IF EXISTS idx_accounts_username_trgm;
@@ -0,0 +1,22 @@
+-- Trigram indexes for search. pg_trgm ships with PostgreSQL's contrib
+-- package, but creating it may take privileges the application lacks;
+-- without it search scans the tables instead.
+
+DO $$
+BEGIN
+    CREATE EXTENSION IF NOT EXISTS pg_trgm;
+EXCEPTION WHEN OTHERS THEN
+    RAISE NOTICE 'pg_trgm is not available (%), search will scan the tables', SQLERRM;
+END
+$$;
+
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'pg_trgm') THEN
+        CREATE INDEX IF NOT EXISTS idx_accounts_username_trgm ON accounts USING gin (lower(username) gin_trgm_ops);
+        CREATE INDEX IF NOT EXISTS idx_accounts_name_trgm ON accounts USING gin (lower(firstname || ' ' || surname) gin_trgm_ops);
+        CREATE INDEX IF NOT EXISTS idx_groups_groupname_trgm ON groups USING gin (lower(groupname) gin_trgm_ops);
+        CREATE INDEX IF NOT EXISTS idx_groups_description_trgm ON groups USING gin (lower(description) gin_trgm_ops);
+    END IF;
+END
+$$;
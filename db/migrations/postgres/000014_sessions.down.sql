@@ -0,0 +1,2 @@
+ALTER TABLE users DROP COLUMN active;
+DROP TABLE IF EXISTS sessions;
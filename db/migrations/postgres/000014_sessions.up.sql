@@ -0,0 +1,21 @@
+-- Logins of users. Access tokens name their session and stop working once
+-- it is revoked; refresh tokens are <key>.<secret> and only the hash of the
+-- current secret is kept, so a rotated token used again is detected.
+
+CREATE TABLE sessions (
+    id          BIGSERIAL PRIMARY KEY,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    user_id     BIGINT NOT NULL,
+    token_key   TEXT NOT NULL UNIQUE,
+    secret_hash TEXT NOT NULL,
+    expires_at  TIMESTAMPTZ NOT NULL,
+    revoked_at  TIMESTAMPTZ,
+    client_ip   TEXT NOT NULL DEFAULT '',
+    user_agent  TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX idx_sessions_user_id ON sessions (user_id);
+
+-- Disabled users cannot log in and lose their sessions
+ALTER TABLE users ADD COLUMN active BOOLEAN NOT NULL DEFAULT TRUE;
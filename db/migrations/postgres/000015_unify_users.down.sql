@@ -0,0 +1,41 @@
+ALTER TABLE merged_registered_users RENAME TO registered_users;
+
+-- Merged users get back the credentials the merge replaced
+UPDATE users u SET
+    password     = r.previous_password,
+    totp_enabled = r.previous_totp_enabled,
+    totp_secret  = r.previous_totp_secret,
+    last_login   = r.previous_last_login
+FROM registered_users r
+WHERE r.merge = 'merged' AND r.user_id = u.id AND r.previous_password IS NOT NULL;
+
+-- Users the merge created are removed, with their sessions
+DELETE FROM sessions
+WHERE user_id IN (SELECT user_id FROM registered_users WHERE merge IN ('renamed', 'created'));
+DELETE FROM users
+WHERE id IN (SELECT user_id FROM registered_users WHERE merge IN ('renamed', 'created'));
+
+ALTER TABLE registered_users DROP COLUMN previous_last_login;
+ALTER TABLE registered_users DROP COLUMN previous_totp_secret;
+ALTER TABLE registered_users DROP COLUMN previous_totp_enabled;
+ALTER TABLE registered_users DROP COLUMN previous_password;
+ALTER TABLE registered_users DROP COLUMN user_id;
+ALTER TABLE registered_users DROP COLUMN merge;
+
+-- The trigger the up migration dropped
+CREATE FUNCTION hash_registered_user_password() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'INSERT' OR NEW.password_hash IS DISTINCT FROM OLD.password_hash THEN
+        NEW.password_hash := crypt(NEW.password_hash, gen_salt('bf', 10));
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER registered_users_hash_password
+    BEFORE INSERT OR UPDATE OF password_hash ON registered_users
+    FOR EACH ROW EXECUTE FUNCTION hash_registered_user_password();
+
+ALTER TABLE users DROP COLUMN department;
+ALTER TABLE users DROP COLUMN last_name;
+ALTER TABLE users DROP COLUMN first_name;
@@ -0,0 +1,79 @@
+-- Users used to be kept twice: in users, which logins use, and in
+-- registered_users, which nothing logs in with any more. Both hold bcrypt
+-- hashes (pgcrypto's crypt() with gen_salt('bf') writes the same $2a$
+-- format), so registered users move to users with their passwords.
+--
+-- Every registered user is merged, by these rules:
+--   merged:  a user has its email, so it is the same person. The user
+--            keeps its username, role and active flag and gains the
+--            profile. The password and TOTP settings come from whichever
+--            of the two logged in last; the user's, if neither did.
+--   renamed: a different user has its username. It becomes a new user
+--            named <username>-registered-<id>.
+--   created: it becomes a new user as it is.
+-- registered_users is kept as merged_registered_users, with the user each
+-- row went to and what it replaced, so the down migration can undo this.
+
+ALTER TABLE users ADD COLUMN first_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN last_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN department TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE registered_users ADD COLUMN merge TEXT;
+ALTER TABLE registered_users ADD COLUMN user_id BIGINT;
+ALTER TABLE registered_users ADD COLUMN previous_password TEXT;
+ALTER TABLE registered_users ADD COLUMN previous_totp_enabled BOOLEAN;
+ALTER TABLE registered_users ADD COLUMN previous_totp_secret TEXT;
+ALTER TABLE registered_users ADD COLUMN previous_last_login TIMESTAMPTZ;
+
+UPDATE registered_users r SET merge = 'merged', user_id = u.id
+FROM users u WHERE u.email = r.email;
+
+UPDATE registered_users r SET merge = 'renamed'
+WHERE r.merge IS NULL AND EXISTS (SELECT 1 FROM users u WHERE u.username = r.username);
+
+UPDATE registered_users SET merge = 'created' WHERE merge IS NULL;
+
+-- Keep what a merge replaces: the user's credentials, when the registered
+-- user logged in last
+UPDATE registered_users r SET
+    previous_password     = u.password,
+    previous_totp_enabled = u.totp_enabled,
+    previous_totp_secret  = u.totp_secret,
+    previous_last_login   = u.last_login
+FROM users u
+WHERE r.merge = 'merged' AND u.id = r.user_id
+  AND r.last_login IS NOT NULL AND (u.last_login IS NULL OR r.last_login > u.last_login);
+
+UPDATE users u SET
+    first_name = r.first_name,
+    last_name  = r.last_name,
+    department = r.department
+FROM registered_users r
+WHERE r.merge = 'merged' AND r.user_id = u.id;
+
+UPDATE users u SET
+    password     = r.password_hash,
+    totp_enabled = r.totp_enabled,
+    totp_secret  = r.totp_secret,
+    last_login   = r.last_login
+FROM registered_users r
+WHERE r.merge = 'merged' AND r.user_id = u.id AND r.previous_password IS NOT NULL;
+
+-- A new name that is taken too stops the migration rather than losing the user
+INSERT INTO users (created_at, updated_at, username, password, email, role, totp_enabled, totp_secret,
+                   active, last_login, first_name, last_name, department)
+SELECT created_at, updated_at,
+       CASE merge WHEN 'renamed' THEN username || '-registered-' || id ELSE username END,
+       password_hash, email, role, totp_enabled, totp_secret,
+       is_active, last_login, first_name, last_name, department
+FROM registered_users
+WHERE merge IN ('renamed', 'created')
+ORDER BY id;
+
+UPDATE registered_users r SET user_id = u.id
+FROM users u WHERE r.merge IN ('renamed', 'created') AND u.email = r.email;
+
+DROP TRIGGER IF EXISTS registered_users_hash_password ON registered_users;
+DROP FUNCTION IF EXISTS hash_registered_user_password();
+
+ALTER TABLE registered_users RENAME TO merged_registered_users;
@@ -0,0 +1,13 @@
+-- Failed logins per username and per client IP address. Every server
+-- counts in this table, so a lockout holds whichever server is asked.
+
+CREATE TABLE login_attempts (
+    id              BIGSERIAL PRIMARY KEY,
+    kind            TEXT NOT NULL,
+    subject         TEXT NOT NULL,
+    failures        INTEGER NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMPTZ NOT NULL,
+    locked_until    TIMESTAMPTZ NOT NULL
+);
+
+CREATE UNIQUE INDEX idx_login_attempts_subject ON login_attempts (kind, subject);
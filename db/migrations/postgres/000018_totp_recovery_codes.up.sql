@@ -0,0 +1,12 @@
+-- One-time codes that stand in for a TOTP code. Only their hashes are
+-- stored; a used code keeps its row, with used_at set.
+
+CREATE TABLE totp_recovery_codes (
+    id         BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    user_id    BIGINT NOT NULL,
+    code_hash  TEXT NOT NULL UNIQUE,
+    used_at    TIMESTAMPTZ
+);
+
+CREATE INDEX idx_totp_recovery_codes_user_id ON totp_recovery_codes (user_id);
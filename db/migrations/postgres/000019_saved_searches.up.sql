@@ -0,0 +1,13 @@
+-- Queries in the query language that users stored under a name. The kind
+-- is what the query runs against: accounts, groups or all.
+
+CREATE TABLE saved_searches (
+    id         BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    user_id    BIGINT NOT NULL,
+    name       TEXT NOT NULL,
+    kind       TEXT NOT NULL,
+    query      TEXT NOT NULL,
+    UNIQUE (user_id, name)
+);
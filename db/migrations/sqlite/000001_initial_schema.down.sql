@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS registered_users;
+DROP TABLE IF EXISTS users;
+DROP TABLE IF EXISTS audit_entries;
+DROP TABLE IF EXISTS account_groups;
+DROP TABLE IF EXISTS accounts;
+DROP TABLE IF EXISTS groups;
@@ -0,0 +1,94 @@
+-- Initial Unixify schema for SQLite; mirrors postgres/000001_initial_schema.up.sql
+
+CREATE TABLE groups (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at  DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at  DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    deleted_at  DATETIME,
+    groupname   TEXT NOT NULL UNIQUE,
+    unixgid     INTEGER NOT NULL UNIQUE,
+    type        TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    active      BOOLEAN NOT NULL DEFAULT TRUE,
+    created_by  TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX idx_groups_deleted_at ON groups (deleted_at);
+CREATE INDEX idx_groups_type ON groups (type);
+
+CREATE TABLE accounts (
+    id               INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at       DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at       DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    deleted_at       DATETIME,
+    username         TEXT NOT NULL UNIQUE,
+    unixuid          INTEGER NOT NULL UNIQUE,
+    type             TEXT NOT NULL,
+    primary_group_id INTEGER NOT NULL DEFAULT 0,
+    active           BOOLEAN NOT NULL DEFAULT TRUE,
+    firstname        TEXT NOT NULL DEFAULT '',
+    surname          TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX idx_accounts_deleted_at ON accounts (deleted_at);
+CREATE INDEX idx_accounts_type ON accounts (type);
+CREATE INDEX idx_accounts_primary_group_id ON accounts (primary_group_id);
+
+CREATE TABLE account_groups (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    account_id INTEGER NOT NULL,
+    group_id   INTEGER NOT NULL
+);
+
+CREATE INDEX idx_account_groups_account_id ON account_groups (account_id);
+CREATE INDEX idx_account_groups_group_id ON account_groups (group_id);
+
+CREATE TABLE audit_entries (
+    id            INTEGER PRIMARY KEY AUTOINCREMENT,
+    timestamp     DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    action        TEXT NOT NULL DEFAULT '',
+    resource_id   INTEGER NOT NULL DEFAULT 0,
+    resource_type TEXT NOT NULL DEFAULT '',
+    entity_id     INTEGER NOT NULL DEFAULT 0,
+    entity_type   TEXT NOT NULL DEFAULT '',
+    user_id       INTEGER NOT NULL DEFAULT 0,
+    username      TEXT NOT NULL DEFAULT '',
+    details       TEXT NOT NULL DEFAULT '',
+    section       TEXT NOT NULL DEFAULT '',
+    ip_address    TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX idx_audit_entries_timestamp ON audit_entries (timestamp);
+CREATE INDEX idx_audit_entries_entity ON audit_entries (entity_type, entity_id);
+
+CREATE TABLE users (
+    id           INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at   DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at   DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    username     TEXT NOT NULL UNIQUE,
+    password     TEXT NOT NULL,
+    email        TEXT NOT NULL UNIQUE,
+    role         TEXT NOT NULL DEFAULT 'user',
+    totp_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    totp_secret  TEXT NOT NULL DEFAULT '',
+    last_login   DATETIME
+);
+
+-- There is no pgcrypto here: the repository hashes password_hash itself
+CREATE TABLE registered_users (
+    id            INTEGER PRIMARY KEY AUTOINCREMENT,
+    username      TEXT NOT NULL UNIQUE,
+    email         TEXT NOT NULL UNIQUE,
+    password_hash TEXT NOT NULL,
+    first_name    TEXT NOT NULL,
+    last_name     TEXT NOT NULL,
+    department    TEXT NOT NULL DEFAULT '',
+    role          TEXT NOT NULL DEFAULT 'user',
+    totp_enabled  BOOLEAN NOT NULL DEFAULT FALSE,
+    totp_secret   TEXT NOT NULL DEFAULT '',
+    is_active     BOOLEAN NOT NULL DEFAULT TRUE,
+    last_login    DATETIME,
+    created_at    DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at    DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,15 @@
+-- UID and GID ranges held back from allocation
+
+CREATE TABLE reservations (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at  DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at  DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    name        TEXT NOT NULL UNIQUE,
+    kind        TEXT NOT NULL,
+    start       INTEGER NOT NULL,
+    "end"       INTEGER NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    CHECK (start <= "end")
+);
+
+CREATE INDEX idx_reservations_kind ON reservations (kind);
@@ -0,0 +1,4 @@
+-- Row versions for optimistic concurrency; served to clients as ETags
+
+ALTER TABLE accounts ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE groups ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,10 @@
+-- Event log behind the live event stream. Each event keeps the ID of the
+-- audit entry recorded for the change, so IDs increase with every change.
+
+CREATE TABLE event_records (
+    id         INTEGER PRIMARY KEY,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    type       TEXT NOT NULL,
+    section    TEXT NOT NULL DEFAULT '',
+    payload    TEXT NOT NULL
+);
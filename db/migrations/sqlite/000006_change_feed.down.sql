@@ -0,0 +1,11 @@
+DROP TABLE IF EXISTS tombstones;
+
+DROP INDEX IF EXISTS idx_account_groups_change_seq;
+DROP INDEX IF EXISTS idx_accounts_change_seq;
+DROP INDEX IF EXISTS idx_groups_change_seq;
+
+ALTER TABLE account_groups DROP COLUMN change_seq;
+ALTER TABLE accounts DROP COLUMN change_seq;
+ALTER TABLE groups DROP COLUMN change_seq;
+
+DROP TABLE IF EXISTS change_sequence;
@@ -0,0 +1,14 @@
+-- Sync reports sent by host agents, including the drift they found
+
+CREATE TABLE host_reports (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    hostname   TEXT NOT NULL,
+    sequence   INTEGER NOT NULL DEFAULT 0,
+    offline    BOOLEAN NOT NULL DEFAULT FALSE,
+    accounts   INTEGER NOT NULL DEFAULT 0,
+    groups     INTEGER NOT NULL DEFAULT 0,
+    drift      TEXT NOT NULL DEFAULT '[]'
+);
+
+CREATE INDEX idx_host_reports_hostname ON host_reports (hostname, id);
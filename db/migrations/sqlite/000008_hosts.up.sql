@@ -0,0 +1,39 @@
+-- Host inventory and the access rules that decide which accounts and groups
+-- each host sees. Like memberships, the references are not foreign keys; the
+-- repository removes a host's or host group's rows together with it.
+
+CREATE TABLE hosts (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at  DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at  DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    hostname    TEXT NOT NULL UNIQUE,
+    description TEXT NOT NULL DEFAULT '',
+    token_hash  TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE host_groups (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at  DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at  DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    name        TEXT NOT NULL UNIQUE,
+    description TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE host_group_members (
+    id            INTEGER PRIMARY KEY AUTOINCREMENT,
+    host_group_id INTEGER NOT NULL,
+    host_id       INTEGER NOT NULL,
+    UNIQUE (host_group_id, host_id)
+);
+
+CREATE INDEX idx_host_group_members_host_id ON host_group_members (host_id);
+
+CREATE TABLE access_rules (
+    id            INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at    DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    host_group_id INTEGER NOT NULL,
+    group_id      INTEGER NOT NULL DEFAULT 0,
+    account_id    INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX idx_access_rules_host_group_id ON access_rules (host_group_id);
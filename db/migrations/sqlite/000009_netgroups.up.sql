@@ -0,0 +1,12 @@
+-- NIS netgroups. Triples and nested netgroup names are stored as JSON lists;
+-- the service checks usernames and nested names when a netgroup is saved.
+
+CREATE TABLE netgroups (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at  DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at  DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    name        TEXT NOT NULL UNIQUE,
+    description TEXT NOT NULL DEFAULT '',
+    triples     TEXT NOT NULL DEFAULT '[]',
+    netgroups   TEXT NOT NULL DEFAULT '[]'
+);
@@ -0,0 +1,18 @@
+-- Sudo rules granted to groups or accounts. Like access rules, the group and
+-- account references are not foreign keys; exports skip rules whose group or
+-- account is gone.
+
+CREATE TABLE sudo_rules (
+    id            INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at    DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at    DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    name          TEXT NOT NULL UNIQUE,
+    description   TEXT NOT NULL DEFAULT '',
+    group_id      INTEGER NOT NULL DEFAULT 0,
+    account_id    INTEGER NOT NULL DEFAULT 0,
+    hosts         TEXT NOT NULL DEFAULT '[]',
+    run_as_users  TEXT NOT NULL DEFAULT '[]',
+    run_as_groups TEXT NOT NULL DEFAULT '[]',
+    commands      TEXT NOT NULL DEFAULT '[]',
+    no_passwd     BOOLEAN NOT NULL DEFAULT FALSE
+);
@@ -0,0 +1,11 @@
+-- Subordinate UID/GID blocks of people accounts. The same block is used for
+-- /etc/subuid and /etc/subgid. Blocks outlive their account so the IDs are
+-- not handed to someone else while files on hosts still use them.
+
+CREATE TABLE sub_id_ranges (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    account_id INTEGER NOT NULL UNIQUE,
+    start      INTEGER NOT NULL UNIQUE,
+    count      INTEGER NOT NULL
+);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_tombstones_kind_name;
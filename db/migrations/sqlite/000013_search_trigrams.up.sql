@@ -0,0 +1,5 @@
+-- SQLite has no trigram indexes; search scans the accounts and groups
+-- tables and ranks them in the application. Kept so both backends share
+-- migration versions.
+
+SELECT 1;
@@ -0,0 +1,27 @@
+ALTER TABLE merged_registered_users RENAME TO registered_users;
+
+-- Merged users get back the credentials the merge replaced
+UPDATE users SET
+    password     = (SELECT r.previous_password FROM registered_users r WHERE r.merge = 'merged' AND r.user_id = users.id),
+    totp_enabled = (SELECT r.previous_totp_enabled FROM registered_users r WHERE r.merge = 'merged' AND r.user_id = users.id),
+    totp_secret  = (SELECT r.previous_totp_secret FROM registered_users r WHERE r.merge = 'merged' AND r.user_id = users.id),
+    last_login   = (SELECT r.previous_last_login FROM registered_users r WHERE r.merge = 'merged' AND r.user_id = users.id)
+WHERE EXISTS (SELECT 1 FROM registered_users r
+              WHERE r.merge = 'merged' AND r.user_id = users.id AND r.previous_password IS NOT NULL);
+
+-- Users the merge created are removed, with their sessions
+DELETE FROM sessions
+WHERE user_id IN (SELECT user_id FROM registered_users WHERE merge IN ('renamed', 'created'));
+DELETE FROM users
+WHERE id IN (SELECT user_id FROM registered_users WHERE merge IN ('renamed', 'created'));
+
+ALTER TABLE registered_users DROP COLUMN previous_last_login;
+ALTER TABLE registered_users DROP COLUMN previous_totp_secret;
+ALTER TABLE registered_users DROP COLUMN previous_totp_enabled;
+ALTER TABLE registered_users DROP COLUMN previous_password;
+ALTER TABLE registered_users DROP COLUMN user_id;
+ALTER TABLE registered_users DROP COLUMN merge;
+
+ALTER TABLE users DROP COLUMN department;
+ALTER TABLE users DROP COLUMN last_name;
+ALTER TABLE users DROP COLUMN first_name;
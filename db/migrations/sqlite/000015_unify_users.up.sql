@@ -0,0 +1,77 @@
+-- Users used to be kept twice: in users, which logins use, and in
+-- registered_users, which nothing logs in with any more. Both hold bcrypt
+-- hashes (pgcrypto's crypt() with gen_salt('bf') writes the same $2a$
+-- format), so registered users move to users with their passwords.
+--
+-- Every registered user is merged, by these rules:
+--   merged:  a user has its email, so it is the same person. The user
+--            keeps its username, role and active flag and gains the
+--            profile. The password and TOTP settings come from whichever
+--            of the two logged in last; the user's, if neither did.
+--   renamed: a different user has its username. It becomes a new user
+--            named <username>-registered-<id>.
+--   created: it becomes a new user as it is.
+-- registered_users is kept as merged_registered_users, with the user each
+-- row went to and what it replaced, so the down migration can undo this.
+
+ALTER TABLE users ADD COLUMN first_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN last_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN department TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE registered_users ADD COLUMN merge TEXT;
+ALTER TABLE registered_users ADD COLUMN user_id BIGINT;
+ALTER TABLE registered_users ADD COLUMN previous_password TEXT;
+ALTER TABLE registered_users ADD COLUMN previous_totp_enabled BOOLEAN;
+ALTER TABLE registered_users ADD COLUMN previous_totp_secret TEXT;
+ALTER TABLE registered_users ADD COLUMN previous_last_login DATETIME;
+
+UPDATE registered_users SET
+    merge   = 'merged',
+    user_id = (SELECT u.id FROM users u WHERE u.email = registered_users.email)
+WHERE EXISTS (SELECT 1 FROM users u WHERE u.email = registered_users.email);
+
+UPDATE registered_users SET merge = 'renamed'
+WHERE merge IS NULL AND EXISTS (SELECT 1 FROM users u WHERE u.username = registered_users.username);
+
+UPDATE registered_users SET merge = 'created' WHERE merge IS NULL;
+
+-- Keep what a merge replaces: the user's credentials, when the registered
+-- user logged in last
+UPDATE registered_users SET
+    previous_password     = (SELECT u.password FROM users u WHERE u.id = registered_users.user_id),
+    previous_totp_enabled = (SELECT u.totp_enabled FROM users u WHERE u.id = registered_users.user_id),
+    previous_totp_secret  = (SELECT u.totp_secret FROM users u WHERE u.id = registered_users.user_id),
+    previous_last_login   = (SELECT u.last_login FROM users u WHERE u.id = registered_users.user_id)
+WHERE merge = 'merged' AND last_login IS NOT NULL
+  AND EXISTS (SELECT 1 FROM users u WHERE u.id = registered_users.user_id
+              AND (u.last_login IS NULL OR julianday(registered_users.last_login) > julianday(u.last_login)));
+
+UPDATE users SET
+    first_name = (SELECT r.first_name FROM registered_users r WHERE r.merge = 'merged' AND r.user_id = users.id),
+    last_name  = (SELECT r.last_name FROM registered_users r WHERE r.merge = 'merged' AND r.user_id = users.id),
+    department = (SELECT r.department FROM registered_users r WHERE r.merge = 'merged' AND r.user_id = users.id)
+WHERE EXISTS (SELECT 1 FROM registered_users r WHERE r.merge = 'merged' AND r.user_id = users.id);
+
+UPDATE users SET
+    password     = (SELECT CAST(r.password_hash AS TEXT) FROM registered_users r WHERE r.merge = 'merged' AND r.user_id = users.id),
+    totp_enabled = (SELECT r.totp_enabled FROM registered_users r WHERE r.merge = 'merged' AND r.user_id = users.id),
+    totp_secret  = (SELECT r.totp_secret FROM registered_users r WHERE r.merge = 'merged' AND r.user_id = users.id),
+    last_login   = (SELECT r.last_login FROM registered_users r WHERE r.merge = 'merged' AND r.user_id = users.id)
+WHERE EXISTS (SELECT 1 FROM registered_users r
+              WHERE r.merge = 'merged' AND r.user_id = users.id AND r.previous_password IS NOT NULL);
+
+-- A new name that is taken too stops the migration rather than losing the user
+INSERT INTO users (created_at, updated_at, username, password, email, role, totp_enabled, totp_secret,
+                   active, last_login, first_name, last_name, department)
+SELECT created_at, updated_at,
+       CASE merge WHEN 'renamed' THEN username || '-registered-' || id ELSE username END,
+       CAST(password_hash AS TEXT), email, role, totp_enabled, totp_secret,
+       is_active, last_login, first_name, last_name, department
+FROM registered_users
+WHERE merge IN ('renamed', 'created')
+ORDER BY id;
+
+UPDATE registered_users SET user_id = (SELECT u.id FROM users u WHERE u.email = registered_users.email)
+WHERE merge IN ('renamed', 'created');
+
+ALTER TABLE registered_users RENAME TO merged_registered_users;
@@ -0,0 +1,15 @@
+-- Logins that passed the password check and wait for a TOTP code. The
+-- token handed out is only stored hashed, and allows a few codes.
+
+CREATE TABLE totp_challenges (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    user_id    BIGINT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    attempts   INTEGER NOT NULL DEFAULT 0,
+    expires_at DATETIME NOT NULL
+);
+
+-- Time step of the last TOTP code each user logged in with; codes of that
+-- step or earlier are refused, so a code cannot be replayed
+ALTER TABLE users ADD COLUMN totp_last_step BIGINT NOT NULL DEFAULT 0;
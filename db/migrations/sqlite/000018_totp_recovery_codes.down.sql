@@ -0,0 +1 @@
+DROP TABLE IF EXISTS totp_recovery_codes;
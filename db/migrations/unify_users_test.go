@@ -0,0 +1,140 @@
+package migrations
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// migrateTo moves a SQLite database to a schema version
+func migrateTo(t *testing.T, databaseURL string, version uint) {
+	t.Helper()
+	m, err := New(databaseURL)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer m.Close()
+	if err := m.Migrate(version); err != nil {
+		t.Fatalf("Migrate(%d): %v", version, err)
+	}
+}
+
+// exec runs statements on the database or fails the test
+func exec(t *testing.T, db *sql.DB, statements ...string) {
+	t.Helper()
+	for _, statement := range statements {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatalf("%s: %v", statement, err)
+		}
+	}
+}
+
+// dump returns every row of a table, ordered by ID, as text
+func dump(t *testing.T, db *sql.DB, table string) []string {
+	t.Helper()
+	rows, err := db.Query("SELECT * FROM " + table + " ORDER BY id")
+	if err != nil {
+		t.Fatalf("Query %s: %v", table, err)
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		t.Fatalf("Columns: %v", err)
+	}
+	var dumped []string
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			t.Fatalf("Scan: %v", err)
+		}
+		dumped = append(dumped, fmt.Sprintf("%v %v", columns, values))
+	}
+	return dumped
+}
+
+// mergedUser is the part of a users row the merge decides
+type mergedUser struct {
+	Username, Email, Password, Role, FirstName string
+}
+
+func TestUnifyUsers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "unixify.db")
+	databaseURL := "sqlite://" + path
+	migrateTo(t, databaseURL, 14)
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+	exec(t, db,
+		`INSERT INTO users (username, password, email, role, last_login) VALUES
+			('alice', 'u-alice', 'alice@example.com', 'admin', '2024-02-01 00:00:00'),
+			('carol', 'u-carol', 'carol@example.com', 'user', '2024-02-01 00:00:00'),
+			('dave', 'u-dave', 'dave@example.com', 'user', NULL)`,
+		`INSERT INTO registered_users (username, email, password_hash, first_name, last_name, role, last_login) VALUES
+			('alice', 'alice@example.com', 'r-alice', 'Alice', 'Smith', 'user', '2024-01-01 00:00:00'),
+			('caz', 'carol@example.com', 'r-carol', 'Carol', 'Jones', 'admin', '2024-03-01 00:00:00'),
+			('dave', 'dave2@example.com', 'r-dave', 'David', 'Brown', 'user', NULL),
+			('erin', 'erin@example.com', 'r-erin', 'Erin', 'White', 'user', NULL)`,
+	)
+
+	users, registered := dump(t, db, "users"), dump(t, db, "registered_users")
+
+	migrateTo(t, databaseURL, 15)
+
+	rows, err := db.Query(`SELECT username, email, password, role, first_name FROM users ORDER BY id`)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	defer rows.Close()
+	var got []mergedUser
+	for rows.Next() {
+		var user mergedUser
+		if err := rows.Scan(&user.Username, &user.Email, &user.Password, &user.Role, &user.FirstName); err != nil {
+			t.Fatalf("Scan: %v", err)
+		}
+		got = append(got, user)
+	}
+	want := []mergedUser{
+		// Same email: the profile moves over, the password of the last login wins
+		{"alice", "alice@example.com", "u-alice", "admin", "Alice"},
+		{"carol", "carol@example.com", "r-carol", "user", "Carol"},
+		{"dave", "dave@example.com", "u-dave", "user", ""},
+		// A different person with a taken username is renamed
+		{"dave-registered-3", "dave2@example.com", "r-dave", "user", "David"},
+		{"erin", "erin@example.com", "r-erin", "user", "Erin"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("users = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("user %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	var unlinked int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM merged_registered_users WHERE user_id IS NULL`).Scan(&unlinked); err != nil || unlinked != 0 {
+		t.Errorf("registered users without a user = %d, %v", unlinked, err)
+	}
+
+	// Rolling back restores both tables as they were
+	exec(t, db, `INSERT INTO sessions (user_id, token_key, secret_hash, expires_at) VALUES (5, 'k', 'h', '2030-01-01 00:00:00')`)
+	migrateTo(t, databaseURL, 14)
+	if got := dump(t, db, "users"); !reflect.DeepEqual(got, users) {
+		t.Errorf("users after down:\n%v\nwant:\n%v", got, users)
+	}
+	if got := dump(t, db, "registered_users"); !reflect.DeepEqual(got, registered) {
+		t.Errorf("registered_users after down:\n%v\nwant:\n%v", got, registered)
+	}
+	if sessions := dump(t, db, "sessions"); len(sessions) != 0 {
+		t.Errorf("sessions of removed users = %v", sessions)
+	}
+}
@@ -0,0 +1,302 @@
+// Package agent keeps a host's passwd, group and shadow files in sync with the
+// registry. It only manages entries with IDs in its configured ranges and
+// works from a local cache when the server is unreachable.
+package agent
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/home/unixify/internal/client"
+	"github.com/home/unixify/internal/idrange"
+	"github.com/home/unixify/internal/models"
+	"github.com/home/unixify/internal/nss"
+	"github.com/sirupsen/logrus"
+)
+
+// Agent materializes registry accounts and groups on a host
+type Agent struct {
+	client   *client.Client
+	hostname string
+	logger   *logrus.Logger
+
+	// Root is the directory that holds the host's etc/; / on a real host
+	Root string
+	// CachePath is where the local replica of the registry is kept
+	CachePath string
+	// Ranges are the UIDs and GIDs the agent manages; nothing outside is touched
+	Ranges idrange.Ranges
+	// Home is the parent directory of home directories
+	Home string
+	// Shell is the login shell of active accounts
+	Shell string
+	// InactiveShell is the login shell of inactive accounts
+	InactiveShell string
+	// DefaultGID is the primary GID of accounts without a primary group
+	DefaultGID int
+	// Interval is the time between syncs in Run
+	Interval time.Duration
+	// PageSize is the number of changes fetched per request
+	PageSize int
+	// DryRun reports what would change without writing anything
+	DryRun bool
+}
+
+// New creates an agent that manages the people UID range of the host at root
+func New(api *client.Client, hostname, root string, logger *logrus.Logger) *Agent {
+	return &Agent{
+		client:        api,
+		hostname:      hostname,
+		logger:        logger,
+		Root:          root,
+		CachePath:     filepath.Join(root, "var/lib/unixify-agent/cache.json"),
+		Ranges:        idrange.Ranges{{Start: 1000, End: 60000}},
+		Home:          nss.DefaultHome,
+		Shell:         nss.DefaultShell,
+		InactiveShell: nss.DefaultInactiveShell,
+		DefaultGID:    nss.DefaultGID,
+		Interval:      5 * time.Minute,
+		PageSize:      1000,
+	}
+}
+
+// Run syncs every Interval until the context is cancelled
+func (a *Agent) Run(ctx context.Context) {
+	ticker := time.NewTicker(a.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := a.Sync(); err != nil {
+			a.logger.Errorf("Sync failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sync brings the cache up to date, rewrites the host's files from it and
+// reports the result, including any drift found, to the server. When the
+// server cannot be reached the files are rebuilt from the cache and nothing
+// is reported.
+func (a *Agent) Sync() (*models.HostReport, error) {
+	cache, err := LoadCache(a.CachePath)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &models.HostReport{Hostname: a.hostname}
+
+	// With a host token only the records the host's access rules allow are
+	// written. The feed leaves out records outside the scope, so when the
+	// scope widens the feed is read again from the start for the records it
+	// skipped. The access is fetched before the feed: a rule added in between
+	// widens the scope on the next sync.
+	var scope *Scope
+	if a.client.HostToken != "" {
+		access, err := a.client.HostAccess()
+		if err != nil {
+			a.logger.Warnf("Failed to fetch the host's access, using the cached scope: %v", err)
+			report.Offline = true
+		} else {
+			scope = NewScope(access)
+			if cache.Scope != nil && scope.Widens(cache.Scope) {
+				a.logger.Infof("The host's access widened, fetching the registry again")
+				if fresh, err := cache.Refetch(a.client, a.PageSize); err != nil {
+					// The cached scope is kept, so the next sync tries again
+					a.logger.Warnf("Failed to fetch the registry again, using the cache: %v", err)
+					report.Offline = true
+					scope = nil
+				} else {
+					cache = fresh
+				}
+			}
+		}
+	}
+
+	if err := cache.Pull(a.client, a.PageSize); err != nil {
+		if cache.Sequence == 0 {
+			return nil, fmt.Errorf("failed to fetch the registry and there is no cache: %w", err)
+		}
+		a.logger.Warnf("Failed to fetch changes, using the cache at sequence %d: %v", cache.Sequence, err)
+		report.Offline = true
+	}
+	report.Sequence = cache.Sequence
+
+	// The last known scope is used while the server is unreachable
+	if a.client.HostToken != "" {
+		if scope != nil {
+			cache.Scope = scope
+		}
+		if cache.Scope == nil {
+			return nil, fmt.Errorf("failed to fetch the host's access and there is no cached scope")
+		}
+	} else {
+		cache.Scope = nil
+	}
+
+	written, err := a.apply(cache, report)
+	if err != nil {
+		return nil, err
+	}
+	for _, finding := range report.Drift {
+		a.logger.Warnf("Drift: %s", finding.Message)
+	}
+	if a.DryRun {
+		return report, nil
+	}
+
+	cache.Written = written
+	if err := cache.Save(a.CachePath); err != nil {
+		return nil, err
+	}
+
+	if !report.Offline {
+		send := a.client.ReportHost
+		if a.client.HostToken != "" {
+			send = a.client.ReportSelf
+		}
+		if err := send(report); err != nil {
+			a.logger.Warnf("Failed to send the sync report: %v", err)
+		}
+	}
+	a.logger.Infof("Synced %d accounts and %d groups at sequence %d", report.Accounts, report.Groups, report.Sequence)
+	return report, nil
+}
+
+// apply rewrites the host's files from the cache, adds the counts and drift
+// to the report and returns the registry lines now in each file
+func (a *Agent) apply(cache *Cache, report *models.HostReport) (map[string]map[string]string, error) {
+	etc := filepath.Join(a.Root, "etc")
+	paths := map[string]string{
+		passwdFile: filepath.Join(etc, passwdFile),
+		groupFile:  filepath.Join(etc, groupFile),
+		shadowFile: filepath.Join(etc, shadowFile),
+	}
+
+	// Lock and read the files
+	current := make(map[string][]string)
+	for _, file := range []string{passwdFile, groupFile, shadowFile} {
+		if !a.DryRun {
+			unlock, err := lockFile(paths[file])
+			if err != nil {
+				return nil, err
+			}
+			defer unlock()
+		}
+		lines, err := readLines(paths[file])
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", paths[file], err)
+		}
+		current[file] = lines
+	}
+
+	// Accounts first: groups only list members that made it into passwd
+	accounts, skipped := a.passwdEntries(cache)
+	passwd := merge(passwdFile, current[passwdFile], passwdFields, accounts, a.Ranges, cache.Written[passwdFile])
+	groups, skippedGroups := a.groupEntries(cache, passwd.written)
+	group := merge(groupFile, current[groupFile], groupFields, groups, a.Ranges, cache.Written[groupFile])
+
+	// Shadow entries follow the accounts in passwd
+	active := make(map[string]bool)
+	for _, account := range cache.Accounts {
+		if _, ok := passwd.written[account.Username]; ok {
+			active[account.Username] = account.Active
+		}
+	}
+	removed := make(map[string]bool)
+	names := passwd.names(passwdFields)
+	for name := range cache.Written[passwdFile] {
+		if !names[name] {
+			removed[name] = true
+		}
+	}
+	shadow := mergeShadow(current[shadowFile], active, removed, time.Now().Unix()/86400)
+
+	report.Accounts = len(passwd.written)
+	report.Groups = len(group.written)
+	report.Drift = append(append(append(skipped, passwd.drift...), skippedGroups...), group.drift...)
+
+	// Write the files that changed
+	updated := map[string][]string{passwdFile: passwd.lines, groupFile: group.lines, shadowFile: shadow}
+	modes := map[string]os.FileMode{passwdFile: 0644, groupFile: 0644, shadowFile: 0640}
+	for _, file := range []string{passwdFile, groupFile, shadowFile} {
+		data := joinLines(updated[file])
+		if bytes.Equal(data, joinLines(current[file])) {
+			continue
+		}
+		if a.DryRun {
+			a.logger.Infof("Would update %s", paths[file])
+			continue
+		}
+		if err := writeFile(paths[file], data, modes[file]); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", paths[file], err)
+		}
+		a.logger.Infof("Updated %s", paths[file])
+	}
+
+	return map[string]map[string]string{passwdFile: passwd.written, groupFile: group.written}, nil
+}
+
+// passwdEntries returns the passwd lines of the cached accounts, and
+// conflicts for accounts that cannot be written safely
+func (a *Agent) passwdEntries(cache *Cache) ([]entry, []models.DriftFinding) {
+	options := nss.Options{Home: a.Home, Shell: a.Shell, InactiveShell: a.InactiveShell, DefaultGID: a.DefaultGID}
+	var entries []entry
+	var skipped []models.DriftFinding
+	for _, account := range cache.Accounts {
+		if !a.Ranges.Contains(account.UnixUID) || !cache.Scope.Account(account.ID) {
+			continue
+		}
+		if !nss.ValidName(account.Username) {
+			skipped = append(skipped, models.DriftFinding{Kind: models.DriftConflict, File: passwdFile, Name: account.Username, ID: account.UnixUID,
+				Message: fmt.Sprintf("passwd %q (%d) is not written: the name is not valid in passwd", account.Username, account.UnixUID)})
+			continue
+		}
+		line := options.Passwd(account, cache.Groups).String()
+		entries = append(entries, entry{name: account.Username, id: account.UnixUID, line: line})
+	}
+	sortFindings(skipped)
+	return entries, skipped
+}
+
+// groupEntries returns the group lines of the cached groups. Members are the
+// accounts in written, the registry accounts that are in passwd.
+func (a *Agent) groupEntries(cache *Cache, written map[string]string) ([]entry, []models.DriftFinding) {
+	members := make(map[uint][]string)
+	for _, membership := range cache.Memberships {
+		account, ok := cache.Accounts[membership.AccountID]
+		if _, inPasswd := written[account.Username]; ok && inPasswd {
+			members[membership.GroupID] = append(members[membership.GroupID], account.Username)
+		}
+	}
+
+	var entries []entry
+	var skipped []models.DriftFinding
+	for _, group := range cache.Groups {
+		if !a.Ranges.Contains(group.UnixGID) || !cache.Scope.Group(group.ID) {
+			continue
+		}
+		if !nss.ValidName(group.Groupname) {
+			skipped = append(skipped, models.DriftFinding{Kind: models.DriftConflict, File: groupFile, Name: group.Groupname, ID: group.UnixGID,
+				Message: fmt.Sprintf("group %q (%d) is not written: the name is not valid in group", group.Groupname, group.UnixGID)})
+			continue
+		}
+		line := nss.Group(group, members[group.ID]).String()
+		entries = append(entries, entry{name: group.Groupname, id: group.UnixGID, line: line})
+	}
+	sortFindings(skipped)
+	return entries, skipped
+}
+
+// sortFindings orders findings by ID
+func sortFindings(findings []models.DriftFinding) {
+	sort.Slice(findings, func(i, j int) bool { return findings[i].ID < findings[j].ID })
+}
@@ -0,0 +1,274 @@
+package agent
+
+import (
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/home/unixify/internal/client"
+	"github.com/home/unixify/internal/handlers"
+	"github.com/home/unixify/internal/models"
+	"github.com/home/unixify/internal/repository/memory"
+	"github.com/home/unixify/internal/service"
+	"github.com/sirupsen/logrus"
+)
+
+// Local entries of the test host; only carol is in the managed range
+var localPasswd = []string{
+	"root:x:0:0:root:/root:/bin/bash",
+	"bob:x:900:900:Local Bob:/home/bob:/bin/sh",
+	"carol:x:1500:100:Carol:/home/carol:/bin/bash",
+	"+@netadmins",
+}
+
+// readFile returns the lines of a file under the test root
+func readFile(t *testing.T, root, name string) []string {
+	t.Helper()
+	lines, err := readLines(filepath.Join(root, "etc", name))
+	if err != nil {
+		t.Fatalf("read %s: %v", name, err)
+	}
+	return lines
+}
+
+// findLine returns the line for name in lines, or ""
+func findLine(lines []string, name string) string {
+	for _, line := range lines {
+		if strings.HasPrefix(line, name+":") {
+			return line
+		}
+	}
+	return ""
+}
+
+// driftKinds lists the kind and name of every finding
+func driftKinds(report *models.HostReport) string {
+	kinds := []string{}
+	for _, finding := range report.Drift {
+		kinds = append(kinds, finding.Kind+" "+finding.File+" "+finding.Name)
+	}
+	return strings.Join(kinds, ", ")
+}
+
+func TestAgentSyncsManagedRangeOnly(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	services := service.NewServices(service.Deps{Repos: memory.NewRepositories()})
+	h := handlers.NewHandler(services, nil, logger)
+	router := gin.New()
+	router.GET("/api/changes", h.GetChanges)
+	router.POST("/api/hosts/reports", h.ReportHost)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	// A host with local users, a NIS compat line and a shadow entry for root
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "etc"), 0755)
+	os.WriteFile(filepath.Join(root, "etc", "passwd"), joinLines(localPasswd), 0644)
+	os.WriteFile(filepath.Join(root, "etc", "shadow"), []byte("root:$6$root:19000:0:99999:7:::\n"), 0640)
+
+	staff := &models.Group{UnixGID: 1000, Groupname: "staff", Type: models.GroupTypePeople}
+	daemons := &models.Group{UnixGID: 10, Groupname: "daemons", Type: models.GroupTypeSystem}
+	for _, group := range []*models.Group{staff, daemons} {
+		if err := services.Group.CreateGroup(group, 1, "admin", "127.0.0.1"); err != nil {
+			t.Fatalf("CreateGroup: %v", err)
+		}
+	}
+	alice := &models.Account{UnixUID: 1001, Username: "alice", Type: models.AccountTypePeople, PrimaryGroupID: staff.ID, Firstname: "Alice"}
+	bob := &models.Account{UnixUID: 1002, Username: "bob", Type: models.AccountTypePeople}
+	for _, account := range []*models.Account{alice, bob} {
+		if err := services.Account.CreateAccount(account, 1, "admin", "127.0.0.1"); err != nil {
+			t.Fatalf("CreateAccount: %v", err)
+		}
+	}
+	if err := services.Account.AssignAccountToGroup(alice.ID, staff.ID, 1, "admin", "127.0.0.1"); err != nil {
+		t.Fatalf("AssignAccountToGroup: %v", err)
+	}
+
+	a := New(client.New(server.URL, ""), "web1", root, logger)
+	a.PageSize = 2
+
+	// First sync: alice and staff are written; bob clashes with the local bob
+	// and carol is reported but kept
+	report, err := a.Sync()
+	if err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	passwd := readFile(t, root, "passwd")
+	if got := strings.Join(passwd, "\n"); got != strings.Join(localPasswd, "\n")+"\nalice:x:1001:1000:Alice:/home/alice:/bin/bash" {
+		t.Errorf("passwd after first sync:\n%s", got)
+	}
+	if got := strings.Join(readFile(t, root, "group"), "\n"); got != "staff:x:1000:alice" {
+		t.Errorf("group after first sync: %q", got)
+	}
+	shadow := readFile(t, root, "shadow")
+	if len(shadow) != 2 || shadow[0] != "root:$6$root:19000:0:99999:7:::" || !strings.HasPrefix(shadow[1], "alice:!:") {
+		t.Errorf("shadow after first sync: %q", shadow)
+	}
+	if got := driftKinds(report); got != "conflict passwd bob, unmanaged passwd carol" {
+		t.Errorf("first sync drift = %s", got)
+	}
+	if report.Accounts != 1 || report.Groups != 1 || report.Offline {
+		t.Errorf("unexpected report %+v", report)
+	}
+	if stored, _ := services.Host.GetHostReports("web1", 10); len(stored) != 1 || len(stored[0].Drift) != 2 {
+		t.Errorf("server has reports %+v", stored)
+	}
+
+	// Local edits to managed entries: alice's shell changes, which is drift,
+	// and her password, which is not
+	passwd[len(passwd)-1] = "alice:x:1001:1000:Alice:/home/alice:/bin/zsh"
+	os.WriteFile(filepath.Join(root, "etc", "passwd"), joinLines(passwd), 0644)
+	shadow[1] = strings.Replace(shadow[1], ":!:", ":$6$alice:", 1)
+	os.WriteFile(filepath.Join(root, "etc", "shadow"), joinLines(shadow), 0640)
+
+	dave := &models.Account{UnixUID: 1003, Username: "dave", Type: models.AccountTypePeople}
+	if err := services.Account.CreateAccount(dave, 1, "admin", "127.0.0.1"); err != nil {
+		t.Fatalf("CreateAccount: %v", err)
+	}
+	if report, err = a.Sync(); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	passwd = readFile(t, root, "passwd")
+	if findLine(passwd, "alice") != "alice:x:1001:1000:Alice:/home/alice:/bin/bash" || findLine(passwd, "dave") == "" {
+		t.Errorf("passwd after second sync: %q", passwd)
+	}
+	if line := findLine(readFile(t, root, "shadow"), "alice"); !strings.HasPrefix(line, "alice:$6$alice:") {
+		t.Errorf("local password was not kept: %q", line)
+	}
+	if got := driftKinds(report); got != "conflict passwd bob, unmanaged passwd carol, modified passwd alice" {
+		t.Errorf("second sync drift = %s", got)
+	}
+
+	// Deleting alice in the registry removes her everywhere
+	if err := services.Account.DeleteAccount(alice.ID, 0, 1, "admin", "127.0.0.1"); err != nil {
+		t.Fatalf("DeleteAccount: %v", err)
+	}
+	if _, err = a.Sync(); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if line := findLine(readFile(t, root, "passwd"), "alice"); line != "" {
+		t.Errorf("deleted account is still in passwd: %q", line)
+	}
+	if line := findLine(readFile(t, root, "shadow"), "alice"); line != "" {
+		t.Errorf("deleted account is still in shadow: %q", line)
+	}
+	if got := strings.Join(readFile(t, root, "group"), "\n"); got != "staff:x:1000:" {
+		t.Errorf("group after delete: %q", got)
+	}
+
+	// Offline: dave is restored from the cache after a local userdel
+	server.Close()
+	passwd = readFile(t, root, "passwd")
+	os.WriteFile(filepath.Join(root, "etc", "passwd"), joinLines(passwd[:len(passwd)-1]), 0644)
+	if report, err = a.Sync(); err != nil {
+		t.Fatalf("offline Sync: %v", err)
+	}
+	if !report.Offline || findLine(readFile(t, root, "passwd"), "dave") == "" {
+		t.Errorf("offline sync did not restore dave: %+v", report)
+	}
+	if got := driftKinds(report); got != "conflict passwd bob, unmanaged passwd carol, missing passwd dave" {
+		t.Errorf("offline sync drift = %s", got)
+	}
+
+	// Nothing outside the managed range was touched and no lock was left behind
+	passwd = readFile(t, root, "passwd")
+	for i, line := range localPasswd {
+		if passwd[i] != line {
+			t.Errorf("local line %d changed to %q", i, passwd[i])
+		}
+	}
+	if locks, _ := filepath.Glob(filepath.Join(root, "etc", "*.lock")); len(locks) != 0 {
+		t.Errorf("locks left behind: %v", locks)
+	}
+}
+
+func TestAgentFetchesRecordsWhenScopeWidens(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	services := service.NewServices(service.Deps{Repos: memory.NewRepositories()})
+	h := handlers.NewHandler(services, nil, logger)
+	router := gin.New()
+	noUsers := func(c *gin.Context) { c.AbortWithStatus(401) }
+	router.GET("/api/changes", h.UserOrHostMiddleware(noUsers), h.GetChanges)
+	host := router.Group("/api/host", h.HostAuthMiddleware())
+	host.GET("/access", h.GetCurrentHostAccess)
+	host.POST("/reports", h.ReportCurrentHost)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "etc"), 0755)
+
+	// alice is in staff and bob in devs; web1 may only see staff at first
+	staff := &models.Group{UnixGID: 1000, Groupname: "staff", Type: models.GroupTypePeople}
+	devs := &models.Group{UnixGID: 1001, Groupname: "devs", Type: models.GroupTypePeople}
+	for _, group := range []*models.Group{staff, devs} {
+		if err := services.Group.CreateGroup(group, 1, "admin", "127.0.0.1"); err != nil {
+			t.Fatalf("CreateGroup: %v", err)
+		}
+	}
+	alice := &models.Account{UnixUID: 1001, Username: "alice", Type: models.AccountTypePeople, PrimaryGroupID: staff.ID}
+	bob := &models.Account{UnixUID: 1002, Username: "bob", Type: models.AccountTypePeople, PrimaryGroupID: devs.ID}
+	for _, account := range []*models.Account{alice, bob} {
+		if err := services.Account.CreateAccount(account, 1, "admin", "127.0.0.1"); err != nil {
+			t.Fatalf("CreateAccount: %v", err)
+		}
+	}
+	web1 := &models.Host{Hostname: "web1"}
+	token, err := services.Host.CreateHost(web1, 1, "admin", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("CreateHost: %v", err)
+	}
+	webservers := &models.HostGroup{Name: "webservers"}
+	if err := services.Host.CreateHostGroup(webservers, 1, "admin", "127.0.0.1"); err != nil {
+		t.Fatalf("CreateHostGroup: %v", err)
+	}
+	if err := services.Host.AddHostToGroup(webservers.ID, web1.ID, 1, "admin", "127.0.0.1"); err != nil {
+		t.Fatalf("AddHostToGroup: %v", err)
+	}
+	allow := func(group *models.Group) {
+		t.Helper()
+		rule := &models.AccessRule{HostGroupID: webservers.ID, GroupID: group.ID}
+		if err := services.Host.CreateAccessRule(rule, 1, "admin", "127.0.0.1"); err != nil {
+			t.Fatalf("CreateAccessRule: %v", err)
+		}
+	}
+	allow(staff)
+
+	api := client.New(server.URL, "")
+	api.HostToken = token
+	a := New(api, "web1", root, logger)
+
+	if _, err := a.Sync(); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	passwd := readFile(t, root, "passwd")
+	if findLine(passwd, "alice") == "" || findLine(passwd, "bob") != "" {
+		t.Fatalf("passwd before widening: %q", passwd)
+	}
+
+	// bob and devs changed before the cursor, so only reading the feed again
+	// brings them
+	allow(devs)
+	report, err := a.Sync()
+	if err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	passwd = readFile(t, root, "passwd")
+	if findLine(passwd, "alice") == "" || findLine(passwd, "bob") != "bob:x:1002:1001::/home/bob:/bin/bash" {
+		t.Errorf("passwd after widening: %q", passwd)
+	}
+	if group := findLine(readFile(t, root, "group"), "devs"); group != "devs:x:1001:" {
+		t.Errorf("devs after widening: %q", group)
+	}
+	if report.Offline || report.Accounts != 2 {
+		t.Errorf("report after widening = %+v", report)
+	}
+}
@@ -0,0 +1,166 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/home/unixify/internal/client"
+	"github.com/home/unixify/internal/models"
+)
+
+// Cache is the agent's local replica of the registry. It is kept up to date
+// from the change feed and saved after every sync, so the host's files can be
+// rebuilt while the server is unreachable.
+type Cache struct {
+	Sequence    int64                        `json:"sequence"`
+	Accounts    map[uint]models.Account      `json:"accounts"`
+	Groups      map[uint]models.Group        `json:"groups"`
+	Memberships map[uint]models.AccountGroup `json:"memberships"`
+	// Written holds the lines the agent last wrote, by file and name, to tell
+	// local edits from registry changes
+	Written map[string]map[string]string `json:"written"`
+	// Scope is the part of the registry the host's access rules allow; nil
+	// when the agent has no host token and manages every record
+	Scope *Scope `json:"scope,omitempty"`
+}
+
+// Scope lists the accounts and groups a host may see, by ID
+type Scope struct {
+	Accounts map[uint]bool `json:"accounts"`
+	Groups   map[uint]bool `json:"groups"`
+}
+
+// NewScope creates the scope of a host from its access
+func NewScope(access *models.HostAccess) *Scope {
+	scope := &Scope{Accounts: make(map[uint]bool), Groups: make(map[uint]bool)}
+	for _, account := range access.Accounts {
+		scope.Accounts[account.ID] = true
+	}
+	for _, group := range access.Groups {
+		scope.Groups[group.ID] = true
+	}
+	return scope
+}
+
+// Account reports whether the scope includes an account; a nil scope includes all
+func (s *Scope) Account(id uint) bool {
+	return s == nil || s.Accounts[id]
+}
+
+// Group reports whether the scope includes a group; a nil scope includes all
+func (s *Scope) Group(id uint) bool {
+	return s == nil || s.Groups[id]
+}
+
+// Widens reports whether the scope includes an account or group that the
+// previous scope did not
+func (s *Scope) Widens(previous *Scope) bool {
+	for id := range s.Accounts {
+		if !previous.Accounts[id] {
+			return true
+		}
+	}
+	for id := range s.Groups {
+		if !previous.Groups[id] {
+			return true
+		}
+	}
+	return false
+}
+
+// NewCache creates an empty cache
+func NewCache() *Cache {
+	return &Cache{
+		Accounts:    make(map[uint]models.Account),
+		Groups:      make(map[uint]models.Group),
+		Memberships: make(map[uint]models.AccountGroup),
+		Written:     make(map[string]map[string]string),
+	}
+}
+
+// LoadCache reads the cache from path; a missing file is an empty cache
+func LoadCache(path string) (*Cache, error) {
+	cache := NewCache()
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cache, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache: %w", err)
+	}
+	if err := json.Unmarshal(data, cache); err != nil {
+		return nil, fmt.Errorf("failed to decode cache %s: %w", path, err)
+	}
+	return cache, nil
+}
+
+// Save writes the cache to path, replacing the old one atomically
+func (c *Cache) Save(path string) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("failed to encode cache: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	if err := replaceFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to save cache: %w", err)
+	}
+	return nil
+}
+
+// Refetch reads the whole feed again into a new cache. The lines last
+// written are kept, to tell local edits from registry changes. The cache
+// itself is left as it is, so it stays usable if a page fails.
+func (c *Cache) Refetch(api *client.Client, pageSize int) (*Cache, error) {
+	fresh := NewCache()
+	fresh.Written = c.Written
+	if err := fresh.Pull(api, pageSize); err != nil {
+		return nil, err
+	}
+	return fresh, nil
+}
+
+// Apply applies one page of the change feed: tombstones first, then the
+// records, which are always in their current state
+func (c *Cache) Apply(changes *models.ChangeSet) {
+	for _, tombstone := range changes.Tombstones {
+		switch tombstone.Kind {
+		case models.TombstoneAccount:
+			delete(c.Accounts, tombstone.EntityID)
+		case models.TombstoneGroup:
+			delete(c.Groups, tombstone.EntityID)
+		case models.TombstoneMembership:
+			delete(c.Memberships, tombstone.EntityID)
+		}
+	}
+	for _, account := range changes.Accounts {
+		account.PrimaryGroup = nil
+		c.Accounts[account.ID] = account
+	}
+	for _, group := range changes.Groups {
+		c.Groups[group.ID] = group
+	}
+	for _, membership := range changes.Memberships {
+		c.Memberships[membership.ID] = membership
+	}
+	c.Sequence = changes.Sequence
+}
+
+// Pull fetches and applies changes until the cache is current. The cache is
+// consistent after every page, so it stays usable when a later page fails.
+func (c *Cache) Pull(api *client.Client, pageSize int) error {
+	for {
+		changes, err := api.Changes(c.Sequence, pageSize)
+		if err != nil {
+			return err
+		}
+		c.Apply(changes)
+		if !changes.More {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,303 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/home/unixify/internal/idrange"
+	"github.com/home/unixify/internal/models"
+)
+
+// Names of the files the agent manages; they live in etc/ under the root
+const (
+	passwdFile = "passwd"
+	groupFile  = "group"
+	shadowFile = "shadow"
+)
+
+// Field counts of the managed files
+const (
+	passwdFields = 7
+	groupFields  = 4
+	shadowFields = 9
+)
+
+// entry is a line the registry wants in a passwd or group file
+type entry struct {
+	name string
+	id   int
+	line string
+}
+
+// parseLine returns the name and ID (the third field) of a passwd or group
+// line; ok is false for comments, NIS compat entries and malformed lines
+func parseLine(line string, fields int) (name string, id int, ok bool) {
+	if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "+") || strings.HasPrefix(line, "-") {
+		return "", 0, false
+	}
+	parts := strings.Split(line, ":")
+	if len(parts) != fields {
+		return "", 0, false
+	}
+	id, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return "", 0, false
+	}
+	return parts[0], id, true
+}
+
+// merged is a rewritten passwd or group file
+type merged struct {
+	lines   []string
+	written map[string]string // Registry lines now in the file, by name
+	drift   []models.DriftFinding
+}
+
+// names returns the names of all entries in the merged file
+func (m merged) names(fields int) map[string]bool {
+	names := make(map[string]bool)
+	for _, line := range m.lines {
+		if name, _, ok := parseLine(line, fields); ok {
+			names[name] = true
+		}
+	}
+	return names
+}
+
+// merge puts the desired entries into the lines of a passwd or group file.
+// Lines with IDs outside ranges are never changed. Inside them, registry
+// entries replace lines of the same name, lines the agent wrote before
+// (previous) are removed once the registry drops them, and any other line is
+// kept and reported. Registry entries that clash with a kept line by name or
+// ID are not written.
+func merge(file string, lines []string, fields int, desired []entry, ranges idrange.Ranges, previous map[string]string) merged {
+	m := merged{written: make(map[string]string)}
+	drift := func(kind, name string, id int, format string, args ...interface{}) {
+		m.drift = append(m.drift, models.DriftFinding{Kind: kind, File: file, Name: name, ID: id, Message: fmt.Sprintf(format, args...)})
+	}
+
+	want := make(map[string]entry)
+	for _, e := range desired {
+		if ranges.Contains(e.id) {
+			want[e.name] = e
+		}
+	}
+
+	// Lines the agent does not own, which registry entries must not clash with
+	localNames := make(map[string]int)
+	localIDs := make(map[int]string)
+	for _, line := range lines {
+		name, id, ok := parseLine(line, fields)
+		if !ok {
+			continue
+		}
+		if _, wanted := want[name]; ranges.Contains(id) && (wanted || previous[name] != "") {
+			continue
+		}
+		localNames[name] = id
+		if _, seen := localIDs[id]; !seen {
+			localIDs[id] = name
+		}
+	}
+	for _, e := range sortedEntries(want) {
+		if id, clash := localNames[e.name]; clash {
+			drift(models.DriftConflict, e.name, e.id, "%s %s (%d) is not written: the name belongs to a local entry with ID %d", file, e.name, e.id, id)
+			delete(want, e.name)
+		} else if name, clash := localIDs[e.id]; clash {
+			drift(models.DriftConflict, e.name, e.id, "%s %s (%d) is not written: the ID belongs to local entry %s", file, e.name, e.id, name)
+			delete(want, e.name)
+		}
+	}
+
+	// Rewrite the file in place, keeping its order
+	emitted := make(map[string]bool)
+	for _, line := range lines {
+		name, id, ok := parseLine(line, fields)
+		if !ok || !ranges.Contains(id) {
+			m.lines = append(m.lines, line)
+			continue
+		}
+		if e, wanted := want[name]; wanted {
+			if emitted[name] {
+				continue // Duplicate of an entry already written
+			}
+			if line != e.line && previous[name] == "" {
+				drift(models.DriftModified, name, id, "%s %s (%d) differed from the registry and was replaced", file, name, id)
+			} else if line != e.line && line != previous[name] {
+				drift(models.DriftModified, name, id, "%s %s (%d) was changed locally and has been restored", file, name, id)
+			}
+			m.lines = append(m.lines, e.line)
+			emitted[name] = true
+			continue
+		}
+		if previous[name] != "" {
+			continue // Removed from the registry
+		}
+		drift(models.DriftUnmanaged, name, id, "%s %s (%d) is in a managed range but not in the registry", file, name, id)
+		m.lines = append(m.lines, line)
+	}
+
+	// Add the new entries at the end
+	for _, e := range sortedEntries(want) {
+		m.written[e.name] = e.line
+		if emitted[e.name] {
+			continue
+		}
+		if previous[e.name] != "" {
+			drift(models.DriftMissing, e.name, e.id, "%s %s (%d) was removed locally and has been restored", file, e.name, e.id)
+		}
+		m.lines = append(m.lines, e.line)
+	}
+	return m
+}
+
+// sortedEntries returns the entries ordered by ID
+func sortedEntries(entries map[string]entry) []entry {
+	sorted := make([]entry, 0, len(entries))
+	for _, e := range entries {
+		sorted = append(sorted, e)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].id != sorted[j].id {
+			return sorted[i].id < sorted[j].id
+		}
+		return sorted[i].name < sorted[j].name
+	})
+	return sorted
+}
+
+// mergeShadow keeps a shadow entry for every managed account. Only the expiry
+// date of existing entries is set, to lock inactive accounts, so passwords
+// set on the host survive. Entries of removed accounts are dropped; all
+// others are never changed. New entries get a locked password.
+func mergeShadow(lines []string, active map[string]bool, removed map[string]bool, today int64) []string {
+	expiry := func(name string) string {
+		if active[name] {
+			return ""
+		}
+		return "1" // Expired since 1970-01-02
+	}
+
+	var out []string
+	seen := make(map[string]bool)
+	for _, line := range lines {
+		name, _, _ := strings.Cut(line, ":")
+		if _, managed := active[name]; managed && line != "" && !strings.HasPrefix(line, "#") {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			parts := strings.Split(line, ":")
+			for len(parts) < shadowFields {
+				parts = append(parts, "")
+			}
+			parts[7] = expiry(name)
+			out = append(out, strings.Join(parts, ":"))
+			continue
+		}
+		if removed[name] {
+			continue
+		}
+		out = append(out, line)
+	}
+
+	names := make([]string, 0, len(active))
+	for name := range active {
+		if !seen[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		out = append(out, fmt.Sprintf("%s:!:%d:0:99999:7::%s:", name, today, expiry(name)))
+	}
+	return out
+}
+
+// readLines reads the lines of a file; a missing file has none
+func readLines(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	text := strings.TrimSuffix(string(data), "\n")
+	if text == "" {
+		return nil, nil
+	}
+	return strings.Split(text, "\n"), nil
+}
+
+// joinLines turns lines back into file contents
+func joinLines(lines []string) []byte {
+	if len(lines) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(lines, "\n") + "\n")
+}
+
+// writeFile replaces a file atomically. Like shadow-utils, it keeps the old
+// version with a - suffix and the file's mode, or uses mode for a new file.
+func writeFile(path string, data []byte, mode os.FileMode) error {
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+		old, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := replaceFile(path+"-", old, mode); err != nil {
+			return err
+		}
+	}
+	return replaceFile(path, data, mode)
+}
+
+// replaceFile writes data to a temporary file next to path and renames it over path
+func replaceFile(path string, data []byte, mode os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// lockFile takes the lock file shadow-utils uses for path (path.lock), so
+// useradd and friends do not write the file at the same time. It fails if the
+// lock is held.
+func lockFile(path string) (unlock func(), err error) {
+	lockPath := path + ".lock"
+	lock, err := os.OpenFile(lockPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if errors.Is(err, os.ErrExist) {
+		return nil, fmt.Errorf("%s is locked by another program (remove %s if it is stale)", path, lockPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(lock, "%d", os.Getpid())
+	lock.Close()
+	return func() { os.Remove(lockPath) }, nil
+}
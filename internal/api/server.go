@@ -10,6 +10,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/home/unixify/internal/auth"
 	"github.com/home/unixify/internal/config"
+	"github.com/home/unixify/internal/events"
 	"github.com/home/unixify/internal/handlers"
 	"github.com/home/unixify/internal/repository"
 	"github.com/home/unixify/internal/service"
@@ -27,8 +28,8 @@ type Server struct {
 	repo    *repository.Repository
 }
 
-// NewServer creates a new API server
-func NewServer(cfg *config.Config, services *service.Services) *Server {
+// NewServer creates a new API server. The broker feeds the event stream.
+func NewServer(cfg *config.Config, services *service.Services, broker *events.Broker) *Server {
 	// Initialize logger
 	logger := logrus.New()
 	if cfg.Server.Mode == "debug" {
@@ -38,15 +39,19 @@ func NewServer(cfg *config.Config, services *service.Services) *Server {
 	// Set Gin mode
 	gin.SetMode(cfg.Server.Mode)
 
-	// Initialize router
+	// Initialize router. Only trusted proxies may set the client address
+	// that login protection and audit entries use.
 	router := gin.New()
+	if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		logger.Fatalf("Invalid trusted proxies: %v", err)
+	}
 	
 	// Use middleware
 	router.Use(gin.Recovery())
 	router.Use(LoggerMiddleware(logger))
 	
 	// Initialize handlers
-	handler := handlers.NewHandler(services, logger)
+	handler := handlers.NewHandler(services, broker, logger)
 
 	// Get database connection and repository
 	db := services.GetDB()
@@ -111,7 +116,7 @@ func LoggerMiddleware(logger *logrus.Logger) gin.HandlerFunc {
 // initRoutes initializes the API routes
 func (s *Server) initRoutes() {
 	// Authentication middleware
-	authService := auth.NewService(*s.config)
+	authService := auth.NewService(*s.config, repository.NewRepositories(s.db))
 	authMiddleware := authService.AuthMiddleware()
 	guestMiddleware := authService.GuestMiddleware()
 
@@ -123,49 +128,135 @@ func (s *Server) initRoutes() {
 			c.JSON(http.StatusOK, gin.H{"status": "ok"})
 		})
 
-		// Guest accessible routes - read-only operations
-		guestAPI := api.Group("/")
-		guestAPI.Use(guestMiddleware)
+		// Read-only routes - open to guests unless guest access is turned
+		// off, in which case they require a logged-in user
+		readAuth := guestMiddleware
+		if !s.config.Server.GuestAccess {
+			readAuth = authMiddleware
+		}
+		readAPI := api.Group("/")
+		readAPI.Use(readAuth)
 		{
-			// Account read-only routes
-			accounts := guestAPI.Group("/accounts")
-			{
-				accounts.GET("", s.handler.GetAllAccounts)
-				accounts.GET("/:id", s.handler.GetAccount)
-				accounts.GET("/uid/:uid", s.handler.GetAccountByUID)
-				accounts.GET("/username/:username", s.handler.GetAccountByUsername)
-				accounts.GET("/:id/groups", s.handler.GetAccountGroups)
-			}
-
 			// Group read-only routes
-			groups := guestAPI.Group("/groups")
+			groups := readAPI.Group("/groups")
 			{
 				groups.GET("", s.handler.GetAllGroups)
+				groups.GET("/next-gid", s.handler.GetNextAvailableGID)
+				groups.GET("/check-duplicate", s.handler.CheckGIDDuplicate)
 				groups.GET("/:id", s.handler.GetGroup)
 				groups.GET("/gid/:gid", s.handler.GetGroupByGID)
 				groups.GET("/groupname/:groupname", s.handler.GetGroupByGroupname)
 				groups.GET("/:id/accounts", s.handler.GetGroupMembers)
 			}
 
+			// Account lookups used when creating accounts
+			accountLookups := readAPI.Group("/accounts")
+			{
+				accountLookups.GET("/next-uid", s.handler.GetNextAvailableUID)
+				accountLookups.GET("/check-duplicate", s.handler.CheckUIDDuplicate)
+				accountLookups.GET("/suggest-username", s.handler.SuggestUsernames)
+			}
+
 			// Search routes (read-only)
-			search := guestAPI.Group("/search")
+			search := readAPI.Group("/search")
 			{
+				search.GET("", s.handler.Search)
 				search.GET("/accounts", s.handler.SearchAccounts)
 				search.GET("/groups", s.handler.SearchGroups)
 			}
 
 			// Audit routes (read-only)
-			audit := guestAPI.Group("/audit")
+			audit := readAPI.Group("/audit")
 			{
 				audit.GET("", s.handler.GetAuditEntries)
 				audit.GET("/:id", s.handler.GetAuditEntry)
 			}
+
+			// Sync reports from host agents
+			readAPI.GET("/hosts/reports", s.handler.GetHostReports)
+
+			// Host inventory read-only routes
+			hosts := readAPI.Group("/hosts")
+			{
+				hosts.GET("", s.handler.GetAllHosts)
+				hosts.GET("/:id", s.handler.GetHost)
+				hosts.GET("/:id/host-groups", s.handler.GetHostGroupsOfHost)
+				hosts.GET("/:id/access", s.handler.GetHostAccessPreview)
+			}
+
+			// Host group and access rule read-only routes
+			hostGroups := readAPI.Group("/host-groups")
+			{
+				hostGroups.GET("", s.handler.GetAllHostGroups)
+				hostGroups.GET("/:id", s.handler.GetHostGroup)
+				hostGroups.GET("/:id/hosts", s.handler.GetHostGroupHosts)
+				hostGroups.GET("/:id/rules", s.handler.GetAccessRules)
+			}
+
+			// Netgroup read-only routes and exports
+			netgroups := readAPI.Group("/netgroups")
+			{
+				netgroups.GET("", s.handler.GetAllNetgroups)
+				netgroups.GET("/export", s.handler.ExportNetgroups)
+				netgroups.GET("/:id", s.handler.GetNetgroup)
+			}
+
+			// Sudo rule read-only routes and exports
+			sudoRules := readAPI.Group("/sudo-rules")
+			{
+				sudoRules.GET("", s.handler.GetAllSudoRules)
+				sudoRules.GET("/export", s.handler.ExportSudoRules)
+				sudoRules.GET("/:id", s.handler.GetSudoRule)
+				sudoRules.GET("/:id/sudoers", s.handler.ExportSudoRule)
+			}
+
+			// Subordinate ID read-only routes and exports
+			subIDs := readAPI.Group("/subids")
+			{
+				subIDs.GET("", s.handler.GetAllSubIDRanges)
+				subIDs.GET("/subuid", s.handler.ExportSubIDs)
+				subIDs.GET("/subgid", s.handler.ExportSubIDs)
+				subIDs.GET("/:account_id", s.handler.GetSubIDRange)
+			}
+		}
+
+		// Account data routes - read-only routes that hosts share with users;
+		// hosts only get the accounts, groups and memberships they have
+		// access to
+		userOrHost := api.Group("/")
+		userOrHost.Use(s.handler.UserOrHostMiddleware(readAuth))
+		{
+			accounts := userOrHost.Group("/accounts")
+			{
+				accounts.GET("", s.handler.GetAllAccounts)
+				accounts.GET("/:id", s.handler.GetAccount)
+				accounts.GET("/uid/:uid", s.handler.GetAccountByUID)
+				accounts.GET("/username/:username", s.handler.GetAccountByUsername)
+				accounts.GET("/:id/groups", s.handler.GetAccountGroups)
+			}
+
+			// Live stream of registry changes
+			userOrHost.GET("/events", s.handler.StreamEvents)
+
+			// Incremental change feed for replicas
+			userOrHost.GET("/changes", s.handler.GetChanges)
 		}
 
 		// Protected API routes - require authentication for write operations
 		protected := api.Group("/")
 		protected.Use(authMiddleware)
 		{
+			// Each user's saved searches
+			savedSearches := protected.Group("/saved-searches")
+			{
+				savedSearches.GET("", s.handler.GetSavedSearches)
+				savedSearches.POST("", s.handler.CreateSavedSearch)
+				savedSearches.GET("/:id", s.handler.GetSavedSearch)
+				savedSearches.PUT("/:id", s.handler.UpdateSavedSearch)
+				savedSearches.DELETE("/:id", s.handler.DeleteSavedSearch)
+				savedSearches.GET("/:id/results", s.handler.RunSavedSearch)
+			}
+
 			// Account write operations
 			accounts := protected.Group("/accounts")
 			{
@@ -188,11 +279,99 @@ func (s *Server) initRoutes() {
 				membership.POST("", s.handler.AssignAccountToGroup)
 				membership.DELETE("", s.handler.RemoveAccountFromGroup)
 			}
+
+			// Desired-state plans; applying them is for admins
+			protected.POST("/state/plan", s.handler.PlanState)
+
+			// Host agents report after each sync
+			protected.POST("/hosts/reports", s.handler.ReportHost)
+
+			// Drift reports compare uploaded host files with the registry
+			protected.POST("/hosts/drift", s.handler.CompareHostFiles)
+
+			// Host inventory write operations
+			hosts := protected.Group("/hosts")
+			{
+				hosts.POST("", s.handler.CreateHost)
+				hosts.PUT("/:id", s.handler.UpdateHost)
+				hosts.DELETE("/:id", s.handler.DeleteHost)
+				hosts.POST("/:id/token", s.handler.RotateHostToken)
+			}
+
+			// Host group and access rule write operations
+			hostGroups := protected.Group("/host-groups")
+			{
+				hostGroups.POST("", s.handler.CreateHostGroup)
+				hostGroups.PUT("/:id", s.handler.UpdateHostGroup)
+				hostGroups.DELETE("/:id", s.handler.DeleteHostGroup)
+				hostGroups.POST("/:id/hosts", s.handler.AddHostToGroup)
+				hostGroups.DELETE("/:id/hosts/:hostId", s.handler.RemoveHostFromGroup)
+				hostGroups.POST("/:id/rules", s.handler.CreateAccessRule)
+				hostGroups.DELETE("/:id/rules/:ruleId", s.handler.DeleteAccessRule)
+			}
+
+			// Netgroup write operations
+			netgroups := protected.Group("/netgroups")
+			{
+				netgroups.POST("", s.handler.CreateNetgroup)
+				netgroups.PUT("/:id", s.handler.UpdateNetgroup)
+				netgroups.DELETE("/:id", s.handler.DeleteNetgroup)
+			}
+
+			// Subordinate ID allocation
+			subIDs := protected.Group("/subids")
+			{
+				subIDs.POST("", s.handler.AllocateSubIDs)
+				subIDs.DELETE("/:account_id", s.handler.ReleaseSubIDs)
+			}
+		}
+
+		// Admin API routes - write operations that can remove or grant a lot
+		// at once
+		adminAPI := api.Group("/")
+		adminAPI.Use(authMiddleware, authService.RoleMiddleware("admin"))
+		{
+			// Applying desired state, which with prune=true deletes every
+			// undeclared account, group and reservation
+			adminAPI.POST("/state/apply", s.handler.ApplyState)
+
+			// Sudo rule write operations, which grant root on hosts
+			sudoRules := adminAPI.Group("/sudo-rules")
+			{
+				sudoRules.POST("", s.handler.CreateSudoRule)
+				sudoRules.PUT("/:id", s.handler.UpdateSudoRule)
+				sudoRules.DELETE("/:id", s.handler.DeleteSudoRule)
+			}
+
+			// Webhook subscriptions and their delivery log; a webhook
+			// receives every registry change
+			webhooks := adminAPI.Group("/webhooks")
+			{
+				webhooks.GET("", s.handler.GetAllWebhooks)
+				webhooks.POST("", s.handler.CreateWebhook)
+				webhooks.GET("/:id", s.handler.GetWebhook)
+				webhooks.PUT("/:id", s.handler.UpdateWebhook)
+				webhooks.DELETE("/:id", s.handler.DeleteWebhook)
+				webhooks.GET("/:id/deliveries", s.handler.GetWebhookDeliveries)
+			}
+		}
+
+		// Host routes - authenticated by host token and scoped to that host
+		hostAPI := api.Group("/host")
+		hostAPI.Use(s.handler.HostAuthMiddleware())
+		{
+			hostAPI.GET("", s.handler.GetCurrentHost)
+			hostAPI.GET("/access", s.handler.GetCurrentHostAccess)
+			hostAPI.GET("/passwd", s.handler.ExportHostPasswd)
+			hostAPI.GET("/group", s.handler.ExportHostGroup)
+			hostAPI.GET("/nss/passwd", s.handler.LookupHostPasswd)
+			hostAPI.GET("/nss/group", s.handler.LookupHostGroup)
+			hostAPI.POST("/reports", s.handler.ReportCurrentHost)
 		}
 	}
 
 	// Auth handler instance
-	authHandler := handlers.NewAuthHandler(s.db, auth.NewService(*s.config), s.repo)
+	authHandler := handlers.NewAuthHandler(authService, s.repo)
 	
 	// Auth routes
 	authRoutes := s.router.Group("/api/auth")
@@ -200,6 +379,7 @@ func (s *Server) initRoutes() {
 		authRoutes.POST("/register", authHandler.Register)
 		authRoutes.POST("/login", authHandler.Login)
 		authRoutes.POST("/verify-totp", authHandler.VerifyTOTP)
+		authRoutes.POST("/refresh", authHandler.Refresh)
 		
 		// Protected auth routes
 		protected := authRoutes.Group("/")
@@ -210,6 +390,22 @@ func (s *Server) initRoutes() {
 			protected.GET("/setup-totp", authHandler.SetupTOTP)
 			protected.POST("/activate-totp", authHandler.ActivateTOTP)
 			protected.POST("/disable-totp", authHandler.DisableTOTP)
+			protected.POST("/regenerate-recovery-codes", authHandler.RegenerateRecoveryCodes)
+			protected.POST("/logout", authHandler.Logout)
+			protected.GET("/sessions", authHandler.GetSessions)
+			protected.DELETE("/sessions/:id", authHandler.RevokeSession)
+		}
+
+		// User administration
+		admin := authRoutes.Group("/")
+		admin.Use(authMiddleware, authService.RoleMiddleware("admin"))
+		{
+			admin.POST("/users/:id/disable", authHandler.DisableUser)
+			admin.POST("/users/:id/enable", authHandler.EnableUser)
+			admin.DELETE("/users/:id/sessions", authHandler.RevokeUserSessions)
+			admin.POST("/users/:id/unlock", authHandler.UnlockUser)
+			admin.GET("/lockouts", authHandler.GetLockouts)
+			admin.DELETE("/lockouts/:kind/:subject", authHandler.DeleteLockout)
 		}
 	}
 
@@ -1,6 +1,11 @@
 package auth
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"strings"
@@ -9,18 +14,38 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/home/unixify/internal/config"
 	"github.com/home/unixify/internal/models"
+	"github.com/home/unixify/internal/repository"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// Errors returned for refresh tokens and sessions that cannot be used
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrSessionRevoked      = errors.New("session has been revoked")
+	ErrRefreshTokenReused  = errors.New("refresh token was already used; the session has been revoked")
+)
+
 // Service contains the authentication-related logic
 type Service struct {
-	config config.Config
+	config   config.Config
+	users    repository.UserStore
+	sessions repository.SessionStore
+	logins   repository.LoginAttemptStore
+	totp     repository.TOTPChallengeStore
+	recovery repository.TOTPRecoveryCodeStore
+	audit    repository.AuditStore
 }
 
 // NewService creates a new authentication service
-func NewService(cfg config.Config) *Service {
+func NewService(cfg config.Config, repos *repository.Repositories) *Service {
 	return &Service{
-		config: cfg,
+		config:   cfg,
+		users:    repos.User,
+		sessions: repos.Session,
+		logins:   repos.Login,
+		totp:     repos.TOTP,
+		recovery: repos.Recovery,
+		audit:    repos.Audit,
 	}
 }
 
@@ -39,30 +64,175 @@ func (s *Service) CheckPassword(password, hash string) bool {
 	return err == nil
 }
 
-// GenerateToken generates a JWT token for the given user
-func (s *Service) GenerateToken(user *models.User) (string, error) {
-	// Set token expiration to 24 hours
-	expirationTime := time.Now().Add(24 * time.Hour)
-	
+// GenerateToken generates a short-lived JWT access token for the given user
+// in a session; it stops working when the session is revoked
+func (s *Service) GenerateToken(user *models.User, session *models.Session) (string, error) {
+	expirationTime := time.Now().Add(s.config.Server.AccessTokenTTL)
+
 	claims := jwt.MapClaims{
 		"id":        user.ID,
+		"sid":       session.ID,
 		"username":  user.Username,
 		"email":     user.Email,
 		"role":      user.Role,
 		"exp":       expirationTime.Unix(),
 		"issued_at": time.Now().Unix(),
 	}
-	
+
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	
+
 	tokenString, err := token.SignedString([]byte(s.config.Server.Secret))
 	if err != nil {
 		return "", err
 	}
-	
+
 	return tokenString, nil
 }
 
+// StartSession creates a session for a user who has just logged in and
+// returns its tokens
+func (s *Service) StartSession(user *models.User, clientIP, userAgent string) (*models.AuthResponse, error) {
+	// Expired sessions are of no more use, not even to detect reuse
+	if err := s.sessions.DeleteExpired(time.Now()); err != nil {
+		return nil, err
+	}
+
+	key, err := randomString(16)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := randomString(32)
+	if err != nil {
+		return nil, err
+	}
+	session := &models.Session{
+		UserID:     user.ID,
+		TokenKey:   key,
+		SecretHash: hashSecret(secret),
+		ExpiresAt:  time.Now().Add(s.config.Server.RefreshTokenTTL),
+		ClientIP:   clientIP,
+		UserAgent:  userAgent,
+	}
+	if err := s.sessions.Create(session); err != nil {
+		return nil, err
+	}
+	return s.IssueTokens(user, session, key+"."+secret)
+}
+
+// RefreshSession exchanges a refresh token for a new one and returns the
+// session it belongs to. A refresh token works once: using one that was
+// already exchanged revokes the session, as it may have been stolen.
+func (s *Service) RefreshSession(refreshToken string) (*models.Session, string, error) {
+	key, secret, ok := strings.Cut(refreshToken, ".")
+	if !ok || key == "" || secret == "" {
+		return nil, "", ErrInvalidRefreshToken
+	}
+	session, err := s.sessions.FindByTokenKey(key)
+	if err != nil {
+		return nil, "", err
+	}
+	if session == nil || time.Now().After(session.ExpiresAt) {
+		return nil, "", ErrInvalidRefreshToken
+	}
+	if session.RevokedAt != nil {
+		return nil, "", ErrSessionRevoked
+	}
+
+	oldHash := hashSecret(secret)
+	if subtle.ConstantTimeCompare([]byte(oldHash), []byte(session.SecretHash)) != 1 {
+		return nil, "", s.revokeReused(session.ID)
+	}
+	newSecret, err := randomString(32)
+	if err != nil {
+		return nil, "", err
+	}
+	session.SecretHash = hashSecret(newSecret)
+	if err := s.sessions.Rotate(session.ID, oldHash, session.SecretHash); err != nil {
+		// Another refresh with the same token got there first
+		if errors.Is(err, repository.ErrVersionMismatch) {
+			return nil, "", s.revokeReused(session.ID)
+		}
+		return nil, "", err
+	}
+	return session, key + "." + newSecret, nil
+}
+
+// revokeReused revokes a session whose refresh token was used twice
+func (s *Service) revokeReused(sessionID uint) error {
+	if err := s.sessions.Revoke(sessionID); err != nil {
+		return err
+	}
+	return ErrRefreshTokenReused
+}
+
+// IssueTokens returns a new access token for a user in a session, with the
+// session's current refresh token
+func (s *Service) IssueTokens(user *models.User, session *models.Session, refreshToken string) (*models.AuthResponse, error) {
+	token, err := s.GenerateToken(user, session)
+	if err != nil {
+		return nil, err
+	}
+	return &models.AuthResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(s.config.Server.AccessTokenTTL.Seconds()),
+		User: models.UserResponse{
+			ID:          user.ID,
+			Username:    user.Username,
+			Email:       user.Email,
+			Role:        user.Role,
+			TOTPEnabled: user.TOTPEnabled,
+		},
+	}, nil
+}
+
+// CheckSession returns an error unless a session exists, has not expired
+// and has not been revoked
+func (s *Service) CheckSession(sessionID uint) error {
+	session, err := s.sessions.FindByID(sessionID)
+	if err != nil {
+		return err
+	}
+	if session == nil || time.Now().After(session.ExpiresAt) {
+		return errors.New("session has expired")
+	}
+	if session.RevokedAt != nil {
+		return ErrSessionRevoked
+	}
+	return nil
+}
+
+// Sessions lists the sessions of a user, newest first
+func (s *Service) Sessions(userID uint) ([]models.Session, error) {
+	return s.sessions.FindByUserID(userID)
+}
+
+// RevokeSession revokes a session; its tokens stop working at once
+func (s *Service) RevokeSession(sessionID uint) error {
+	return s.sessions.Revoke(sessionID)
+}
+
+// RevokeUserSessions revokes the sessions of a user except exceptID; 0
+// revokes all of them
+func (s *Service) RevokeUserSessions(userID, exceptID uint) error {
+	return s.sessions.RevokeByUserID(userID, exceptID)
+}
+
+// randomString returns n random bytes encoded for use in a token
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashSecret hashes the secret of a refresh token for storage
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
 // VerifyToken validates a JWT token
 func (s *Service) VerifyToken(tokenString string) (*jwt.Token, error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
@@ -93,6 +263,19 @@ func (s *Service) ExtractTokenFromHeader(authHeader string) (string, error) {
 	return parts[1], nil
 }
 
+// GetSessionFromToken extracts the session ID from a JWT token
+func (s *Service) GetSessionFromToken(token *jwt.Token) (uint, error) {
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return 0, errors.New("invalid token claims")
+	}
+	sessionID, ok := claims["sid"].(float64)
+	if !ok {
+		return 0, errors.New("invalid session ID in token")
+	}
+	return uint(sessionID), nil
+}
+
 // GetUserFromToken extracts user information from a JWT token
 func (s *Service) GetUserFromToken(token *jwt.Token) (*models.UserResponse, error) {
 	claims, ok := token.Claims.(jwt.MapClaims)
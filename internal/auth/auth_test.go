@@ -0,0 +1,322 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/home/unixify/internal/config"
+	"github.com/home/unixify/internal/models"
+	"github.com/home/unixify/internal/repository/memory"
+	"github.com/pquerna/otp/totp"
+)
+
+func newTestService() *Service {
+	cfg := config.Config{Server: config.ServerConfig{
+		Secret:          "test-secret",
+		AccessTokenTTL:  15 * time.Minute,
+		RefreshTokenTTL: time.Hour,
+	}, Logins: config.LoginConfig{
+		MaxFailures:   3,
+		MaxIPFailures: 5,
+		Lockout:       15 * time.Minute,
+		Backoff:       time.Minute,
+	}}
+	return NewService(cfg, memory.NewRepositories())
+}
+
+func TestRegisterAndAuthenticate(t *testing.T) {
+	s := newTestService()
+
+	request := &models.RegisterUserRequest{
+		Username:  "alice",
+		Email:     "alice@example.com",
+		Password:  "correct horse",
+		FirstName: "Alice",
+		LastName:  "Liddell",
+	}
+	user, err := s.Register(request)
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	if user.Password == request.Password || !user.Active || user.Role != "user" || user.FirstName != "Alice" {
+		t.Errorf("Register = %+v, want an active user with a hashed password and the profile", user)
+	}
+
+	duplicateUsername := *request
+	duplicateUsername.Email = "other@example.com"
+	if _, err := s.Register(&duplicateUsername); !errors.Is(err, ErrUsernameTaken) {
+		t.Errorf("Register with a taken username: %v, want ErrUsernameTaken", err)
+	}
+	duplicateEmail := *request
+	duplicateEmail.Username = "alice2"
+	if _, err := s.Register(&duplicateEmail); !errors.Is(err, ErrEmailTaken) {
+		t.Errorf("Register with a taken email: %v, want ErrEmailTaken", err)
+	}
+
+	if got, err := s.Authenticate("alice", "correct horse"); err != nil || got.ID != user.ID {
+		t.Errorf("Authenticate with the right password = %v, %v; want alice", got, err)
+	}
+	if _, err := s.Authenticate("alice", "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Authenticate with a wrong password: %v, want ErrInvalidCredentials", err)
+	}
+	if _, err := s.Authenticate("nobody", "correct horse"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Authenticate for an unknown user: %v, want ErrInvalidCredentials", err)
+	}
+
+	// Users merged from registered_users keep their $2a$ hash, the format
+	// pgcrypto's crypt() writes
+	merged := &models.User{Username: "bob", Email: "bob@example.com",
+		Password: "$2a$10$9CYDKiZYe.1bkcroVy6I6.cFwolrKq8dg6Ck/rOdAtxoM.SJlleGS"}
+	if err := s.users.Create(merged); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := s.Authenticate("bob", "correct horse"); err != nil {
+		t.Errorf("Authenticate with a pgcrypto hash: %v", err)
+	}
+}
+
+func TestSessions(t *testing.T) {
+	s := newTestService()
+	user := &models.User{ID: 7, Username: "alice", Role: "user", Active: true}
+
+	login, err := s.StartSession(user, "192.0.2.1", "test")
+	if err != nil {
+		t.Fatalf("StartSession: %v", err)
+	}
+	token, err := s.VerifyToken(login.Token)
+	if err != nil {
+		t.Fatalf("VerifyToken: %v", err)
+	}
+	sessionID, err := s.GetSessionFromToken(token)
+	if err != nil || s.CheckSession(sessionID) != nil {
+		t.Fatalf("session %d of a new login is not live: %v", sessionID, err)
+	}
+
+	// Refreshing rotates the refresh token
+	session, refreshed, err := s.RefreshSession(login.RefreshToken)
+	if err != nil {
+		t.Fatalf("RefreshSession: %v", err)
+	}
+	if session.ID != sessionID || refreshed == login.RefreshToken {
+		t.Errorf("RefreshSession = session %d with token %q, want session %d with a new token", session.ID, refreshed, sessionID)
+	}
+
+	// Using the old token again revokes the session
+	if _, _, err := s.RefreshSession(login.RefreshToken); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Errorf("reusing a refresh token: %v, want ErrRefreshTokenReused", err)
+	}
+	if _, _, err := s.RefreshSession(refreshed); !errors.Is(err, ErrSessionRevoked) {
+		t.Errorf("refreshing a revoked session: %v, want ErrSessionRevoked", err)
+	}
+	if err := s.CheckSession(sessionID); !errors.Is(err, ErrSessionRevoked) {
+		t.Errorf("CheckSession of a revoked session: %v, want ErrSessionRevoked", err)
+	}
+
+	if _, _, err := s.RefreshSession("not-a-token"); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("RefreshSession(not-a-token): %v, want ErrInvalidRefreshToken", err)
+	}
+}
+
+func TestRevokeUserSessions(t *testing.T) {
+	s := newTestService()
+	user := &models.User{ID: 7, Username: "alice", Role: "user", Active: true}
+
+	var ids []uint
+	for i := 0; i < 3; i++ {
+		login, err := s.StartSession(user, "", "")
+		if err != nil {
+			t.Fatalf("StartSession: %v", err)
+		}
+		token, _ := s.VerifyToken(login.Token)
+		id, _ := s.GetSessionFromToken(token)
+		ids = append(ids, id)
+	}
+	other, err := s.StartSession(&models.User{ID: 8, Username: "bob"}, "", "")
+	if err != nil {
+		t.Fatalf("StartSession: %v", err)
+	}
+
+	// A password change keeps the session it was made in
+	if err := s.RevokeUserSessions(user.ID, ids[1]); err != nil {
+		t.Fatalf("RevokeUserSessions: %v", err)
+	}
+	for i, id := range ids {
+		if live := s.CheckSession(id) == nil; live != (i == 1) {
+			t.Errorf("session %d live = %v after revoking the others", id, live)
+		}
+	}
+	if _, _, err := s.RefreshSession(other.RefreshToken); err != nil {
+		t.Errorf("session of another user was revoked: %v", err)
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	s := newTestService()
+	const ip, otherIP = "192.0.2.1", "192.0.2.2"
+
+	wait := func(username, clientIP string) time.Duration {
+		t.Helper()
+		wait, err := s.LoginWait(username, clientIP)
+		if err != nil {
+			t.Fatalf("LoginWait: %v", err)
+		}
+		return wait.Round(time.Minute)
+	}
+	if got := wait("alice", ip); got != 0 {
+		t.Fatalf("wait before any failure = %v, want 0", got)
+	}
+
+	// Each failure doubles the wait, until the lockout
+	for i, want := range []time.Duration{time.Minute, 2 * time.Minute, 15 * time.Minute} {
+		if err := s.RecordLoginFailure(7, "alice", ip, "invalid password"); err != nil {
+			t.Fatalf("RecordLoginFailure: %v", err)
+		}
+		if got := wait("alice", otherIP); got != want {
+			t.Errorf("wait after %d failures = %v, want %v", i+1, got, want)
+		}
+	}
+
+	// The address is slowed down too, for every username
+	if got := wait("bob", ip); got != 4*time.Minute {
+		t.Errorf("wait for another user from the address = %v, want 4m", got)
+	}
+	if got := wait("bob", otherIP); got != 0 {
+		t.Errorf("wait for another user elsewhere = %v, want 0", got)
+	}
+
+	// Logging in clears the username only
+	if err := s.RecordLoginSuccess("alice"); err != nil {
+		t.Fatalf("RecordLoginSuccess: %v", err)
+	}
+	if got := wait("alice", otherIP); got != 0 {
+		t.Errorf("wait after a successful login = %v, want 0", got)
+	}
+	admin := &models.UserResponse{ID: 1, Username: "admin"}
+	if err := s.Unlock(models.LoginAttemptIP, ip, admin, otherIP); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	if got := wait("alice", ip); got != 0 {
+		t.Errorf("wait after unlocking the address = %v, want 0", got)
+	}
+
+	for action, want := range map[string]int{AuditLoginFailed: 3, AuditLockout: 1, AuditLoginRefused: 4, AuditUnlock: 1} {
+		entries, err := s.audit.FindAll("user", action, 0, 0)
+		if err != nil {
+			t.Fatalf("FindAll: %v", err)
+		}
+		if len(entries) != want {
+			t.Errorf("%d %s audit entries, want %d", len(entries), action, want)
+		}
+	}
+}
+
+func TestTOTPChallenge(t *testing.T) {
+	s := newTestService()
+	key, err := totp.Generate(totp.GenerateOpts{Issuer: "unixify", AccountName: "alice"})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	user := &models.User{Username: "alice", Email: "alice@example.com", Active: true,
+		TOTPEnabled: true, TOTPSecret: key.Secret()}
+	if err := s.users.Create(user); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	token, err := s.StartTOTPChallenge(user)
+	if err != nil {
+		t.Fatalf("StartTOTPChallenge: %v", err)
+	}
+	if _, err := s.CheckTOTPChallenge("not-a-token"); !errors.Is(err, ErrInvalidTOTPToken) {
+		t.Errorf("CheckTOTPChallenge(not-a-token): %v, want ErrInvalidTOTPToken", err)
+	}
+
+	// A code works once
+	code, err := totp.GenerateCode(key.Secret(), time.Now().UTC())
+	if err != nil {
+		t.Fatalf("GenerateCode: %v", err)
+	}
+	for i, want := range []bool{true, false} {
+		challenge, err := s.CheckTOTPChallenge(token)
+		if err != nil || challenge.UserID != user.ID {
+			t.Fatalf("CheckTOTPChallenge = %v, %v; want the challenge of alice", challenge, err)
+		}
+		if valid, err := s.VerifyTOTP(user, code); err != nil || valid != want {
+			t.Errorf("VerifyTOTP #%d = %v, %v; want %v", i+1, valid, err, want)
+		}
+	}
+
+	// The token is used up after MaxTOTPAttempts codes
+	for i := 2; i < MaxTOTPAttempts; i++ {
+		if _, err := s.CheckTOTPChallenge(token); err != nil {
+			t.Fatalf("CheckTOTPChallenge attempt %d: %v", i+1, err)
+		}
+	}
+	if _, err := s.CheckTOTPChallenge(token); !errors.Is(err, ErrInvalidTOTPToken) {
+		t.Errorf("CheckTOTPChallenge after %d attempts: %v, want ErrInvalidTOTPToken", MaxTOTPAttempts, err)
+	}
+
+	// A finished challenge cannot be used again
+	token, err = s.StartTOTPChallenge(user)
+	if err != nil {
+		t.Fatalf("StartTOTPChallenge: %v", err)
+	}
+	challenge, err := s.CheckTOTPChallenge(token)
+	if err != nil {
+		t.Fatalf("CheckTOTPChallenge: %v", err)
+	}
+	if err := s.FinishTOTPChallenge(challenge); err != nil {
+		t.Fatalf("FinishTOTPChallenge: %v", err)
+	}
+	if _, err := s.CheckTOTPChallenge(token); !errors.Is(err, ErrInvalidTOTPToken) {
+		t.Errorf("CheckTOTPChallenge of a finished challenge: %v, want ErrInvalidTOTPToken", err)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	s := newTestService()
+	user := &models.User{ID: 7, Username: "alice", Active: true, TOTPEnabled: true}
+
+	codes, err := s.GenerateRecoveryCodes(user)
+	if err != nil {
+		t.Fatalf("GenerateRecoveryCodes: %v", err)
+	}
+	if len(codes) != RecoveryCodeCount || len(codes[0]) != 19 {
+		t.Fatalf("GenerateRecoveryCodes = %q, want %d codes like xxxx-xxxx-xxxx-xxxx", codes, RecoveryCodeCount)
+	}
+
+	// A code works once, however it is typed
+	for i, want := range []bool{true, false} {
+		if used, err := s.UseRecoveryCode(user, strings.ToUpper(strings.ReplaceAll(codes[0], "-", " ")), "192.0.2.1"); err != nil || used != want {
+			t.Errorf("UseRecoveryCode #%d = %v, %v; want %v", i+1, used, err, want)
+		}
+	}
+	if used, err := s.UseRecoveryCode(&models.User{ID: 8, Username: "bob"}, codes[1], ""); err != nil || used {
+		t.Errorf("UseRecoveryCode with the code of another user = %v, %v; want false", used, err)
+	}
+	if left, err := s.RecoveryCodesLeft(user.ID); err != nil || left != RecoveryCodeCount-1 {
+		t.Errorf("RecoveryCodesLeft = %d, %v; want %d", left, err, RecoveryCodeCount-1)
+	}
+
+	// Regenerating invalidates the old codes
+	if _, err := s.RegenerateRecoveryCodes(user, "192.0.2.1"); err != nil {
+		t.Fatalf("RegenerateRecoveryCodes: %v", err)
+	}
+	if used, err := s.UseRecoveryCode(user, codes[1], ""); err != nil || used {
+		t.Errorf("UseRecoveryCode with an old code = %v, %v; want false", used, err)
+	}
+	if left, err := s.RecoveryCodesLeft(user.ID); err != nil || left != RecoveryCodeCount {
+		t.Errorf("RecoveryCodesLeft after regenerating = %d, %v; want %d", left, err, RecoveryCodeCount)
+	}
+
+	for action, want := range map[string]int{AuditRecoveryCodeUsed: 1, AuditRecoveryCodesRegenerated: 1} {
+		entries, err := s.audit.FindAll("user", action, 0, 0)
+		if err != nil {
+			t.Fatalf("FindAll: %v", err)
+		}
+		if len(entries) != want {
+			t.Errorf("%d %s audit entries, want %d", len(entries), action, want)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package auth
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/home/unixify/internal/models"
+)
+
+// Audit actions of logins
+const (
+	AuditLoginFailed  = "login_failed"
+	AuditLoginRefused = "login_refused"
+	AuditLockout      = "lockout"
+	AuditUnlock       = "unlock"
+)
+
+// LoginWait returns how long a username must wait before logging in again
+// from a client IP address; 0 means it may try now. Refused attempts are
+// audited.
+func (s *Service) LoginWait(username, clientIP string) (time.Duration, error) {
+	now := time.Now().UTC()
+	var until time.Time
+	for _, subject := range loginSubjects(username, clientIP) {
+		attempt, err := s.logins.Find(subject.kind, subject.name)
+		if err != nil {
+			return 0, err
+		}
+		if attempt != nil && attempt.LockedUntil.After(until) {
+			until = attempt.LockedUntil
+		}
+	}
+	if !until.After(now) {
+		return 0, nil
+	}
+
+	wait := until.Sub(now)
+	details := fmt.Sprintf("Refused login for %s: locked for %s", username, wait.Round(time.Second))
+	if err := s.auditLogin(AuditLoginRefused, 0, username, clientIP, details); err != nil {
+		return 0, err
+	}
+	return wait, nil
+}
+
+// RecordLoginFailure counts a failed login for the username and the client
+// IP address, refuses further logins for a while, and audits it. userID is
+// 0 for unknown usernames.
+func (s *Service) RecordLoginFailure(userID uint, username, clientIP, reason string) error {
+	now := time.Now().UTC()
+	if err := s.logins.DeleteStale(now.Add(-s.config.Logins.Lockout)); err != nil {
+		return err
+	}
+
+	details := fmt.Sprintf("Failed login for %s: %s", username, reason)
+	if err := s.auditLogin(AuditLoginFailed, userID, username, clientIP, details); err != nil {
+		return err
+	}
+	for _, subject := range loginSubjects(username, clientIP) {
+		attempt, err := s.logins.RecordFailure(subject.kind, subject.name, now)
+		if err != nil {
+			return err
+		}
+		max := s.config.Logins.MaxFailures
+		if subject.kind == models.LoginAttemptIP {
+			max = s.config.Logins.MaxIPFailures
+		}
+		wait := s.backoff(attempt.Failures)
+		if attempt.Failures >= max {
+			wait = s.config.Logins.Lockout
+		}
+		if err := s.logins.Lock(attempt.ID, now.Add(wait)); err != nil {
+			return err
+		}
+
+		if attempt.Failures == max {
+			details := fmt.Sprintf("Locked out %s %s for %s after %d failed logins", subject.kind, subject.name, wait, max)
+			if err := s.auditLogin(AuditLockout, userID, username, clientIP, details); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// RecordLoginSuccess forgets the failed logins of a username. Those from
+// the client IP address are kept, so that logging in to one account does
+// not clear guesses at others.
+func (s *Service) RecordLoginSuccess(username string) error {
+	return s.logins.Delete(models.LoginAttemptUsername, username)
+}
+
+// Lockouts lists the usernames and client IP addresses that may not log in
+// at the moment
+func (s *Service) Lockouts() ([]models.LoginAttempt, error) {
+	return s.logins.FindLocked(time.Now().UTC())
+}
+
+// Unlock forgets the failed logins of a username or client IP address,
+// letting it log in at once, and audits who did it
+func (s *Service) Unlock(kind, subject string, admin *models.UserResponse, clientIP string) error {
+	if err := s.logins.Delete(kind, subject); err != nil {
+		return err
+	}
+	return s.audit.Create(&models.AuditEntry{
+		Action:     AuditUnlock,
+		EntityType: "user",
+		Details:    fmt.Sprintf("Unlocked logins of %s %s", kind, subject),
+		UserID:     admin.ID,
+		Username:   admin.Username,
+		IPAddress:  clientIP,
+		Timestamp:  time.Now(),
+	})
+}
+
+// backoff returns how long logins are refused after a number of failures:
+// Backoff after the first, doubling with each further one, up to Lockout
+func (s *Service) backoff(failures int) time.Duration {
+	wait := s.config.Logins.Backoff
+	for i := 1; i < failures && wait < s.config.Logins.Lockout; i++ {
+		wait *= 2
+	}
+	if wait > s.config.Logins.Lockout {
+		wait = s.config.Logins.Lockout
+	}
+	return wait
+}
+
+// auditLogin logs an audit entry for a login attempt, under the username
+// that was tried
+func (s *Service) auditLogin(action string, userID uint, username, clientIP, details string) error {
+	return s.audit.Create(&models.AuditEntry{
+		Action:     action,
+		EntityID:   userID,
+		EntityType: "user",
+		Details:    details,
+		UserID:     userID,
+		Username:   username,
+		IPAddress:  clientIP,
+		Timestamp:  time.Now(),
+	})
+}
+
+// loginSubject is a username or client IP address that failed logins are
+// counted for
+type loginSubject struct {
+	kind, name string
+}
+
+// loginSubjects returns the counters a login attempt is checked against
+func loginSubjects(username, clientIP string) []loginSubject {
+	return []loginSubject{
+		{models.LoginAttemptUsername, username},
+		{models.LoginAttemptIP, clientIP},
+	}
+}
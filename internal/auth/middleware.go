@@ -48,8 +48,21 @@ func (s *Service) AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		// The session must still be live: logout, password changes and
+		// disabling the user revoke it
+		sessionID, err := s.GetSessionFromToken(token)
+		if err == nil {
+			err = s.CheckSession(sessionID)
+		}
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has expired or been revoked"})
+			c.Abort()
+			return
+		}
+
 		// Store user info in the context for later use in handlers
 		c.Set("user", user)
+		c.Set("sessionID", sessionID)
 		c.Set("userID", user.ID)
 		c.Set("username", user.Username)
 		c.Set("role", user.Role)
@@ -99,9 +112,21 @@ func (s *Service) GuestMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		// Revoked sessions are guests too
+		sessionID, err := s.GetSessionFromToken(token)
+		if err == nil {
+			err = s.CheckSession(sessionID)
+		}
+		if err != nil {
+			c.Set("isGuest", true)
+			c.Next()
+			return
+		}
+
 		// Store authenticated user info in the context
 		c.Set("isGuest", false)
 		c.Set("user", user)
+		c.Set("sessionID", sessionID)
 		c.Set("userID", user.ID)
 		c.Set("username", user.Username)
 		c.Set("role", user.Role)
@@ -110,6 +135,14 @@ func (s *Service) GuestMiddleware() gin.HandlerFunc {
 	}
 }
 
+// SessionID returns the session of a request authenticated by AuthMiddleware
+// or GuestMiddleware, or 0 for guests
+func SessionID(c *gin.Context) uint {
+	sessionID, _ := c.Get("sessionID")
+	id, _ := sessionID.(uint)
+	return id
+}
+
 // RoleMiddleware checks if the user has the required role
 func (s *Service) RoleMiddleware(roles ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/home/unixify/internal/models"
+)
+
+// RecoveryCodeCount is how many recovery codes a user gets at a time
+const RecoveryCodeCount = 10
+
+// Audit actions of recovery codes
+const (
+	AuditRecoveryCodeUsed         = "recovery_code_used"
+	AuditRecoveryCodesRegenerated = "recovery_codes_regenerated"
+)
+
+// recoveryEncoding writes recovery codes in Crockford's base32, in lower
+// case. It has no i, l or o, which are read as 1, 1 and 0.
+var recoveryEncoding = base32.NewEncoding("0123456789abcdefghjkmnpqrstvwxyz").WithPadding(base32.NoPadding)
+
+// recoveryReplacer undoes the ways recovery codes are mistyped
+var recoveryReplacer = strings.NewReplacer("-", "", " ", "", "i", "1", "l", "1", "o", "0")
+
+// GenerateRecoveryCodes gives a user a new set of recovery codes, which
+// replaces any earlier set. Only their hashes are stored, so the codes
+// cannot be shown again.
+func (s *Service) GenerateRecoveryCodes(user *models.User) ([]string, error) {
+	codes := make([]string, RecoveryCodeCount)
+	hashes := make([]string, RecoveryCodeCount)
+	for i := range codes {
+		// 10 bytes make 16 characters, written in groups of 4
+		b := make([]byte, 10)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		code := recoveryEncoding.EncodeToString(b)
+		codes[i] = code[0:4] + "-" + code[4:8] + "-" + code[8:12] + "-" + code[12:16]
+		hashes[i] = hashSecret(code)
+	}
+	if err := s.recovery.Replace(user.ID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// RegenerateRecoveryCodes gives a user a new set of recovery codes like
+// GenerateRecoveryCodes, and audits it
+func (s *Service) RegenerateRecoveryCodes(user *models.User, clientIP string) ([]string, error) {
+	codes, err := s.GenerateRecoveryCodes(user)
+	if err != nil {
+		return nil, err
+	}
+	details := fmt.Sprintf("Regenerated the recovery codes of %s", user.Username)
+	if err := s.auditLogin(AuditRecoveryCodesRegenerated, user.ID, user.Username, clientIP, details); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// UseRecoveryCode accepts a recovery code of a user in place of a TOTP
+// code. Each code works once; its use is audited.
+func (s *Service) UseRecoveryCode(user *models.User, code, clientIP string) (bool, error) {
+	code = recoveryReplacer.Replace(strings.ToLower(code))
+	used, err := s.recovery.Use(user.ID, hashSecret(code), time.Now().UTC())
+	if err != nil || !used {
+		return false, err
+	}
+
+	left, err := s.recovery.CountUnused(user.ID)
+	if err != nil {
+		return false, err
+	}
+	details := fmt.Sprintf("%s logged in with a recovery code, %d left", user.Username, left)
+	if err := s.auditLogin(AuditRecoveryCodeUsed, user.ID, user.Username, clientIP, details); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// RecoveryCodesLeft counts the recovery codes a user has not used
+func (s *Service) RecoveryCodesLeft(userID uint) (int64, error) {
+	return s.recovery.CountUnused(userID)
+}
+
+// DeleteRecoveryCodes deletes the recovery codes of a user, such as when
+// TOTP is disabled
+func (s *Service) DeleteRecoveryCodes(userID uint) error {
+	return s.recovery.DeleteByUser(userID)
+}
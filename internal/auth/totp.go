@@ -2,7 +2,9 @@ package auth
 
 import (
 	"bytes"
+	"crypto/subtle"
 	"encoding/base64"
+	"errors"
 	"image/png"
 	"time"
 
@@ -11,6 +13,25 @@ import (
 	"github.com/pquerna/otp/totp"
 )
 
+// A TOTP challenge expires after TOTPChallengeTTL and allows
+// MaxTOTPAttempts codes
+const (
+	TOTPChallengeTTL = 5 * time.Minute
+	MaxTOTPAttempts  = 5
+)
+
+// ErrInvalidTOTPToken is returned for TOTP tokens that are unknown, expired
+// or used up
+var ErrInvalidTOTPToken = errors.New("invalid or expired TOTP token")
+
+// totpOpts are the TOTP parameters authenticator apps use
+var totpOpts = totp.ValidateOpts{
+	Period:    30,
+	Skew:      1,
+	Digits:    otp.DigitsSix,
+	Algorithm: otp.AlgorithmSHA1,
+}
+
 // GenerateTOTPSecret generates a new TOTP secret for a user
 func (s *Service) GenerateTOTPSecret(username string) (*models.TOTPSetupResponse, error) {
 	issuer := s.config.Server.TOTPIssuer
@@ -45,23 +66,90 @@ func (s *Service) GenerateTOTPSecret(username string) (*models.TOTPSetupResponse
 	return response, nil
 }
 
-// VerifyTOTP verifies a TOTP code against a secret
-func (s *Service) VerifyTOTP(secret, code string) bool {
-	valid, err := totp.ValidateCustom(
-		code,
-		secret,
-		time.Now().UTC(),
-		totp.ValidateOpts{
-			Period:    30,
-			Skew:      1,
-			Digits:    otp.DigitsSix,
-			Algorithm: otp.AlgorithmSHA1,
-		},
-	)
-	
+// VerifyTOTP verifies a TOTP code against the secret of a user. A code
+// works once: it is refused if a code of the same time step, or a later
+// one, was accepted before.
+func (s *Service) VerifyTOTP(user *models.User, code string) (bool, error) {
+	step, ok := totpStep(user.TOTPSecret, code, time.Now().UTC())
+	if !ok {
+		return false, nil
+	}
+	claimed, err := s.users.ClaimTOTPStep(user.ID, step)
+	if err != nil || !claimed {
+		return false, err
+	}
+	user.TOTPLastStep = step
+	return true, nil
+}
+
+// totpStep returns the time step a code belongs to, allowing for the
+// clock skew of totpOpts
+func totpStep(secret, code string, at time.Time) (int64, bool) {
+	if secret == "" {
+		return 0, false
+	}
+	current := at.Unix() / int64(totpOpts.Period)
+	for step := current - int64(totpOpts.Skew); step <= current+int64(totpOpts.Skew); step++ {
+		expected, err := totp.GenerateCodeCustom(secret, time.Unix(step*int64(totpOpts.Period), 0).UTC(), totpOpts)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// StartTOTPChallenge returns a token for a user who gave the right password
+// and still has to give a TOTP code. The token only works for that, for
+// TOTPChallengeTTL and MaxTOTPAttempts codes.
+func (s *Service) StartTOTPChallenge(user *models.User) (string, error) {
+	if err := s.totp.DeleteExpired(time.Now().UTC()); err != nil {
+		return "", err
+	}
+
+	token, err := randomString(32)
 	if err != nil {
-		return false
+		return "", err
 	}
-	
-	return valid
-}
\ No newline at end of file
+	challenge := &models.TOTPChallenge{
+		UserID:    user.ID,
+		TokenHash: hashSecret(token),
+		ExpiresAt: time.Now().UTC().Add(TOTPChallengeTTL),
+	}
+	if err := s.totp.Create(challenge); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// CheckTOTPChallenge returns the challenge of a token and counts a code
+// tried with it, or returns ErrInvalidTOTPToken. A token that has been
+// tried MaxTOTPAttempts times is deleted.
+func (s *Service) CheckTOTPChallenge(token string) (*models.TOTPChallenge, error) {
+	challenge, err := s.totp.FindByTokenHash(hashSecret(token))
+	if err != nil {
+		return nil, err
+	}
+	if challenge == nil || time.Now().UTC().After(challenge.ExpiresAt) {
+		return nil, ErrInvalidTOTPToken
+	}
+	counted, err := s.totp.AddAttempt(challenge.ID, MaxTOTPAttempts)
+	if err != nil {
+		return nil, err
+	}
+	if !counted {
+		if err := s.totp.Delete(challenge.ID); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidTOTPToken
+	}
+	return challenge, nil
+}
+
+// FinishTOTPChallenge deletes the challenge of a completed login, so its
+// token cannot be used again
+func (s *Service) FinishTOTPChallenge(challenge *models.TOTPChallenge) error {
+	return s.totp.Delete(challenge.ID)
+}
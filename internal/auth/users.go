@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"github.com/home/unixify/internal/models"
+)
+
+// Errors returned when registering and authenticating users
+var (
+	ErrUsernameTaken      = errors.New("username already exists")
+	ErrEmailTaken         = errors.New("email already exists")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// dummyPasswordHash is a bcrypt hash, at the cost HashPassword uses, that
+// passwords of unknown usernames are checked against. Checking them takes
+// as long as for a real user, so the time taken does not tell which
+// usernames exist.
+const dummyPasswordHash = "$2a$10$Hlh.lIVVGlvUagk02uLfo.oij1Be1HTpeYGsw0bXVlMoNxWi5z16u"
+
+// Register creates a user with a bcrypt hash of their password
+func (s *Service) Register(req *models.RegisterUserRequest) (*models.User, error) {
+	existing, err := s.users.FindByUsername(req.Username)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, ErrUsernameTaken
+	}
+	existing, err = s.users.FindByEmail(req.Email)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, ErrEmailTaken
+	}
+
+	hashedPassword, err := s.HashPassword(req.Password)
+	if err != nil {
+		return nil, err
+	}
+	user := &models.User{
+		Username:   req.Username,
+		Password:   hashedPassword,
+		Email:      req.Email,
+		Role:       "user", // Default role for new users
+		Active:     true,
+		FirstName:  req.FirstName,
+		LastName:   req.LastName,
+		Department: req.Department,
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+	}
+	if err := s.users.Create(user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// Authenticate returns the user with a username and password, or
+// ErrInvalidCredentials. Disabled users are returned too; the caller
+// decides how to turn them away.
+func (s *Service) Authenticate(username, password string) (*models.User, error) {
+	user, err := s.users.FindByUsername(username)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		s.CheckPassword(password, dummyPasswordHash)
+		return nil, ErrInvalidCredentials
+	}
+	if !s.CheckPassword(password, user.Password) {
+		return nil, ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+// User finds a user by ID; it returns nil if there is none
+func (s *Service) User(id uint) (*models.User, error) {
+	return s.users.FindByID(id)
+}
+
+// UserByUsername finds a user by username; it returns nil if there is none
+func (s *Service) UserByUsername(username string) (*models.User, error) {
+	return s.users.FindByUsername(username)
+}
+
+// SaveUser saves a changed user
+func (s *Service) SaveUser(user *models.User) error {
+	user.UpdatedAt = time.Now()
+	return s.users.Update(user)
+}
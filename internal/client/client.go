@@ -0,0 +1,486 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/home/unixify/internal/models"
+)
+
+// Client is a small HTTP client for the Unixify REST API
+type Client struct {
+	BaseURL      string
+	Token        string
+	RefreshToken string // Exchanged for a new Token when the server rejects it
+	// OnRefresh is called with the new tokens after a refresh, to store them
+	OnRefresh func(token, refreshToken string)
+	HostToken string // Sent as X-Unixify-Host-Token for the host-scoped API
+	HTTP      *http.Client
+}
+
+// New creates a new API client
+func New(baseURL, token string) *Client {
+	return &Client{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		Token:   token,
+		HTTP:    &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// APIError is returned when the server answers with a non-2xx status
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+// Error implements the error interface
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s (HTTP %d)", e.Message, e.StatusCode)
+}
+
+// LoginResult is the outcome of a login or TOTP verification
+type LoginResult struct {
+	Token        string              `json:"token"`
+	RefreshToken string              `json:"refresh_token"`
+	ExpiresIn    int                 `json:"expires_in"` // Seconds until Token expires
+	RequiresTOTP bool                `json:"requires_totp"`
+	TOTPToken    string              `json:"totp_token"` // Passed to VerifyTOTP when RequiresTOTP is set
+	User         models.UserResponse `json:"user"`
+}
+
+// AccountInput is the payload for creating or updating an account
+type AccountInput struct {
+	UID            int                `json:"uid"`
+	Username       string             `json:"username"`
+	Type           models.AccountType `json:"type"`
+	PrimaryGroupID uint               `json:"primary_group_id"`
+	Firstname      string             `json:"firstname"`
+	Surname        string             `json:"surname"`
+	// Generates the username on create when Username is empty
+	UsernameTemplate string `json:"username_template,omitempty"`
+}
+
+// GroupInput is the payload for creating or updating a group
+type GroupInput struct {
+	GID         int              `json:"gid"`
+	Groupname   string           `json:"groupname"`
+	Description string           `json:"description"`
+	Type        models.GroupType `json:"type"`
+}
+
+// AuditFilter narrows down audit entry listings
+type AuditFilter struct {
+	EntityType string
+	Action     string
+	EntityID   uint
+	UserID     uint
+}
+
+// do sends a request and decodes the JSON response into out (when not nil)
+func (c *Client) do(method, path string, query url.Values, body, out interface{}) error {
+	return c.send(method, path, query, nil, body, out)
+}
+
+// ifMatch returns the header that makes a write conditional on version; 0 matches any version
+func ifMatch(version int) http.Header {
+	etag := "*"
+	if version != 0 {
+		etag = `"` + strconv.Itoa(version) + `"`
+	}
+	return http.Header{"If-Match": []string{etag}}
+}
+
+// send is do with extra request headers. An expired access token is
+// refreshed once with RefreshToken and the request sent again.
+func (c *Client) send(method, path string, query url.Values, header http.Header, body, out interface{}) error {
+	err := c.attempt(method, path, query, header, body, out)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized || c.RefreshToken == "" || path == refreshPath {
+		return err
+	}
+	if refreshErr := c.Refresh(); refreshErr != nil {
+		return err
+	}
+	return c.attempt(method, path, query, header, body, out)
+}
+
+// attempt sends a request once
+func (c *Client) attempt(method, path string, query url.Values, header http.Header, body, out interface{}) error {
+	endpoint := c.BaseURL + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, endpoint, reader)
+	if err != nil {
+		return err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	if c.HostToken != "" {
+		req.Header.Set("X-Unixify-Host-Token", c.HostToken)
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return fmt.Errorf("request to %s failed: %w", c.BaseURL, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		message := strings.TrimSpace(string(data))
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Error != "" {
+			message = apiErr.Error
+		}
+		if message == "" {
+			message = http.StatusText(resp.StatusCode)
+		}
+		return &APIError{StatusCode: resp.StatusCode, Message: message}
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// Login authenticates with a username and password
+func (c *Client) Login(username, password string) (*LoginResult, error) {
+	var result LoginResult
+	err := c.do(http.MethodPost, "/api/auth/login", nil, models.LoginRequest{Username: username, Password: password}, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// refreshPath exchanges refresh tokens
+const refreshPath = "/api/auth/refresh"
+
+// Refresh exchanges RefreshToken for new tokens and calls OnRefresh with them
+func (c *Client) Refresh() error {
+	var result LoginResult
+	body := map[string]string{"refresh_token": c.RefreshToken}
+	if err := c.attempt(http.MethodPost, refreshPath, nil, nil, body, &result); err != nil {
+		return err
+	}
+	c.Token, c.RefreshToken = result.Token, result.RefreshToken
+	if c.OnRefresh != nil {
+		c.OnRefresh(c.Token, c.RefreshToken)
+	}
+	return nil
+}
+
+// Logout revokes the session of the client's tokens
+func (c *Client) Logout() error {
+	return c.do(http.MethodPost, "/api/auth/logout", nil, nil, nil)
+}
+
+// VerifyTOTP completes a login that requires a TOTP code, with the
+// TOTPToken of the login
+func (c *Client) VerifyTOTP(totpToken, code string) (*LoginResult, error) {
+	var result LoginResult
+	body := map[string]string{"totp_token": totpToken, "token": code}
+	if err := c.do(http.MethodPost, "/api/auth/verify-totp", nil, body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// VerifyRecoveryCode completes a login that requires a TOTP code with a
+// recovery code instead
+func (c *Client) VerifyRecoveryCode(totpToken, code string) (*LoginResult, error) {
+	var result LoginResult
+	body := map[string]string{"totp_token": totpToken, "recovery_code": code}
+	if err := c.do(http.MethodPost, "/api/auth/verify-totp", nil, body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Accounts lists accounts, optionally filtered by type
+func (c *Client) Accounts(accountType models.AccountType) ([]models.Account, error) {
+	query := url.Values{}
+	if accountType != "" {
+		query.Set("type", string(accountType))
+	}
+	var accounts []models.Account
+	err := c.do(http.MethodGet, "/api/accounts", query, nil, &accounts)
+	return accounts, err
+}
+
+// Account gets an account by ID
+func (c *Client) Account(id uint) (*models.Account, error) {
+	var account models.Account
+	if err := c.do(http.MethodGet, fmt.Sprintf("/api/accounts/%d", id), nil, nil, &account); err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// AccountByUsername gets an account by username
+func (c *Client) AccountByUsername(username string) (*models.Account, error) {
+	var account models.Account
+	if err := c.do(http.MethodGet, "/api/accounts/username/"+url.PathEscape(username), nil, nil, &account); err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// AccountByUID gets an account by UID
+func (c *Client) AccountByUID(uid int) (*models.Account, error) {
+	var account models.Account
+	if err := c.do(http.MethodGet, "/api/accounts/uid/"+strconv.Itoa(uid), nil, nil, &account); err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// CreateAccount creates an account
+func (c *Client) CreateAccount(input AccountInput) (*models.Account, error) {
+	var account models.Account
+	if err := c.do(http.MethodPost, "/api/accounts", nil, input, &account); err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// UpdateAccount updates an account, provided it is still at version (0 matches any)
+func (c *Client) UpdateAccount(id uint, version int, input AccountInput) (*models.Account, error) {
+	var account models.Account
+	if err := c.send(http.MethodPut, fmt.Sprintf("/api/accounts/%d", id), nil, ifMatch(version), input, &account); err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// DeleteAccount deletes an account, provided it is still at version (0 matches any)
+func (c *Client) DeleteAccount(id uint, version int) error {
+	return c.send(http.MethodDelete, fmt.Sprintf("/api/accounts/%d", id), nil, ifMatch(version), nil, nil)
+}
+
+// AccountGroups lists the groups an account is a member of
+func (c *Client) AccountGroups(id uint) ([]models.Group, error) {
+	var groups []models.Group
+	err := c.do(http.MethodGet, fmt.Sprintf("/api/accounts/%d/groups", id), nil, nil, &groups)
+	return groups, err
+}
+
+// Groups lists groups, optionally filtered by type
+func (c *Client) Groups(groupType models.GroupType) ([]models.Group, error) {
+	query := url.Values{}
+	if groupType != "" {
+		query.Set("type", string(groupType))
+	}
+	var groups []models.Group
+	err := c.do(http.MethodGet, "/api/groups", query, nil, &groups)
+	return groups, err
+}
+
+// Group gets a group by ID
+func (c *Client) Group(id uint) (*models.Group, error) {
+	var group models.Group
+	if err := c.do(http.MethodGet, fmt.Sprintf("/api/groups/%d", id), nil, nil, &group); err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// GroupByGroupname gets a group by groupname
+func (c *Client) GroupByGroupname(groupname string) (*models.Group, error) {
+	var group models.Group
+	if err := c.do(http.MethodGet, "/api/groups/groupname/"+url.PathEscape(groupname), nil, nil, &group); err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// GroupByGID gets a group by GID
+func (c *Client) GroupByGID(gid int) (*models.Group, error) {
+	var group models.Group
+	if err := c.do(http.MethodGet, "/api/groups/gid/"+strconv.Itoa(gid), nil, nil, &group); err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// CreateGroup creates a group
+func (c *Client) CreateGroup(input GroupInput) (*models.Group, error) {
+	var group models.Group
+	if err := c.do(http.MethodPost, "/api/groups", nil, input, &group); err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// UpdateGroup updates a group, provided it is still at version (0 matches any)
+func (c *Client) UpdateGroup(id uint, version int, input GroupInput) (*models.Group, error) {
+	var group models.Group
+	if err := c.send(http.MethodPut, fmt.Sprintf("/api/groups/%d", id), nil, ifMatch(version), input, &group); err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// DeleteGroup deletes a group, provided it is still at version (0 matches any)
+func (c *Client) DeleteGroup(id uint, version int) error {
+	return c.send(http.MethodDelete, fmt.Sprintf("/api/groups/%d", id), nil, ifMatch(version), nil, nil)
+}
+
+// GroupMembers lists the accounts in a group
+func (c *Client) GroupMembers(id uint) ([]models.Account, error) {
+	var accounts []models.Account
+	err := c.do(http.MethodGet, fmt.Sprintf("/api/groups/%d/accounts", id), nil, nil, &accounts)
+	return accounts, err
+}
+
+// AddMembership assigns an account to a group
+func (c *Client) AddMembership(accountID, groupID uint) error {
+	body := map[string]uint{"account_id": accountID, "group_id": groupID}
+	return c.do(http.MethodPost, "/api/memberships", nil, body, nil)
+}
+
+// RemoveMembership removes an account from a group
+func (c *Client) RemoveMembership(accountID, groupID uint) error {
+	body := map[string]uint{"account_id": accountID, "group_id": groupID}
+	return c.do(http.MethodDelete, "/api/memberships", nil, body, nil)
+}
+
+// Search searches accounts and groups together; a limit of 0 uses the
+// server's default
+func (c *Client) Search(q string, limit int) ([]models.SearchResult, error) {
+	query := url.Values{"q": {q}}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	var results []models.SearchResult
+	err := c.do(http.MethodGet, "/api/search", query, nil, &results)
+	return results, err
+}
+
+// SearchAccounts finds the accounts matching a query in the query language
+func (c *Client) SearchAccounts(q string) ([]models.Account, error) {
+	var accounts []models.Account
+	err := c.do(http.MethodGet, "/api/search/accounts", url.Values{"q": {q}}, nil, &accounts)
+	return accounts, err
+}
+
+// SearchGroups finds the groups matching a query in the query language
+func (c *Client) SearchGroups(q string) ([]models.Group, error) {
+	var groups []models.Group
+	err := c.do(http.MethodGet, "/api/search/groups", url.Values{"q": {q}}, nil, &groups)
+	return groups, err
+}
+
+// AuditEntries lists audit entries matching the filter
+func (c *Client) AuditEntries(filter AuditFilter) ([]models.AuditEntry, error) {
+	query := url.Values{}
+	if filter.EntityType != "" {
+		query.Set("entity_type", filter.EntityType)
+	}
+	if filter.Action != "" {
+		query.Set("action", filter.Action)
+	}
+	if filter.EntityID != 0 {
+		query.Set("entity_id", strconv.FormatUint(uint64(filter.EntityID), 10))
+	}
+	if filter.UserID != 0 {
+		query.Set("user_id", strconv.FormatUint(uint64(filter.UserID), 10))
+	}
+	var entries []models.AuditEntry
+	err := c.do(http.MethodGet, "/api/audit", query, nil, &entries)
+	return entries, err
+}
+
+// AuditEntry gets a single audit entry
+func (c *Client) AuditEntry(id uint) (*models.AuditEntry, error) {
+	var entry models.AuditEntry
+	if err := c.do(http.MethodGet, fmt.Sprintf("/api/audit/%d", id), nil, nil, &entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// NextUID returns the next free UID for an account type
+func (c *Client) NextUID(accountType models.AccountType) (int, error) {
+	var result struct {
+		UID int `json:"uid"`
+	}
+	err := c.do(http.MethodGet, "/api/accounts/next-uid", url.Values{"type": {string(accountType)}}, nil, &result)
+	return result.UID, err
+}
+
+// NextGID returns the next free GID for a group type
+func (c *Client) NextGID(groupType models.GroupType) (int, error) {
+	var result struct {
+		GID int `json:"gid"`
+	}
+	err := c.do(http.MethodGet, "/api/groups/next-gid", url.Values{"type": {string(groupType)}}, nil, &result)
+	return result.GID, err
+}
+
+// Changes returns one page of the change feed after sequence number since
+func (c *Client) Changes(since int64, limit int) (*models.ChangeSet, error) {
+	query := url.Values{"since": {strconv.FormatInt(since, 10)}, "limit": {strconv.Itoa(limit)}}
+	var changes models.ChangeSet
+	if err := c.do(http.MethodGet, "/api/changes", query, nil, &changes); err != nil {
+		return nil, err
+	}
+	return &changes, nil
+}
+
+// ReportHost sends a host agent's sync report
+func (c *Client) ReportHost(report *models.HostReport) error {
+	return c.do(http.MethodPost, "/api/hosts/reports", nil, report, report)
+}
+
+// HostAccess returns the accounts, groups and memberships the host
+// authenticated by HostToken may see
+func (c *Client) HostAccess() (*models.HostAccess, error) {
+	var access models.HostAccess
+	if err := c.do(http.MethodGet, "/api/host/access", nil, nil, &access); err != nil {
+		return nil, err
+	}
+	return &access, nil
+}
+
+// ReportSelf sends a sync report for the host authenticated by HostToken
+func (c *Client) ReportSelf(report *models.HostReport) error {
+	return c.do(http.MethodPost, "/api/host/reports", nil, report, report)
+}
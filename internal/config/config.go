@@ -2,14 +2,27 @@ package config
 
 import (
 	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"regexp"
 	"strconv"
+	"strings"
+	"time"
+
+	"github.com/home/unixify/internal/models"
+	"github.com/home/unixify/internal/validator"
 )
 
 // Config holds all configuration for the application
 type Config struct {
 	Server   ServerConfig
 	Database DatabaseConfig
+	Webhooks WebhookConfig
+	Events   EventConfig
+	Logins   LoginConfig
+	SubIDs   SubIDConfig
+	Names    validator.NamePolicy
 }
 
 // ServerConfig holds server related configuration
@@ -18,16 +31,75 @@ type ServerConfig struct {
 	Mode      string
 	Secret    string
 	TOTPIssuer string
+	// AccessTokenTTL is how long an access token is valid; RefreshTokenTTL
+	// is how long a session lasts without logging in again
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	// GuestAccess lets visitors who are not logged in use every read route;
+	// without it reads need a login or a host token
+	GuestAccess bool
+	// TrustedProxies are the addresses and networks of reverse proxies whose
+	// X-Forwarded-For header gives the client address; empty trusts none
+	TrustedProxies []string
 }
 
+// Supported database drivers
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
 // DatabaseConfig holds database related configuration
 type DatabaseConfig struct {
+	// Driver selects the backend: postgres or sqlite
+	Driver   string
+	// Path is the database file used by the sqlite driver
+	Path     string
 	Host     string
 	Port     int
 	User     string
 	Password string
 	DBName   string
 	SSLMode  string
+	// AutoMigrate applies pending schema migrations when the server starts
+	AutoMigrate bool
+}
+
+// WebhookConfig holds webhook delivery configuration
+type WebhookConfig struct {
+	// Dispatch runs the delivery worker in this process
+	Dispatch     bool
+	PollInterval time.Duration
+	MaxAttempts  int
+	// AllowedTargets are host names, addresses and CIDR networks webhooks
+	// may point at although they are not public
+	AllowedTargets []string
+}
+
+// EventConfig holds event stream configuration
+type EventConfig struct {
+	// PollInterval is how often SQLite servers check the event log;
+	// PostgreSQL servers are notified instead
+	PollInterval time.Duration
+}
+
+// LoginConfig holds the brute-force protection of logins
+type LoginConfig struct {
+	// MaxFailures failed logins for one username, or MaxIPFailures from one
+	// client IP address, lock it out for Lockout
+	MaxFailures   int
+	MaxIPFailures int
+	Lockout       time.Duration
+	// Backoff is how long logins are refused after the first failure; it
+	// doubles with every further failure
+	Backoff time.Duration
+}
+
+// SubIDConfig holds the pool subordinate UID and GID blocks are allocated from
+type SubIDConfig struct {
+	// Start and End bound the pool; both are included
+	Start int
+	End   int
 }
 
 // Load loads configuration from environment variables
@@ -40,6 +112,8 @@ func Load() (*Config, error) {
 			TOTPIssuer: getEnvOrDefault("TOTP_ISSUER", "Unixify"),
 		},
 		Database: DatabaseConfig{
+			Driver:   getEnvOrDefault("DB_DRIVER", DriverPostgres),
+			Path:     getEnvOrDefault("DB_PATH", "unixify.db"),
 			Host:     getEnvOrDefault("DB_HOST", "localhost"),
 			User:     getEnvOrDefault("DB_USER", "postgres"),
 			Password: getEnvOrDefault("DB_PASSWORD", "postgres"),
@@ -48,15 +122,188 @@ func Load() (*Config, error) {
 		},
 	}
 
+	if cfg.Database.Driver != DriverPostgres && cfg.Database.Driver != DriverSQLite {
+		return nil, fmt.Errorf("invalid DB_DRIVER %q: expected %s or %s", cfg.Database.Driver, DriverPostgres, DriverSQLite)
+	}
+
 	dbPort, err := strconv.Atoi(getEnvOrDefault("DB_PORT", "5432"))
 	if err != nil {
 		return nil, fmt.Errorf("invalid DB_PORT: %v", err)
 	}
 	cfg.Database.Port = dbPort
 
+	accessTTL, err := time.ParseDuration(getEnvOrDefault("ACCESS_TOKEN_TTL", "15m"))
+	if err != nil || accessTTL <= 0 {
+		return nil, fmt.Errorf("invalid ACCESS_TOKEN_TTL: expected a positive duration such as 15m")
+	}
+	cfg.Server.AccessTokenTTL = accessTTL
+
+	refreshTTL, err := time.ParseDuration(getEnvOrDefault("REFRESH_TOKEN_TTL", "720h"))
+	if err != nil || refreshTTL < accessTTL {
+		return nil, fmt.Errorf("invalid REFRESH_TOKEN_TTL: expected a duration such as 720h, at least ACCESS_TOKEN_TTL")
+	}
+	cfg.Server.RefreshTokenTTL = refreshTTL
+
+	guestAccess, err := strconv.ParseBool(getEnvOrDefault("GUEST_ACCESS", "true"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid GUEST_ACCESS: %v", err)
+	}
+	cfg.Server.GuestAccess = guestAccess
+
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy == "" {
+			continue
+		}
+		if net.ParseIP(proxy) == nil {
+			if _, _, err := net.ParseCIDR(proxy); err != nil {
+				return nil, fmt.Errorf("invalid TRUSTED_PROXIES: %q is not an address or network", proxy)
+			}
+		}
+		cfg.Server.TrustedProxies = append(cfg.Server.TrustedProxies, proxy)
+	}
+
+	maxFailures, err := strconv.Atoi(getEnvOrDefault("LOGIN_MAX_FAILURES", "5"))
+	if err != nil || maxFailures < 1 {
+		return nil, fmt.Errorf("invalid LOGIN_MAX_FAILURES: expected a positive number")
+	}
+	cfg.Logins.MaxFailures = maxFailures
+
+	maxIPFailures, err := strconv.Atoi(getEnvOrDefault("LOGIN_MAX_IP_FAILURES", "20"))
+	if err != nil || maxIPFailures < 1 {
+		return nil, fmt.Errorf("invalid LOGIN_MAX_IP_FAILURES: expected a positive number")
+	}
+	cfg.Logins.MaxIPFailures = maxIPFailures
+
+	lockout, err := time.ParseDuration(getEnvOrDefault("LOGIN_LOCKOUT", "15m"))
+	if err != nil || lockout <= 0 {
+		return nil, fmt.Errorf("invalid LOGIN_LOCKOUT: expected a positive duration such as 15m")
+	}
+	cfg.Logins.Lockout = lockout
+
+	backoff, err := time.ParseDuration(getEnvOrDefault("LOGIN_BACKOFF", "1s"))
+	if err != nil || backoff < 0 || backoff > lockout {
+		return nil, fmt.Errorf("invalid LOGIN_BACKOFF: expected a duration such as 1s, at most LOGIN_LOCKOUT")
+	}
+	cfg.Logins.Backoff = backoff
+
+	autoMigrate, err := strconv.ParseBool(getEnvOrDefault("DB_AUTO_MIGRATE", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid DB_AUTO_MIGRATE: %v", err)
+	}
+	cfg.Database.AutoMigrate = autoMigrate
+
+	dispatch, err := strconv.ParseBool(getEnvOrDefault("WEBHOOK_DISPATCH", "true"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid WEBHOOK_DISPATCH: %v", err)
+	}
+	cfg.Webhooks.Dispatch = dispatch
+
+	pollInterval, err := time.ParseDuration(getEnvOrDefault("WEBHOOK_POLL_INTERVAL", "5s"))
+	if err != nil || pollInterval <= 0 {
+		return nil, fmt.Errorf("invalid WEBHOOK_POLL_INTERVAL: expected a positive duration such as 5s")
+	}
+	cfg.Webhooks.PollInterval = pollInterval
+
+	maxAttempts, err := strconv.Atoi(getEnvOrDefault("WEBHOOK_MAX_ATTEMPTS", "10"))
+	if err != nil || maxAttempts < 1 {
+		return nil, fmt.Errorf("invalid WEBHOOK_MAX_ATTEMPTS: expected a positive number")
+	}
+	cfg.Webhooks.MaxAttempts = maxAttempts
+
+	for _, target := range strings.Split(os.Getenv("WEBHOOK_ALLOWED_TARGETS"), ",") {
+		if target = strings.TrimSpace(target); target != "" {
+			cfg.Webhooks.AllowedTargets = append(cfg.Webhooks.AllowedTargets, target)
+		}
+	}
+
+	eventPollInterval, err := time.ParseDuration(getEnvOrDefault("EVENTS_POLL_INTERVAL", "1s"))
+	if err != nil || eventPollInterval <= 0 {
+		return nil, fmt.Errorf("invalid EVENTS_POLL_INTERVAL: expected a positive duration such as 1s")
+	}
+	cfg.Events.PollInterval = eventPollInterval
+
+	subIDs, err := parseSubIDRange(getEnvOrDefault("SUBID_RANGE", "100000-600100000"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid SUBID_RANGE: %v", err)
+	}
+	cfg.SubIDs = subIDs
+
+	names, err := loadNamePolicy()
+	if err != nil {
+		return nil, err
+	}
+	cfg.Names = names
+
 	return cfg, nil
 }
 
+// loadNamePolicy reads the username and group name policy; unset variables
+// keep the defaults of validator.DefaultNamePolicy
+func loadNamePolicy() (validator.NamePolicy, error) {
+	policy := validator.DefaultNamePolicy()
+
+	pattern, err := regexp.Compile(getEnvOrDefault("NAME_PATTERN", validator.DefaultNamePattern))
+	if err != nil {
+		return policy, fmt.Errorf("invalid NAME_PATTERN: %v", err)
+	}
+	policy.Pattern = pattern
+
+	maxLength, err := strconv.Atoi(getEnvOrDefault("NAME_MAX_LENGTH", strconv.Itoa(validator.DefaultNameMaxLength)))
+	if err != nil || maxLength < 1 {
+		return policy, fmt.Errorf("invalid NAME_MAX_LENGTH: expected a positive number")
+	}
+	policy.MaxLength = maxLength
+
+	if reserved, ok := os.LookupEnv("NAME_RESERVED"); ok {
+		policy.Reserved = nil
+		for _, name := range strings.Split(reserved, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				policy.Reserved = append(policy.Reserved, name)
+			}
+		}
+	}
+
+	accountPrefixes, err := validator.ParsePrefixes(getEnvOrDefault("ACCOUNT_NAME_PREFIXES", ""))
+	if err != nil {
+		return policy, fmt.Errorf("invalid ACCOUNT_NAME_PREFIXES: %v", err)
+	}
+	for t, prefix := range accountPrefixes {
+		policy.AccountPrefixes[models.AccountType(t)] = prefix
+	}
+	groupPrefixes, err := validator.ParsePrefixes(getEnvOrDefault("GROUP_NAME_PREFIXES", ""))
+	if err != nil {
+		return policy, fmt.Errorf("invalid GROUP_NAME_PREFIXES: %v", err)
+	}
+	for t, prefix := range groupPrefixes {
+		policy.GroupPrefixes[models.GroupType(t)] = prefix
+	}
+	return policy, nil
+}
+
+// parseSubIDRange parses a START-END subordinate ID pool. The pool must hold
+// at least one 65536-wide block and stay clear of the account and group ranges.
+func parseSubIDRange(spec string) (SubIDConfig, error) {
+	start, end, ok := strings.Cut(spec, "-")
+	if !ok {
+		return SubIDConfig{}, fmt.Errorf("expected START-END")
+	}
+	var pool SubIDConfig
+	var err error
+	if pool.Start, err = strconv.Atoi(strings.TrimSpace(start)); err != nil {
+		return SubIDConfig{}, fmt.Errorf("bad start %q", start)
+	}
+	if pool.End, err = strconv.Atoi(strings.TrimSpace(end)); err != nil {
+		return SubIDConfig{}, fmt.Errorf("bad end %q", end)
+	}
+	if pool.Start < 1 || pool.End > 4294967294 || pool.End-pool.Start+1 < 65536 {
+		return SubIDConfig{}, fmt.Errorf("expected a range of at least 65536 IDs between 1 and 4294967294")
+	}
+	if r, overlaps := validator.OverlappingRange(pool.Start, pool.End); overlaps {
+		return SubIDConfig{}, fmt.Errorf("overlaps the %s range %d-%d", r.Name, r.Min, r.Max)
+	}
+	return pool, nil
+}
+
 func getEnvOrDefault(key, defaultValue string) string {
 	if value, exists := os.LookupEnv(key); exists {
 		return value
@@ -66,10 +313,34 @@ func getEnvOrDefault(key, defaultValue string) string {
 
 // GetDSN returns the data source name for connecting to the database
 func (c *DatabaseConfig) GetDSN() string {
+	if c.Driver == DriverSQLite {
+		// Wait on locks instead of failing, and take the write lock when a
+		// transaction starts so concurrent requests queue up cleanly
+		query := url.Values{
+			"_pragma": {"busy_timeout(5000)", "journal_mode(WAL)"},
+			"_txlock": {"immediate"},
+		}
+		return "file:" + c.Path + "?" + query.Encode()
+	}
 	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
 		c.Host, c.Port, c.User, c.Password, c.DBName, c.SSLMode)
 }
 
+// GetURL returns the database URL used by the migration tooling
+func (c *DatabaseConfig) GetURL() string {
+	if c.Driver == DriverSQLite {
+		return "sqlite://" + c.Path
+	}
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(c.User, c.Password),
+		Host:     fmt.Sprintf("%s:%d", c.Host, c.Port),
+		Path:     "/" + c.DBName,
+		RawQuery: url.Values{"sslmode": {c.SSLMode}}.Encode(),
+	}
+	return u.String()
+}
+
 // GetString gets a string value from environment variables
 func (c *Config) GetString(key string) string {
 	return getEnvOrDefault(key, "")
@@ -0,0 +1,295 @@
+package doctor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/home/unixify/internal/models"
+	"github.com/home/unixify/internal/repository"
+	"github.com/home/unixify/internal/validator"
+)
+
+// Severity of a finding
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Check identifies the rule that produced a finding
+type Check string
+
+const (
+	CheckOrphanedMembership    Check = "orphaned-membership"
+	CheckDuplicateMembership   Check = "duplicate-membership"
+	CheckMissingPrimaryGroup   Check = "missing-primary-group"
+	CheckSystemPrimaryGroup    Check = "system-primary-group"
+	CheckIDOutOfRange          Check = "id-out-of-range"
+	CheckCaseDuplicate         Check = "case-duplicate"
+	CheckInvalidMembershipType Check = "invalid-membership-type"
+)
+
+// Finding is a single problem found in the registry
+type Finding struct {
+	Check        Check    `json:"check"`
+	Severity     Severity `json:"severity"`
+	Message      string   `json:"message"`
+	AccountID    uint     `json:"account_id,omitempty"`
+	GroupID      uint     `json:"group_id,omitempty"`
+	MembershipID uint     `json:"membership_id,omitempty"`
+	Fixable      bool     `json:"fixable"`
+	Fixed        bool     `json:"fixed"`
+}
+
+// Registry is the data the checks run against
+type Registry struct {
+	Accounts    []models.Account
+	Groups      []models.Group
+	Memberships []models.AccountGroup
+}
+
+// Load reads the registry through the repositories
+func Load(repos *repository.Repositories) (*Registry, error) {
+	accounts, err := repos.Account.FindAll("")
+	if err != nil {
+		return nil, fmt.Errorf("failed to load accounts: %w", err)
+	}
+	groups, err := repos.Group.FindAll("")
+	if err != nil {
+		return nil, fmt.Errorf("failed to load groups: %w", err)
+	}
+	memberships, err := repos.Account.FindAllMemberships()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load memberships: %w", err)
+	}
+	return &Registry{Accounts: accounts, Groups: groups, Memberships: memberships}, nil
+}
+
+// Diagnose runs every check and returns the findings ordered by severity and check
+func Diagnose(registry *Registry) []Finding {
+	accounts := make(map[uint]models.Account, len(registry.Accounts))
+	for _, account := range registry.Accounts {
+		accounts[account.ID] = account
+	}
+	groups := make(map[uint]models.Group, len(registry.Groups))
+	for _, group := range registry.Groups {
+		groups[group.ID] = group
+	}
+
+	var findings []Finding
+
+	// Memberships pointing at missing records, duplicated, or with incompatible types
+	seen := make(map[[2]uint]uint)
+	for _, membership := range registry.Memberships {
+		account, accountExists := accounts[membership.AccountID]
+		group, groupExists := groups[membership.GroupID]
+
+		if !accountExists || !groupExists {
+			var missing []string
+			if !accountExists {
+				missing = append(missing, fmt.Sprintf("account %d", membership.AccountID))
+			}
+			if !groupExists {
+				missing = append(missing, fmt.Sprintf("group %d", membership.GroupID))
+			}
+			findings = append(findings, Finding{
+				Check:        CheckOrphanedMembership,
+				Severity:     SeverityError,
+				Message:      fmt.Sprintf("membership %d references missing %s", membership.ID, strings.Join(missing, " and ")),
+				AccountID:    membership.AccountID,
+				GroupID:      membership.GroupID,
+				MembershipID: membership.ID,
+				Fixable:      true,
+			})
+			continue
+		}
+
+		pair := [2]uint{membership.AccountID, membership.GroupID}
+		if firstID, exists := seen[pair]; exists {
+			findings = append(findings, Finding{
+				Check:        CheckDuplicateMembership,
+				Severity:     SeverityWarning,
+				Message:      fmt.Sprintf("membership %d duplicates membership %d (%s in %s)", membership.ID, firstID, account.Username, group.Groupname),
+				AccountID:    membership.AccountID,
+				GroupID:      membership.GroupID,
+				MembershipID: membership.ID,
+				Fixable:      true,
+			})
+			continue
+		}
+		seen[pair] = membership.ID
+
+		if !validator.IsValidAccountGroupAssignment(account.Type, group.Type) {
+			findings = append(findings, Finding{
+				Check:        CheckInvalidMembershipType,
+				Severity:     SeverityError,
+				Message:      fmt.Sprintf("%s account %s is a member of %s group %s", account.Type, account.Username, group.Type, group.Groupname),
+				AccountID:    account.ID,
+				GroupID:      group.ID,
+				MembershipID: membership.ID,
+			})
+		}
+	}
+
+	for _, account := range registry.Accounts {
+		// Primary group references
+		primaryGroup, primaryExists := groups[account.PrimaryGroupID]
+		if account.PrimaryGroupID != 0 && !primaryExists {
+			findings = append(findings, Finding{
+				Check:     CheckMissingPrimaryGroup,
+				Severity:  SeverityError,
+				Message:   fmt.Sprintf("account %s has missing primary group %d", account.Username, account.PrimaryGroupID),
+				AccountID: account.ID,
+				GroupID:   account.PrimaryGroupID,
+				// Clearing the reference would leave a system account without a primary group
+				Fixable: account.Type != models.AccountTypeSystem,
+			})
+		}
+
+		if account.Type == models.AccountTypeSystem {
+			if account.PrimaryGroupID == 0 {
+				findings = append(findings, Finding{
+					Check:     CheckSystemPrimaryGroup,
+					Severity:  SeverityError,
+					Message:   fmt.Sprintf("system account %s has no primary group", account.Username),
+					AccountID: account.ID,
+				})
+			} else if primaryExists && primaryGroup.Type != models.GroupTypeSystem {
+				findings = append(findings, Finding{
+					Check:     CheckSystemPrimaryGroup,
+					Severity:  SeverityError,
+					Message:   fmt.Sprintf("system account %s has %s group %s as primary group", account.Username, primaryGroup.Type, primaryGroup.Groupname),
+					AccountID: account.ID,
+					GroupID:   primaryGroup.ID,
+				})
+			}
+		}
+
+		// UID ranges
+		if err := validator.ValidateUIDForType(account.UnixUID, account.Type); err != nil {
+			findings = append(findings, Finding{
+				Check:     CheckIDOutOfRange,
+				Severity:  SeverityWarning,
+				Message:   fmt.Sprintf("account %s: %s", account.Username, strings.TrimPrefix(err.Error(), "WARNING: ")),
+				AccountID: account.ID,
+			})
+		}
+	}
+
+	// GID ranges
+	for _, group := range registry.Groups {
+		if err := validator.ValidateGIDForType(group.UnixGID, group.Type); err != nil {
+			findings = append(findings, Finding{
+				Check:    CheckIDOutOfRange,
+				Severity: SeverityWarning,
+				Message:  fmt.Sprintf("group %s: %s", group.Groupname, strings.TrimPrefix(err.Error(), "WARNING: ")),
+				GroupID:  group.ID,
+			})
+		}
+	}
+
+	// Names that only differ by case
+	usernames := make(map[string][]string)
+	for _, account := range registry.Accounts {
+		key := strings.ToLower(account.Username)
+		usernames[key] = append(usernames[key], account.Username)
+	}
+	for _, names := range usernames {
+		if len(names) > 1 {
+			sort.Strings(names)
+			findings = append(findings, Finding{
+				Check:    CheckCaseDuplicate,
+				Severity: SeverityWarning,
+				Message:  fmt.Sprintf("usernames differ only by case: %s", strings.Join(names, ", ")),
+			})
+		}
+	}
+	groupnames := make(map[string][]string)
+	for _, group := range registry.Groups {
+		key := strings.ToLower(group.Groupname)
+		groupnames[key] = append(groupnames[key], group.Groupname)
+	}
+	for _, names := range groupnames {
+		if len(names) > 1 {
+			sort.Strings(names)
+			findings = append(findings, Finding{
+				Check:    CheckCaseDuplicate,
+				Severity: SeverityWarning,
+				Message:  fmt.Sprintf("groupnames differ only by case: %s", strings.Join(names, ", ")),
+			})
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].Severity != findings[j].Severity {
+			return findings[i].Severity == SeverityError
+		}
+		if findings[i].Check != findings[j].Check {
+			return findings[i].Check < findings[j].Check
+		}
+		return findings[i].Message < findings[j].Message
+	})
+
+	return findings
+}
+
+// Fix applies the safe repairs for fixable findings and records them in the audit log.
+// Orphaned and duplicate memberships are deleted, and dangling primary group
+// references on non-system accounts are cleared. Everything else needs a human.
+func Fix(repos *repository.Repositories, findings []Finding, username string) error {
+	for i := range findings {
+		finding := &findings[i]
+		if !finding.Fixable {
+			continue
+		}
+
+		var entityType, details string
+		var entityID uint
+		switch finding.Check {
+		case CheckOrphanedMembership, CheckDuplicateMembership:
+			if err := repos.Account.DeleteMembership(finding.MembershipID); err != nil {
+				return fmt.Errorf("failed to delete membership %d: %w", finding.MembershipID, err)
+			}
+			entityType = "account_group"
+			entityID = finding.AccountID
+			details = fmt.Sprintf("Deleted membership %d: %s", finding.MembershipID, finding.Message)
+
+		case CheckMissingPrimaryGroup:
+			account, err := repos.Account.FindByID(finding.AccountID)
+			if err != nil {
+				return err
+			}
+			account.PrimaryGroupID = 0
+			account.PrimaryGroup = nil
+			if err := repos.Account.Update(account); err != nil {
+				return fmt.Errorf("failed to clear primary group of %s: %w", account.Username, err)
+			}
+			entityType = "account"
+			entityID = account.ID
+			details = fmt.Sprintf("Cleared missing primary group %d of account %s", finding.GroupID, account.Username)
+
+		default:
+			continue
+		}
+
+		// Log audit entry
+		auditEntry := &models.AuditEntry{
+			Action:     "repair",
+			EntityID:   entityID,
+			EntityType: entityType,
+			Details:    details,
+			Username:   username,
+			IPAddress:  "local",
+			Timestamp:  time.Now(),
+		}
+		if err := repos.Audit.Create(auditEntry); err != nil {
+			return err
+		}
+		finding.Fixed = true
+	}
+
+	return nil
+}
@@ -0,0 +1,291 @@
+package doctor
+
+import (
+	"testing"
+
+	"github.com/home/unixify/internal/models"
+	"github.com/home/unixify/internal/repository"
+	"github.com/home/unixify/internal/repository/memory"
+)
+
+// duplicatedMemberships makes an account store list one membership twice,
+// as a database without the unique index could; the memory store refuses
+// duplicates
+type duplicatedMemberships struct {
+	repository.AccountStore
+	duplicate *models.AccountGroup
+}
+
+func (d *duplicatedMemberships) FindAllMemberships() ([]models.AccountGroup, error) {
+	memberships, err := d.AccountStore.FindAllMemberships()
+	if err != nil || d.duplicate == nil {
+		return memberships, err
+	}
+	return append(memberships, *d.duplicate), nil
+}
+
+func (d *duplicatedMemberships) DeleteMembership(id uint) error {
+	if d.duplicate != nil && d.duplicate.ID == id {
+		d.duplicate = nil
+		return nil
+	}
+	return d.AccountStore.DeleteMembership(id)
+}
+
+// fixture is a clean registry that each case adds one problem to
+type fixture struct {
+	repos  *repository.Repositories
+	staff  *models.Group
+	system *models.Group
+	alice  *models.Account
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	f := &fixture{repos: memory.NewRepositories()}
+	f.staff = f.group(t, "staff", 1000, models.GroupTypePeople)
+	f.system = f.group(t, "daemon", 100, models.GroupTypeSystem)
+	f.alice = f.account(t, "alice", 1001, models.AccountTypePeople, f.staff.ID)
+	f.account(t, "daemon", 100, models.AccountTypeSystem, f.system.ID)
+	return f
+}
+
+func (f *fixture) group(t *testing.T, groupname string, gid int, groupType models.GroupType) *models.Group {
+	t.Helper()
+	group := &models.Group{Groupname: groupname, UnixGID: gid, Type: groupType}
+	if err := f.repos.Group.Create(group); err != nil {
+		t.Fatalf("Create group %s: %v", groupname, err)
+	}
+	return group
+}
+
+func (f *fixture) account(t *testing.T, username string, uid int, accountType models.AccountType, primaryGroupID uint) *models.Account {
+	t.Helper()
+	account := &models.Account{Username: username, UnixUID: uid, Type: accountType, PrimaryGroupID: primaryGroupID}
+	if err := f.repos.Account.Create(account); err != nil {
+		t.Fatalf("Create account %s: %v", username, err)
+	}
+	return account
+}
+
+func (f *fixture) assign(t *testing.T, accountID, groupID uint) {
+	t.Helper()
+	if err := f.repos.Account.AssignToGroup(accountID, groupID); err != nil {
+		t.Fatalf("AssignToGroup: %v", err)
+	}
+}
+
+// diagnose loads the registry and runs the checks
+func (f *fixture) diagnose(t *testing.T) []Finding {
+	t.Helper()
+	registry, err := Load(f.repos)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	return Diagnose(registry)
+}
+
+func TestDiagnoseAndFix(t *testing.T) {
+	tests := []struct {
+		name     string
+		seed     func(t *testing.T, f *fixture)
+		check    Check
+		severity Severity
+		fixable  bool
+		// repaired checks the registry after Fix, for fixable findings
+		repaired func(t *testing.T, f *fixture)
+	}{
+		{
+			name:     "membership of a missing group",
+			seed:     func(t *testing.T, f *fixture) { f.assign(t, f.alice.ID, 99) },
+			check:    CheckOrphanedMembership,
+			severity: SeverityError,
+			fixable:  true,
+		},
+		{
+			name: "membership of a deleted account",
+			seed: func(t *testing.T, f *fixture) {
+				bob := f.account(t, "bob", 1002, models.AccountTypePeople, 0)
+				f.assign(t, bob.ID, f.staff.ID)
+				if err := f.repos.Account.Delete(bob.ID, 0); err != nil {
+					t.Fatalf("Delete: %v", err)
+				}
+			},
+			check:    CheckOrphanedMembership,
+			severity: SeverityError,
+			fixable:  true,
+		},
+		{
+			name: "duplicate membership",
+			seed: func(t *testing.T, f *fixture) {
+				devs := f.group(t, "devs", 1001, models.GroupTypePeople)
+				f.assign(t, f.alice.ID, devs.ID)
+				f.repos.Account = &duplicatedMemberships{
+					AccountStore: f.repos.Account,
+					duplicate:    &models.AccountGroup{ID: 1000, AccountID: f.alice.ID, GroupID: devs.ID},
+				}
+			},
+			check:    CheckDuplicateMembership,
+			severity: SeverityWarning,
+			fixable:  true,
+			repaired: func(t *testing.T, f *fixture) {
+				memberships, err := f.repos.Account.FindAllMemberships()
+				if err != nil || len(memberships) != 1 || memberships[0].ID == 1000 {
+					t.Errorf("memberships after fix = %+v, %v; want the first one kept", memberships, err)
+				}
+			},
+		},
+		{
+			name: "missing primary group",
+			seed: func(t *testing.T, f *fixture) {
+				f.account(t, "carol", 1003, models.AccountTypePeople, 99)
+			},
+			check:    CheckMissingPrimaryGroup,
+			severity: SeverityError,
+			fixable:  true,
+			repaired: func(t *testing.T, f *fixture) {
+				carol, err := f.repos.Account.FindByUsername("carol")
+				if err != nil || carol.PrimaryGroupID != 0 {
+					t.Errorf("carol after fix = %+v, %v; want no primary group", carol, err)
+				}
+			},
+		},
+		{
+			name: "missing primary group of a system account",
+			seed: func(t *testing.T, f *fixture) {
+				f.account(t, "backup", 101, models.AccountTypeSystem, 99)
+			},
+			check:    CheckMissingPrimaryGroup,
+			severity: SeverityError,
+		},
+		{
+			name: "system account without a primary group",
+			seed: func(t *testing.T, f *fixture) {
+				f.account(t, "backup", 101, models.AccountTypeSystem, 0)
+			},
+			check:    CheckSystemPrimaryGroup,
+			severity: SeverityError,
+		},
+		{
+			name: "system account with a people primary group",
+			seed: func(t *testing.T, f *fixture) {
+				f.account(t, "backup", 101, models.AccountTypeSystem, f.staff.ID)
+			},
+			check:    CheckSystemPrimaryGroup,
+			severity: SeverityError,
+		},
+		{
+			name: "UID out of range",
+			seed: func(t *testing.T, f *fixture) {
+				f.account(t, "carol", 500, models.AccountTypePeople, f.staff.ID)
+			},
+			check:    CheckIDOutOfRange,
+			severity: SeverityWarning,
+		},
+		{
+			name: "GID out of range",
+			seed: func(t *testing.T, f *fixture) {
+				f.group(t, "devs", 50, models.GroupTypePeople)
+			},
+			check:    CheckIDOutOfRange,
+			severity: SeverityWarning,
+		},
+		{
+			name: "usernames that differ by case",
+			seed: func(t *testing.T, f *fixture) {
+				f.account(t, "Alice", 1002, models.AccountTypePeople, f.staff.ID)
+			},
+			check:    CheckCaseDuplicate,
+			severity: SeverityWarning,
+		},
+		{
+			name: "groupnames that differ by case",
+			seed: func(t *testing.T, f *fixture) {
+				f.group(t, "Staff", 1001, models.GroupTypePeople)
+			},
+			check:    CheckCaseDuplicate,
+			severity: SeverityWarning,
+		},
+		{
+			name: "system account in a people group",
+			seed: func(t *testing.T, f *fixture) {
+				daemon, err := f.repos.Account.FindByUsername("daemon")
+				if err != nil {
+					t.Fatalf("FindByUsername: %v", err)
+				}
+				f.assign(t, daemon.ID, f.staff.ID)
+			},
+			check:    CheckInvalidMembershipType,
+			severity: SeverityError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t)
+			if findings := f.diagnose(t); len(findings) != 0 {
+				t.Fatalf("clean registry has findings: %+v", findings)
+			}
+			tt.seed(t, f)
+
+			// The problem is reported, and only it
+			findings := f.diagnose(t)
+			if len(findings) != 1 {
+				t.Fatalf("findings = %+v, want one %s", findings, tt.check)
+			}
+			finding := findings[0]
+			if finding.Check != tt.check || finding.Severity != tt.severity || finding.Fixable != tt.fixable {
+				t.Fatalf("finding = %+v, want %s %s with fixable %v", finding, tt.severity, tt.check, tt.fixable)
+			}
+
+			// Fixable problems are repaired and audited; the rest are left alone
+			if err := Fix(f.repos, findings, "doctor"); err != nil {
+				t.Fatalf("Fix: %v", err)
+			}
+			if findings[0].Fixed != tt.fixable {
+				t.Errorf("Fixed = %v, want %v", findings[0].Fixed, tt.fixable)
+			}
+			repairs, err := f.repos.Audit.FindAll("", "repair", 0, 0)
+			if err != nil {
+				t.Fatalf("FindAll: %v", err)
+			}
+			after := f.diagnose(t)
+			if tt.fixable {
+				if len(after) != 0 {
+					t.Errorf("findings after fix = %+v", after)
+				}
+				if len(repairs) != 1 || repairs[0].Username != "doctor" {
+					t.Errorf("repair audit = %+v, want one entry by doctor", repairs)
+				}
+				if tt.repaired != nil {
+					tt.repaired(t, f)
+				}
+			} else {
+				if len(after) != 1 || after[0].Check != tt.check {
+					t.Errorf("findings after fix = %+v, want the %s finding kept", after, tt.check)
+				}
+				if len(repairs) != 0 {
+					t.Errorf("repair audit = %+v, want none", repairs)
+				}
+			}
+		})
+	}
+}
+
+func TestDiagnoseOrdersErrorsFirst(t *testing.T) {
+	f := newFixture(t)
+	f.account(t, "carol", 500, models.AccountTypePeople, f.staff.ID)
+	f.assign(t, f.alice.ID, 99)
+	f.account(t, "backup", 101, models.AccountTypeSystem, 0)
+
+	findings := f.diagnose(t)
+	want := []Check{CheckOrphanedMembership, CheckSystemPrimaryGroup, CheckIDOutOfRange}
+	if len(findings) != len(want) {
+		t.Fatalf("findings = %+v", findings)
+	}
+	for i, check := range want {
+		if findings[i].Check != check {
+			t.Errorf("finding %d = %s, want %s", i, findings[i].Check, check)
+		}
+	}
+}
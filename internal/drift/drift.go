@@ -0,0 +1,317 @@
+// Package drift compares a host's passwd, group and shadow files with the
+// registry without changing anything, to show how far a host is from the
+// registry before the agent manages it. The API and cmd/driftreport use it.
+package drift
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/home/unixify/internal/models"
+	"github.com/home/unixify/internal/nss"
+)
+
+// Severity of a finding
+type Severity string
+
+const (
+	SeverityError   Severity = "error"   // The host and the registry disagree about who someone is
+	SeverityWarning Severity = "warning" // The host differs in a way the agent would change or report
+	SeverityInfo    Severity = "info"    // Local entries outside the managed ranges
+)
+
+// Check identifies the rule that produced a finding
+type Check string
+
+const (
+	CheckUnknownAccount    Check = "unknown-account"
+	CheckUnknownGroup      Check = "unknown-group"
+	CheckUIDMismatch       Check = "uid-mismatch"
+	CheckGIDMismatch       Check = "gid-mismatch"
+	CheckUsernameMismatch  Check = "username-mismatch"
+	CheckGroupnameMismatch Check = "groupname-mismatch"
+	CheckPrimaryGroup      Check = "primary-group-mismatch"
+	CheckMissingMember     Check = "missing-member"
+	CheckExtraMember       Check = "extra-member"
+	CheckInactivePassword  Check = "inactive-password"
+	CheckShadowOrphan      Check = "shadow-orphan"
+	CheckMalformedLine     Check = "malformed-line"
+)
+
+// Finding is one difference between a host's files and the registry
+type Finding struct {
+	Check    Check    `json:"check"`
+	Severity Severity `json:"severity"`
+	File     string   `json:"file"` // passwd, group or shadow
+	Name     string   `json:"name"`
+	ID       int      `json:"id"` // UID or GID; 0 for shadow findings
+	Message  string   `json:"message"`
+}
+
+// Report is the result of a comparison
+type Report struct {
+	Accounts int       `json:"accounts"` // Entries read from passwd
+	Groups   int       `json:"groups"`   // Entries read from group
+	Errors   int       `json:"errors"`
+	Warnings int       `json:"warnings"`
+	Infos    int       `json:"infos"`
+	Findings []Finding `json:"findings"`
+}
+
+// Files are the contents of a host's files; a nil file is not compared
+type Files struct {
+	Passwd []byte
+	Group  []byte
+	Shadow []byte
+}
+
+// Registry is the data the files are compared with
+type Registry struct {
+	Accounts    []models.Account
+	Groups      []models.Group
+	Memberships []models.AccountGroup
+}
+
+// Managed reports whether a UID or GID is one the registry manages; unknown
+// entries with such IDs are warnings, others are only informational
+type Managed func(id int) bool
+
+// line is a parsed line of a host file
+type line struct {
+	number int
+	fields []string
+	id     int
+}
+
+// parse returns the entries of a file with the given number of fields, keyed
+// by name, and findings for lines that cannot be read. Comments, blank lines
+// and NIS compat entries are skipped. Shadow lines have no ID and their
+// content is never repeated in findings.
+func parse(file string, data []byte, fields int) (map[string]line, []string, []Finding) {
+	entries := make(map[string]line)
+	var order []string
+	var findings []Finding
+	for i, text := range strings.Split(string(data), "\n") {
+		text = strings.TrimSuffix(text, "\r")
+		if strings.TrimSpace(text) == "" || strings.HasPrefix(text, "#") || strings.HasPrefix(text, "+") || strings.HasPrefix(text, "-") {
+			continue
+		}
+		parts := strings.Split(text, ":")
+		id := 0
+		var err error
+		if len(parts) == fields && file != "shadow" {
+			id, err = strconv.Atoi(parts[2])
+		}
+		if len(parts) != fields || err != nil || parts[0] == "" {
+			findings = append(findings, Finding{
+				Check:    CheckMalformedLine,
+				Severity: SeverityWarning,
+				File:     file,
+				Message:  fmt.Sprintf("%s line %d cannot be read: expected %d fields", file, i+1, fields),
+			})
+			continue
+		}
+		if _, dup := entries[parts[0]]; !dup {
+			order = append(order, parts[0])
+		}
+		entries[parts[0]] = line{number: i + 1, fields: parts, id: id}
+	}
+	return entries, order, findings
+}
+
+// Compare compares a host's files with the registry. Local entries unknown to
+// the registry, IDs that differ by name, names that differ by ID, primary
+// groups, group members and passwords of inactive accounts are checked.
+func Compare(files Files, registry *Registry, managed Managed) *Report {
+	accountsByName := make(map[string]models.Account)
+	accountsByUID := make(map[int]models.Account)
+	accountsByID := make(map[uint]models.Account)
+	for _, account := range registry.Accounts {
+		accountsByName[account.Username] = account
+		accountsByUID[account.UnixUID] = account
+		accountsByID[account.ID] = account
+	}
+	groupsByName := make(map[string]models.Group)
+	groupsByGID := make(map[int]models.Group)
+	groupsByID := make(map[uint]models.Group)
+	for _, group := range registry.Groups {
+		groupsByName[group.Groupname] = group
+		groupsByGID[group.UnixGID] = group
+		groupsByID[group.ID] = group
+	}
+	members := make(map[uint]map[string]bool)
+	for _, membership := range registry.Memberships {
+		account, ok := accountsByID[membership.AccountID]
+		if !ok {
+			continue
+		}
+		if members[membership.GroupID] == nil {
+			members[membership.GroupID] = make(map[string]bool)
+		}
+		members[membership.GroupID][account.Username] = true
+	}
+
+	report := &Report{}
+	add := func(finding Finding) {
+		report.Findings = append(report.Findings, finding)
+	}
+	unknown := func(id int) Severity {
+		if managed != nil && managed(id) {
+			return SeverityWarning
+		}
+		return SeverityInfo
+	}
+
+	// passwd: accounts by name and by UID
+	passwd, passwdOrder, malformed := parse("passwd", files.Passwd, 7)
+	report.Findings = append(report.Findings, malformed...)
+	report.Accounts = len(passwd)
+	options := nss.DefaultOptions()
+	for _, name := range passwdOrder {
+		entry := passwd[name]
+		gid, _ := strconv.Atoi(entry.fields[3])
+		account, known := accountsByName[name]
+		switch {
+		case known && account.UnixUID != entry.id:
+			add(Finding{Check: CheckUIDMismatch, Severity: SeverityError, File: "passwd", Name: name, ID: entry.id,
+				Message: fmt.Sprintf("account %s has UID %d on the host but %d in the registry", name, entry.id, account.UnixUID)})
+		case known:
+			if want := options.Passwd(account, groupsByID).GID; gid != want {
+				add(Finding{Check: CheckPrimaryGroup, Severity: SeverityWarning, File: "passwd", Name: name, ID: entry.id,
+					Message: fmt.Sprintf("account %s has primary GID %d on the host but %d in the registry", name, gid, want)})
+			}
+		default:
+			if owner, taken := accountsByUID[entry.id]; taken {
+				add(Finding{Check: CheckUsernameMismatch, Severity: SeverityError, File: "passwd", Name: name, ID: entry.id,
+					Message: fmt.Sprintf("UID %d is %s on the host but %s in the registry", entry.id, name, owner.Username)})
+			} else {
+				add(Finding{Check: CheckUnknownAccount, Severity: unknown(entry.id), File: "passwd", Name: name, ID: entry.id,
+					Message: fmt.Sprintf("account %s (UID %d) is not in the registry", name, entry.id)})
+			}
+		}
+	}
+
+	// group: groups by name and by GID, then members of known groups
+	group, groupOrder, malformed := parse("group", files.Group, 4)
+	report.Findings = append(report.Findings, malformed...)
+	report.Groups = len(group)
+	for _, name := range groupOrder {
+		entry := group[name]
+		registryGroup, known := groupsByName[name]
+		switch {
+		case known && registryGroup.UnixGID != entry.id:
+			add(Finding{Check: CheckGIDMismatch, Severity: SeverityError, File: "group", Name: name, ID: entry.id,
+				Message: fmt.Sprintf("group %s has GID %d on the host but %d in the registry", name, entry.id, registryGroup.UnixGID)})
+		case !known:
+			if owner, taken := groupsByGID[entry.id]; taken {
+				add(Finding{Check: CheckGroupnameMismatch, Severity: SeverityError, File: "group", Name: name, ID: entry.id,
+					Message: fmt.Sprintf("GID %d is %s on the host but %s in the registry", entry.id, name, owner.Groupname)})
+			} else {
+				add(Finding{Check: CheckUnknownGroup, Severity: unknown(entry.id), File: "group", Name: name, ID: entry.id,
+					Message: fmt.Sprintf("group %s (GID %d) is not in the registry", name, entry.id)})
+			}
+			continue
+		}
+
+		local := make(map[string]bool)
+		for _, member := range strings.Split(entry.fields[3], ",") {
+			if member = strings.TrimSpace(member); member != "" {
+				local[member] = true
+			}
+		}
+		for _, member := range sortedNames(local) {
+			if !members[registryGroup.ID][member] {
+				add(Finding{Check: CheckExtraMember, Severity: SeverityWarning, File: "group", Name: name, ID: entry.id,
+					Message: fmt.Sprintf("%s is a member of group %s on the host but not in the registry", member, name)})
+			}
+		}
+		// Members only count as missing if the host has their account
+		for _, member := range sortedNames(members[registryGroup.ID]) {
+			_, onHost := passwd[member]
+			if !local[member] && (onHost || files.Passwd == nil) {
+				add(Finding{Check: CheckMissingMember, Severity: SeverityWarning, File: "group", Name: name, ID: entry.id,
+					Message: fmt.Sprintf("%s is a member of group %s in the registry but not on the host", member, name)})
+			}
+		}
+	}
+
+	// shadow: entries without an account, and passwords of inactive accounts
+	shadow, shadowOrder, malformed := parse("shadow", files.Shadow, 9)
+	report.Findings = append(report.Findings, malformed...)
+	for _, name := range shadowOrder {
+		if _, onHost := passwd[name]; files.Passwd != nil && !onHost {
+			add(Finding{Check: CheckShadowOrphan, Severity: SeverityWarning, File: "shadow", Name: name,
+				Message: fmt.Sprintf("shadow has an entry for %s, which is not in passwd", name)})
+		}
+		account, known := accountsByName[name]
+		hash := shadow[name].fields[1]
+		if known && !account.Active && (hash == "" || !strings.HasPrefix(hash, "!") && !strings.HasPrefix(hash, "*")) {
+			add(Finding{Check: CheckInactivePassword, Severity: SeverityError, File: "shadow", Name: name,
+				Message: fmt.Sprintf("account %s is inactive in the registry but can log in with a password on the host", name)})
+		}
+	}
+
+	sortFindings(report.Findings)
+	for _, finding := range report.Findings {
+		switch finding.Severity {
+		case SeverityError:
+			report.Errors++
+		case SeverityWarning:
+			report.Warnings++
+		default:
+			report.Infos++
+		}
+	}
+	if report.Findings == nil {
+		report.Findings = []Finding{}
+	}
+	return report
+}
+
+// sortedNames returns the keys of a set in order
+func sortedNames(set map[string]bool) []string {
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// severityOrder ranks severities from most to least serious
+var severityOrder = map[Severity]int{SeverityError: 0, SeverityWarning: 1, SeverityInfo: 2}
+
+// sortFindings orders findings by severity, file, ID and message
+func sortFindings(findings []Finding) {
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i], findings[j]
+		if a.Severity != b.Severity {
+			return severityOrder[a.Severity] < severityOrder[b.Severity]
+		}
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.ID != b.ID {
+			return a.ID < b.ID
+		}
+		return a.Message < b.Message
+	})
+}
+
+// WriteText writes the report in a human-readable form
+func (r *Report) WriteText(w io.Writer) error {
+	var b strings.Builder
+	if len(r.Findings) == 0 {
+		fmt.Fprintf(&b, "No drift found in %d accounts and %d groups.\n", r.Accounts, r.Groups)
+	} else {
+		for _, finding := range r.Findings {
+			fmt.Fprintf(&b, "%-7s %-22s %s\n", finding.Severity, finding.Check, finding.Message)
+		}
+		fmt.Fprintf(&b, "\n%d errors, %d warnings, %d info in %d accounts and %d groups\n", r.Errors, r.Warnings, r.Infos, r.Accounts, r.Groups)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,101 @@
+package drift
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/home/unixify/internal/models"
+)
+
+func TestCompare(t *testing.T) {
+	registry := &Registry{
+		Accounts: []models.Account{
+			{ID: 1, Username: "alice", UnixUID: 1001, PrimaryGroupID: 1, Active: true},
+			{ID: 2, Username: "bob", UnixUID: 1002, PrimaryGroupID: 1, Active: true},
+			{ID: 3, Username: "carol", UnixUID: 1003, PrimaryGroupID: 1, Active: false},
+			{ID: 4, Username: "dave", UnixUID: 1004, PrimaryGroupID: 1, Active: true},
+		},
+		Groups: []models.Group{
+			{ID: 1, Groupname: "staff", UnixGID: 1000},
+			{ID: 2, Groupname: "dev", UnixGID: 1100},
+			{ID: 3, Groupname: "ops", UnixGID: 1200},
+		},
+		Memberships: []models.AccountGroup{
+			{AccountID: 1, GroupID: 2},
+			{AccountID: 2, GroupID: 2},
+			{AccountID: 4, GroupID: 2},
+		},
+	}
+	files := Files{
+		Passwd: []byte(strings.Join([]string{
+			"root:x:0:0:root:/root:/bin/bash",
+			"alice:x:1001:1000:Alice:/home/alice:/bin/bash",
+			"bob:x:1502:1000::/home/bob:/bin/bash",
+			"carol:x:1003:100::/home/carol:/bin/bash",
+			"eve:x:1004:1000::/home/eve:/bin/bash",
+			"mallory:x:1666:1000::/home/mallory:/bin/bash",
+			"+@netadmins",
+			"broken:x:1007",
+		}, "\n") + "\n"),
+		Group: []byte(strings.Join([]string{
+			"root:x:0:",
+			"staff:x:1000:",
+			"dev:x:1100:alice,eve",
+			"operators:x:1200:",
+			"docker:x:1300:alice",
+		}, "\n") + "\n"),
+		Shadow: []byte(strings.Join([]string{
+			"root:$6$root:19000:0:99999:7:::",
+			"carol:$6$carol:19000:0:99999:7:::",
+			"alice:!:19000:0:99999:7:::",
+			"ghost:*:19000:0:99999:7:::",
+		}, "\n") + "\n"),
+	}
+	report := Compare(files, registry, func(id int) bool { return id >= 1000 && id <= 60000 })
+
+	var got []string
+	for _, finding := range report.Findings {
+		got = append(got, string(finding.Severity)+" "+string(finding.Check)+" "+finding.Name)
+	}
+	want := []string{
+		"error groupname-mismatch operators",
+		"error username-mismatch eve",
+		"error uid-mismatch bob",
+		"error inactive-password carol",
+		"warning missing-member dev",
+		"warning extra-member dev",
+		"warning unknown-group docker",
+		"warning malformed-line ",
+		"warning primary-group-mismatch carol",
+		"warning unknown-account mallory",
+		"warning shadow-orphan ghost",
+		"info unknown-group root",
+		"info unknown-account root",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("findings:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if report.Accounts != 6 || report.Groups != 5 || report.Errors != 4 || report.Warnings != 7 || report.Infos != 2 {
+		t.Errorf("unexpected counts %+v", report)
+	}
+
+	// Shadow content is never repeated
+	for _, finding := range report.Findings {
+		if strings.Contains(finding.Message, "$6$") {
+			t.Errorf("finding leaks a password hash: %s", finding.Message)
+		}
+	}
+
+	// Missing members are only reported for accounts the host has: dave is not
+	files.Group = []byte("dev:x:1100:\n")
+	report = Compare(files, registry, nil)
+	var missing []string
+	for _, finding := range report.Findings {
+		if finding.Check == CheckMissingMember {
+			missing = append(missing, finding.Message)
+		}
+	}
+	if strings.Join(missing, "; ") != "alice is a member of group dev in the registry but not on the host; bob is a member of group dev in the registry but not on the host" {
+		t.Errorf("missing members: %q", missing)
+	}
+}
@@ -0,0 +1,292 @@
+// Package events fans the registry event log out to live subscribers, such as
+// the clients of the event stream.
+package events
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/home/unixify/internal/models"
+	"github.com/home/unixify/internal/repository"
+	"github.com/jackc/pgx/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// reconnectDelay is the wait before the PostgreSQL listener reconnects
+const reconnectDelay = 5 * time.Second
+
+// Gap tracking: how long the broker waits for a missing event ID by default,
+// and how far below a new ID missing ones are tracked. Changes in flight at
+// the same time never span more IDs than that.
+const (
+	defaultGapTimeout = time.Minute
+	maxGapSpan        = 10000
+)
+
+// Broker hands newly committed events from the event log to its subscribers.
+// On PostgreSQL it is woken by LISTEN/NOTIFY, so changes made through any
+// server sharing the database reach the subscribers of every server; on other
+// backends it polls the event log.
+//
+// Event IDs are taken when a change is made but become visible when it
+// commits, so a lower ID can show up after a higher one. IDs below the
+// highest delivered one that have not been seen yet are kept as gaps, and
+// the log is read again from the lowest of them until they are filled or
+// GapTimeout passes. IDs of rolled-back changes, and of audit entries that
+// are not events, never fill.
+type Broker struct {
+	store  repository.EventStore
+	logger *logrus.Logger
+
+	// PollInterval is how often the event log is checked when polling
+	PollInterval time.Duration
+	// BufferSize is how many events a subscriber may fall behind before it is dropped
+	BufferSize int
+	// BatchSize is the number of events read from the log at a time
+	BatchSize int
+	// GapTimeout is how long a missing event ID is waited for
+	GapTimeout time.Duration
+
+	mu          sync.Mutex
+	subscribers map[*Subscription]struct{}
+	lastID      uint               // Highest ID delivered
+	floor       uint               // Every ID up to here was delivered or given up
+	gaps        map[uint]time.Time // IDs between floor and lastID not seen yet, by when they were missed
+}
+
+// Subscription receives the events of the sections it asked for
+type Subscription struct {
+	// Events is closed when the subscriber falls too far behind; it should
+	// then reconnect and resume after the last event it received
+	Events <-chan models.EventRecord
+	// After is the ID at or below which Events delivers nothing, as every
+	// such event had been delivered or given up on when subscribing
+	After uint
+
+	events   chan models.EventRecord
+	sections map[string]bool
+}
+
+// NewBroker creates a broker over the event log
+func NewBroker(store repository.EventStore, logger *logrus.Logger) *Broker {
+	return &Broker{
+		store:        store,
+		logger:       logger,
+		PollInterval: time.Second,
+		BufferSize:   256,
+		BatchSize:    500,
+		GapTimeout:   defaultGapTimeout,
+		subscribers:  make(map[*Subscription]struct{}),
+		gaps:         make(map[uint]time.Time),
+	}
+}
+
+// Start skips the events already in the log, so only later ones are delivered
+func (b *Broker) Start() error {
+	latest, err := b.store.LatestID()
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lastID = latest
+	b.floor = latest
+	return nil
+}
+
+// Subscribe registers a subscriber for the given sections; none means all
+func (b *Broker) Subscribe(sections []string) *Subscription {
+	events := make(chan models.EventRecord, b.BufferSize)
+	sub := &Subscription{
+		Events:   events,
+		events:   events,
+		sections: make(map[string]bool),
+	}
+	for _, section := range sections {
+		sub.sections[section] = true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	sub.After = b.floor
+	b.subscribers[sub] = struct{}{}
+	return sub
+}
+
+// Unsubscribe removes a subscriber and closes its channel
+func (b *Broker) Unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.drop(sub)
+}
+
+// drop removes a subscriber; the caller holds the lock
+func (b *Broker) drop(sub *Subscription) {
+	if _, ok := b.subscribers[sub]; ok {
+		delete(b.subscribers, sub)
+		close(sub.events)
+	}
+}
+
+// Wants reports whether the subscription includes an event
+func (s *Subscription) Wants(record *models.EventRecord) bool {
+	return len(s.sections) == 0 || s.sections[record.Section]
+}
+
+// publish hands an event to every subscriber that wants it and reports
+// whether it was new; events are only delivered once. Subscribers whose
+// buffer is full are dropped rather than holding up the others.
+func (b *Broker) publish(record models.EventRecord) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	switch {
+	case record.ID <= b.floor:
+		return false
+	case record.ID > b.lastID:
+		from := b.lastID + 1
+		if record.ID-from > maxGapSpan {
+			from = record.ID - maxGapSpan
+		}
+		for id := from; id < record.ID; id++ {
+			b.gaps[id] = now
+		}
+		b.lastID = record.ID
+	default:
+		if _, missing := b.gaps[record.ID]; !missing {
+			return false // Already delivered
+		}
+		delete(b.gaps, record.ID)
+	}
+	b.settle(now)
+
+	for sub := range b.subscribers {
+		if !sub.Wants(&record) {
+			continue
+		}
+		select {
+		case sub.events <- record:
+		default:
+			b.logger.Warnf("Dropping event stream subscriber that fell %d events behind", cap(sub.events))
+			b.drop(sub)
+		}
+	}
+	return true
+}
+
+// settle gives up on gaps older than GapTimeout and moves the floor up to
+// the lowest gap left; the caller holds the lock
+func (b *Broker) settle(now time.Time) {
+	b.floor = b.lastID
+	for id, missed := range b.gaps {
+		if now.Sub(missed) >= b.GapTimeout {
+			delete(b.gaps, id)
+		} else if id <= b.floor {
+			b.floor = id - 1
+		}
+	}
+}
+
+// CatchUp delivers the events logged after the lowest ID not seen yet that
+// were not delivered before, and returns how many there were
+func (b *Broker) CatchUp() (int, error) {
+	b.mu.Lock()
+	b.settle(time.Now())
+	after := b.floor
+	b.mu.Unlock()
+
+	delivered := 0
+	for {
+		records, err := b.store.FindSince(after, b.BatchSize)
+		if err != nil {
+			return delivered, err
+		}
+		for _, record := range records {
+			if b.publish(record) {
+				delivered++
+			}
+			after = record.ID
+		}
+		if len(records) < b.BatchSize {
+			return delivered, nil
+		}
+	}
+}
+
+// Poll delivers new events from the log every PollInterval until the context
+// is cancelled
+func (b *Broker) Poll(ctx context.Context) {
+	ticker := time.NewTicker(b.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if _, err := b.CatchUp(); err != nil {
+			b.logger.Errorf("Failed to read the event log: %v", err)
+		}
+	}
+}
+
+// Listen delivers the events announced on the PostgreSQL database at
+// databaseURL until the context is cancelled, reconnecting after errors
+func (b *Broker) Listen(ctx context.Context, databaseURL string) {
+	for {
+		err := b.listen(ctx, databaseURL)
+		if ctx.Err() != nil {
+			return
+		}
+		b.logger.Errorf("Event listener stopped, reconnecting in %v: %v", reconnectDelay, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
+
+// listen runs one LISTEN session. Events are loaded by the ID in each
+// notification, so they reach subscribers in commit order, which need not be
+// ID order. Each session first catches up from the lowest ID not seen yet.
+func (b *Broker) listen(ctx context.Context, databaseURL string) error {
+	conn, err := pgx.Connect(ctx, databaseURL)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+repository.EventChannel); err != nil {
+		return err
+	}
+
+	// Deliver whatever was logged while nobody was listening
+	if _, err := b.CatchUp(); err != nil {
+		return err
+	}
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		id, err := strconv.ParseUint(notification.Payload, 10, 64)
+		if err != nil {
+			b.logger.Warnf("Ignoring event notification %q", notification.Payload)
+			continue
+		}
+		record, err := b.store.FindByID(uint(id))
+		if err != nil {
+			b.logger.Errorf("Failed to load announced event: %v", err)
+			continue
+		}
+		b.publish(*record)
+	}
+}
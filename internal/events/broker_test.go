@@ -0,0 +1,143 @@
+package events
+
+import (
+	"io"
+	"testing"
+
+	"github.com/home/unixify/internal/models"
+	"github.com/home/unixify/internal/repository/memory"
+	"github.com/sirupsen/logrus"
+)
+
+// newTestBroker returns a broker over an empty in-memory event log
+func newTestBroker(t *testing.T) (*Broker, *memory.EventRepository) {
+	t.Helper()
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	store := memory.NewStore().Events()
+	return NewBroker(store, logger), store
+}
+
+// logEvent adds an event to the log
+func logEvent(t *testing.T, store *memory.EventRepository, id uint, section string) {
+	t.Helper()
+	record := &models.EventRecord{ID: id, Type: models.EventAccountCreated, Section: section, Payload: "{}"}
+	if err := store.Create(record); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+}
+
+// received drains the events buffered for a subscription
+func received(sub *Subscription) []uint {
+	ids := []uint{}
+	for {
+		select {
+		case record, ok := <-sub.Events:
+			if !ok {
+				return append(ids, 0)
+			}
+			ids = append(ids, record.ID)
+		default:
+			return ids
+		}
+	}
+}
+
+func TestBrokerDeliversNewEventsBySection(t *testing.T) {
+	broker, store := newTestBroker(t)
+	logEvent(t, store, 1, "people")
+	if err := broker.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	all := broker.Subscribe(nil)
+	people := broker.Subscribe([]string{"people"})
+	logEvent(t, store, 2, "people")
+	logEvent(t, store, 3, "system")
+
+	if n, err := broker.CatchUp(); err != nil || n != 2 {
+		t.Fatalf("CatchUp = %d, %v; want the 2 events logged after Start", n, err)
+	}
+	if got := received(all); len(got) != 2 || got[0] != 2 || got[1] != 3 {
+		t.Errorf("unfiltered subscriber got %v", got)
+	}
+	if got := received(people); len(got) != 1 || got[0] != 2 {
+		t.Errorf("people subscriber got %v", got)
+	}
+
+	broker.Unsubscribe(people)
+	logEvent(t, store, 4, "people")
+	broker.CatchUp()
+	if got := received(all); len(got) != 1 || got[0] != 4 {
+		t.Errorf("unfiltered subscriber got %v after unsubscribe", got)
+	}
+}
+
+func TestSlowSubscriberIsDropped(t *testing.T) {
+	broker, store := newTestBroker(t)
+	broker.BufferSize = 1
+	slow := broker.Subscribe(nil)
+
+	logEvent(t, store, 1, "people")
+	logEvent(t, store, 2, "people")
+	broker.CatchUp()
+
+	// The buffered event is still readable, then the channel is closed
+	if got := received(slow); len(got) != 2 || got[0] != 1 || got[1] != 0 {
+		t.Errorf("slow subscriber got %v, want event 1 and a closed channel", got)
+	}
+}
+
+func TestBrokerDeliversEventsCommittedOutOfOrder(t *testing.T) {
+	broker, store := newTestBroker(t)
+	if err := broker.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	sub := broker.Subscribe(nil)
+
+	// Event 2 commits after event 3
+	logEvent(t, store, 1, "people")
+	logEvent(t, store, 3, "people")
+	if n, err := broker.CatchUp(); err != nil || n != 2 {
+		t.Fatalf("CatchUp = %d, %v; want 2", n, err)
+	}
+	logEvent(t, store, 2, "people")
+	if n, err := broker.CatchUp(); err != nil || n != 1 {
+		t.Fatalf("CatchUp = %d, %v; want the late event", n, err)
+	}
+	if got := received(sub); len(got) != 3 || got[0] != 1 || got[1] != 3 || got[2] != 2 {
+		t.Errorf("subscriber got %v", got)
+	}
+
+	// Nothing is delivered twice, whether read again or announced again
+	if n, err := broker.CatchUp(); err != nil || n != 0 {
+		t.Errorf("CatchUp = %d, %v; want nothing new", n, err)
+	}
+	if broker.publish(models.EventRecord{ID: 2, Section: "people"}) {
+		t.Error("event 2 was published twice")
+	}
+	if got := received(sub); len(got) != 0 {
+		t.Errorf("subscriber got %v again", got)
+	}
+	if later := broker.Subscribe(nil); later.After != 3 {
+		t.Errorf("new subscription After = %d, want 3", later.After)
+	}
+}
+
+func TestBrokerGivesUpOnGaps(t *testing.T) {
+	broker, store := newTestBroker(t)
+	broker.GapTimeout = 0
+	sub := broker.Subscribe(nil)
+
+	// ID 2 never shows up in time, e.g. because it was rolled back
+	logEvent(t, store, 1, "people")
+	logEvent(t, store, 3, "people")
+	broker.CatchUp()
+	logEvent(t, store, 2, "people")
+	if n, err := broker.CatchUp(); err != nil || n != 0 {
+		t.Errorf("CatchUp = %d, %v; want the given up event to be skipped", n, err)
+	}
+	if got := received(sub); len(got) != 2 || got[0] != 1 || got[1] != 3 {
+		t.Errorf("subscriber got %v", got)
+	}
+}
@@ -1,21 +1,27 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/home/unixify/internal/models"
+	"github.com/home/unixify/internal/repository"
 )
 
 // accountInput represents the input for account creation/update
 type accountInput struct {
 	UnixUID        int                `json:"uid" binding:"required"` // JSON field remains "uid" for backward compatibility
-	Username       string             `json:"username" binding:"required"`
+	Username       string             `json:"username"`
 	Type           models.AccountType `json:"type" binding:"required"`
 	PrimaryGroupID uint               `json:"primary_group_id"`
 	Firstname      string             `json:"firstname"`
 	Surname        string             `json:"surname"`
+	// On create without a username, the username is generated from the
+	// first name and surname with this template, e.g. {f}{surname}
+	UsernameTemplate string `json:"username_template"`
 }
 
 // GetAllAccounts handles GET /api/accounts
@@ -31,7 +37,16 @@ func (h *Handler) GetAllAccounts(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, accounts)
+	// Hosts only see the accounts they have access to
+	scope, ok := h.requestScope(c)
+	if !ok {
+		return
+	}
+	if scope != nil {
+		accounts = scope.FilterAccounts(accounts)
+	}
+
+	writeCollection(c, accounts)
 }
 
 // GetAccount handles GET /api/accounts/:id
@@ -50,8 +65,11 @@ func (h *Handler) GetAccount(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
+	if !h.visibleAccount(c, account.ID, fmt.Sprintf("account with ID %d not found", id)) {
+		return
+	}
 
-	c.JSON(http.StatusOK, account)
+	writeVersioned(c, accountETag(account), account)
 }
 
 // GetAccountByUID handles GET /api/accounts/uid/:uid
@@ -70,8 +88,11 @@ func (h *Handler) GetAccountByUID(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
+	if !h.visibleAccount(c, account.ID, fmt.Sprintf("account with UID %d not found", unixUID)) {
+		return
+	}
 
-	c.JSON(http.StatusOK, account)
+	writeVersioned(c, accountETag(account), account)
 }
 
 // GetAccountByUsername handles GET /api/accounts/username/:username
@@ -86,8 +107,11 @@ func (h *Handler) GetAccountByUsername(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
+	if !h.visibleAccount(c, account.ID, fmt.Sprintf("account with username %s not found", username)) {
+		return
+	}
 
-	c.JSON(http.StatusOK, account)
+	writeVersioned(c, accountETag(account), account)
 }
 
 // CreateAccount handles POST /api/accounts
@@ -109,6 +133,16 @@ func (h *Handler) CreateAccount(c *gin.Context) {
 		Surname:        input.Surname,
 	}
 
+	// Generate the username if asked to
+	if account.Username == "" && input.UsernameTemplate != "" {
+		generated, err := h.services.Account.GenerateUsername(input.UsernameTemplate, input.Firstname, input.Surname, input.Type)
+		if err != nil {
+			badRequest(c, err)
+			return
+		}
+		account.Username = generated
+	}
+
 	// Get user info for audit
 	userID := uint(0) // In a real app, this would be from the auth middleware
 	username := "admin" // In a real app, this would be from the auth middleware
@@ -118,10 +152,11 @@ func (h *Handler) CreateAccount(c *gin.Context) {
 	err := h.services.Account.CreateAccount(account, userID, username, ipAddress)
 	if err != nil {
 		h.logger.Errorf("Failed to create account: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		badRequest(c, err)
 		return
 	}
 
+	c.Header("ETag", accountETag(account))
 	c.JSON(http.StatusCreated, account)
 }
 
@@ -138,6 +173,12 @@ func (h *Handler) UpdateAccount(c *gin.Context) {
 	}
 	h.logger.Infof("UpdateAccount: Updating account with ID: %d", id)
 
+	// Get the version the client last saw
+	version, ok := ifMatchVersion(c)
+	if !ok {
+		return
+	}
+
 	// Get existing account
 	account, err := h.services.Account.GetAccount(uint(id))
 	if err != nil {
@@ -147,6 +188,13 @@ func (h *Handler) UpdateAccount(c *gin.Context) {
 	}
 	h.logger.Infof("UpdateAccount: Found existing account: %+v", account)
 
+	// Refuse to overwrite changes the client has not seen
+	if version != 0 && version != account.Version {
+		h.logger.Warnf("UpdateAccount: Version mismatch: If-Match %d, stored %d", version, account.Version)
+		versionConflict(c)
+		return
+	}
+
 	// Parse input
 	var input accountInput
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -181,7 +229,11 @@ func (h *Handler) UpdateAccount(c *gin.Context) {
 	err = h.services.Account.UpdateAccount(account, userID, username, ipAddress)
 	if err != nil {
 		h.logger.Errorf("UpdateAccount: Failed to update account: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		if errors.Is(err, repository.ErrVersionMismatch) {
+			versionConflict(c)
+			return
+		}
+		badRequest(c, err)
 		return
 	}
 	h.logger.Infof("UpdateAccount: Account updated successfully with ID: %d", account.ID)
@@ -191,11 +243,13 @@ func (h *Handler) UpdateAccount(c *gin.Context) {
 	if err != nil {
 		h.logger.Warnf("UpdateAccount: Failed to get updated account: %v", err)
 		// Still return the local account object if we can't fetch the updated one
+		c.Header("ETag", accountETag(account))
 		c.JSON(http.StatusOK, account)
 		return
 	}
 	
 	h.logger.Infof("UpdateAccount: Returning updated account: %+v", updatedAccount)
+	c.Header("ETag", accountETag(updatedAccount))
 	c.JSON(http.StatusOK, updatedAccount)
 }
 
@@ -208,15 +262,25 @@ func (h *Handler) DeleteAccount(c *gin.Context) {
 		return
 	}
 
+	// Get the version the client last saw
+	version, ok := ifMatchVersion(c)
+	if !ok {
+		return
+	}
+
 	// Get user info for audit
 	userID := uint(0) // In a real app, this would be from the auth middleware
 	username := "admin" // In a real app, this would be from the auth middleware
 	ipAddress := c.ClientIP()
 
 	// Delete account
-	err = h.services.Account.DeleteAccount(uint(id), userID, username, ipAddress)
+	err = h.services.Account.DeleteAccount(uint(id), version, userID, username, ipAddress)
 	if err != nil {
 		h.logger.Errorf("Failed to delete account: %v", err)
+		if errors.Is(err, repository.ErrVersionMismatch) {
+			versionConflict(c)
+			return
+		}
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
@@ -241,9 +305,36 @@ func (h *Handler) GetAccountGroups(c *gin.Context) {
 		return
 	}
 
+	// Hosts only see the groups they have access to, and none of the
+	// accounts they have no access to
+	scope, ok := h.requestScope(c)
+	if !ok {
+		return
+	}
+	if scope != nil {
+		if !scope.Accounts[uint(id)] {
+			groups = nil
+		}
+		groups = scope.FilterGroups(groups)
+	}
+
 	c.JSON(http.StatusOK, groups)
 }
 
+// visibleAccount answers 404 with the not found message when a host asks for
+// an account it has no access to, so hosts cannot tell it from a missing one
+func (h *Handler) visibleAccount(c *gin.Context, accountID uint, notFound string) bool {
+	scope, ok := h.requestScope(c)
+	if !ok {
+		return false
+	}
+	if scope != nil && !scope.Accounts[accountID] {
+		c.JSON(http.StatusNotFound, gin.H{"error": notFound})
+		return false
+	}
+	return true
+}
+
 // SearchAccounts handles GET /api/search/accounts
 func (h *Handler) SearchAccounts(c *gin.Context) {
 	// Get search query
@@ -255,6 +346,10 @@ func (h *Handler) SearchAccounts(c *gin.Context) {
 
 	// Search accounts
 	accounts, err := h.services.Account.SearchAccounts(query)
+	if isQueryError(err) {
+		badRequest(c, err)
+		return
+	}
 	if err != nil {
 		h.logger.Errorf("Failed to search accounts: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search accounts"})
@@ -264,6 +359,21 @@ func (h *Handler) SearchAccounts(c *gin.Context) {
 	c.JSON(http.StatusOK, accounts)
 }
 
+// SuggestUsernames handles GET /api/accounts/suggest-username. It generates
+// a free username for firstname and surname with each template given, or
+// with the default templates.
+func (h *Handler) SuggestUsernames(c *gin.Context) {
+	firstname, surname := c.Query("firstname"), c.Query("surname")
+	if firstname == "" && surname == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "firstname or surname is required"})
+		return
+	}
+	accountType := models.AccountType(c.DefaultQuery("type", string(models.AccountTypePeople)))
+
+	suggestions := h.services.Account.SuggestUsernames(c.QueryArray("template"), firstname, surname, accountType)
+	c.JSON(http.StatusOK, gin.H{"suggestions": suggestions})
+}
+
 // CheckUIDDuplicate handles GET /api/accounts/check-duplicate
 func (h *Handler) CheckUIDDuplicate(c *gin.Context) {
 	// Parse UnixUID
@@ -1,27 +1,27 @@
 package handlers
 
 import (
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/home/unixify/internal/auth"
 	"github.com/home/unixify/internal/models"
 	"github.com/home/unixify/internal/repository"
-	"gorm.io/gorm"
 )
 
 // AuthHandler handles authentication-related requests
 type AuthHandler struct {
-	db         *gorm.DB
 	authService *auth.Service
 	repo       *repository.Repository
 }
 
 // NewAuthHandler creates a new auth handler
-func NewAuthHandler(db *gorm.DB, authService *auth.Service, repo *repository.Repository) *AuthHandler {
+func NewAuthHandler(authService *auth.Service, repo *repository.Repository) *AuthHandler {
 	return &AuthHandler{
-		db:         db,
 		authService: authService,
 		repo:       repo,
 	}
@@ -29,49 +29,22 @@ func NewAuthHandler(db *gorm.DB, authService *auth.Service, repo *repository.Rep
 
 // Register handles user registration
 func (h *AuthHandler) Register(c *gin.Context) {
-	var input struct {
-		Username string `json:"username" binding:"required"`
-		Password string `json:"password" binding:"required"`
-		Email    string `json:"email" binding:"required,email"`
-	}
-
+	var input models.RegisterUserRequest
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Check if username already exists
-	var existingUser models.User
-	if result := h.db.Where("username = ?", input.Username).First(&existingUser); result.Error == nil {
+	user, err := h.authService.Register(&input)
+	if errors.Is(err, auth.ErrUsernameTaken) {
 		c.JSON(http.StatusConflict, gin.H{"error": "Username already exists"})
 		return
 	}
-
-	// Check if email already exists
-	if result := h.db.Where("email = ?", input.Email).First(&existingUser); result.Error == nil {
+	if errors.Is(err, auth.ErrEmailTaken) {
 		c.JSON(http.StatusConflict, gin.H{"error": "Email already exists"})
 		return
 	}
-
-	// Hash the password
-	hashedPassword, err := h.authService.HashPassword(input.Password)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
-		return
-	}
-
-	// Create user
-	user := models.User{
-		Username:    input.Username,
-		Password:    hashedPassword,
-		Email:       input.Email,
-		Role:        "user", // Default role for new users
-		TOTPEnabled: false,
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
-	}
-
-	if result := h.db.Create(&user); result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
 		return
 	}
@@ -96,24 +69,38 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	// Find user by username
-	var user models.User
-	if result := h.db.Where("username = ?", input.Username).First(&user); result.Error != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+	if !h.loginAllowed(c, input.Username) {
 		return
 	}
 
-	// Check password
-	if !h.authService.CheckPassword(input.Password, user.Password) {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+	// Check the username and password
+	user, err := h.authService.Authenticate(input.Username, input.Password)
+	if errors.Is(err, auth.ErrInvalidCredentials) {
+		h.loginFailed(c, 0, input.Username, "invalid username or password")
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Authentication failed"})
+		return
+	}
+	if !user.Active {
+		// Answered like a wrong password, so it does not confirm the password
+		h.loginFailed(c, user.ID, user.Username, "user is disabled")
 		return
 	}
 
-	// If TOTP is enabled, don't generate a token yet
+	// If TOTP is enabled, don't generate a token yet, only one that lets
+	// the user give a TOTP code
 	if user.TOTPEnabled {
+		totpToken, err := h.authService.StartTOTPChallenge(user)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Authentication failed"})
+			return
+		}
 		c.JSON(http.StatusOK, gin.H{
 			"message": "TOTP verification required",
 			"requires_totp": true,
+			"totp_token": totpToken,
 			"user": models.UserResponse{
 				ID:          user.ID,
 				Username:    user.Username,
@@ -125,75 +112,79 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	// Generate JWT token
-	token, err := h.authService.GenerateToken(&user)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
-		return
-	}
-
-	// Update last login time
-	user.LastLogin = time.Now()
-	h.db.Save(&user)
-
-	c.JSON(http.StatusOK, models.AuthResponse{
-		Token: token,
-		User: models.UserResponse{
-			ID:          user.ID,
-			Username:    user.Username,
-			Email:       user.Email,
-			Role:        user.Role,
-			TOTPEnabled: user.TOTPEnabled,
-		},
-	})
+	h.startSession(c, user)
 }
 
-// VerifyTOTP verifies a TOTP code after initial login
+// VerifyTOTP verifies a TOTP code, or a recovery code, after initial login,
+// given the TOTP token the login returned
 func (h *AuthHandler) VerifyTOTP(c *gin.Context) {
 	var input struct {
-		Username string `json:"username" binding:"required"`
-		Token    string `json:"token" binding:"required"`
+		TOTPToken    string `json:"totp_token" binding:"required"`
+		Token        string `json:"token"`
+		RecoveryCode string `json:"recovery_code"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-
-	// Find user by username
-	var user models.User
-	if result := h.db.Where("username = ?", input.Username).First(&user); result.Error != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+	if input.Token == "" && input.RecoveryCode == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A TOTP code or a recovery code is required"})
 		return
 	}
 
-	// Verify TOTP code
-	if !h.authService.VerifyTOTP(user.TOTPSecret, input.Token) {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid TOTP code"})
+	// The TOTP token proves the password was checked, for a few tries
+	challenge, err := h.authService.CheckTOTPChallenge(input.TOTPToken)
+	if errors.Is(err, auth.ErrInvalidTOTPToken) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "TOTP login has expired, log in again"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Authentication failed"})
 		return
 	}
 
-	// Generate JWT token
-	token, err := h.authService.GenerateToken(&user)
+	user, err := h.authService.User(challenge.UserID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Authentication failed"})
+		return
+	}
+	if user == nil || !user.TOTPEnabled {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "TOTP login has expired, log in again"})
 		return
 	}
 
-	// Update last login time
-	user.LastLogin = time.Now()
-	h.db.Save(&user)
+	if !h.loginAllowed(c, user.Username) {
+		return
+	}
 
-	c.JSON(http.StatusOK, models.AuthResponse{
-		Token: token,
-		User: models.UserResponse{
-			ID:          user.ID,
-			Username:    user.Username,
-			Email:       user.Email,
-			Role:        user.Role,
-			TOTPEnabled: user.TOTPEnabled,
-		},
-	})
+	// Verify the TOTP code, or the recovery code in its place
+	var valid bool
+	reason := "invalid or reused TOTP code"
+	if input.RecoveryCode != "" {
+		valid, err = h.authService.UseRecoveryCode(user, input.RecoveryCode, c.ClientIP())
+		reason = "invalid or used recovery code"
+	} else {
+		valid, err = h.authService.VerifyTOTP(user, input.Token)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Authentication failed"})
+		return
+	}
+	if !valid {
+		h.loginFailed(c, user.ID, user.Username, reason)
+		return
+	}
+	if !user.Active {
+		h.loginFailed(c, user.ID, user.Username, "user is disabled")
+		return
+	}
+	if err := h.authService.FinishTOTPChallenge(challenge); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Authentication failed"})
+		return
+	}
+
+	h.startSession(c, user)
 }
 
 // SetupTOTP generates a new TOTP secret for a user
@@ -212,8 +203,8 @@ func (h *AuthHandler) SetupTOTP(c *gin.Context) {
 	}
 
 	// Find the full user record
-	var user models.User
-	if result := h.db.Where("id = ?", userResponse.ID).First(&user); result.Error != nil {
+	user, err := h.authService.User(userResponse.ID)
+	if err != nil || user == nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
@@ -228,7 +219,8 @@ func (h *AuthHandler) SetupTOTP(c *gin.Context) {
 	// Store secret in user record but don't enable TOTP yet
 	// It will be enabled after the user verifies a valid code
 	user.TOTPSecret = totpResponse.Secret
-	if err := h.db.Save(&user).Error; err != nil {
+	user.TOTPLastStep = 0
+	if err := h.authService.SaveUser(user); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save TOTP secret"})
 		return
 	}
@@ -262,27 +254,94 @@ func (h *AuthHandler) ActivateTOTP(c *gin.Context) {
 	}
 
 	// Find the full user record
-	var user models.User
-	if result := h.db.Where("id = ?", userResponse.ID).First(&user); result.Error != nil {
+	user, err := h.authService.User(userResponse.ID)
+	if err != nil || user == nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
 
 	// Verify the token against the stored secret
-	if !h.authService.VerifyTOTP(user.TOTPSecret, input.Token) {
+	valid, err := h.authService.VerifyTOTP(user, input.Token)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify TOTP code"})
+		return
+	}
+	if !valid {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid TOTP code"})
 		return
 	}
 
 	// Enable TOTP for the user
 	user.TOTPEnabled = true
-	if err := h.db.Save(&user).Error; err != nil {
+	if err := h.authService.SaveUser(user); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable TOTP"})
 		return
 	}
 
+	// Recovery codes let the user log in without the authenticator app
+	codes, err := h.authService.GenerateRecoveryCodes(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "TOTP enabled successfully",
+		"recovery_codes": codes,
+	})
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of a user with a new
+// set, so the old codes no longer work
+func (h *AuthHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	// Get user from context
+	userObj, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		return
+	}
+
+	userResponse, ok := userObj.(*models.UserResponse)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user information"})
+		return
+	}
+
+	var input struct {
+		Password string `json:"password" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Find the full user record
+	user, err := h.authService.User(userResponse.ID)
+	if err != nil || user == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	// Verify password for security
+	if !h.authService.CheckPassword(input.Password, user.Password) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password"})
+		return
+	}
+	if !user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "TOTP is not enabled"})
+		return
+	}
+
+	codes, err := h.authService.RegenerateRecoveryCodes(user, c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Recovery codes regenerated successfully",
+		"recovery_codes": codes,
 	})
 }
 
@@ -311,8 +370,8 @@ func (h *AuthHandler) DisableTOTP(c *gin.Context) {
 	}
 
 	// Find the full user record
-	var user models.User
-	if result := h.db.Where("id = ?", userResponse.ID).First(&user); result.Error != nil {
+	user, err := h.authService.User(userResponse.ID)
+	if err != nil || user == nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
@@ -326,7 +385,12 @@ func (h *AuthHandler) DisableTOTP(c *gin.Context) {
 	// Disable TOTP
 	user.TOTPEnabled = false
 	user.TOTPSecret = ""
-	if err := h.db.Save(&user).Error; err != nil {
+	user.TOTPLastStep = 0
+	if err := h.authService.SaveUser(user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable TOTP"})
+		return
+	}
+	if err := h.authService.DeleteRecoveryCodes(user.ID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable TOTP"})
 		return
 	}
@@ -382,8 +446,8 @@ func (h *AuthHandler) UpdatePassword(c *gin.Context) {
 	}
 
 	// Find the full user record
-	var user models.User
-	if result := h.db.Where("id = ?", userResponse.ID).First(&user); result.Error != nil {
+	user, err := h.authService.User(userResponse.ID)
+	if err != nil || user == nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
@@ -403,13 +467,292 @@ func (h *AuthHandler) UpdatePassword(c *gin.Context) {
 
 	// Update password
 	user.Password = hashedPassword
-	user.UpdatedAt = time.Now()
-	if err := h.db.Save(&user).Error; err != nil {
+	if err := h.authService.SaveUser(user); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
 		return
 	}
 
+	// Log out everywhere else, in case the old password was compromised
+	if err := h.authService.RevokeUserSessions(user.ID, auth.SessionID(c)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Password updated successfully",
 	})
-}
\ No newline at end of file
+}
+
+// loginAllowed refuses a login attempt made too soon after failed ones
+// for the same username or from the same address
+func (h *AuthHandler) loginAllowed(c *gin.Context, username string) bool {
+	wait, err := h.authService.LoginWait(username, c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Authentication failed"})
+		return false
+	}
+	if wait > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed login attempts, try again later"})
+		return false
+	}
+	return true
+}
+
+// loginFailed counts a failed login and answers it without telling what
+// was wrong
+func (h *AuthHandler) loginFailed(c *gin.Context, userID uint, username, reason string) {
+	if err := h.authService.RecordLoginFailure(userID, username, c.ClientIP(), reason); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Authentication failed"})
+		return
+	}
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+}
+
+// startSession answers a successful login with the tokens of a new session
+func (h *AuthHandler) startSession(c *gin.Context, user *models.User) {
+	response, err := h.authService.StartSession(user, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	// Update last login time
+	user.LastLogin = time.Now()
+	h.authService.SaveUser(user)
+	h.authService.RecordLoginSuccess(user.Username)
+
+	c.JSON(http.StatusOK, response)
+}
+
+// Refresh exchanges a refresh token for a new access token and refresh token
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var input struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	session, refreshToken, err := h.authService.RefreshSession(input.RefreshToken)
+	if errors.Is(err, auth.ErrInvalidRefreshToken) || errors.Is(err, auth.ErrSessionRevoked) || errors.Is(err, auth.ErrRefreshTokenReused) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh session"})
+		return
+	}
+
+	// The user may have been disabled or removed since logging in
+	user, err := h.authService.User(session.UserID)
+	if err != nil || user == nil || !user.Active {
+		h.authService.RevokeSession(session.ID)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": auth.ErrSessionRevoked.Error()})
+		return
+	}
+
+	response, err := h.authService.IssueTokens(user, session, refreshToken)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// Logout revokes the current session, or with {"all": true} every session
+// of the user
+func (h *AuthHandler) Logout(c *gin.Context) {
+	var input struct {
+		All bool `json:"all"`
+	}
+
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	var err error
+	if input.All {
+		err = h.authService.RevokeUserSessions(c.GetUint("userID"), 0)
+	} else {
+		err = h.authService.RevokeSession(auth.SessionID(c))
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Logged out successfully",
+	})
+}
+
+// GetSessions lists the sessions of the current user
+func (h *AuthHandler) GetSessions(c *gin.Context) {
+	sessions, err := h.authService.Sessions(c.GetUint("userID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"sessions":           sessions,
+		"current_session_id": auth.SessionID(c),
+	})
+}
+
+// RevokeSession revokes one of the current user's sessions, such as one on
+// a lost device
+func (h *AuthHandler) RevokeSession(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	sessions, err := h.authService.Sessions(c.GetUint("userID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get sessions"})
+		return
+	}
+	for _, session := range sessions {
+		if session.ID != uint(id) {
+			continue
+		}
+		if err := h.authService.RevokeSession(session.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Session revoked successfully"})
+		return
+	}
+
+	c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+}
+
+// DisableUser disables a user and revokes their sessions (admin only)
+func (h *AuthHandler) DisableUser(c *gin.Context) {
+	h.setUserActive(c, false)
+}
+
+// EnableUser lets a disabled user log in again (admin only)
+func (h *AuthHandler) EnableUser(c *gin.Context) {
+	h.setUserActive(c, true)
+}
+
+// setUserActive enables or disables the user in the path
+func (h *AuthHandler) setUserActive(c *gin.Context, active bool) {
+	user, ok := h.userParam(c)
+	if !ok {
+		return
+	}
+
+	user.Active = active
+	if err := h.authService.SaveUser(user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+		return
+	}
+	if !active {
+		if err := h.authService.RevokeUserSessions(user.ID, 0); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "User updated successfully",
+		"user": gin.H{
+			"id":       user.ID,
+			"username": user.Username,
+			"active":   active,
+		},
+	})
+}
+
+// RevokeUserSessions logs a user out everywhere (admin only)
+func (h *AuthHandler) RevokeUserSessions(c *gin.Context) {
+	user, ok := h.userParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.authService.RevokeUserSessions(user.ID, 0); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Sessions revoked successfully",
+	})
+}
+
+// userParam finds the user in the path, answering 404 if there is none
+func (h *AuthHandler) userParam(c *gin.Context) (*models.User, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return nil, false
+	}
+	user, err := h.authService.User(uint(id))
+	if err != nil || user == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return nil, false
+	}
+	return user, true
+}
+
+// UnlockUser lets a user who was locked out by failed logins try again at
+// once (admin only)
+func (h *AuthHandler) UnlockUser(c *gin.Context) {
+	user, ok := h.userParam(c)
+	if !ok {
+		return
+	}
+
+	h.unlock(c, models.LoginAttemptUsername, user.Username)
+}
+
+// GetLockouts lists the usernames and addresses that may not log in at the
+// moment (admin only)
+func (h *AuthHandler) GetLockouts(c *gin.Context) {
+	lockouts, err := h.authService.Lockouts()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get lockouts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"lockouts": lockouts,
+	})
+}
+
+// DeleteLockout lets a username or address in the lockout list log in
+// again at once (admin only)
+func (h *AuthHandler) DeleteLockout(c *gin.Context) {
+	kind := c.Param("kind")
+	if kind != models.LoginAttemptUsername && kind != models.LoginAttemptIP {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Lockout kind must be username or ip"})
+		return
+	}
+
+	h.unlock(c, kind, c.Param("subject"))
+}
+
+// unlock clears the failed logins of a username or address
+func (h *AuthHandler) unlock(c *gin.Context, kind, subject string) {
+	admin, _ := c.MustGet("user").(*models.UserResponse)
+	if err := h.authService.Unlock(kind, subject, admin, c.ClientIP()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Unlocked successfully",
+	})
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/home/unixify/internal/auth"
+	"github.com/home/unixify/internal/config"
+	"github.com/home/unixify/internal/models"
+	"github.com/home/unixify/internal/repository/memory"
+)
+
+func TestLoginDoesNotTellDisabledUsersApart(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := config.Config{Server: config.ServerConfig{
+		Secret:          "test-secret",
+		AccessTokenTTL:  15 * time.Minute,
+		RefreshTokenTTL: time.Hour,
+	}, Logins: config.LoginConfig{
+		MaxFailures:   10,
+		MaxIPFailures: 10,
+		Lockout:       15 * time.Minute,
+	}}
+	authService := auth.NewService(cfg, memory.NewRepositories())
+	h := NewAuthHandler(authService, nil)
+	router := gin.New()
+	router.POST("/api/auth/login", h.Login)
+
+	user, err := authService.Register(&models.RegisterUserRequest{Username: "alice", Email: "alice@example.com", Password: "correct horse"})
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	login := func(password string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/auth/login", strings.NewReader(`{"username":"alice","password":"`+password+`"}`))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := login("correct horse"); w.Code != http.StatusOK {
+		t.Fatalf("login = %d %s", w.Code, w.Body)
+	}
+	user.Active = false
+	if err := authService.SaveUser(user); err != nil {
+		t.Fatalf("SaveUser: %v", err)
+	}
+
+	// The right password of a disabled user gets the answer of a wrong one
+	wrong := login("wrong horse")
+	right := login("correct horse")
+	if wrong.Code != http.StatusUnauthorized || right.Code != wrong.Code || right.Body.String() != wrong.Body.String() {
+		t.Errorf("disabled user login = %d %s, wrong password = %d %s", right.Code, right.Body, wrong.Code, wrong.Body)
+	}
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Change feed page sizes
+const (
+	defaultChangeLimit = 1000
+	maxChangeLimit     = 10000
+)
+
+// GetChanges handles GET /api/changes?since=N. It returns the accounts,
+// groups and memberships changed after sequence number N, and tombstones for
+// the deleted ones. since=0 (the default) returns the whole registry. Hosts
+// only get the accounts, groups and memberships they have access to.
+func (h *Handler) GetChanges(c *gin.Context) {
+	// Parse the sequence number the client has
+	var since int64
+	if sinceStr := c.Query("since"); sinceStr != "" {
+		var err error
+		since, err = strconv.ParseInt(sinceStr, 10, 64)
+		if err != nil || since < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid since"})
+			return
+		}
+	}
+
+	// Parse page size
+	limit := defaultChangeLimit
+	if limitStr := c.Query("limit"); limitStr != "" {
+		var err error
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > maxChangeLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return
+		}
+	}
+
+	// Get changes
+	changes, err := h.services.Change.GetChanges(since, limit)
+	if err != nil {
+		h.logger.Errorf("Failed to get changes: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get changes"})
+		return
+	}
+
+	// Hosts only get the records they have access to
+	scope, ok := h.requestScope(c)
+	if !ok {
+		return
+	}
+	if scope != nil {
+		scope.FilterChanges(changes)
+	}
+
+	c.JSON(http.StatusOK, changes)
+}
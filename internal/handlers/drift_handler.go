@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/home/unixify/internal/drift"
+	"github.com/home/unixify/internal/idrange"
+	"github.com/home/unixify/internal/validator"
+)
+
+// maxHostFileSize limits each uploaded host file
+const maxHostFileSize = 16 << 20
+
+// hostFile reads an uploaded file or form field; it returns nil when the
+// request has neither
+func hostFile(c *gin.Context, name string) ([]byte, error) {
+	if header, err := c.FormFile(name); err == nil {
+		if header.Size > maxHostFileSize {
+			return nil, fmt.Errorf("%s is larger than %d bytes", name, maxHostFileSize)
+		}
+		file, err := header.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		return io.ReadAll(file)
+	}
+	if value, ok := c.GetPostForm(name); ok {
+		return []byte(value), nil
+	}
+	return nil, nil
+}
+
+// CompareHostFiles handles POST /api/hosts/drift. It takes a host's passwd,
+// group and shadow files as multipart form files and reports how they differ
+// from the registry, as JSON or with format=text as plain text. IDs in
+// ranges (default the people range) are managed: unknown entries with them
+// are warnings instead of info.
+func (h *Handler) CompareHostFiles(c *gin.Context) {
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "text" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid format, use json or text"})
+		return
+	}
+	managed, err := idrange.Parse(c.DefaultQuery("ranges", fmt.Sprintf("%d-%d", validator.MinUserUID, validator.MaxUserUID)))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Read the files
+	var files drift.Files
+	for name, data := range map[string]*[]byte{"passwd": &files.Passwd, "group": &files.Group, "shadow": &files.Shadow} {
+		if *data, err = hostFile(c, name); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Failed to read %s: %v", name, err)})
+			return
+		}
+	}
+	if files.Passwd == nil && files.Group == nil && files.Shadow == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No files given, send passwd, group or shadow as form files"})
+		return
+	}
+
+	// Compare
+	report, err := h.services.Drift.CompareHost(files, managed.Contains)
+	if err != nil {
+		h.logger.Errorf("Failed to compare host files: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compare host files"})
+		return
+	}
+
+	if format == "text" {
+		var buf bytes.Buffer
+		report.WriteText(&buf)
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", buf.Bytes())
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
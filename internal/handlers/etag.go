@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/home/unixify/internal/models"
+)
+
+// versionETag returns the strong ETag for a record version
+func versionETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// accountETag returns the strong ETag for an account. The response embeds the
+// primary group, so its version is part of the tag: renaming the group changes
+// what a client holds even though the account itself is unchanged.
+func accountETag(account *models.Account) string {
+	if account.PrimaryGroup == nil {
+		return versionETag(account.Version)
+	}
+	return `"` + strconv.Itoa(account.Version) + "." + strconv.Itoa(account.PrimaryGroup.Version) + `"`
+}
+
+// etagListed reports whether an If-None-Match header names etag, using the
+// weak comparison that header calls for
+func etagListed(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified sets the ETag header and answers 304 if the client already has it
+func notModified(c *gin.Context, etag string) bool {
+	c.Header("ETag", etag)
+	if header := c.GetHeader("If-None-Match"); header != "" && etagListed(header, etag) {
+		c.Status(http.StatusNotModified)
+		return true
+	}
+	return false
+}
+
+// writeVersioned writes a single record tagged with etag
+func writeVersioned(c *gin.Context, etag string, record interface{}) {
+	if notModified(c, etag) {
+		return
+	}
+	c.JSON(http.StatusOK, record)
+}
+
+// writeCollection writes a list tagged with a weak ETag of its body, so
+// pollers get a 304 until something in the list changes
+func writeCollection(c *gin.Context, records interface{}) {
+	body, err := json.Marshal(records)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode response"})
+		return
+	}
+	sum := sha256.Sum256(body)
+	if notModified(c, `W/"`+hex.EncodeToString(sum[:16])+`"`) {
+		return
+	}
+	c.Data(http.StatusOK, "application/json; charset=utf-8", body)
+}
+
+// ifMatchVersion returns the version a write is conditional on. "*" yields 0,
+// meaning any version. An account ETag's primary group version is ignored,
+// since a write only conflicts with changes to the record itself. A missing header answers 428 and one that names no
+// version answers 412; both return false.
+func ifMatchVersion(c *gin.Context) (int, bool) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" {
+		c.JSON(http.StatusPreconditionRequired, gin.H{"error": "If-Match header is required; send the ETag from a previous GET"})
+		return 0, false
+	}
+	if header == "*" {
+		return 0, true
+	}
+	tag := strings.Trim(header, `"`)
+	if i := strings.IndexByte(tag, '.'); i >= 0 {
+		tag = tag[:i]
+	}
+	version, err := strconv.Atoi(tag)
+	if err != nil || version < 1 || !strings.HasPrefix(header, `"`) {
+		versionConflict(c)
+		return 0, false
+	}
+	return version, true
+}
+
+// versionConflict answers 412 for a write against a stale version
+func versionConflict(c *gin.Context) {
+	c.JSON(http.StatusPreconditionFailed, gin.H{"error": "Record was modified since it was read; reload it and try again"})
+}
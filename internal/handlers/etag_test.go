@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/home/unixify/internal/repository/memory"
+	"github.com/home/unixify/internal/service"
+	"github.com/sirupsen/logrus"
+)
+
+// newTestRouter serves the account routes from an empty in-memory store
+func newTestRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	h := NewHandler(service.NewServices(service.Deps{Repos: memory.NewRepositories()}), nil, logger)
+
+	router := gin.New()
+	router.GET("/api/accounts", h.GetAllAccounts)
+	router.POST("/api/accounts", h.CreateAccount)
+	router.GET("/api/accounts/:id", h.GetAccount)
+	router.PUT("/api/accounts/:id", h.UpdateAccount)
+	router.DELETE("/api/accounts/:id", h.DeleteAccount)
+	router.POST("/api/groups", h.CreateGroup)
+	router.PUT("/api/groups/:id", h.UpdateGroup)
+	return router
+}
+
+// serve sends a request with optional headers given as name, value pairs
+func serve(router *gin.Engine, method, path, body string, headers ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestAccountConditionalRequests(t *testing.T) {
+	router := newTestRouter()
+	alice := `{"uid": 1001, "username": "alice", "type": "people"}`
+
+	if w := serve(router, http.MethodPost, "/api/accounts", alice); w.Code != http.StatusCreated || w.Header().Get("ETag") != `"1"` {
+		t.Fatalf("create = %d with ETag %q, want 201 with \"1\"", w.Code, w.Header().Get("ETag"))
+	}
+
+	w := serve(router, http.MethodGet, "/api/accounts/1", "")
+	if w.Code != http.StatusOK || w.Header().Get("ETag") != `"1"` {
+		t.Fatalf("get = %d with ETag %q, want 200 with \"1\"", w.Code, w.Header().Get("ETag"))
+	}
+	if w := serve(router, http.MethodGet, "/api/accounts/1", "", "If-None-Match", `"1"`); w.Code != http.StatusNotModified {
+		t.Errorf("get with a current If-None-Match = %d, want 304", w.Code)
+	}
+
+	list := serve(router, http.MethodGet, "/api/accounts", "")
+	listETag := list.Header().Get("ETag")
+	if !strings.HasPrefix(listETag, `W/"`) {
+		t.Fatalf("list ETag = %q, want a weak ETag", listETag)
+	}
+	if w := serve(router, http.MethodGet, "/api/accounts", "", "If-None-Match", listETag); w.Code != http.StatusNotModified {
+		t.Errorf("list with a current If-None-Match = %d, want 304", w.Code)
+	}
+
+	update := `{"uid": 1001, "username": "alice", "type": "people", "firstname": "Alice"}`
+	if w := serve(router, http.MethodPut, "/api/accounts/1", update); w.Code != http.StatusPreconditionRequired {
+		t.Errorf("update without If-Match = %d, want 428", w.Code)
+	}
+	w = serve(router, http.MethodPut, "/api/accounts/1", update, "If-Match", `"1"`)
+	if w.Code != http.StatusOK || w.Header().Get("ETag") != `"2"` {
+		t.Fatalf("update = %d with ETag %q, want 200 with \"2\"", w.Code, w.Header().Get("ETag"))
+	}
+	if w := serve(router, http.MethodPut, "/api/accounts/1", update, "If-Match", `"1"`); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("update with a stale If-Match = %d, want 412", w.Code)
+	}
+
+	if w := serve(router, http.MethodGet, "/api/accounts/1", "", "If-None-Match", `"1"`); w.Code != http.StatusOK {
+		t.Errorf("get with a stale If-None-Match = %d, want 200", w.Code)
+	}
+	if w := serve(router, http.MethodGet, "/api/accounts", "", "If-None-Match", listETag); w.Code != http.StatusOK {
+		t.Errorf("list with a stale If-None-Match = %d, want 200", w.Code)
+	}
+
+	if w := serve(router, http.MethodDelete, "/api/accounts/1", "", "If-Match", `"1"`); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("delete with a stale If-Match = %d, want 412", w.Code)
+	}
+	if w := serve(router, http.MethodDelete, "/api/accounts/1", "", "If-Match", `"2"`); w.Code != http.StatusOK {
+		t.Errorf("delete = %d, want 200", w.Code)
+	}
+}
+
+func TestAccountETagFollowsPrimaryGroup(t *testing.T) {
+	router := newTestRouter()
+	if w := serve(router, http.MethodPost, "/api/groups", `{"gid": 2001, "groupname": "staff", "type": "people"}`); w.Code != http.StatusCreated {
+		t.Fatalf("create group = %d: %s", w.Code, w.Body.String())
+	}
+	if w := serve(router, http.MethodPost, "/api/accounts", `{"uid": 1001, "username": "alice", "type": "people", "primary_group_id": 1}`); w.Code != http.StatusCreated {
+		t.Fatalf("create account = %d: %s", w.Code, w.Body.String())
+	}
+
+	w := serve(router, http.MethodGet, "/api/accounts/1", "")
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag != `"1.1"` {
+		t.Fatalf("get = %d with ETag %q, want 200 with \"1.1\"", w.Code, etag)
+	}
+
+	rename := `{"gid": 2001, "groupname": "employees", "type": "people"}`
+	if w := serve(router, http.MethodPut, "/api/groups/1", rename, "If-Match", `"1"`); w.Code != http.StatusOK {
+		t.Fatalf("rename group = %d: %s", w.Code, w.Body.String())
+	}
+	w = serve(router, http.MethodGet, "/api/accounts/1", "", "If-None-Match", etag)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"employees"`) {
+		t.Fatalf("get after renaming the primary group = %d: %s, want 200 with the new name", w.Code, w.Body.String())
+	}
+	etag = w.Header().Get("ETag")
+	if etag != `"1.2"` {
+		t.Errorf("ETag after renaming the primary group = %q, want \"1.2\"", etag)
+	}
+
+	update := `{"uid": 1001, "username": "alice", "type": "people", "primary_group_id": 1, "firstname": "Alice"}`
+	if w := serve(router, http.MethodPut, "/api/accounts/1", update, "If-Match", etag); w.Code != http.StatusOK {
+		t.Errorf("update with the ETag from the last read = %d, want 200", w.Code)
+	}
+}
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/home/unixify/internal/models"
+	"github.com/home/unixify/internal/service"
+)
+
+// Event stream settings
+const (
+	eventReplayBatch   = 500
+	eventKeepAlive     = 30 * time.Second
+	eventRetryInterval = 5 * time.Second
+)
+
+// StreamEvents handles GET /api/events. It streams registry changes as
+// Server-Sent Events, optionally limited to some sections with
+// ?section=people,system. A client that sends Last-Event-ID (or
+// ?last_event_id=) first receives the events it missed. Hosts only receive
+// the events about accounts, groups and memberships they have access to.
+func (h *Handler) StreamEvents(c *gin.Context) {
+	if h.events == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Event stream is not available"})
+		return
+	}
+
+	// Parse section filter
+	var sections []string
+	if sectionStr := c.Query("section"); sectionStr != "" {
+		for _, section := range strings.Split(sectionStr, ",") {
+			section = strings.TrimSpace(section)
+			switch models.AccountType(section) {
+			case models.AccountTypePeople, models.AccountTypeSystem, models.AccountTypeDatabase, models.AccountTypeService:
+				sections = append(sections, section)
+			default:
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid section %q", section)})
+				return
+			}
+		}
+	}
+
+	// Parse the resume point
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+	var resumeAfter uint64
+	if lastEventID != "" {
+		var err error
+		resumeAfter, err = strconv.ParseUint(lastEventID, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Last-Event-ID"})
+			return
+		}
+	}
+
+	// Subscribe before replaying so nothing committed in between is lost
+	sub := h.events.Subscribe(sections)
+	defer h.events.Unsubscribe(sub)
+
+	// Hosts are limited to their scope
+	scope, ok := h.requestScope(c)
+	if !ok {
+		return
+	}
+	wants := func(record *models.EventRecord) bool {
+		return sub.Wants(record) && h.scopeWantsEvent(c, scope, record)
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // Keep reverse proxies from buffering the stream
+	c.Status(http.StatusOK)
+	fmt.Fprintf(c.Writer, "retry: %d\n\n", eventRetryInterval.Milliseconds())
+	c.Writer.Flush()
+
+	// Replay the missed events. Events above sub.After may also come through
+	// the subscription, so those replayed are remembered to skip them there.
+	sent := uint(resumeAfter)
+	replayed := make(map[uint]bool)
+	if lastEventID != "" {
+		for {
+			records, err := h.services.Event.GetEventsSince(sent, eventReplayBatch)
+			if err != nil {
+				h.logger.Errorf("Failed to replay events: %v", err)
+				return
+			}
+			for i := range records {
+				if wants(&records[i]) {
+					writeEvent(c, &records[i])
+				}
+				if records[i].ID > sub.After {
+					replayed[records[i].ID] = true
+				}
+				sent = records[i].ID
+			}
+			c.Writer.Flush()
+			if len(records) < eventReplayBatch {
+				break
+			}
+		}
+	}
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case record, ok := <-sub.Events:
+			if !ok {
+				// Fell behind; the client reconnects and resumes from Last-Event-ID
+				return
+			}
+			if replayed[record.ID] {
+				continue // Already sent during the replay
+			}
+			if !wants(&record) {
+				continue
+			}
+			writeEvent(c, &record)
+			c.Writer.Flush()
+		case <-keepAlive.C:
+			fmt.Fprint(c.Writer, ": keep-alive\n\n")
+			c.Writer.Flush()
+		}
+	}
+}
+
+// scopeWantsEvent reports whether a host's scope covers an event; a nil
+// scope covers everything. An event outside the scope may be about a record
+// the host has been given access to since, so the scope is widened by the
+// host's current one, which is cached across its streams. It is never
+// narrowed, so the host still hears about records it could see that have
+// been deleted or moved out of its reach.
+func (h *Handler) scopeWantsEvent(c *gin.Context, scope *service.HostScope, record *models.EventRecord) bool {
+	if scope == nil || scope.WantsEvent(record) {
+		return true
+	}
+	fresh, err := h.services.Host.CachedHostScope(currentHost(c), record)
+	if err != nil {
+		h.logger.Errorf("Failed to resolve host access: %v", err)
+		return false
+	}
+	scope.Add(fresh)
+	return scope.WantsEvent(record)
+}
+
+// writeEvent writes one event in the Server-Sent Events format
+func writeEvent(c *gin.Context, record *models.EventRecord) {
+	fmt.Fprintf(c.Writer, "id: %d\nevent: %s\ndata: %s\n\n", record.ID, record.Type, record.Payload)
+}
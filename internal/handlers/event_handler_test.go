@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/home/unixify/internal/events"
+	"github.com/home/unixify/internal/models"
+	"github.com/home/unixify/internal/repository/memory"
+	"github.com/home/unixify/internal/service"
+	"github.com/sirupsen/logrus"
+)
+
+// stream requests the event stream and returns what it sent before the client went away
+func stream(router *gin.Engine, path string, headers ...string) *httptest.ResponseRecorder {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	req := httptest.NewRequest(http.MethodGet, path, nil).WithContext(ctx)
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestEventStreamReplaysFromLastEventID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	repos := memory.NewRepositories()
+	services := service.NewServices(service.Deps{Repos: repos})
+	h := NewHandler(services, events.NewBroker(repos.Event, logger), logger)
+	router := gin.New()
+	router.GET("/api/events", h.StreamEvents)
+
+	// Events 1, 2 and 3
+	staff := &models.Group{UnixGID: 1000, Groupname: "staff", Type: models.GroupTypePeople}
+	alice := &models.Account{UnixUID: 1001, Username: "alice", Type: models.AccountTypePeople}
+	daemons := &models.Group{UnixGID: 10, Groupname: "daemons", Type: models.GroupTypeSystem}
+	if err := services.Group.CreateGroup(staff, 1, "admin", "127.0.0.1"); err != nil {
+		t.Fatalf("CreateGroup: %v", err)
+	}
+	if err := services.Account.CreateAccount(alice, 1, "admin", "127.0.0.1"); err != nil {
+		t.Fatalf("CreateAccount: %v", err)
+	}
+	if err := services.Group.CreateGroup(daemons, 1, "admin", "127.0.0.1"); err != nil {
+		t.Fatalf("CreateGroup: %v", err)
+	}
+
+	w := stream(router, "/api/events?section=people", "Last-Event-ID", "1")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("stream = %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, "id: 2\nevent: account.created\ndata: {") {
+		t.Errorf("missed people event 2 in %q", body)
+	}
+	if strings.Contains(body, "id: 1\n") || strings.Contains(body, "id: 3\n") {
+		t.Errorf("replayed events outside the request in %q", body)
+	}
+
+	if body := stream(router, "/api/events").Body.String(); strings.Contains(body, "id: ") {
+		t.Errorf("replayed events without Last-Event-ID: %q", body)
+	}
+	if w := stream(router, "/api/events?section=staff"); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown section = %d, want 400", w.Code)
+	}
+}
@@ -1,11 +1,13 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/home/unixify/internal/models"
+	"github.com/home/unixify/internal/repository"
 )
 
 // groupInput represents the input for group creation/update
@@ -30,7 +32,7 @@ func (h *Handler) GetAllGroups(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, groups)
+	writeCollection(c, groups)
 }
 
 // GetGroup handles GET /api/groups/:id
@@ -50,7 +52,7 @@ func (h *Handler) GetGroup(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, group)
+	writeVersioned(c, versionETag(group.Version), group)
 }
 
 // GetGroupByGID handles GET /api/groups/gid/:gid
@@ -70,7 +72,7 @@ func (h *Handler) GetGroupByGID(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, group)
+	writeVersioned(c, versionETag(group.Version), group)
 }
 
 // GetGroupByGroupname handles GET /api/groups/groupname/:groupname
@@ -86,7 +88,7 @@ func (h *Handler) GetGroupByGroupname(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, group)
+	writeVersioned(c, versionETag(group.Version), group)
 }
 
 // CreateGroup handles POST /api/groups
@@ -128,11 +130,12 @@ func (h *Handler) CreateGroup(c *gin.Context) {
 	err := h.services.Group.CreateGroup(group, userID, username, ipAddress)
 	if err != nil {
 		h.logger.Errorf("CreateGroup: Failed to create group: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		badRequest(c, err)
 		return
 	}
 
 	h.logger.Infof("CreateGroup: Group created successfully with ID: %d", group.ID)
+	c.Header("ETag", versionETag(group.Version))
 	c.JSON(http.StatusCreated, group)
 }
 
@@ -145,6 +148,12 @@ func (h *Handler) UpdateGroup(c *gin.Context) {
 		return
 	}
 
+	// Get the version the client last saw
+	version, ok := ifMatchVersion(c)
+	if !ok {
+		return
+	}
+
 	// Get existing group
 	group, err := h.services.Group.GetGroup(uint(id))
 	if err != nil {
@@ -153,6 +162,12 @@ func (h *Handler) UpdateGroup(c *gin.Context) {
 		return
 	}
 
+	// Refuse to overwrite changes the client has not seen
+	if version != 0 && version != group.Version {
+		versionConflict(c)
+		return
+	}
+
 	// Parse input
 	var input groupInput
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -180,10 +195,15 @@ func (h *Handler) UpdateGroup(c *gin.Context) {
 	err = h.services.Group.UpdateGroup(group, userID, username, ipAddress)
 	if err != nil {
 		h.logger.Errorf("Failed to update group: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		if errors.Is(err, repository.ErrVersionMismatch) {
+			versionConflict(c)
+			return
+		}
+		badRequest(c, err)
 		return
 	}
 
+	c.Header("ETag", versionETag(group.Version))
 	c.JSON(http.StatusOK, group)
 }
 
@@ -196,15 +216,25 @@ func (h *Handler) DeleteGroup(c *gin.Context) {
 		return
 	}
 
+	// Get the version the client last saw
+	version, ok := ifMatchVersion(c)
+	if !ok {
+		return
+	}
+
 	// Get user info for audit
 	userID := uint(0) // In a real app, this would be from the auth middleware
 	username := "admin" // In a real app, this would be from the auth middleware
 	ipAddress := c.ClientIP()
 
 	// Delete group
-	err = h.services.Group.DeleteGroup(uint(id), userID, username, ipAddress)
+	err = h.services.Group.DeleteGroup(uint(id), version, userID, username, ipAddress)
 	if err != nil {
 		h.logger.Errorf("Failed to delete group: %v", err)
+		if errors.Is(err, repository.ErrVersionMismatch) {
+			versionConflict(c)
+			return
+		}
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
@@ -243,6 +273,10 @@ func (h *Handler) SearchGroups(c *gin.Context) {
 
 	// Search groups
 	groups, err := h.services.Group.SearchGroups(query)
+	if isQueryError(err) {
+		badRequest(c, err)
+		return
+	}
 	if err != nil {
 		h.logger.Errorf("Failed to search groups: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search groups"})
@@ -1,20 +1,51 @@
 package handlers
 
 import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/home/unixify/internal/events"
+	"github.com/home/unixify/internal/query"
 	"github.com/home/unixify/internal/service"
+	"github.com/home/unixify/internal/validator"
 	"github.com/sirupsen/logrus"
 )
 
 // Handler handles HTTP requests
 type Handler struct {
 	services *service.Services
+	events   *events.Broker // Feeds the event stream; nil disables it
 	logger   *logrus.Logger
 }
 
 // NewHandler creates a new handler
-func NewHandler(services *service.Services, logger *logrus.Logger) *Handler {
+func NewHandler(services *service.Services, broker *events.Broker, logger *logrus.Logger) *Handler {
 	return &Handler{
 		services: services,
+		events:   broker,
 		logger:   logger,
 	}
-}
\ No newline at end of file
+}
+
+// badRequest answers 400 with the error; validation failures also list the
+// fields they concern, and query parse errors where the problem is
+func badRequest(c *gin.Context, err error) {
+	var fields validator.FieldErrors
+	if errors.As(err, &fields) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "fields": fields})
+		return
+	}
+	var parseErr *query.Error
+	if errors.As(err, &parseErr) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "position": parseErr.Pos + 1})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+}
+
+// isQueryError reports whether err is a query parse error
+func isQueryError(err error) bool {
+	var parseErr *query.Error
+	return errors.As(err, &parseErr)
+}
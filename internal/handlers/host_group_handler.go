@@ -0,0 +1,285 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/home/unixify/internal/models"
+)
+
+// hostGroupInput represents the input for host group creation/update
+type hostGroupInput struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+}
+
+// hostGroupMemberInput represents the input for adding a host to a host group
+type hostGroupMemberInput struct {
+	HostID uint `json:"host_id" binding:"required"`
+}
+
+// accessRuleInput represents the input for access rule creation; exactly
+// one of the fields is set
+type accessRuleInput struct {
+	GroupID   uint `json:"group_id"`
+	AccountID uint `json:"account_id"`
+}
+
+// GetAllHostGroups handles GET /api/host-groups
+func (h *Handler) GetAllHostGroups(c *gin.Context) {
+	hostGroups, err := h.services.Host.GetAllHostGroups()
+	if err != nil {
+		h.logger.Errorf("Failed to get host groups: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get host groups"})
+		return
+	}
+
+	c.JSON(http.StatusOK, hostGroups)
+}
+
+// GetHostGroup handles GET /api/host-groups/:id
+func (h *Handler) GetHostGroup(c *gin.Context) {
+	id, ok := idParam(c, "id", "host group")
+	if !ok {
+		return
+	}
+
+	// Get host group
+	hostGroup, err := h.services.Host.GetHostGroup(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, hostGroup)
+}
+
+// CreateHostGroup handles POST /api/host-groups
+func (h *Handler) CreateHostGroup(c *gin.Context) {
+	// Parse input
+	var input hostGroupInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Get user info for audit
+	userID := c.GetUint("userID")
+	username := c.GetString("username")
+	ipAddress := c.ClientIP()
+
+	// Create host group
+	hostGroup := &models.HostGroup{Name: input.Name, Description: input.Description}
+	if err := h.services.Host.CreateHostGroup(hostGroup, userID, username, ipAddress); err != nil {
+		h.logger.Errorf("Failed to create host group: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, hostGroup)
+}
+
+// UpdateHostGroup handles PUT /api/host-groups/:id
+func (h *Handler) UpdateHostGroup(c *gin.Context) {
+	id, ok := idParam(c, "id", "host group")
+	if !ok {
+		return
+	}
+
+	// Get existing host group
+	hostGroup, err := h.services.Host.GetHostGroup(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Parse input
+	var input hostGroupInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	hostGroup.Name = input.Name
+	hostGroup.Description = input.Description
+
+	// Get user info for audit
+	userID := c.GetUint("userID")
+	username := c.GetString("username")
+	ipAddress := c.ClientIP()
+
+	// Update host group
+	if err := h.services.Host.UpdateHostGroup(hostGroup, userID, username, ipAddress); err != nil {
+		h.logger.Errorf("Failed to update host group: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, hostGroup)
+}
+
+// DeleteHostGroup handles DELETE /api/host-groups/:id
+func (h *Handler) DeleteHostGroup(c *gin.Context) {
+	id, ok := idParam(c, "id", "host group")
+	if !ok {
+		return
+	}
+
+	// Get user info for audit
+	userID := c.GetUint("userID")
+	username := c.GetString("username")
+	ipAddress := c.ClientIP()
+
+	// Delete host group
+	if err := h.services.Host.DeleteHostGroup(id, userID, username, ipAddress); err != nil {
+		h.logger.Errorf("Failed to delete host group: %v", err)
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Host group deleted successfully"})
+}
+
+// GetHostGroupHosts handles GET /api/host-groups/:id/hosts
+func (h *Handler) GetHostGroupHosts(c *gin.Context) {
+	id, ok := idParam(c, "id", "host group")
+	if !ok {
+		return
+	}
+
+	// Get hosts
+	hosts, err := h.services.Host.GetHostsInGroup(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, hosts)
+}
+
+// AddHostToGroup handles POST /api/host-groups/:id/hosts
+func (h *Handler) AddHostToGroup(c *gin.Context) {
+	id, ok := idParam(c, "id", "host group")
+	if !ok {
+		return
+	}
+
+	// Parse input
+	var input hostGroupMemberInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Get user info for audit
+	userID := c.GetUint("userID")
+	username := c.GetString("username")
+	ipAddress := c.ClientIP()
+
+	// Add host
+	if err := h.services.Host.AddHostToGroup(id, input.HostID, userID, username, ipAddress); err != nil {
+		h.logger.Errorf("Failed to add host to host group: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Host added to host group successfully"})
+}
+
+// RemoveHostFromGroup handles DELETE /api/host-groups/:id/hosts/:hostId
+func (h *Handler) RemoveHostFromGroup(c *gin.Context) {
+	id, ok := idParam(c, "id", "host group")
+	if !ok {
+		return
+	}
+	hostID, ok := idParam(c, "hostId", "host")
+	if !ok {
+		return
+	}
+
+	// Get user info for audit
+	userID := c.GetUint("userID")
+	username := c.GetString("username")
+	ipAddress := c.ClientIP()
+
+	// Remove host
+	if err := h.services.Host.RemoveHostFromGroup(id, hostID, userID, username, ipAddress); err != nil {
+		h.logger.Errorf("Failed to remove host from host group: %v", err)
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Host removed from host group successfully"})
+}
+
+// GetAccessRules handles GET /api/host-groups/:id/rules
+func (h *Handler) GetAccessRules(c *gin.Context) {
+	id, ok := idParam(c, "id", "host group")
+	if !ok {
+		return
+	}
+
+	// Get rules
+	rules, err := h.services.Host.GetAccessRules(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, rules)
+}
+
+// CreateAccessRule handles POST /api/host-groups/:id/rules
+func (h *Handler) CreateAccessRule(c *gin.Context) {
+	id, ok := idParam(c, "id", "host group")
+	if !ok {
+		return
+	}
+
+	// Parse input
+	var input accessRuleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Get user info for audit
+	userID := c.GetUint("userID")
+	username := c.GetString("username")
+	ipAddress := c.ClientIP()
+
+	// Create rule
+	rule := &models.AccessRule{HostGroupID: id, GroupID: input.GroupID, AccountID: input.AccountID}
+	if err := h.services.Host.CreateAccessRule(rule, userID, username, ipAddress); err != nil {
+		h.logger.Errorf("Failed to create access rule: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, rule)
+}
+
+// DeleteAccessRule handles DELETE /api/host-groups/:id/rules/:ruleId
+func (h *Handler) DeleteAccessRule(c *gin.Context) {
+	id, ok := idParam(c, "id", "host group")
+	if !ok {
+		return
+	}
+	ruleID, ok := idParam(c, "ruleId", "access rule")
+	if !ok {
+		return
+	}
+
+	// Get user info for audit
+	userID := c.GetUint("userID")
+	username := c.GetString("username")
+	ipAddress := c.ClientIP()
+
+	// Delete rule
+	if err := h.services.Host.DeleteAccessRule(id, ruleID, userID, username, ipAddress); err != nil {
+		h.logger.Errorf("Failed to delete access rule: %v", err)
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Access rule deleted successfully"})
+}
@@ -0,0 +1,274 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/home/unixify/internal/models"
+)
+
+// Host report page sizes
+const (
+	defaultHostReportLimit = 100
+	maxHostReportLimit     = 1000
+)
+
+// ReportHost handles POST /api/hosts/reports, which host agents call after each sync
+func (h *Handler) ReportHost(c *gin.Context) {
+	// Parse input
+	var report models.HostReport
+	if err := c.ShouldBindJSON(&report); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Store report
+	if err := h.services.Host.ReportHost(&report); err != nil {
+		h.logger.Errorf("Failed to store host report: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, report)
+}
+
+// GetHostReports handles GET /api/hosts/reports?hostname=NAME
+func (h *Handler) GetHostReports(c *gin.Context) {
+	// Parse page size
+	limit := defaultHostReportLimit
+	if limitStr := c.Query("limit"); limitStr != "" {
+		var err error
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > maxHostReportLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return
+		}
+	}
+
+	// Get reports
+	reports, err := h.services.Host.GetHostReports(c.Query("hostname"), limit)
+	if err != nil {
+		h.logger.Errorf("Failed to get host reports: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get host reports"})
+		return
+	}
+
+	c.JSON(http.StatusOK, reports)
+}
+
+// hostInput represents the input for host creation/update
+type hostInput struct {
+	Hostname    string `json:"hostname" binding:"required"`
+	Description string `json:"description"`
+}
+
+// hostWithToken is returned once when a host is created or its token rotated
+type hostWithToken struct {
+	*models.Host
+	Token string `json:"token"`
+}
+
+// idParam parses a numeric path parameter and answers 400 when it is invalid
+func idParam(c *gin.Context, name, label string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param(name), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + label + " ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// GetAllHosts handles GET /api/hosts
+func (h *Handler) GetAllHosts(c *gin.Context) {
+	hosts, err := h.services.Host.GetAllHosts()
+	if err != nil {
+		h.logger.Errorf("Failed to get hosts: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get hosts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, hosts)
+}
+
+// GetHost handles GET /api/hosts/:id
+func (h *Handler) GetHost(c *gin.Context) {
+	id, ok := idParam(c, "id", "host")
+	if !ok {
+		return
+	}
+
+	// Get host
+	host, err := h.services.Host.GetHost(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, host)
+}
+
+// GetHostAccessPreview handles GET /api/hosts/:id/access, which shows what a
+// host sees without its token
+func (h *Handler) GetHostAccessPreview(c *gin.Context) {
+	id, ok := idParam(c, "id", "host")
+	if !ok {
+		return
+	}
+
+	// Get host
+	host, err := h.services.Host.GetHost(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Resolve access
+	access, err := h.services.Host.GetHostAccess(host)
+	if err != nil {
+		h.logger.Errorf("Failed to resolve host access: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve host access"})
+		return
+	}
+
+	c.JSON(http.StatusOK, access)
+}
+
+// GetHostGroupsOfHost handles GET /api/hosts/:id/host-groups
+func (h *Handler) GetHostGroupsOfHost(c *gin.Context) {
+	id, ok := idParam(c, "id", "host")
+	if !ok {
+		return
+	}
+
+	// Make sure the host exists
+	if _, err := h.services.Host.GetHost(id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Get host groups
+	hostGroups, err := h.services.Host.GetHostGroupsOfHost(id)
+	if err != nil {
+		h.logger.Errorf("Failed to get host groups of host: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get host groups"})
+		return
+	}
+
+	c.JSON(http.StatusOK, hostGroups)
+}
+
+// CreateHost handles POST /api/hosts. The response holds the host token,
+// which is not shown again.
+func (h *Handler) CreateHost(c *gin.Context) {
+	// Parse input
+	var input hostInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Get user info for audit
+	userID := c.GetUint("userID")
+	username := c.GetString("username")
+	ipAddress := c.ClientIP()
+
+	// Create host
+	host := &models.Host{Hostname: input.Hostname, Description: input.Description}
+	token, err := h.services.Host.CreateHost(host, userID, username, ipAddress)
+	if err != nil {
+		h.logger.Errorf("Failed to create host: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, hostWithToken{Host: host, Token: token})
+}
+
+// UpdateHost handles PUT /api/hosts/:id
+func (h *Handler) UpdateHost(c *gin.Context) {
+	id, ok := idParam(c, "id", "host")
+	if !ok {
+		return
+	}
+
+	// Get existing host
+	host, err := h.services.Host.GetHost(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Parse input
+	var input hostInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	host.Hostname = input.Hostname
+	host.Description = input.Description
+
+	// Get user info for audit
+	userID := c.GetUint("userID")
+	username := c.GetString("username")
+	ipAddress := c.ClientIP()
+
+	// Update host
+	if err := h.services.Host.UpdateHost(host, userID, username, ipAddress); err != nil {
+		h.logger.Errorf("Failed to update host: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, host)
+}
+
+// DeleteHost handles DELETE /api/hosts/:id
+func (h *Handler) DeleteHost(c *gin.Context) {
+	id, ok := idParam(c, "id", "host")
+	if !ok {
+		return
+	}
+
+	// Get user info for audit
+	userID := c.GetUint("userID")
+	username := c.GetString("username")
+	ipAddress := c.ClientIP()
+
+	// Delete host
+	if err := h.services.Host.DeleteHost(id, userID, username, ipAddress); err != nil {
+		h.logger.Errorf("Failed to delete host: %v", err)
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Host deleted successfully"})
+}
+
+// RotateHostToken handles POST /api/hosts/:id/token
+func (h *Handler) RotateHostToken(c *gin.Context) {
+	id, ok := idParam(c, "id", "host")
+	if !ok {
+		return
+	}
+
+	// Get user info for audit
+	userID := c.GetUint("userID")
+	username := c.GetString("username")
+	ipAddress := c.ClientIP()
+
+	// Rotate token
+	token, err := h.services.Host.RotateHostToken(id, userID, username, ipAddress)
+	if err != nil {
+		h.logger.Errorf("Failed to rotate host token: %v", err)
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	host, err := h.services.Host.GetHost(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, hostWithToken{Host: host, Token: token})
+}
@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/home/unixify/internal/models"
+	"github.com/home/unixify/internal/nss"
+	"github.com/home/unixify/internal/service"
+)
+
+// HostTokenHeader carries the token a host authenticates with
+const HostTokenHeader = "X-Unixify-Host-Token"
+
+// HostAuthMiddleware authenticates hosts by their token and stores the host
+// in the context; every response under it is scoped to that host
+func (h *Handler) HostAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		host, err := h.services.Host.AuthenticateHost(c.GetHeader(HostTokenHeader))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.Set("host", host)
+		c.Next()
+	}
+}
+
+// currentHost returns the host authenticated by HostAuthMiddleware
+func currentHost(c *gin.Context) *models.Host {
+	return c.MustGet("host").(*models.Host)
+}
+
+// UserOrHostMiddleware admits either a host, by its token, or a logged-in
+// user through userAuth. It guards the read routes that hosts share with
+// users; requestScope tells the handlers what a host may see.
+func (h *Handler) UserOrHostMiddleware(userAuth gin.HandlerFunc) gin.HandlerFunc {
+	hostAuth := h.HostAuthMiddleware()
+	return func(c *gin.Context) {
+		if c.GetHeader(HostTokenHeader) != "" {
+			hostAuth(c)
+			return
+		}
+		userAuth(c)
+	}
+}
+
+// requestScope returns the accounts and groups the requesting host may see,
+// or nil for users, who see everything. It answers 500 on failure.
+func (h *Handler) requestScope(c *gin.Context) (*service.HostScope, bool) {
+	value, exists := c.Get("host")
+	if !exists {
+		return nil, true
+	}
+	scope, err := h.services.Host.GetHostScope(value.(*models.Host))
+	if err != nil {
+		h.logger.Errorf("Failed to resolve host access: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve host access"})
+		return nil, false
+	}
+	return scope, true
+}
+
+// GetCurrentHost handles GET /api/host, which tells a host who it is
+func (h *Handler) GetCurrentHost(c *gin.Context) {
+	host := currentHost(c)
+	hostGroups, err := h.services.Host.GetHostGroupsOfHost(host.ID)
+	if err != nil {
+		h.logger.Errorf("Failed to get host groups of host: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get host groups"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"host": host, "host_groups": hostGroups})
+}
+
+// GetCurrentHostAccess handles GET /api/host/access
+func (h *Handler) GetCurrentHostAccess(c *gin.Context) {
+	access, err := h.services.Host.GetHostAccess(currentHost(c))
+	if err != nil {
+		h.logger.Errorf("Failed to resolve host access: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve host access"})
+		return
+	}
+
+	c.JSON(http.StatusOK, access)
+}
+
+// hostEntries gets the passwd and group entries of the current host,
+// answering 500 on failure
+func (h *Handler) hostEntries(c *gin.Context) ([]nss.PasswdEntry, []nss.GroupEntry, bool) {
+	passwd, group, err := h.services.Host.GetHostEntries(currentHost(c))
+	if err != nil {
+		h.logger.Errorf("Failed to build host entries: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build host entries"})
+		return nil, nil, false
+	}
+	return passwd, group, true
+}
+
+// ExportHostPasswd handles GET /api/host/passwd, the host's passwd file
+func (h *Handler) ExportHostPasswd(c *gin.Context) {
+	passwd, _, ok := h.hostEntries(c)
+	if !ok {
+		return
+	}
+
+	var b strings.Builder
+	for _, entry := range passwd {
+		b.WriteString(entry.String() + "\n")
+	}
+	c.String(http.StatusOK, b.String())
+}
+
+// ExportHostGroup handles GET /api/host/group, the host's group file
+func (h *Handler) ExportHostGroup(c *gin.Context) {
+	_, group, ok := h.hostEntries(c)
+	if !ok {
+		return
+	}
+
+	var b strings.Builder
+	for _, entry := range group {
+		b.WriteString(entry.String() + "\n")
+	}
+	c.String(http.StatusOK, b.String())
+}
+
+// LookupHostPasswd handles GET /api/host/nss/passwd?name=NAME&uid=UID. Without
+// filters it enumerates; with them it answers 404 when nothing matches, like
+// getpwnam and getpwuid.
+func (h *Handler) LookupHostPasswd(c *gin.Context) {
+	name := c.Query("name")
+	uid := -1
+	if uidStr := c.Query("uid"); uidStr != "" {
+		var err error
+		if uid, err = strconv.Atoi(uidStr); err != nil || uid < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid UID"})
+			return
+		}
+	}
+
+	passwd, _, ok := h.hostEntries(c)
+	if !ok {
+		return
+	}
+	matches := []nss.PasswdEntry{}
+	for _, entry := range passwd {
+		if (name == "" || entry.Name == name) && (uid < 0 || entry.UID == uid) {
+			matches = append(matches, entry)
+		}
+	}
+	if len(matches) == 0 && (name != "" || uid >= 0) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, matches)
+}
+
+// LookupHostGroup handles GET /api/host/nss/group?name=NAME&gid=GID&member=USER.
+// Without filters it enumerates; with them it answers 404 when nothing
+// matches, like getgrnam and getgrgid. member lists the groups a user is in.
+func (h *Handler) LookupHostGroup(c *gin.Context) {
+	name := c.Query("name")
+	member := c.Query("member")
+	gid := -1
+	if gidStr := c.Query("gid"); gidStr != "" {
+		var err error
+		if gid, err = strconv.Atoi(gidStr); err != nil || gid < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid GID"})
+			return
+		}
+	}
+
+	_, group, ok := h.hostEntries(c)
+	if !ok {
+		return
+	}
+	matches := []nss.GroupEntry{}
+	for _, entry := range group {
+		if (name == "" || entry.Name == name) && (gid < 0 || entry.GID == gid) && (member == "" || hasMember(entry, member)) {
+			matches = append(matches, entry)
+		}
+	}
+	if len(matches) == 0 && (name != "" || gid >= 0 || member != "") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, matches)
+}
+
+// hasMember reports whether a group entry lists a user
+func hasMember(entry nss.GroupEntry, username string) bool {
+	for _, member := range entry.Members {
+		if member == username {
+			return true
+		}
+	}
+	return false
+}
+
+// ReportCurrentHost handles POST /api/host/reports; the report is filed under
+// the authenticated host, whatever hostname it names
+func (h *Handler) ReportCurrentHost(c *gin.Context) {
+	// Parse input
+	var report models.HostReport
+	if err := c.ShouldBindJSON(&report); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	report.Hostname = currentHost(c).Hostname
+
+	// Store report
+	if err := h.services.Host.ReportHost(&report); err != nil {
+		h.logger.Errorf("Failed to store host report: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, report)
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/home/unixify/internal/models"
+)
+
+// netgroupInput represents the input for netgroup creation/update
+type netgroupInput struct {
+	Name        string                  `json:"name" binding:"required"`
+	Description string                  `json:"description"`
+	Triples     []models.NetgroupTriple `json:"triples"`
+	Netgroups   []string                `json:"netgroups"` // Names of nested netgroups
+}
+
+// GetAllNetgroups handles GET /api/netgroups
+func (h *Handler) GetAllNetgroups(c *gin.Context) {
+	netgroups, err := h.services.Netgroup.GetAllNetgroups()
+	if err != nil {
+		h.logger.Errorf("Failed to get netgroups: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get netgroups"})
+		return
+	}
+
+	c.JSON(http.StatusOK, netgroups)
+}
+
+// GetNetgroup handles GET /api/netgroups/:id
+func (h *Handler) GetNetgroup(c *gin.Context) {
+	id, ok := idParam(c, "id", "netgroup")
+	if !ok {
+		return
+	}
+
+	// Get netgroup
+	netgroup, err := h.services.Netgroup.GetNetgroup(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, netgroup)
+}
+
+// ExportNetgroups handles GET /api/netgroups/export?format=netgroup|ldif.
+// The ldif format takes the parent entry of the netgroups in base_dn.
+func (h *Handler) ExportNetgroups(c *gin.Context) {
+	var data []byte
+	var err error
+	switch c.DefaultQuery("format", "netgroup") {
+	case "netgroup":
+		data, err = h.services.Netgroup.ExportNetgroupFile()
+	case "ldif":
+		data, err = h.services.Netgroup.ExportNetgroupLDIF(c.Query("base_dn"))
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid format, use netgroup or ldif"})
+		return
+	}
+	if err != nil {
+		h.logger.Errorf("Failed to export netgroups: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export netgroups"})
+		return
+	}
+
+	c.Data(http.StatusOK, "text/plain; charset=utf-8", data)
+}
+
+// CreateNetgroup handles POST /api/netgroups
+func (h *Handler) CreateNetgroup(c *gin.Context) {
+	// Parse input
+	var input netgroupInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Get user info for audit
+	userID := c.GetUint("userID")
+	username := c.GetString("username")
+	ipAddress := c.ClientIP()
+
+	// Create netgroup
+	netgroup := &models.Netgroup{
+		Name:        input.Name,
+		Description: input.Description,
+		Triples:     input.Triples,
+		Netgroups:   input.Netgroups,
+	}
+	if err := h.services.Netgroup.CreateNetgroup(netgroup, userID, username, ipAddress); err != nil {
+		h.logger.Errorf("Failed to create netgroup: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, netgroup)
+}
+
+// UpdateNetgroup handles PUT /api/netgroups/:id
+func (h *Handler) UpdateNetgroup(c *gin.Context) {
+	id, ok := idParam(c, "id", "netgroup")
+	if !ok {
+		return
+	}
+
+	// Get existing netgroup
+	netgroup, err := h.services.Netgroup.GetNetgroup(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Parse input
+	var input netgroupInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	netgroup.Name = input.Name
+	netgroup.Description = input.Description
+	netgroup.Triples = input.Triples
+	netgroup.Netgroups = input.Netgroups
+
+	// Get user info for audit
+	userID := c.GetUint("userID")
+	username := c.GetString("username")
+	ipAddress := c.ClientIP()
+
+	// Update netgroup
+	if err := h.services.Netgroup.UpdateNetgroup(netgroup, userID, username, ipAddress); err != nil {
+		h.logger.Errorf("Failed to update netgroup: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, netgroup)
+}
+
+// DeleteNetgroup handles DELETE /api/netgroups/:id
+func (h *Handler) DeleteNetgroup(c *gin.Context) {
+	id, ok := idParam(c, "id", "netgroup")
+	if !ok {
+		return
+	}
+
+	// Make sure the netgroup exists
+	if _, err := h.services.Netgroup.GetNetgroup(id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Get user info for audit
+	userID := c.GetUint("userID")
+	username := c.GetString("username")
+	ipAddress := c.ClientIP()
+
+	// Delete netgroup
+	if err := h.services.Netgroup.DeleteNetgroup(id, userID, username, ipAddress); err != nil {
+		h.logger.Errorf("Failed to delete netgroup: %v", err)
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Netgroup deleted successfully"})
+}
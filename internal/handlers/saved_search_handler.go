@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/home/unixify/internal/models"
+)
+
+// savedSearchInput represents the input for saved search creation/update
+type savedSearchInput struct {
+	Name  string `json:"name" binding:"required"`
+	Kind  string `json:"kind" binding:"required"` // accounts, groups or all
+	Query string `json:"query" binding:"required"`
+}
+
+// GetSavedSearches handles GET /api/saved-searches. It lists the searches
+// the current user saved.
+func (h *Handler) GetSavedSearches(c *gin.Context) {
+	searches, err := h.services.SavedSearch.GetSavedSearches(c.GetUint("userID"))
+	if err != nil {
+		h.logger.Errorf("Failed to get saved searches: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get saved searches"})
+		return
+	}
+
+	c.JSON(http.StatusOK, searches)
+}
+
+// GetSavedSearch handles GET /api/saved-searches/:id
+func (h *Handler) GetSavedSearch(c *gin.Context) {
+	id, ok := idParam(c, "id", "saved search")
+	if !ok {
+		return
+	}
+
+	search, err := h.services.SavedSearch.GetSavedSearch(id, c.GetUint("userID"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, search)
+}
+
+// CreateSavedSearch handles POST /api/saved-searches. The query must parse
+// for the kind of search.
+func (h *Handler) CreateSavedSearch(c *gin.Context) {
+	var input savedSearchInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	search := &models.SavedSearch{Name: input.Name, Kind: input.Kind, Query: input.Query}
+	if err := h.services.SavedSearch.CreateSavedSearch(search, c.GetUint("userID")); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, search)
+}
+
+// UpdateSavedSearch handles PUT /api/saved-searches/:id
+func (h *Handler) UpdateSavedSearch(c *gin.Context) {
+	id, ok := idParam(c, "id", "saved search")
+	if !ok {
+		return
+	}
+	userID := c.GetUint("userID")
+
+	search, err := h.services.SavedSearch.GetSavedSearch(id, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	var input savedSearchInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	search.Name = input.Name
+	search.Kind = input.Kind
+	search.Query = input.Query
+
+	if err := h.services.SavedSearch.UpdateSavedSearch(search, userID); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, search)
+}
+
+// DeleteSavedSearch handles DELETE /api/saved-searches/:id
+func (h *Handler) DeleteSavedSearch(c *gin.Context) {
+	id, ok := idParam(c, "id", "saved search")
+	if !ok {
+		return
+	}
+
+	userID := c.GetUint("userID")
+
+	// Make sure the saved search exists and is the user's
+	if _, err := h.services.SavedSearch.GetSavedSearch(id, userID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.services.SavedSearch.DeleteSavedSearch(id, userID); err != nil {
+		h.logger.Errorf("Failed to delete saved search: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete saved search"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Saved search deleted successfully"})
+}
+
+// RunSavedSearch handles GET /api/saved-searches/:id/results. It runs the
+// saved query as the search endpoint of its kind would; limit applies to
+// searches of the kind all.
+func (h *Handler) RunSavedSearch(c *gin.Context) {
+	id, ok := idParam(c, "id", "saved search")
+	if !ok {
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "0"))
+	if err != nil || limit < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+		return
+	}
+
+	search, err := h.services.SavedSearch.GetSavedSearch(id, c.GetUint("userID"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	results, err := h.services.SavedSearch.RunSavedSearch(search, limit)
+	if isQueryError(err) {
+		badRequest(c, err)
+		return
+	}
+	if err != nil {
+		h.logger.Errorf("Failed to run saved search: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to run saved search"})
+		return
+	}
+
+	c.JSON(http.StatusOK, results)
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/home/unixify/internal/state"
+)
+
+// bindDesiredState parses a desired-state document from the request body.
+// YAML is accepted when the Content-Type says so, JSON otherwise.
+func bindDesiredState(c *gin.Context) (*state.DesiredState, error) {
+	data, err := c.GetRawData()
+	if err != nil {
+		return nil, err
+	}
+
+	format := state.FormatJSON
+	if strings.Contains(c.ContentType(), "yaml") {
+		format = state.FormatYAML
+	}
+
+	return state.Parse(data, format)
+}
+
+// PlanState handles POST /api/state/plan
+func (h *Handler) PlanState(c *gin.Context) {
+	// Parse desired state
+	desired, err := bindDesiredState(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	prune := c.Query("prune") == "true"
+
+	// Compute plan
+	plan, err := h.services.State.Plan(desired, prune)
+	if err != nil {
+		h.logger.Errorf("Failed to plan desired state: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, plan)
+}
+
+// ApplyState handles POST /api/state/apply
+func (h *Handler) ApplyState(c *gin.Context) {
+	// Parse desired state
+	desired, err := bindDesiredState(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	prune := c.Query("prune") == "true"
+
+	// Get user info for audit
+	userID := c.GetUint("userID")
+	username := c.GetString("username")
+	ipAddress := c.ClientIP()
+
+	// Apply plan
+	plan, err := h.services.State.Apply(desired, prune, userID, username, ipAddress)
+	if err != nil {
+		h.logger.Errorf("Failed to apply desired state: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, plan)
+}
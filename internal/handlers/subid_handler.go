@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/home/unixify/internal/models"
+)
+
+// subIDInput represents the input for subordinate ID allocation
+type subIDInput struct {
+	AccountID uint `json:"account_id"` // 0 allocates to every people account without a block
+}
+
+// GetAllSubIDRanges handles GET /api/subids
+func (h *Handler) GetAllSubIDRanges(c *gin.Context) {
+	blocks, err := h.services.SubID.GetSubIDRanges()
+	if err != nil {
+		h.logger.Errorf("Failed to get subordinate IDs: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get subordinate IDs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, blocks)
+}
+
+// GetSubIDRange handles GET /api/subids/:account_id
+func (h *Handler) GetSubIDRange(c *gin.Context) {
+	accountID, ok := idParam(c, "account_id", "account")
+	if !ok {
+		return
+	}
+
+	block, err := h.services.SubID.GetSubIDRange(accountID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, block)
+}
+
+// ExportSubIDs handles GET /api/subids/subuid and /api/subids/subgid; both
+// files hold the same blocks
+func (h *Handler) ExportSubIDs(c *gin.Context) {
+	data, err := h.services.SubID.ExportSubIDs()
+	if err != nil {
+		h.logger.Errorf("Failed to export subordinate IDs: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export subordinate IDs"})
+		return
+	}
+
+	c.Data(http.StatusOK, "text/plain; charset=utf-8", data)
+}
+
+// AllocateSubIDs handles POST /api/subids
+func (h *Handler) AllocateSubIDs(c *gin.Context) {
+	// Parse input; an empty body allocates to every account without a block
+	var input subIDInput
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	// Get user info for audit
+	userID := c.GetUint("userID")
+	username := c.GetString("username")
+	ipAddress := c.ClientIP()
+
+	// Allocate blocks
+	var blocks []models.SubIDRange
+	var err error
+	if input.AccountID != 0 {
+		var block *models.SubIDRange
+		if block, err = h.services.SubID.AllocateSubIDs(input.AccountID, userID, username, ipAddress); err == nil {
+			blocks = []models.SubIDRange{*block}
+		}
+	} else {
+		blocks, err = h.services.SubID.AllocateMissingSubIDs(userID, username, ipAddress)
+	}
+	if err != nil {
+		h.logger.Errorf("Failed to allocate subordinate IDs: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, blocks)
+}
+
+// ReleaseSubIDs handles DELETE /api/subids/:account_id
+func (h *Handler) ReleaseSubIDs(c *gin.Context) {
+	accountID, ok := idParam(c, "account_id", "account")
+	if !ok {
+		return
+	}
+
+	// Get user info for audit
+	userID := c.GetUint("userID")
+	username := c.GetString("username")
+	ipAddress := c.ClientIP()
+
+	// Release block
+	if err := h.services.SubID.ReleaseSubIDs(accountID, userID, username, ipAddress); err != nil {
+		h.logger.Errorf("Failed to release subordinate IDs: %v", err)
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Subordinate IDs released successfully"})
+}
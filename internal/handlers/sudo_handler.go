@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/home/unixify/internal/models"
+)
+
+// sudoRuleInput represents the input for sudo rule creation/update
+type sudoRuleInput struct {
+	Name        string   `json:"name" binding:"required"`
+	Description string   `json:"description"`
+	GroupID     uint     `json:"group_id"`
+	AccountID   uint     `json:"account_id"`
+	Hosts       []string `json:"hosts"`
+	RunAsUsers  []string `json:"runas_users"`
+	RunAsGroups []string `json:"runas_groups"`
+	Commands    []string `json:"commands" binding:"required"`
+	NoPasswd    bool     `json:"nopasswd"`
+}
+
+// apply copies the input onto a sudo rule
+func (input sudoRuleInput) apply(rule *models.SudoRule) {
+	rule.Name = input.Name
+	rule.Description = input.Description
+	rule.GroupID = input.GroupID
+	rule.AccountID = input.AccountID
+	rule.Hosts = input.Hosts
+	rule.RunAsUsers = input.RunAsUsers
+	rule.RunAsGroups = input.RunAsGroups
+	rule.Commands = input.Commands
+	rule.NoPasswd = input.NoPasswd
+}
+
+// GetAllSudoRules handles GET /api/sudo-rules
+func (h *Handler) GetAllSudoRules(c *gin.Context) {
+	rules, err := h.services.Sudo.GetAllSudoRules()
+	if err != nil {
+		h.logger.Errorf("Failed to get sudo rules: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get sudo rules"})
+		return
+	}
+
+	c.JSON(http.StatusOK, rules)
+}
+
+// GetSudoRule handles GET /api/sudo-rules/:id
+func (h *Handler) GetSudoRule(c *gin.Context) {
+	id, ok := idParam(c, "id", "sudo rule")
+	if !ok {
+		return
+	}
+
+	// Get rule
+	rule, err := h.services.Sudo.GetSudoRule(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, rule)
+}
+
+// ExportSudoRules handles GET /api/sudo-rules/export?format=sudoers|ldif.
+// The ldif format takes the parent entry of the rules in base_dn.
+func (h *Handler) ExportSudoRules(c *gin.Context) {
+	var data []byte
+	var err error
+	switch c.DefaultQuery("format", "sudoers") {
+	case "sudoers":
+		data, err = h.services.Sudo.ExportSudoersFile()
+	case "ldif":
+		data, err = h.services.Sudo.ExportSudoLDIF(c.Query("base_dn"))
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid format, use sudoers or ldif"})
+		return
+	}
+	if err != nil {
+		h.logger.Errorf("Failed to export sudo rules: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export sudo rules"})
+		return
+	}
+
+	c.Data(http.StatusOK, "text/plain; charset=utf-8", data)
+}
+
+// ExportSudoRule handles GET /api/sudo-rules/:id/sudoers, the rule's own
+// sudoers.d file
+func (h *Handler) ExportSudoRule(c *gin.Context) {
+	id, ok := idParam(c, "id", "sudo rule")
+	if !ok {
+		return
+	}
+
+	// Make sure the rule exists
+	if _, err := h.services.Sudo.GetSudoRule(id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Export rule
+	data, err := h.services.Sudo.ExportSudoersRule(id)
+	if err != nil {
+		h.logger.Errorf("Failed to export sudo rule: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export sudo rule"})
+		return
+	}
+
+	c.Data(http.StatusOK, "text/plain; charset=utf-8", data)
+}
+
+// CreateSudoRule handles POST /api/sudo-rules
+func (h *Handler) CreateSudoRule(c *gin.Context) {
+	// Parse input
+	var input sudoRuleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Get user info for audit
+	userID := c.GetUint("userID")
+	username := c.GetString("username")
+	ipAddress := c.ClientIP()
+
+	// Create rule
+	rule := &models.SudoRule{}
+	input.apply(rule)
+	if err := h.services.Sudo.CreateSudoRule(rule, userID, username, ipAddress); err != nil {
+		h.logger.Errorf("Failed to create sudo rule: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, rule)
+}
+
+// UpdateSudoRule handles PUT /api/sudo-rules/:id
+func (h *Handler) UpdateSudoRule(c *gin.Context) {
+	id, ok := idParam(c, "id", "sudo rule")
+	if !ok {
+		return
+	}
+
+	// Get existing rule
+	rule, err := h.services.Sudo.GetSudoRule(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Parse input
+	var input sudoRuleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	input.apply(rule)
+
+	// Get user info for audit
+	userID := c.GetUint("userID")
+	username := c.GetString("username")
+	ipAddress := c.ClientIP()
+
+	// Update rule
+	if err := h.services.Sudo.UpdateSudoRule(rule, userID, username, ipAddress); err != nil {
+		h.logger.Errorf("Failed to update sudo rule: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, rule)
+}
+
+// DeleteSudoRule handles DELETE /api/sudo-rules/:id
+func (h *Handler) DeleteSudoRule(c *gin.Context) {
+	id, ok := idParam(c, "id", "sudo rule")
+	if !ok {
+		return
+	}
+
+	// Get user info for audit
+	userID := c.GetUint("userID")
+	username := c.GetString("username")
+	ipAddress := c.ClientIP()
+
+	// Delete rule
+	if err := h.services.Sudo.DeleteSudoRule(id, userID, username, ipAddress); err != nil {
+		h.logger.Errorf("Failed to delete sudo rule: %v", err)
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Sudo rule deleted successfully"})
+}
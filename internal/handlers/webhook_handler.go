@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/home/unixify/internal/models"
+)
+
+// webhookInput represents the input for webhook creation/update
+type webhookInput struct {
+	Name       string   `json:"name" binding:"required"`
+	URL        string   `json:"url" binding:"required"`
+	Secret     string   `json:"secret"`      // Generated on create and kept on update when empty
+	EventTypes []string `json:"event_types"` // Empty subscribes to all events
+	Active     *bool    `json:"active"`      // Defaults to true on create and is kept on update when omitted
+}
+
+// webhookWithSecret is returned once when a webhook is created or its secret changes
+type webhookWithSecret struct {
+	*models.Webhook
+	Secret string `json:"secret"`
+}
+
+// GetAllWebhooks handles GET /api/webhooks
+func (h *Handler) GetAllWebhooks(c *gin.Context) {
+	webhooks, err := h.services.Webhook.GetAllWebhooks()
+	if err != nil {
+		h.logger.Errorf("Failed to get webhooks: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get webhooks"})
+		return
+	}
+
+	c.JSON(http.StatusOK, webhooks)
+}
+
+// GetWebhook handles GET /api/webhooks/:id
+func (h *Handler) GetWebhook(c *gin.Context) {
+	// Parse webhook ID
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID"})
+		return
+	}
+
+	// Get webhook
+	webhook, err := h.services.Webhook.GetWebhook(uint(id))
+	if err != nil {
+		h.logger.Errorf("Failed to get webhook: %v", err)
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, webhook)
+}
+
+// CreateWebhook handles POST /api/webhooks
+func (h *Handler) CreateWebhook(c *gin.Context) {
+	// Parse input
+	var input webhookInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Get user info for audit
+	userID := c.GetUint("userID")
+	username := c.GetString("username")
+	ipAddress := c.ClientIP()
+
+	// Create webhook
+	webhook := &models.Webhook{
+		Name:       input.Name,
+		URL:        input.URL,
+		Secret:     input.Secret,
+		EventTypes: input.EventTypes,
+		Active:     input.Active == nil || *input.Active,
+		CreatedBy:  username,
+	}
+	err := h.services.Webhook.CreateWebhook(webhook, userID, username, ipAddress)
+	if err != nil {
+		h.logger.Errorf("Failed to create webhook: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, webhookWithSecret{Webhook: webhook, Secret: webhook.Secret})
+}
+
+// UpdateWebhook handles PUT /api/webhooks/:id
+func (h *Handler) UpdateWebhook(c *gin.Context) {
+	// Parse webhook ID
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID"})
+		return
+	}
+
+	// Get existing webhook
+	webhook, err := h.services.Webhook.GetWebhook(uint(id))
+	if err != nil {
+		h.logger.Errorf("Failed to get webhook for update: %v", err)
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Parse input
+	var input webhookInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Update webhook fields
+	webhook.Name = input.Name
+	webhook.URL = input.URL
+	webhook.EventTypes = input.EventTypes
+	if input.Active != nil {
+		webhook.Active = *input.Active
+	}
+	if input.Secret != "" {
+		webhook.Secret = input.Secret
+	}
+
+	// Get user info for audit
+	userID := c.GetUint("userID")
+	username := c.GetString("username")
+	ipAddress := c.ClientIP()
+
+	// Update webhook
+	err = h.services.Webhook.UpdateWebhook(webhook, userID, username, ipAddress)
+	if err != nil {
+		h.logger.Errorf("Failed to update webhook: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if input.Secret != "" {
+		c.JSON(http.StatusOK, webhookWithSecret{Webhook: webhook, Secret: webhook.Secret})
+		return
+	}
+	c.JSON(http.StatusOK, webhook)
+}
+
+// DeleteWebhook handles DELETE /api/webhooks/:id
+func (h *Handler) DeleteWebhook(c *gin.Context) {
+	// Parse webhook ID
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID"})
+		return
+	}
+
+	// Get user info for audit
+	userID := c.GetUint("userID")
+	username := c.GetString("username")
+	ipAddress := c.ClientIP()
+
+	// Delete webhook
+	err = h.services.Webhook.DeleteWebhook(uint(id), userID, username, ipAddress)
+	if err != nil {
+		h.logger.Errorf("Failed to delete webhook: %v", err)
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted successfully"})
+}
+
+// GetWebhookDeliveries handles GET /api/webhooks/:id/deliveries
+func (h *Handler) GetWebhookDeliveries(c *gin.Context) {
+	// Parse webhook ID
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID"})
+		return
+	}
+
+	// Make sure the webhook exists
+	if _, err := h.services.Webhook.GetWebhook(uint(id)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Parse limit, newest deliveries first
+	limit := 100
+	if limitStr := c.Query("limit"); limitStr != "" {
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return
+		}
+	}
+
+	// Get deliveries
+	deliveries, err := h.services.Webhook.GetDeliveries(uint(id), c.Query("status"), limit)
+	if err != nil {
+		h.logger.Errorf("Failed to get webhook deliveries: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, deliveries)
+}
@@ -0,0 +1,69 @@
+// Package idrange parses and matches the UID and GID ranges the host agent
+// and drift reports treat as managed by the registry
+package idrange
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Range is an inclusive range of UIDs or GIDs
+type Range struct {
+	Start int
+	End   int
+}
+
+// Ranges are a set of UID or GID ranges
+type Ranges []Range
+
+// Parse parses a comma-separated list such as 1000-60000,70000-79999.
+// A single number is a range of one ID. ID 0 can never be managed.
+func Parse(spec string) (Ranges, error) {
+	var ranges Ranges
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		startStr, endStr, isRange := strings.Cut(part, "-")
+		if !isRange {
+			endStr = startStr
+		}
+		start, err := strconv.Atoi(strings.TrimSpace(startStr))
+		if err != nil {
+			return nil, fmt.Errorf("invalid range %q", part)
+		}
+		end, err := strconv.Atoi(strings.TrimSpace(endStr))
+		if err != nil {
+			return nil, fmt.Errorf("invalid range %q", part)
+		}
+		if start < 1 || end < start {
+			return nil, fmt.Errorf("invalid range %q: IDs must be positive and in order", part)
+		}
+		ranges = append(ranges, Range{Start: start, End: end})
+	}
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("no ID ranges given")
+	}
+	return ranges, nil
+}
+
+// Contains reports whether id lies in one of the ranges
+func (r Ranges) Contains(id int) bool {
+	for _, idRange := range r {
+		if id >= idRange.Start && id <= idRange.End {
+			return true
+		}
+	}
+	return false
+}
+
+// String formats the ranges the way Parse reads them
+func (r Ranges) String() string {
+	parts := make([]string, 0, len(r))
+	for _, idRange := range r {
+		parts = append(parts, fmt.Sprintf("%d-%d", idRange.Start, idRange.End))
+	}
+	return strings.Join(parts, ",")
+}
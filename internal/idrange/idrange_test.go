@@ -0,0 +1,18 @@
+package idrange
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	ranges, err := Parse("1000-60000, 70000-79999,65534")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if ranges.String() != "1000-60000,70000-79999,65534-65534" || !ranges.Contains(65534) || ranges.Contains(999) {
+		t.Errorf("Parse = %s", ranges)
+	}
+	for _, spec := range []string{"", "0-999", "10-5", "a-b"} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Parse(%q) accepted", spec)
+		}
+	}
+}
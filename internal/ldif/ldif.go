@@ -0,0 +1,91 @@
+// Package ldif writes LDAP Data Interchange Format (RFC 2849) files, for
+// exports that are loaded into a directory server with ldapadd
+package ldif
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Entry is one LDAP entry
+type Entry struct {
+	DN         string
+	Attributes []Attribute
+}
+
+// Attribute is one value of an entry attribute; multi-valued attributes
+// appear once per value
+type Attribute struct {
+	Name  string
+	Value string
+}
+
+// Add appends values of an attribute to the entry
+func (e *Entry) Add(name string, values ...string) {
+	for _, value := range values {
+		e.Attributes = append(e.Attributes, Attribute{Name: name, Value: value})
+	}
+}
+
+// Write writes the entries separated by blank lines, base64-encoding values
+// that are not safe as plain text
+func Write(w io.Writer, entries []Entry) error {
+	if _, err := fmt.Fprintln(w, "version: 1"); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if _, err := fmt.Fprintf(w, "\n%s\n", line("dn", entry.DN)); err != nil {
+			return err
+		}
+		for _, attribute := range entry.Attributes {
+			if _, err := fmt.Fprintln(w, line(attribute.Name, attribute.Value)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// line formats one attribute line
+func line(name, value string) string {
+	if safe(value) {
+		return name + ": " + value
+	}
+	return name + ":: " + base64.StdEncoding.EncodeToString([]byte(value))
+}
+
+// safe reports whether a value is a SAFE-STRING in RFC 2849 terms and has no
+// trailing space
+func safe(value string) bool {
+	if value == "" {
+		return true
+	}
+	if strings.ContainsAny(value[:1], " :<") || strings.HasSuffix(value, " ") {
+		return false
+	}
+	for i := 0; i < len(value); i++ {
+		if c := value[i]; c == 0 || c == '\n' || c == '\r' || c > 127 {
+			return false
+		}
+	}
+	return true
+}
+
+// EscapeDN escapes a value for use in a distinguished name (RFC 4514)
+func EscapeDN(value string) string {
+	var b strings.Builder
+	for i, c := range value {
+		switch {
+		case strings.ContainsRune(`,+"\<>;=`, c):
+			b.WriteRune('\\')
+		case (c == ' ' || c == '#') && i == 0:
+			b.WriteRune('\\')
+		case c == ' ' && i == len(value)-1:
+			b.WriteRune('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
@@ -31,7 +31,7 @@ func NewMailer() *Mailer {
 func (m *Mailer) SendEmail(to []string, subject, body string) error {
 	// Set up authentication information if credentials are provided
 	var auth smtp.Auth
-	if m.Username \!= "" && m.Password \!= "" {
+	if m.Username != "" && m.Password != "" {
 		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
 	}
 
@@ -46,7 +46,7 @@ func (m *Mailer) SendEmail(to []string, subject, body string) error {
 
 	addr := fmt.Sprintf("%s:%s", m.Host, m.Port)
 	
-	if err := smtp.SendMail(addr, auth, m.From, to, msg); err \!= nil {
+	if err := smtp.SendMail(addr, auth, m.From, to, msg); err != nil {
 		log.Printf("Error sending email: %v", err)
 		return err
 	}
@@ -62,7 +62,7 @@ func (m *Mailer) SendVerificationEmail(to, username, token string) error {
 	// In a real app, this would be a link to your verification endpoint
 	verificationLink := fmt.Sprintf("http://localhost:8080/verify?token=%s", token)
 	
-	body := fmt.Sprintf("<html><body><h2>Welcome to Unixify, %s\!</h2><p>Please verify your account by clicking the link below:</p><p><a href=\"%s\">Verify Account</a></p><p>If you didn't create this account, you can safely ignore this email.</p><p>The Unixify Team</p></body></html>", username, verificationLink)
+	body := fmt.Sprintf("<html><body><h2>Welcome to Unixify, %s!</h2><p>Please verify your account by clicking the link below:</p><p><a href=\"%s\">Verify Account</a></p><p>If you didn't create this account, you can safely ignore this email.</p><p>The Unixify Team</p></body></html>", username, verificationLink)
 	
 	return m.SendEmail([]string{to}, subject, body)
 }
@@ -81,9 +81,9 @@ func (m *Mailer) SendPasswordResetEmail(to, username, token string) error {
 
 // SendWelcomeEmail sends a welcome email to a new user
 func (m *Mailer) SendWelcomeEmail(to, username string) error {
-	subject := "Welcome to Unixify\!"
+	subject := "Welcome to Unixify!"
 	
-	body := fmt.Sprintf("<html><body><h2>Welcome to Unixify, %s\!</h2><p>Thank you for registering an account with us.</p><p>You can now manage your UNIX accounts and groups with our comprehensive interface.</p><p>If you have any questions, please don't hesitate to contact us.</p><p>The Unixify Team</p></body></html>", username)
+	body := fmt.Sprintf("<html><body><h2>Welcome to Unixify, %s!</h2><p>Thank you for registering an account with us.</p><p>You can now manage your UNIX accounts and groups with our comprehensive interface.</p><p>If you have any questions, please don't hesitate to contact us.</p><p>The Unixify Team</p></body></html>", username)
 	
 	return m.SendEmail([]string{to}, subject, body)
 }
@@ -36,8 +36,10 @@ type Account struct {
 	PrimaryGroupID uint        `json:"primary_group_id" gorm:"index"`
 	PrimaryGroup   *Group      `json:"primary_group" gorm:"-"` // Ignore this field for GORM but keep in JSON
 	Active         bool        `json:"active" gorm:"default:true"`
-	Firstname      string      `json:"firstname"` // First name of the account owner
-	Surname        string      `json:"surname"`   // Last name/surname of the account owner
+	Firstname      string      `json:"firstname"`  // First name of the account owner
+	Surname        string      `json:"surname"`    // Last name/surname of the account owner
+	Version        int         `json:"version"`    // Incremented on every update; exposed as the ETag
+	ChangeSeq      int64       `json:"change_seq"` // Sequence number of the last change, see ChangeSet
 }
 
 // Group represents a UNIX group
@@ -52,6 +54,8 @@ type Group struct {
 	Description string    `json:"description"`
 	Active      bool      `json:"active" gorm:"default:true"`
 	CreatedBy   string    `json:"created_by"` // Username of the person who created this group
+	Version     int       `json:"version"`    // Incremented on every update; exposed as the ETag
+	ChangeSeq   int64     `json:"change_seq"` // Sequence number of the last change, see ChangeSet
 }
 
 // Membership represents the association between accounts and groups
@@ -69,6 +73,7 @@ type AccountGroup struct {
 	CreatedAt time.Time `json:"created_at"`
 	AccountID uint      `json:"account_id" gorm:"index"`
 	GroupID   uint      `json:"group_id" gorm:"index"`
+	ChangeSeq int64     `json:"change_seq"` // Sequence number of the change that created it
 }
 
 // AuditEntry represents an audit log entry
@@ -98,25 +103,12 @@ type User struct {
 	Role        string    `json:"role"`
 	TOTPEnabled bool      `json:"totp_enabled"`
 	TOTPSecret  string    `json:"-"` // Store securely, never expose in JSON
+	TOTPLastStep int64    `json:"-"` // Time step of the last TOTP code used, which cannot be used again
+	Active      bool      `json:"active" gorm:"default:true"` // Disabled users cannot log in
 	LastLogin   time.Time `json:"last_login"`
-}
-
-// RegisteredUser represents a registered user with enhanced security
-type RegisteredUser struct {
-	ID           uint      `json:"id" gorm:"primaryKey" sql:"AUTO_INCREMENT"`
-	Username     string    `json:"username" gorm:"unique;not null"`
-	Email        string    `json:"email" gorm:"unique;not null"`
-	PasswordHash []byte    `json:"-" gorm:"column:password_hash;not null"` // Stored encrypted, never expose in JSON
-	FirstName    string    `json:"first_name" gorm:"not null"`
-	LastName     string    `json:"last_name" gorm:"not null"`
-	Department   string    `json:"department"`
-	Role         string    `json:"role" gorm:"not null;default:'user'"`
-	TOTPEnabled  bool      `json:"totp_enabled" gorm:"default:false"`
-	TOTPSecret   string    `json:"-" gorm:"column:totp_secret"` // Store securely, never expose in JSON
-	IsActive     bool      `json:"is_active" gorm:"default:true"`
-	LastLogin    time.Time `json:"last_login"`
-	CreatedAt    time.Time `json:"created_at" gorm:"autoCreateTime"`
-	UpdatedAt    time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+	FirstName   string    `json:"first_name"`
+	LastName    string    `json:"last_name"`
+	Department  string    `json:"department"`
 }
 
 // LoginRequest represents a user login request
@@ -130,8 +122,8 @@ type RegisterUserRequest struct {
 	Username    string `json:"username" binding:"required,min=3,max=50"`
 	Email       string `json:"email" binding:"required,email"`
 	Password    string `json:"password" binding:"required,min=8"`
-	FirstName   string `json:"firstName" binding:"required"`
-	LastName    string `json:"lastName" binding:"required"`
+	FirstName   string `json:"firstName"`
+	LastName    string `json:"lastName"`
 	Department  string `json:"department"`
 }
 
@@ -149,6 +141,8 @@ type TOTPVerifyRequest struct {
 // AuthResponse is the response after successful authentication
 type AuthResponse struct {
 	Token       string `json:"token"`
+	RefreshToken string `json:"refresh_token,omitempty"` // Exchanged at /api/auth/refresh for new tokens
+	ExpiresIn    int    `json:"expires_in,omitempty"`    // Seconds until Token expires
 	RequiresTOTP bool   `json:"requires_totp,omitempty"`
 	User        UserResponse `json:"user"`
 }
@@ -160,4 +154,366 @@ type UserResponse struct {
 	Email       string `json:"email"`
 	Role        string `json:"role"`
 	TOTPEnabled bool   `json:"totp_enabled"`
-}
\ No newline at end of file
+}
+
+// Reservation kinds
+const (
+	ReservationKindUID = "uid"
+	ReservationKindGID = "gid"
+)
+
+// Reservation represents a UID or GID range that is held back from allocation
+type Reservation struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Name        string    `json:"name" gorm:"unique"`
+	Kind        string    `json:"kind" gorm:"index"` // uid or gid
+	Start       int       `json:"start"`
+	End         int       `json:"end"`
+	Description string    `json:"description"`
+}
+
+// Tombstone kinds
+const (
+	TombstoneAccount    = "account"
+	TombstoneGroup      = "group"
+	TombstoneMembership = "membership"
+)
+
+// Tombstone records the deletion of an account, group or membership for the change feed
+type Tombstone struct {
+	ID        uint      `json:"-" gorm:"primaryKey"`
+	ChangeSeq int64     `json:"change_seq"`
+	CreatedAt time.Time `json:"deleted_at"`
+	Kind      string    `json:"kind"`                 // account, group or membership
+	EntityID  uint      `json:"id"`                   // ID of the deleted record
+	Name      string    `json:"name,omitempty"`       // Username or groupname
+	AccountID uint      `json:"account_id,omitempty"` // Set for memberships
+	GroupID   uint      `json:"group_id,omitempty"`   // Set for memberships
+}
+
+// ChangeSet is one page of the change feed: the current state of everything
+// changed after Since, up to and including Sequence
+type ChangeSet struct {
+	Since       int64          `json:"since"`
+	Sequence    int64          `json:"sequence"` // Pass as since to fetch the next page
+	More        bool           `json:"more"`     // Further changes are waiting
+	Accounts    []Account      `json:"accounts"`
+	Groups      []Group        `json:"groups"`
+	Memberships []AccountGroup `json:"memberships"`
+	Tombstones  []Tombstone    `json:"tombstones"`
+}
+
+// Registry change event types
+const (
+	EventAccountCreated    = "account.created"
+	EventAccountUpdated    = "account.updated"
+	EventAccountDeleted    = "account.deleted"
+	EventGroupCreated      = "group.created"
+	EventGroupUpdated      = "group.updated"
+	EventGroupDeleted      = "group.deleted"
+	EventMembershipAdded   = "membership.added"
+	EventMembershipRemoved = "membership.removed"
+	EventSudoRuleCreated   = "sudo_rule.created"
+	EventSudoRuleUpdated   = "sudo_rule.updated"
+	EventSudoRuleDeleted   = "sudo_rule.deleted"
+)
+
+// EventTypes lists every registry change event type
+var EventTypes = []string{
+	EventAccountCreated, EventAccountUpdated, EventAccountDeleted,
+	EventGroupCreated, EventGroupUpdated, EventGroupDeleted,
+	EventMembershipAdded, EventMembershipRemoved,
+	EventSudoRuleCreated, EventSudoRuleUpdated, EventSudoRuleDeleted,
+}
+
+// Event describes a single registry change; it is the body of webhook deliveries
+type Event struct {
+	ID         uint        `json:"id"` // ID of the audit entry recorded for the change
+	Type       string      `json:"type"`
+	Timestamp  time.Time   `json:"timestamp"`
+	EntityType string      `json:"entity_type"`
+	EntityID   uint        `json:"entity_id"`
+	Section    string      `json:"section"` // Account or group type the change belongs to
+	Actor      EventActor  `json:"actor"`
+	Before     interface{} `json:"before,omitempty"` // State before the change, absent for creations
+	After      interface{} `json:"after,omitempty"`  // State after the change, absent for deletions
+}
+
+// EventRecord is an event kept in the event log for streaming and replay
+type EventRecord struct {
+	ID        uint      `json:"id" gorm:"primaryKey;autoIncrement:false"` // Same as Event.ID
+	CreatedAt time.Time `json:"created_at"`
+	Type      string    `json:"type"`
+	Section   string    `json:"section"`
+	Payload   string    `json:"payload"` // The event encoded as JSON
+}
+
+// EventActor identifies who made a change
+type EventActor struct {
+	UserID    uint   `json:"user_id"`
+	Username  string `json:"username"`
+	IPAddress string `json:"ip_address"`
+}
+
+// EventMembership is the state carried by membership events
+type EventMembership struct {
+	AccountID uint   `json:"account_id"`
+	Username  string `json:"username"`
+	GroupID   uint   `json:"group_id"`
+	Groupname string `json:"groupname"`
+}
+
+// Webhook delivery states
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// Webhook is a subscription that receives registry change events over HTTP
+type Webhook struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	Name       string    `json:"name"`
+	URL        string    `json:"url"`
+	Secret     string    `json:"-"`                                  // HMAC-SHA256 key for payload signatures, never exposed in JSON
+	EventTypes []string  `json:"event_types" gorm:"serializer:json"` // Event types or prefixes like account.*; empty means all
+	Active     bool      `json:"active"`
+	CreatedBy  string    `json:"created_by"`
+}
+
+// WebhookDelivery is one event queued for, or sent to, a webhook
+type WebhookDelivery struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	WebhookID     uint       `json:"webhook_id" gorm:"index"`
+	EventID       uint       `json:"event_id"`
+	EventType     string     `json:"event_type"`
+	Payload       string     `json:"payload"`
+	Status        string     `json:"status"`   // pending, delivered or failed
+	Attempts      int        `json:"attempts"` // Attempts started so far
+	NextAttemptAt time.Time  `json:"next_attempt_at"`
+	ResponseCode  int        `json:"response_code"`
+	LastError     string     `json:"last_error"`
+	DeliveredAt   *time.Time `json:"delivered_at"`
+}
+
+// Drift kinds reported by host agents
+const (
+	DriftUnmanaged = "unmanaged" // Local entry in a managed range that the registry does not provide; kept
+	DriftModified  = "modified"  // Entry written by the agent was changed locally; restored
+	DriftMissing   = "missing"   // Entry written by the agent was removed locally; restored
+	DriftConflict  = "conflict"  // Registry entry clashes with a local entry by name or ID; not written
+)
+
+// DriftFinding is one difference between a host's files and the registry
+type DriftFinding struct {
+	Kind    string `json:"kind"`
+	File    string `json:"file"` // passwd or group
+	Name    string `json:"name"`
+	ID      int    `json:"id"` // UID or GID
+	Message string `json:"message"`
+}
+
+// HostReport is sent by a host agent after each sync
+type HostReport struct {
+	ID        uint           `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time      `json:"created_at"`
+	Hostname  string         `json:"hostname" gorm:"index"`
+	Sequence  int64          `json:"sequence"` // Change feed sequence the host's files reflect
+	Offline   bool           `json:"offline"`  // The agent could not reach the server and used its cache
+	Accounts  int            `json:"accounts"` // Managed accounts on the host
+	Groups    int            `json:"groups"`   // Managed groups on the host
+	Drift     []DriftFinding `json:"drift" gorm:"serializer:json"`
+}
+
+// Host is a machine that reads the registry. It authenticates with a host
+// token, which is only shown when it is created or rotated.
+type Host struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Hostname    string    `json:"hostname" gorm:"unique"`
+	Description string    `json:"description"`
+	TokenHash   string    `json:"-" gorm:"unique"` // SHA-256 of the host token, never exposed in JSON
+}
+
+// HostGroup is a set of hosts that access rules apply to
+type HostGroup struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Name        string    `json:"name" gorm:"unique"`
+	Description string    `json:"description"`
+}
+
+// HostGroupMember puts a host in a host group
+type HostGroupMember struct {
+	ID          uint `json:"id" gorm:"primaryKey"`
+	HostGroupID uint `json:"host_group_id" gorm:"index"`
+	HostID      uint `json:"host_id" gorm:"index"`
+}
+
+// AccessRule allows the members of a group, or a single account, on the hosts
+// of a host group. Exactly one of GroupID and AccountID is set.
+type AccessRule struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt   time.Time `json:"created_at"`
+	HostGroupID uint      `json:"host_group_id" gorm:"index"`
+	GroupID     uint      `json:"group_id,omitempty"`
+	AccountID   uint      `json:"account_id,omitempty"`
+}
+
+// HostAccess is the part of the registry a host may see: the accounts its
+// access rules allow, the groups they name and the primary groups of those
+// accounts, and the memberships between them
+type HostAccess struct {
+	Hostname    string         `json:"hostname"`
+	Accounts    []Account      `json:"accounts"`
+	Groups      []Group        `json:"groups"`
+	Memberships []AccountGroup `json:"memberships"`
+}
+
+// NetgroupTriple is a (host,user,domain) member of a netgroup. An empty field
+// matches anything and "-" matches nothing, as in /etc/netgroup.
+type NetgroupTriple struct {
+	Host   string `json:"host"`
+	User   string `json:"user"` // Empty, "-" or the username of an account
+	Domain string `json:"domain"`
+}
+
+// Netgroup is a NIS netgroup, used by NFS exports and PAM access rules. Its
+// members are triples and other netgroups, named in Netgroups.
+type Netgroup struct {
+	ID          uint             `json:"id" gorm:"primaryKey"`
+	CreatedAt   time.Time        `json:"created_at"`
+	UpdatedAt   time.Time        `json:"updated_at"`
+	Name        string           `json:"name" gorm:"unique"`
+	Description string           `json:"description"`
+	Triples     []NetgroupTriple `json:"triples" gorm:"serializer:json"`
+	Netgroups   []string         `json:"netgroups" gorm:"serializer:json"`
+}
+
+// SudoRule grants the members of a group, or a single account, the right to
+// run commands with sudo. Exactly one of GroupID and AccountID is set.
+type SudoRule struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Name        string    `json:"name" gorm:"unique"` // File name in sudoers.d and cn of the sudoRole
+	Description string    `json:"description"`
+	GroupID     uint      `json:"group_id,omitempty"`
+	AccountID   uint      `json:"account_id,omitempty"`
+	Hosts       []string  `json:"hosts" gorm:"serializer:json"`        // Host names, addresses or +netgroups; empty means ALL
+	RunAsUsers  []string  `json:"runas_users" gorm:"serializer:json"`  // Empty means root
+	RunAsGroups []string  `json:"runas_groups" gorm:"serializer:json"` // Empty means the target user's group
+	Commands    []string  `json:"commands" gorm:"serializer:json"`     // Absolute paths with arguments, or ALL
+	NoPasswd    bool      `json:"nopasswd"`
+}
+
+// SubIDRange is the block of subordinate UIDs and GIDs of a people account,
+// written to /etc/subuid and /etc/subgid for rootless containers
+type SubIDRange struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"created_at"`
+	AccountID uint      `json:"account_id" gorm:"unique"`
+	Start     int       `json:"start" gorm:"unique"` // First subordinate ID
+	Count     int       `json:"count"`
+}
+
+// Search result kinds
+const (
+	SearchKindAccount = "account"
+	SearchKindGroup   = "group"
+)
+
+// SearchResult is an account or group found by a search, with the field that
+// matched best and how well it matched
+type SearchResult struct {
+	Kind    string   `json:"kind"`    // account or group
+	ID      uint     `json:"id"`      // ID of the account or group
+	Name    string   `json:"name"`    // Username or groupname
+	UnixID  int      `json:"unix_id"` // UID or GID
+	Type    string   `json:"type"`
+	Field   string   `json:"field"` // Field that matched best, such as username or description
+	Score   float64  `json:"score"` // 1 for an exact match, lower for weaker ones
+	Account *Account `json:"account,omitempty"`
+	Group   *Group   `json:"group,omitempty"`
+}
+
+// Session is a login of a user. Its refresh token is replaced on every
+// refresh, and its access tokens stop working once it is revoked.
+type Session struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"` // Last refresh
+	UserID     uint       `json:"user_id" gorm:"index"`
+	TokenKey   string     `json:"-" gorm:"unique"` // Identifies the session in its refresh tokens
+	SecretHash string     `json:"-"`               // SHA-256 of the secret of the current refresh token
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	ClientIP   string     `json:"client_ip"`
+	UserAgent  string     `json:"user_agent"`
+}
+
+// Kinds of login attempt counters
+const (
+	LoginAttemptUsername = "username"
+	LoginAttemptIP       = "ip"
+)
+
+// LoginAttempt counts the recent failed logins for a username or from a
+// client IP address. After each failure logins are refused until
+// LockedUntil, which grows with every failure.
+type LoginAttempt struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	Kind          string    `json:"kind" gorm:"uniqueIndex:idx_login_attempts_subject"` // username or ip
+	Subject       string    `json:"subject" gorm:"uniqueIndex:idx_login_attempts_subject"`
+	Failures      int       `json:"failures"`
+	LastFailureAt time.Time `json:"last_failure_at"`
+	LockedUntil   time.Time `json:"locked_until"`
+}
+
+// TOTPChallenge is a login that passed the password check and waits for a
+// TOTP code. Its token is only accepted by POST /api/auth/verify-totp.
+type TOTPChallenge struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"created_at"`
+	UserID    uint      `json:"user_id"`
+	TokenHash string    `json:"-" gorm:"unique"` // SHA-256 of the token
+	Attempts  int       `json:"attempts"`        // Codes tried with the token
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// TOTPRecoveryCode is a one-time code a user can give instead of a TOTP
+// code, such as after losing their authenticator app
+type TOTPRecoveryCode struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time  `json:"created_at"`
+	UserID    uint       `json:"user_id" gorm:"index"`
+	CodeHash  string     `json:"-" gorm:"unique"` // SHA-256 of the code
+	UsedAt    *time.Time `json:"used_at"`         // nil until the code is used
+}
+
+// What a saved search runs against
+const (
+	SavedSearchAccounts = "accounts" // like GET /api/search/accounts
+	SavedSearchGroups   = "groups"   // like GET /api/search/groups
+	SavedSearchAll      = "all"      // like GET /api/search
+)
+
+// SavedSearch is a query in the query language that a user stored under a
+// name, to run again later. Each user has their own.
+type SavedSearch struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	UserID    uint      `json:"user_id" gorm:"index"` // The owner
+	Name      string    `json:"name"`                 // Unique per user
+	Kind      string    `json:"kind"`                 // accounts, groups or all
+	Query     string    `json:"query"`
+}
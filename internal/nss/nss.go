@@ -0,0 +1,138 @@
+// Package nss renders registry accounts and groups as passwd and group
+// entries. The server uses it for host exports and NSS lookups, and the host
+// agent for the lines it writes, so both agree on every field.
+package nss
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/home/unixify/internal/models"
+)
+
+// Defaults for the fields the registry does not store
+const (
+	DefaultHome          = "/home"
+	DefaultShell         = "/bin/bash"
+	DefaultInactiveShell = "/usr/sbin/nologin"
+	DefaultGID           = 100
+)
+
+// Options fill in the passwd fields the registry does not store
+type Options struct {
+	Home          string // Parent directory of home directories
+	Shell         string // Login shell of active accounts
+	InactiveShell string // Login shell of inactive accounts
+	DefaultGID    int    // Primary GID of accounts without a primary group
+}
+
+// DefaultOptions returns the options used when nothing is configured
+func DefaultOptions() Options {
+	return Options{
+		Home:          DefaultHome,
+		Shell:         DefaultShell,
+		InactiveShell: DefaultInactiveShell,
+		DefaultGID:    DefaultGID,
+	}
+}
+
+// PasswdEntry is one line of a passwd file
+type PasswdEntry struct {
+	Name  string `json:"name"`
+	UID   int    `json:"uid"`
+	GID   int    `json:"gid"`
+	Gecos string `json:"gecos"`
+	Dir   string `json:"dir"`
+	Shell string `json:"shell"`
+}
+
+// String formats the entry as a passwd line
+func (e PasswdEntry) String() string {
+	return fmt.Sprintf("%s:x:%d:%d:%s:%s:%s", e.Name, e.UID, e.GID, e.Gecos, e.Dir, e.Shell)
+}
+
+// GroupEntry is one line of a group file
+type GroupEntry struct {
+	Name    string   `json:"name"`
+	GID     int      `json:"gid"`
+	Members []string `json:"members"`
+}
+
+// String formats the entry as a group line
+func (e GroupEntry) String() string {
+	return fmt.Sprintf("%s:x:%d:%s", e.Name, e.GID, strings.Join(e.Members, ","))
+}
+
+// Passwd returns the passwd entry of an account; groups is used to look up
+// its primary GID
+func (o Options) Passwd(account models.Account, groups map[uint]models.Group) PasswdEntry {
+	gid := o.DefaultGID
+	if group, ok := groups[account.PrimaryGroupID]; ok {
+		gid = group.UnixGID
+	}
+	shell := o.Shell
+	if !account.Active {
+		shell = o.InactiveShell
+	}
+	gecos := strings.NewReplacer(":", " ", "\n", " ").Replace(strings.TrimSpace(account.Firstname + " " + account.Surname))
+	return PasswdEntry{
+		Name:  account.Username,
+		UID:   account.UnixUID,
+		GID:   gid,
+		Gecos: gecos,
+		Dir:   path.Join(o.Home, account.Username),
+		Shell: shell,
+	}
+}
+
+// Group returns the group entry of a group with the given member names
+func Group(group models.Group, members []string) GroupEntry {
+	sorted := append([]string{}, members...)
+	sort.Strings(sorted)
+	return GroupEntry{Name: group.Groupname, GID: group.UnixGID, Members: sorted}
+}
+
+// Build returns the passwd and group entries of the records, ordered by ID.
+// Records whose names cannot be written are left out, and groups only list
+// members that are in the passwd entries.
+func (o Options) Build(accounts []models.Account, groups []models.Group, memberships []models.AccountGroup) ([]PasswdEntry, []GroupEntry) {
+	byID := make(map[uint]models.Group, len(groups))
+	for _, group := range groups {
+		byID[group.ID] = group
+	}
+
+	passwd := []PasswdEntry{}
+	names := make(map[uint]string)
+	for _, account := range accounts {
+		if !ValidName(account.Username) {
+			continue
+		}
+		passwd = append(passwd, o.Passwd(account, byID))
+		names[account.ID] = account.Username
+	}
+	sort.Slice(passwd, func(i, j int) bool { return passwd[i].UID < passwd[j].UID })
+
+	members := make(map[uint][]string)
+	for _, membership := range memberships {
+		if name, ok := names[membership.AccountID]; ok {
+			members[membership.GroupID] = append(members[membership.GroupID], name)
+		}
+	}
+	group := []GroupEntry{}
+	for _, g := range groups {
+		if ValidName(g.Groupname) {
+			group = append(group, Group(g, members[g.ID]))
+		}
+	}
+	sort.Slice(group, func(i, j int) bool { return group[i].GID < group[j].GID })
+	return passwd, group
+}
+
+// ValidName reports whether a user or group name can be written to passwd and
+// group files without breaking their format
+func ValidName(name string) bool {
+	return name != "" && !strings.HasPrefix(name, "+") && !strings.HasPrefix(name, "-") &&
+		!strings.HasPrefix(name, "#") && !strings.ContainsAny(name, ":,\n\r\t /")
+}
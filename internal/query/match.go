@@ -0,0 +1,175 @@
+package query
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/home/unixify/internal/models"
+)
+
+// AccountRecord is an account with the groups its filters look at
+type AccountRecord struct {
+	Account      models.Account
+	PrimaryGroup *models.Group // nil without a primary group
+	Groups       []string      // Groupnames of the groups the account is a member of
+}
+
+// GroupRecord is a group with the members its filters look at
+type GroupRecord struct {
+	Group   models.Group
+	Members []string // Usernames of the members
+}
+
+// MatchAccount reports whether an account matches every term
+func (q *Query) MatchAccount(record AccountRecord) bool {
+	if q.Kinds&KindAccount == 0 {
+		return false
+	}
+	account := record.Account
+	for _, term := range q.Terms {
+		matched := term.matchAny(func(value Value) bool {
+			switch term.Field {
+			case FieldText:
+				return value.contains(account.Username, account.Firstname, account.Surname, strconv.Itoa(account.UnixUID))
+			case FieldKind:
+				return value.Text == "account"
+			case FieldID:
+				return value.compare(int(account.ID))
+			case FieldUID:
+				return value.compare(account.UnixUID)
+			case FieldGID:
+				return record.PrimaryGroup != nil && value.compare(record.PrimaryGroup.UnixGID)
+			case FieldType:
+				return value.Text == string(account.Type)
+			case FieldActive:
+				return value.Bool == account.Active
+			case FieldUsername:
+				return value.like(account.Username)
+			case FieldFirstname:
+				return value.like(account.Firstname)
+			case FieldSurname:
+				return value.like(account.Surname)
+			case FieldName:
+				return value.like(account.Firstname) || value.like(account.Surname) ||
+					value.like(strings.TrimSpace(account.Firstname+" "+account.Surname))
+			case FieldMemberOf:
+				return value.like(record.Groups...)
+			case FieldPrimaryGroup:
+				return record.PrimaryGroup != nil && value.like(record.PrimaryGroup.Groupname)
+			}
+			return false
+		})
+		if matched == term.Negate {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchGroup reports whether a group matches every term
+func (q *Query) MatchGroup(record GroupRecord) bool {
+	if q.Kinds&KindGroup == 0 {
+		return false
+	}
+	group := record.Group
+	for _, term := range q.Terms {
+		matched := term.matchAny(func(value Value) bool {
+			switch term.Field {
+			case FieldText:
+				return value.contains(group.Groupname, group.Description, strconv.Itoa(group.UnixGID))
+			case FieldKind:
+				return value.Text == "group"
+			case FieldID:
+				return value.compare(int(group.ID))
+			case FieldGID:
+				return value.compare(group.UnixGID)
+			case FieldType:
+				return value.Text == string(group.Type)
+			case FieldActive:
+				return value.Bool == group.Active
+			case FieldGroupname:
+				return value.like(group.Groupname)
+			case FieldDescription:
+				return value.like(group.Description)
+			case FieldCreatedBy:
+				return value.like(group.CreatedBy)
+			case FieldHasMember:
+				return value.like(record.Members...)
+			}
+			return false
+		})
+		if matched == term.Negate {
+			return false
+		}
+	}
+	return true
+}
+
+// matchAny reports whether any value of the term matches
+func (t Term) matchAny(match func(Value) bool) bool {
+	for _, value := range t.Values {
+		if match(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// compare compares a number with the value
+func (v Value) compare(n int) bool {
+	switch v.Op {
+	case OpGreater:
+		return n > v.Number
+	case OpAtLeast:
+		return n >= v.Number
+	case OpLess:
+		return n < v.Number
+	case OpAtMost:
+		return n <= v.Number
+	case OpRange:
+		return n >= v.Number && n <= v.High
+	}
+	return n == v.Number
+}
+
+// like reports whether any of the strings equals the value, ignoring case;
+// * in the value matches any run of characters
+func (v Value) like(candidates ...string) bool {
+	for _, candidate := range candidates {
+		if wildcard(v.Text, strings.ToLower(candidate)) {
+			return true
+		}
+	}
+	return false
+}
+
+// contains reports whether any of the strings contains the value, ignoring case
+func (v Value) contains(candidates ...string) bool {
+	for _, candidate := range candidates {
+		if wildcard("*"+v.Text+"*", strings.ToLower(candidate)) {
+			return true
+		}
+	}
+	return false
+}
+
+// wildcard matches s against a pattern in which * matches any run of
+// characters
+func wildcard(pattern, s string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == s
+	}
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(s, part)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(part):]
+	}
+	return strings.HasSuffix(s, parts[len(parts)-1])
+}
@@ -0,0 +1,239 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Parse parses a query that searches records of kinds. Fields that none of
+// kinds have, and terms that no record could match together, are errors.
+func Parse(input string, kinds Kinds) (*Query, error) {
+	p := &parser{input: input}
+	q := &Query{Kinds: kinds}
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.input) {
+			break
+		}
+		term, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+
+		// Narrow the kinds the query can match
+		field := fields[term.Field]
+		if field.Kinds&kinds == 0 {
+			return nil, &Error{Pos: term.Pos, Message: fmt.Sprintf("%s only applies to %s, not %s", term.Field, field.Kinds, kinds)}
+		}
+		narrowed := q.Kinds & field.Kinds
+		if term.Field == FieldKind {
+			var named Kinds
+			for _, value := range term.Values {
+				if value.Text == "account" {
+					named |= KindAccount
+				} else {
+					named |= KindGroup
+				}
+			}
+			if term.Negate {
+				narrowed = q.Kinds &^ named
+			} else {
+				narrowed = q.Kinds & named
+			}
+		}
+		if narrowed == 0 {
+			return nil, &Error{Pos: term.Pos, Message: fmt.Sprintf("%s cannot match: the terms before it only match %s", term.Field, q.Kinds)}
+		}
+		q.Kinds = narrowed
+		q.Terms = append(q.Terms, term)
+	}
+	return q, nil
+}
+
+// parser reads a query term by term
+type parser struct {
+	input string
+	pos   int
+}
+
+// skipSpace moves past spaces
+func (p *parser) skipSpace() {
+	for p.pos < len(p.input) && isSpace(p.input[p.pos]) {
+		p.pos++
+	}
+}
+
+// isSpace reports whether c separates terms
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// term reads a term: [-]field:value or [-]word
+func (p *parser) term() (Term, error) {
+	term := Term{Pos: p.pos}
+	if p.input[p.pos] == '-' {
+		term.Negate = true
+		p.pos++
+		if p.pos >= len(p.input) || isSpace(p.input[p.pos]) {
+			return term, &Error{Pos: term.Pos, Message: "- must be followed by a term to leave out, such as -member-of:dba"}
+		}
+	}
+
+	// A field is letters and hyphens followed by a colon
+	name, valuePos := p.fieldName()
+	if name == "" {
+		word, err := p.value()
+		if err != nil {
+			return term, err
+		}
+		term.Field = FieldText
+		term.Values = []Value{{Op: OpEqual, Text: strings.ToLower(word)}}
+		return term, nil
+	}
+
+	field, ok := fields[name]
+	if !ok || name == FieldText {
+		message := fmt.Sprintf("unknown field %q", name)
+		if suggestion := suggest(name, fieldNames()); suggestion != "" {
+			message += fmt.Sprintf(", did you mean %s?", suggestion)
+		} else {
+			message += ", use " + strings.Join(fieldNames(), ", ")
+		}
+		return term, &Error{Pos: p.pos, Message: message}
+	}
+	p.pos = valuePos
+	if p.pos >= len(p.input) || isSpace(p.input[p.pos]) {
+		return term, &Error{Pos: p.pos, Message: fmt.Sprintf("%s needs a value: %s", name, field.Help)}
+	}
+	raw, err := p.value()
+	if err != nil {
+		return term, err
+	}
+	term.Field = name
+	term.Values, err = parseValues(field, raw, valuePos)
+	return term, err
+}
+
+// fieldName returns the field name at the current position and where its
+// value starts, or "" if there is none
+func (p *parser) fieldName() (string, int) {
+	end := p.pos
+	for end < len(p.input) && (p.input[end] >= 'a' && p.input[end] <= 'z' || p.input[end] >= 'A' && p.input[end] <= 'Z' || p.input[end] == '-') {
+		end++
+	}
+	if end == p.pos || end >= len(p.input) || p.input[end] != ':' {
+		return "", 0
+	}
+	return strings.ToLower(p.input[p.pos:end]), end + 1
+}
+
+// value reads a quoted value, or one up to the next space
+func (p *parser) value() (string, error) {
+	if p.input[p.pos] == '"' {
+		start := p.pos
+		end := strings.IndexByte(p.input[start+1:], '"')
+		if end < 0 {
+			return "", &Error{Pos: start, Message: "unclosed quote"}
+		}
+		p.pos = start + 1 + end + 1
+		if p.pos < len(p.input) && !isSpace(p.input[p.pos]) {
+			return "", &Error{Pos: p.pos, Message: "expected a space after the closing quote"}
+		}
+		return p.input[start+1 : start+1+end], nil
+	}
+
+	start := p.pos
+	for p.pos < len(p.input) && !isSpace(p.input[p.pos]) {
+		p.pos++
+	}
+	return p.input[start:p.pos], nil
+}
+
+// fieldNames lists the names of the fields terms can use
+func fieldNames() []string {
+	var names []string
+	for _, field := range FieldsFor(KindAll) {
+		names = append(names, field.Name)
+	}
+	return names
+}
+
+// parseValues parses the comma-separated values of a field
+func parseValues(field Field, raw string, pos int) ([]Value, error) {
+	var values []Value
+	for _, text := range strings.Split(raw, ",") {
+		text = strings.TrimSpace(text)
+		if text == "" {
+			return nil, &Error{Pos: pos, Message: fmt.Sprintf("%s has an empty value", field.Name)}
+		}
+		value, err := parseValue(field, text)
+		if err != nil {
+			return nil, &Error{Pos: pos, Message: err.Error()}
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// parseValue parses one value of a field
+func parseValue(field Field, text string) (Value, error) {
+	switch field.typ {
+	case typeNumber:
+		return parseNumber(field, text)
+
+	case typeBool:
+		switch strings.ToLower(text) {
+		case "true", "yes":
+			return Value{Op: OpEqual, Bool: true}, nil
+		case "false", "no":
+			return Value{Op: OpEqual, Bool: false}, nil
+		}
+		return Value{}, fmt.Errorf("%s is true or false, not %q", field.Name, text)
+
+	case typeEnum:
+		// Plurals are accepted: kind:accounts, type:services
+		singular := strings.TrimSuffix(strings.ToLower(text), "s")
+		for _, allowed := range field.enum {
+			if strings.TrimSuffix(allowed, "s") == singular {
+				return Value{Op: OpEqual, Text: allowed}, nil
+			}
+		}
+		message := fmt.Sprintf("%s is %s, not %q", field.Name, strings.Join(field.enum, ", "), text)
+		if suggestion := suggest(strings.ToLower(text), field.enum); suggestion != "" {
+			message += fmt.Sprintf("; did you mean %s?", suggestion)
+		}
+		return Value{}, fmt.Errorf("%s", message)
+	}
+	return Value{Op: OpEqual, Text: strings.ToLower(text)}, nil
+}
+
+// parseNumber parses N, >N, >=N, <N, <=N or N..M
+func parseNumber(field Field, text string) (Value, error) {
+	invalid := fmt.Errorf("%s takes a number such as 1000, a comparison such as >1000 or a range such as 1000..1999, not %q", field.Name, text)
+
+	if low, high, ok := strings.Cut(text, ".."); ok {
+		l, errLow := strconv.Atoi(low)
+		h, errHigh := strconv.Atoi(high)
+		if errLow != nil || errHigh != nil {
+			return Value{}, invalid
+		}
+		if l > h {
+			return Value{}, fmt.Errorf("%s range %s starts after it ends", field.Name, text)
+		}
+		return Value{Op: OpRange, Number: l, High: h}, nil
+	}
+
+	op := OpEqual
+	for _, candidate := range []Op{OpAtLeast, OpAtMost, OpGreater, OpLess, OpEqual} {
+		if strings.HasPrefix(text, string(candidate)) {
+			op, text = candidate, text[len(candidate):]
+			break
+		}
+	}
+	number, err := strconv.Atoi(text)
+	if err != nil {
+		return Value{}, invalid
+	}
+	return Value{Op: op, Number: number}, nil
+}
@@ -0,0 +1,231 @@
+// Package query parses the search query language, such as
+//
+//	type:service active:false gid:>60000 member-of:dba
+//
+// A query is a list of terms that must all match. A term is a field, a
+// colon and a value, or a bare word matched against names and IDs. A leading
+// minus negates a term. Values may be quoted, and comma-separated values
+// match any of them.
+//
+//   - Numbers: gid:60001, gid:>60000 (also >=, <, <=), gid:1000..1999
+//   - Strings: case-insensitive, exact unless they contain * wildcards
+//   - Booleans: true or false, yes or no
+package query
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Kinds is a set of the kinds of record a query searches
+type Kinds int
+
+// Kinds of record
+const (
+	KindAccount Kinds = 1 << iota
+	KindGroup
+	KindAll = KindAccount | KindGroup
+)
+
+// String names the kinds, such as "accounts or groups"
+func (k Kinds) String() string {
+	var names []string
+	if k&KindAccount != 0 {
+		names = append(names, "accounts")
+	}
+	if k&KindGroup != 0 {
+		names = append(names, "groups")
+	}
+	return strings.Join(names, " or ")
+}
+
+// valueType is the type of a field's values
+type valueType int
+
+const (
+	typeString valueType = iota
+	typeNumber
+	typeBool
+	typeEnum
+)
+
+// Field is a field a term can filter on
+type Field struct {
+	Name  string
+	Kinds Kinds // Kinds of record that have the field
+	Help  string
+	typ   valueType
+	enum  []string // Allowed values of an enum
+}
+
+// Fields that terms can filter on; FieldText holds bare words
+const (
+	FieldText         = "text"
+	FieldKind         = "kind"
+	FieldID           = "id"
+	FieldUID          = "uid"
+	FieldGID          = "gid"
+	FieldType         = "type"
+	FieldActive       = "active"
+	FieldUsername     = "username"
+	FieldFirstname    = "firstname"
+	FieldSurname      = "surname"
+	FieldName         = "name"
+	FieldMemberOf     = "member-of"
+	FieldPrimaryGroup = "primary-group"
+	FieldGroupname    = "groupname"
+	FieldDescription  = "description"
+	FieldCreatedBy    = "created-by"
+	FieldHasMember    = "has-member"
+)
+
+// types are the account and group types
+var types = []string{"people", "system", "service", "database"}
+
+// fields by name
+var fields = map[string]Field{
+	FieldText:         {Kinds: KindAll, typ: typeString, Help: "bare words: part of a name, or of a UID or GID"},
+	FieldKind:         {Kinds: KindAll, typ: typeEnum, enum: []string{"account", "group"}, Help: "account or group"},
+	FieldID:           {Kinds: KindAll, typ: typeNumber, Help: "record ID"},
+	FieldUID:          {Kinds: KindAccount, typ: typeNumber, Help: "UID"},
+	FieldGID:          {Kinds: KindAll, typ: typeNumber, Help: "GID; for accounts the GID of the primary group"},
+	FieldType:         {Kinds: KindAll, typ: typeEnum, enum: types, Help: "people, system, service or database"},
+	FieldActive:       {Kinds: KindAll, typ: typeBool, Help: "true or false"},
+	FieldUsername:     {Kinds: KindAccount, typ: typeString, Help: "username"},
+	FieldFirstname:    {Kinds: KindAccount, typ: typeString, Help: "first name"},
+	FieldSurname:      {Kinds: KindAccount, typ: typeString, Help: "surname"},
+	FieldName:         {Kinds: KindAccount, typ: typeString, Help: "first name, surname or both"},
+	FieldMemberOf:     {Kinds: KindAccount, typ: typeString, Help: "groupname of a group the account is a member of"},
+	FieldPrimaryGroup: {Kinds: KindAccount, typ: typeString, Help: "groupname of the primary group"},
+	FieldGroupname:    {Kinds: KindGroup, typ: typeString, Help: "groupname"},
+	FieldDescription:  {Kinds: KindGroup, typ: typeString, Help: "description"},
+	FieldCreatedBy:    {Kinds: KindGroup, typ: typeString, Help: "user who created the group"},
+	FieldHasMember:    {Kinds: KindGroup, typ: typeString, Help: "username of a member"},
+}
+
+func init() {
+	for name, field := range fields {
+		field.Name = name
+		fields[name] = field
+	}
+}
+
+// FieldsFor lists the fields that records of kinds have, by name
+func FieldsFor(kinds Kinds) []Field {
+	var list []Field
+	for _, field := range fields {
+		if field.Kinds&kinds != 0 && field.Name != FieldText {
+			list = append(list, field)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Op compares a number
+type Op string
+
+// Number comparisons; strings, booleans and enums use OpEqual
+const (
+	OpEqual   Op = "="
+	OpGreater Op = ">"
+	OpAtLeast Op = ">="
+	OpLess    Op = "<"
+	OpAtMost  Op = "<="
+	OpRange   Op = ".."
+)
+
+// Value is one of the values of a term
+type Value struct {
+	Op     Op
+	Text   string // Lowercased string, enum or bare word; * is a wildcard
+	Number int    // Number, or the start of a range
+	High   int    // End of a range
+	Bool   bool
+}
+
+// Term is a filter the records must match
+type Term struct {
+	Field  string
+	Values []Value // The term matches if any value does
+	Negate bool
+	Pos    int // Byte offset of the term in the query
+}
+
+// Query is a parsed query
+type Query struct {
+	Terms []Term
+	Kinds Kinds // Kinds of record the query can match
+}
+
+// Text returns the bare words of the query that are not negated
+func (q *Query) Text() string {
+	var words []string
+	for _, term := range q.Terms {
+		if term.Field == FieldText && !term.Negate {
+			words = append(words, term.Values[0].Text)
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// Filters returns the query without the bare words Text returns
+func (q *Query) Filters() *Query {
+	filters := &Query{Kinds: q.Kinds}
+	for _, term := range q.Terms {
+		if term.Field != FieldText || term.Negate {
+			filters.Terms = append(filters.Terms, term)
+		}
+	}
+	return filters
+}
+
+// Error is a query that cannot be parsed
+type Error struct {
+	Pos     int // Byte offset of the problem in the query
+	Message string
+}
+
+// Error describes the problem and where it is, counting from 1
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (at position %d)", e.Message, e.Pos+1)
+}
+
+// suggest returns the candidate closest to word, or "" if none is close
+func suggest(word string, candidates []string) string {
+	best, bestDistance := "", 3
+	for _, candidate := range candidates {
+		if d := distance(word, candidate); d < bestDistance {
+			best, bestDistance = candidate, d
+		}
+	}
+	return best
+}
+
+// distance is the number of single-character insertions, deletions,
+// substitutions and swaps of neighbours that turn a into b
+func distance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	d := make([][]int, len(ra)+1)
+	for i := range d {
+		d[i] = make([]int, len(rb)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(ra)][len(rb)]
+}
@@ -0,0 +1,126 @@
+package query
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/home/unixify/internal/models"
+)
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		kinds Kinds
+		pos   int
+		want  string
+	}{
+		{"typ:service", KindAll, 0, "did you mean type?"},
+		{"colour:red", KindAll, 0, "use active, created-by"},
+		{"gid:", KindAll, 4, "gid needs a value"},
+		{"active:false gid:>6000x", KindAll, 17, "gid takes a number"},
+		{"gid:2000..1000", KindAll, 4, "starts after it ends"},
+		{"active:maybe", KindAll, 7, "true or false"},
+		{"type:servce", KindAll, 5, "did you mean service?"},
+		{`name:"john smith`, KindAccount, 5, "unclosed quote"},
+		{"uid:1000 has-member:bob", KindAll, 9, "has-member cannot match: the terms before it only match accounts"},
+		{"member-of:dba", KindGroup, 0, "member-of only applies to accounts, not groups"},
+		{"member-of:dba,", KindAccount, 10, "empty value"},
+		{"- uid:1", KindAccount, 0, "- must be followed"},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.input, tt.kinds)
+		var parseErr *Error
+		if !errors.As(err, &parseErr) {
+			t.Errorf("Parse(%q) error = %v, want *Error", tt.input, err)
+			continue
+		}
+		if parseErr.Pos != tt.pos || !strings.Contains(parseErr.Message, tt.want) {
+			t.Errorf("Parse(%q) = %q at %d, want %q at %d", tt.input, parseErr.Message, parseErr.Pos, tt.want, tt.pos)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	q, err := Parse(`type:services active:NO gid:>60000 -member-of:dba,ops* name:"Jo Smith" smith`, KindAll)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if q.Kinds != KindAccount {
+		t.Errorf("Kinds = %s, want accounts", q.Kinds)
+	}
+	if len(q.Terms) != 6 {
+		t.Fatalf("parsed %d terms, want 6", len(q.Terms))
+	}
+	if v := q.Terms[0].Values[0]; v.Text != "service" {
+		t.Errorf("type value = %q, want service", v.Text)
+	}
+	if v := q.Terms[2].Values[0]; v.Op != OpGreater || v.Number != 60000 {
+		t.Errorf("gid value = %+v, want >60000", v)
+	}
+	if term := q.Terms[3]; !term.Negate || len(term.Values) != 2 || term.Pos != 35 {
+		t.Errorf("member-of term = %+v, want negated with 2 values at 35", term)
+	}
+	if v := q.Terms[4].Values[0]; v.Text != "jo smith" {
+		t.Errorf("name value = %q, want jo smith", v.Text)
+	}
+	if q.Text() != "smith" || len(q.Filters().Terms) != 5 {
+		t.Errorf("Text() = %q with %d filters, want smith with 5", q.Text(), len(q.Filters().Terms))
+	}
+
+	q, err = Parse("-kind:account", KindAll)
+	if err != nil || q.Kinds != KindGroup {
+		t.Errorf("Parse(-kind:account) = %v, %v, want groups", q, err)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	dba := models.Group{ID: 1, Groupname: "dba", UnixGID: 60010, Type: models.GroupTypeService}
+	accounts := []AccountRecord{
+		{Account: models.Account{ID: 1, Username: "oracle", UnixUID: 60001, Type: models.AccountTypeService}, PrimaryGroup: &dba, Groups: []string{"dba"}},
+		{Account: models.Account{ID: 2, Username: "backup", UnixUID: 60002, Type: models.AccountTypeService}, PrimaryGroup: &dba},
+		{Account: models.Account{ID: 3, Username: "jsmith", UnixUID: 1001, Type: models.AccountTypePeople, Active: true, Firstname: "John", Surname: "Smith"}, Groups: []string{"dba", "ops"}},
+	}
+	groups := []GroupRecord{
+		{Group: dba, Members: []string{"oracle", "jsmith"}},
+		{Group: models.Group{ID: 2, Groupname: "ops", UnixGID: 1100, Active: true, Description: "Operators"}, Members: []string{"jsmith"}},
+	}
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"type:service active:false gid:>60000 member-of:dba", "oracle"},
+		{"type:service -member-of:dba", "backup"},
+		{"uid:60000..60005", "oracle backup"},
+		{"member-of:d*", "oracle jsmith"},
+		{`name:"john smith"`, "jsmith"},
+		{"primary-group:dba uid:<60002", "oracle"},
+		{"smi", "jsmith"},
+		{"has-member:oracle", "dba"},
+		{"kind:group oper", "ops"},
+		{"active:yes", "jsmith ops"},
+		{"gid:1100,60010", "oracle backup dba ops"},
+	}
+	for _, tt := range tests {
+		q, err := Parse(tt.input, KindAll)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.input, err)
+			continue
+		}
+		var got []string
+		for _, record := range accounts {
+			if q.MatchAccount(record) {
+				got = append(got, record.Account.Username)
+			}
+		}
+		for _, record := range groups {
+			if q.MatchGroup(record) {
+				got = append(got, record.Group.Groupname)
+			}
+		}
+		if strings.Join(got, " ") != tt.want {
+			t.Errorf("%q matched %q, want %q", tt.input, strings.Join(got, " "), tt.want)
+		}
+	}
+}
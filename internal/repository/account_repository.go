@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"github.com/home/unixify/internal/models"
+	"github.com/home/unixify/internal/query"
 	"gorm.io/gorm"
 )
 
@@ -22,7 +23,11 @@ func NewAccountRepository(db *gorm.DB) *AccountRepository {
 
 // Create creates a new account
 func (r *AccountRepository) Create(account *models.Account) error {
-	return r.db.Create(account).Error
+	account.Version = 1
+	return sequenced(r.db, func(tx *gorm.DB, seq int64) error {
+		account.ChangeSeq = seq
+		return tx.Create(account).Error
+	})
 }
 
 // IsUIDDuplicate checks if a UID already exists
@@ -122,6 +127,15 @@ func (r *AccountRepository) FindByUsername(username string) (*models.Account, er
 	return &account, nil
 }
 
+// IsUsernameDeleted reports whether a deleted account had the username
+func (r *AccountRepository) IsUsernameDeleted(username string) (bool, error) {
+	var count int64
+	err := r.db.Model(&models.Tombstone{}).
+		Where("kind = ? AND name = ?", models.TombstoneAccount, username).
+		Count(&count).Error
+	return count > 0, err
+}
+
 // FindAll finds all accounts with optional filtering by type
 func (r *AccountRepository) FindAll(accountType models.AccountType) ([]models.Account, error) {
 	var accounts []models.Account
@@ -156,35 +170,78 @@ func (r *AccountRepository) FindAll(accountType models.AccountType) ([]models.Ac
 
 // Update updates an account
 func (r *AccountRepository) Update(account *models.Account) error {
-	// Use a transaction to ensure atomicity
-	tx := r.db.Begin()
-	
-	// Save the account - this updates the record
-	if err := tx.Save(account).Error; err != nil {
-		tx.Rollback()
-		return fmt.Errorf("failed to update account: %w", err)
-	}
-	
-	// Verify the update was successful by reloading the account
-	var updatedAccount models.Account
-	if err := tx.First(&updatedAccount, account.ID).Error; err != nil {
-		tx.Rollback()
-		return fmt.Errorf("failed to verify account update: %w", err)
-	}
-	
-	// Ensure type was updated correctly
-	if updatedAccount.Type != account.Type {
-		tx.Rollback()
-		return fmt.Errorf("account type was not updated correctly: expected %s, got %s", account.Type, updatedAccount.Type)
-	}
-	
-	// Commit the transaction
-	return tx.Commit().Error
+	// Use a transaction to ensure atomicity. Transaction falls back to a
+	// savepoint when the repository is already bound to a transaction.
+	return sequenced(r.db, func(tx *gorm.DB, seq int64) error {
+		// Save the account only if nobody changed it since it was read
+		expected, previousSeq := account.Version, account.ChangeSeq
+		account.Version, account.ChangeSeq = expected+1, seq
+		result := tx.Model(account).Where("version = ?", expected).Select("*").Updates(account)
+		if result.Error != nil {
+			account.Version, account.ChangeSeq = expected, previousSeq
+			return fmt.Errorf("failed to update account: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			account.Version, account.ChangeSeq = expected, previousSeq
+			if err := tx.First(&models.Account{}, account.ID).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return fmt.Errorf("account with ID %d not found", account.ID)
+				}
+				return err
+			}
+			return ErrVersionMismatch
+		}
+
+		// Verify the update was successful by reloading the account
+		var updatedAccount models.Account
+		if err := tx.First(&updatedAccount, account.ID).Error; err != nil {
+			return fmt.Errorf("failed to verify account update: %w", err)
+		}
+
+		// Ensure type was updated correctly
+		if updatedAccount.Type != account.Type {
+			return fmt.Errorf("account type was not updated correctly: expected %s, got %s", account.Type, updatedAccount.Type)
+		}
+
+		return nil
+	})
 }
 
-// Delete soft deletes an account
-func (r *AccountRepository) Delete(id uint) error {
-	return r.db.Delete(&models.Account{}, id).Error
+// Delete deletes an account, provided it is still at version (0 skips the check),
+// and leaves a tombstone for the change feed
+func (r *AccountRepository) Delete(id uint, version int) error {
+	return sequenced(r.db, func(tx *gorm.DB, seq int64) error {
+		var account models.Account
+		if err := tx.First(&account, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) && version == 0 {
+				return nil
+			}
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("account with ID %d not found", id)
+			}
+			return err
+		}
+
+		query := tx
+		if version != 0 {
+			query = query.Where("version = ?", version)
+		}
+		result := query.Delete(&models.Account{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrVersionMismatch
+		}
+
+		tombstone := &models.Tombstone{
+			ChangeSeq: seq,
+			Kind:      models.TombstoneAccount,
+			EntityID:  id,
+			Name:      account.Username,
+		}
+		return tx.Create(tombstone).Error
+	})
 }
 
 // FindByGroupID finds all accounts in a specific group
@@ -219,20 +276,39 @@ func (r *AccountRepository) AssignToGroup(accountID, groupID uint) error {
 		return fmt.Errorf("account is already a member of this group")
 	}
 	
-	return r.db.Create(&accountGroup).Error
+	return sequenced(r.db, func(tx *gorm.DB, seq int64) error {
+		accountGroup.ChangeSeq = seq
+		return tx.Create(&accountGroup).Error
+	})
 }
 
 // RemoveFromGroup removes an account from a group
 func (r *AccountRepository) RemoveFromGroup(accountID, groupID uint) error {
-	return r.db.Where("account_id = ? AND group_id = ?", accountID, groupID).
-		Delete(&models.AccountGroup{}).Error
+	return deleteMemberships(r.db, "account_id = ? AND group_id = ?", accountID, groupID)
 }
 
-// Search searches for accounts by UID or username
-func (r *AccountRepository) Search(query string) ([]models.Account, error) {
+// FindAllMemberships returns every account/group membership
+func (r *AccountRepository) FindAllMemberships() ([]models.AccountGroup, error) {
+	var memberships []models.AccountGroup
+	err := r.db.Order("account_id, group_id").Find(&memberships).Error
+	if err != nil {
+		return nil, err
+	}
+	return memberships, nil
+}
+
+// DeleteMembership deletes a single membership row by its ID
+func (r *AccountRepository) DeleteMembership(id uint) error {
+	return deleteMemberships(r.db, "id = ?", id)
+}
+
+// FindByQuery finds the accounts matching a parsed query
+func (r *AccountRepository) FindByQuery(q *query.Query) ([]models.Account, error) {
 	var accounts []models.Account
-	err := r.db.Where("username LIKE ? OR CAST(unixuid AS TEXT) LIKE ?", "%"+query+"%", "%"+query+"%").
-		Find(&accounts).Error
+	if q.Kinds&query.KindAccount == 0 {
+		return accounts, nil
+	}
+	err := applyQuery(r.db, q, accountConditions).Order("accounts.id").Find(&accounts).Error
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"database/sql"
+
+	"github.com/home/unixify/internal/models"
+	"gorm.io/gorm"
+)
+
+// nextChangeSeq takes the next change sequence number. The counter row stays
+// locked until db's transaction ends, so changes commit in sequence order and
+// a reader never sees a number before every lower one is visible.
+func nextChangeSeq(db *gorm.DB) (int64, error) {
+	var seq int64
+	err := db.Raw("UPDATE change_sequence SET value = value + 1 WHERE id = 1 RETURNING value").Scan(&seq).Error
+	return seq, err
+}
+
+// sequenced runs fn in a transaction with the next change sequence number
+func sequenced(db *gorm.DB, fn func(tx *gorm.DB, seq int64) error) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		seq, err := nextChangeSeq(tx)
+		if err != nil {
+			return err
+		}
+		return fn(tx, seq)
+	})
+}
+
+// deleteMemberships deletes the membership rows matching a condition, leaving a
+// tombstone with its own sequence number for each
+func deleteMemberships(db *gorm.DB, query interface{}, args ...interface{}) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var memberships []models.AccountGroup
+		if err := tx.Where(query, args...).Order("id").Find(&memberships).Error; err != nil {
+			return err
+		}
+		for _, membership := range memberships {
+			seq, err := nextChangeSeq(tx)
+			if err != nil {
+				return err
+			}
+			result := tx.Delete(&models.AccountGroup{}, membership.ID)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				continue // Deleted concurrently, which left the tombstone
+			}
+			tombstone := &models.Tombstone{
+				ChangeSeq: seq,
+				Kind:      models.TombstoneMembership,
+				EntityID:  membership.ID,
+				AccountID: membership.AccountID,
+				GroupID:   membership.GroupID,
+			}
+			if err := tx.Create(tombstone).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ChangeRepository reads the change feed
+type ChangeRepository struct {
+	db *gorm.DB
+}
+
+// NewChangeRepository creates a new change repository
+func NewChangeRepository(db *gorm.DB) *ChangeRepository {
+	return &ChangeRepository{
+		db: db,
+	}
+}
+
+// FindChangesSince finds up to limit accounts, groups, memberships and
+// tombstones each that changed after since, in sequence order. All four are
+// read from one snapshot.
+func (r *ChangeRepository) FindChangesSince(since int64, limit int) (*models.ChangeSet, error) {
+	changes := &models.ChangeSet{Since: since}
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		changed := func() *gorm.DB {
+			return tx.Where("change_seq > ?", since).Order("change_seq").Limit(limit)
+		}
+		if err := changed().Find(&changes.Accounts).Error; err != nil {
+			return err
+		}
+		if err := changed().Find(&changes.Groups).Error; err != nil {
+			return err
+		}
+		if err := changed().Find(&changes.Memberships).Error; err != nil {
+			return err
+		}
+		return changed().Find(&changes.Tombstones).Error
+	}, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
@@ -5,54 +5,97 @@ import (
 
 	"github.com/home/unixify/internal/config"
 	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
+	_ "modernc.org/sqlite"
 )
 
 // InitDB initializes the database connection
 func InitDB(cfg *config.Config) (*gorm.DB, error) {
-	db, err := gorm.Open(postgres.Open(cfg.Database.GetDSN()), &gorm.Config{
+	var dialector gorm.Dialector
+	switch cfg.Database.Driver {
+	case config.DriverSQLite:
+		// Use the pure-Go driver registered as "sqlite" so builds work without cgo
+		dialector = sqlite.Dialector{DriverName: "sqlite", DSN: cfg.Database.GetDSN()}
+	default:
+		dialector = postgres.Open(cfg.Database.GetDSN())
+	}
+
+	db, err := gorm.Open(dialector, &gorm.Config{
 		Logger: logger.Default.LogMode(logger.Info),
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
 
-	// Skip auto-migration and rely on the SQL migrations
-	// that have already been applied via the migrate tool.
-	// This avoids issues with column naming differences.
+	// Skip GORM auto-migration; the schema is owned by the embedded
+	// SQL migrations in db/migrations, applied by the migrate tool or
+	// by the server on boot when DB_AUTO_MIGRATE is set.
 
 	return db, nil
 }
 
 // Repositories is a holder for all repositories
 type Repositories struct {
-	Account *AccountRepository
-	Group   *GroupRepository
-	Audit   *AuditRepository
+	Account     AccountStore
+	Group       GroupStore
+	Audit       AuditStore
+	Reservation *ReservationRepository
+	Webhook     WebhookStore
+	Event       EventStore
+	Change      ChangeStore
+	Host        HostStore
+	Netgroup    NetgroupStore
+	Sudo        SudoStore
+	SubID       SubIDStore
+	Search      SearchStore
+	SavedSearch SavedSearchStore
+	Session     SessionStore
+	User        UserStore
+	Login       LoginAttemptStore
+	TOTP        TOTPChallengeStore
+	Recovery    TOTPRecoveryCodeStore
 }
 
 // Repository is an alias for Repositories for backward compatibility
 type Repository struct {
-	Account *AccountRepository
-	Group   *GroupRepository
-	Audit   *AuditRepository
+	Account     *AccountRepository
+	Group       *GroupRepository
+	Audit       *AuditRepository
+	Reservation *ReservationRepository
 }
 
 // NewRepositories creates new instances of all repositories
 func NewRepositories(db *gorm.DB) *Repositories {
 	return &Repositories{
-		Account: NewAccountRepository(db),
-		Group:   NewGroupRepository(db),
-		Audit:   NewAuditRepository(db),
+		Account:     NewAccountRepository(db),
+		Group:       NewGroupRepository(db),
+		Audit:       NewAuditRepository(db),
+		Reservation: NewReservationRepository(db),
+		Webhook:     NewWebhookRepository(db),
+		Event:       NewEventRepository(db),
+		Change:      NewChangeRepository(db),
+		Host:        NewHostRepository(db),
+		Netgroup:    NewNetgroupRepository(db),
+		Sudo:        NewSudoRepository(db),
+		SubID:       NewSubIDRepository(db),
+		Search:      NewSearchRepository(db),
+		SavedSearch: NewSavedSearchRepository(db),
+		Session:     NewSessionRepository(db),
+		User:        NewUserRepository(db),
+		Login:       NewLoginAttemptRepository(db),
+		TOTP:        NewTOTPChallengeRepository(db),
+		Recovery:    NewTOTPRecoveryCodeRepository(db),
 	}
 }
 
 // NewRepository creates new instances of all repositories (alias for NewRepositories)
 func NewRepository(db *gorm.DB) *Repository {
 	return &Repository{
-		Account: NewAccountRepository(db),
-		Group:   NewGroupRepository(db),
-		Audit:   NewAuditRepository(db),
+		Account:     NewAccountRepository(db),
+		Group:       NewGroupRepository(db),
+		Audit:       NewAuditRepository(db),
+		Reservation: NewReservationRepository(db),
 	}
-}
\ No newline at end of file
+}
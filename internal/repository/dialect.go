@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"strconv"
+
+	"github.com/home/unixify/internal/config"
+	"gorm.io/gorm"
+)
+
+// dialect isolates the SQL that only works on one database backend
+type dialect interface {
+	// notifyEvent tells the other servers about a new event once db's transaction commits
+	notifyEvent(db *gorm.DB, id uint) error
+	// hasTrigrams reports whether search can use pg_trgm's trigram indexes
+	hasTrigrams(db *gorm.DB) (bool, error)
+}
+
+// dialectOf returns the dialect for a database connection
+func dialectOf(db *gorm.DB) dialect {
+	if db.Dialector.Name() == config.DriverSQLite {
+		return sqliteDialect{}
+	}
+	return postgresDialect{}
+}
+
+// postgresDialect shares events between servers with LISTEN/NOTIFY and
+// searches with pg_trgm
+type postgresDialect struct{}
+
+// notifyEvent sends a NOTIFY on EventChannel, which PostgreSQL holds back until commit
+func (postgresDialect) notifyEvent(db *gorm.DB, id uint) error {
+	return db.Exec("SELECT pg_notify(?, ?)", EventChannel, strconv.FormatUint(uint64(id), 10)).Error
+}
+
+// hasTrigrams checks that pg_trgm is installed, which migrations do when
+// the database user may create extensions
+func (postgresDialect) hasTrigrams(db *gorm.DB) (bool, error) {
+	var installed bool
+	err := db.Raw("SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'pg_trgm')").Scan(&installed).Error
+	return installed, err
+}
+
+// sqliteDialect serves a single server and searches without indexes
+type sqliteDialect struct{}
+
+// notifyEvent does nothing: a SQLite database belongs to a single server,
+// which polls the event log instead
+func (sqliteDialect) notifyEvent(db *gorm.DB, id uint) error {
+	return nil
+}
+
+// hasTrigrams is false: SQLite has no trigram indexes
+func (sqliteDialect) hasTrigrams(db *gorm.DB) (bool, error) {
+	return false, nil
+}
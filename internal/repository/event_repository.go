@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/home/unixify/internal/models"
+	"gorm.io/gorm"
+)
+
+// EventChannel is the PostgreSQL notification channel that announces new
+// events; the payload is the event ID
+const EventChannel = "unixify_events"
+
+// EventRepository handles database operations for the event log
+type EventRepository struct {
+	db *gorm.DB
+}
+
+// NewEventRepository creates a new event repository
+func NewEventRepository(db *gorm.DB) *EventRepository {
+	return &EventRepository{
+		db: db,
+	}
+}
+
+// Create adds an event to the log and announces it to listening servers.
+// The announcement is only sent once the surrounding transaction commits.
+func (r *EventRepository) Create(record *models.EventRecord) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(record).Error; err != nil {
+			return err
+		}
+		return dialectOf(tx).notifyEvent(tx, record.ID)
+	})
+}
+
+// FindByID finds an event by ID
+func (r *EventRepository) FindByID(id uint) (*models.EventRecord, error) {
+	var record models.EventRecord
+	err := r.db.First(&record, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("event with ID %d not found", id)
+		}
+		return nil, err
+	}
+	return &record, nil
+}
+
+// FindSince finds up to limit events with an ID above afterID, oldest first
+func (r *EventRepository) FindSince(afterID uint, limit int) ([]models.EventRecord, error) {
+	var records []models.EventRecord
+	err := r.db.Where("id > ?", afterID).Order("id").Limit(limit).Find(&records).Error
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// LatestID returns the ID of the newest event, or 0 when the log is empty
+func (r *EventRepository) LatestID() (uint, error) {
+	var latest uint
+	err := r.db.Model(&models.EventRecord{}).Select("COALESCE(MAX(id), 0)").Scan(&latest).Error
+	return latest, err
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"github.com/home/unixify/internal/models"
+	"github.com/home/unixify/internal/query"
 	"gorm.io/gorm"
 )
 
@@ -22,7 +23,11 @@ func NewGroupRepository(db *gorm.DB) *GroupRepository {
 
 // Create creates a new group
 func (r *GroupRepository) Create(group *models.Group) error {
-	return r.db.Create(group).Error
+	group.Version = 1
+	return sequenced(r.db, func(tx *gorm.DB, seq int64) error {
+		group.ChangeSeq = seq
+		return tx.Create(group).Error
+	})
 }
 
 // IsGIDDuplicate checks if a GID already exists
@@ -87,7 +92,7 @@ func (r *GroupRepository) FindByID(id uint) (*models.Group, error) {
 // FindByGID finds a group by GID
 func (r *GroupRepository) FindByGID(gid int) (*models.Group, error) {
 	var group models.Group
-	err := r.db.Where("gid = ?", gid).First(&group).Error
+	err := r.db.Where("unixgid = ?", gid).First(&group).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, fmt.Errorf("group with GID %d not found", gid)
@@ -126,14 +131,61 @@ func (r *GroupRepository) FindAll(groupType models.GroupType) ([]models.Group, e
 	return groups, nil
 }
 
-// Update updates a group
+// Update updates a group, provided nobody changed it since it was read
 func (r *GroupRepository) Update(group *models.Group) error {
-	return r.db.Save(group).Error
+	return sequenced(r.db, func(tx *gorm.DB, seq int64) error {
+		expected, previousSeq := group.Version, group.ChangeSeq
+		group.Version, group.ChangeSeq = expected+1, seq
+		result := tx.Model(group).Where("version = ?", expected).Select("*").Updates(group)
+		if result.Error == nil && result.RowsAffected > 0 {
+			return nil
+		}
+		group.Version, group.ChangeSeq = expected, previousSeq
+		if result.Error != nil {
+			return result.Error
+		}
+		if _, err := NewGroupRepository(tx).FindByID(group.ID); err != nil {
+			return err
+		}
+		return ErrVersionMismatch
+	})
 }
 
-// Delete soft deletes a group
-func (r *GroupRepository) Delete(id uint) error {
-	return r.db.Delete(&models.Group{}, id).Error
+// Delete deletes a group, provided it is still at version (0 skips the check),
+// and leaves a tombstone for the change feed
+func (r *GroupRepository) Delete(id uint, version int) error {
+	return sequenced(r.db, func(tx *gorm.DB, seq int64) error {
+		var group models.Group
+		if err := tx.First(&group, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) && version == 0 {
+				return nil
+			}
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("group with ID %d not found", id)
+			}
+			return err
+		}
+
+		query := tx
+		if version != 0 {
+			query = query.Where("version = ?", version)
+		}
+		result := query.Delete(&models.Group{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrVersionMismatch
+		}
+
+		tombstone := &models.Tombstone{
+			ChangeSeq: seq,
+			Kind:      models.TombstoneGroup,
+			EntityID:  id,
+			Name:      group.Groupname,
+		}
+		return tx.Create(tombstone).Error
+	})
 }
 
 // FindByAccountID finds all groups that an account is a member of
@@ -160,11 +212,13 @@ func (r *GroupRepository) GetAccountsInGroup(groupID uint) ([]models.Account, er
 	return accounts, nil
 }
 
-// Search searches for groups by GID or groupname
-func (r *GroupRepository) Search(query string) ([]models.Group, error) {
+// FindByQuery finds the groups matching a parsed query
+func (r *GroupRepository) FindByQuery(q *query.Query) ([]models.Group, error) {
 	var groups []models.Group
-	err := r.db.Where("groupname LIKE ? OR CAST(gid AS TEXT) LIKE ?", "%"+query+"%", "%"+query+"%").
-		Find(&groups).Error
+	if q.Kinds&query.KindGroup == 0 {
+		return groups, nil
+	}
+	err := applyQuery(r.db, q, groupConditions).Order("groups.id").Find(&groups).Error
 	if err != nil {
 		return nil, err
 	}
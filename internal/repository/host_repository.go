@@ -0,0 +1,224 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/home/unixify/internal/models"
+	"gorm.io/gorm"
+)
+
+// HostRepository handles database operations for hosts, host groups, their
+// access rules and the reports host agents send
+type HostRepository struct {
+	db *gorm.DB
+}
+
+// NewHostRepository creates a new host repository
+func NewHostRepository(db *gorm.DB) *HostRepository {
+	return &HostRepository{
+		db: db,
+	}
+}
+
+// CreateReport stores a report sent by a host agent
+func (r *HostRepository) CreateReport(report *models.HostReport) error {
+	return r.db.Create(report).Error
+}
+
+// FindReports finds the latest reports, newest first, optionally for one host
+func (r *HostRepository) FindReports(hostname string, limit int) ([]models.HostReport, error) {
+	var reports []models.HostReport
+	query := r.db.Order("id DESC").Limit(limit)
+	if hostname != "" {
+		query = query.Where("hostname = ?", hostname)
+	}
+	if err := query.Find(&reports).Error; err != nil {
+		return nil, err
+	}
+	return reports, nil
+}
+
+// Create creates a new host
+func (r *HostRepository) Create(host *models.Host) error {
+	return r.db.Create(host).Error
+}
+
+// FindByID finds a host by ID
+func (r *HostRepository) FindByID(id uint) (*models.Host, error) {
+	var host models.Host
+	err := r.db.First(&host, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("host with ID %d not found", id)
+		}
+		return nil, err
+	}
+	return &host, nil
+}
+
+// FindByTokenHash finds the host a token belongs to
+func (r *HostRepository) FindByTokenHash(tokenHash string) (*models.Host, error) {
+	var host models.Host
+	err := r.db.Where("token_hash = ?", tokenHash).First(&host).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("host not found")
+		}
+		return nil, err
+	}
+	return &host, nil
+}
+
+// FindAll finds all hosts
+func (r *HostRepository) FindAll() ([]models.Host, error) {
+	var hosts []models.Host
+	err := r.db.Order("hostname").Find(&hosts).Error
+	if err != nil {
+		return nil, err
+	}
+	return hosts, nil
+}
+
+// Update updates a host
+func (r *HostRepository) Update(host *models.Host) error {
+	return r.db.Save(host).Error
+}
+
+// Delete deletes a host and removes it from its host groups
+func (r *HostRepository) Delete(id uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("host_id = ?", id).Delete(&models.HostGroupMember{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.Host{}, id).Error
+	})
+}
+
+// CreateHostGroup creates a new host group
+func (r *HostRepository) CreateHostGroup(hostGroup *models.HostGroup) error {
+	return r.db.Create(hostGroup).Error
+}
+
+// FindHostGroupByID finds a host group by ID
+func (r *HostRepository) FindHostGroupByID(id uint) (*models.HostGroup, error) {
+	var hostGroup models.HostGroup
+	err := r.db.First(&hostGroup, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("host group with ID %d not found", id)
+		}
+		return nil, err
+	}
+	return &hostGroup, nil
+}
+
+// FindAllHostGroups finds all host groups
+func (r *HostRepository) FindAllHostGroups() ([]models.HostGroup, error) {
+	var hostGroups []models.HostGroup
+	err := r.db.Order("name").Find(&hostGroups).Error
+	if err != nil {
+		return nil, err
+	}
+	return hostGroups, nil
+}
+
+// UpdateHostGroup updates a host group
+func (r *HostRepository) UpdateHostGroup(hostGroup *models.HostGroup) error {
+	return r.db.Save(hostGroup).Error
+}
+
+// DeleteHostGroup deletes a host group together with its members and access rules
+func (r *HostRepository) DeleteHostGroup(id uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("host_group_id = ?", id).Delete(&models.HostGroupMember{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("host_group_id = ?", id).Delete(&models.AccessRule{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.HostGroup{}, id).Error
+	})
+}
+
+// AddToHostGroup puts a host in a host group
+func (r *HostRepository) AddToHostGroup(hostGroupID, hostID uint) error {
+	var count int64
+	err := r.db.Model(&models.HostGroupMember{}).
+		Where("host_group_id = ? AND host_id = ?", hostGroupID, hostID).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("host is already a member of this host group")
+	}
+	return r.db.Create(&models.HostGroupMember{HostGroupID: hostGroupID, HostID: hostID}).Error
+}
+
+// RemoveFromHostGroup takes a host out of a host group
+func (r *HostRepository) RemoveFromHostGroup(hostGroupID, hostID uint) error {
+	return r.db.Where("host_group_id = ? AND host_id = ?", hostGroupID, hostID).Delete(&models.HostGroupMember{}).Error
+}
+
+// FindHostsInGroup finds the hosts in a host group
+func (r *HostRepository) FindHostsInGroup(hostGroupID uint) ([]models.Host, error) {
+	var hosts []models.Host
+	err := r.db.Joins("JOIN host_group_members ON host_group_members.host_id = hosts.id").
+		Where("host_group_members.host_group_id = ?", hostGroupID).
+		Order("hostname").
+		Find(&hosts).Error
+	if err != nil {
+		return nil, err
+	}
+	return hosts, nil
+}
+
+// FindHostGroupsOfHost finds the host groups a host is in
+func (r *HostRepository) FindHostGroupsOfHost(hostID uint) ([]models.HostGroup, error) {
+	var hostGroups []models.HostGroup
+	err := r.db.Joins("JOIN host_group_members ON host_group_members.host_group_id = host_groups.id").
+		Where("host_group_members.host_id = ?", hostID).
+		Order("name").
+		Find(&hostGroups).Error
+	if err != nil {
+		return nil, err
+	}
+	return hostGroups, nil
+}
+
+// CreateAccessRule creates a new access rule
+func (r *HostRepository) CreateAccessRule(rule *models.AccessRule) error {
+	return r.db.Create(rule).Error
+}
+
+// FindAccessRuleByID finds an access rule by ID
+func (r *HostRepository) FindAccessRuleByID(id uint) (*models.AccessRule, error) {
+	var rule models.AccessRule
+	err := r.db.First(&rule, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("access rule with ID %d not found", id)
+		}
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// FindAccessRules finds the access rules of the given host groups
+func (r *HostRepository) FindAccessRules(hostGroupIDs []uint) ([]models.AccessRule, error) {
+	rules := []models.AccessRule{}
+	if len(hostGroupIDs) == 0 {
+		return rules, nil
+	}
+	err := r.db.Where("host_group_id IN ?", hostGroupIDs).Order("id").Find(&rules).Error
+	if err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// DeleteAccessRule deletes an access rule
+func (r *HostRepository) DeleteAccessRule(id uint) error {
+	return r.db.Delete(&models.AccessRule{}, id).Error
+}
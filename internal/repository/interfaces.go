@@ -0,0 +1,229 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/home/unixify/internal/models"
+	"github.com/home/unixify/internal/query"
+)
+
+// ErrVersionMismatch is returned by Update and Delete when the record's
+// version no longer matches the one the caller read
+var ErrVersionMismatch = errors.New("record was modified since it was read")
+
+// AccountStore is the storage used by the services for accounts and memberships.
+// Update only succeeds if account.Version still matches the stored version and
+// increments it; Delete does the same unless version is 0.
+type AccountStore interface {
+	Create(account *models.Account) error
+	IsUIDDuplicate(uid int, excludeID uint) (bool, error)
+	GetLatestUID(accountType models.AccountType) (int, error)
+	FindByID(id uint) (*models.Account, error)
+	FindByUID(uid int) (*models.Account, error)
+	FindByUsername(username string) (*models.Account, error)
+	IsUsernameDeleted(username string) (bool, error)
+	FindAll(accountType models.AccountType) ([]models.Account, error)
+	Update(account *models.Account) error
+	Delete(id uint, version int) error
+	FindByGroupID(groupID uint) ([]models.Account, error)
+	AssignToGroup(accountID, groupID uint) error
+	RemoveFromGroup(accountID, groupID uint) error
+	FindAllMemberships() ([]models.AccountGroup, error)
+	DeleteMembership(id uint) error
+	FindByQuery(q *query.Query) ([]models.Account, error)
+}
+
+// GroupStore is the storage used by the services for groups. Update and Delete
+// check versions the same way as AccountStore.
+type GroupStore interface {
+	Create(group *models.Group) error
+	IsGIDDuplicate(gid int, excludeID uint) (bool, error)
+	GetLatestGID(groupType models.GroupType) (int, error)
+	FindByID(id uint) (*models.Group, error)
+	FindByGID(gid int) (*models.Group, error)
+	FindByGroupname(groupname string) (*models.Group, error)
+	FindAll(groupType models.GroupType) ([]models.Group, error)
+	Update(group *models.Group) error
+	Delete(id uint, version int) error
+	FindByAccountID(accountID uint) ([]models.Group, error)
+	GetAccountsInGroup(groupID uint) ([]models.Account, error)
+	FindByQuery(q *query.Query) ([]models.Group, error)
+}
+
+// AuditStore is the storage used by the services for audit entries
+type AuditStore interface {
+	Create(entry *models.AuditEntry) error
+	FindAll(entityType, action string, entityID, userID uint) ([]models.AuditEntry, error)
+	FindByID(id uint) (*models.AuditEntry, error)
+}
+
+// UserStore is the storage used for the users who log in
+type UserStore interface {
+	Create(user *models.User) error
+	FindByID(id uint) (*models.User, error)
+	FindByUsername(username string) (*models.User, error)
+	FindByEmail(email string) (*models.User, error)
+	Update(user *models.User) error
+	ClaimTOTPStep(id uint, step int64) (bool, error)
+}
+
+// WebhookStore is the storage used for webhooks and their delivery queue
+type WebhookStore interface {
+	Create(webhook *models.Webhook) error
+	FindByID(id uint) (*models.Webhook, error)
+	FindAll() ([]models.Webhook, error)
+	FindActive() ([]models.Webhook, error)
+	Update(webhook *models.Webhook) error
+	Delete(id uint) error
+	CreateDelivery(delivery *models.WebhookDelivery) error
+	FindDeliveries(webhookID uint, status string, limit int) ([]models.WebhookDelivery, error)
+	FindDueDeliveries(now time.Time, limit int) ([]models.WebhookDelivery, error)
+	ClaimDelivery(delivery *models.WebhookDelivery, until time.Time) (bool, error)
+	UpdateDelivery(delivery *models.WebhookDelivery) error
+}
+
+// EventStore is the storage used for the event log. Create also announces the
+// event to other servers sharing the database, when the backend supports it.
+type EventStore interface {
+	Create(record *models.EventRecord) error
+	FindByID(id uint) (*models.EventRecord, error)
+	FindSince(afterID uint, limit int) ([]models.EventRecord, error)
+	LatestID() (uint, error)
+}
+
+// ChangeStore is the storage used for the change feed. Every change to an
+// account, group or membership takes the next sequence number, and deletions
+// leave a tombstone. FindChangesSince reads up to limit records of each kind
+// with a higher number than since from one snapshot, in sequence order.
+type ChangeStore interface {
+	FindChangesSince(since int64, limit int) (*models.ChangeSet, error)
+}
+
+// HostStore is the storage used for hosts, host groups and their access
+// rules, and for the reports sent by host agents. Deleting a host or host
+// group also deletes its memberships, and a host group's access rules.
+type HostStore interface {
+	Create(host *models.Host) error
+	FindByID(id uint) (*models.Host, error)
+	FindByTokenHash(tokenHash string) (*models.Host, error)
+	FindAll() ([]models.Host, error)
+	Update(host *models.Host) error
+	Delete(id uint) error
+	CreateHostGroup(hostGroup *models.HostGroup) error
+	FindHostGroupByID(id uint) (*models.HostGroup, error)
+	FindAllHostGroups() ([]models.HostGroup, error)
+	UpdateHostGroup(hostGroup *models.HostGroup) error
+	DeleteHostGroup(id uint) error
+	AddToHostGroup(hostGroupID, hostID uint) error
+	RemoveFromHostGroup(hostGroupID, hostID uint) error
+	FindHostsInGroup(hostGroupID uint) ([]models.Host, error)
+	FindHostGroupsOfHost(hostID uint) ([]models.HostGroup, error)
+	CreateAccessRule(rule *models.AccessRule) error
+	FindAccessRuleByID(id uint) (*models.AccessRule, error)
+	FindAccessRules(hostGroupIDs []uint) ([]models.AccessRule, error)
+	DeleteAccessRule(id uint) error
+	CreateReport(report *models.HostReport) error
+	FindReports(hostname string, limit int) ([]models.HostReport, error)
+}
+
+// NetgroupStore is the storage used for netgroups
+type NetgroupStore interface {
+	Create(netgroup *models.Netgroup) error
+	FindByID(id uint) (*models.Netgroup, error)
+	FindByName(name string) (*models.Netgroup, error)
+	FindAll() ([]models.Netgroup, error)
+	Update(netgroup *models.Netgroup) error
+	Delete(id uint) error
+}
+
+// SudoStore is the storage used for sudo rules
+type SudoStore interface {
+	Create(rule *models.SudoRule) error
+	FindByID(id uint) (*models.SudoRule, error)
+	FindAll() ([]models.SudoRule, error)
+	Update(rule *models.SudoRule) error
+	Delete(id uint) error
+}
+
+// SubIDStore is the storage used for subordinate ID blocks
+type SubIDStore interface {
+	Create(block *models.SubIDRange) error
+	FindByAccountID(accountID uint) (*models.SubIDRange, error)
+	FindAll() ([]models.SubIDRange, error)
+	DeleteByAccountID(accountID uint) error
+}
+
+// SessionStore is the storage used for login sessions
+type SessionStore interface {
+	Create(session *models.Session) error
+	FindByID(id uint) (*models.Session, error)
+	FindByTokenKey(key string) (*models.Session, error)
+	FindByUserID(userID uint) ([]models.Session, error)
+	Rotate(id uint, oldHash, newHash string) error
+	Revoke(id uint) error
+	RevokeByUserID(userID, exceptID uint) error
+	DeleteExpired(before time.Time) error
+}
+
+// LoginAttemptStore is the storage used for counting failed logins
+type LoginAttemptStore interface {
+	Find(kind, subject string) (*models.LoginAttempt, error)
+	FindLocked(at time.Time) ([]models.LoginAttempt, error)
+	RecordFailure(kind, subject string, at time.Time) (*models.LoginAttempt, error)
+	Lock(id uint, until time.Time) error
+	Delete(kind, subject string) error
+	DeleteStale(before time.Time) error
+}
+
+// TOTPChallengeStore is the storage used for logins waiting for a TOTP code
+type TOTPChallengeStore interface {
+	Create(challenge *models.TOTPChallenge) error
+	FindByTokenHash(hash string) (*models.TOTPChallenge, error)
+	AddAttempt(id uint, max int) (bool, error)
+	Delete(id uint) error
+	DeleteExpired(before time.Time) error
+}
+
+// TOTPRecoveryCodeStore is the storage used for TOTP recovery codes
+type TOTPRecoveryCodeStore interface {
+	Replace(userID uint, hashes []string) error
+	Use(userID uint, hash string, at time.Time) (bool, error)
+	CountUnused(userID uint) (int64, error)
+	DeleteByUser(userID uint) error
+}
+
+// SearchStore is the storage used for searching accounts and groups together
+type SearchStore interface {
+	Search(query string, limit int) ([]models.SearchResult, error)
+}
+
+// SavedSearchStore is the storage used for saved searches
+type SavedSearchStore interface {
+	Create(search *models.SavedSearch) error
+	FindByID(id uint) (*models.SavedSearch, error)
+	FindByUser(userID uint) ([]models.SavedSearch, error)
+	Update(search *models.SavedSearch) error
+	Delete(id uint) error
+}
+
+// Make sure the database repositories satisfy the interfaces
+var (
+	_ AccountStore          = (*AccountRepository)(nil)
+	_ GroupStore            = (*GroupRepository)(nil)
+	_ AuditStore            = (*AuditRepository)(nil)
+	_ UserStore             = (*UserRepository)(nil)
+	_ WebhookStore          = (*WebhookRepository)(nil)
+	_ EventStore            = (*EventRepository)(nil)
+	_ ChangeStore           = (*ChangeRepository)(nil)
+	_ HostStore             = (*HostRepository)(nil)
+	_ NetgroupStore         = (*NetgroupRepository)(nil)
+	_ SudoStore             = (*SudoRepository)(nil)
+	_ SubIDStore            = (*SubIDRepository)(nil)
+	_ SessionStore          = (*SessionRepository)(nil)
+	_ LoginAttemptStore     = (*LoginAttemptRepository)(nil)
+	_ TOTPChallengeStore    = (*TOTPChallengeRepository)(nil)
+	_ TOTPRecoveryCodeStore = (*TOTPRecoveryCodeRepository)(nil)
+	_ SearchStore           = (*SearchRepository)(nil)
+	_ SavedSearchStore      = (*SavedSearchRepository)(nil)
+)
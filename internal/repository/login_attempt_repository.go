@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/home/unixify/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LoginAttemptRepository handles database operations for failed login
+// counters, which every server shares
+type LoginAttemptRepository struct {
+	db *gorm.DB
+}
+
+// NewLoginAttemptRepository creates a new login attempt repository
+func NewLoginAttemptRepository(db *gorm.DB) *LoginAttemptRepository {
+	return &LoginAttemptRepository{
+		db: db,
+	}
+}
+
+// Find finds the counter of a username or IP address; it returns nil if
+// there is none
+func (r *LoginAttemptRepository) Find(kind, subject string) (*models.LoginAttempt, error) {
+	var attempt models.LoginAttempt
+	err := r.db.Where("kind = ? AND subject = ?", kind, subject).First(&attempt).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &attempt, nil
+}
+
+// FindLocked finds the counters that refuse logins at a time
+func (r *LoginAttemptRepository) FindLocked(at time.Time) ([]models.LoginAttempt, error) {
+	var attempts []models.LoginAttempt
+	err := r.db.Where("locked_until > ?", at).Order("kind, subject").Find(&attempts).Error
+	if err != nil {
+		return nil, err
+	}
+	return attempts, nil
+}
+
+// RecordFailure adds a failure to the counter of a username or IP address,
+// creating it if needed, and returns the counter. The increment happens in
+// the database, so failures on different servers are all counted.
+func (r *LoginAttemptRepository) RecordFailure(kind, subject string, at time.Time) (*models.LoginAttempt, error) {
+	attempt := models.LoginAttempt{Kind: kind, Subject: subject, Failures: 1, LastFailureAt: at, LockedUntil: at}
+	err := r.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "kind"}, {Name: "subject"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"failures":        gorm.Expr("login_attempts.failures + 1"),
+			"last_failure_at": at,
+		}),
+	}).Create(&attempt).Error
+	if err != nil {
+		return nil, err
+	}
+	return r.Find(kind, subject)
+}
+
+// Lock refuses logins until a time, unless they are already refused for longer
+func (r *LoginAttemptRepository) Lock(id uint, until time.Time) error {
+	return r.db.Model(&models.LoginAttempt{}).
+		Where("id = ? AND locked_until < ?", id, until).
+		Update("locked_until", until).Error
+}
+
+// Delete forgets the failures of a username or IP address
+func (r *LoginAttemptRepository) Delete(kind, subject string) error {
+	return r.db.Where("kind = ? AND subject = ?", kind, subject).Delete(&models.LoginAttempt{}).Error
+}
+
+// DeleteStale forgets the counters whose last failure and lock both ended
+// before a time
+func (r *LoginAttemptRepository) DeleteStale(before time.Time) error {
+	return r.db.Where("last_failure_at < ? AND locked_until < ?", before, before).Delete(&models.LoginAttempt{}).Error
+}
@@ -0,0 +1,2295 @@
+// Package memory implements the repository interfaces in memory. It keeps the
+// uniqueness rules of the database schema so services can be tested without one.
+package memory
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/home/unixify/internal/models"
+	"github.com/home/unixify/internal/query"
+	"github.com/home/unixify/internal/repository"
+	"github.com/home/unixify/internal/search"
+	"gorm.io/gorm"
+)
+
+// Store holds the tables shared by the in-memory repositories
+type Store struct {
+	mu          sync.Mutex
+	accounts    map[uint]models.Account
+	groups      map[uint]models.Group
+	memberships map[uint]models.AccountGroup
+	audit       map[uint]models.AuditEntry
+	users       map[uint]models.User
+	webhooks    map[uint]models.Webhook
+	deliveries  map[uint]models.WebhookDelivery
+	events      map[uint]models.EventRecord
+	tombstones  []models.Tombstone
+	changeSeq   int64
+	hostReports []models.HostReport
+	hosts       map[uint]models.Host
+	hostGroups  map[uint]models.HostGroup
+	hostMembers map[uint]models.HostGroupMember
+	accessRules map[uint]models.AccessRule
+	netgroups   map[uint]models.Netgroup
+	sudoRules   map[uint]models.SudoRule
+	subIDs      map[uint]models.SubIDRange
+	sessions    map[uint]models.Session
+	logins      map[uint]models.LoginAttempt
+	challenges  map[uint]models.TOTPChallenge
+	recovery    map[uint]models.TOTPRecoveryCode
+	saved       map[uint]models.SavedSearch
+	nextID      map[string]uint
+}
+
+// NewStore creates an empty store
+func NewStore() *Store {
+	return &Store{
+		accounts:    make(map[uint]models.Account),
+		groups:      make(map[uint]models.Group),
+		memberships: make(map[uint]models.AccountGroup),
+		audit:       make(map[uint]models.AuditEntry),
+		users:       make(map[uint]models.User),
+		webhooks:    make(map[uint]models.Webhook),
+		deliveries:  make(map[uint]models.WebhookDelivery),
+		events:      make(map[uint]models.EventRecord),
+		hosts:       make(map[uint]models.Host),
+		hostGroups:  make(map[uint]models.HostGroup),
+		hostMembers: make(map[uint]models.HostGroupMember),
+		accessRules: make(map[uint]models.AccessRule),
+		netgroups:   make(map[uint]models.Netgroup),
+		sudoRules:   make(map[uint]models.SudoRule),
+		subIDs:      make(map[uint]models.SubIDRange),
+		sessions:    make(map[uint]models.Session),
+		logins:      make(map[uint]models.LoginAttempt),
+		challenges:  make(map[uint]models.TOTPChallenge),
+		recovery:    make(map[uint]models.TOTPRecoveryCode),
+		saved:       make(map[uint]models.SavedSearch),
+		nextID:      make(map[string]uint),
+	}
+}
+
+// NewRepositories creates repositories backed by a new store.
+// Reservations are not part of the in-memory implementation.
+func NewRepositories() *repository.Repositories {
+	store := NewStore()
+	return &repository.Repositories{
+		Account:     store.Accounts(),
+		Group:       store.Groups(),
+		Audit:       store.Audit(),
+		Webhook:     store.Webhooks(),
+		Event:       store.Events(),
+		Change:      store.Changes(),
+		Host:        store.Hosts(),
+		Netgroup:    store.Netgroups(),
+		Sudo:        store.Sudo(),
+		SubID:       store.SubIDs(),
+		Search:      store.Search(),
+		SavedSearch: store.SavedSearches(),
+		Session:     store.Sessions(),
+		User:        store.Users(),
+		Login:       store.LoginAttempts(),
+		TOTP:        store.TOTPChallenges(),
+		Recovery:    store.TOTPRecoveryCodes(),
+	}
+}
+
+// Accounts returns the account repository of the store
+func (s *Store) Accounts() *AccountRepository {
+	return &AccountRepository{store: s}
+}
+
+// Groups returns the group repository of the store
+func (s *Store) Groups() *GroupRepository {
+	return &GroupRepository{store: s}
+}
+
+// Audit returns the audit repository of the store
+func (s *Store) Audit() *AuditRepository {
+	return &AuditRepository{store: s}
+}
+
+// Webhooks returns the webhook repository of the store
+func (s *Store) Webhooks() *WebhookRepository {
+	return &WebhookRepository{store: s}
+}
+
+// Events returns the event log repository of the store
+func (s *Store) Events() *EventRepository {
+	return &EventRepository{store: s}
+}
+
+// Changes returns the change feed repository of the store
+func (s *Store) Changes() *ChangeRepository {
+	return &ChangeRepository{store: s}
+}
+
+// Hosts returns the host report repository of the store
+func (s *Store) Hosts() *HostRepository {
+	return &HostRepository{store: s}
+}
+
+// Netgroups returns the netgroup repository of the store
+func (s *Store) Netgroups() *NetgroupRepository {
+	return &NetgroupRepository{store: s}
+}
+
+// Sudo returns the sudo rule repository of the store
+func (s *Store) Sudo() *SudoRepository {
+	return &SudoRepository{store: s}
+}
+
+// SubIDs returns the subordinate ID repository of the store
+func (s *Store) SubIDs() *SubIDRepository {
+	return &SubIDRepository{store: s}
+}
+
+// Sessions returns the session repository of the store
+func (s *Store) Sessions() *SessionRepository {
+	return &SessionRepository{store: s}
+}
+
+// Search returns the search repository of the store
+func (s *Store) Search() *SearchRepository {
+	return &SearchRepository{store: s}
+}
+
+// SavedSearches returns the saved search repository of the store
+func (s *Store) SavedSearches() *SavedSearchRepository {
+	return &SavedSearchRepository{store: s}
+}
+
+// LoginAttempts returns the login attempt repository of the store
+func (s *Store) LoginAttempts() *LoginAttemptRepository {
+	return &LoginAttemptRepository{store: s}
+}
+
+// TOTPChallenges returns the TOTP challenge repository of the store
+func (s *Store) TOTPChallenges() *TOTPChallengeRepository {
+	return &TOTPChallengeRepository{store: s}
+}
+
+// TOTPRecoveryCodes returns the TOTP recovery code repository of the store
+func (s *Store) TOTPRecoveryCodes() *TOTPRecoveryCodeRepository {
+	return &TOTPRecoveryCodeRepository{store: s}
+}
+
+// Users returns the user repository of the store
+func (s *Store) Users() *UserRepository {
+	return &UserRepository{store: s}
+}
+
+// allocateID returns the next auto-increment ID for a table
+func (s *Store) allocateID(table string) uint {
+	s.nextID[table]++
+	return s.nextID[table]
+}
+
+// nextChangeSeq returns the next change sequence number
+func (s *Store) nextChangeSeq() int64 {
+	s.changeSeq++
+	return s.changeSeq
+}
+
+// bury records the deletion of a record for the change feed
+func (s *Store) bury(tombstone models.Tombstone) {
+	tombstone.ID = s.allocateID("tombstones")
+	tombstone.ChangeSeq = s.nextChangeSeq()
+	tombstone.CreatedAt = time.Now()
+	s.tombstones = append(s.tombstones, tombstone)
+}
+
+// deleteMembership deletes a membership row and leaves its tombstone
+func (s *Store) deleteMembership(membership models.AccountGroup) {
+	delete(s.memberships, membership.ID)
+	s.bury(models.Tombstone{
+		Kind:      models.TombstoneMembership,
+		EntityID:  membership.ID,
+		AccountID: membership.AccountID,
+		GroupID:   membership.GroupID,
+	})
+}
+
+// loadPrimaryGroup fills in the primary group like the database repository does
+func (s *Store) loadPrimaryGroup(account *models.Account) {
+	if account.PrimaryGroupID == 0 {
+		return
+	}
+	if group, ok := s.groups[account.PrimaryGroupID]; ok {
+		account.PrimaryGroup = &group
+	}
+}
+
+// sortedAccounts returns accounts matching the filter ordered by ID
+func (s *Store) sortedAccounts(match func(models.Account) bool) []models.Account {
+	accounts := []models.Account{}
+	for _, account := range s.accounts {
+		if match(account) {
+			accounts = append(accounts, account)
+		}
+	}
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].ID < accounts[j].ID })
+	return accounts
+}
+
+// sortedGroups returns groups matching the filter ordered by ID
+func (s *Store) sortedGroups(match func(models.Group) bool) []models.Group {
+	groups := []models.Group{}
+	for _, group := range s.groups {
+		if match(group) {
+			groups = append(groups, group)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].ID < groups[j].ID })
+	return groups
+}
+
+// sortedMemberships returns memberships ordered by account, group and ID
+func (s *Store) sortedMemberships() []models.AccountGroup {
+	memberships := make([]models.AccountGroup, 0, len(s.memberships))
+	for _, membership := range s.memberships {
+		memberships = append(memberships, membership)
+	}
+	sort.Slice(memberships, func(i, j int) bool {
+		a, b := memberships[i], memberships[j]
+		if a.AccountID != b.AccountID {
+			return a.AccountID < b.AccountID
+		}
+		if a.GroupID != b.GroupID {
+			return a.GroupID < b.GroupID
+		}
+		return a.ID < b.ID
+	})
+	return memberships
+}
+
+// AccountRepository stores accounts and memberships in memory
+type AccountRepository struct {
+	store *Store
+}
+
+// checkUnique enforces the unique username and UID columns
+func (r *AccountRepository) checkUnique(account *models.Account) error {
+	for _, existing := range r.store.accounts {
+		if existing.ID == account.ID {
+			continue
+		}
+		if existing.Username == account.Username {
+			return fmt.Errorf("duplicate key value violates unique constraint: accounts.username %s", account.Username)
+		}
+		if existing.UnixUID == account.UnixUID {
+			return fmt.Errorf("duplicate key value violates unique constraint: accounts.unixuid %d", account.UnixUID)
+		}
+	}
+	return nil
+}
+
+// Create creates a new account
+func (r *AccountRepository) Create(account *models.Account) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	account.ID = 0
+	if err := r.checkUnique(account); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	account.ID = r.store.allocateID("accounts")
+	if account.CreatedAt.IsZero() {
+		account.CreatedAt = now
+	}
+	account.UpdatedAt = now
+	account.Version = 1
+	account.ChangeSeq = r.store.nextChangeSeq()
+	// The active column defaults to true and a false value is not written on create
+	account.Active = true
+
+	stored := *account
+	stored.PrimaryGroup = nil
+	r.store.accounts[account.ID] = stored
+	return nil
+}
+
+// IsUIDDuplicate checks if a UID already exists
+func (r *AccountRepository) IsUIDDuplicate(uid int, excludeID uint) (bool, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for _, account := range r.store.accounts {
+		if account.UnixUID == uid && account.ID != excludeID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// GetLatestUID returns the next available UID for a specific account type
+func (r *AccountRepository) GetLatestUID(accountType models.AccountType) (int, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	highest, found := 0, false
+	for _, account := range r.store.accounts {
+		if account.Type == accountType && (!found || account.UnixUID > highest) {
+			highest, found = account.UnixUID, true
+		}
+	}
+	if found {
+		return highest + 1, nil
+	}
+
+	switch accountType {
+	case models.AccountTypeSystem:
+		return 9000, nil
+	case models.AccountTypeService:
+		return 60001, nil
+	case models.AccountTypeDatabase:
+		return 70000, nil
+	default:
+		return 1000, nil
+	}
+}
+
+// FindByID finds an account by ID
+func (r *AccountRepository) FindByID(id uint) (*models.Account, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	account, ok := r.store.accounts[id]
+	if !ok {
+		return nil, fmt.Errorf("account with ID %d not found", id)
+	}
+	r.store.loadPrimaryGroup(&account)
+	return &account, nil
+}
+
+// FindByUID finds an account by UID
+func (r *AccountRepository) FindByUID(uid int) (*models.Account, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for _, account := range r.store.accounts {
+		if account.UnixUID == uid {
+			return &account, nil
+		}
+	}
+	return nil, fmt.Errorf("account with UID %d not found", uid)
+}
+
+// FindByUsername finds an account by username
+func (r *AccountRepository) FindByUsername(username string) (*models.Account, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for _, account := range r.store.accounts {
+		if account.Username == username {
+			return &account, nil
+		}
+	}
+	return nil, fmt.Errorf("account with username %s not found", username)
+}
+
+// IsUsernameDeleted reports whether a deleted account had the username
+func (r *AccountRepository) IsUsernameDeleted(username string) (bool, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for _, tombstone := range r.store.tombstones {
+		if tombstone.Kind == models.TombstoneAccount && tombstone.Name == username {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// FindAll finds all accounts with optional filtering by type
+func (r *AccountRepository) FindAll(accountType models.AccountType) ([]models.Account, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	accounts := r.store.sortedAccounts(func(account models.Account) bool {
+		return accountType == "" || account.Type == accountType
+	})
+	for i := range accounts {
+		r.store.loadPrimaryGroup(&accounts[i])
+	}
+	return accounts, nil
+}
+
+// Update updates an account, provided its version still matches
+func (r *AccountRepository) Update(account *models.Account) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	existing, ok := r.store.accounts[account.ID]
+	if !ok {
+		return fmt.Errorf("account with ID %d not found", account.ID)
+	}
+	if err := r.checkUnique(account); err != nil {
+		return fmt.Errorf("failed to update account: %w", err)
+	}
+	if existing.Version != account.Version {
+		return repository.ErrVersionMismatch
+	}
+
+	account.UpdatedAt = time.Now()
+	account.Version++
+	account.ChangeSeq = r.store.nextChangeSeq()
+	stored := *account
+	stored.PrimaryGroup = nil
+	r.store.accounts[account.ID] = stored
+	return nil
+}
+
+// Delete deletes an account; its memberships are left behind like in the database
+func (r *AccountRepository) Delete(id uint, version int) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	existing, ok := r.store.accounts[id]
+	if !ok {
+		if version != 0 {
+			return fmt.Errorf("account with ID %d not found", id)
+		}
+		return nil
+	}
+	if version != 0 && existing.Version != version {
+		return repository.ErrVersionMismatch
+	}
+	delete(r.store.accounts, id)
+	r.store.bury(models.Tombstone{Kind: models.TombstoneAccount, EntityID: id, Name: existing.Username})
+	return nil
+}
+
+// FindByGroupID finds all accounts in a specific group
+func (r *AccountRepository) FindByGroupID(groupID uint) ([]models.Account, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	accounts := []models.Account{}
+	for _, membership := range r.store.sortedMemberships() {
+		if membership.GroupID != groupID {
+			continue
+		}
+		if account, ok := r.store.accounts[membership.AccountID]; ok {
+			accounts = append(accounts, account)
+		}
+	}
+	return accounts, nil
+}
+
+// AssignToGroup assigns an account to a group
+func (r *AccountRepository) AssignToGroup(accountID, groupID uint) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for _, membership := range r.store.memberships {
+		if membership.AccountID == accountID && membership.GroupID == groupID {
+			return fmt.Errorf("account is already a member of this group")
+		}
+	}
+
+	id := r.store.allocateID("account_groups")
+	r.store.memberships[id] = models.AccountGroup{
+		ID:        id,
+		CreatedAt: time.Now(),
+		AccountID: accountID,
+		GroupID:   groupID,
+		ChangeSeq: r.store.nextChangeSeq(),
+	}
+	return nil
+}
+
+// RemoveFromGroup removes an account from a group
+func (r *AccountRepository) RemoveFromGroup(accountID, groupID uint) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for _, membership := range r.store.sortedMemberships() {
+		if membership.AccountID == accountID && membership.GroupID == groupID {
+			r.store.deleteMembership(membership)
+		}
+	}
+	return nil
+}
+
+// FindAllMemberships returns every account/group membership
+func (r *AccountRepository) FindAllMemberships() ([]models.AccountGroup, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	return r.store.sortedMemberships(), nil
+}
+
+// DeleteMembership deletes a single membership row by its ID
+func (r *AccountRepository) DeleteMembership(id uint) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if membership, ok := r.store.memberships[id]; ok {
+		r.store.deleteMembership(membership)
+	}
+	return nil
+}
+
+// FindByQuery finds the accounts matching a parsed query
+func (r *AccountRepository) FindByQuery(q *query.Query) ([]models.Account, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	groups := make(map[uint][]string)
+	for _, membership := range r.store.sortedMemberships() {
+		groups[membership.AccountID] = append(groups[membership.AccountID], r.store.groups[membership.GroupID].Groupname)
+	}
+	return r.store.sortedAccounts(func(account models.Account) bool {
+		record := query.AccountRecord{Account: account, Groups: groups[account.ID]}
+		if group, ok := r.store.groups[account.PrimaryGroupID]; ok {
+			record.PrimaryGroup = &group
+		}
+		return q.MatchAccount(record)
+	}), nil
+}
+
+// GroupRepository stores groups in memory
+type GroupRepository struct {
+	store *Store
+}
+
+// checkUnique enforces the unique groupname and GID columns
+func (r *GroupRepository) checkUnique(group *models.Group) error {
+	for _, existing := range r.store.groups {
+		if existing.ID == group.ID {
+			continue
+		}
+		if existing.Groupname == group.Groupname {
+			return fmt.Errorf("duplicate key value violates unique constraint: groups.groupname %s", group.Groupname)
+		}
+		if existing.UnixGID == group.UnixGID {
+			return fmt.Errorf("duplicate key value violates unique constraint: groups.unixgid %d", group.UnixGID)
+		}
+	}
+	return nil
+}
+
+// Create creates a new group
+func (r *GroupRepository) Create(group *models.Group) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	group.ID = 0
+	if err := r.checkUnique(group); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	group.ID = r.store.allocateID("groups")
+	if group.CreatedAt.IsZero() {
+		group.CreatedAt = now
+	}
+	group.UpdatedAt = now
+	group.Version = 1
+	group.ChangeSeq = r.store.nextChangeSeq()
+	// The active column defaults to true and a false value is not written on create
+	group.Active = true
+
+	r.store.groups[group.ID] = *group
+	return nil
+}
+
+// IsGIDDuplicate checks if a GID already exists
+func (r *GroupRepository) IsGIDDuplicate(gid int, excludeID uint) (bool, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for _, group := range r.store.groups {
+		if group.UnixGID == gid && group.ID != excludeID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// GetLatestGID returns the next available GID for a specific group type
+func (r *GroupRepository) GetLatestGID(groupType models.GroupType) (int, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	highest, found := 0, false
+	for _, group := range r.store.groups {
+		if group.Type == groupType && (!found || group.UnixGID > highest) {
+			highest, found = group.UnixGID, true
+		}
+	}
+	if found {
+		return highest + 1, nil
+	}
+
+	switch groupType {
+	case models.GroupTypeSystem:
+		return 9000, nil
+	case models.GroupTypeService:
+		return 60001, nil
+	case models.GroupTypeDatabase:
+		return 70000, nil
+	default:
+		return 1000, nil
+	}
+}
+
+// FindByID finds a group by ID
+func (r *GroupRepository) FindByID(id uint) (*models.Group, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	group, ok := r.store.groups[id]
+	if !ok {
+		return nil, fmt.Errorf("group with ID %d not found", id)
+	}
+	return &group, nil
+}
+
+// FindByGID finds a group by GID
+func (r *GroupRepository) FindByGID(gid int) (*models.Group, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for _, group := range r.store.groups {
+		if group.UnixGID == gid {
+			return &group, nil
+		}
+	}
+	return nil, fmt.Errorf("group with GID %d not found", gid)
+}
+
+// FindByGroupname finds a group by groupname
+func (r *GroupRepository) FindByGroupname(groupname string) (*models.Group, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for _, group := range r.store.groups {
+		if group.Groupname == groupname {
+			return &group, nil
+		}
+	}
+	return nil, fmt.Errorf("group with groupname %s not found", groupname)
+}
+
+// FindAll finds all groups with optional filtering by type
+func (r *GroupRepository) FindAll(groupType models.GroupType) ([]models.Group, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	return r.store.sortedGroups(func(group models.Group) bool {
+		return groupType == "" || group.Type == groupType
+	}), nil
+}
+
+// Update updates a group, provided its version still matches
+func (r *GroupRepository) Update(group *models.Group) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	existing, ok := r.store.groups[group.ID]
+	if !ok {
+		return fmt.Errorf("group with ID %d not found", group.ID)
+	}
+	if err := r.checkUnique(group); err != nil {
+		return err
+	}
+	if existing.Version != group.Version {
+		return repository.ErrVersionMismatch
+	}
+
+	group.UpdatedAt = time.Now()
+	group.Version++
+	group.ChangeSeq = r.store.nextChangeSeq()
+	r.store.groups[group.ID] = *group
+	return nil
+}
+
+// Delete deletes a group; its memberships are left behind like in the database
+func (r *GroupRepository) Delete(id uint, version int) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	existing, ok := r.store.groups[id]
+	if !ok {
+		if version != 0 {
+			return fmt.Errorf("group with ID %d not found", id)
+		}
+		return nil
+	}
+	if version != 0 && existing.Version != version {
+		return repository.ErrVersionMismatch
+	}
+	delete(r.store.groups, id)
+	r.store.bury(models.Tombstone{Kind: models.TombstoneGroup, EntityID: id, Name: existing.Groupname})
+	return nil
+}
+
+// FindByAccountID finds all groups that an account is a member of
+func (r *GroupRepository) FindByAccountID(accountID uint) ([]models.Group, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	groups := []models.Group{}
+	for _, membership := range r.store.sortedMemberships() {
+		if membership.AccountID != accountID {
+			continue
+		}
+		if group, ok := r.store.groups[membership.GroupID]; ok {
+			groups = append(groups, group)
+		}
+	}
+	return groups, nil
+}
+
+// GetAccountsInGroup returns all accounts in a group
+func (r *GroupRepository) GetAccountsInGroup(groupID uint) ([]models.Account, error) {
+	return r.store.Accounts().FindByGroupID(groupID)
+}
+
+// FindByQuery finds the groups matching a parsed query
+func (r *GroupRepository) FindByQuery(q *query.Query) ([]models.Group, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	members := make(map[uint][]string)
+	for _, membership := range r.store.sortedMemberships() {
+		members[membership.GroupID] = append(members[membership.GroupID], r.store.accounts[membership.AccountID].Username)
+	}
+	return r.store.sortedGroups(func(group models.Group) bool {
+		return q.MatchGroup(query.GroupRecord{Group: group, Members: members[group.ID]})
+	}), nil
+}
+
+// AuditRepository stores audit entries in memory
+type AuditRepository struct {
+	store *Store
+}
+
+// Create creates a new audit entry
+func (r *AuditRepository) Create(entry *models.AuditEntry) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	entry.ID = r.store.allocateID("audit_entries")
+	r.store.audit[entry.ID] = *entry
+	return nil
+}
+
+// FindAll retrieves all audit entries with optional filtering, newest first
+func (r *AuditRepository) FindAll(entityType, action string, entityID, userID uint) ([]models.AuditEntry, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	entries := []models.AuditEntry{}
+	for _, entry := range r.store.audit {
+		if entityType != "" && entry.EntityType != entityType {
+			continue
+		}
+		if action != "" && entry.Action != action {
+			continue
+		}
+		if entityID != 0 && entry.EntityID != entityID {
+			continue
+		}
+		if userID != 0 && entry.UserID != userID {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].Timestamp.Equal(entries[j].Timestamp) {
+			return entries[i].Timestamp.After(entries[j].Timestamp)
+		}
+		return entries[i].ID > entries[j].ID
+	})
+	return entries, nil
+}
+
+// FindByID finds an audit entry by ID
+func (r *AuditRepository) FindByID(id uint) (*models.AuditEntry, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	entry, ok := r.store.audit[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &entry, nil
+}
+
+// UserRepository stores the users who log in in memory
+type UserRepository struct {
+	store *Store
+}
+
+// findUser returns the stored user matching the predicate
+func (r *UserRepository) findUser(match func(models.User) bool) (*models.User, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for _, user := range r.store.users {
+		if match(user) {
+			return &user, nil
+		}
+	}
+	return nil, nil
+}
+
+// checkUnique returns an error if another user has the username or email
+func (r *UserRepository) checkUnique(user *models.User) error {
+	for _, existing := range r.store.users {
+		if existing.ID == user.ID {
+			continue
+		}
+		if existing.Username == user.Username {
+			return fmt.Errorf("duplicate key value violates unique constraint: users.username %s", user.Username)
+		}
+		if existing.Email == user.Email {
+			return fmt.Errorf("duplicate key value violates unique constraint: users.email %s", user.Email)
+		}
+	}
+	return nil
+}
+
+// Create creates a new user; its password must already be hashed
+func (r *UserRepository) Create(user *models.User) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if err := r.checkUnique(user); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	user.ID = r.store.allocateID("users")
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	if user.Role == "" {
+		user.Role = "user"
+	}
+	// active defaults to true and a false value is not written on create
+	user.Active = true
+
+	r.store.users[user.ID] = *user
+	return nil
+}
+
+// FindByID finds a user by ID; a missing user is nil without error
+func (r *UserRepository) FindByID(id uint) (*models.User, error) {
+	return r.findUser(func(user models.User) bool { return user.ID == id })
+}
+
+// FindByUsername finds a user by username; a missing user is nil without error
+func (r *UserRepository) FindByUsername(username string) (*models.User, error) {
+	return r.findUser(func(user models.User) bool { return user.Username == username })
+}
+
+// FindByEmail finds a user by email; a missing user is nil without error
+func (r *UserRepository) FindByEmail(email string) (*models.User, error) {
+	return r.findUser(func(user models.User) bool { return user.Email == email })
+}
+
+// ClaimTOTPStep records that a TOTP code of a time step was used. It
+// returns false if a code of that step or a later one was used before.
+func (r *UserRepository) ClaimTOTPStep(id uint, step int64) (bool, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	user, ok := r.store.users[id]
+	if !ok || user.TOTPLastStep >= step {
+		return false, nil
+	}
+	user.TOTPLastStep = step
+	r.store.users[id] = user
+	return true, nil
+}
+
+// Update saves every field of a user
+func (r *UserRepository) Update(user *models.User) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.users[user.ID]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	if err := r.checkUnique(user); err != nil {
+		return err
+	}
+	user.UpdatedAt = time.Now()
+	r.store.users[user.ID] = *user
+	return nil
+}
+
+// WebhookRepository stores webhooks and their delivery queue in memory
+type WebhookRepository struct {
+	store *Store
+}
+
+// copyWebhook returns a webhook that shares no memory with the stored one
+func copyWebhook(webhook models.Webhook) models.Webhook {
+	webhook.EventTypes = append([]string(nil), webhook.EventTypes...)
+	return webhook
+}
+
+// Create creates a new webhook
+func (r *WebhookRepository) Create(webhook *models.Webhook) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	now := time.Now()
+	webhook.ID = r.store.allocateID("webhooks")
+	webhook.CreatedAt = now
+	webhook.UpdatedAt = now
+	r.store.webhooks[webhook.ID] = copyWebhook(*webhook)
+	return nil
+}
+
+// FindByID finds a webhook by ID
+func (r *WebhookRepository) FindByID(id uint) (*models.Webhook, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	webhook, ok := r.store.webhooks[id]
+	if !ok {
+		return nil, fmt.Errorf("webhook with ID %d not found", id)
+	}
+	webhook = copyWebhook(webhook)
+	return &webhook, nil
+}
+
+// FindAll finds all webhooks
+func (r *WebhookRepository) FindAll() ([]models.Webhook, error) {
+	return r.find(func(models.Webhook) bool { return true }), nil
+}
+
+// FindActive finds the webhooks that receive events
+func (r *WebhookRepository) FindActive() ([]models.Webhook, error) {
+	return r.find(func(webhook models.Webhook) bool { return webhook.Active }), nil
+}
+
+// find returns the webhooks matching the filter ordered by ID
+func (r *WebhookRepository) find(match func(models.Webhook) bool) []models.Webhook {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	webhooks := []models.Webhook{}
+	for _, webhook := range r.store.webhooks {
+		if match(webhook) {
+			webhooks = append(webhooks, copyWebhook(webhook))
+		}
+	}
+	sort.Slice(webhooks, func(i, j int) bool { return webhooks[i].ID < webhooks[j].ID })
+	return webhooks
+}
+
+// Update updates a webhook
+func (r *WebhookRepository) Update(webhook *models.Webhook) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.webhooks[webhook.ID]; !ok {
+		return fmt.Errorf("webhook with ID %d not found", webhook.ID)
+	}
+	webhook.UpdatedAt = time.Now()
+	r.store.webhooks[webhook.ID] = copyWebhook(*webhook)
+	return nil
+}
+
+// Delete deletes a webhook together with its deliveries
+func (r *WebhookRepository) Delete(id uint) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for deliveryID, delivery := range r.store.deliveries {
+		if delivery.WebhookID == id {
+			delete(r.store.deliveries, deliveryID)
+		}
+	}
+	delete(r.store.webhooks, id)
+	return nil
+}
+
+// CreateDelivery queues a delivery
+func (r *WebhookRepository) CreateDelivery(delivery *models.WebhookDelivery) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	now := time.Now()
+	delivery.ID = r.store.allocateID("webhook_deliveries")
+	delivery.CreatedAt = now
+	delivery.UpdatedAt = now
+	r.store.deliveries[delivery.ID] = *delivery
+	return nil
+}
+
+// FindDeliveries finds the deliveries of a webhook, newest first, optionally
+// filtered by status. A limit of 0 returns all of them.
+func (r *WebhookRepository) FindDeliveries(webhookID uint, status string, limit int) ([]models.WebhookDelivery, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	deliveries := []models.WebhookDelivery{}
+	for _, delivery := range r.store.deliveries {
+		if delivery.WebhookID == webhookID && (status == "" || delivery.Status == status) {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].ID > deliveries[j].ID })
+	if limit > 0 && len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, nil
+}
+
+// FindDueDeliveries finds pending deliveries whose next attempt is due, oldest first
+func (r *WebhookRepository) FindDueDeliveries(now time.Time, limit int) ([]models.WebhookDelivery, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	deliveries := []models.WebhookDelivery{}
+	for _, delivery := range r.store.deliveries {
+		if delivery.Status == models.DeliveryPending && !delivery.NextAttemptAt.After(now) {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		a, b := deliveries[i], deliveries[j]
+		if !a.NextAttemptAt.Equal(b.NextAttemptAt) {
+			return a.NextAttemptAt.Before(b.NextAttemptAt)
+		}
+		return a.ID < b.ID
+	})
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, nil
+}
+
+// ClaimDelivery starts an attempt unless another dispatcher claimed the delivery first
+func (r *WebhookRepository) ClaimDelivery(delivery *models.WebhookDelivery, until time.Time) (bool, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	stored, ok := r.store.deliveries[delivery.ID]
+	if !ok || stored.Status != models.DeliveryPending || stored.Attempts != delivery.Attempts {
+		return false, nil
+	}
+	stored.Attempts++
+	stored.NextAttemptAt = until
+	stored.UpdatedAt = time.Now()
+	r.store.deliveries[delivery.ID] = stored
+
+	delivery.Attempts = stored.Attempts
+	delivery.NextAttemptAt = until
+	return true, nil
+}
+
+// UpdateDelivery records the outcome of an attempt
+func (r *WebhookRepository) UpdateDelivery(delivery *models.WebhookDelivery) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.deliveries[delivery.ID]; !ok {
+		return fmt.Errorf("webhook delivery with ID %d not found", delivery.ID)
+	}
+	delivery.UpdatedAt = time.Now()
+	r.store.deliveries[delivery.ID] = *delivery
+	return nil
+}
+
+// EventRepository stores the event log in memory
+type EventRepository struct {
+	store *Store
+}
+
+// Create adds an event to the log
+func (r *EventRepository) Create(record *models.EventRecord) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.events[record.ID]; ok {
+		return fmt.Errorf("event with ID %d already exists", record.ID)
+	}
+	record.CreatedAt = time.Now()
+	r.store.events[record.ID] = *record
+	return nil
+}
+
+// FindByID finds an event by ID
+func (r *EventRepository) FindByID(id uint) (*models.EventRecord, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	record, ok := r.store.events[id]
+	if !ok {
+		return nil, fmt.Errorf("event with ID %d not found", id)
+	}
+	return &record, nil
+}
+
+// FindSince finds up to limit events with an ID above afterID, oldest first
+func (r *EventRepository) FindSince(afterID uint, limit int) ([]models.EventRecord, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	records := []models.EventRecord{}
+	for _, record := range r.store.events {
+		if record.ID > afterID {
+			records = append(records, record)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].ID < records[j].ID })
+	if len(records) > limit {
+		records = records[:limit]
+	}
+	return records, nil
+}
+
+// LatestID returns the ID of the newest event, or 0 when the log is empty
+func (r *EventRepository) LatestID() (uint, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	var latest uint
+	for id := range r.store.events {
+		if id > latest {
+			latest = id
+		}
+	}
+	return latest, nil
+}
+
+// ChangeRepository reads the change feed of the store
+type ChangeRepository struct {
+	store *Store
+}
+
+// FindChangesSince finds up to limit accounts, groups, memberships and
+// tombstones each that changed after since, in sequence order
+func (r *ChangeRepository) FindChangesSince(since int64, limit int) (*models.ChangeSet, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	changes := &models.ChangeSet{
+		Since:       since,
+		Accounts:    []models.Account{},
+		Groups:      []models.Group{},
+		Memberships: []models.AccountGroup{},
+		Tombstones:  []models.Tombstone{},
+	}
+	for _, account := range r.store.accounts {
+		if account.ChangeSeq > since {
+			changes.Accounts = append(changes.Accounts, account)
+		}
+	}
+	for _, group := range r.store.groups {
+		if group.ChangeSeq > since {
+			changes.Groups = append(changes.Groups, group)
+		}
+	}
+	for _, membership := range r.store.memberships {
+		if membership.ChangeSeq > since {
+			changes.Memberships = append(changes.Memberships, membership)
+		}
+	}
+	for _, tombstone := range r.store.tombstones {
+		if tombstone.ChangeSeq > since {
+			changes.Tombstones = append(changes.Tombstones, tombstone)
+		}
+	}
+
+	sort.Slice(changes.Accounts, func(i, j int) bool { return changes.Accounts[i].ChangeSeq < changes.Accounts[j].ChangeSeq })
+	sort.Slice(changes.Groups, func(i, j int) bool { return changes.Groups[i].ChangeSeq < changes.Groups[j].ChangeSeq })
+	sort.Slice(changes.Memberships, func(i, j int) bool { return changes.Memberships[i].ChangeSeq < changes.Memberships[j].ChangeSeq })
+	sort.Slice(changes.Tombstones, func(i, j int) bool { return changes.Tombstones[i].ChangeSeq < changes.Tombstones[j].ChangeSeq })
+	if len(changes.Accounts) > limit {
+		changes.Accounts = changes.Accounts[:limit]
+	}
+	if len(changes.Groups) > limit {
+		changes.Groups = changes.Groups[:limit]
+	}
+	if len(changes.Memberships) > limit {
+		changes.Memberships = changes.Memberships[:limit]
+	}
+	if len(changes.Tombstones) > limit {
+		changes.Tombstones = changes.Tombstones[:limit]
+	}
+	return changes, nil
+}
+
+// HostRepository stores hosts, host groups, access rules and host agent
+// reports in memory
+type HostRepository struct {
+	store *Store
+}
+
+// checkUniqueHost enforces the unique hostname and token hash columns
+func (r *HostRepository) checkUniqueHost(host *models.Host) error {
+	for _, existing := range r.store.hosts {
+		if existing.ID == host.ID {
+			continue
+		}
+		if existing.Hostname == host.Hostname {
+			return fmt.Errorf("duplicate key value violates unique constraint: hosts.hostname %s", host.Hostname)
+		}
+		if existing.TokenHash == host.TokenHash {
+			return fmt.Errorf("duplicate key value violates unique constraint: hosts.token_hash")
+		}
+	}
+	return nil
+}
+
+// Create creates a new host
+func (r *HostRepository) Create(host *models.Host) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	host.ID = 0
+	if err := r.checkUniqueHost(host); err != nil {
+		return err
+	}
+	now := time.Now()
+	host.ID = r.store.allocateID("hosts")
+	host.CreatedAt = now
+	host.UpdatedAt = now
+	r.store.hosts[host.ID] = *host
+	return nil
+}
+
+// FindByID finds a host by ID
+func (r *HostRepository) FindByID(id uint) (*models.Host, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	host, ok := r.store.hosts[id]
+	if !ok {
+		return nil, fmt.Errorf("host with ID %d not found", id)
+	}
+	return &host, nil
+}
+
+// FindByTokenHash finds the host a token belongs to
+func (r *HostRepository) FindByTokenHash(tokenHash string) (*models.Host, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for _, host := range r.store.hosts {
+		if host.TokenHash == tokenHash {
+			return &host, nil
+		}
+	}
+	return nil, fmt.Errorf("host not found")
+}
+
+// FindAll finds all hosts ordered by hostname
+func (r *HostRepository) FindAll() ([]models.Host, error) {
+	return r.findHosts(func(models.Host) bool { return true }), nil
+}
+
+// findHosts returns the hosts matching the filter ordered by hostname
+func (r *HostRepository) findHosts(match func(models.Host) bool) []models.Host {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	hosts := []models.Host{}
+	for _, host := range r.store.hosts {
+		if match(host) {
+			hosts = append(hosts, host)
+		}
+	}
+	sort.Slice(hosts, func(i, j int) bool { return hosts[i].Hostname < hosts[j].Hostname })
+	return hosts
+}
+
+// Update updates a host
+func (r *HostRepository) Update(host *models.Host) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.hosts[host.ID]; !ok {
+		return fmt.Errorf("host with ID %d not found", host.ID)
+	}
+	if err := r.checkUniqueHost(host); err != nil {
+		return err
+	}
+	host.UpdatedAt = time.Now()
+	r.store.hosts[host.ID] = *host
+	return nil
+}
+
+// Delete deletes a host and removes it from its host groups
+func (r *HostRepository) Delete(id uint) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for memberID, member := range r.store.hostMembers {
+		if member.HostID == id {
+			delete(r.store.hostMembers, memberID)
+		}
+	}
+	delete(r.store.hosts, id)
+	return nil
+}
+
+// CreateHostGroup creates a new host group
+func (r *HostRepository) CreateHostGroup(hostGroup *models.HostGroup) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for _, existing := range r.store.hostGroups {
+		if existing.Name == hostGroup.Name {
+			return fmt.Errorf("duplicate key value violates unique constraint: host_groups.name %s", hostGroup.Name)
+		}
+	}
+	now := time.Now()
+	hostGroup.ID = r.store.allocateID("host_groups")
+	hostGroup.CreatedAt = now
+	hostGroup.UpdatedAt = now
+	r.store.hostGroups[hostGroup.ID] = *hostGroup
+	return nil
+}
+
+// FindHostGroupByID finds a host group by ID
+func (r *HostRepository) FindHostGroupByID(id uint) (*models.HostGroup, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	hostGroup, ok := r.store.hostGroups[id]
+	if !ok {
+		return nil, fmt.Errorf("host group with ID %d not found", id)
+	}
+	return &hostGroup, nil
+}
+
+// FindAllHostGroups finds all host groups ordered by name
+func (r *HostRepository) FindAllHostGroups() ([]models.HostGroup, error) {
+	return r.findHostGroups(func(models.HostGroup) bool { return true }), nil
+}
+
+// findHostGroups returns the host groups matching the filter ordered by name
+func (r *HostRepository) findHostGroups(match func(models.HostGroup) bool) []models.HostGroup {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	hostGroups := []models.HostGroup{}
+	for _, hostGroup := range r.store.hostGroups {
+		if match(hostGroup) {
+			hostGroups = append(hostGroups, hostGroup)
+		}
+	}
+	sort.Slice(hostGroups, func(i, j int) bool { return hostGroups[i].Name < hostGroups[j].Name })
+	return hostGroups
+}
+
+// UpdateHostGroup updates a host group
+func (r *HostRepository) UpdateHostGroup(hostGroup *models.HostGroup) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.hostGroups[hostGroup.ID]; !ok {
+		return fmt.Errorf("host group with ID %d not found", hostGroup.ID)
+	}
+	for _, existing := range r.store.hostGroups {
+		if existing.ID != hostGroup.ID && existing.Name == hostGroup.Name {
+			return fmt.Errorf("duplicate key value violates unique constraint: host_groups.name %s", hostGroup.Name)
+		}
+	}
+	hostGroup.UpdatedAt = time.Now()
+	r.store.hostGroups[hostGroup.ID] = *hostGroup
+	return nil
+}
+
+// DeleteHostGroup deletes a host group together with its members and access rules
+func (r *HostRepository) DeleteHostGroup(id uint) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for memberID, member := range r.store.hostMembers {
+		if member.HostGroupID == id {
+			delete(r.store.hostMembers, memberID)
+		}
+	}
+	for ruleID, rule := range r.store.accessRules {
+		if rule.HostGroupID == id {
+			delete(r.store.accessRules, ruleID)
+		}
+	}
+	delete(r.store.hostGroups, id)
+	return nil
+}
+
+// AddToHostGroup puts a host in a host group
+func (r *HostRepository) AddToHostGroup(hostGroupID, hostID uint) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for _, member := range r.store.hostMembers {
+		if member.HostGroupID == hostGroupID && member.HostID == hostID {
+			return fmt.Errorf("host is already a member of this host group")
+		}
+	}
+	id := r.store.allocateID("host_group_members")
+	r.store.hostMembers[id] = models.HostGroupMember{ID: id, HostGroupID: hostGroupID, HostID: hostID}
+	return nil
+}
+
+// RemoveFromHostGroup takes a host out of a host group
+func (r *HostRepository) RemoveFromHostGroup(hostGroupID, hostID uint) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for id, member := range r.store.hostMembers {
+		if member.HostGroupID == hostGroupID && member.HostID == hostID {
+			delete(r.store.hostMembers, id)
+		}
+	}
+	return nil
+}
+
+// memberOf reports whether a host is in a host group
+func (r *HostRepository) memberOf(hostGroupID, hostID uint) bool {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for _, member := range r.store.hostMembers {
+		if member.HostGroupID == hostGroupID && member.HostID == hostID {
+			return true
+		}
+	}
+	return false
+}
+
+// FindHostsInGroup finds the hosts in a host group
+func (r *HostRepository) FindHostsInGroup(hostGroupID uint) ([]models.Host, error) {
+	hosts := []models.Host{}
+	for _, host := range r.findHosts(func(models.Host) bool { return true }) {
+		if r.memberOf(hostGroupID, host.ID) {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts, nil
+}
+
+// FindHostGroupsOfHost finds the host groups a host is in
+func (r *HostRepository) FindHostGroupsOfHost(hostID uint) ([]models.HostGroup, error) {
+	hostGroups := []models.HostGroup{}
+	for _, hostGroup := range r.findHostGroups(func(models.HostGroup) bool { return true }) {
+		if r.memberOf(hostGroup.ID, hostID) {
+			hostGroups = append(hostGroups, hostGroup)
+		}
+	}
+	return hostGroups, nil
+}
+
+// CreateAccessRule creates a new access rule
+func (r *HostRepository) CreateAccessRule(rule *models.AccessRule) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	rule.ID = r.store.allocateID("access_rules")
+	rule.CreatedAt = time.Now()
+	r.store.accessRules[rule.ID] = *rule
+	return nil
+}
+
+// FindAccessRuleByID finds an access rule by ID
+func (r *HostRepository) FindAccessRuleByID(id uint) (*models.AccessRule, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	rule, ok := r.store.accessRules[id]
+	if !ok {
+		return nil, fmt.Errorf("access rule with ID %d not found", id)
+	}
+	return &rule, nil
+}
+
+// FindAccessRules finds the access rules of the given host groups
+func (r *HostRepository) FindAccessRules(hostGroupIDs []uint) ([]models.AccessRule, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	wanted := make(map[uint]bool)
+	for _, id := range hostGroupIDs {
+		wanted[id] = true
+	}
+	rules := []models.AccessRule{}
+	for _, rule := range r.store.accessRules {
+		if wanted[rule.HostGroupID] {
+			rules = append(rules, rule)
+		}
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].ID < rules[j].ID })
+	return rules, nil
+}
+
+// DeleteAccessRule deletes an access rule
+func (r *HostRepository) DeleteAccessRule(id uint) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	delete(r.store.accessRules, id)
+	return nil
+}
+
+// CreateReport stores a report sent by a host agent
+func (r *HostRepository) CreateReport(report *models.HostReport) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	report.ID = r.store.allocateID("host_reports")
+	report.CreatedAt = time.Now()
+	stored := *report
+	stored.Drift = append([]models.DriftFinding(nil), report.Drift...)
+	r.store.hostReports = append(r.store.hostReports, stored)
+	return nil
+}
+
+// FindReports finds the latest reports, newest first, optionally for one host
+func (r *HostRepository) FindReports(hostname string, limit int) ([]models.HostReport, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	reports := []models.HostReport{}
+	for i := len(r.store.hostReports) - 1; i >= 0 && len(reports) < limit; i-- {
+		if hostname == "" || r.store.hostReports[i].Hostname == hostname {
+			reports = append(reports, r.store.hostReports[i])
+		}
+	}
+	return reports, nil
+}
+
+// Make sure the in-memory repositories satisfy the interfaces
+var (
+	_ repository.AccountStore          = (*AccountRepository)(nil)
+	_ repository.GroupStore            = (*GroupRepository)(nil)
+	_ repository.AuditStore            = (*AuditRepository)(nil)
+	_ repository.UserStore             = (*UserRepository)(nil)
+	_ repository.WebhookStore          = (*WebhookRepository)(nil)
+	_ repository.EventStore            = (*EventRepository)(nil)
+	_ repository.ChangeStore           = (*ChangeRepository)(nil)
+	_ repository.HostStore             = (*HostRepository)(nil)
+	_ repository.NetgroupStore         = (*NetgroupRepository)(nil)
+	_ repository.SudoStore             = (*SudoRepository)(nil)
+	_ repository.SubIDStore            = (*SubIDRepository)(nil)
+	_ repository.SessionStore          = (*SessionRepository)(nil)
+	_ repository.LoginAttemptStore     = (*LoginAttemptRepository)(nil)
+	_ repository.TOTPChallengeStore    = (*TOTPChallengeRepository)(nil)
+	_ repository.TOTPRecoveryCodeStore = (*TOTPRecoveryCodeRepository)(nil)
+	_ repository.SearchStore           = (*SearchRepository)(nil)
+	_ repository.SavedSearchStore      = (*SavedSearchRepository)(nil)
+)
+
+// NetgroupRepository stores netgroups in memory
+type NetgroupRepository struct {
+	store *Store
+}
+
+// Create creates a new netgroup
+func (r *NetgroupRepository) Create(netgroup *models.Netgroup) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for _, existing := range r.store.netgroups {
+		if existing.Name == netgroup.Name {
+			return fmt.Errorf("duplicate key value violates unique constraint: netgroups.name %s", netgroup.Name)
+		}
+	}
+	now := time.Now()
+	netgroup.ID = r.store.allocateID("netgroups")
+	netgroup.CreatedAt = now
+	netgroup.UpdatedAt = now
+	r.store.netgroups[netgroup.ID] = copyNetgroup(*netgroup)
+	return nil
+}
+
+// FindByID finds a netgroup by ID
+func (r *NetgroupRepository) FindByID(id uint) (*models.Netgroup, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	netgroup, ok := r.store.netgroups[id]
+	if !ok {
+		return nil, fmt.Errorf("netgroup with ID %d not found", id)
+	}
+	netgroup = copyNetgroup(netgroup)
+	return &netgroup, nil
+}
+
+// FindByName finds a netgroup by name
+func (r *NetgroupRepository) FindByName(name string) (*models.Netgroup, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for _, netgroup := range r.store.netgroups {
+		if netgroup.Name == name {
+			netgroup = copyNetgroup(netgroup)
+			return &netgroup, nil
+		}
+	}
+	return nil, fmt.Errorf("netgroup %s not found", name)
+}
+
+// FindAll finds all netgroups ordered by name
+func (r *NetgroupRepository) FindAll() ([]models.Netgroup, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	netgroups := []models.Netgroup{}
+	for _, netgroup := range r.store.netgroups {
+		netgroups = append(netgroups, copyNetgroup(netgroup))
+	}
+	sort.Slice(netgroups, func(i, j int) bool { return netgroups[i].Name < netgroups[j].Name })
+	return netgroups, nil
+}
+
+// Update updates a netgroup
+func (r *NetgroupRepository) Update(netgroup *models.Netgroup) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.netgroups[netgroup.ID]; !ok {
+		return fmt.Errorf("netgroup with ID %d not found", netgroup.ID)
+	}
+	for _, existing := range r.store.netgroups {
+		if existing.ID != netgroup.ID && existing.Name == netgroup.Name {
+			return fmt.Errorf("duplicate key value violates unique constraint: netgroups.name %s", netgroup.Name)
+		}
+	}
+	netgroup.UpdatedAt = time.Now()
+	r.store.netgroups[netgroup.ID] = copyNetgroup(*netgroup)
+	return nil
+}
+
+// Delete deletes a netgroup
+func (r *NetgroupRepository) Delete(id uint) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	delete(r.store.netgroups, id)
+	return nil
+}
+
+// copyNetgroup copies a netgroup's member lists so callers cannot change the
+// stored netgroup through them
+func copyNetgroup(netgroup models.Netgroup) models.Netgroup {
+	netgroup.Triples = append([]models.NetgroupTriple{}, netgroup.Triples...)
+	netgroup.Netgroups = append([]string{}, netgroup.Netgroups...)
+	return netgroup
+}
+
+// SudoRepository stores sudo rules in memory
+type SudoRepository struct {
+	store *Store
+}
+
+// Create creates a new sudo rule
+func (r *SudoRepository) Create(rule *models.SudoRule) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for _, existing := range r.store.sudoRules {
+		if existing.Name == rule.Name {
+			return fmt.Errorf("duplicate key value violates unique constraint: sudo_rules.name %s", rule.Name)
+		}
+	}
+	now := time.Now()
+	rule.ID = r.store.allocateID("sudo_rules")
+	rule.CreatedAt = now
+	rule.UpdatedAt = now
+	r.store.sudoRules[rule.ID] = copySudoRule(*rule)
+	return nil
+}
+
+// FindByID finds a sudo rule by ID
+func (r *SudoRepository) FindByID(id uint) (*models.SudoRule, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	rule, ok := r.store.sudoRules[id]
+	if !ok {
+		return nil, fmt.Errorf("sudo rule with ID %d not found", id)
+	}
+	rule = copySudoRule(rule)
+	return &rule, nil
+}
+
+// FindAll finds all sudo rules ordered by name
+func (r *SudoRepository) FindAll() ([]models.SudoRule, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	rules := []models.SudoRule{}
+	for _, rule := range r.store.sudoRules {
+		rules = append(rules, copySudoRule(rule))
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Name < rules[j].Name })
+	return rules, nil
+}
+
+// Update updates a sudo rule
+func (r *SudoRepository) Update(rule *models.SudoRule) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.sudoRules[rule.ID]; !ok {
+		return fmt.Errorf("sudo rule with ID %d not found", rule.ID)
+	}
+	for _, existing := range r.store.sudoRules {
+		if existing.ID != rule.ID && existing.Name == rule.Name {
+			return fmt.Errorf("duplicate key value violates unique constraint: sudo_rules.name %s", rule.Name)
+		}
+	}
+	rule.UpdatedAt = time.Now()
+	r.store.sudoRules[rule.ID] = copySudoRule(*rule)
+	return nil
+}
+
+// Delete deletes a sudo rule
+func (r *SudoRepository) Delete(id uint) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	delete(r.store.sudoRules, id)
+	return nil
+}
+
+// copySudoRule copies a sudo rule's lists so callers cannot change the stored
+// rule through them
+func copySudoRule(rule models.SudoRule) models.SudoRule {
+	rule.Hosts = append([]string{}, rule.Hosts...)
+	rule.RunAsUsers = append([]string{}, rule.RunAsUsers...)
+	rule.RunAsGroups = append([]string{}, rule.RunAsGroups...)
+	rule.Commands = append([]string{}, rule.Commands...)
+	return rule
+}
+
+// SubIDRepository stores subordinate ID blocks in memory
+type SubIDRepository struct {
+	store *Store
+}
+
+// Create creates a new block
+func (r *SubIDRepository) Create(block *models.SubIDRange) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for _, existing := range r.store.subIDs {
+		if existing.AccountID == block.AccountID {
+			return fmt.Errorf("duplicate key value violates unique constraint: sub_id_ranges.account_id %d", block.AccountID)
+		}
+		if existing.Start == block.Start {
+			return fmt.Errorf("duplicate key value violates unique constraint: sub_id_ranges.start %d", block.Start)
+		}
+	}
+	block.ID = r.store.allocateID("sub_id_ranges")
+	block.CreatedAt = time.Now()
+	r.store.subIDs[block.ID] = *block
+	return nil
+}
+
+// FindByAccountID finds the block of an account
+func (r *SubIDRepository) FindByAccountID(accountID uint) (*models.SubIDRange, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for _, block := range r.store.subIDs {
+		if block.AccountID == accountID {
+			return &block, nil
+		}
+	}
+	return nil, fmt.Errorf("account with ID %d has no subordinate IDs", accountID)
+}
+
+// FindAll finds all blocks ordered by start
+func (r *SubIDRepository) FindAll() ([]models.SubIDRange, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	blocks := []models.SubIDRange{}
+	for _, block := range r.store.subIDs {
+		blocks = append(blocks, block)
+	}
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i].Start < blocks[j].Start })
+	return blocks, nil
+}
+
+// DeleteByAccountID deletes the block of an account
+func (r *SubIDRepository) DeleteByAccountID(accountID uint) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for id, block := range r.store.subIDs {
+		if block.AccountID == accountID {
+			delete(r.store.subIDs, id)
+		}
+	}
+	return nil
+}
+
+// SearchRepository searches the accounts and groups of the store
+type SearchRepository struct {
+	store *Store
+}
+
+// Search finds up to limit accounts and groups matching query, best first
+func (r *SearchRepository) Search(query string, limit int) ([]models.SearchResult, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	accounts := r.store.sortedAccounts(func(models.Account) bool { return true })
+	groups := r.store.sortedGroups(func(models.Group) bool { return true })
+	return search.Rank(query, accounts, groups, limit), nil
+}
+
+// SessionRepository stores login sessions in memory
+type SessionRepository struct {
+	store *Store
+}
+
+// Create creates a new session
+func (r *SessionRepository) Create(session *models.Session) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for _, existing := range r.store.sessions {
+		if existing.TokenKey == session.TokenKey {
+			return fmt.Errorf("duplicate key value violates unique constraint: sessions.token_key")
+		}
+	}
+	session.ID = r.store.allocateID("sessions")
+	session.CreatedAt = time.Now()
+	session.UpdatedAt = session.CreatedAt
+	r.store.sessions[session.ID] = *session
+	return nil
+}
+
+// FindByID finds a session by its ID; it returns nil if there is none
+func (r *SessionRepository) FindByID(id uint) (*models.Session, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	session, ok := r.store.sessions[id]
+	if !ok {
+		return nil, nil
+	}
+	return &session, nil
+}
+
+// FindByTokenKey finds the session a refresh token belongs to; it returns
+// nil if there is none
+func (r *SessionRepository) FindByTokenKey(key string) (*models.Session, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for _, session := range r.store.sessions {
+		if session.TokenKey == key {
+			return &session, nil
+		}
+	}
+	return nil, nil
+}
+
+// FindByUserID finds the sessions of a user, newest first
+func (r *SessionRepository) FindByUserID(userID uint) ([]models.Session, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	sessions := []models.Session{}
+	for _, session := range r.store.sessions {
+		if session.UserID == userID {
+			sessions = append(sessions, session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].ID > sessions[j].ID })
+	return sessions, nil
+}
+
+// Rotate replaces the refresh token secret of a session that is not
+// revoked; it returns ErrVersionMismatch if the secret is no longer oldHash
+func (r *SessionRepository) Rotate(id uint, oldHash, newHash string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	session, ok := r.store.sessions[id]
+	if !ok || session.SecretHash != oldHash || session.RevokedAt != nil {
+		return repository.ErrVersionMismatch
+	}
+	session.SecretHash = newHash
+	session.UpdatedAt = time.Now()
+	r.store.sessions[id] = session
+	return nil
+}
+
+// Revoke revokes a session
+func (r *SessionRepository) Revoke(id uint) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	r.store.revokeSessions(func(session models.Session) bool { return session.ID == id })
+	return nil
+}
+
+// RevokeByUserID revokes the sessions of a user except exceptID; 0 revokes
+// all of them
+func (r *SessionRepository) RevokeByUserID(userID, exceptID uint) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	r.store.revokeSessions(func(session models.Session) bool {
+		return session.UserID == userID && session.ID != exceptID
+	})
+	return nil
+}
+
+// revokeSessions revokes the sessions that match and are not revoked yet
+func (s *Store) revokeSessions(match func(models.Session) bool) {
+	now := time.Now()
+	for id, session := range s.sessions {
+		if session.RevokedAt == nil && match(session) {
+			session.RevokedAt = &now
+			s.sessions[id] = session
+		}
+	}
+}
+
+// DeleteExpired deletes the sessions that expired before a time
+func (r *SessionRepository) DeleteExpired(before time.Time) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for id, session := range r.store.sessions {
+		if session.ExpiresAt.Before(before) {
+			delete(r.store.sessions, id)
+		}
+	}
+	return nil
+}
+
+// LoginAttemptRepository stores failed login counters in memory
+type LoginAttemptRepository struct {
+	store *Store
+}
+
+// find returns the counter of a username or IP address
+func (r *LoginAttemptRepository) find(kind, subject string) (models.LoginAttempt, bool) {
+	for _, attempt := range r.store.logins {
+		if attempt.Kind == kind && attempt.Subject == subject {
+			return attempt, true
+		}
+	}
+	return models.LoginAttempt{}, false
+}
+
+// Find finds the counter of a username or IP address; it returns nil if
+// there is none
+func (r *LoginAttemptRepository) Find(kind, subject string) (*models.LoginAttempt, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	attempt, ok := r.find(kind, subject)
+	if !ok {
+		return nil, nil
+	}
+	return &attempt, nil
+}
+
+// FindLocked finds the counters that refuse logins at a time
+func (r *LoginAttemptRepository) FindLocked(at time.Time) ([]models.LoginAttempt, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	attempts := []models.LoginAttempt{}
+	for _, attempt := range r.store.logins {
+		if attempt.LockedUntil.After(at) {
+			attempts = append(attempts, attempt)
+		}
+	}
+	sort.Slice(attempts, func(i, j int) bool {
+		if attempts[i].Kind != attempts[j].Kind {
+			return attempts[i].Kind < attempts[j].Kind
+		}
+		return attempts[i].Subject < attempts[j].Subject
+	})
+	return attempts, nil
+}
+
+// RecordFailure adds a failure to the counter of a username or IP address,
+// creating it if needed, and returns the counter
+func (r *LoginAttemptRepository) RecordFailure(kind, subject string, at time.Time) (*models.LoginAttempt, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	attempt, ok := r.find(kind, subject)
+	if !ok {
+		attempt = models.LoginAttempt{ID: r.store.allocateID("login_attempts"), Kind: kind, Subject: subject, LockedUntil: at}
+	}
+	attempt.Failures++
+	attempt.LastFailureAt = at
+	r.store.logins[attempt.ID] = attempt
+	return &attempt, nil
+}
+
+// Lock refuses logins until a time, unless they are already refused for longer
+func (r *LoginAttemptRepository) Lock(id uint, until time.Time) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	attempt, ok := r.store.logins[id]
+	if ok && attempt.LockedUntil.Before(until) {
+		attempt.LockedUntil = until
+		r.store.logins[id] = attempt
+	}
+	return nil
+}
+
+// Delete forgets the failures of a username or IP address
+func (r *LoginAttemptRepository) Delete(kind, subject string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if attempt, ok := r.find(kind, subject); ok {
+		delete(r.store.logins, attempt.ID)
+	}
+	return nil
+}
+
+// DeleteStale forgets the counters whose last failure and lock both ended
+// before a time
+func (r *LoginAttemptRepository) DeleteStale(before time.Time) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for id, attempt := range r.store.logins {
+		if attempt.LastFailureAt.Before(before) && attempt.LockedUntil.Before(before) {
+			delete(r.store.logins, id)
+		}
+	}
+	return nil
+}
+
+// TOTPChallengeRepository stores logins waiting for a TOTP code in memory
+type TOTPChallengeRepository struct {
+	store *Store
+}
+
+// Create creates a new challenge
+func (r *TOTPChallengeRepository) Create(challenge *models.TOTPChallenge) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for _, existing := range r.store.challenges {
+		if existing.TokenHash == challenge.TokenHash {
+			return fmt.Errorf("duplicate key value violates unique constraint: totp_challenges.token_hash")
+		}
+	}
+	challenge.ID = r.store.allocateID("totp_challenges")
+	challenge.CreatedAt = time.Now()
+	r.store.challenges[challenge.ID] = *challenge
+	return nil
+}
+
+// FindByTokenHash finds the challenge of a token; it returns nil if there
+// is none
+func (r *TOTPChallengeRepository) FindByTokenHash(hash string) (*models.TOTPChallenge, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for _, challenge := range r.store.challenges {
+		if challenge.TokenHash == hash {
+			return &challenge, nil
+		}
+	}
+	return nil, nil
+}
+
+// AddAttempt counts a code tried with a challenge. It returns false without
+// counting if max codes were tried already.
+func (r *TOTPChallengeRepository) AddAttempt(id uint, max int) (bool, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	challenge, ok := r.store.challenges[id]
+	if !ok || challenge.Attempts >= max {
+		return false, nil
+	}
+	challenge.Attempts++
+	r.store.challenges[id] = challenge
+	return true, nil
+}
+
+// Delete deletes a challenge
+func (r *TOTPChallengeRepository) Delete(id uint) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	delete(r.store.challenges, id)
+	return nil
+}
+
+// DeleteExpired deletes the challenges that expired before a time
+func (r *TOTPChallengeRepository) DeleteExpired(before time.Time) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for id, challenge := range r.store.challenges {
+		if challenge.ExpiresAt.Before(before) {
+			delete(r.store.challenges, id)
+		}
+	}
+	return nil
+}
+
+// TOTPRecoveryCodeRepository stores TOTP recovery codes in memory
+type TOTPRecoveryCodeRepository struct {
+	store *Store
+}
+
+// Replace replaces the recovery codes of a user with codes of the given
+// hashes
+func (r *TOTPRecoveryCodeRepository) Replace(userID uint, hashes []string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for id, code := range r.store.recovery {
+		if code.UserID == userID {
+			delete(r.store.recovery, id)
+		}
+	}
+	for _, hash := range hashes {
+		code := models.TOTPRecoveryCode{
+			ID:        r.store.allocateID("totp_recovery_codes"),
+			CreatedAt: time.Now(),
+			UserID:    userID,
+			CodeHash:  hash,
+		}
+		r.store.recovery[code.ID] = code
+	}
+	return nil
+}
+
+// Use marks an unused recovery code of a user as used. It returns false if
+// the user has no such unused code.
+func (r *TOTPRecoveryCodeRepository) Use(userID uint, hash string, at time.Time) (bool, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for id, code := range r.store.recovery {
+		if code.UserID == userID && code.CodeHash == hash && code.UsedAt == nil {
+			code.UsedAt = &at
+			r.store.recovery[id] = code
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// CountUnused counts the recovery codes a user has left
+func (r *TOTPRecoveryCodeRepository) CountUnused(userID uint) (int64, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	var count int64
+	for _, code := range r.store.recovery {
+		if code.UserID == userID && code.UsedAt == nil {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// DeleteByUser deletes the recovery codes of a user
+func (r *TOTPRecoveryCodeRepository) DeleteByUser(userID uint) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for id, code := range r.store.recovery {
+		if code.UserID == userID {
+			delete(r.store.recovery, id)
+		}
+	}
+	return nil
+}
+
+// SavedSearchRepository stores saved searches in memory
+type SavedSearchRepository struct {
+	store *Store
+}
+
+// Create creates a new saved search
+func (r *SavedSearchRepository) Create(search *models.SavedSearch) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for _, existing := range r.store.saved {
+		if existing.UserID == search.UserID && existing.Name == search.Name {
+			return fmt.Errorf("duplicate key value violates unique constraint: saved_searches.user_id, name %d, %s", search.UserID, search.Name)
+		}
+	}
+	now := time.Now()
+	search.ID = r.store.allocateID("saved_searches")
+	search.CreatedAt = now
+	search.UpdatedAt = now
+	r.store.saved[search.ID] = *search
+	return nil
+}
+
+// FindByID finds a saved search by ID
+func (r *SavedSearchRepository) FindByID(id uint) (*models.SavedSearch, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	search, ok := r.store.saved[id]
+	if !ok {
+		return nil, fmt.Errorf("saved search with ID %d not found", id)
+	}
+	return &search, nil
+}
+
+// FindByUser finds the saved searches of a user ordered by name
+func (r *SavedSearchRepository) FindByUser(userID uint) ([]models.SavedSearch, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	searches := []models.SavedSearch{}
+	for _, search := range r.store.saved {
+		if search.UserID == userID {
+			searches = append(searches, search)
+		}
+	}
+	sort.Slice(searches, func(i, j int) bool { return searches[i].Name < searches[j].Name })
+	return searches, nil
+}
+
+// Update updates a saved search
+func (r *SavedSearchRepository) Update(search *models.SavedSearch) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.saved[search.ID]; !ok {
+		return fmt.Errorf("saved search with ID %d not found", search.ID)
+	}
+	for _, existing := range r.store.saved {
+		if existing.ID != search.ID && existing.UserID == search.UserID && existing.Name == search.Name {
+			return fmt.Errorf("duplicate key value violates unique constraint: saved_searches.user_id, name %d, %s", search.UserID, search.Name)
+		}
+	}
+	search.UpdatedAt = time.Now()
+	r.store.saved[search.ID] = *search
+	return nil
+}
+
+// Delete deletes a saved search
+func (r *SavedSearchRepository) Delete(id uint) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	delete(r.store.saved, id)
+	return nil
+}
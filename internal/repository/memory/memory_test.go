@@ -0,0 +1,93 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/home/unixify/internal/models"
+)
+
+func TestAccountUniqueness(t *testing.T) {
+	accounts := NewStore().Accounts()
+
+	alice := &models.Account{Username: "alice", UnixUID: 1001, Type: models.AccountTypePeople}
+	if err := accounts.Create(alice); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := accounts.Create(&models.Account{Username: "alice", UnixUID: 1002}); err == nil {
+		t.Error("expected a duplicate username to be rejected")
+	}
+	if err := accounts.Create(&models.Account{Username: "bob", UnixUID: 1001}); err == nil {
+		t.Error("expected a duplicate UID to be rejected")
+	}
+
+	bob := &models.Account{Username: "bob", UnixUID: 1002, Type: models.AccountTypePeople}
+	if err := accounts.Create(bob); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	bob.UnixUID = 1001
+	if err := accounts.Update(bob); err == nil {
+		t.Error("expected an update to a taken UID to be rejected")
+	}
+
+	// Callers only see copies of the stored rows
+	stored, err := accounts.FindByUsername("bob")
+	if err != nil {
+		t.Fatalf("FindByUsername: %v", err)
+	}
+	if stored.UnixUID != 1002 {
+		t.Errorf("stored UID = %d, want 1002", stored.UnixUID)
+	}
+}
+
+func TestGroupUniqueness(t *testing.T) {
+	groups := NewStore().Groups()
+
+	if err := groups.Create(&models.Group{Groupname: "staff", UnixGID: 1000}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := groups.Create(&models.Group{Groupname: "staff", UnixGID: 1001}); err == nil {
+		t.Error("expected a duplicate groupname to be rejected")
+	}
+	if err := groups.Create(&models.Group{Groupname: "devs", UnixGID: 1000}); err == nil {
+		t.Error("expected a duplicate GID to be rejected")
+	}
+}
+
+func TestMembershipsSurviveDeletes(t *testing.T) {
+	store := NewStore()
+	accounts, groups := store.Accounts(), store.Groups()
+
+	account := &models.Account{Username: "alice", UnixUID: 1001}
+	group := &models.Group{Groupname: "staff", UnixGID: 1000}
+	if err := accounts.Create(account); err != nil {
+		t.Fatalf("Create account: %v", err)
+	}
+	if err := groups.Create(group); err != nil {
+		t.Fatalf("Create group: %v", err)
+	}
+	if err := accounts.AssignToGroup(account.ID, group.ID); err != nil {
+		t.Fatalf("AssignToGroup: %v", err)
+	}
+	if err := accounts.AssignToGroup(account.ID, group.ID); err == nil {
+		t.Error("expected a duplicate membership to be rejected")
+	}
+
+	// Like the database, deleting a group leaves the membership row behind
+	if err := groups.Delete(group.ID, 0); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	memberships, err := accounts.FindAllMemberships()
+	if err != nil {
+		t.Fatalf("FindAllMemberships: %v", err)
+	}
+	if len(memberships) != 1 {
+		t.Fatalf("expected the orphaned membership to remain, got %d", len(memberships))
+	}
+	remaining, err := groups.FindByAccountID(account.ID)
+	if err != nil {
+		t.Fatalf("FindByAccountID: %v", err)
+	}
+	if len(remaining) != 0 {
+		t.Errorf("expected orphaned memberships to be skipped, got %+v", remaining)
+	}
+}
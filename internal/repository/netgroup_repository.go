@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/home/unixify/internal/models"
+	"gorm.io/gorm"
+)
+
+// NetgroupRepository handles database operations for netgroups
+type NetgroupRepository struct {
+	db *gorm.DB
+}
+
+// NewNetgroupRepository creates a new netgroup repository
+func NewNetgroupRepository(db *gorm.DB) *NetgroupRepository {
+	return &NetgroupRepository{
+		db: db,
+	}
+}
+
+// Create creates a new netgroup
+func (r *NetgroupRepository) Create(netgroup *models.Netgroup) error {
+	return r.db.Create(netgroup).Error
+}
+
+// FindByID finds a netgroup by ID
+func (r *NetgroupRepository) FindByID(id uint) (*models.Netgroup, error) {
+	var netgroup models.Netgroup
+	err := r.db.First(&netgroup, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("netgroup with ID %d not found", id)
+		}
+		return nil, err
+	}
+	return &netgroup, nil
+}
+
+// FindByName finds a netgroup by name
+func (r *NetgroupRepository) FindByName(name string) (*models.Netgroup, error) {
+	var netgroup models.Netgroup
+	err := r.db.Where("name = ?", name).First(&netgroup).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("netgroup %s not found", name)
+		}
+		return nil, err
+	}
+	return &netgroup, nil
+}
+
+// FindAll finds all netgroups ordered by name
+func (r *NetgroupRepository) FindAll() ([]models.Netgroup, error) {
+	var netgroups []models.Netgroup
+	err := r.db.Order("name").Find(&netgroups).Error
+	if err != nil {
+		return nil, err
+	}
+	return netgroups, nil
+}
+
+// Update updates a netgroup
+func (r *NetgroupRepository) Update(netgroup *models.Netgroup) error {
+	return r.db.Save(netgroup).Error
+}
+
+// Delete deletes a netgroup
+func (r *NetgroupRepository) Delete(id uint) error {
+	return r.db.Delete(&models.Netgroup{}, id).Error
+}
@@ -0,0 +1,142 @@
+package repository
+
+import (
+	"strings"
+
+	"github.com/home/unixify/internal/query"
+	"gorm.io/gorm"
+)
+
+// condition is a SQL condition with its arguments
+type condition struct {
+	sql  string
+	args []interface{}
+}
+
+// accountConditions compiles the terms of a query into conditions on the
+// accounts table, in the same way query.MatchAccount evaluates them
+func accountConditions(term query.Term, value query.Value) condition {
+	switch term.Field {
+	case query.FieldText:
+		return containsCondition(value, "username", "firstname", "surname", "CAST(unixuid AS TEXT)")
+	case query.FieldKind:
+		return condition{sql: "?", args: []interface{}{value.Text == "account"}}
+	case query.FieldID:
+		return numberCondition("accounts.id", value)
+	case query.FieldUID:
+		return numberCondition("unixuid", value)
+	case query.FieldGID:
+		c := numberCondition("unixgid", value)
+		c.sql = "primary_group_id IN (SELECT id FROM groups WHERE " + c.sql + ")"
+		return c
+	case query.FieldType:
+		return condition{sql: "type = ?", args: []interface{}{value.Text}}
+	case query.FieldActive:
+		return condition{sql: "active = ?", args: []interface{}{value.Bool}}
+	case query.FieldUsername:
+		return likeCondition("username", value)
+	case query.FieldFirstname:
+		return likeCondition("firstname", value)
+	case query.FieldSurname:
+		return likeCondition("surname", value)
+	case query.FieldName:
+		return anyCondition(likeCondition("firstname", value), likeCondition("surname", value),
+			likeCondition("firstname || ' ' || surname", value))
+	case query.FieldMemberOf:
+		c := likeCondition("groups.groupname", value)
+		c.sql = "accounts.id IN (SELECT account_groups.account_id FROM account_groups JOIN groups ON groups.id = account_groups.group_id WHERE " + c.sql + ")"
+		return c
+	case query.FieldPrimaryGroup:
+		c := likeCondition("groupname", value)
+		c.sql = "primary_group_id IN (SELECT id FROM groups WHERE " + c.sql + ")"
+		return c
+	}
+	return condition{sql: "?", args: []interface{}{false}}
+}
+
+// groupConditions compiles the terms of a query into conditions on the
+// groups table, in the same way query.MatchGroup evaluates them
+func groupConditions(term query.Term, value query.Value) condition {
+	switch term.Field {
+	case query.FieldText:
+		return containsCondition(value, "groupname", "description", "CAST(unixgid AS TEXT)")
+	case query.FieldKind:
+		return condition{sql: "?", args: []interface{}{value.Text == "group"}}
+	case query.FieldID:
+		return numberCondition("groups.id", value)
+	case query.FieldGID:
+		return numberCondition("unixgid", value)
+	case query.FieldType:
+		return condition{sql: "type = ?", args: []interface{}{value.Text}}
+	case query.FieldActive:
+		return condition{sql: "active = ?", args: []interface{}{value.Bool}}
+	case query.FieldGroupname:
+		return likeCondition("groupname", value)
+	case query.FieldDescription:
+		return likeCondition("description", value)
+	case query.FieldCreatedBy:
+		return likeCondition("created_by", value)
+	case query.FieldHasMember:
+		c := likeCondition("accounts.username", value)
+		c.sql = "groups.id IN (SELECT account_groups.group_id FROM account_groups JOIN accounts ON accounts.id = account_groups.account_id WHERE " + c.sql + ")"
+		return c
+	}
+	return condition{sql: "?", args: []interface{}{false}}
+}
+
+// applyQuery adds a WHERE clause for every term of a query; a term matches
+// if any of its values does
+func applyQuery(db *gorm.DB, q *query.Query, compile func(query.Term, query.Value) condition) *gorm.DB {
+	for _, term := range q.Terms {
+		var values []condition
+		for _, value := range term.Values {
+			values = append(values, compile(term, value))
+		}
+		c := anyCondition(values...)
+		if term.Negate {
+			c.sql = "NOT (" + c.sql + ")"
+		}
+		db = db.Where(c.sql, c.args...)
+	}
+	return db
+}
+
+// anyCondition joins conditions with OR
+func anyCondition(conditions ...condition) condition {
+	var joined condition
+	var parts []string
+	for _, c := range conditions {
+		parts = append(parts, "("+c.sql+")")
+		joined.args = append(joined.args, c.args...)
+	}
+	joined.sql = strings.Join(parts, " OR ")
+	return joined
+}
+
+// numberCondition compares a numeric column with a value
+func numberCondition(column string, value query.Value) condition {
+	if value.Op == query.OpRange {
+		return condition{sql: column + " BETWEEN ? AND ?", args: []interface{}{value.Number, value.High}}
+	}
+	return condition{sql: column + " " + string(value.Op) + " ?", args: []interface{}{value.Number}}
+}
+
+// likeCondition matches a text column with a value, ignoring case; * in
+// the value is a wildcard
+func likeCondition(column string, value query.Value) condition {
+	if !strings.Contains(value.Text, "*") {
+		return condition{sql: "lower(" + column + ") = ?", args: []interface{}{value.Text}}
+	}
+	pattern := strings.ReplaceAll(escapeLike(value.Text), "*", "%")
+	return condition{sql: "lower(" + column + `) LIKE ? ESCAPE '\'`, args: []interface{}{pattern}}
+}
+
+// containsCondition matches text columns that contain the value, ignoring case
+func containsCondition(value query.Value, columns ...string) condition {
+	pattern := "%" + strings.ReplaceAll(escapeLike(value.Text), "*", "%") + "%"
+	var conditions []condition
+	for _, column := range columns {
+		conditions = append(conditions, condition{sql: "lower(" + column + `) LIKE ? ESCAPE '\'`, args: []interface{}{pattern}})
+	}
+	return anyCondition(conditions...)
+}
@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/home/unixify/internal/models"
+	"gorm.io/gorm"
+)
+
+// ReservationRepository handles database operations for UID/GID reservations
+type ReservationRepository struct {
+	db *gorm.DB
+}
+
+// NewReservationRepository creates a new reservation repository
+func NewReservationRepository(db *gorm.DB) *ReservationRepository {
+	return &ReservationRepository{
+		db: db,
+	}
+}
+
+// Create creates a new reservation
+func (r *ReservationRepository) Create(reservation *models.Reservation) error {
+	return r.db.Create(reservation).Error
+}
+
+// FindByID finds a reservation by ID
+func (r *ReservationRepository) FindByID(id uint) (*models.Reservation, error) {
+	var reservation models.Reservation
+	err := r.db.First(&reservation, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("reservation with ID %d not found", id)
+		}
+		return nil, err
+	}
+	return &reservation, nil
+}
+
+// FindByName finds a reservation by name
+func (r *ReservationRepository) FindByName(name string) (*models.Reservation, error) {
+	var reservation models.Reservation
+	err := r.db.Where("name = ?", name).First(&reservation).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("reservation with name %s not found", name)
+		}
+		return nil, err
+	}
+	return &reservation, nil
+}
+
+// FindAll finds all reservations with optional filtering by kind
+func (r *ReservationRepository) FindAll(kind string) ([]models.Reservation, error) {
+	var reservations []models.Reservation
+	query := r.db
+
+	if kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+
+	err := query.Order("start").Find(&reservations).Error
+	if err != nil {
+		return nil, err
+	}
+	return reservations, nil
+}
+
+// Update updates a reservation
+func (r *ReservationRepository) Update(reservation *models.Reservation) error {
+	return r.db.Save(reservation).Error
+}
+
+// Delete deletes a reservation
+func (r *ReservationRepository) Delete(id uint) error {
+	return r.db.Delete(&models.Reservation{}, id).Error
+}
@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/home/unixify/internal/models"
+	"gorm.io/gorm"
+)
+
+// SavedSearchRepository handles database operations for saved searches
+type SavedSearchRepository struct {
+	db *gorm.DB
+}
+
+// NewSavedSearchRepository creates a new saved search repository
+func NewSavedSearchRepository(db *gorm.DB) *SavedSearchRepository {
+	return &SavedSearchRepository{
+		db: db,
+	}
+}
+
+// Create creates a new saved search
+func (r *SavedSearchRepository) Create(search *models.SavedSearch) error {
+	return r.db.Create(search).Error
+}
+
+// FindByID finds a saved search by ID
+func (r *SavedSearchRepository) FindByID(id uint) (*models.SavedSearch, error) {
+	var search models.SavedSearch
+	err := r.db.First(&search, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("saved search with ID %d not found", id)
+		}
+		return nil, err
+	}
+	return &search, nil
+}
+
+// FindByUser finds the saved searches of a user ordered by name
+func (r *SavedSearchRepository) FindByUser(userID uint) ([]models.SavedSearch, error) {
+	var searches []models.SavedSearch
+	err := r.db.Where("user_id = ?", userID).Order("name").Find(&searches).Error
+	if err != nil {
+		return nil, err
+	}
+	return searches, nil
+}
+
+// Update updates a saved search
+func (r *SavedSearchRepository) Update(search *models.SavedSearch) error {
+	return r.db.Save(search).Error
+}
+
+// Delete deletes a saved search
+func (r *SavedSearchRepository) Delete(id uint) error {
+	return r.db.Delete(&models.SavedSearch{}, id).Error
+}
@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/home/unixify/internal/models"
+	"github.com/home/unixify/internal/search"
+	"gorm.io/gorm"
+)
+
+// maxSearchCandidates limits the accounts and groups each that the trigram
+// indexes hand to search.Rank
+const maxSearchCandidates = 1000
+
+// SearchRepository searches accounts and groups together
+type SearchRepository struct {
+	db           *gorm.DB
+	trigramsOnce sync.Once
+	trigrams     bool // pg_trgm is installed
+}
+
+// NewSearchRepository creates a new search repository
+func NewSearchRepository(db *gorm.DB) *SearchRepository {
+	return &SearchRepository{
+		db: db,
+	}
+}
+
+// useTrigrams reports whether the database has pg_trgm; it is checked once
+func (r *SearchRepository) useTrigrams() bool {
+	r.trigramsOnce.Do(func() {
+		r.trigrams, _ = dialectOf(r.db).hasTrigrams(r.db)
+	})
+	return r.trigrams
+}
+
+// Search finds up to limit accounts and groups matching query, best first.
+// With pg_trgm the trigram indexes pick the candidates; otherwise all
+// accounts and groups are ranked.
+func (r *SearchRepository) Search(query string, limit int) ([]models.SearchResult, error) {
+	query = search.Normalize(query)
+	if query == "" {
+		return []models.SearchResult{}, nil
+	}
+
+	var accounts []models.Account
+	var groups []models.Group
+	if !r.useTrigrams() {
+		if err := r.db.Find(&accounts).Error; err != nil {
+			return nil, err
+		}
+		if err := r.db.Find(&groups).Error; err != nil {
+			return nil, err
+		}
+		return search.Rank(query, accounts, groups, limit), nil
+	}
+
+	like := "%" + escapeLike(query) + "%"
+	accountWhere := "lower(username) LIKE ? OR lower(firstname || ' ' || surname) LIKE ? OR ? <% lower(username) OR ? <% lower(firstname || ' ' || surname)"
+	groupWhere := "lower(groupname) LIKE ? OR lower(description) LIKE ? OR ? <% lower(groupname) OR ? <% lower(description)"
+	accountArgs := []interface{}{like, like, query, query}
+	groupArgs := []interface{}{like, like, query, query}
+	if id, err := strconv.Atoi(query); err == nil {
+		accountWhere += " OR unixuid = ?"
+		accountArgs = append(accountArgs, id)
+		groupWhere += " OR unixgid = ?"
+		groupArgs = append(groupArgs, id)
+	}
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		// Match words as loosely as search.Rank does
+		if err := tx.Exec("SELECT set_config('pg_trgm.word_similarity_threshold', ?, true)",
+			strconv.FormatFloat(search.MinSimilarity, 'f', -1, 64)).Error; err != nil {
+			return err
+		}
+		if err := tx.Where(accountWhere, accountArgs...).Limit(maxSearchCandidates).Find(&accounts).Error; err != nil {
+			return err
+		}
+		return tx.Where(groupWhere, groupArgs...).Limit(maxSearchCandidates).Find(&groups).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return search.Rank(query, accounts, groups, limit), nil
+}
+
+// escapeLike escapes the LIKE wildcards in s
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/home/unixify/internal/models"
+	"gorm.io/gorm"
+)
+
+// SessionRepository handles database operations for login sessions
+type SessionRepository struct {
+	db *gorm.DB
+}
+
+// NewSessionRepository creates a new session repository
+func NewSessionRepository(db *gorm.DB) *SessionRepository {
+	return &SessionRepository{
+		db: db,
+	}
+}
+
+// Create creates a new session
+func (r *SessionRepository) Create(session *models.Session) error {
+	return r.db.Create(session).Error
+}
+
+// FindByID finds a session by its ID; it returns nil if there is none
+func (r *SessionRepository) FindByID(id uint) (*models.Session, error) {
+	return r.find("id = ?", id)
+}
+
+// FindByTokenKey finds the session a refresh token belongs to; it returns
+// nil if there is none
+func (r *SessionRepository) FindByTokenKey(key string) (*models.Session, error) {
+	return r.find("token_key = ?", key)
+}
+
+// find finds the session matching a condition
+func (r *SessionRepository) find(condition string, args ...interface{}) (*models.Session, error) {
+	var session models.Session
+	err := r.db.Where(condition, args...).First(&session).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &session, nil
+}
+
+// FindByUserID finds the sessions of a user, newest first
+func (r *SessionRepository) FindByUserID(userID uint) ([]models.Session, error) {
+	var sessions []models.Session
+	err := r.db.Where("user_id = ?", userID).Order("id DESC").Find(&sessions).Error
+	if err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// Rotate replaces the refresh token secret of a session that is not
+// revoked. It returns ErrVersionMismatch if the secret is no longer oldHash,
+// so only one of two concurrent refreshes with the same token succeeds.
+func (r *SessionRepository) Rotate(id uint, oldHash, newHash string) error {
+	result := r.db.Model(&models.Session{}).
+		Where("id = ? AND secret_hash = ? AND revoked_at IS NULL", id, oldHash).
+		Updates(map[string]interface{}{"secret_hash": newHash, "updated_at": time.Now()})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrVersionMismatch
+	}
+	return nil
+}
+
+// Revoke revokes a session
+func (r *SessionRepository) Revoke(id uint) error {
+	return r.db.Model(&models.Session{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now()).Error
+}
+
+// RevokeByUserID revokes the sessions of a user except exceptID; 0 revokes
+// all of them
+func (r *SessionRepository) RevokeByUserID(userID, exceptID uint) error {
+	return r.db.Model(&models.Session{}).
+		Where("user_id = ? AND id <> ? AND revoked_at IS NULL", userID, exceptID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// DeleteExpired deletes the sessions that expired before a time
+func (r *SessionRepository) DeleteExpired(before time.Time) error {
+	return r.db.Where("expires_at < ?", before).Delete(&models.Session{}).Error
+}
@@ -0,0 +1,273 @@
+package repository
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/home/unixify/db/migrations"
+	"github.com/home/unixify/internal/config"
+	"github.com/home/unixify/internal/models"
+	"gorm.io/gorm/logger"
+)
+
+// newSQLiteRepositories returns repositories over a fresh SQLite file with
+// the embedded migrations applied
+func newSQLiteRepositories(t *testing.T) *Repositories {
+	t.Helper()
+	cfg := &config.Config{Database: config.DatabaseConfig{
+		Driver: config.DriverSQLite,
+		Path:   filepath.Join(t.TempDir(), "unixify.db"),
+	}}
+	if err := migrations.Up(cfg.Database.GetURL()); err != nil {
+		t.Fatalf("migrations.Up: %v", err)
+	}
+	db, err := InitDB(cfg)
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	db.Logger = logger.Default.LogMode(logger.Silent)
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("DB: %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	return NewRepositories(db)
+}
+
+// mustCreateGroup creates a group in the database
+func mustCreateGroup(t *testing.T, repos *Repositories, groupname string, gid int) *models.Group {
+	t.Helper()
+	group := &models.Group{Groupname: groupname, UnixGID: gid, Type: models.GroupTypePeople, Active: true}
+	if err := repos.Group.Create(group); err != nil {
+		t.Fatalf("Create group %s: %v", groupname, err)
+	}
+	return group
+}
+
+// mustCreateAccount creates an account in the database
+func mustCreateAccount(t *testing.T, repos *Repositories, username string, uid int, primaryGroupID uint) *models.Account {
+	t.Helper()
+	account := &models.Account{Username: username, UnixUID: uid, Type: models.AccountTypePeople, PrimaryGroupID: primaryGroupID, Active: true}
+	if err := repos.Account.Create(account); err != nil {
+		t.Fatalf("Create account %s: %v", username, err)
+	}
+	return account
+}
+
+func TestSQLiteAccountsAndGroups(t *testing.T) {
+	repos := newSQLiteRepositories(t)
+
+	staff := mustCreateGroup(t, repos, "staff", 1000)
+	alice := mustCreateAccount(t, repos, "alice", 1001, staff.ID)
+	if err := repos.Account.Create(&models.Account{Username: "alice", UnixUID: 1002, Type: models.AccountTypePeople}); err == nil {
+		t.Error("expected a duplicate username to be rejected")
+	}
+	if err := repos.Account.Create(&models.Account{Username: "bob", UnixUID: 1001, Type: models.AccountTypePeople}); err == nil {
+		t.Error("expected a duplicate UID to be rejected")
+	}
+	if err := repos.Group.Create(&models.Group{Groupname: "devs", UnixGID: 1000, Type: models.GroupTypePeople}); err == nil {
+		t.Error("expected a duplicate GID to be rejected")
+	}
+
+	found, err := repos.Account.FindByUsername("alice")
+	if err != nil || found.ID != alice.ID || found.PrimaryGroupID != staff.ID {
+		t.Fatalf("FindByUsername = %+v, %v", found, err)
+	}
+	if next, err := repos.Account.GetLatestUID(models.AccountTypePeople); err != nil || next != 1002 {
+		t.Errorf("GetLatestUID = %d, %v; want the next UID 1002", next, err)
+	}
+
+	// Updates check and increment the version
+	stale := *found
+	found.Firstname = "Alice"
+	if err := repos.Account.Update(found); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if found.Version != stale.Version+1 {
+		t.Errorf("version = %d after update, want %d", found.Version, stale.Version+1)
+	}
+	stale.Firstname = "Alicia"
+	if err := repos.Account.Update(&stale); !errors.Is(err, ErrVersionMismatch) {
+		t.Errorf("stale Update = %v, want ErrVersionMismatch", err)
+	}
+
+	// Memberships are unique and found from both sides
+	devs := mustCreateGroup(t, repos, "devs", 1001)
+	if err := repos.Account.AssignToGroup(alice.ID, devs.ID); err != nil {
+		t.Fatalf("AssignToGroup: %v", err)
+	}
+	if err := repos.Account.AssignToGroup(alice.ID, devs.ID); err == nil {
+		t.Error("expected a duplicate membership to be rejected")
+	}
+	if members, err := repos.Account.FindByGroupID(devs.ID); err != nil || len(members) != 1 || members[0].ID != alice.ID {
+		t.Errorf("FindByGroupID = %+v, %v", members, err)
+	}
+	if groups, err := repos.Group.FindByAccountID(alice.ID); err != nil || len(groups) != 1 || groups[0].ID != devs.ID {
+		t.Errorf("FindByAccountID = %+v, %v", groups, err)
+	}
+
+	// Deleted usernames stay reserved
+	if err := repos.Account.Delete(alice.ID, 0); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := repos.Account.FindByID(alice.ID); err == nil {
+		t.Error("expected the deleted account to be gone")
+	}
+	if deleted, err := repos.Account.IsUsernameDeleted("alice"); err != nil || !deleted {
+		t.Errorf("IsUsernameDeleted = %v, %v; want true", deleted, err)
+	}
+}
+
+func TestSQLiteChangeFeed(t *testing.T) {
+	repos := newSQLiteRepositories(t)
+
+	staff := mustCreateGroup(t, repos, "staff", 1000)
+	alice := mustCreateAccount(t, repos, "alice", 1001, 0)
+	if err := repos.Account.AssignToGroup(alice.ID, staff.ID); err != nil {
+		t.Fatalf("AssignToGroup: %v", err)
+	}
+
+	all, err := repos.Change.FindChangesSince(0, 100)
+	if err != nil {
+		t.Fatalf("FindChangesSince: %v", err)
+	}
+	if len(all.Groups) != 1 || len(all.Accounts) != 1 || len(all.Memberships) != 1 || len(all.Tombstones) != 0 {
+		t.Fatalf("changes = %+v", all)
+	}
+	seq := all.Memberships[0].ChangeSeq
+	if !(all.Groups[0].ChangeSeq < all.Accounts[0].ChangeSeq && all.Accounts[0].ChangeSeq < seq) {
+		t.Errorf("sequence numbers out of order: %+v", all)
+	}
+
+	// Removing the membership leaves a tombstone with a later number
+	if err := repos.Account.RemoveFromGroup(alice.ID, staff.ID); err != nil {
+		t.Fatalf("RemoveFromGroup: %v", err)
+	}
+	later, err := repos.Change.FindChangesSince(seq, 100)
+	if err != nil {
+		t.Fatalf("FindChangesSince: %v", err)
+	}
+	if len(later.Accounts)+len(later.Groups)+len(later.Memberships) != 0 || len(later.Tombstones) != 1 {
+		t.Fatalf("changes since %d = %+v", seq, later)
+	}
+	tombstone := later.Tombstones[0]
+	if tombstone.Kind != models.TombstoneMembership || tombstone.AccountID != alice.ID || tombstone.GroupID != staff.ID || tombstone.ChangeSeq <= seq {
+		t.Errorf("tombstone = %+v", tombstone)
+	}
+}
+
+func TestSQLiteEventLog(t *testing.T) {
+	repos := newSQLiteRepositories(t)
+
+	if latest, err := repos.Event.LatestID(); err != nil || latest != 0 {
+		t.Fatalf("LatestID = %d, %v; want 0 for an empty log", latest, err)
+	}
+	for _, id := range []uint{3, 7, 5} {
+		record := &models.EventRecord{ID: id, Type: models.EventAccountCreated, Section: "people", Payload: "{}"}
+		if err := repos.Event.Create(record); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+	if latest, err := repos.Event.LatestID(); err != nil || latest != 7 {
+		t.Errorf("LatestID = %d, %v; want 7", latest, err)
+	}
+	records, err := repos.Event.FindSince(3, 10)
+	if err != nil || len(records) != 2 || records[0].ID != 5 || records[1].ID != 7 {
+		t.Errorf("FindSince = %+v, %v; want 5 and 7", records, err)
+	}
+	if record, err := repos.Event.FindByID(5); err != nil || record.Type != models.EventAccountCreated {
+		t.Errorf("FindByID = %+v, %v", record, err)
+	}
+}
+
+func TestSQLiteUsersAndRecoveryCodes(t *testing.T) {
+	repos := newSQLiteRepositories(t)
+
+	user := &models.User{Username: "admin1", Email: "admin1@example.com", Password: "hash", Role: "admin", Active: true}
+	if err := repos.User.Create(user); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if found, err := repos.User.FindByEmail("admin1@example.com"); err != nil || found.ID != user.ID {
+		t.Fatalf("FindByEmail = %+v, %v", found, err)
+	}
+
+	// A TOTP time step can be claimed once, and older ones not at all
+	if claimed, err := repos.User.ClaimTOTPStep(user.ID, 100); err != nil || !claimed {
+		t.Errorf("ClaimTOTPStep(100) = %v, %v; want true", claimed, err)
+	}
+	for _, step := range []int64{100, 99} {
+		if claimed, err := repos.User.ClaimTOTPStep(user.ID, step); err != nil || claimed {
+			t.Errorf("ClaimTOTPStep(%d) = %v, %v; want false", step, claimed, err)
+		}
+	}
+
+	// Recovery codes work once; replacing them invalidates the old ones
+	if err := repos.Recovery.Replace(user.ID, []string{"a", "b"}); err != nil {
+		t.Fatalf("Replace: %v", err)
+	}
+	now := time.Now()
+	if used, err := repos.Recovery.Use(user.ID, "a", now); err != nil || !used {
+		t.Errorf("Use(a) = %v, %v; want true", used, err)
+	}
+	if used, err := repos.Recovery.Use(user.ID, "a", now); err != nil || used {
+		t.Errorf("Use(a) again = %v, %v; want false", used, err)
+	}
+	if left, err := repos.Recovery.CountUnused(user.ID); err != nil || left != 1 {
+		t.Errorf("CountUnused = %d, %v; want 1", left, err)
+	}
+	if err := repos.Recovery.Replace(user.ID, []string{"c"}); err != nil {
+		t.Fatalf("Replace: %v", err)
+	}
+	if used, err := repos.Recovery.Use(user.ID, "b", now); err != nil || used {
+		t.Errorf("Use(b) after Replace = %v, %v; want false", used, err)
+	}
+}
+
+func TestSQLiteSearch(t *testing.T) {
+	repos := newSQLiteRepositories(t)
+
+	staff := mustCreateGroup(t, repos, "staff", 1000)
+	mustCreateAccount(t, repos, "alice", 1001, staff.ID)
+	mustCreateAccount(t, repos, "bob", 1002, staff.ID)
+
+	// Without pg_trgm every record is ranked in Go, typos included
+	for _, query := range []string{"ALI", "alicee"} {
+		results, err := repos.Search.Search(query, 10)
+		if err != nil {
+			t.Fatalf("Search: %v", err)
+		}
+		if len(results) == 0 || results[0].Name != "alice" {
+			t.Errorf("Search(%s) = %+v, want alice first", query, results)
+		}
+	}
+}
+
+func TestSQLiteSavedSearches(t *testing.T) {
+	repos := newSQLiteRepositories(t)
+
+	for _, search := range []*models.SavedSearch{
+		{UserID: 1, Name: "services", Kind: models.SavedSearchAccounts, Query: "type:service"},
+		{UserID: 1, Name: "admins", Kind: models.SavedSearchGroups, Query: "groupname:admin*"},
+		{UserID: 2, Name: "services", Kind: models.SavedSearchAll, Query: "type:service"},
+	} {
+		if err := repos.SavedSearch.Create(search); err != nil {
+			t.Fatalf("Create %s: %v", search.Name, err)
+		}
+	}
+	if err := repos.SavedSearch.Create(&models.SavedSearch{UserID: 1, Name: "services", Kind: models.SavedSearchAll, Query: "x"}); err == nil {
+		t.Error("expected a duplicate name for the same user to be rejected")
+	}
+
+	searches, err := repos.SavedSearch.FindByUser(1)
+	if err != nil || len(searches) != 2 || searches[0].Name != "admins" || searches[1].Query != "type:service" {
+		t.Fatalf("FindByUser = %+v, %v", searches, err)
+	}
+	if err := repos.SavedSearch.Delete(searches[0].ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := repos.SavedSearch.FindByID(searches[0].ID); err == nil {
+		t.Error("expected the deleted saved search to be gone")
+	}
+}
@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/home/unixify/internal/models"
+	"gorm.io/gorm"
+)
+
+// SubIDRepository handles database operations for subordinate ID blocks
+type SubIDRepository struct {
+	db *gorm.DB
+}
+
+// NewSubIDRepository creates a new subordinate ID repository
+func NewSubIDRepository(db *gorm.DB) *SubIDRepository {
+	return &SubIDRepository{
+		db: db,
+	}
+}
+
+// Create creates a new block
+func (r *SubIDRepository) Create(block *models.SubIDRange) error {
+	return r.db.Create(block).Error
+}
+
+// FindByAccountID finds the block of an account
+func (r *SubIDRepository) FindByAccountID(accountID uint) (*models.SubIDRange, error) {
+	var block models.SubIDRange
+	err := r.db.Where("account_id = ?", accountID).First(&block).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("account with ID %d has no subordinate IDs", accountID)
+		}
+		return nil, err
+	}
+	return &block, nil
+}
+
+// FindAll finds all blocks ordered by start
+func (r *SubIDRepository) FindAll() ([]models.SubIDRange, error) {
+	var blocks []models.SubIDRange
+	err := r.db.Order("start").Find(&blocks).Error
+	if err != nil {
+		return nil, err
+	}
+	return blocks, nil
+}
+
+// DeleteByAccountID deletes the block of an account
+func (r *SubIDRepository) DeleteByAccountID(accountID uint) error {
+	return r.db.Where("account_id = ?", accountID).Delete(&models.SubIDRange{}).Error
+}
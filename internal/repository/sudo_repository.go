@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/home/unixify/internal/models"
+	"gorm.io/gorm"
+)
+
+// SudoRepository handles database operations for sudo rules
+type SudoRepository struct {
+	db *gorm.DB
+}
+
+// NewSudoRepository creates a new sudo rule repository
+func NewSudoRepository(db *gorm.DB) *SudoRepository {
+	return &SudoRepository{
+		db: db,
+	}
+}
+
+// Create creates a new sudo rule
+func (r *SudoRepository) Create(rule *models.SudoRule) error {
+	return r.db.Create(rule).Error
+}
+
+// FindByID finds a sudo rule by ID
+func (r *SudoRepository) FindByID(id uint) (*models.SudoRule, error) {
+	var rule models.SudoRule
+	err := r.db.First(&rule, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("sudo rule with ID %d not found", id)
+		}
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// FindAll finds all sudo rules ordered by name
+func (r *SudoRepository) FindAll() ([]models.SudoRule, error) {
+	var rules []models.SudoRule
+	err := r.db.Order("name").Find(&rules).Error
+	if err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// Update updates a sudo rule
+func (r *SudoRepository) Update(rule *models.SudoRule) error {
+	return r.db.Save(rule).Error
+}
+
+// Delete deletes a sudo rule
+func (r *SudoRepository) Delete(id uint) error {
+	return r.db.Delete(&models.SudoRule{}, id).Error
+}
@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/home/unixify/internal/models"
+	"gorm.io/gorm"
+)
+
+// TOTPChallengeRepository handles database operations for logins waiting
+// for a TOTP code
+type TOTPChallengeRepository struct {
+	db *gorm.DB
+}
+
+// NewTOTPChallengeRepository creates a new TOTP challenge repository
+func NewTOTPChallengeRepository(db *gorm.DB) *TOTPChallengeRepository {
+	return &TOTPChallengeRepository{
+		db: db,
+	}
+}
+
+// Create creates a new challenge
+func (r *TOTPChallengeRepository) Create(challenge *models.TOTPChallenge) error {
+	return r.db.Create(challenge).Error
+}
+
+// FindByTokenHash finds the challenge of a token; it returns nil if there
+// is none
+func (r *TOTPChallengeRepository) FindByTokenHash(hash string) (*models.TOTPChallenge, error) {
+	var challenge models.TOTPChallenge
+	err := r.db.Where("token_hash = ?", hash).First(&challenge).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &challenge, nil
+}
+
+// AddAttempt counts a code tried with a challenge. It returns false without
+// counting if max codes were tried already.
+func (r *TOTPChallengeRepository) AddAttempt(id uint, max int) (bool, error) {
+	result := r.db.Model(&models.TOTPChallenge{}).
+		Where("id = ? AND attempts < ?", id, max).
+		Update("attempts", gorm.Expr("attempts + 1"))
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// Delete deletes a challenge
+func (r *TOTPChallengeRepository) Delete(id uint) error {
+	return r.db.Delete(&models.TOTPChallenge{}, id).Error
+}
+
+// DeleteExpired deletes the challenges that expired before a time
+func (r *TOTPChallengeRepository) DeleteExpired(before time.Time) error {
+	return r.db.Where("expires_at < ?", before).Delete(&models.TOTPChallenge{}).Error
+}
@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/home/unixify/internal/models"
+	"gorm.io/gorm"
+)
+
+// TOTPRecoveryCodeRepository handles database operations for TOTP recovery
+// codes
+type TOTPRecoveryCodeRepository struct {
+	db *gorm.DB
+}
+
+// NewTOTPRecoveryCodeRepository creates a new TOTP recovery code repository
+func NewTOTPRecoveryCodeRepository(db *gorm.DB) *TOTPRecoveryCodeRepository {
+	return &TOTPRecoveryCodeRepository{
+		db: db,
+	}
+}
+
+// Replace replaces the recovery codes of a user with codes of the given
+// hashes
+func (r *TOTPRecoveryCodeRepository) Replace(userID uint, hashes []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.TOTPRecoveryCode{}).Error; err != nil {
+			return err
+		}
+		for _, hash := range hashes {
+			code := &models.TOTPRecoveryCode{UserID: userID, CodeHash: hash}
+			if err := tx.Create(code).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Use marks an unused recovery code of a user as used. It returns false if
+// the user has no such unused code.
+func (r *TOTPRecoveryCodeRepository) Use(userID uint, hash string, at time.Time) (bool, error) {
+	result := r.db.Model(&models.TOTPRecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hash).
+		Update("used_at", at)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// CountUnused counts the recovery codes a user has left
+func (r *TOTPRecoveryCodeRepository) CountUnused(userID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.TOTPRecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Count(&count).Error
+	return count, err
+}
+
+// DeleteByUser deletes the recovery codes of a user
+func (r *TOTPRecoveryCodeRepository) DeleteByUser(userID uint) error {
+	return r.db.Where("user_id = ?", userID).Delete(&models.TOTPRecoveryCode{}).Error
+}
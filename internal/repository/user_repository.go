@@ -2,114 +2,70 @@ package repository
 
 import (
 	"errors"
-	"time"
 
 	"github.com/home/unixify/internal/models"
 	"gorm.io/gorm"
 )
 
-// UserRepository handles database operations for RegisteredUser
+// UserRepository handles database operations for the users who log in
 type UserRepository struct {
-	DB *gorm.DB
+	db *gorm.DB
 }
 
-// NewUserRepository creates a new UserRepository
+// NewUserRepository creates a new user repository
 func NewUserRepository(db *gorm.DB) *UserRepository {
-	return &UserRepository{DB: db}
+	return &UserRepository{
+		db: db,
+	}
 }
 
-// CreateUser creates a new user with encrypted password
-func (r *UserRepository) CreateUser(user *models.RegisteredUser, password string) error {
-	// Convert plain text password to bytea
-	user.PasswordHash = []byte(password)
-	
-	// Database trigger will handle the encryption
+// Create creates a new user; its password must already be hashed
+func (r *UserRepository) Create(user *models.User) error {
+	return r.db.Create(user).Error
+}
 
-	// Create the user
-	result := r.DB.Create(user)
-	return result.Error
+// FindByID finds a user by ID; it returns nil if there is none
+func (r *UserRepository) FindByID(id uint) (*models.User, error) {
+	return r.find("id = ?", id)
 }
 
-// FindByUsername finds a user by their username
-func (r *UserRepository) FindByUsername(username string) (*models.RegisteredUser, error) {
-	var user models.RegisteredUser
-	result := r.DB.Where("username = ?", username).First(&user)
-	if result.Error \!= nil {
-		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			return nil, nil // User not found
-		}
-		return nil, result.Error // Database error
-	}
-	return &user, nil
+// FindByUsername finds a user by username; it returns nil if there is none
+func (r *UserRepository) FindByUsername(username string) (*models.User, error) {
+	return r.find("username = ?", username)
 }
 
-// FindByEmail finds a user by their email
-func (r *UserRepository) FindByEmail(email string) (*models.RegisteredUser, error) {
-	var user models.RegisteredUser
-	result := r.DB.Where("email = ?", email).First(&user)
-	if result.Error \!= nil {
-		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			return nil, nil // User not found
-		}
-		return nil, result.Error // Database error
-	}
-	return &user, nil
+// FindByEmail finds a user by email; it returns nil if there is none
+func (r *UserRepository) FindByEmail(email string) (*models.User, error) {
+	return r.find("email = ?", email)
 }
 
-// VerifyPassword verifies the user's password directly with the database
-func (r *UserRepository) VerifyPassword(username, password string) (bool, error) {
-	// Get the stored hash for this user
-	var storedHash []byte
-	result := r.DB.Model(&models.RegisteredUser{}).
-		Where("username = ?", username).
-		Select("password_hash").
-		Take(&storedHash)
-	
-	if result.Error \!= nil {
-		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			return false, nil // User not found
+// find finds the user matching a condition
+func (r *UserRepository) find(condition string, args ...interface{}) (*models.User, error) {
+	var user models.User
+	err := r.db.Where(condition, args...).First(&user).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
 		}
-		return false, result.Error // Database error
+		return nil, err
 	}
+	return &user, nil
+}
 
-	// For PostgreSQL with pgcrypto, we can verify directly with SQL
-	var passwordMatches bool
-	result = r.DB.Raw("SELECT (password_hash = crypt(?, password_hash)) FROM registered_users WHERE username = ?", 
-		password, username).Scan(&passwordMatches)
-	
-	if result.Error \!= nil {
+// ClaimTOTPStep records that a TOTP code of a time step was used. It
+// returns false if a code of that step or a later one was used before, so
+// that each code works once even when servers race.
+func (r *UserRepository) ClaimTOTPStep(id uint, step int64) (bool, error) {
+	result := r.db.Model(&models.User{}).
+		Where("id = ? AND totp_last_step < ?", id, step).
+		Update("totp_last_step", step)
+	if result.Error != nil {
 		return false, result.Error
 	}
-	
-	return passwordMatches, nil
-}
-
-// UpdateLastLogin updates the user's last login timestamp
-func (r *UserRepository) UpdateLastLogin(username string) error {
-	result := r.DB.Model(&models.RegisteredUser{}).
-		Where("username = ?", username).
-		Update("last_login", time.Now())
-	return result.Error
-}
-
-// EnableTOTP enables TOTP for a user
-func (r *UserRepository) EnableTOTP(username, secret string) error {
-	result := r.DB.Model(&models.RegisteredUser{}).
-		Where("username = ?", username).
-		Updates(map[string]interface{}{
-			"totp_enabled": true,
-			"totp_secret": secret,
-		})
-	return result.Error
+	return result.RowsAffected == 1, nil
 }
 
-// DisableTOTP disables TOTP for a user
-func (r *UserRepository) DisableTOTP(username string) error {
-	result := r.DB.Model(&models.RegisteredUser{}).
-		Where("username = ?", username).
-		Updates(map[string]interface{}{
-			"totp_enabled": false,
-			"totp_secret": "",
-		})
-	return result.Error
+// Update saves every field of a user
+func (r *UserRepository) Update(user *models.User) error {
+	return r.db.Save(user).Error
 }
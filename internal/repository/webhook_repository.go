@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/home/unixify/internal/models"
+	"gorm.io/gorm"
+)
+
+// WebhookRepository handles database operations for webhooks and their delivery queue
+type WebhookRepository struct {
+	db *gorm.DB
+}
+
+// NewWebhookRepository creates a new webhook repository
+func NewWebhookRepository(db *gorm.DB) *WebhookRepository {
+	return &WebhookRepository{
+		db: db,
+	}
+}
+
+// Create creates a new webhook
+func (r *WebhookRepository) Create(webhook *models.Webhook) error {
+	return r.db.Create(webhook).Error
+}
+
+// FindByID finds a webhook by ID
+func (r *WebhookRepository) FindByID(id uint) (*models.Webhook, error) {
+	var webhook models.Webhook
+	err := r.db.First(&webhook, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("webhook with ID %d not found", id)
+		}
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+// FindAll finds all webhooks
+func (r *WebhookRepository) FindAll() ([]models.Webhook, error) {
+	var webhooks []models.Webhook
+	err := r.db.Order("id").Find(&webhooks).Error
+	if err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+// FindActive finds the webhooks that receive events
+func (r *WebhookRepository) FindActive() ([]models.Webhook, error) {
+	var webhooks []models.Webhook
+	err := r.db.Where("active = ?", true).Order("id").Find(&webhooks).Error
+	if err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+// Update updates a webhook
+func (r *WebhookRepository) Update(webhook *models.Webhook) error {
+	return r.db.Save(webhook).Error
+}
+
+// Delete deletes a webhook together with its deliveries
+func (r *WebhookRepository) Delete(id uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("webhook_id = ?", id).Delete(&models.WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.Webhook{}, id).Error
+	})
+}
+
+// CreateDelivery queues a delivery
+func (r *WebhookRepository) CreateDelivery(delivery *models.WebhookDelivery) error {
+	return r.db.Create(delivery).Error
+}
+
+// FindDeliveries finds the deliveries of a webhook, newest first, optionally
+// filtered by status. A limit of 0 returns all of them.
+func (r *WebhookRepository) FindDeliveries(webhookID uint, status string, limit int) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+	query := r.db.Where("webhook_id = ?", webhookID)
+
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+
+	err := query.Order("id DESC").Find(&deliveries).Error
+	if err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// FindDueDeliveries finds pending deliveries whose next attempt is due, oldest first
+func (r *WebhookRepository) FindDueDeliveries(now time.Time, limit int) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+	err := r.db.Where("status = ? AND next_attempt_at <= ?", models.DeliveryPending, now).
+		Order("next_attempt_at, id").
+		Limit(limit).
+		Find(&deliveries).Error
+	if err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// ClaimDelivery starts an attempt: it counts the attempt and pushes the next one
+// back to until, so other dispatchers leave the delivery alone. It returns false
+// if another dispatcher claimed the delivery first.
+func (r *WebhookRepository) ClaimDelivery(delivery *models.WebhookDelivery, until time.Time) (bool, error) {
+	result := r.db.Model(&models.WebhookDelivery{}).
+		Where("id = ? AND status = ? AND attempts = ?", delivery.ID, models.DeliveryPending, delivery.Attempts).
+		Updates(map[string]interface{}{"attempts": delivery.Attempts + 1, "next_attempt_at": until})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+	delivery.Attempts++
+	delivery.NextAttemptAt = until
+	return true, nil
+}
+
+// UpdateDelivery records the outcome of an attempt
+func (r *WebhookRepository) UpdateDelivery(delivery *models.WebhookDelivery) error {
+	return r.db.Save(delivery).Error
+}
@@ -0,0 +1,196 @@
+// Package search ranks accounts and groups against a search query. Matching
+// is case-insensitive and tolerates typos by comparing trigrams the way
+// PostgreSQL's pg_trgm does, so a database can use pg_trgm indexes to find
+// the candidates and every backend ranks them the same.
+package search
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/home/unixify/internal/models"
+)
+
+// MinSimilarity is the trigram similarity below which a field does not
+// match; it is pg_trgm's default similarity threshold
+const MinSimilarity = 0.3
+
+// Scores of the kinds of match; trigram matches score below substrings
+const (
+	scoreExact     = 1.0
+	scorePrefix    = 0.9
+	scoreSubstring = 0.8
+	scoreSimilar   = 0.7 // Multiplied by the trigram similarity
+)
+
+// Normalize lowercases a query and trims its spaces
+func Normalize(query string) string {
+	return strings.ToLower(strings.Join(strings.Fields(query), " "))
+}
+
+// words splits text into its runs of letters and digits
+func words(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// trigrams returns the trigrams of text like pg_trgm's show_trgm: each word
+// is padded with two spaces in front and one behind
+func trigrams(text string) map[string]bool {
+	set := make(map[string]bool)
+	for _, word := range words(strings.ToLower(text)) {
+		padded := []rune("  " + word + " ")
+		for i := 0; i+3 <= len(padded); i++ {
+			set[string(padded[i:i+3])] = true
+		}
+	}
+	return set
+}
+
+// Similarity returns the share of trigrams two texts have in common, from 0
+// for nothing to 1 for the same trigrams, like pg_trgm's similarity
+func Similarity(a, b string) float64 {
+	ta, tb := trigrams(a), trigrams(b)
+	if len(ta) == 0 || len(tb) == 0 {
+		return 0
+	}
+	shared := 0
+	for trigram := range ta {
+		if tb[trigram] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(ta)+len(tb)-shared)
+}
+
+// fieldScore scores a normalized query against one field
+func fieldScore(query, field string) float64 {
+	field = strings.ToLower(field)
+	switch {
+	case field == "":
+		return 0
+	case field == query:
+		return scoreExact
+	case strings.HasPrefix(field, query):
+		return scorePrefix
+	case strings.Contains(field, query):
+		return scoreSubstring
+	}
+
+	// Compare with the whole field and with each of its words, so a
+	// misspelled word is found in a description
+	similarity := Similarity(query, field)
+	for _, word := range words(field) {
+		if s := Similarity(query, word); s > similarity {
+			similarity = s
+		}
+	}
+	if similarity < MinSimilarity {
+		return 0
+	}
+	return scoreSimilar * similarity
+}
+
+// best scores a query against named fields and returns the best one
+func best(query string, fields [][2]string) (string, float64) {
+	var bestField string
+	var bestScore float64
+	for _, field := range fields {
+		if score := fieldScore(query, field[1]); score > bestScore {
+			bestField, bestScore = field[0], score
+		}
+	}
+	return bestField, bestScore
+}
+
+// Rank scores accounts and groups against a query and returns the matches,
+// best first, at most limit of them. Numeric queries also match UIDs and
+// GIDs exactly.
+func Rank(query string, accounts []models.Account, groups []models.Group, limit int) []models.SearchResult {
+	query = Normalize(query)
+	if query == "" {
+		return []models.SearchResult{}
+	}
+	id, idErr := strconv.Atoi(query)
+
+	results := []models.SearchResult{}
+	for i := range accounts {
+		account := &accounts[i]
+		field, score := best(query, [][2]string{
+			{"username", account.Username},
+			{"firstname", account.Firstname},
+			{"surname", account.Surname},
+			{"name", strings.TrimSpace(account.Firstname + " " + account.Surname)},
+		})
+		if idErr == nil && account.UnixUID == id {
+			field, score = "uid", scoreExact
+		}
+		if score > 0 {
+			results = append(results, models.SearchResult{
+				Kind: models.SearchKindAccount, ID: account.ID, Name: account.Username, UnixID: account.UnixUID,
+				Type: string(account.Type), Field: field, Score: score, Account: account,
+			})
+		}
+	}
+	for i := range groups {
+		group := &groups[i]
+		field, score := best(query, [][2]string{
+			{"groupname", group.Groupname},
+			{"description", group.Description},
+		})
+		if idErr == nil && group.UnixGID == id {
+			field, score = "gid", scoreExact
+		}
+		if score > 0 {
+			results = append(results, models.SearchResult{
+				Kind: models.SearchKindGroup, ID: group.ID, Name: group.Groupname, UnixID: group.UnixGID,
+				Type: string(group.Type), Field: field, Score: score, Group: group,
+			})
+		}
+	}
+
+	return sortResults(results, limit)
+}
+
+// List returns accounts and groups as results that all score 1, accounts
+// first, at most limit of them
+func List(accounts []models.Account, groups []models.Group, limit int) []models.SearchResult {
+	results := []models.SearchResult{}
+	for i := range accounts {
+		account := &accounts[i]
+		results = append(results, models.SearchResult{
+			Kind: models.SearchKindAccount, ID: account.ID, Name: account.Username, UnixID: account.UnixUID,
+			Type: string(account.Type), Score: scoreExact, Account: account,
+		})
+	}
+	for i := range groups {
+		group := &groups[i]
+		results = append(results, models.SearchResult{
+			Kind: models.SearchKindGroup, ID: group.ID, Name: group.Groupname, UnixID: group.UnixGID,
+			Type: string(group.Type), Score: scoreExact, Group: group,
+		})
+	}
+	return sortResults(results, limit)
+}
+
+// sortResults sorts results best first, accounts before groups on ties,
+// then by name, and keeps at most limit of them
+func sortResults(results []models.SearchResult, limit int) []models.SearchResult {
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if a.Kind != b.Kind {
+			return a.Kind == models.SearchKindAccount
+		}
+		return a.Name < b.Name
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
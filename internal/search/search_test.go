@@ -0,0 +1,68 @@
+package search
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/home/unixify/internal/models"
+)
+
+func TestSimilarity(t *testing.T) {
+	// Values pg_trgm's similarity() returns for the same pairs
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		{"word", "word", 1},
+		{"word", "two words", 0.363636},
+		{"jsmith", "JSMITH", 1},
+		{"alise", "alice", 0.333333},
+		{"abc", "xyz", 0},
+		{"", "abc", 0},
+	}
+	for _, tt := range tests {
+		if got := Similarity(tt.a, tt.b); math.Abs(got-tt.want) > 1e-6 {
+			t.Errorf("Similarity(%q, %q) = %f, want %f", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestRank(t *testing.T) {
+	accounts := []models.Account{
+		{ID: 1, Username: "jsmith", UnixUID: 1001, Firstname: "John", Surname: "Smith"},
+		{ID: 2, Username: "asmithers", UnixUID: 1002, Firstname: "Anna", Surname: "Smithers"},
+		{ID: 3, Username: "bob", UnixUID: 1003, Firstname: "Bob", Surname: "Jones"},
+	}
+	groups := []models.Group{
+		{ID: 1, Groupname: "smith", UnixGID: 1003},
+		{ID: 2, Groupname: "ops", UnixGID: 1100, Description: "Blacksmith operators"},
+	}
+	rank := func(query string, limit int) string {
+		var got []string
+		for _, result := range Rank(query, accounts, groups, limit) {
+			got = append(got, fmt.Sprintf("%s:%s:%s:%.2f", result.Kind, result.Name, result.Field, result.Score))
+		}
+		return strings.Join(got, " ")
+	}
+
+	tests := []struct {
+		query, want string
+	}{
+		{"  SMITH ", "account:jsmith:surname:1.00 group:smith:groupname:1.00 account:asmithers:surname:0.90 group:ops:description:0.80"},
+		{"john smith", "account:jsmith:name:1.00 group:smith:groupname:0.38 account:asmithers:surname:0.23"},
+		{"1003", "account:bob:uid:1.00 group:smith:gid:1.00"},
+		{"operater", "group:ops:description:0.32"},
+		{"nothing", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := rank(tt.query, 0); got != tt.want {
+			t.Errorf("Rank(%q):\n got %s\nwant %s", tt.query, got, tt.want)
+		}
+	}
+	if got := rank("smith", 2); got != "account:jsmith:surname:1.00 group:smith:groupname:1.00" {
+		t.Errorf("Rank with limit 2 = %s", got)
+	}
+}
@@ -1,36 +1,78 @@
 package service
 
 import (
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/home/unixify/internal/models"
+	"github.com/home/unixify/internal/query"
 	"github.com/home/unixify/internal/repository"
+	"github.com/home/unixify/internal/username"
 	"github.com/home/unixify/internal/validator"
 )
 
 // AccountService handles business logic for accounts
 type AccountService struct {
-	accountRepo *repository.AccountRepository
-	groupRepo   *repository.GroupRepository
-	auditRepo   *repository.AuditRepository
+	accountRepo repository.AccountStore
+	groupRepo   repository.GroupStore
+	auditRepo   repository.AuditStore
+	events      EventPublisher
+	subIDs      *SubIDService // Gives people accounts subordinate IDs when set
+	names       validator.NamePolicy // Rules usernames must follow
+	deps        Deps                 // What writes build their transaction's services from
 }
 
 // NewAccountService creates a new account service
 func NewAccountService(
-	accountRepo *repository.AccountRepository,
-	groupRepo *repository.GroupRepository,
-	auditRepo *repository.AuditRepository,
+	accountRepo repository.AccountStore,
+	groupRepo repository.GroupStore,
+	auditRepo repository.AuditStore,
+	events EventPublisher,
 ) *AccountService {
 	return &AccountService{
 		accountRepo: accountRepo,
 		groupRepo:   groupRepo,
 		auditRepo:   auditRepo,
+		events:      events,
+		names:       validator.DefaultNamePolicy(),
 	}
 }
 
-// CreateAccount creates a new account
+// transaction runs fn on the account service of a transaction, so a change, its
+// audit entry and its events are saved together; see transaction
+func (s *AccountService) transaction(fn func(tx *AccountService) error) error {
+	if s.deps.DB == nil {
+		return fn(s) // In-memory repositories have no transactions
+	}
+	return transaction(s.deps, func(tx *Services) error {
+		return fn(tx.Account)
+	})
+}
+
+// CreateAccount creates a new, active account
 func (s *AccountService) CreateAccount(account *models.Account, userID uint, username, ipAddress string) error {
+	return s.transaction(func(tx *AccountService) error {
+		return tx.createAccount(account, true, userID, username, ipAddress)
+	})
+}
+
+// CreateInactiveAccount creates a new account that is inactive from the start
+func (s *AccountService) CreateInactiveAccount(account *models.Account, userID uint, username, ipAddress string) error {
+	return s.transaction(func(tx *AccountService) error {
+		return tx.createAccount(account, false, userID, username, ipAddress)
+	})
+}
+
+// createAccount does the work of CreateAccount and CreateInactiveAccount inside their transaction
+func (s *AccountService) createAccount(account *models.Account, active bool, userID uint, username, ipAddress string) error {
+	// Enforce the naming policy
+	if err := s.names.ValidateUsername(account.Username, account.Type); err != nil {
+		return err
+	}
+
 	// Validate UID - now just a warning
 	if err := validator.ValidateUIDForType(account.UnixUID, account.Type); err != nil {
 		// If it's a warning (starts with "WARNING:"), log it but continue
@@ -80,18 +122,48 @@ func (s *AccountService) CreateAccount(account *models.Account, userID uint, use
 		return err
 	}
 
+	// The active column defaults to true, so an inactive account is saved
+	// again before it is audited and published
+	details := fmt.Sprintf("Created account %s with UID %d", account.Username, account.UnixUID)
+	if !active {
+		account.Active = false
+		if err := s.accountRepo.Update(account); err != nil {
+			return err
+		}
+		details += ", inactive"
+	}
+
 	// Log audit entry
 	auditEntry := &models.AuditEntry{
 		Action:     "create",
 		EntityID:   account.ID,
 		EntityType: "account",
-		Details:    fmt.Sprintf("Created account %s with UID %d", account.Username, account.UnixUID),
+		Details:    details,
 		UserID:     userID,
 		Username:   username,
 		IPAddress:  ipAddress,
 		Timestamp:  time.Now(),
 	}
-	return s.auditRepo.Create(auditEntry)
+	if err := s.auditRepo.Create(auditEntry); err != nil {
+		return err
+	}
+	if err := s.events.Publish(newEvent(models.EventAccountCreated, string(account.Type), auditEntry, nil, eventAccount(account))); err != nil {
+		return err
+	}
+	return s.allocateSubIDs(account, userID, username, ipAddress)
+}
+
+// allocateSubIDs gives a people account its subordinate ID block if it has
+// none. It runs in the transaction of the account change, so an account is
+// never saved without its block.
+func (s *AccountService) allocateSubIDs(account *models.Account, userID uint, username, ipAddress string) error {
+	if s.subIDs == nil || account.Type != models.AccountTypePeople {
+		return nil
+	}
+	if _, err := s.subIDs.AllocateSubIDs(account.ID, userID, username, ipAddress); err != nil {
+		return fmt.Errorf("failed to allocate subordinate IDs to account %s: %w", account.Username, err)
+	}
+	return nil
 }
 
 // GetAccount gets an account by ID
@@ -116,6 +188,13 @@ func (s *AccountService) GetAllAccounts(accountType models.AccountType) ([]model
 
 // UpdateAccount updates an account
 func (s *AccountService) UpdateAccount(account *models.Account, userID uint, username, ipAddress string) error {
+	return s.transaction(func(tx *AccountService) error {
+		return tx.updateAccount(account, userID, username, ipAddress)
+	})
+}
+
+// updateAccount does the work of UpdateAccount inside its transaction
+func (s *AccountService) updateAccount(account *models.Account, userID uint, username, ipAddress string) error {
 	// Validate UID - now just a warning
 	if err := validator.ValidateUIDForType(account.UnixUID, account.Type); err != nil {
 		// If it's a warning (starts with "WARNING:"), log it but continue
@@ -134,6 +213,14 @@ func (s *AccountService) UpdateAccount(account *models.Account, userID uint, use
 		return err
 	}
 
+	// Enforce the naming policy when the name or type changes, so accounts
+	// from before the policy can still be edited
+	if originalAccount.Username != account.Username || originalAccount.Type != account.Type {
+		if err := s.names.ValidateUsername(account.Username, account.Type); err != nil {
+			return err
+		}
+	}
+
 	// Check if UID already exists using the improved method
 	isDuplicate, err := s.accountRepo.IsUIDDuplicate(account.UnixUID, account.ID)
 	if err != nil {
@@ -184,11 +271,24 @@ func (s *AccountService) UpdateAccount(account *models.Account, userID uint, use
 		IPAddress:  ipAddress,
 		Timestamp:  time.Now(),
 	}
-	return s.auditRepo.Create(auditEntry)
+	if err := s.auditRepo.Create(auditEntry); err != nil {
+		return err
+	}
+	if err := s.events.Publish(newEvent(models.EventAccountUpdated, string(account.Type), auditEntry, eventAccount(originalAccount), eventAccount(account))); err != nil {
+		return err
+	}
+	return s.allocateSubIDs(account, userID, username, ipAddress)
 }
 
-// DeleteAccount soft deletes an account
-func (s *AccountService) DeleteAccount(id uint, userID uint, username, ipAddress string) error {
+// DeleteAccount deletes an account if it is still at version; version 0 deletes it regardless
+func (s *AccountService) DeleteAccount(id uint, version int, userID uint, username, ipAddress string) error {
+	return s.transaction(func(tx *AccountService) error {
+		return tx.deleteAccount(id, version, userID, username, ipAddress)
+	})
+}
+
+// deleteAccount does the work of DeleteAccount inside its transaction
+func (s *AccountService) deleteAccount(id uint, version int, userID uint, username, ipAddress string) error {
 	// Get account to record username in audit
 	account, err := s.accountRepo.FindByID(id)
 	if err != nil {
@@ -196,7 +296,7 @@ func (s *AccountService) DeleteAccount(id uint, userID uint, username, ipAddress
 	}
 
 	// Delete account
-	err = s.accountRepo.Delete(id)
+	err = s.accountRepo.Delete(id, version)
 	if err != nil {
 		return err
 	}
@@ -212,7 +312,10 @@ func (s *AccountService) DeleteAccount(id uint, userID uint, username, ipAddress
 		IPAddress:  ipAddress,
 		Timestamp:  time.Now(),
 	}
-	return s.auditRepo.Create(auditEntry)
+	if err := s.auditRepo.Create(auditEntry); err != nil {
+		return err
+	}
+	return s.events.Publish(newEvent(models.EventAccountDeleted, string(account.Type), auditEntry, eventAccount(account), nil))
 }
 
 // GetAccountsInGroup gets all accounts in a specific group
@@ -222,6 +325,13 @@ func (s *AccountService) GetAccountsInGroup(groupID uint) ([]models.Account, err
 
 // AssignAccountToGroup assigns an account to a group
 func (s *AccountService) AssignAccountToGroup(accountID, groupID uint, userID uint, username, ipAddress string) error {
+	return s.transaction(func(tx *AccountService) error {
+		return tx.assignAccountToGroup(accountID, groupID, userID, username, ipAddress)
+	})
+}
+
+// assignAccountToGroup does the work of AssignAccountToGroup inside its transaction
+func (s *AccountService) assignAccountToGroup(accountID, groupID uint, userID uint, username, ipAddress string) error {
 	// Check if account exists
 	account, err := s.accountRepo.FindByID(accountID)
 	if err != nil {
@@ -256,11 +366,21 @@ func (s *AccountService) AssignAccountToGroup(accountID, groupID uint, userID ui
 		IPAddress:  ipAddress,
 		Timestamp:  time.Now(),
 	}
-	return s.auditRepo.Create(auditEntry)
+	if err := s.auditRepo.Create(auditEntry); err != nil {
+		return err
+	}
+	return s.events.Publish(newEvent(models.EventMembershipAdded, string(account.Type), auditEntry, nil, eventMembership(account, group)))
 }
 
 // RemoveAccountFromGroup removes an account from a group
 func (s *AccountService) RemoveAccountFromGroup(accountID, groupID uint, userID uint, username, ipAddress string) error {
+	return s.transaction(func(tx *AccountService) error {
+		return tx.removeAccountFromGroup(accountID, groupID, userID, username, ipAddress)
+	})
+}
+
+// removeAccountFromGroup does the work of RemoveAccountFromGroup inside its transaction
+func (s *AccountService) removeAccountFromGroup(accountID, groupID uint, userID uint, username, ipAddress string) error {
 	// Check if account exists
 	account, err := s.accountRepo.FindByID(accountID)
 	if err != nil {
@@ -290,7 +410,10 @@ func (s *AccountService) RemoveAccountFromGroup(accountID, groupID uint, userID
 		IPAddress:  ipAddress,
 		Timestamp:  time.Now(),
 	}
-	return s.auditRepo.Create(auditEntry)
+	if err := s.auditRepo.Create(auditEntry); err != nil {
+		return err
+	}
+	return s.events.Publish(newEvent(models.EventMembershipRemoved, string(account.Type), auditEntry, eventMembership(account, group), nil))
 }
 
 // GetAccountGroups gets all groups that an account is a member of
@@ -298,9 +421,15 @@ func (s *AccountService) GetAccountGroups(accountID uint) ([]models.Group, error
 	return s.groupRepo.FindByAccountID(accountID)
 }
 
-// SearchAccounts searches for accounts by UID or username
-func (s *AccountService) SearchAccounts(query string) ([]models.Account, error) {
-	return s.accountRepo.Search(query)
+// SearchAccounts finds the accounts matching a query in the query language;
+// bare words match part of a username, name or UID. Parse errors are
+// *query.Error.
+func (s *AccountService) SearchAccounts(input string) ([]models.Account, error) {
+	q, err := query.Parse(input, query.KindAccount)
+	if err != nil {
+		return nil, err
+	}
+	return s.accountRepo.FindByQuery(q)
 }
 
 // IsUIDDuplicate checks if a UID already exists
@@ -311,4 +440,100 @@ func (s *AccountService) IsUIDDuplicate(uid int, excludeID uint) (bool, error) {
 // GetNextAvailableUID gets the next available UID for a specific account type
 func (s *AccountService) GetNextAvailableUID(accountType models.AccountType) (int, error) {
 	return s.accountRepo.GetLatestUID(accountType)
-}
\ No newline at end of file
+}
+
+// maxUsernameSuffix is the highest numeric suffix GenerateUsername tries
+const maxUsernameSuffix = 999
+
+// UsernameSuggestion is the username a template gives for a person, or why
+// it gives none
+type UsernameSuggestion struct {
+	Template string `json:"template"`
+	Username string `json:"username,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// GenerateUsername fills in a username template for a person. A name that
+// is taken by an account, was used by a deleted account or is reserved gets
+// a numeric suffix: jsmith2, jsmith3 and so on. The name is shortened to fit
+// the naming policy, and the type's prefix is added if the template leaves
+// it out.
+func (s *AccountService) GenerateUsername(template, firstname, surname string, accountType models.AccountType) (string, error) {
+	t, err := username.Parse(template)
+	if err != nil {
+		return "", err
+	}
+	base, err := t.Render(firstname, surname)
+	if err != nil {
+		return "", err
+	}
+	if prefix := s.names.AccountPrefixes[accountType]; prefix != "" && !strings.HasPrefix(base, prefix) {
+		base = prefix + base
+	}
+	if s.names.MaxLength > 0 && len(base) > s.names.MaxLength {
+		base = base[:s.names.MaxLength]
+	}
+
+	for n := 1; n <= maxUsernameSuffix; n++ {
+		candidate := base
+		if n > 1 {
+			suffix := strconv.Itoa(n)
+			if s.names.MaxLength > 0 && len(candidate)+len(suffix) > s.names.MaxLength {
+				candidate = candidate[:s.names.MaxLength-len(suffix)]
+			}
+			candidate += suffix
+		}
+
+		if err := s.names.ValidateUsername(candidate, accountType); err != nil {
+			if onlyReserved(err) {
+				continue
+			}
+			return "", err
+		}
+		if existing, err := s.accountRepo.FindByUsername(candidate); err == nil && existing != nil {
+			continue
+		}
+		deleted, err := s.accountRepo.IsUsernameDeleted(candidate)
+		if err != nil {
+			return "", err
+		}
+		if !deleted {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("no free username for template %s: %s to %s%d are taken", template, base, base, maxUsernameSuffix)
+}
+
+// SuggestUsernames generates a username with each template, or with
+// username.DefaultTemplates when none are given
+func (s *AccountService) SuggestUsernames(templates []string, firstname, surname string, accountType models.AccountType) []UsernameSuggestion {
+	if len(templates) == 0 {
+		templates = username.DefaultTemplates
+	}
+	suggestions := make([]UsernameSuggestion, 0, len(templates))
+	for _, template := range templates {
+		suggestion := UsernameSuggestion{Template: template}
+		generated, err := s.GenerateUsername(template, firstname, surname, accountType)
+		if err != nil {
+			suggestion.Error = err.Error()
+		}
+		suggestion.Username = generated
+		suggestions = append(suggestions, suggestion)
+	}
+	return suggestions
+}
+
+// onlyReserved reports whether a naming policy error only refuses a
+// reserved name
+func onlyReserved(err error) bool {
+	var fields validator.FieldErrors
+	if !errors.As(err, &fields) {
+		return false
+	}
+	for _, field := range fields {
+		if field.Code != validator.CodeReserved {
+			return false
+		}
+	}
+	return true
+}
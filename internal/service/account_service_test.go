@@ -0,0 +1,410 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/home/unixify/internal/models"
+	"github.com/home/unixify/internal/query"
+	"github.com/home/unixify/internal/repository"
+)
+
+func TestCreateAccount(t *testing.T) {
+	services, repos := newTestServices(t)
+	staff := mustCreateGroup(t, services, "staff", 1000, models.GroupTypePeople)
+
+	account := mustCreateAccount(t, services, "alice", 1001, models.AccountTypePeople, staff.ID)
+	if account.ID == 0 {
+		t.Fatal("expected the account to get an ID")
+	}
+	if !account.Active {
+		t.Error("expected new accounts to be active")
+	}
+
+	stored, err := services.Account.GetAccount(account.ID)
+	if err != nil {
+		t.Fatalf("GetAccount: %v", err)
+	}
+	if stored.PrimaryGroup == nil || stored.PrimaryGroup.Groupname != "staff" {
+		t.Errorf("expected primary group staff to be loaded, got %+v", stored.PrimaryGroup)
+	}
+
+	if got := auditActions(t, repos, "account"); !reflect.DeepEqual(got, []string{"create"}) {
+		t.Errorf("audit actions = %v, want [create]", got)
+	}
+}
+
+func TestCreateAccountRules(t *testing.T) {
+	services, _ := newTestServices(t)
+	staff := mustCreateGroup(t, services, "staff", 1000, models.GroupTypePeople)
+	wheel := mustCreateGroup(t, services, "wheel", 10, models.GroupTypeSystem)
+	mustCreateAccount(t, services, "alice", 1001, models.AccountTypePeople, staff.ID)
+
+	tests := []struct {
+		name    string
+		account models.Account
+		wantErr string
+	}{
+		{
+			name:    "duplicate UID",
+			account: models.Account{Username: "bob", UnixUID: 1001, Type: models.AccountTypePeople},
+			wantErr: "account with UID 1001 already exists",
+		},
+		{
+			name:    "duplicate username",
+			account: models.Account{Username: "alice", UnixUID: 1002, Type: models.AccountTypePeople},
+			wantErr: "account with username alice already exists",
+		},
+		{
+			name:    "invalid type",
+			account: models.Account{Username: "bob", UnixUID: 1002, Type: "robot"},
+			wantErr: "invalid account type",
+		},
+		{
+			name:    "negative UID",
+			account: models.Account{Username: "bob", UnixUID: -1, Type: models.AccountTypePeople},
+			wantErr: "UID cannot be negative",
+		},
+		{
+			name:    "missing primary group",
+			account: models.Account{Username: "bob", UnixUID: 1002, Type: models.AccountTypePeople, PrimaryGroupID: 99},
+			wantErr: "primary group with ID 99 not found",
+		},
+		{
+			name:    "system account without primary group",
+			account: models.Account{Username: "monitor", UnixUID: 2, Type: models.AccountTypeSystem},
+			wantErr: "system accounts must have a primary group",
+		},
+		{
+			name:    "system account with people primary group",
+			account: models.Account{Username: "monitor", UnixUID: 2, Type: models.AccountTypeSystem, PrimaryGroupID: staff.ID},
+			wantErr: "system accounts must have a system group as primary group",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			account := tt.account
+			err := services.Account.CreateAccount(&account, testUserID, testUsername, testIP)
+			expectError(t, err, tt.wantErr)
+		})
+	}
+
+	t.Run("system account with system primary group", func(t *testing.T) {
+		mustCreateAccount(t, services, "monitor", 2, models.AccountTypeSystem, wheel.ID)
+	})
+
+	t.Run("UID outside the recommended range is only a warning", func(t *testing.T) {
+		mustCreateAccount(t, services, "carol", 500, models.AccountTypePeople, 0)
+	})
+}
+
+func TestUpdateAccountRules(t *testing.T) {
+	services, repos := newTestServices(t)
+	staff := mustCreateGroup(t, services, "staff", 1000, models.GroupTypePeople)
+	wheel := mustCreateGroup(t, services, "wheel", 10, models.GroupTypeSystem)
+	alice := mustCreateAccount(t, services, "alice", 1001, models.AccountTypePeople, staff.ID)
+	mustCreateAccount(t, services, "bob", 1002, models.AccountTypePeople, staff.ID)
+
+	update := func(change func(*models.Account)) error {
+		account, err := services.Account.GetAccount(alice.ID)
+		if err != nil {
+			t.Fatalf("GetAccount: %v", err)
+		}
+		change(account)
+		return services.Account.UpdateAccount(account, testUserID, testUsername, testIP)
+	}
+
+	expectError(t, update(func(a *models.Account) { a.UnixUID = 1002 }), "account with UID 1002 already exists")
+	expectError(t, update(func(a *models.Account) { a.Username = "bob" }), "account with username bob already exists")
+	expectError(t, update(func(a *models.Account) { a.PrimaryGroupID = 99 }), "primary group with ID 99 not found")
+	expectError(t, update(func(a *models.Account) { a.Type = models.AccountTypeSystem; a.UnixUID = 3 }),
+		"system accounts must have a system group as primary group")
+
+	missing := &models.Account{ID: 99, Username: "ghost", UnixUID: 1099, Type: models.AccountTypePeople}
+	expectError(t, services.Account.UpdateAccount(missing, testUserID, testUsername, testIP), "account with ID 99 not found")
+
+	// Keeping its own UID and username is not a conflict
+	if err := update(func(a *models.Account) { a.Firstname = "Alice" }); err != nil {
+		t.Fatalf("UpdateAccount without conflicts: %v", err)
+	}
+
+	// A system account is valid once it has a system primary group
+	if err := update(func(a *models.Account) {
+		a.Type = models.AccountTypeSystem
+		a.UnixUID = 3
+		a.PrimaryGroupID = wheel.ID
+	}); err != nil {
+		t.Fatalf("UpdateAccount to system: %v", err)
+	}
+
+	stored, err := services.Account.GetAccountByUID(3)
+	if err != nil {
+		t.Fatalf("GetAccountByUID: %v", err)
+	}
+	if stored.Type != models.AccountTypeSystem || stored.Firstname != "Alice" {
+		t.Errorf("unexpected stored account %+v", stored)
+	}
+
+	want := []string{"create", "create", "update", "update"}
+	if got := auditActions(t, repos, "account"); !reflect.DeepEqual(got, want) {
+		t.Errorf("audit actions = %v, want %v", got, want)
+	}
+}
+
+func TestUpdateAccountVersionConflict(t *testing.T) {
+	services, repos := newTestServices(t)
+	alice := mustCreateAccount(t, services, "alice", 1001, models.AccountTypePeople, 0)
+	if alice.Version != 1 {
+		t.Fatalf("new account version = %d, want 1", alice.Version)
+	}
+
+	// Two admins load the same account
+	first, err := services.Account.GetAccount(alice.ID)
+	if err != nil {
+		t.Fatalf("GetAccount: %v", err)
+	}
+	second, err := services.Account.GetAccount(alice.ID)
+	if err != nil {
+		t.Fatalf("GetAccount: %v", err)
+	}
+
+	first.Firstname = "Alice"
+	if err := services.Account.UpdateAccount(first, testUserID, testUsername, testIP); err != nil {
+		t.Fatalf("UpdateAccount: %v", err)
+	}
+	if first.Version != 2 {
+		t.Errorf("version after update = %d, want 2", first.Version)
+	}
+
+	second.Surname = "Liddell"
+	err = services.Account.UpdateAccount(second, testUserID, testUsername, testIP)
+	if !errors.Is(err, repository.ErrVersionMismatch) {
+		t.Fatalf("UpdateAccount with a stale version = %v, want ErrVersionMismatch", err)
+	}
+
+	stored, err := services.Account.GetAccount(alice.ID)
+	if err != nil {
+		t.Fatalf("GetAccount: %v", err)
+	}
+	if stored.Firstname != "Alice" || stored.Surname != "" || stored.Version != 2 {
+		t.Errorf("unexpected stored account %+v", stored)
+	}
+
+	want := []string{"create", "update"}
+	if got := auditActions(t, repos, "account"); !reflect.DeepEqual(got, want) {
+		t.Errorf("audit actions = %v, want %v", got, want)
+	}
+}
+
+func TestDeleteAccount(t *testing.T) {
+	services, repos := newTestServices(t)
+	alice := mustCreateAccount(t, services, "alice", 1001, models.AccountTypePeople, 0)
+
+	err := services.Account.DeleteAccount(alice.ID, alice.Version+1, testUserID, testUsername, testIP)
+	if !errors.Is(err, repository.ErrVersionMismatch) {
+		t.Fatalf("DeleteAccount with a stale version = %v, want ErrVersionMismatch", err)
+	}
+	if err := services.Account.DeleteAccount(alice.ID, alice.Version, testUserID, testUsername, testIP); err != nil {
+		t.Fatalf("DeleteAccount: %v", err)
+	}
+	if _, err := services.Account.GetAccount(alice.ID); err == nil {
+		t.Error("expected the deleted account to be gone")
+	}
+	expectError(t, services.Account.DeleteAccount(alice.ID, 0, testUserID, testUsername, testIP), "not found")
+
+	// The UID and username are free again
+	mustCreateAccount(t, services, "alice", 1001, models.AccountTypePeople, 0)
+
+	want := []string{"create", "delete", "create"}
+	if got := auditActions(t, repos, "account"); !reflect.DeepEqual(got, want) {
+		t.Errorf("audit actions = %v, want %v", got, want)
+	}
+}
+
+func TestAssignAccountToGroupRules(t *testing.T) {
+	tests := []struct {
+		accountType models.AccountType
+		groupType   models.GroupType
+		allowed     bool
+	}{
+		{models.AccountTypePeople, models.GroupTypePeople, true},
+		{models.AccountTypePeople, models.GroupTypeDatabase, true},
+		{models.AccountTypePeople, models.GroupTypeSystem, false},
+		{models.AccountTypePeople, models.GroupTypeService, false},
+		{models.AccountTypeSystem, models.GroupTypeSystem, true},
+		{models.AccountTypeSystem, models.GroupTypePeople, false},
+		{models.AccountTypeDatabase, models.GroupTypeDatabase, true},
+		{models.AccountTypeDatabase, models.GroupTypePeople, false},
+		{models.AccountTypeService, models.GroupTypeService, true},
+		{models.AccountTypeService, models.GroupTypeDatabase, false},
+	}
+
+	uids := map[models.AccountType]int{
+		models.AccountTypePeople:   1001,
+		models.AccountTypeSystem:   2,
+		models.AccountTypeDatabase: 70001,
+		models.AccountTypeService:  60002,
+	}
+	gids := map[models.GroupType]int{
+		models.GroupTypePeople:   1000,
+		models.GroupTypeSystem:   10,
+		models.GroupTypeDatabase: 70000,
+		models.GroupTypeService:  60001,
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.accountType)+"-"+string(tt.groupType), func(t *testing.T) {
+			services, _ := newTestServices(t)
+			primary := mustCreateGroup(t, services, "primary", 20, models.GroupTypeSystem)
+			group := mustCreateGroup(t, services, "target", gids[tt.groupType], tt.groupType)
+			account := mustCreateAccount(t, services, "member", uids[tt.accountType], tt.accountType, primary.ID)
+
+			err := services.Account.AssignAccountToGroup(account.ID, group.ID, testUserID, testUsername, testIP)
+			if tt.allowed && err != nil {
+				t.Fatalf("expected assignment to be allowed: %v", err)
+			}
+			if !tt.allowed {
+				expectError(t, err, "cannot be assigned to group of type")
+			}
+		})
+	}
+}
+
+func TestAssignAndRemoveMembership(t *testing.T) {
+	services, repos := newTestServices(t)
+	staff := mustCreateGroup(t, services, "staff", 1000, models.GroupTypePeople)
+	devs := mustCreateGroup(t, services, "devs", 1001, models.GroupTypePeople)
+	alice := mustCreateAccount(t, services, "alice", 1001, models.AccountTypePeople, staff.ID)
+
+	if err := services.Account.AssignAccountToGroup(alice.ID, devs.ID, testUserID, testUsername, testIP); err != nil {
+		t.Fatalf("AssignAccountToGroup: %v", err)
+	}
+	expectError(t, services.Account.AssignAccountToGroup(alice.ID, devs.ID, testUserID, testUsername, testIP),
+		"already a member")
+	expectError(t, services.Account.AssignAccountToGroup(99, devs.ID, testUserID, testUsername, testIP), "account with ID 99 not found")
+	expectError(t, services.Account.AssignAccountToGroup(alice.ID, 99, testUserID, testUsername, testIP), "group with ID 99 not found")
+
+	groups, err := services.Account.GetAccountGroups(alice.ID)
+	if err != nil {
+		t.Fatalf("GetAccountGroups: %v", err)
+	}
+	if len(groups) != 1 || groups[0].Groupname != "devs" {
+		t.Errorf("GetAccountGroups = %+v, want [devs]", groups)
+	}
+
+	members, err := services.Group.GetGroupMembers(devs.ID)
+	if err != nil {
+		t.Fatalf("GetGroupMembers: %v", err)
+	}
+	if len(members) != 1 || members[0].Username != "alice" {
+		t.Errorf("GetGroupMembers = %+v, want [alice]", members)
+	}
+
+	if err := services.Account.RemoveAccountFromGroup(alice.ID, devs.ID, testUserID, testUsername, testIP); err != nil {
+		t.Fatalf("RemoveAccountFromGroup: %v", err)
+	}
+	groups, err = services.Account.GetAccountGroups(alice.ID)
+	if err != nil {
+		t.Fatalf("GetAccountGroups: %v", err)
+	}
+	if len(groups) != 0 {
+		t.Errorf("expected no groups after removal, got %+v", groups)
+	}
+
+	want := []string{"assign", "remove"}
+	if got := auditActions(t, repos, "account_group"); !reflect.DeepEqual(got, want) {
+		t.Errorf("audit actions = %v, want %v", got, want)
+	}
+}
+
+func TestNextAvailableUIDAndSearch(t *testing.T) {
+	services, _ := newTestServices(t)
+
+	uid, err := services.Account.GetNextAvailableUID(models.AccountTypeService)
+	if err != nil {
+		t.Fatalf("GetNextAvailableUID: %v", err)
+	}
+	if uid != 60001 {
+		t.Errorf("first service UID = %d, want 60001", uid)
+	}
+
+	mustCreateAccount(t, services, "alice", 1001, models.AccountTypePeople, 0)
+	mustCreateAccount(t, services, "albert", 1005, models.AccountTypePeople, 0)
+	mustCreateAccount(t, services, "bob", 1003, models.AccountTypePeople, 0)
+
+	uid, err = services.Account.GetNextAvailableUID(models.AccountTypePeople)
+	if err != nil {
+		t.Fatalf("GetNextAvailableUID: %v", err)
+	}
+	if uid != 1006 {
+		t.Errorf("next people UID = %d, want 1006", uid)
+	}
+
+	duplicate, err := services.Account.IsUIDDuplicate(1003, 0)
+	if err != nil || !duplicate {
+		t.Errorf("IsUIDDuplicate(1003) = %v, %v; want true", duplicate, err)
+	}
+
+	accounts, err := services.Account.SearchAccounts("al")
+	if err != nil {
+		t.Fatalf("SearchAccounts: %v", err)
+	}
+	if len(accounts) != 2 {
+		t.Errorf("SearchAccounts(al) returned %d accounts, want 2", len(accounts))
+	}
+	accounts, err = services.Account.SearchAccounts("1003")
+	if err != nil {
+		t.Fatalf("SearchAccounts: %v", err)
+	}
+	if len(accounts) != 1 || accounts[0].Username != "bob" {
+		t.Errorf("SearchAccounts(1003) = %+v, want [bob]", accounts)
+	}
+	accounts, err = services.Account.SearchAccounts("type:people uid:>1001 -username:b*")
+	if err != nil {
+		t.Fatalf("SearchAccounts: %v", err)
+	}
+	if len(accounts) != 1 || accounts[0].Username != "albert" {
+		t.Errorf("SearchAccounts(type:people uid:>1001 -username:b*) = %+v, want [albert]", accounts)
+	}
+	var parseErr *query.Error
+	if _, err := services.Account.SearchAccounts("has-member:bob"); !errors.As(err, &parseErr) {
+		t.Errorf("SearchAccounts(has-member:bob) error = %v, want a parse error", err)
+	}
+}
+
+func TestGenerateUsername(t *testing.T) {
+	services, _ := newTestServices(t)
+
+	// Taken and deleted names get a suffix
+	mustCreateAccount(t, services, "jsmith", 1001, models.AccountTypePeople, 0)
+	deleted := mustCreateAccount(t, services, "jsmith2", 1002, models.AccountTypePeople, 0)
+	if err := services.Account.DeleteAccount(deleted.ID, 0, testUserID, testUsername, testIP); err != nil {
+		t.Fatalf("DeleteAccount: %v", err)
+	}
+	generated, err := services.Account.GenerateUsername("{f}{surname}", "Jane", "Smith", models.AccountTypePeople)
+	if err != nil || generated != "jsmith3" {
+		t.Errorf("GenerateUsername = %q, %v; want jsmith3", generated, err)
+	}
+	generated, err = services.Account.GenerateUsername("{firstname}", "Root", "", models.AccountTypePeople)
+	if err != nil || generated != "root2" {
+		t.Errorf("GenerateUsername(root) = %q, %v; want root2", generated, err)
+	}
+	_, err = services.Account.GenerateUsername("{firstname}.{surname}", "Jane", "Smith", models.AccountTypePeople)
+	expectError(t, err, "does not match")
+
+	// The type's prefix is added and names are shortened to fit
+	services.Account.names.MaxLength = 8
+	services.Account.names.AccountPrefixes[models.AccountTypeService] = "svc_"
+	mustCreateAccount(t, services, "svc_back", 60001, models.AccountTypeService, 0)
+	generated, err = services.Account.GenerateUsername("{surname}", "", "Backups", models.AccountTypeService)
+	if err != nil || generated != "svc_bac2" {
+		t.Errorf("GenerateUsername(service) = %q, %v; want svc_bac2", generated, err)
+	}
+
+	suggestions := services.Account.SuggestUsernames([]string{"{f}{surname}", "{nope}"}, "Jane", "Smith", models.AccountTypePeople)
+	if len(suggestions) != 2 || suggestions[0].Username != "jsmith3" || suggestions[1].Error == "" {
+		t.Errorf("SuggestUsernames = %+v", suggestions)
+	}
+}
@@ -7,11 +7,11 @@ import (
 
 // AuditService handles business logic for audit logs
 type AuditService struct {
-	auditRepo *repository.AuditRepository
+	auditRepo repository.AuditStore
 }
 
 // NewAuditService creates a new audit service
-func NewAuditService(auditRepo *repository.AuditRepository) *AuditService {
+func NewAuditService(auditRepo repository.AuditStore) *AuditService {
 	return &AuditService{
 		auditRepo: auditRepo,
 	}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/home/unixify/internal/models"
+	"github.com/home/unixify/internal/repository"
+)
+
+// ChangeService serves the change feed that lets clients keep a replica of
+// the registry without downloading all of it
+type ChangeService struct {
+	changeRepo repository.ChangeStore
+}
+
+// NewChangeService creates a new change service
+func NewChangeService(changeRepo repository.ChangeStore) *ChangeService {
+	return &ChangeService{
+		changeRepo: changeRepo,
+	}
+}
+
+// GetChanges returns the current state of the accounts, groups and memberships
+// changed after since, and tombstones for the deleted ones, limit records in
+// total at most. When more changes are waiting, More is set and Sequence is
+// where the next page starts.
+func (s *ChangeService) GetChanges(since int64, limit int) (*models.ChangeSet, error) {
+	if since < 0 {
+		return nil, fmt.Errorf("since must not be negative")
+	}
+	if limit < 1 {
+		return nil, fmt.Errorf("limit must be positive")
+	}
+
+	changes, err := s.changeRepo.FindChangesSince(since, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	// Each kind was read up to the limit on its own; keep the lowest limit
+	// sequence numbers overall. A kind that filled the limit may have more
+	// records right after the page, so the next page is needed then too.
+	seqs := []int64{}
+	for _, account := range changes.Accounts {
+		seqs = append(seqs, account.ChangeSeq)
+	}
+	for _, group := range changes.Groups {
+		seqs = append(seqs, group.ChangeSeq)
+	}
+	for _, membership := range changes.Memberships {
+		seqs = append(seqs, membership.ChangeSeq)
+	}
+	for _, tombstone := range changes.Tombstones {
+		seqs = append(seqs, tombstone.ChangeSeq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+
+	changes.Since = since
+	changes.Sequence = since
+	changes.More = len(seqs) > limit || len(changes.Accounts) == limit || len(changes.Groups) == limit ||
+		len(changes.Memberships) == limit || len(changes.Tombstones) == limit
+	if len(seqs) > limit {
+		seqs = seqs[:limit]
+	}
+	if len(seqs) > 0 {
+		changes.Sequence = seqs[len(seqs)-1]
+	}
+
+	// Drop whatever lies beyond the page
+	cutoff := changes.Sequence
+	accounts := []models.Account{}
+	for _, account := range changes.Accounts {
+		if account.ChangeSeq <= cutoff {
+			accounts = append(accounts, account)
+		}
+	}
+	groups := []models.Group{}
+	for _, group := range changes.Groups {
+		if group.ChangeSeq <= cutoff {
+			groups = append(groups, group)
+		}
+	}
+	memberships := []models.AccountGroup{}
+	for _, membership := range changes.Memberships {
+		if membership.ChangeSeq <= cutoff {
+			memberships = append(memberships, membership)
+		}
+	}
+	tombstones := []models.Tombstone{}
+	for _, tombstone := range changes.Tombstones {
+		if tombstone.ChangeSeq <= cutoff {
+			tombstones = append(tombstones, tombstone)
+		}
+	}
+	changes.Accounts, changes.Groups, changes.Memberships, changes.Tombstones = accounts, groups, memberships, tombstones
+
+	return changes, nil
+}
@@ -0,0 +1,147 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/home/unixify/internal/models"
+)
+
+// replica is a client-side copy of the registry kept up to date from the change feed
+type replica struct {
+	sequence    int64
+	accounts    map[uint]string
+	groups      map[uint]string
+	memberships map[uint]string
+}
+
+// sync pulls pages of changes until the replica is current and returns how many it took
+func (r *replica) sync(t *testing.T, services *Services, limit int) int {
+	t.Helper()
+	for pages := 1; ; pages++ {
+		changes, err := services.Change.GetChanges(r.sequence, limit)
+		if err != nil {
+			t.Fatalf("GetChanges(%d): %v", r.sequence, err)
+		}
+		// Tombstones first: every record in the page is current
+		for _, tombstone := range changes.Tombstones {
+			switch tombstone.Kind {
+			case models.TombstoneAccount:
+				delete(r.accounts, tombstone.EntityID)
+			case models.TombstoneGroup:
+				delete(r.groups, tombstone.EntityID)
+			case models.TombstoneMembership:
+				delete(r.memberships, tombstone.EntityID)
+			}
+		}
+		for _, account := range changes.Accounts {
+			r.accounts[account.ID] = fmt.Sprintf("%s:%d:%s", account.Username, account.UnixUID, account.Firstname)
+		}
+		for _, group := range changes.Groups {
+			r.groups[group.ID] = fmt.Sprintf("%s:%d", group.Groupname, group.UnixGID)
+		}
+		for _, membership := range changes.Memberships {
+			r.memberships[membership.ID] = fmt.Sprintf("%d:%d", membership.AccountID, membership.GroupID)
+		}
+
+		if changes.Sequence < r.sequence {
+			t.Fatalf("sequence went back from %d to %d", r.sequence, changes.Sequence)
+		}
+		r.sequence = changes.Sequence
+		if !changes.More {
+			return pages
+		}
+	}
+}
+
+// expectReplicaMatches compares the replica with a fresh full download
+func expectReplicaMatches(t *testing.T, services *Services, got *replica) {
+	t.Helper()
+	want := &replica{accounts: map[uint]string{}, groups: map[uint]string{}, memberships: map[uint]string{}}
+	want.sync(t, services, 10000)
+
+	for name, maps := range map[string][2]map[uint]string{
+		"accounts":    {got.accounts, want.accounts},
+		"groups":      {got.groups, want.groups},
+		"memberships": {got.memberships, want.memberships},
+	} {
+		if fmt.Sprint(sorted(maps[0])) != fmt.Sprint(sorted(maps[1])) {
+			t.Errorf("replica %s = %v, want %v", name, sorted(maps[0]), sorted(maps[1]))
+		}
+	}
+}
+
+// sorted lists the values of a replica table in ID order
+func sorted(table map[uint]string) []string {
+	ids := []uint{}
+	for id := range table {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	values := []string{}
+	for _, id := range ids {
+		values = append(values, fmt.Sprintf("%d=%s", id, table[id]))
+	}
+	return values
+}
+
+func TestChangeFeedKeepsReplicaExact(t *testing.T) {
+	services, _ := newTestServices(t)
+	local := &replica{accounts: map[uint]string{}, groups: map[uint]string{}, memberships: map[uint]string{}}
+
+	staff := mustCreateGroup(t, services, "staff", 1000, models.GroupTypePeople)
+	ops := mustCreateGroup(t, services, "ops", 1001, models.GroupTypePeople)
+	alice := mustCreateAccount(t, services, "alice", 1001, models.AccountTypePeople, staff.ID)
+	bob := mustCreateAccount(t, services, "bob", 1002, models.AccountTypePeople, staff.ID)
+	for _, account := range []*models.Account{alice, bob} {
+		if err := services.Account.AssignAccountToGroup(account.ID, ops.ID, testUserID, testUsername, testIP); err != nil {
+			t.Fatalf("AssignAccountToGroup: %v", err)
+		}
+	}
+
+	// A full sync of 6 changes in pages of two; the memberships fill the third
+	// page, so a fourth, empty one confirms nothing follows
+	if pages := local.sync(t, services, 2); pages != 4 {
+		t.Errorf("full sync took %d pages of 2", pages)
+	}
+	expectReplicaMatches(t, services, local)
+
+	// Nothing new: the sequence stays put
+	before := local.sequence
+	if pages := local.sync(t, services, 2); pages != 1 || local.sequence != before {
+		t.Errorf("idle sync took %d pages and moved the sequence from %d to %d", pages, before, local.sequence)
+	}
+
+	// Update, delete, and remove and re-add a membership
+	alice.Firstname = "Alice"
+	if err := services.Account.UpdateAccount(alice, testUserID, testUsername, testIP); err != nil {
+		t.Fatalf("UpdateAccount: %v", err)
+	}
+	if err := services.Account.RemoveAccountFromGroup(alice.ID, ops.ID, testUserID, testUsername, testIP); err != nil {
+		t.Fatalf("RemoveAccountFromGroup: %v", err)
+	}
+	if err := services.Account.AssignAccountToGroup(alice.ID, ops.ID, testUserID, testUsername, testIP); err != nil {
+		t.Fatalf("AssignAccountToGroup: %v", err)
+	}
+	if err := services.Account.RemoveAccountFromGroup(bob.ID, ops.ID, testUserID, testUsername, testIP); err != nil {
+		t.Fatalf("RemoveAccountFromGroup: %v", err)
+	}
+	if err := services.Account.DeleteAccount(bob.ID, 0, testUserID, testUsername, testIP); err != nil {
+		t.Fatalf("DeleteAccount: %v", err)
+	}
+
+	local.sync(t, services, 2)
+	expectReplicaMatches(t, services, local)
+	if _, ok := local.accounts[bob.ID]; ok {
+		t.Errorf("deleted account is still in the replica")
+	}
+
+	changes, err := services.Change.GetChanges(before, 100)
+	if err != nil {
+		t.Fatalf("GetChanges: %v", err)
+	}
+	if len(changes.Tombstones) != 3 || changes.Tombstones[2].Kind != models.TombstoneAccount || changes.Tombstones[2].Name != "bob" {
+		t.Errorf("unexpected tombstones %+v", changes.Tombstones)
+	}
+}
@@ -0,0 +1,38 @@
+package service
+
+import (
+	"github.com/home/unixify/internal/drift"
+	"github.com/home/unixify/internal/repository"
+)
+
+// DriftService compares host files with the registry
+type DriftService struct {
+	accountRepo repository.AccountStore
+	groupRepo   repository.GroupStore
+}
+
+// NewDriftService creates a new drift service
+func NewDriftService(accountRepo repository.AccountStore, groupRepo repository.GroupStore) *DriftService {
+	return &DriftService{
+		accountRepo: accountRepo,
+		groupRepo:   groupRepo,
+	}
+}
+
+// CompareHost compares a host's files with the current registry
+func (s *DriftService) CompareHost(files drift.Files, managed drift.Managed) (*drift.Report, error) {
+	accounts, err := s.accountRepo.FindAll("")
+	if err != nil {
+		return nil, err
+	}
+	groups, err := s.groupRepo.FindAll("")
+	if err != nil {
+		return nil, err
+	}
+	memberships, err := s.accountRepo.FindAllMemberships()
+	if err != nil {
+		return nil, err
+	}
+	registry := &drift.Registry{Accounts: accounts, Groups: groups, Memberships: memberships}
+	return drift.Compare(files, registry, managed), nil
+}
@@ -0,0 +1,47 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/home/unixify/internal/models"
+	"github.com/home/unixify/internal/repository"
+)
+
+// EventService keeps the event log that the live event stream is served from.
+// Events are logged with the same repositories as the change itself, so they
+// commit or roll back with it.
+type EventService struct {
+	eventRepo repository.EventStore
+}
+
+// NewEventService creates a new event service
+func NewEventService(eventRepo repository.EventStore) *EventService {
+	return &EventService{
+		eventRepo: eventRepo,
+	}
+}
+
+// Publish records the event in the event log
+func (s *EventService) Publish(event *models.Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	record := &models.EventRecord{
+		ID:      event.ID,
+		Type:    event.Type,
+		Section: event.Section,
+		Payload: string(payload),
+	}
+	if err := s.eventRepo.Create(record); err != nil {
+		return fmt.Errorf("failed to record event: %w", err)
+	}
+	return nil
+}
+
+// GetEventsSince gets up to limit logged events after the given event ID, oldest first
+func (s *EventService) GetEventsSince(afterID uint, limit int) ([]models.EventRecord, error) {
+	return s.eventRepo.FindSince(afterID, limit)
+}
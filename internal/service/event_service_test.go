@@ -0,0 +1,51 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/home/unixify/internal/models"
+)
+
+func TestEventLogCommitsWithTheChange(t *testing.T) {
+	services, repos := newSQLiteServices(t)
+
+	staff := mustCreateGroup(t, services, "staff", 1000, models.GroupTypePeople)
+	alice := mustCreateAccount(t, services, "alice", 1001, models.AccountTypePeople, staff.ID)
+
+	// A change whose event cannot be logged is not saved, so it is never
+	// missing from the stream
+	failInserts(t, services, "event_records")
+	err := services.Group.DeleteGroup(staff.ID, 0, testUserID, testUsername, testIP)
+	expectError(t, err, "failed to record event")
+	if _, err := services.Group.GetGroup(staff.ID); err != nil {
+		t.Errorf("group staff was deleted without its event: %v", err)
+	}
+	alice.Firstname = "Alice"
+	err = services.Account.UpdateAccount(alice, testUserID, testUsername, testIP)
+	expectError(t, err, "failed to record event")
+	if account, _ := services.Account.GetAccount(alice.ID); account.Firstname != "" {
+		t.Errorf("firstname = %q, want the update rolled back", account.Firstname)
+	}
+	rule := &models.SudoRule{Name: "alice-logs", AccountID: alice.ID, Commands: []string{"/usr/bin/journalctl"}}
+	err = services.Sudo.CreateSudoRule(rule, testUserID, testUsername, testIP)
+	expectError(t, err, "failed to record event")
+	if rules, _ := services.Sudo.GetAllSudoRules(); len(rules) != 0 {
+		t.Errorf("sudo rules = %+v, want none", rules)
+	}
+
+	records, err := services.Event.GetEventsSince(0, 100)
+	if err != nil {
+		t.Fatalf("GetEventsSince: %v", err)
+	}
+	types := []string{}
+	for _, record := range records {
+		types = append(types, record.Type)
+	}
+	if got := strings.Join(types, ","); got != "group.created,account.created" {
+		t.Errorf("events = %s", got)
+	}
+	if got := strings.Join(auditActions(t, repos, "account"), ","); got != "create" {
+		t.Errorf("account audit = %s", got)
+	}
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"github.com/home/unixify/internal/models"
+)
+
+// EventPublisher is told about every registry change right after its audit
+// entry is written. An error fails the change like a failed audit write.
+type EventPublisher interface {
+	Publish(event *models.Event) error
+}
+
+// publishers hands every event to several publishers in turn
+type publishers []EventPublisher
+
+// Publish publishes the event with each publisher, stopping at the first error
+func (p publishers) Publish(event *models.Event) error {
+	for _, publisher := range p {
+		if err := publisher.Publish(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newEvent describes the change recorded by an audit entry. The section is the
+// account or group type; membership events use the account's.
+func newEvent(eventType, section string, entry *models.AuditEntry, before, after interface{}) *models.Event {
+	return &models.Event{
+		ID:         entry.ID,
+		Type:       eventType,
+		Timestamp:  entry.Timestamp,
+		EntityType: entry.EntityType,
+		EntityID:   entry.EntityID,
+		Section:    section,
+		Actor: models.EventActor{
+			UserID:    entry.UserID,
+			Username:  entry.Username,
+			IPAddress: entry.IPAddress,
+		},
+		Before: before,
+		After:  after,
+	}
+}
+
+// eventAccount copies an account for an event, leaving out the loaded primary group
+func eventAccount(account *models.Account) *models.Account {
+	copied := *account
+	copied.PrimaryGroup = nil
+	return &copied
+}
+
+// eventGroup copies a group for an event
+func eventGroup(group *models.Group) *models.Group {
+	copied := *group
+	return &copied
+}
+
+// eventMembership describes a membership for an event
+func eventMembership(account *models.Account, group *models.Group) *models.EventMembership {
+	return &models.EventMembership{
+		AccountID: account.ID,
+		Username:  account.Username,
+		GroupID:   group.ID,
+		Groupname: group.Groupname,
+	}
+}
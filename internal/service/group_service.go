@@ -5,32 +5,69 @@ import (
 	"time"
 
 	"github.com/home/unixify/internal/models"
+	"github.com/home/unixify/internal/query"
 	"github.com/home/unixify/internal/repository"
 	"github.com/home/unixify/internal/validator"
 )
 
 // GroupService handles business logic for groups
 type GroupService struct {
-	groupRepo   *repository.GroupRepository
-	accountRepo *repository.AccountRepository
-	auditRepo   *repository.AuditRepository
+	groupRepo   repository.GroupStore
+	accountRepo repository.AccountStore
+	auditRepo   repository.AuditStore
+	events      EventPublisher
+	names       validator.NamePolicy // Rules group names must follow
+	deps        Deps                 // What writes build their transaction's services from
 }
 
 // NewGroupService creates a new group service
 func NewGroupService(
-	groupRepo *repository.GroupRepository,
-	accountRepo *repository.AccountRepository,
-	auditRepo *repository.AuditRepository,
+	groupRepo repository.GroupStore,
+	accountRepo repository.AccountStore,
+	auditRepo repository.AuditStore,
+	events EventPublisher,
 ) *GroupService {
 	return &GroupService{
 		groupRepo:   groupRepo,
 		accountRepo: accountRepo,
 		auditRepo:   auditRepo,
+		events:      events,
+		names:       validator.DefaultNamePolicy(),
 	}
 }
 
-// CreateGroup creates a new group
+// transaction runs fn on the group service of a transaction, so a change, its
+// audit entry and its events are saved together; see transaction
+func (s *GroupService) transaction(fn func(tx *GroupService) error) error {
+	if s.deps.DB == nil {
+		return fn(s) // In-memory repositories have no transactions
+	}
+	return transaction(s.deps, func(tx *Services) error {
+		return fn(tx.Group)
+	})
+}
+
+// CreateGroup creates a new, active group
 func (s *GroupService) CreateGroup(group *models.Group, userID uint, username, ipAddress string) error {
+	return s.transaction(func(tx *GroupService) error {
+		return tx.createGroup(group, true, userID, username, ipAddress)
+	})
+}
+
+// CreateInactiveGroup creates a new group that is inactive from the start
+func (s *GroupService) CreateInactiveGroup(group *models.Group, userID uint, username, ipAddress string) error {
+	return s.transaction(func(tx *GroupService) error {
+		return tx.createGroup(group, false, userID, username, ipAddress)
+	})
+}
+
+// createGroup does the work of CreateGroup and CreateInactiveGroup inside their transaction
+func (s *GroupService) createGroup(group *models.Group, active bool, userID uint, username, ipAddress string) error {
+	// Enforce the naming policy
+	if err := s.names.ValidateGroupname(group.Groupname, group.Type); err != nil {
+		return err
+	}
+
 	// Validate GID - now just a warning
 	if err := validator.ValidateGIDForType(group.UnixGID, group.Type); err != nil {
 		// If it's a warning (starts with "WARNING:"), log it but continue
@@ -64,18 +101,32 @@ func (s *GroupService) CreateGroup(group *models.Group, userID uint, username, i
 		return err
 	}
 
+	// The active column defaults to true, so an inactive group is saved
+	// again before it is audited and published
+	details := fmt.Sprintf("Created group %s with GID %d", group.Groupname, group.UnixGID)
+	if !active {
+		group.Active = false
+		if err := s.groupRepo.Update(group); err != nil {
+			return err
+		}
+		details += ", inactive"
+	}
+
 	// Log audit entry
 	auditEntry := &models.AuditEntry{
 		Action:     "create",
 		EntityID:   group.ID,
 		EntityType: "group",
-		Details:    fmt.Sprintf("Created group %s with GID %d", group.Groupname, group.UnixGID),
+		Details:    details,
 		UserID:     userID,
 		Username:   username,
 		IPAddress:  ipAddress,
 		Timestamp:  time.Now(),
 	}
-	return s.auditRepo.Create(auditEntry)
+	if err := s.auditRepo.Create(auditEntry); err != nil {
+		return err
+	}
+	return s.events.Publish(newEvent(models.EventGroupCreated, string(group.Type), auditEntry, nil, eventGroup(group)))
 }
 
 // GetGroup gets a group by ID
@@ -100,6 +151,13 @@ func (s *GroupService) GetAllGroups(groupType models.GroupType) ([]models.Group,
 
 // UpdateGroup updates a group
 func (s *GroupService) UpdateGroup(group *models.Group, userID uint, username, ipAddress string) error {
+	return s.transaction(func(tx *GroupService) error {
+		return tx.updateGroup(group, userID, username, ipAddress)
+	})
+}
+
+// updateGroup does the work of UpdateGroup inside its transaction
+func (s *GroupService) updateGroup(group *models.Group, userID uint, username, ipAddress string) error {
 	// Validate GID - now just a warning
 	if err := validator.ValidateGIDForType(group.UnixGID, group.Type); err != nil {
 		// If it's a warning (starts with "WARNING:"), log it but continue
@@ -118,6 +176,14 @@ func (s *GroupService) UpdateGroup(group *models.Group, userID uint, username, i
 		return err
 	}
 
+	// Enforce the naming policy when the name or type changes, so groups
+	// from before the policy can still be edited
+	if originalGroup.Groupname != group.Groupname || originalGroup.Type != group.Type {
+		if err := s.names.ValidateGroupname(group.Groupname, group.Type); err != nil {
+			return err
+		}
+	}
+
 	// Check if GID already exists using the improved method
 	isDuplicate, err := s.groupRepo.IsGIDDuplicate(group.UnixGID, group.ID)
 	if err != nil {
@@ -152,11 +218,21 @@ func (s *GroupService) UpdateGroup(group *models.Group, userID uint, username, i
 		IPAddress:  ipAddress,
 		Timestamp:  time.Now(),
 	}
-	return s.auditRepo.Create(auditEntry)
+	if err := s.auditRepo.Create(auditEntry); err != nil {
+		return err
+	}
+	return s.events.Publish(newEvent(models.EventGroupUpdated, string(group.Type), auditEntry, eventGroup(originalGroup), eventGroup(group)))
+}
+
+// DeleteGroup deletes a group if it is still at version; version 0 deletes it regardless
+func (s *GroupService) DeleteGroup(id uint, version int, userID uint, username, ipAddress string) error {
+	return s.transaction(func(tx *GroupService) error {
+		return tx.deleteGroup(id, version, userID, username, ipAddress)
+	})
 }
 
-// DeleteGroup soft deletes a group
-func (s *GroupService) DeleteGroup(id uint, userID uint, username, ipAddress string) error {
+// deleteGroup does the work of DeleteGroup inside its transaction
+func (s *GroupService) deleteGroup(id uint, version int, userID uint, username, ipAddress string) error {
 	// Get group to record groupname in audit
 	group, err := s.groupRepo.FindByID(id)
 	if err != nil {
@@ -164,7 +240,7 @@ func (s *GroupService) DeleteGroup(id uint, userID uint, username, ipAddress str
 	}
 
 	// Delete group
-	err = s.groupRepo.Delete(id)
+	err = s.groupRepo.Delete(id, version)
 	if err != nil {
 		return err
 	}
@@ -180,7 +256,10 @@ func (s *GroupService) DeleteGroup(id uint, userID uint, username, ipAddress str
 		IPAddress:  ipAddress,
 		Timestamp:  time.Now(),
 	}
-	return s.auditRepo.Create(auditEntry)
+	if err := s.auditRepo.Create(auditEntry); err != nil {
+		return err
+	}
+	return s.events.Publish(newEvent(models.EventGroupDeleted, string(group.Type), auditEntry, eventGroup(group), nil))
 }
 
 // GetGroupMembers gets all accounts in a specific group
@@ -188,9 +267,15 @@ func (s *GroupService) GetGroupMembers(groupID uint) ([]models.Account, error) {
 	return s.groupRepo.GetAccountsInGroup(groupID)
 }
 
-// SearchGroups searches for groups by GID or groupname
-func (s *GroupService) SearchGroups(query string) ([]models.Group, error) {
-	return s.groupRepo.Search(query)
+// SearchGroups finds the groups matching a query in the query language;
+// bare words match part of a groupname, description or GID. Parse errors
+// are *query.Error.
+func (s *GroupService) SearchGroups(input string) ([]models.Group, error) {
+	q, err := query.Parse(input, query.KindGroup)
+	if err != nil {
+		return nil, err
+	}
+	return s.groupRepo.FindByQuery(q)
 }
 
 // IsGIDDuplicate checks if a GID already exists
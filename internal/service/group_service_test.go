@@ -0,0 +1,133 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/home/unixify/internal/models"
+)
+
+func TestCreateGroupRules(t *testing.T) {
+	services, repos := newTestServices(t)
+	staff := mustCreateGroup(t, services, "staff", 1000, models.GroupTypePeople)
+	if staff.ID == 0 || !staff.Active {
+		t.Errorf("expected an active group with an ID, got %+v", staff)
+	}
+
+	tests := []struct {
+		name    string
+		group   models.Group
+		wantErr string
+	}{
+		{
+			name:    "duplicate GID",
+			group:   models.Group{Groupname: "devs", UnixGID: 1000, Type: models.GroupTypePeople},
+			wantErr: "group with GID 1000 already exists",
+		},
+		{
+			name:    "duplicate groupname",
+			group:   models.Group{Groupname: "staff", UnixGID: 1001, Type: models.GroupTypePeople},
+			wantErr: "group with groupname staff already exists",
+		},
+		{
+			name:    "invalid type",
+			group:   models.Group{Groupname: "devs", UnixGID: 1001, Type: "robot"},
+			wantErr: "invalid group type",
+		},
+		{
+			name:    "negative GID",
+			group:   models.Group{Groupname: "devs", UnixGID: -5, Type: models.GroupTypePeople},
+			wantErr: "GID cannot be negative",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			group := tt.group
+			err := services.Group.CreateGroup(&group, testUserID, testUsername, testIP)
+			expectError(t, err, tt.wantErr)
+		})
+	}
+
+	t.Run("GID outside the recommended range is only a warning", func(t *testing.T) {
+		mustCreateGroup(t, services, "legacy", 500, models.GroupTypePeople)
+	})
+
+	want := []string{"create", "create"}
+	if got := auditActions(t, repos, "group"); !reflect.DeepEqual(got, want) {
+		t.Errorf("audit actions = %v, want %v", got, want)
+	}
+}
+
+func TestUpdateGroupRules(t *testing.T) {
+	services, _ := newTestServices(t)
+	staff := mustCreateGroup(t, services, "staff", 1000, models.GroupTypePeople)
+	mustCreateGroup(t, services, "devs", 1001, models.GroupTypePeople)
+
+	update := func(change func(*models.Group)) error {
+		group, err := services.Group.GetGroup(staff.ID)
+		if err != nil {
+			t.Fatalf("GetGroup: %v", err)
+		}
+		change(group)
+		return services.Group.UpdateGroup(group, testUserID, testUsername, testIP)
+	}
+
+	expectError(t, update(func(g *models.Group) { g.UnixGID = 1001 }), "group with GID 1001 already exists")
+	expectError(t, update(func(g *models.Group) { g.Groupname = "devs" }), "group with groupname devs already exists")
+
+	missing := &models.Group{ID: 99, Groupname: "ghost", UnixGID: 1099, Type: models.GroupTypePeople}
+	expectError(t, services.Group.UpdateGroup(missing, testUserID, testUsername, testIP), "group with ID 99 not found")
+
+	if err := update(func(g *models.Group) {
+		g.Groupname = "employees"
+		g.Description = "Everyone"
+	}); err != nil {
+		t.Fatalf("UpdateGroup: %v", err)
+	}
+
+	stored, err := services.Group.GetGroupByGroupname("employees")
+	if err != nil {
+		t.Fatalf("GetGroupByGroupname: %v", err)
+	}
+	if stored.UnixGID != 1000 || stored.Description != "Everyone" {
+		t.Errorf("unexpected stored group %+v", stored)
+	}
+	if _, err := services.Group.GetGroupByGroupname("staff"); err == nil {
+		t.Error("expected the old groupname to be gone")
+	}
+}
+
+func TestDeleteGroupAndNextGID(t *testing.T) {
+	services, _ := newTestServices(t)
+
+	gid, err := services.Group.GetNextAvailableGID(models.GroupTypeDatabase)
+	if err != nil {
+		t.Fatalf("GetNextAvailableGID: %v", err)
+	}
+	if gid != 70000 {
+		t.Errorf("first database GID = %d, want 70000", gid)
+	}
+
+	mustCreateGroup(t, services, "staff", 1000, models.GroupTypePeople)
+	devs := mustCreateGroup(t, services, "devs", 1004, models.GroupTypePeople)
+
+	gid, err = services.Group.GetNextAvailableGID(models.GroupTypePeople)
+	if err != nil {
+		t.Fatalf("GetNextAvailableGID: %v", err)
+	}
+	if gid != 1005 {
+		t.Errorf("next people GID = %d, want 1005", gid)
+	}
+
+	if err := services.Group.DeleteGroup(devs.ID, devs.Version, testUserID, testUsername, testIP); err != nil {
+		t.Fatalf("DeleteGroup: %v", err)
+	}
+	if _, err := services.Group.GetGroupByGID(1004); err == nil {
+		t.Error("expected the deleted group to be gone")
+	}
+	duplicate, err := services.Group.IsGIDDuplicate(1004, 0)
+	if err != nil || duplicate {
+		t.Errorf("IsGIDDuplicate(1004) = %v, %v; want false", duplicate, err)
+	}
+}
@@ -0,0 +1,171 @@
+package service
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/home/unixify/internal/models"
+)
+
+// HostScope is the part of the registry a host may see, as IDs. It filters
+// the feeds that are shared by users and hosts, such as the account list,
+// the change feed and the event stream.
+type HostScope struct {
+	Accounts map[uint]bool
+	Groups   map[uint]bool
+}
+
+// GetHostScope returns the accounts and groups a host may see, as resolved
+// by GetHostAccess
+func (s *HostService) GetHostScope(host *models.Host) (*HostScope, error) {
+	access, err := s.GetHostAccess(host)
+	if err != nil {
+		return nil, err
+	}
+	scope := &HostScope{Accounts: make(map[uint]bool), Groups: make(map[uint]bool)}
+	for _, account := range access.Accounts {
+		scope.Accounts[account.ID] = true
+	}
+	for _, group := range access.Groups {
+		scope.Groups[group.ID] = true
+	}
+	return scope, nil
+}
+
+// scopeCacheTTL is how long a cached scope is used at most, so access
+// changes made through another server are picked up too
+const scopeCacheTTL = time.Minute
+
+// scopeCache holds the scopes of hosts that stream events, so an event
+// outside a host's scope does not cost a query on every open stream. A scope
+// changes when the host's access rules do, which clears the cache, and when
+// an account or membership changes, which comes with an event.
+type scopeCache struct {
+	mu      sync.Mutex
+	entries map[uint]*cachedScope
+}
+
+// cachedScope is a host's scope as it was after an event
+type cachedScope struct {
+	scope    *HostScope
+	after    uint
+	resolved time.Time
+}
+
+// invalidate drops every cached scope
+func (c *scopeCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[uint]*cachedScope)
+}
+
+// CachedHostScope returns the scope of a host as seen by an event, resolving
+// it again only when the cached one may be older: after its access rules
+// changed, or when the event is about an account or membership and came
+// after the cached scope was resolved. The scope returned is shared and
+// must not be changed.
+func (s *HostService) CachedHostScope(host *models.Host, record *models.EventRecord) (*HostScope, error) {
+	s.scopes.mu.Lock()
+	defer s.scopes.mu.Unlock()
+
+	widens := strings.HasPrefix(record.Type, "account.") || strings.HasPrefix(record.Type, "membership.")
+	entry, ok := s.scopes.entries[host.ID]
+	if ok && time.Since(entry.resolved) < scopeCacheTTL && (!widens || record.ID <= entry.after) {
+		return entry.scope, nil
+	}
+
+	scope, err := s.GetHostScope(host)
+	if err != nil {
+		return nil, err
+	}
+	after := record.ID
+	if ok && entry.after > after {
+		after = entry.after
+	}
+	s.scopes.entries[host.ID] = &cachedScope{scope: scope, after: after, resolved: time.Now()}
+	return scope, nil
+}
+
+// Add widens the scope by another one
+func (sc *HostScope) Add(other *HostScope) {
+	for id := range other.Accounts {
+		sc.Accounts[id] = true
+	}
+	for id := range other.Groups {
+		sc.Groups[id] = true
+	}
+}
+
+// FilterAccounts returns the accounts in the scope
+func (sc *HostScope) FilterAccounts(accounts []models.Account) []models.Account {
+	filtered := []models.Account{}
+	for _, account := range accounts {
+		if sc.Accounts[account.ID] {
+			filtered = append(filtered, account)
+		}
+	}
+	return filtered
+}
+
+// FilterGroups returns the groups in the scope
+func (sc *HostScope) FilterGroups(groups []models.Group) []models.Group {
+	filtered := []models.Group{}
+	for _, group := range groups {
+		if sc.Groups[group.ID] {
+			filtered = append(filtered, group)
+		}
+	}
+	return filtered
+}
+
+// FilterChanges removes the records outside the scope from a page of the
+// change feed. Tombstones are kept, without names: a host cannot tell
+// whether it saw a deleted record, and an ID it does not know is ignored.
+func (sc *HostScope) FilterChanges(changes *models.ChangeSet) {
+	changes.Accounts = sc.FilterAccounts(changes.Accounts)
+	changes.Groups = sc.FilterGroups(changes.Groups)
+	memberships := []models.AccountGroup{}
+	for _, membership := range changes.Memberships {
+		if sc.Accounts[membership.AccountID] && sc.Groups[membership.GroupID] {
+			memberships = append(memberships, membership)
+		}
+	}
+	changes.Memberships = memberships
+	for i := range changes.Tombstones {
+		changes.Tombstones[i].Name = ""
+	}
+}
+
+// WantsEvent reports whether an event is about an account, group or
+// membership in the scope. Other events, such as sudo rule changes, are
+// left out.
+func (sc *HostScope) WantsEvent(record *models.EventRecord) bool {
+	var event struct {
+		EntityID uint            `json:"entity_id"`
+		Before   json.RawMessage `json:"before"`
+		After    json.RawMessage `json:"after"`
+	}
+	if err := json.Unmarshal([]byte(record.Payload), &event); err != nil {
+		return false
+	}
+
+	switch {
+	case strings.HasPrefix(record.Type, "account."):
+		return sc.Accounts[event.EntityID]
+	case strings.HasPrefix(record.Type, "group."):
+		return sc.Groups[event.EntityID]
+	case strings.HasPrefix(record.Type, "membership."):
+		state := event.After
+		if len(state) == 0 {
+			state = event.Before
+		}
+		var membership models.EventMembership
+		if err := json.Unmarshal(state, &membership); err != nil {
+			return false
+		}
+		return sc.Accounts[membership.AccountID] && sc.Groups[membership.GroupID]
+	}
+	return false
+}
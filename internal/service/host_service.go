@@ -0,0 +1,510 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/home/unixify/internal/models"
+	"github.com/home/unixify/internal/nss"
+	"github.com/home/unixify/internal/repository"
+)
+
+// HostService manages the host inventory and the access rules that decide
+// which accounts and groups each host sees, and stores the reports that host
+// agents send after syncing
+type HostService struct {
+	hostRepo    repository.HostStore
+	accountRepo repository.AccountStore
+	groupRepo   repository.GroupStore
+	auditRepo   repository.AuditStore
+
+	scopes scopeCache
+}
+
+// NewHostService creates a new host service
+func NewHostService(
+	hostRepo repository.HostStore,
+	accountRepo repository.AccountStore,
+	groupRepo repository.GroupStore,
+	auditRepo repository.AuditStore,
+) *HostService {
+	return &HostService{
+		hostRepo:    hostRepo,
+		accountRepo: accountRepo,
+		groupRepo:   groupRepo,
+		auditRepo:   auditRepo,
+		scopes:      scopeCache{entries: make(map[uint]*cachedScope)},
+	}
+}
+
+// validateHostname checks that a hostname can name a host and its reports
+func validateHostname(hostname string) error {
+	if hostname == "" || len(hostname) > 255 || strings.ContainsAny(hostname, " \t\r\n/") {
+		return fmt.Errorf("invalid hostname %q", hostname)
+	}
+	return nil
+}
+
+// generateHostToken returns a new random host token and the hash that is stored
+func generateHostToken() (token, hash string, err error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", fmt.Errorf("failed to generate host token: %w", err)
+	}
+	token = hex.EncodeToString(buf)
+	return token, hashHostToken(token), nil
+}
+
+// hashHostToken returns the SHA-256 of a host token
+func hashHostToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// audit logs an audit entry for a host inventory change
+func (s *HostService) audit(action, entityType string, entityID uint, details string, userID uint, username, ipAddress string) error {
+	auditEntry := &models.AuditEntry{
+		Action:     action,
+		EntityID:   entityID,
+		EntityType: entityType,
+		Details:    details,
+		UserID:     userID,
+		Username:   username,
+		IPAddress:  ipAddress,
+		Timestamp:  time.Now(),
+	}
+	return s.auditRepo.Create(auditEntry)
+}
+
+// CreateHost creates a new host and returns its token, which is not stored
+// and cannot be shown again
+func (s *HostService) CreateHost(host *models.Host, userID uint, username, ipAddress string) (string, error) {
+	if err := validateHostname(host.Hostname); err != nil {
+		return "", err
+	}
+	token, hash, err := generateHostToken()
+	if err != nil {
+		return "", err
+	}
+	host.TokenHash = hash
+
+	// Create host
+	if err := s.hostRepo.Create(host); err != nil {
+		return "", err
+	}
+
+	// Log audit entry
+	if err := s.audit("create", "host", host.ID, fmt.Sprintf("Created host %s", host.Hostname), userID, username, ipAddress); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// GetHost gets a host by ID
+func (s *HostService) GetHost(id uint) (*models.Host, error) {
+	return s.hostRepo.FindByID(id)
+}
+
+// GetAllHosts gets all hosts
+func (s *HostService) GetAllHosts() ([]models.Host, error) {
+	return s.hostRepo.FindAll()
+}
+
+// UpdateHost updates the hostname and description of a host; its token is kept
+func (s *HostService) UpdateHost(host *models.Host, userID uint, username, ipAddress string) error {
+	if err := validateHostname(host.Hostname); err != nil {
+		return err
+	}
+	existing, err := s.hostRepo.FindByID(host.ID)
+	if err != nil {
+		return err
+	}
+	host.TokenHash = existing.TokenHash
+	host.CreatedAt = existing.CreatedAt
+
+	// Update host
+	if err := s.hostRepo.Update(host); err != nil {
+		return err
+	}
+
+	// Log audit entry
+	return s.audit("update", "host", host.ID, fmt.Sprintf("Updated host %s", host.Hostname), userID, username, ipAddress)
+}
+
+// DeleteHost deletes a host and takes it out of its host groups
+func (s *HostService) DeleteHost(id uint, userID uint, username, ipAddress string) error {
+	// Get host to record its name in audit
+	host, err := s.hostRepo.FindByID(id)
+	if err != nil {
+		return err
+	}
+
+	// Delete host
+	if err := s.hostRepo.Delete(id); err != nil {
+		return err
+	}
+	s.scopes.invalidate()
+
+	// Log audit entry
+	return s.audit("delete", "host", id, fmt.Sprintf("Deleted host %s", host.Hostname), userID, username, ipAddress)
+}
+
+// RotateHostToken replaces the token of a host and returns the new one; the
+// old token stops working immediately
+func (s *HostService) RotateHostToken(id uint, userID uint, username, ipAddress string) (string, error) {
+	host, err := s.hostRepo.FindByID(id)
+	if err != nil {
+		return "", err
+	}
+	token, hash, err := generateHostToken()
+	if err != nil {
+		return "", err
+	}
+	host.TokenHash = hash
+
+	// Update host
+	if err := s.hostRepo.Update(host); err != nil {
+		return "", err
+	}
+
+	// Log audit entry
+	if err := s.audit("rotate_token", "host", host.ID, fmt.Sprintf("Rotated the token of host %s", host.Hostname), userID, username, ipAddress); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// AuthenticateHost returns the host a token belongs to
+func (s *HostService) AuthenticateHost(token string) (*models.Host, error) {
+	if token == "" {
+		return nil, fmt.Errorf("missing host token")
+	}
+	host, err := s.hostRepo.FindByTokenHash(hashHostToken(token))
+	if err != nil {
+		return nil, fmt.Errorf("invalid host token")
+	}
+	return host, nil
+}
+
+// validateHostGroup checks a host group before it is stored
+func validateHostGroup(hostGroup *models.HostGroup) error {
+	if hostGroup.Name == "" || len(hostGroup.Name) > 255 {
+		return fmt.Errorf("invalid host group name %q", hostGroup.Name)
+	}
+	return nil
+}
+
+// CreateHostGroup creates a new host group
+func (s *HostService) CreateHostGroup(hostGroup *models.HostGroup, userID uint, username, ipAddress string) error {
+	if err := validateHostGroup(hostGroup); err != nil {
+		return err
+	}
+
+	// Create host group
+	if err := s.hostRepo.CreateHostGroup(hostGroup); err != nil {
+		return err
+	}
+
+	// Log audit entry
+	return s.audit("create", "host_group", hostGroup.ID, fmt.Sprintf("Created host group %s", hostGroup.Name), userID, username, ipAddress)
+}
+
+// GetHostGroup gets a host group by ID
+func (s *HostService) GetHostGroup(id uint) (*models.HostGroup, error) {
+	return s.hostRepo.FindHostGroupByID(id)
+}
+
+// GetAllHostGroups gets all host groups
+func (s *HostService) GetAllHostGroups() ([]models.HostGroup, error) {
+	return s.hostRepo.FindAllHostGroups()
+}
+
+// UpdateHostGroup updates a host group
+func (s *HostService) UpdateHostGroup(hostGroup *models.HostGroup, userID uint, username, ipAddress string) error {
+	if err := validateHostGroup(hostGroup); err != nil {
+		return err
+	}
+	existing, err := s.hostRepo.FindHostGroupByID(hostGroup.ID)
+	if err != nil {
+		return err
+	}
+	hostGroup.CreatedAt = existing.CreatedAt
+
+	// Update host group
+	if err := s.hostRepo.UpdateHostGroup(hostGroup); err != nil {
+		return err
+	}
+
+	// Log audit entry
+	return s.audit("update", "host_group", hostGroup.ID, fmt.Sprintf("Updated host group %s", hostGroup.Name), userID, username, ipAddress)
+}
+
+// DeleteHostGroup deletes a host group together with its members and access rules
+func (s *HostService) DeleteHostGroup(id uint, userID uint, username, ipAddress string) error {
+	// Get host group to record its name in audit
+	hostGroup, err := s.hostRepo.FindHostGroupByID(id)
+	if err != nil {
+		return err
+	}
+
+	// Delete host group
+	if err := s.hostRepo.DeleteHostGroup(id); err != nil {
+		return err
+	}
+	s.scopes.invalidate()
+
+	// Log audit entry
+	return s.audit("delete", "host_group", id, fmt.Sprintf("Deleted host group %s", hostGroup.Name), userID, username, ipAddress)
+}
+
+// AddHostToGroup puts a host in a host group
+func (s *HostService) AddHostToGroup(hostGroupID, hostID uint, userID uint, username, ipAddress string) error {
+	hostGroup, err := s.hostRepo.FindHostGroupByID(hostGroupID)
+	if err != nil {
+		return err
+	}
+	host, err := s.hostRepo.FindByID(hostID)
+	if err != nil {
+		return err
+	}
+
+	// Add host
+	if err := s.hostRepo.AddToHostGroup(hostGroupID, hostID); err != nil {
+		return err
+	}
+	s.scopes.invalidate()
+
+	// Log audit entry
+	return s.audit("add_host", "host_group", hostGroupID, fmt.Sprintf("Added host %s to host group %s", host.Hostname, hostGroup.Name), userID, username, ipAddress)
+}
+
+// RemoveHostFromGroup takes a host out of a host group
+func (s *HostService) RemoveHostFromGroup(hostGroupID, hostID uint, userID uint, username, ipAddress string) error {
+	hostGroup, err := s.hostRepo.FindHostGroupByID(hostGroupID)
+	if err != nil {
+		return err
+	}
+	host, err := s.hostRepo.FindByID(hostID)
+	if err != nil {
+		return err
+	}
+
+	// Remove host
+	if err := s.hostRepo.RemoveFromHostGroup(hostGroupID, hostID); err != nil {
+		return err
+	}
+	s.scopes.invalidate()
+
+	// Log audit entry
+	return s.audit("remove_host", "host_group", hostGroupID, fmt.Sprintf("Removed host %s from host group %s", host.Hostname, hostGroup.Name), userID, username, ipAddress)
+}
+
+// GetHostsInGroup gets the hosts in a host group
+func (s *HostService) GetHostsInGroup(hostGroupID uint) ([]models.Host, error) {
+	if _, err := s.hostRepo.FindHostGroupByID(hostGroupID); err != nil {
+		return nil, err
+	}
+	return s.hostRepo.FindHostsInGroup(hostGroupID)
+}
+
+// GetHostGroupsOfHost gets the host groups a host is in
+func (s *HostService) GetHostGroupsOfHost(hostID uint) ([]models.HostGroup, error) {
+	return s.hostRepo.FindHostGroupsOfHost(hostID)
+}
+
+// CreateAccessRule allows a group's members or a single account on the hosts
+// of a host group
+func (s *HostService) CreateAccessRule(rule *models.AccessRule, userID uint, username, ipAddress string) error {
+	hostGroup, err := s.hostRepo.FindHostGroupByID(rule.HostGroupID)
+	if err != nil {
+		return err
+	}
+
+	// Exactly one of the group and the account is allowed
+	var subject string
+	switch {
+	case rule.GroupID != 0 && rule.AccountID != 0:
+		return fmt.Errorf("an access rule allows either a group or an account, not both")
+	case rule.GroupID != 0:
+		group, err := s.groupRepo.FindByID(rule.GroupID)
+		if err != nil {
+			return err
+		}
+		subject = "group " + group.Groupname
+	case rule.AccountID != 0:
+		account, err := s.accountRepo.FindByID(rule.AccountID)
+		if err != nil {
+			return err
+		}
+		subject = "account " + account.Username
+	default:
+		return fmt.Errorf("an access rule must allow a group or an account")
+	}
+
+	// Create rule
+	if err := s.hostRepo.CreateAccessRule(rule); err != nil {
+		return err
+	}
+	s.scopes.invalidate()
+
+	// Log audit entry
+	return s.audit("create", "access_rule", rule.ID, fmt.Sprintf("Allowed %s on host group %s", subject, hostGroup.Name), userID, username, ipAddress)
+}
+
+// GetAccessRules gets the access rules of a host group
+func (s *HostService) GetAccessRules(hostGroupID uint) ([]models.AccessRule, error) {
+	if _, err := s.hostRepo.FindHostGroupByID(hostGroupID); err != nil {
+		return nil, err
+	}
+	return s.hostRepo.FindAccessRules([]uint{hostGroupID})
+}
+
+// DeleteAccessRule deletes an access rule of a host group
+func (s *HostService) DeleteAccessRule(hostGroupID, ruleID uint, userID uint, username, ipAddress string) error {
+	rule, err := s.hostRepo.FindAccessRuleByID(ruleID)
+	if err != nil {
+		return err
+	}
+	if rule.HostGroupID != hostGroupID {
+		return fmt.Errorf("access rule with ID %d not found", ruleID)
+	}
+
+	// Delete rule
+	if err := s.hostRepo.DeleteAccessRule(ruleID); err != nil {
+		return err
+	}
+	s.scopes.invalidate()
+
+	// Log audit entry
+	return s.audit("delete", "access_rule", ruleID, fmt.Sprintf("Deleted access rule %d of host group %d", ruleID, hostGroupID), userID, username, ipAddress)
+}
+
+// GetHostAccess resolves the part of the registry a host may see. An account
+// is allowed when a rule of one of the host's groups names it or a group it
+// belongs to, as a member or by its primary group. The host sees the allowed
+// accounts, the groups rules name, the primary groups of allowed accounts and
+// the memberships between them. A host without rules sees nothing.
+func (s *HostService) GetHostAccess(host *models.Host) (*models.HostAccess, error) {
+	hostGroups, err := s.hostRepo.FindHostGroupsOfHost(host.ID)
+	if err != nil {
+		return nil, err
+	}
+	hostGroupIDs := make([]uint, 0, len(hostGroups))
+	for _, hostGroup := range hostGroups {
+		hostGroupIDs = append(hostGroupIDs, hostGroup.ID)
+	}
+	rules, err := s.hostRepo.FindAccessRules(hostGroupIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	access := &models.HostAccess{
+		Hostname:    host.Hostname,
+		Accounts:    []models.Account{},
+		Groups:      []models.Group{},
+		Memberships: []models.AccountGroup{},
+	}
+	if len(rules) == 0 {
+		return access, nil
+	}
+
+	allowedGroups := make(map[uint]bool)
+	allowedAccounts := make(map[uint]bool)
+	for _, rule := range rules {
+		if rule.GroupID != 0 {
+			allowedGroups[rule.GroupID] = true
+		}
+		if rule.AccountID != 0 {
+			allowedAccounts[rule.AccountID] = true
+		}
+	}
+
+	// Members of allowed groups are allowed
+	memberships, err := s.accountRepo.FindAllMemberships()
+	if err != nil {
+		return nil, err
+	}
+	for _, membership := range memberships {
+		if allowedGroups[membership.GroupID] {
+			allowedAccounts[membership.AccountID] = true
+		}
+	}
+	accounts, err := s.accountRepo.FindAll("")
+	if err != nil {
+		return nil, err
+	}
+	visibleGroups := make(map[uint]bool)
+	for id := range allowedGroups {
+		visibleGroups[id] = true
+	}
+	for _, account := range accounts {
+		if allowedGroups[account.PrimaryGroupID] {
+			allowedAccounts[account.ID] = true
+		}
+		if allowedAccounts[account.ID] {
+			access.Accounts = append(access.Accounts, account)
+			if account.PrimaryGroupID != 0 {
+				visibleGroups[account.PrimaryGroupID] = true
+			}
+		}
+	}
+
+	groups, err := s.groupRepo.FindAll("")
+	if err != nil {
+		return nil, err
+	}
+	for _, group := range groups {
+		if visibleGroups[group.ID] {
+			access.Groups = append(access.Groups, group)
+		}
+	}
+	for _, membership := range memberships {
+		if allowedAccounts[membership.AccountID] && visibleGroups[membership.GroupID] {
+			access.Memberships = append(access.Memberships, membership)
+		}
+	}
+
+	sort.Slice(access.Accounts, func(i, j int) bool { return access.Accounts[i].UnixUID < access.Accounts[j].UnixUID })
+	sort.Slice(access.Groups, func(i, j int) bool { return access.Groups[i].UnixGID < access.Groups[j].UnixGID })
+	return access, nil
+}
+
+// GetHostEntries returns the passwd and group entries a host may see
+func (s *HostService) GetHostEntries(host *models.Host) ([]nss.PasswdEntry, []nss.GroupEntry, error) {
+	access, err := s.GetHostAccess(host)
+	if err != nil {
+		return nil, nil, err
+	}
+	passwd, group := nss.DefaultOptions().Build(access.Accounts, access.Groups, access.Memberships)
+	return passwd, group, nil
+}
+
+// ReportHost validates and stores a host agent report
+func (s *HostService) ReportHost(report *models.HostReport) error {
+	if err := validateHostname(report.Hostname); err != nil {
+		return err
+	}
+	for _, finding := range report.Drift {
+		switch finding.Kind {
+		case models.DriftUnmanaged, models.DriftModified, models.DriftMissing, models.DriftConflict:
+		default:
+			return fmt.Errorf("unknown drift kind %q", finding.Kind)
+		}
+	}
+
+	if report.Drift == nil {
+		report.Drift = []models.DriftFinding{} // Stored as [] rather than null
+	}
+	report.ID = 0
+	return s.hostRepo.CreateReport(report)
+}
+
+// GetHostReports gets the latest limit reports, optionally for one host
+func (s *HostService) GetHostReports(hostname string, limit int) ([]models.HostReport, error) {
+	return s.hostRepo.FindReports(hostname, limit)
+}
@@ -0,0 +1,237 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/home/unixify/internal/models"
+)
+
+// hostView summarizes what a host sees as passwd names and group lines
+func hostView(t *testing.T, services *Services, host *models.Host) string {
+	t.Helper()
+	passwd, group, err := services.Host.GetHostEntries(host)
+	if err != nil {
+		t.Fatalf("GetHostEntries: %v", err)
+	}
+	names := []string{}
+	for _, entry := range passwd {
+		names = append(names, entry.Name)
+	}
+	lines := []string{}
+	for _, entry := range group {
+		lines = append(lines, entry.String())
+	}
+	return strings.Join(names, ",") + " | " + strings.Join(lines, " ")
+}
+
+func TestHostAccessRules(t *testing.T) {
+	services, repos := newTestServices(t)
+
+	staff := mustCreateGroup(t, services, "staff", 1000, models.GroupTypePeople)
+	dba := mustCreateGroup(t, services, "dba", 1001, models.GroupTypePeople)
+	web := mustCreateGroup(t, services, "web", 1002, models.GroupTypePeople)
+	alice := mustCreateAccount(t, services, "alice", 1001, models.AccountTypePeople, staff.ID)
+	bob := mustCreateAccount(t, services, "bob", 1002, models.AccountTypePeople, dba.ID)
+	carol := mustCreateAccount(t, services, "carol", 1003, models.AccountTypePeople, 0)
+	mustCreateAccount(t, services, "dave", 1004, models.AccountTypePeople, web.ID)
+	for _, account := range []*models.Account{alice, carol} {
+		if err := services.Account.AssignAccountToGroup(account.ID, dba.ID, testUserID, testUsername, testIP); err != nil {
+			t.Fatalf("AssignAccountToGroup: %v", err)
+		}
+	}
+
+	db1 := &models.Host{Hostname: "db1"}
+	token, err := services.Host.CreateHost(db1, testUserID, testUsername, testIP)
+	if err != nil {
+		t.Fatalf("CreateHost: %v", err)
+	}
+	if found, err := services.Host.AuthenticateHost(token); err != nil || found.ID != db1.ID {
+		t.Fatalf("AuthenticateHost = %v, %v", found, err)
+	}
+
+	// A host without rules sees nothing
+	if got := hostView(t, services, db1); got != " | " {
+		t.Errorf("host without rules sees %s", got)
+	}
+
+	// dba members and primary members, plus carol's direct rule on a second
+	// host group; alice brings her primary group staff but not its members
+	databases := &models.HostGroup{Name: "databases"}
+	oncall := &models.HostGroup{Name: "oncall"}
+	for _, hostGroup := range []*models.HostGroup{databases, oncall} {
+		if err := services.Host.CreateHostGroup(hostGroup, testUserID, testUsername, testIP); err != nil {
+			t.Fatalf("CreateHostGroup: %v", err)
+		}
+		if err := services.Host.AddHostToGroup(hostGroup.ID, db1.ID, testUserID, testUsername, testIP); err != nil {
+			t.Fatalf("AddHostToGroup: %v", err)
+		}
+	}
+	rules := []*models.AccessRule{
+		{HostGroupID: databases.ID, GroupID: dba.ID},
+		{HostGroupID: oncall.ID, AccountID: carol.ID},
+	}
+	for _, rule := range rules {
+		if err := services.Host.CreateAccessRule(rule, testUserID, testUsername, testIP); err != nil {
+			t.Fatalf("CreateAccessRule: %v", err)
+		}
+	}
+	if got := hostView(t, services, db1); got != "alice,bob,carol | staff:x:1000: dba:x:1001:alice,carol" {
+		t.Errorf("db1 sees %s", got)
+	}
+
+	// Rules must name exactly one existing group or account
+	expectError(t, services.Host.CreateAccessRule(&models.AccessRule{HostGroupID: databases.ID}, testUserID, testUsername, testIP), "must allow")
+	expectError(t, services.Host.CreateAccessRule(&models.AccessRule{HostGroupID: databases.ID, GroupID: web.ID, AccountID: bob.ID}, testUserID, testUsername, testIP), "not both")
+	expectError(t, services.Host.CreateAccessRule(&models.AccessRule{HostGroupID: databases.ID, GroupID: 999}, testUserID, testUsername, testIP), "not found")
+
+	// Leaving the host group withdraws its rules; rotating the token
+	// invalidates the old one
+	if err := services.Host.RemoveHostFromGroup(databases.ID, db1.ID, testUserID, testUsername, testIP); err != nil {
+		t.Fatalf("RemoveHostFromGroup: %v", err)
+	}
+	if got := hostView(t, services, db1); got != "carol | " {
+		t.Errorf("db1 sees %s after leaving databases", got)
+	}
+	if _, err := services.Host.RotateHostToken(db1.ID, testUserID, testUsername, testIP); err != nil {
+		t.Fatalf("RotateHostToken: %v", err)
+	}
+	_, err = services.Host.AuthenticateHost(token)
+	expectError(t, err, "invalid host token")
+
+	if got := strings.Join(auditActions(t, repos, "host"), ","); got != "create,rotate_token" {
+		t.Errorf("host audit = %s", got)
+	}
+}
+
+func TestHostScope(t *testing.T) {
+	services, _ := newTestServices(t)
+
+	dba := mustCreateGroup(t, services, "dba", 1001, models.GroupTypePeople)
+	web := mustCreateGroup(t, services, "web", 1002, models.GroupTypePeople)
+	alice := mustCreateAccount(t, services, "alice", 1001, models.AccountTypePeople, dba.ID)
+	bob := mustCreateAccount(t, services, "bob", 1002, models.AccountTypePeople, web.ID)
+	if err := services.Account.AssignAccountToGroup(alice.ID, web.ID, testUserID, testUsername, testIP); err != nil {
+		t.Fatalf("AssignAccountToGroup: %v", err)
+	}
+
+	db1 := &models.Host{Hostname: "db1"}
+	if _, err := services.Host.CreateHost(db1, testUserID, testUsername, testIP); err != nil {
+		t.Fatalf("CreateHost: %v", err)
+	}
+	databases := &models.HostGroup{Name: "databases"}
+	if err := services.Host.CreateHostGroup(databases, testUserID, testUsername, testIP); err != nil {
+		t.Fatalf("CreateHostGroup: %v", err)
+	}
+	if err := services.Host.AddHostToGroup(databases.ID, db1.ID, testUserID, testUsername, testIP); err != nil {
+		t.Fatalf("AddHostToGroup: %v", err)
+	}
+	if err := services.Host.CreateAccessRule(&models.AccessRule{HostGroupID: databases.ID, GroupID: dba.ID}, testUserID, testUsername, testIP); err != nil {
+		t.Fatalf("CreateAccessRule: %v", err)
+	}
+
+	// db1 sees alice and dba, but not bob or web, which db1 has no rule for
+	scope, err := services.Host.GetHostScope(db1)
+	if err != nil {
+		t.Fatalf("GetHostScope: %v", err)
+	}
+	if !scope.Accounts[alice.ID] || scope.Accounts[bob.ID] || !scope.Groups[dba.ID] || scope.Groups[web.ID] {
+		t.Fatalf("scope = %+v", scope)
+	}
+
+	changes, err := services.Change.GetChanges(0, 1000)
+	if err != nil {
+		t.Fatalf("GetChanges: %v", err)
+	}
+	scope.FilterChanges(changes)
+	if len(changes.Accounts) != 1 || changes.Accounts[0].ID != alice.ID {
+		t.Errorf("filtered accounts = %+v", changes.Accounts)
+	}
+	if len(changes.Groups) != 1 || changes.Groups[0].ID != dba.ID {
+		t.Errorf("filtered groups = %+v", changes.Groups)
+	}
+	if len(changes.Memberships) != 0 {
+		t.Errorf("filtered memberships = %+v", changes.Memberships)
+	}
+
+	// Events about bob, web and alice's membership of web are left out
+	records, err := services.Event.GetEventsSince(0, 1000)
+	if err != nil {
+		t.Fatalf("GetEventsSince: %v", err)
+	}
+	wanted := []string{}
+	for i := range records {
+		if scope.WantsEvent(&records[i]) {
+			wanted = append(wanted, records[i].Type)
+		}
+	}
+	if got := strings.Join(wanted, ","); got != "group.created,account.created" {
+		t.Errorf("wanted events = %s", got)
+	}
+}
+
+func TestCachedHostScope(t *testing.T) {
+	services, _ := newTestServices(t)
+
+	dba := mustCreateGroup(t, services, "dba", 1001, models.GroupTypePeople)
+	web := mustCreateGroup(t, services, "web", 1002, models.GroupTypePeople)
+	alice := mustCreateAccount(t, services, "alice", 1001, models.AccountTypePeople, dba.ID)
+	bob := mustCreateAccount(t, services, "bob", 1002, models.AccountTypePeople, web.ID)
+
+	db1 := &models.Host{Hostname: "db1"}
+	if _, err := services.Host.CreateHost(db1, testUserID, testUsername, testIP); err != nil {
+		t.Fatalf("CreateHost: %v", err)
+	}
+	databases := &models.HostGroup{Name: "databases"}
+	if err := services.Host.CreateHostGroup(databases, testUserID, testUsername, testIP); err != nil {
+		t.Fatalf("CreateHostGroup: %v", err)
+	}
+	if err := services.Host.AddHostToGroup(databases.ID, db1.ID, testUserID, testUsername, testIP); err != nil {
+		t.Fatalf("AddHostToGroup: %v", err)
+	}
+	if err := services.Host.CreateAccessRule(&models.AccessRule{HostGroupID: databases.ID, GroupID: dba.ID}, testUserID, testUsername, testIP); err != nil {
+		t.Fatalf("CreateAccessRule: %v", err)
+	}
+
+	lastEvent := func() *models.EventRecord {
+		t.Helper()
+		records, err := services.Event.GetEventsSince(0, 1000)
+		if err != nil || len(records) == 0 {
+			t.Fatalf("GetEventsSince = %d records, %v", len(records), err)
+		}
+		return &records[len(records)-1]
+	}
+	cached := func(record *models.EventRecord) *HostScope {
+		t.Helper()
+		scope, err := services.Host.CachedHostScope(db1, record)
+		if err != nil {
+			t.Fatalf("CachedHostScope: %v", err)
+		}
+		return scope
+	}
+	groupEvent := func() *models.EventRecord {
+		return &models.EventRecord{ID: lastEvent().ID, Type: "group.updated"}
+	}
+
+	if scope := cached(groupEvent()); !scope.Accounts[alice.ID] || scope.Accounts[bob.ID] {
+		t.Fatalf("scope = %+v", scope)
+	}
+
+	// A new dba account comes into scope with its own event; other events
+	// keep using the cached scope
+	carol := mustCreateAccount(t, services, "carol", 1003, models.AccountTypePeople, dba.ID)
+	if scope := cached(groupEvent()); scope.Accounts[carol.ID] {
+		t.Errorf("group event resolved the scope again: %+v", scope)
+	}
+	if scope := cached(lastEvent()); !scope.Accounts[carol.ID] {
+		t.Errorf("account event did not resolve the scope again: %+v", scope)
+	}
+
+	// A new rule clears the cache without any event
+	if err := services.Host.CreateAccessRule(&models.AccessRule{HostGroupID: databases.ID, GroupID: web.ID}, testUserID, testUsername, testIP); err != nil {
+		t.Fatalf("CreateAccessRule: %v", err)
+	}
+	if scope := cached(groupEvent()); !scope.Accounts[bob.ID] || !scope.Groups[web.ID] {
+		t.Errorf("scope after new rule = %+v", scope)
+	}
+}
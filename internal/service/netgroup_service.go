@@ -0,0 +1,315 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/home/unixify/internal/ldif"
+	"github.com/home/unixify/internal/models"
+	"github.com/home/unixify/internal/nss"
+	"github.com/home/unixify/internal/repository"
+)
+
+// DefaultNetgroupBaseDN is where the LDIF export puts netgroups unless told otherwise
+const DefaultNetgroupBaseDN = "ou=netgroup,dc=example,dc=com"
+
+// NetgroupService manages NIS netgroups and exports them as /etc/netgroup and
+// as LDAP nisNetgroup entries
+type NetgroupService struct {
+	netgroupRepo repository.NetgroupStore
+	accountRepo  repository.AccountStore
+	auditRepo    repository.AuditStore
+}
+
+// NewNetgroupService creates a new netgroup service
+func NewNetgroupService(
+	netgroupRepo repository.NetgroupStore,
+	accountRepo repository.AccountStore,
+	auditRepo repository.AuditStore,
+) *NetgroupService {
+	return &NetgroupService{
+		netgroupRepo: netgroupRepo,
+		accountRepo:  accountRepo,
+		auditRepo:    auditRepo,
+	}
+}
+
+// FormatTriple formats a triple as it appears in /etc/netgroup
+func FormatTriple(triple models.NetgroupTriple) string {
+	return fmt.Sprintf("(%s,%s,%s)", triple.Host, triple.User, triple.Domain)
+}
+
+// validNetgroupField reports whether a triple field can be written without
+// breaking the netgroup format
+func validNetgroupField(value string) bool {
+	return !strings.ContainsAny(value, "(),# \t\r\n")
+}
+
+// validateNetgroup checks a netgroup's name and members. Users must be
+// accounts, and nested netgroups must exist and not lead back to it.
+func (s *NetgroupService) validateNetgroup(netgroup *models.Netgroup) error {
+	if !nss.ValidName(netgroup.Name) || len(netgroup.Name) > 255 || !validNetgroupField(netgroup.Name) {
+		return fmt.Errorf("invalid netgroup name %q", netgroup.Name)
+	}
+
+	seenTriples := make(map[models.NetgroupTriple]bool)
+	for _, triple := range netgroup.Triples {
+		if !validNetgroupField(triple.Host) || !validNetgroupField(triple.User) || !validNetgroupField(triple.Domain) {
+			return fmt.Errorf("invalid netgroup triple %s", FormatTriple(triple))
+		}
+		if seenTriples[triple] {
+			return fmt.Errorf("duplicate netgroup triple %s", FormatTriple(triple))
+		}
+		seenTriples[triple] = true
+		if triple.User != "" && triple.User != "-" {
+			if _, err := s.accountRepo.FindByUsername(triple.User); err != nil {
+				return fmt.Errorf("triple %s: account %s not found", FormatTriple(triple), triple.User)
+			}
+		}
+	}
+
+	all, err := s.netgroupRepo.FindAll()
+	if err != nil {
+		return err
+	}
+	byName := make(map[string]models.Netgroup, len(all))
+	for _, existing := range all {
+		byName[existing.Name] = existing
+	}
+	seenNested := make(map[string]bool)
+	for _, name := range netgroup.Netgroups {
+		if name == netgroup.Name {
+			return fmt.Errorf("netgroup %s cannot contain itself", name)
+		}
+		if seenNested[name] {
+			return fmt.Errorf("duplicate nested netgroup %s", name)
+		}
+		seenNested[name] = true
+		if _, ok := byName[name]; !ok {
+			return fmt.Errorf("netgroup %s not found", name)
+		}
+	}
+
+	// Follow the nested netgroups, as saved, looking for this one; its own
+	// saved version is replaced by the one being checked
+	for name, existing := range byName {
+		if netgroup.ID != 0 && existing.ID == netgroup.ID {
+			delete(byName, name)
+		}
+	}
+	visited := make(map[string]bool)
+	queue := append([]string{}, netgroup.Netgroups...)
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		if name == netgroup.Name {
+			return fmt.Errorf("netgroup %s would contain itself through its nested netgroups", netgroup.Name)
+		}
+		if visited[name] {
+			continue
+		}
+		visited[name] = true
+		queue = append(queue, byName[name].Netgroups...)
+	}
+	return nil
+}
+
+// parentsOf returns the names of the netgroups that contain a netgroup
+func (s *NetgroupService) parentsOf(name string) ([]string, error) {
+	all, err := s.netgroupRepo.FindAll()
+	if err != nil {
+		return nil, err
+	}
+	var parents []string
+	for _, netgroup := range all {
+		for _, nested := range netgroup.Netgroups {
+			if nested == name {
+				parents = append(parents, netgroup.Name)
+			}
+		}
+	}
+	return parents, nil
+}
+
+// normalizeNetgroup stores empty member lists as [] rather than null
+func normalizeNetgroup(netgroup *models.Netgroup) {
+	if netgroup.Triples == nil {
+		netgroup.Triples = []models.NetgroupTriple{}
+	}
+	if netgroup.Netgroups == nil {
+		netgroup.Netgroups = []string{}
+	}
+}
+
+// CreateNetgroup creates a new netgroup
+func (s *NetgroupService) CreateNetgroup(netgroup *models.Netgroup, userID uint, username, ipAddress string) error {
+	netgroup.ID = 0
+	if err := s.validateNetgroup(netgroup); err != nil {
+		return err
+	}
+	normalizeNetgroup(netgroup)
+
+	// Create netgroup
+	err := s.netgroupRepo.Create(netgroup)
+	if err != nil {
+		return err
+	}
+
+	// Log audit entry
+	auditEntry := &models.AuditEntry{
+		Action:     "create",
+		EntityID:   netgroup.ID,
+		EntityType: "netgroup",
+		Details:    fmt.Sprintf("Created netgroup %s", netgroupLine(*netgroup)),
+		UserID:     userID,
+		Username:   username,
+		IPAddress:  ipAddress,
+		Timestamp:  time.Now(),
+	}
+	return s.auditRepo.Create(auditEntry)
+}
+
+// GetNetgroup gets a netgroup by ID
+func (s *NetgroupService) GetNetgroup(id uint) (*models.Netgroup, error) {
+	return s.netgroupRepo.FindByID(id)
+}
+
+// GetAllNetgroups gets all netgroups
+func (s *NetgroupService) GetAllNetgroups() ([]models.Netgroup, error) {
+	return s.netgroupRepo.FindAll()
+}
+
+// UpdateNetgroup updates a netgroup. A netgroup that other netgroups contain
+// cannot be renamed.
+func (s *NetgroupService) UpdateNetgroup(netgroup *models.Netgroup, userID uint, username, ipAddress string) error {
+	existing, err := s.netgroupRepo.FindByID(netgroup.ID)
+	if err != nil {
+		return err
+	}
+	if existing.Name != netgroup.Name {
+		parents, err := s.parentsOf(existing.Name)
+		if err != nil {
+			return err
+		}
+		if len(parents) > 0 {
+			return fmt.Errorf("netgroup %s cannot be renamed: it is nested in %s", existing.Name, strings.Join(parents, ", "))
+		}
+	}
+	if err := s.validateNetgroup(netgroup); err != nil {
+		return err
+	}
+	normalizeNetgroup(netgroup)
+	netgroup.CreatedAt = existing.CreatedAt
+
+	// Update netgroup
+	err = s.netgroupRepo.Update(netgroup)
+	if err != nil {
+		return err
+	}
+
+	// Log audit entry
+	auditEntry := &models.AuditEntry{
+		Action:     "update",
+		EntityID:   netgroup.ID,
+		EntityType: "netgroup",
+		Details:    fmt.Sprintf("Updated netgroup %s", netgroupLine(*netgroup)),
+		UserID:     userID,
+		Username:   username,
+		IPAddress:  ipAddress,
+		Timestamp:  time.Now(),
+	}
+	return s.auditRepo.Create(auditEntry)
+}
+
+// DeleteNetgroup deletes a netgroup that no other netgroup contains
+func (s *NetgroupService) DeleteNetgroup(id uint, userID uint, username, ipAddress string) error {
+	// Get netgroup to record its name in audit
+	netgroup, err := s.netgroupRepo.FindByID(id)
+	if err != nil {
+		return err
+	}
+	parents, err := s.parentsOf(netgroup.Name)
+	if err != nil {
+		return err
+	}
+	if len(parents) > 0 {
+		return fmt.Errorf("netgroup %s cannot be deleted: it is nested in %s", netgroup.Name, strings.Join(parents, ", "))
+	}
+
+	// Delete netgroup
+	err = s.netgroupRepo.Delete(id)
+	if err != nil {
+		return err
+	}
+
+	// Log audit entry
+	auditEntry := &models.AuditEntry{
+		Action:     "delete",
+		EntityID:   id,
+		EntityType: "netgroup",
+		Details:    fmt.Sprintf("Deleted netgroup %s", netgroup.Name),
+		UserID:     userID,
+		Username:   username,
+		IPAddress:  ipAddress,
+		Timestamp:  time.Now(),
+	}
+	return s.auditRepo.Create(auditEntry)
+}
+
+// netgroupLine formats a netgroup as a line of /etc/netgroup
+func netgroupLine(netgroup models.Netgroup) string {
+	fields := []string{netgroup.Name}
+	for _, triple := range netgroup.Triples {
+		fields = append(fields, FormatTriple(triple))
+	}
+	fields = append(fields, netgroup.Netgroups...)
+	return strings.Join(fields, " ")
+}
+
+// ExportNetgroupFile returns all netgroups in /etc/netgroup format
+func (s *NetgroupService) ExportNetgroupFile() ([]byte, error) {
+	netgroups, err := s.netgroupRepo.FindAll()
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	for _, netgroup := range netgroups {
+		buf.WriteString(netgroupLine(netgroup) + "\n")
+	}
+	return buf.Bytes(), nil
+}
+
+// ExportNetgroupLDIF returns all netgroups as RFC 2307 nisNetgroup entries
+// below baseDN
+func (s *NetgroupService) ExportNetgroupLDIF(baseDN string) ([]byte, error) {
+	if baseDN == "" {
+		baseDN = DefaultNetgroupBaseDN
+	}
+	netgroups, err := s.netgroupRepo.FindAll()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]ldif.Entry, 0, len(netgroups))
+	for _, netgroup := range netgroups {
+		entry := ldif.Entry{DN: "cn=" + ldif.EscapeDN(netgroup.Name) + "," + baseDN}
+		entry.Add("objectClass", "top", "nisNetgroup")
+		entry.Add("cn", netgroup.Name)
+		if netgroup.Description != "" {
+			entry.Add("description", netgroup.Description)
+		}
+		for _, triple := range netgroup.Triples {
+			entry.Add("nisNetgroupTriple", FormatTriple(triple))
+		}
+		entry.Add("memberNisNetgroup", netgroup.Netgroups...)
+		entries = append(entries, entry)
+	}
+
+	var buf bytes.Buffer
+	if err := ldif.Write(&buf, entries); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/home/unixify/internal/models"
+)
+
+func TestNetgroupValidationAndExport(t *testing.T) {
+	services, repos := newTestServices(t)
+	mustCreateAccount(t, services, "alice", 1001, models.AccountTypePeople, 0)
+
+	create := func(name string, triples []models.NetgroupTriple, nested ...string) (*models.Netgroup, error) {
+		netgroup := &models.Netgroup{Name: name, Triples: triples, Netgroups: nested}
+		return netgroup, services.Netgroup.CreateNetgroup(netgroup, testUserID, testUsername, testIP)
+	}
+
+	admins, err := create("admins", []models.NetgroupTriple{{User: "alice"}, {Host: "bastion", User: "-", Domain: "corp"}})
+	if err != nil {
+		t.Fatalf("CreateNetgroup(admins): %v", err)
+	}
+	nfs, err := create("nfs-clients", []models.NetgroupTriple{{Host: "web1"}}, "admins")
+	if err != nil {
+		t.Fatalf("CreateNetgroup(nfs-clients): %v", err)
+	}
+
+	// Users must be accounts, nested netgroups must exist, and fields must not
+	// break the format
+	_, err = create("bad", []models.NetgroupTriple{{User: "mallory"}})
+	expectError(t, err, "account mallory not found")
+	_, err = create("bad", nil, "missing")
+	expectError(t, err, "netgroup missing not found")
+	_, err = create("bad", []models.NetgroupTriple{{Host: "a,b"}})
+	expectError(t, err, "invalid netgroup triple")
+	_, err = create("bad name", nil)
+	expectError(t, err, "invalid netgroup name")
+
+	// Cycles are rejected, directly and through other netgroups
+	admins.Netgroups = []string{"nfs-clients"}
+	expectError(t, services.Netgroup.UpdateNetgroup(admins, testUserID, testUsername, testIP), "would contain itself")
+	admins.Netgroups = []string{"admins"}
+	expectError(t, services.Netgroup.UpdateNetgroup(admins, testUserID, testUsername, testIP), "cannot contain itself")
+
+	// Nested netgroups cannot be deleted or renamed
+	expectError(t, services.Netgroup.DeleteNetgroup(admins.ID, testUserID, testUsername, testIP), "nested in nfs-clients")
+	admins, _ = services.Netgroup.GetNetgroup(admins.ID)
+	admins.Name = "wheel"
+	expectError(t, services.Netgroup.UpdateNetgroup(admins, testUserID, testUsername, testIP), "cannot be renamed")
+
+	file, err := services.Netgroup.ExportNetgroupFile()
+	if err != nil {
+		t.Fatalf("ExportNetgroupFile: %v", err)
+	}
+	if want := "admins (,alice,) (bastion,-,corp)\nnfs-clients (web1,,) admins\n"; string(file) != want {
+		t.Errorf("netgroup file:\n%s\nwant:\n%s", file, want)
+	}
+
+	data, err := services.Netgroup.ExportNetgroupLDIF("ou=netgroup,dc=corp")
+	if err != nil {
+		t.Fatalf("ExportNetgroupLDIF: %v", err)
+	}
+	for _, want := range []string{
+		"dn: cn=nfs-clients,ou=netgroup,dc=corp\nobjectClass: top\nobjectClass: nisNetgroup\ncn: nfs-clients\nnisNetgroupTriple: (web1,,)\nmemberNisNetgroup: admins\n",
+		"nisNetgroupTriple: (,alice,)\nnisNetgroupTriple: (bastion,-,corp)\n",
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("LDIF export is missing %q:\n%s", want, data)
+		}
+	}
+
+	if err := services.Netgroup.DeleteNetgroup(nfs.ID, testUserID, testUsername, testIP); err != nil {
+		t.Fatalf("DeleteNetgroup: %v", err)
+	}
+	if got := strings.Join(auditActions(t, repos, "netgroup"), ","); got != "create,create,delete" {
+		t.Errorf("netgroup audit = %s", got)
+	}
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/home/unixify/internal/models"
+	"github.com/home/unixify/internal/repository"
+)
+
+// ReservationService handles business logic for UID/GID reservations
+type ReservationService struct {
+	reservationRepo *repository.ReservationRepository
+	auditRepo       repository.AuditStore
+}
+
+// NewReservationService creates a new reservation service
+func NewReservationService(
+	reservationRepo *repository.ReservationRepository,
+	auditRepo repository.AuditStore,
+) *ReservationService {
+	return &ReservationService{
+		reservationRepo: reservationRepo,
+		auditRepo:       auditRepo,
+	}
+}
+
+// CreateReservation creates a new reservation
+func (s *ReservationService) CreateReservation(reservation *models.Reservation, userID uint, username, ipAddress string) error {
+	if err := validateReservation(reservation); err != nil {
+		return err
+	}
+
+	// Check if name already exists
+	existing, err := s.reservationRepo.FindByName(reservation.Name)
+	if err == nil && existing != nil {
+		return fmt.Errorf("reservation with name %s already exists", reservation.Name)
+	}
+
+	// Create reservation
+	err = s.reservationRepo.Create(reservation)
+	if err != nil {
+		return err
+	}
+
+	// Log audit entry
+	auditEntry := &models.AuditEntry{
+		Action:     "create",
+		EntityID:   reservation.ID,
+		EntityType: "reservation",
+		Details:    fmt.Sprintf("Created %s reservation %s (%d-%d)", reservation.Kind, reservation.Name, reservation.Start, reservation.End),
+		UserID:     userID,
+		Username:   username,
+		IPAddress:  ipAddress,
+		Timestamp:  time.Now(),
+	}
+	return s.auditRepo.Create(auditEntry)
+}
+
+// GetAllReservations gets all reservations with optional filtering by kind
+func (s *ReservationService) GetAllReservations(kind string) ([]models.Reservation, error) {
+	return s.reservationRepo.FindAll(kind)
+}
+
+// UpdateReservation updates a reservation
+func (s *ReservationService) UpdateReservation(reservation *models.Reservation, userID uint, username, ipAddress string) error {
+	if err := validateReservation(reservation); err != nil {
+		return err
+	}
+
+	// Update reservation
+	err := s.reservationRepo.Update(reservation)
+	if err != nil {
+		return err
+	}
+
+	// Log audit entry
+	auditEntry := &models.AuditEntry{
+		Action:     "update",
+		EntityID:   reservation.ID,
+		EntityType: "reservation",
+		Details:    fmt.Sprintf("Updated %s reservation %s (%d-%d)", reservation.Kind, reservation.Name, reservation.Start, reservation.End),
+		UserID:     userID,
+		Username:   username,
+		IPAddress:  ipAddress,
+		Timestamp:  time.Now(),
+	}
+	return s.auditRepo.Create(auditEntry)
+}
+
+// DeleteReservation deletes a reservation
+func (s *ReservationService) DeleteReservation(id uint, userID uint, username, ipAddress string) error {
+	// Get reservation to record its name in audit
+	reservation, err := s.reservationRepo.FindByID(id)
+	if err != nil {
+		return err
+	}
+
+	// Delete reservation
+	err = s.reservationRepo.Delete(id)
+	if err != nil {
+		return err
+	}
+
+	// Log audit entry
+	auditEntry := &models.AuditEntry{
+		Action:     "delete",
+		EntityID:   id,
+		EntityType: "reservation",
+		Details:    fmt.Sprintf("Deleted %s reservation %s (%d-%d)", reservation.Kind, reservation.Name, reservation.Start, reservation.End),
+		UserID:     userID,
+		Username:   username,
+		IPAddress:  ipAddress,
+		Timestamp:  time.Now(),
+	}
+	return s.auditRepo.Create(auditEntry)
+}
+
+// validateReservation checks the kind and bounds of a reservation
+func validateReservation(reservation *models.Reservation) error {
+	if reservation.Kind != models.ReservationKindUID && reservation.Kind != models.ReservationKindGID {
+		return fmt.Errorf("invalid reservation kind: %s", reservation.Kind)
+	}
+	if reservation.Start < 0 || reservation.End < reservation.Start {
+		return fmt.Errorf("invalid reservation range %d-%d", reservation.Start, reservation.End)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/home/unixify/internal/models"
+	"github.com/home/unixify/internal/query"
+	"github.com/home/unixify/internal/repository"
+)
+
+// SavedSearchService stores queries in the query language under a name, for
+// each user, and runs them. Queries are parsed when they are saved, so a
+// saved search that would not parse is never stored.
+type SavedSearchService struct {
+	savedRepo repository.SavedSearchStore
+	accounts  *AccountService
+	groups    *GroupService
+	search    *SearchService
+}
+
+// NewSavedSearchService creates a new saved search service. Saved searches
+// run through the account, group and combined searches.
+func NewSavedSearchService(
+	savedRepo repository.SavedSearchStore,
+	accounts *AccountService,
+	groups *GroupService,
+	search *SearchService,
+) *SavedSearchService {
+	return &SavedSearchService{
+		savedRepo: savedRepo,
+		accounts:  accounts,
+		groups:    groups,
+		search:    search,
+	}
+}
+
+// savedSearchKinds maps the kind of a saved search to the kinds of record
+// its query is parsed for
+var savedSearchKinds = map[string]query.Kinds{
+	models.SavedSearchAccounts: query.KindAccount,
+	models.SavedSearchGroups:   query.KindGroup,
+	models.SavedSearchAll:      query.KindAll,
+}
+
+// validateSavedSearch checks a saved search's name and kind, parses its
+// query, and makes sure its owner has no other search of that name. Parse
+// errors are *query.Error.
+func (s *SavedSearchService) validateSavedSearch(search *models.SavedSearch) error {
+	search.Name = strings.TrimSpace(search.Name)
+	if search.Name == "" || len(search.Name) > 255 {
+		return fmt.Errorf("invalid saved search name %q", search.Name)
+	}
+	kinds, ok := savedSearchKinds[search.Kind]
+	if !ok {
+		return fmt.Errorf("invalid saved search kind %q, use accounts, groups or all", search.Kind)
+	}
+	if strings.TrimSpace(search.Query) == "" {
+		return fmt.Errorf("saved search query is required")
+	}
+	if _, err := query.Parse(search.Query, kinds); err != nil {
+		return err
+	}
+
+	existing, err := s.savedRepo.FindByUser(search.UserID)
+	if err != nil {
+		return err
+	}
+	for _, other := range existing {
+		if other.ID != search.ID && other.Name == search.Name {
+			return fmt.Errorf("saved search %s already exists", search.Name)
+		}
+	}
+	return nil
+}
+
+// CreateSavedSearch saves a search for a user
+func (s *SavedSearchService) CreateSavedSearch(search *models.SavedSearch, userID uint) error {
+	search.ID = 0
+	search.UserID = userID
+	if err := s.validateSavedSearch(search); err != nil {
+		return err
+	}
+	return s.savedRepo.Create(search)
+}
+
+// GetSavedSearch gets a saved search of a user by ID. Other users' saved
+// searches are reported as not found.
+func (s *SavedSearchService) GetSavedSearch(id, userID uint) (*models.SavedSearch, error) {
+	search, err := s.savedRepo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if search.UserID != userID {
+		return nil, fmt.Errorf("saved search with ID %d not found", id)
+	}
+	return search, nil
+}
+
+// GetSavedSearches gets the saved searches of a user
+func (s *SavedSearchService) GetSavedSearches(userID uint) ([]models.SavedSearch, error) {
+	return s.savedRepo.FindByUser(userID)
+}
+
+// UpdateSavedSearch updates a saved search of a user
+func (s *SavedSearchService) UpdateSavedSearch(search *models.SavedSearch, userID uint) error {
+	existing, err := s.GetSavedSearch(search.ID, userID)
+	if err != nil {
+		return err
+	}
+	search.UserID = userID
+	search.CreatedAt = existing.CreatedAt
+	if err := s.validateSavedSearch(search); err != nil {
+		return err
+	}
+	return s.savedRepo.Update(search)
+}
+
+// DeleteSavedSearch deletes a saved search of a user
+func (s *SavedSearchService) DeleteSavedSearch(id, userID uint) error {
+	if _, err := s.GetSavedSearch(id, userID); err != nil {
+		return err
+	}
+	return s.savedRepo.Delete(id)
+}
+
+// RunSavedSearch runs a saved search against the registry as it is now. It
+// returns []models.Account, []models.Group or, for the kind all, at most
+// limit []models.SearchResult, as the matching search endpoint would. Parse
+// errors are *query.Error.
+func (s *SavedSearchService) RunSavedSearch(search *models.SavedSearch, limit int) (interface{}, error) {
+	switch search.Kind {
+	case models.SavedSearchAccounts:
+		return s.accounts.SearchAccounts(search.Query)
+	case models.SavedSearchGroups:
+		return s.groups.SearchGroups(search.Query)
+	case models.SavedSearchAll:
+		return s.search.Search(search.Query, limit)
+	}
+	return nil, fmt.Errorf("invalid saved search kind %q", search.Kind)
+}
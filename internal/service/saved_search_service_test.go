@@ -0,0 +1,79 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/home/unixify/internal/models"
+	"github.com/home/unixify/internal/query"
+)
+
+func TestSavedSearches(t *testing.T) {
+	services, _ := newTestServices(t)
+	staff := mustCreateGroup(t, services, "staff", 1000, models.GroupTypePeople)
+	mustCreateAccount(t, services, "alice", 1001, models.AccountTypePeople, staff.ID)
+	mustCreateAccount(t, services, "svc-backup", 20001, models.AccountTypeService, 0)
+
+	save := func(userID uint, name, kind, q string) (*models.SavedSearch, error) {
+		search := &models.SavedSearch{Name: name, Kind: kind, Query: q}
+		return search, services.SavedSearch.CreateSavedSearch(search, userID)
+	}
+
+	serviceAccounts, err := save(testUserID, "services", models.SavedSearchAccounts, "type:service")
+	if err != nil {
+		t.Fatalf("CreateSavedSearch: %v", err)
+	}
+	if _, err := save(testUserID, "people groups", models.SavedSearchGroups, "type:people"); err != nil {
+		t.Fatalf("CreateSavedSearch: %v", err)
+	}
+
+	// Queries are parsed for the kind of search when they are saved
+	var parseErr *query.Error
+	if _, err := save(testUserID, "typo", models.SavedSearchAccounts, "typ:service"); !errors.As(err, &parseErr) {
+		t.Errorf("saving an unparsable query = %v, want a *query.Error", err)
+	}
+	if _, err := save(testUserID, "uids", models.SavedSearchGroups, "uid:>1000"); !errors.As(err, &parseErr) {
+		t.Errorf("saving an account field as a group search = %v, want a *query.Error", err)
+	}
+	_, err = save(testUserID, "bad", "users", "type:service")
+	expectError(t, err, "invalid saved search kind")
+	_, err = save(testUserID, "services", models.SavedSearchAll, "active:true")
+	expectError(t, err, "saved search services already exists")
+
+	// Names are per user, and other users' searches cannot be seen or changed
+	other, err := save(testUserID+1, "services", models.SavedSearchAll, "type:service")
+	if err != nil {
+		t.Fatalf("CreateSavedSearch for another user: %v", err)
+	}
+	if _, err := services.SavedSearch.GetSavedSearch(other.ID, testUserID); err == nil {
+		t.Error("expected another user's saved search to be hidden")
+	}
+	expectError(t, services.SavedSearch.DeleteSavedSearch(other.ID, testUserID), "not found")
+	mine, err := services.SavedSearch.GetSavedSearches(testUserID)
+	if err != nil || len(mine) != 2 || mine[0].Name != "people groups" || mine[1].Name != "services" {
+		t.Fatalf("GetSavedSearches = %+v, %v", mine, err)
+	}
+
+	// Running a saved search evaluates its query against the registry as it is
+	results, err := services.SavedSearch.RunSavedSearch(serviceAccounts, 0)
+	if accounts, ok := results.([]models.Account); err != nil || !ok || len(accounts) != 1 || accounts[0].Username != "svc-backup" {
+		t.Errorf("RunSavedSearch(services) = %+v, %v", results, err)
+	}
+	results, err = services.SavedSearch.RunSavedSearch(other, 0)
+	if found, ok := results.([]models.SearchResult); err != nil || !ok || len(found) != 1 || found[0].Name != "svc-backup" {
+		t.Errorf("RunSavedSearch(all) = %+v, %v", results, err)
+	}
+
+	serviceAccounts.Query = "type:people"
+	if err := services.SavedSearch.UpdateSavedSearch(serviceAccounts, testUserID); err != nil {
+		t.Fatalf("UpdateSavedSearch: %v", err)
+	}
+	results, err = services.SavedSearch.RunSavedSearch(serviceAccounts, 0)
+	if accounts, ok := results.([]models.Account); err != nil || !ok || len(accounts) != 1 || accounts[0].Username != "alice" {
+		t.Errorf("RunSavedSearch after update = %+v, %v", results, err)
+	}
+	serviceAccounts.Query = "uid:abc"
+	if err := services.SavedSearch.UpdateSavedSearch(serviceAccounts, testUserID); !errors.As(err, &parseErr) {
+		t.Errorf("UpdateSavedSearch with a bad query = %v, want a *query.Error", err)
+	}
+}
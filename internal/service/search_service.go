@@ -0,0 +1,66 @@
+package service
+
+import (
+	"github.com/home/unixify/internal/models"
+	"github.com/home/unixify/internal/query"
+	"github.com/home/unixify/internal/repository"
+	"github.com/home/unixify/internal/search"
+)
+
+// Search result limits
+const (
+	DefaultSearchLimit = 20
+	MaxSearchLimit     = 100
+)
+
+// SearchService searches accounts and groups together
+type SearchService struct {
+	searchRepo  repository.SearchStore
+	accountRepo repository.AccountStore
+	groupRepo   repository.GroupStore
+}
+
+// NewSearchService creates a new search service
+func NewSearchService(searchRepo repository.SearchStore, accountRepo repository.AccountStore, groupRepo repository.GroupStore) *SearchService {
+	return &SearchService{
+		searchRepo:  searchRepo,
+		accountRepo: accountRepo,
+		groupRepo:   groupRepo,
+	}
+}
+
+// Search finds the accounts and groups matching a query, best first. Bare
+// words are ranked by how well they match; field terms of the query
+// language filter the results. A limit of 0 returns DefaultSearchLimit
+// results; larger limits are capped at MaxSearchLimit. Parse errors are
+// *query.Error.
+func (s *SearchService) Search(input string, limit int) ([]models.SearchResult, error) {
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+	if limit > MaxSearchLimit {
+		limit = MaxSearchLimit
+	}
+
+	q, err := query.Parse(input, query.KindAll)
+	if err != nil {
+		return nil, err
+	}
+	filters := q.Filters()
+	if len(filters.Terms) == 0 {
+		return s.searchRepo.Search(q.Text(), limit)
+	}
+
+	accounts, err := s.accountRepo.FindByQuery(filters)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := s.groupRepo.FindByQuery(filters)
+	if err != nil {
+		return nil, err
+	}
+	if text := q.Text(); text != "" {
+		return search.Rank(text, accounts, groups, limit), nil
+	}
+	return search.List(accounts, groups, limit), nil
+}
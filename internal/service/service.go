@@ -2,6 +2,8 @@ package service
 
 import (
 	"github.com/home/unixify/internal/repository"
+	"github.com/home/unixify/internal/validator"
+	"github.com/home/unixify/internal/webhook"
 	"gorm.io/gorm"
 )
 
@@ -9,26 +11,88 @@ import (
 type Deps struct {
 	Repos *repository.Repositories
 	DB    *gorm.DB
+	// SubIDs is the pool subordinate ID blocks come from; zero uses DefaultSubIDPool
+	SubIDs SubIDPool
+	// Names is the username and group name policy; zero uses validator.DefaultNamePolicy
+	Names validator.NamePolicy
+	// WebhookTargets is where webhooks may point; zero refuses non-public addresses
+	WebhookTargets webhook.TargetPolicy
 }
 
 // Services is a holder for all services
 type Services struct {
-	Account *AccountService
-	Group   *GroupService
-	Audit   *AuditService
-	db      *gorm.DB  // Add DB connection for direct access if needed
+	Account     *AccountService
+	Group       *GroupService
+	Audit       *AuditService
+	Reservation *ReservationService
+	State       *StateService
+	Webhook     *WebhookService
+	Event       *EventService
+	Change      *ChangeService
+	Host        *HostService
+	Netgroup    *NetgroupService
+	Sudo        *SudoService
+	SubID       *SubIDService
+	Drift       *DriftService
+	Search      *SearchService
+	SavedSearch *SavedSearchService
+	db          *gorm.DB // Add DB connection for direct access if needed
 }
 
 // NewServices creates new instances of all services
 func NewServices(deps Deps) *Services {
+	webhooks := NewWebhookService(deps.Repos.Webhook, deps.Repos.Audit)
+	webhooks.targets = deps.WebhookTargets
+	eventLog := NewEventService(deps.Repos.Event)
+	events := publishers{eventLog, webhooks}
+	subIDs := NewSubIDService(deps.Repos.SubID, deps.Repos.Account, deps.Repos.Audit, deps.SubIDs)
+	accounts := NewAccountService(deps.Repos.Account, deps.Repos.Group, deps.Repos.Audit, events)
+	accounts.subIDs = subIDs
+	accounts.deps = deps
+	groups := NewGroupService(deps.Repos.Group, deps.Repos.Account, deps.Repos.Audit, events)
+	groups.deps = deps
+	sudo := NewSudoService(deps.Repos.Sudo, deps.Repos.Account, deps.Repos.Group, deps.Repos.Audit, events)
+	sudo.deps = deps
+	if deps.Names.Pattern != nil {
+		accounts.names = deps.Names
+		groups.names = deps.Names
+	}
+	states := NewStateService(deps.DB, deps.Repos)
+	states.subIDs = deps.SubIDs
+	states.names = deps.Names
+	search := NewSearchService(deps.Repos.Search, deps.Repos.Account, deps.Repos.Group)
 	return &Services{
-		Account: NewAccountService(deps.Repos.Account, deps.Repos.Group, deps.Repos.Audit),
-		Group:   NewGroupService(deps.Repos.Group, deps.Repos.Account, deps.Repos.Audit),
-		Audit:   NewAuditService(deps.Repos.Audit),
-		db:      deps.DB,
+		Account:     accounts,
+		Group:       groups,
+		Audit:       NewAuditService(deps.Repos.Audit),
+		Reservation: NewReservationService(deps.Repos.Reservation, deps.Repos.Audit),
+		State:       states,
+		Webhook:     webhooks,
+		Event:       eventLog,
+		Change:      NewChangeService(deps.Repos.Change),
+		Host:        NewHostService(deps.Repos.Host, deps.Repos.Account, deps.Repos.Group, deps.Repos.Audit),
+		Netgroup:    NewNetgroupService(deps.Repos.Netgroup, deps.Repos.Account, deps.Repos.Audit),
+		Sudo:        sudo,
+		SubID:       subIDs,
+		Drift:       NewDriftService(deps.Repos.Account, deps.Repos.Group),
+		Search:      search,
+		SavedSearch: NewSavedSearchService(deps.Repos.SavedSearch, accounts, groups, search),
+		db:          deps.DB,
 	}
 }
 
+// transaction runs fn with services built from deps whose writes all go
+// through one database transaction, so a change, its audit entry and its
+// events are saved together or not at all
+func transaction(deps Deps, fn func(tx *Services) error) error {
+	return deps.DB.Transaction(func(tx *gorm.DB) error {
+		txDeps := deps
+		txDeps.Repos = repository.NewRepositories(tx)
+		txDeps.DB = tx
+		return fn(NewServices(txDeps))
+	})
+}
+
 // GetDB returns the database connection
 func (s *Services) GetDB() *gorm.DB {
 	return s.db
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/home/unixify/db/migrations"
+	"github.com/home/unixify/internal/config"
+	"github.com/home/unixify/internal/models"
+	"github.com/home/unixify/internal/repository"
+	"github.com/home/unixify/internal/repository/memory"
+	"gorm.io/gorm/logger"
+)
+
+// Audit identity used by the tests
+const (
+	testUserID   = 1
+	testUsername = "tester"
+	testIP       = "127.0.0.1"
+)
+
+// newTestServices returns services backed by an empty in-memory store
+func newTestServices(t *testing.T) (*Services, *repository.Repositories) {
+	t.Helper()
+	repos := memory.NewRepositories()
+	return NewServices(Deps{Repos: repos}), repos
+}
+
+// newSQLiteServices returns services over a fresh SQLite file with the
+// embedded migrations applied, for tests that need transactions
+func newSQLiteServices(t *testing.T) (*Services, *repository.Repositories) {
+	t.Helper()
+	cfg := &config.Config{Database: config.DatabaseConfig{
+		Driver: config.DriverSQLite,
+		Path:   filepath.Join(t.TempDir(), "unixify.db"),
+	}}
+	if err := migrations.Up(cfg.Database.GetURL()); err != nil {
+		t.Fatalf("migrations.Up: %v", err)
+	}
+	db, err := repository.InitDB(cfg)
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	db.Logger = logger.Default.LogMode(logger.Silent)
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("DB: %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	repos := repository.NewRepositories(db)
+	return NewServices(Deps{Repos: repos, DB: db}), repos
+}
+
+// failInserts makes every insert into a table fail until the test ends
+func failInserts(t *testing.T, services *Services, table string) {
+	t.Helper()
+	db := services.GetDB()
+	trigger := "fail_" + table
+	if err := db.Exec("CREATE TRIGGER " + trigger + " BEFORE INSERT ON " + table + " BEGIN SELECT RAISE(ABORT, 'insert refused by test'); END").Error; err != nil {
+		t.Fatalf("create trigger: %v", err)
+	}
+	t.Cleanup(func() { db.Exec("DROP TRIGGER " + trigger) })
+}
+
+// mustCreateGroup creates a group or fails the test
+func mustCreateGroup(t *testing.T, services *Services, groupname string, gid int, groupType models.GroupType) *models.Group {
+	t.Helper()
+	group := &models.Group{Groupname: groupname, UnixGID: gid, Type: groupType}
+	if err := services.Group.CreateGroup(group, testUserID, testUsername, testIP); err != nil {
+		t.Fatalf("CreateGroup(%s): %v", groupname, err)
+	}
+	return group
+}
+
+// mustCreateAccount creates an account or fails the test
+func mustCreateAccount(t *testing.T, services *Services, username string, uid int, accountType models.AccountType, primaryGroupID uint) *models.Account {
+	t.Helper()
+	account := &models.Account{Username: username, UnixUID: uid, Type: accountType, PrimaryGroupID: primaryGroupID}
+	if err := services.Account.CreateAccount(account, testUserID, testUsername, testIP); err != nil {
+		t.Fatalf("CreateAccount(%s): %v", username, err)
+	}
+	return account
+}
+
+// expectError fails the test unless err contains want
+func expectError(t *testing.T, err error, want string) {
+	t.Helper()
+	if err == nil {
+		t.Fatalf("expected error containing %q, got nil", want)
+	}
+	if !strings.Contains(err.Error(), want) {
+		t.Fatalf("expected error containing %q, got %q", want, err.Error())
+	}
+}
+
+// auditActions returns the actions recorded for an entity type, oldest first
+func auditActions(t *testing.T, repos *repository.Repositories, entityType string) []string {
+	t.Helper()
+	entries, err := repos.Audit.FindAll(entityType, "", 0, 0)
+	if err != nil {
+		t.Fatalf("FindAll audit: %v", err)
+	}
+	actions := make([]string, 0, len(entries))
+	for i := len(entries) - 1; i >= 0; i-- {
+		actions = append(actions, entries[i].Action)
+	}
+	return actions
+}
@@ -0,0 +1,201 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/home/unixify/internal/models"
+	"github.com/home/unixify/internal/repository"
+	"github.com/home/unixify/internal/state"
+	"github.com/home/unixify/internal/validator"
+	"gorm.io/gorm"
+)
+
+// StateService plans and applies declarative desired-state documents
+type StateService struct {
+	db     *gorm.DB
+	repos  *repository.Repositories
+	subIDs SubIDPool            // Pool of the services Apply creates
+	names  validator.NamePolicy // Name policy of the services Apply creates
+}
+
+// NewStateService creates a new state service
+func NewStateService(db *gorm.DB, repos *repository.Repositories) *StateService {
+	return &StateService{
+		db:    db,
+		repos: repos,
+	}
+}
+
+// Plan compares the desired state with the registry and returns the changes needed
+func (s *StateService) Plan(desired *state.DesiredState, prune bool) (*state.Plan, error) {
+	snapshot, err := takeSnapshot(s.repos)
+	if err != nil {
+		return nil, err
+	}
+	return state.Diff(desired, snapshot, prune)
+}
+
+// Apply brings the registry in line with the desired state in a single transaction.
+// Every change goes through the regular services so validation and audit entries
+// are identical to changes made through the API. Nothing is written if any change fails.
+func (s *StateService) Apply(desired *state.DesiredState, prune bool, userID uint, username, ipAddress string) (*state.Plan, error) {
+	var plan *state.Plan
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		repos := repository.NewRepositories(tx)
+		services := NewServices(Deps{Repos: repos, DB: tx, SubIDs: s.subIDs, Names: s.names})
+
+		// Plan inside the transaction so the diff matches what is written
+		snapshot, err := takeSnapshot(repos)
+		if err != nil {
+			return err
+		}
+		plan, err = state.Diff(desired, snapshot, prune)
+		if err != nil {
+			return err
+		}
+
+		for _, change := range plan.Changes {
+			if err := applyChange(services, repos, change, userID, username, ipAddress); err != nil {
+				return fmt.Errorf("failed to %s %s %s: %w", change.Action, change.Kind, change.Name, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return plan, nil
+}
+
+// takeSnapshot loads the current registry content
+func takeSnapshot(repos *repository.Repositories) (*state.Snapshot, error) {
+	groups, err := repos.Group.FindAll("")
+	if err != nil {
+		return nil, err
+	}
+	accounts, err := repos.Account.FindAll("")
+	if err != nil {
+		return nil, err
+	}
+	memberships, err := repos.Account.FindAllMemberships()
+	if err != nil {
+		return nil, err
+	}
+	reservations, err := repos.Reservation.FindAll("")
+	if err != nil {
+		return nil, err
+	}
+
+	return &state.Snapshot{
+		Groups:       groups,
+		Accounts:     accounts,
+		Memberships:  memberships,
+		Reservations: reservations,
+	}, nil
+}
+
+// applyChange executes a single planned change
+func applyChange(services *Services, repos *repository.Repositories, change state.Change, userID uint, username, ipAddress string) error {
+	switch change.Kind {
+	case state.KindReservation:
+		if change.Action == state.ActionDelete {
+			return services.Reservation.DeleteReservation(change.ID, userID, username, ipAddress)
+		}
+		reservation := &models.Reservation{
+			ID:          change.ID,
+			Name:        change.Reservation.Name,
+			Kind:        change.Reservation.Kind,
+			Start:       change.Reservation.Start,
+			End:         change.Reservation.End,
+			Description: change.Reservation.Description,
+		}
+		if change.Action == state.ActionCreate {
+			return services.Reservation.CreateReservation(reservation, userID, username, ipAddress)
+		}
+		existing, err := repos.Reservation.FindByID(change.ID)
+		if err != nil {
+			return err
+		}
+		reservation.CreatedAt = existing.CreatedAt
+		return services.Reservation.UpdateReservation(reservation, userID, username, ipAddress)
+
+	case state.KindGroup:
+		if change.Action == state.ActionDelete {
+			return services.Group.DeleteGroup(change.ID, 0, userID, username, ipAddress)
+		}
+		group := &models.Group{CreatedBy: username}
+		if change.Action == state.ActionUpdate {
+			existing, err := repos.Group.FindByID(change.ID)
+			if err != nil {
+				return err
+			}
+			group = existing
+		}
+		group.Groupname = change.Group.Groupname
+		group.UnixGID = change.Group.GID
+		group.Type = change.Group.Type
+		group.Description = change.Group.Description
+		group.Active = change.Group.IsActive()
+		if change.Action == state.ActionCreate {
+			if !change.Group.IsActive() {
+				return services.Group.CreateInactiveGroup(group, userID, username, ipAddress)
+			}
+			return services.Group.CreateGroup(group, userID, username, ipAddress)
+		}
+		return services.Group.UpdateGroup(group, userID, username, ipAddress)
+
+	case state.KindAccount:
+		if change.Action == state.ActionDelete {
+			return services.Account.DeleteAccount(change.ID, 0, userID, username, ipAddress)
+		}
+		account := &models.Account{}
+		if change.Action == state.ActionUpdate {
+			existing, err := repos.Account.FindByID(change.ID)
+			if err != nil {
+				return err
+			}
+			account = existing
+			account.PrimaryGroup = nil
+		}
+		var primaryGroupID uint
+		if change.Account.PrimaryGroup != "" {
+			group, err := repos.Group.FindByGroupname(change.Account.PrimaryGroup)
+			if err != nil {
+				return err
+			}
+			primaryGroupID = group.ID
+		}
+		account.Username = change.Account.Username
+		account.UnixUID = change.Account.UID
+		account.Type = change.Account.Type
+		account.PrimaryGroupID = primaryGroupID
+		account.Firstname = change.Account.Firstname
+		account.Surname = change.Account.Surname
+		account.Active = change.Account.IsActive()
+		if change.Action == state.ActionCreate {
+			if !change.Account.IsActive() {
+				return services.Account.CreateInactiveAccount(account, userID, username, ipAddress)
+			}
+			return services.Account.CreateAccount(account, userID, username, ipAddress)
+		}
+		return services.Account.UpdateAccount(account, userID, username, ipAddress)
+
+	case state.KindMembership:
+		account, err := repos.Account.FindByUsername(change.Membership.Account)
+		if err != nil {
+			return err
+		}
+		group, err := repos.Group.FindByGroupname(change.Membership.Group)
+		if err != nil {
+			return err
+		}
+		if change.Action == state.ActionDelete {
+			return services.Account.RemoveAccountFromGroup(account.ID, group.ID, userID, username, ipAddress)
+		}
+		return services.Account.AssignAccountToGroup(account.ID, group.ID, userID, username, ipAddress)
+	}
+
+	return fmt.Errorf("unsupported change kind: %s", change.Kind)
+}
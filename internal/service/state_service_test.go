@@ -0,0 +1,55 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/home/unixify/internal/models"
+	"github.com/home/unixify/internal/state"
+)
+
+func TestApplyCreatesInactiveRecordsInOneWrite(t *testing.T) {
+	services, repos := newSQLiteServices(t)
+
+	inactive := false
+	desired := &state.DesiredState{
+		Groups:   []state.GroupSpec{{Groupname: "alumni", GID: 1000, Type: models.GroupTypePeople, Active: &inactive}},
+		Accounts: []state.AccountSpec{{Username: "alice", UID: 1001, Type: models.AccountTypePeople, PrimaryGroup: "alumni", Active: &inactive}},
+	}
+	if _, err := services.State.Apply(desired, false, testUserID, testUsername, testIP); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+
+	group, err := services.Group.GetGroupByGroupname("alumni")
+	if err != nil || group.Active {
+		t.Fatalf("group = %+v, %v; want an inactive group", group, err)
+	}
+	account, err := services.Account.GetAccountByUsername("alice")
+	if err != nil || account.Active {
+		t.Fatalf("account = %+v, %v; want an inactive account", account, err)
+	}
+
+	// Each creation is one audit entry and one event, which show the record
+	// inactive
+	for _, entityType := range []string{"group", "account"} {
+		entries, err := repos.Audit.FindAll(entityType, "", 0, 0)
+		if err != nil || len(entries) != 1 || !strings.HasSuffix(entries[0].Details, ", inactive") {
+			t.Errorf("%s audit = %+v, %v", entityType, entries, err)
+		}
+	}
+	records, err := services.Event.GetEventsSince(0, 100)
+	if err != nil || len(records) != 2 {
+		t.Fatalf("events = %+v, %v; want two", records, err)
+	}
+	for _, record := range records {
+		if !strings.Contains(record.Payload, `"active":false`) {
+			t.Errorf("%s event = %s, want the record inactive", record.Type, record.Payload)
+		}
+	}
+
+	// The change feed carries them inactive too
+	changes, err := services.Change.GetChanges(0, 100)
+	if err != nil || len(changes.Accounts) != 1 || changes.Accounts[0].Active || len(changes.Groups) != 1 || changes.Groups[0].Active {
+		t.Errorf("changes = %+v, %v", changes, err)
+	}
+}
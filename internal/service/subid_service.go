@@ -0,0 +1,201 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/home/unixify/internal/models"
+	"github.com/home/unixify/internal/repository"
+	"github.com/home/unixify/internal/validator"
+)
+
+// SubIDBlockSize is the number of subordinate UIDs and GIDs each person gets,
+// enough for a full user namespace
+const SubIDBlockSize = 65536
+
+// SubIDPool is the inclusive range subordinate ID blocks are allocated from
+type SubIDPool struct {
+	Start int
+	End   int
+}
+
+// DefaultSubIDPool matches the SUB_UID_MIN and SUB_UID_MAX defaults of shadow-utils
+var DefaultSubIDPool = SubIDPool{Start: 100000, End: 600100000}
+
+// SubIDService allocates subordinate UID/GID blocks to people accounts and
+// exports them as /etc/subuid and /etc/subgid. Each account gets one block,
+// used for both files. Blocks never overlap each other or the account and
+// group ranges in validator.
+type SubIDService struct {
+	subIDRepo   repository.SubIDStore
+	accountRepo repository.AccountStore
+	auditRepo   repository.AuditStore
+	pool        SubIDPool
+}
+
+// NewSubIDService creates a new subordinate ID service; a zero pool uses DefaultSubIDPool
+func NewSubIDService(
+	subIDRepo repository.SubIDStore,
+	accountRepo repository.AccountStore,
+	auditRepo repository.AuditStore,
+	pool SubIDPool,
+) *SubIDService {
+	if pool == (SubIDPool{}) {
+		pool = DefaultSubIDPool
+	}
+	return &SubIDService{
+		subIDRepo:   subIDRepo,
+		accountRepo: accountRepo,
+		auditRepo:   auditRepo,
+		pool:        pool,
+	}
+}
+
+// GetSubIDRanges gets all blocks ordered by start
+func (s *SubIDService) GetSubIDRanges() ([]models.SubIDRange, error) {
+	return s.subIDRepo.FindAll()
+}
+
+// GetSubIDRange gets the block of an account
+func (s *SubIDService) GetSubIDRange(accountID uint) (*models.SubIDRange, error) {
+	return s.subIDRepo.FindByAccountID(accountID)
+}
+
+// nextFreeStart returns the first start in the pool where a block overlaps
+// neither a taken block nor a validator range
+func (s *SubIDService) nextFreeStart(taken []models.SubIDRange) (int, error) {
+	start := s.pool.Start
+	for start+SubIDBlockSize-1 <= s.pool.End {
+		end := start + SubIDBlockSize - 1
+		moved := false
+		if r, overlaps := validator.OverlappingRange(start, end); overlaps {
+			start, moved = r.Max+1, true
+		}
+		for _, block := range taken {
+			if !moved && start <= block.Start+block.Count-1 && end >= block.Start {
+				start, moved = block.Start+block.Count, true
+			}
+		}
+		if !moved {
+			return start, nil
+		}
+	}
+	return 0, fmt.Errorf("no free block of %d subordinate IDs left in %d-%d", SubIDBlockSize, s.pool.Start, s.pool.End)
+}
+
+// AllocateSubIDs gives a people account a block, or returns the one it has
+func (s *SubIDService) AllocateSubIDs(accountID uint, userID uint, username, ipAddress string) (*models.SubIDRange, error) {
+	account, err := s.accountRepo.FindByID(accountID)
+	if err != nil {
+		return nil, err
+	}
+	if account.Type != models.AccountTypePeople {
+		return nil, fmt.Errorf("only people accounts get subordinate IDs, %s is a %s account", account.Username, account.Type)
+	}
+	if block, err := s.subIDRepo.FindByAccountID(accountID); err == nil {
+		return block, nil
+	}
+
+	// Take the first free block
+	taken, err := s.subIDRepo.FindAll()
+	if err != nil {
+		return nil, err
+	}
+	start, err := s.nextFreeStart(taken)
+	if err != nil {
+		return nil, err
+	}
+	block := &models.SubIDRange{AccountID: accountID, Start: start, Count: SubIDBlockSize}
+	if err := s.subIDRepo.Create(block); err != nil {
+		return nil, err
+	}
+
+	// Log audit entry
+	auditEntry := &models.AuditEntry{
+		Action:     "create",
+		EntityID:   accountID,
+		EntityType: "subid",
+		Details:    fmt.Sprintf("Allocated subordinate IDs %d-%d to account %s", block.Start, block.Start+block.Count-1, account.Username),
+		UserID:     userID,
+		Username:   username,
+		IPAddress:  ipAddress,
+		Timestamp:  time.Now(),
+	}
+	if err := s.auditRepo.Create(auditEntry); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+// AllocateMissingSubIDs gives a block to every people account without one and
+// returns the new blocks
+func (s *SubIDService) AllocateMissingSubIDs(userID uint, username, ipAddress string) ([]models.SubIDRange, error) {
+	accounts, err := s.accountRepo.FindAll(models.AccountTypePeople)
+	if err != nil {
+		return nil, err
+	}
+	allocated := []models.SubIDRange{}
+	for _, account := range accounts {
+		if _, err := s.subIDRepo.FindByAccountID(account.ID); err == nil {
+			continue
+		}
+		block, err := s.AllocateSubIDs(account.ID, userID, username, ipAddress)
+		if err != nil {
+			return allocated, err
+		}
+		allocated = append(allocated, *block)
+	}
+	return allocated, nil
+}
+
+// ReleaseSubIDs frees the block of an account. Blocks are kept when accounts
+// are deleted, so this is how the IDs are handed out again.
+func (s *SubIDService) ReleaseSubIDs(accountID uint, userID uint, username, ipAddress string) error {
+	block, err := s.subIDRepo.FindByAccountID(accountID)
+	if err != nil {
+		return err
+	}
+	if err := s.subIDRepo.DeleteByAccountID(accountID); err != nil {
+		return err
+	}
+
+	// Log audit entry
+	auditEntry := &models.AuditEntry{
+		Action:     "delete",
+		EntityID:   accountID,
+		EntityType: "subid",
+		Details:    fmt.Sprintf("Released subordinate IDs %d-%d of account ID %d", block.Start, block.Start+block.Count-1, accountID),
+		UserID:     userID,
+		Username:   username,
+		IPAddress:  ipAddress,
+		Timestamp:  time.Now(),
+	}
+	return s.auditRepo.Create(auditEntry)
+}
+
+// ExportSubIDs returns the blocks in /etc/subuid format, which /etc/subgid
+// shares: username:start:count, ordered by start. Blocks of deleted accounts
+// are left out.
+func (s *SubIDService) ExportSubIDs() ([]byte, error) {
+	blocks, err := s.subIDRepo.FindAll()
+	if err != nil {
+		return nil, err
+	}
+	accounts, err := s.accountRepo.FindAll("")
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[uint]string, len(accounts))
+	for _, account := range accounts {
+		names[account.ID] = account.Username
+	}
+
+	var buf bytes.Buffer
+	for _, block := range blocks {
+		if name, ok := names[block.AccountID]; ok {
+			fmt.Fprintf(&buf, "%s:%d:%d\n", name, block.Start, block.Count)
+		}
+	}
+	return buf.Bytes(), nil
+}
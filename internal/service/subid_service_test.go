@@ -0,0 +1,104 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/home/unixify/internal/models"
+)
+
+func TestSubIDAllocation(t *testing.T) {
+	services, repos := newTestServices(t)
+
+	// People accounts get a block when they are created; others do not
+	alice := mustCreateAccount(t, services, "alice", 1001, models.AccountTypePeople, 0)
+	bob := mustCreateAccount(t, services, "bob", 1002, models.AccountTypePeople, 0)
+	svc := mustCreateAccount(t, services, "backups", 60010, models.AccountTypeService, 0)
+	_, err := services.SubID.AllocateSubIDs(svc.ID, testUserID, testUsername, testIP)
+	expectError(t, err, "only people accounts")
+
+	data, err := services.SubID.ExportSubIDs()
+	if err != nil {
+		t.Fatalf("ExportSubIDs: %v", err)
+	}
+	if want := "alice:100000:65536\nbob:165536:65536\n"; string(data) != want {
+		t.Errorf("subuid:\n%s\nwant:\n%s", data, want)
+	}
+
+	// A released block is handed out again; allocating twice keeps the block
+	if err := services.SubID.ReleaseSubIDs(alice.ID, testUserID, testUsername, testIP); err != nil {
+		t.Fatalf("ReleaseSubIDs: %v", err)
+	}
+	carol := mustCreateAccount(t, services, "carol", 1003, models.AccountTypePeople, 0)
+	if block, err := services.SubID.GetSubIDRange(carol.ID); err != nil || block.Start != 100000 {
+		t.Errorf("carol got %+v, %v", block, err)
+	}
+	allocated, err := services.SubID.AllocateMissingSubIDs(testUserID, testUsername, testIP)
+	if err != nil || len(allocated) != 1 || allocated[0].AccountID != alice.ID || allocated[0].Start != 231072 {
+		t.Errorf("AllocateMissingSubIDs = %+v, %v", allocated, err)
+	}
+	if block, err := services.SubID.AllocateSubIDs(bob.ID, testUserID, testUsername, testIP); err != nil || block.Start != 165536 {
+		t.Errorf("bob's block moved: %+v, %v", block, err)
+	}
+
+	// Deleted accounts keep their block but leave the export
+	if err := services.Account.DeleteAccount(bob.ID, 0, testUserID, testUsername, testIP); err != nil {
+		t.Fatalf("DeleteAccount: %v", err)
+	}
+	data, _ = services.SubID.ExportSubIDs()
+	if want := "carol:100000:65536\nalice:231072:65536\n"; string(data) != want {
+		t.Errorf("subuid after delete:\n%s\nwant:\n%s", data, want)
+	}
+	if blocks, _ := services.SubID.GetSubIDRanges(); len(blocks) != 3 {
+		t.Errorf("expected 3 blocks, got %+v", blocks)
+	}
+	if got := strings.Join(auditActions(t, repos, "subid"), ","); got != "create,create,delete,create,create" {
+		t.Errorf("audit actions = %s", got)
+	}
+
+	// Blocks skip the validator ranges and stop at the end of the pool
+	subIDs := NewSubIDService(repos.SubID, repos.Account, repos.Audit, SubIDPool{Start: 1, End: 80000 + 2*SubIDBlockSize - 1})
+	start, err := subIDs.nextFreeStart(nil)
+	if err != nil || start != 80000 {
+		t.Errorf("nextFreeStart = %d, %v; want 80000", start, err)
+	}
+	_, err = subIDs.nextFreeStart([]models.SubIDRange{{Start: 80000, Count: SubIDBlockSize}, {Start: 80000 + SubIDBlockSize, Count: SubIDBlockSize}})
+	expectError(t, err, "no free block")
+}
+
+func TestSubIDAllocationFailureRollsBackTheAccount(t *testing.T) {
+	services, repos := newSQLiteServices(t)
+	// Room for a single block
+	services.Account.deps.SubIDs = SubIDPool{Start: 100000, End: 100000 + SubIDBlockSize - 1}
+
+	mustCreateAccount(t, services, "alice", 1001, models.AccountTypePeople, 0)
+	bob := &models.Account{Username: "bob", UnixUID: 1002, Type: models.AccountTypePeople}
+	err := services.Account.CreateAccount(bob, testUserID, testUsername, testIP)
+	expectError(t, err, "failed to allocate subordinate IDs to account bob")
+	if _, err := services.Account.GetAccountByUsername("bob"); err == nil {
+		t.Error("account bob was saved without subordinate IDs")
+	}
+
+	// A service account needs no block, and cannot become a people account
+	// without one
+	builds := mustCreateAccount(t, services, "builds", 60001, models.AccountTypeService, 0)
+	builds.Type = models.AccountTypePeople
+	builds.UnixUID = 1003
+	err = services.Account.UpdateAccount(builds, testUserID, testUsername, testIP)
+	expectError(t, err, "failed to allocate subordinate IDs to account builds")
+	if account, _ := services.Account.GetAccount(builds.ID); account.Type != models.AccountTypeService {
+		t.Errorf("builds type = %s, want the change rolled back", account.Type)
+	}
+
+	// Once a block is free, creating bob again works
+	if err := services.SubID.ReleaseSubIDs(1, testUserID, testUsername, testIP); err != nil {
+		t.Fatalf("ReleaseSubIDs: %v", err)
+	}
+	bob.ID = 0
+	if err := services.Account.CreateAccount(bob, testUserID, testUsername, testIP); err != nil {
+		t.Fatalf("CreateAccount(bob) after a block was freed: %v", err)
+	}
+	if got := strings.Join(auditActions(t, repos, "account"), ","); got != "create,create,create" {
+		t.Errorf("account audit = %s", got)
+	}
+}
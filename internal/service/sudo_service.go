@@ -0,0 +1,393 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/home/unixify/internal/ldif"
+	"github.com/home/unixify/internal/models"
+	"github.com/home/unixify/internal/repository"
+	"github.com/home/unixify/internal/sudoers"
+)
+
+// DefaultSudoBaseDN is where the LDIF export puts sudo rules unless told otherwise
+const DefaultSudoBaseDN = "ou=SUDOers,dc=example,dc=com"
+
+// sudoersHeader starts every exported sudoers file
+const sudoersHeader = "# Managed by Unixify; local changes are overwritten\n"
+
+// sudoRuleNameRe matches names sudo reads from sudoers.d, which skips files
+// with a dot or ending in ~
+var sudoRuleNameRe = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// SudoService manages sudo rules and exports them as sudoers.d files and LDAP
+// sudoRole entries. Changes are audited and published like account changes.
+type SudoService struct {
+	sudoRepo    repository.SudoStore
+	accountRepo repository.AccountStore
+	groupRepo   repository.GroupStore
+	auditRepo   repository.AuditStore
+	events      EventPublisher
+	deps        Deps // What writes build their transaction's services from
+}
+
+// NewSudoService creates a new sudo rule service
+func NewSudoService(
+	sudoRepo repository.SudoStore,
+	accountRepo repository.AccountStore,
+	groupRepo repository.GroupStore,
+	auditRepo repository.AuditStore,
+	events EventPublisher,
+) *SudoService {
+	return &SudoService{
+		sudoRepo:    sudoRepo,
+		accountRepo: accountRepo,
+		groupRepo:   groupRepo,
+		auditRepo:   auditRepo,
+		events:      events,
+	}
+}
+
+// transaction runs fn on the sudo rule service of a transaction, so a change, its
+// audit entry and its events are saved together; see transaction
+func (s *SudoService) transaction(fn func(tx *SudoService) error) error {
+	if s.deps.DB == nil {
+		return fn(s) // In-memory repositories have no transactions
+	}
+	return transaction(s.deps, func(tx *Services) error {
+		return fn(tx.Sudo)
+	})
+}
+
+// sudoUser returns the sudoers name of the group or account a rule is granted
+// to: %group or the username
+func (s *SudoService) sudoUser(rule *models.SudoRule) (string, error) {
+	if rule.GroupID != 0 {
+		group, err := s.groupRepo.FindByID(rule.GroupID)
+		if err != nil {
+			return "", fmt.Errorf("group with ID %d not found", rule.GroupID)
+		}
+		return "%" + group.Groupname, nil
+	}
+	account, err := s.accountRepo.FindByID(rule.AccountID)
+	if err != nil {
+		return "", fmt.Errorf("account with ID %d not found", rule.AccountID)
+	}
+	return account.Username, nil
+}
+
+// sudoersLine formats a rule as a sudoers user specification
+func sudoersLine(rule *models.SudoRule, user string) string {
+	hosts := "ALL"
+	if len(rule.Hosts) > 0 {
+		hosts = strings.Join(rule.Hosts, ",")
+	}
+	line := user + " " + hosts + " = "
+	if len(rule.RunAsUsers) > 0 || len(rule.RunAsGroups) > 0 {
+		line += "(" + strings.Join(rule.RunAsUsers, ",")
+		if len(rule.RunAsGroups) > 0 {
+			line += ":" + strings.Join(rule.RunAsGroups, ",")
+		}
+		line += ") "
+	}
+	if rule.NoPasswd {
+		line += "NOPASSWD: "
+	}
+	return line + strings.Join(rule.Commands, ", ")
+}
+
+// sudoersComment formats a rule's name and description as a comment line
+func sudoersComment(rule *models.SudoRule) string {
+	comment := "# " + rule.Name
+	if rule.Description != "" {
+		comment += ": " + strings.Join(strings.Fields(rule.Description), " ")
+	}
+	return comment + "\n"
+}
+
+// validateSudoRule checks a rule's fields, that it names exactly one existing
+// group or account, and that its sudoers line passes the syntax check
+func (s *SudoService) validateSudoRule(rule *models.SudoRule) error {
+	if !sudoRuleNameRe.MatchString(rule.Name) {
+		return fmt.Errorf("invalid sudo rule name %q: use up to 64 letters, digits, - and _", rule.Name)
+	}
+	if rule.GroupID != 0 && rule.AccountID != 0 {
+		return fmt.Errorf("a sudo rule is granted to either a group or an account, not both")
+	}
+	if rule.GroupID == 0 && rule.AccountID == 0 {
+		return fmt.Errorf("a sudo rule must be granted to a group or an account")
+	}
+	for _, host := range rule.Hosts {
+		if !sudoers.ValidHost(host) {
+			return fmt.Errorf("invalid host %q", host)
+		}
+	}
+	for _, user := range rule.RunAsUsers {
+		if !sudoers.ValidUser(user) {
+			return fmt.Errorf("invalid runas user %q", user)
+		}
+	}
+	for _, group := range rule.RunAsGroups {
+		if !sudoers.ValidRunasGroup(group) {
+			return fmt.Errorf("invalid runas group %q", group)
+		}
+	}
+	if len(rule.Commands) == 0 {
+		return fmt.Errorf("a sudo rule needs at least one command")
+	}
+	for _, command := range rule.Commands {
+		if !sudoers.ValidCommand(command) {
+			return fmt.Errorf("invalid command %q: use ALL or an absolute path, and no , : = \\ ( ) # or quotes in arguments", command)
+		}
+	}
+
+	user, err := s.sudoUser(rule)
+	if err != nil {
+		return err
+	}
+	if err := sudoers.Check([]byte(sudoersLine(rule, user) + "\n")); err != nil {
+		return fmt.Errorf("sudo rule does not pass the sudoers syntax check: %w", err)
+	}
+	return nil
+}
+
+// normalizeSudoRule stores empty lists as [] rather than null
+func normalizeSudoRule(rule *models.SudoRule) {
+	for _, list := range []*[]string{&rule.Hosts, &rule.RunAsUsers, &rule.RunAsGroups, &rule.Commands} {
+		if *list == nil {
+			*list = []string{}
+		}
+	}
+}
+
+// eventSudoRule copies a sudo rule for an event
+func eventSudoRule(rule *models.SudoRule) *models.SudoRule {
+	copied := *rule
+	return &copied
+}
+
+// CreateSudoRule creates a new sudo rule
+func (s *SudoService) CreateSudoRule(rule *models.SudoRule, userID uint, username, ipAddress string) error {
+	return s.transaction(func(tx *SudoService) error {
+		return tx.createSudoRule(rule, userID, username, ipAddress)
+	})
+}
+
+// createSudoRule does the work of CreateSudoRule inside its transaction
+func (s *SudoService) createSudoRule(rule *models.SudoRule, userID uint, username, ipAddress string) error {
+	if err := s.validateSudoRule(rule); err != nil {
+		return err
+	}
+	normalizeSudoRule(rule)
+	user, _ := s.sudoUser(rule)
+
+	// Create rule
+	err := s.sudoRepo.Create(rule)
+	if err != nil {
+		return err
+	}
+
+	// Log audit entry
+	auditEntry := &models.AuditEntry{
+		Action:     "create",
+		EntityID:   rule.ID,
+		EntityType: "sudo_rule",
+		Details:    fmt.Sprintf("Created sudo rule %s: %s", rule.Name, sudoersLine(rule, user)),
+		UserID:     userID,
+		Username:   username,
+		IPAddress:  ipAddress,
+		Timestamp:  time.Now(),
+	}
+	if err := s.auditRepo.Create(auditEntry); err != nil {
+		return err
+	}
+	return s.events.Publish(newEvent(models.EventSudoRuleCreated, "", auditEntry, nil, eventSudoRule(rule)))
+}
+
+// GetSudoRule gets a sudo rule by ID
+func (s *SudoService) GetSudoRule(id uint) (*models.SudoRule, error) {
+	return s.sudoRepo.FindByID(id)
+}
+
+// GetAllSudoRules gets all sudo rules
+func (s *SudoService) GetAllSudoRules() ([]models.SudoRule, error) {
+	return s.sudoRepo.FindAll()
+}
+
+// UpdateSudoRule updates a sudo rule
+func (s *SudoService) UpdateSudoRule(rule *models.SudoRule, userID uint, username, ipAddress string) error {
+	return s.transaction(func(tx *SudoService) error {
+		return tx.updateSudoRule(rule, userID, username, ipAddress)
+	})
+}
+
+// updateSudoRule does the work of UpdateSudoRule inside its transaction
+func (s *SudoService) updateSudoRule(rule *models.SudoRule, userID uint, username, ipAddress string) error {
+	original, err := s.sudoRepo.FindByID(rule.ID)
+	if err != nil {
+		return err
+	}
+	if err := s.validateSudoRule(rule); err != nil {
+		return err
+	}
+	normalizeSudoRule(rule)
+	rule.CreatedAt = original.CreatedAt
+	user, _ := s.sudoUser(rule)
+
+	// Update rule
+	err = s.sudoRepo.Update(rule)
+	if err != nil {
+		return err
+	}
+
+	// Log audit entry
+	auditEntry := &models.AuditEntry{
+		Action:     "update",
+		EntityID:   rule.ID,
+		EntityType: "sudo_rule",
+		Details:    fmt.Sprintf("Updated sudo rule %s: %s", rule.Name, sudoersLine(rule, user)),
+		UserID:     userID,
+		Username:   username,
+		IPAddress:  ipAddress,
+		Timestamp:  time.Now(),
+	}
+	if err := s.auditRepo.Create(auditEntry); err != nil {
+		return err
+	}
+	return s.events.Publish(newEvent(models.EventSudoRuleUpdated, "", auditEntry, original, eventSudoRule(rule)))
+}
+
+// DeleteSudoRule deletes a sudo rule
+func (s *SudoService) DeleteSudoRule(id uint, userID uint, username, ipAddress string) error {
+	return s.transaction(func(tx *SudoService) error {
+		return tx.deleteSudoRule(id, userID, username, ipAddress)
+	})
+}
+
+// deleteSudoRule does the work of DeleteSudoRule inside its transaction
+func (s *SudoService) deleteSudoRule(id uint, userID uint, username, ipAddress string) error {
+	// Get rule to record it in audit
+	rule, err := s.sudoRepo.FindByID(id)
+	if err != nil {
+		return err
+	}
+
+	// Delete rule
+	err = s.sudoRepo.Delete(id)
+	if err != nil {
+		return err
+	}
+
+	// Log audit entry
+	auditEntry := &models.AuditEntry{
+		Action:     "delete",
+		EntityID:   id,
+		EntityType: "sudo_rule",
+		Details:    fmt.Sprintf("Deleted sudo rule %s", rule.Name),
+		UserID:     userID,
+		Username:   username,
+		IPAddress:  ipAddress,
+		Timestamp:  time.Now(),
+	}
+	if err := s.auditRepo.Create(auditEntry); err != nil {
+		return err
+	}
+	return s.events.Publish(newEvent(models.EventSudoRuleDeleted, "", auditEntry, rule, nil))
+}
+
+// writeSudoers appends a rule to a sudoers file. Rules whose group or
+// account is gone are left out with a comment.
+func (s *SudoService) writeSudoers(buf *bytes.Buffer, rule *models.SudoRule) {
+	buf.WriteString(sudoersComment(rule))
+	user, err := s.sudoUser(rule)
+	if err != nil {
+		fmt.Fprintf(buf, "# Skipped: %v\n", err)
+		return
+	}
+	buf.WriteString(sudoersLine(rule, user) + "\n")
+}
+
+// checkedSudoers runs the built-in syntax check on an exported file
+func checkedSudoers(data []byte) ([]byte, error) {
+	if err := sudoers.Check(data); err != nil {
+		return nil, fmt.Errorf("exported sudoers file does not pass the syntax check: %w", err)
+	}
+	return data, nil
+}
+
+// ExportSudoersFile returns all sudo rules as one sudoers.d file
+func (s *SudoService) ExportSudoersFile() ([]byte, error) {
+	rules, err := s.sudoRepo.FindAll()
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.WriteString(sudoersHeader)
+	for i := range rules {
+		buf.WriteString("\n")
+		s.writeSudoers(&buf, &rules[i])
+	}
+	return checkedSudoers(buf.Bytes())
+}
+
+// ExportSudoersRule returns a sudo rule as its own sudoers.d file, named
+// after the rule
+func (s *SudoService) ExportSudoersRule(id uint) ([]byte, error) {
+	rule, err := s.sudoRepo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.WriteString(sudoersHeader)
+	s.writeSudoers(&buf, rule)
+	return checkedSudoers(buf.Bytes())
+}
+
+// ExportSudoLDIF returns all sudo rules as sudoRole entries below baseDN, in
+// the schema shipped with sudo. Rules whose group or account is gone are left out.
+func (s *SudoService) ExportSudoLDIF(baseDN string) ([]byte, error) {
+	if baseDN == "" {
+		baseDN = DefaultSudoBaseDN
+	}
+	rules, err := s.sudoRepo.FindAll()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]ldif.Entry, 0, len(rules))
+	for i := range rules {
+		rule := &rules[i]
+		user, err := s.sudoUser(rule)
+		if err != nil {
+			continue
+		}
+		entry := ldif.Entry{DN: "cn=" + ldif.EscapeDN(rule.Name) + "," + baseDN}
+		entry.Add("objectClass", "top", "sudoRole")
+		entry.Add("cn", rule.Name)
+		if rule.Description != "" {
+			entry.Add("description", rule.Description)
+		}
+		entry.Add("sudoUser", user)
+		if len(rule.Hosts) == 0 {
+			entry.Add("sudoHost", "ALL")
+		}
+		entry.Add("sudoHost", rule.Hosts...)
+		entry.Add("sudoRunAsUser", rule.RunAsUsers...)
+		entry.Add("sudoRunAsGroup", rule.RunAsGroups...)
+		entry.Add("sudoCommand", rule.Commands...)
+		if rule.NoPasswd {
+			entry.Add("sudoOption", "!authenticate")
+		}
+		entry.Add("sudoOrder", fmt.Sprint(rule.ID))
+		entries = append(entries, entry)
+	}
+
+	var buf bytes.Buffer
+	if err := ldif.Write(&buf, entries); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
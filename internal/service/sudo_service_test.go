@@ -0,0 +1,110 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/home/unixify/internal/models"
+)
+
+func TestSudoRulesExportAndAudit(t *testing.T) {
+	services, repos := newTestServices(t)
+	dba := mustCreateGroup(t, services, "dba", 1001, models.GroupTypePeople)
+	alice := mustCreateAccount(t, services, "alice", 1001, models.AccountTypePeople, 0)
+
+	restart := &models.SudoRule{
+		Name:        "dba-restart",
+		Description: "Restart the database",
+		GroupID:     dba.ID,
+		Hosts:       []string{"db1", "+databases"},
+		RunAsUsers:  []string{"root"},
+		Commands:    []string{"/usr/bin/systemctl restart postgresql"},
+		NoPasswd:    true,
+	}
+	logs := &models.SudoRule{Name: "alice-logs", AccountID: alice.ID, RunAsGroups: []string{"adm"}, Commands: []string{"/usr/bin/journalctl"}}
+	for _, rule := range []*models.SudoRule{restart, logs} {
+		if err := services.Sudo.CreateSudoRule(rule, testUserID, testUsername, testIP); err != nil {
+			t.Fatalf("CreateSudoRule(%s): %v", rule.Name, err)
+		}
+	}
+
+	// Invalid rules are rejected before anything is stored
+	invalid := []struct {
+		rule models.SudoRule
+		want string
+	}{
+		{models.SudoRule{Name: "a.b", GroupID: dba.ID, Commands: []string{"ALL"}}, "invalid sudo rule name"},
+		{models.SudoRule{Name: "both", GroupID: dba.ID, AccountID: alice.ID, Commands: []string{"ALL"}}, "not both"},
+		{models.SudoRule{Name: "nobody", Commands: []string{"ALL"}}, "must be granted"},
+		{models.SudoRule{Name: "gone", GroupID: 999, Commands: []string{"ALL"}}, "group with ID 999 not found"},
+		{models.SudoRule{Name: "relative", GroupID: dba.ID, Commands: []string{"vi"}}, "invalid command"},
+		{models.SudoRule{Name: "escape", GroupID: dba.ID, Commands: []string{"/bin/sh -c a=b"}}, "invalid command"},
+		{models.SudoRule{Name: "empty", GroupID: dba.ID}, "at least one command"},
+		{models.SudoRule{Name: "host", GroupID: dba.ID, Hosts: []string{"db 1"}, Commands: []string{"ALL"}}, "invalid host"},
+	}
+	for _, tt := range invalid {
+		rule := tt.rule
+		expectError(t, services.Sudo.CreateSudoRule(&rule, testUserID, testUsername, testIP), tt.want)
+	}
+
+	file, err := services.Sudo.ExportSudoersFile()
+	if err != nil {
+		t.Fatalf("ExportSudoersFile: %v", err)
+	}
+	want := "# Managed by Unixify; local changes are overwritten\n" +
+		"\n# alice-logs\nalice ALL = (:adm) /usr/bin/journalctl\n" +
+		"\n# dba-restart: Restart the database\n%dba db1,+databases = (root) NOPASSWD: /usr/bin/systemctl restart postgresql\n"
+	if string(file) != want {
+		t.Errorf("sudoers file:\n%s\nwant:\n%s", file, want)
+	}
+
+	data, err := services.Sudo.ExportSudoLDIF("")
+	if err != nil {
+		t.Fatalf("ExportSudoLDIF: %v", err)
+	}
+	wantEntry := "dn: cn=dba-restart,ou=SUDOers,dc=example,dc=com\nobjectClass: top\nobjectClass: sudoRole\ncn: dba-restart\n" +
+		"description: Restart the database\nsudoUser: %dba\nsudoHost: db1\nsudoHost: +databases\nsudoRunAsUser: root\n" +
+		"sudoCommand: /usr/bin/systemctl restart postgresql\nsudoOption: !authenticate\nsudoOrder: 1\n"
+	if !strings.Contains(string(data), wantEntry) {
+		t.Errorf("LDIF export is missing\n%s\ngot:\n%s", wantEntry, data)
+	}
+
+	// Renaming the group changes the export; deleting it leaves the rule out
+	dba.Groupname = "dbadmins"
+	if err := services.Group.UpdateGroup(dba, testUserID, testUsername, testIP); err != nil {
+		t.Fatalf("UpdateGroup: %v", err)
+	}
+	if file, _ := services.Sudo.ExportSudoersRule(restart.ID); !strings.Contains(string(file), "\n%dbadmins db1") {
+		t.Errorf("renamed group not exported:\n%s", file)
+	}
+	if err := services.Group.DeleteGroup(dba.ID, 0, testUserID, testUsername, testIP); err != nil {
+		t.Fatalf("DeleteGroup: %v", err)
+	}
+	if file, err := services.Sudo.ExportSudoersFile(); err != nil || !strings.Contains(string(file), "# Skipped: group with ID") {
+		t.Errorf("rule of deleted group: %v\n%s", err, file)
+	}
+
+	logs.NoPasswd = true
+	if err := services.Sudo.UpdateSudoRule(logs, testUserID, testUsername, testIP); err != nil {
+		t.Fatalf("UpdateSudoRule: %v", err)
+	}
+	if err := services.Sudo.DeleteSudoRule(restart.ID, testUserID, testUsername, testIP); err != nil {
+		t.Fatalf("DeleteSudoRule: %v", err)
+	}
+	if got := strings.Join(auditActions(t, repos, "sudo_rule"), ","); got != "create,create,update,delete" {
+		t.Errorf("sudo rule audit = %s", got)
+	}
+	events, err := services.Event.GetEventsSince(0, 100)
+	if err != nil {
+		t.Fatalf("GetEventsSince: %v", err)
+	}
+	var types []string
+	for _, event := range events {
+		if strings.HasPrefix(event.Type, "sudo_rule.") {
+			types = append(types, event.Type)
+		}
+	}
+	if got := strings.Join(types, ","); got != "sudo_rule.created,sudo_rule.created,sudo_rule.updated,sudo_rule.deleted" {
+		t.Errorf("sudo rule events = %s", got)
+	}
+}
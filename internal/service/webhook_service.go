@@ -0,0 +1,232 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/home/unixify/internal/models"
+	"github.com/home/unixify/internal/repository"
+	"github.com/home/unixify/internal/webhook"
+)
+
+// WebhookService manages webhook subscriptions and queues a delivery for every
+// registry event a subscription wants. Deliveries are written with the same
+// repositories as the change itself, so they commit or roll back with it.
+type WebhookService struct {
+	webhookRepo repository.WebhookStore
+	auditRepo   repository.AuditStore
+	targets     webhook.TargetPolicy
+}
+
+// NewWebhookService creates a new webhook service
+func NewWebhookService(
+	webhookRepo repository.WebhookStore,
+	auditRepo repository.AuditStore,
+) *WebhookService {
+	return &WebhookService{
+		webhookRepo: webhookRepo,
+		auditRepo:   auditRepo,
+	}
+}
+
+// CreateWebhook creates a new webhook. A secret is generated when none is given.
+func (s *WebhookService) CreateWebhook(webhook *models.Webhook, userID uint, username, ipAddress string) error {
+	if err := s.validateWebhook(webhook); err != nil {
+		return err
+	}
+	if webhook.Secret == "" {
+		secret, err := generateWebhookSecret()
+		if err != nil {
+			return err
+		}
+		webhook.Secret = secret
+	}
+
+	// Create webhook
+	err := s.webhookRepo.Create(webhook)
+	if err != nil {
+		return err
+	}
+
+	// Log audit entry
+	auditEntry := &models.AuditEntry{
+		Action:     "create",
+		EntityID:   webhook.ID,
+		EntityType: "webhook",
+		Details:    fmt.Sprintf("Created webhook %s for %s", webhook.Name, webhook.URL),
+		UserID:     userID,
+		Username:   username,
+		IPAddress:  ipAddress,
+		Timestamp:  time.Now(),
+	}
+	return s.auditRepo.Create(auditEntry)
+}
+
+// GetWebhook gets a webhook by ID
+func (s *WebhookService) GetWebhook(id uint) (*models.Webhook, error) {
+	return s.webhookRepo.FindByID(id)
+}
+
+// GetAllWebhooks gets all webhooks
+func (s *WebhookService) GetAllWebhooks() ([]models.Webhook, error) {
+	return s.webhookRepo.FindAll()
+}
+
+// UpdateWebhook updates a webhook
+func (s *WebhookService) UpdateWebhook(webhook *models.Webhook, userID uint, username, ipAddress string) error {
+	if err := s.validateWebhook(webhook); err != nil {
+		return err
+	}
+
+	// Update webhook
+	err := s.webhookRepo.Update(webhook)
+	if err != nil {
+		return err
+	}
+
+	// Log audit entry
+	auditEntry := &models.AuditEntry{
+		Action:     "update",
+		EntityID:   webhook.ID,
+		EntityType: "webhook",
+		Details:    fmt.Sprintf("Updated webhook %s for %s", webhook.Name, webhook.URL),
+		UserID:     userID,
+		Username:   username,
+		IPAddress:  ipAddress,
+		Timestamp:  time.Now(),
+	}
+	return s.auditRepo.Create(auditEntry)
+}
+
+// DeleteWebhook deletes a webhook and its delivery log
+func (s *WebhookService) DeleteWebhook(id uint, userID uint, username, ipAddress string) error {
+	// Get webhook to record its name in audit
+	webhook, err := s.webhookRepo.FindByID(id)
+	if err != nil {
+		return err
+	}
+
+	// Delete webhook
+	err = s.webhookRepo.Delete(id)
+	if err != nil {
+		return err
+	}
+
+	// Log audit entry
+	auditEntry := &models.AuditEntry{
+		Action:     "delete",
+		EntityID:   id,
+		EntityType: "webhook",
+		Details:    fmt.Sprintf("Deleted webhook %s for %s", webhook.Name, webhook.URL),
+		UserID:     userID,
+		Username:   username,
+		IPAddress:  ipAddress,
+		Timestamp:  time.Now(),
+	}
+	return s.auditRepo.Create(auditEntry)
+}
+
+// GetDeliveries gets the delivery log of a webhook, newest first
+func (s *WebhookService) GetDeliveries(webhookID uint, status string, limit int) ([]models.WebhookDelivery, error) {
+	switch status {
+	case "", models.DeliveryPending, models.DeliveryDelivered, models.DeliveryFailed:
+	default:
+		return nil, fmt.Errorf("invalid delivery status %q", status)
+	}
+	return s.webhookRepo.FindDeliveries(webhookID, status, limit)
+}
+
+// Publish queues a delivery of the event for every active webhook that wants it
+func (s *WebhookService) Publish(event *models.Event) error {
+	webhooks, err := s.webhookRepo.FindActive()
+	if err != nil {
+		return fmt.Errorf("failed to load webhooks: %w", err)
+	}
+
+	var payload []byte
+	for _, webhook := range webhooks {
+		if !webhookWants(&webhook, event.Type) {
+			continue
+		}
+		if payload == nil {
+			if payload, err = json.Marshal(event); err != nil {
+				return fmt.Errorf("failed to encode event: %w", err)
+			}
+		}
+		delivery := &models.WebhookDelivery{
+			WebhookID:     webhook.ID,
+			EventID:       event.ID,
+			EventType:     event.Type,
+			Payload:       string(payload),
+			Status:        models.DeliveryPending,
+			NextAttemptAt: time.Now().UTC(),
+		}
+		if err := s.webhookRepo.CreateDelivery(delivery); err != nil {
+			return fmt.Errorf("failed to queue webhook delivery: %w", err)
+		}
+	}
+	return nil
+}
+
+// webhookWants reports whether a webhook subscribes to an event type
+func webhookWants(webhook *models.Webhook, eventType string) bool {
+	if len(webhook.EventTypes) == 0 {
+		return true
+	}
+	for _, pattern := range webhook.EventTypes {
+		if eventPatternMatches(pattern, eventType) {
+			return true
+		}
+	}
+	return false
+}
+
+// eventPatternMatches reports whether an event type filter matches an event type.
+// Filters match exactly, by prefix when they end in ".*", and "*" matches all.
+func eventPatternMatches(pattern, eventType string) bool {
+	if pattern == "*" || pattern == eventType {
+		return true
+	}
+	return strings.HasSuffix(pattern, ".*") && strings.HasPrefix(eventType, strings.TrimSuffix(pattern, "*"))
+}
+
+// validateWebhook checks the name, the URL and the event type filters
+func (s *WebhookService) validateWebhook(webhook *models.Webhook) error {
+	if strings.TrimSpace(webhook.Name) == "" {
+		return fmt.Errorf("webhook name is required")
+	}
+
+	if err := s.targets.CheckURL(webhook.URL); err != nil {
+		return err
+	}
+
+	for _, pattern := range webhook.EventTypes {
+		if !validEventPattern(pattern) {
+			return fmt.Errorf("unknown event type %q", pattern)
+		}
+	}
+	return nil
+}
+
+// validEventPattern reports whether an event type filter can match anything
+func validEventPattern(pattern string) bool {
+	for _, eventType := range models.EventTypes {
+		if eventPatternMatches(pattern, eventType) {
+			return true
+		}
+	}
+	return false
+}
+
+// generateWebhookSecret returns a random key for signing payloads
+func generateWebhookSecret() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	return hex.EncodeToString(key), nil
+}
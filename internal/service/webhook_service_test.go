@@ -0,0 +1,188 @@
+package service
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/home/unixify/internal/models"
+)
+
+func TestCreateWebhookRules(t *testing.T) {
+	services, _ := newTestServices(t)
+
+	tests := []struct {
+		name    string
+		webhook models.Webhook
+		wantErr string
+	}{
+		{
+			name:    "missing name",
+			webhook: models.Webhook{URL: "https://example.com/hook"},
+			wantErr: "webhook name is required",
+		},
+		{
+			name:    "relative URL",
+			webhook: models.Webhook{Name: "ticketing", URL: "/hook"},
+			wantErr: "absolute http or https URL",
+		},
+		{
+			name:    "loopback address",
+			webhook: models.Webhook{Name: "ticketing", URL: "http://127.0.0.1:8080/hook"},
+			wantErr: "loopback, link-local or private address",
+		},
+		{
+			name:    "localhost",
+			webhook: models.Webhook{Name: "ticketing", URL: "http://localhost/hook"},
+			wantErr: "loopback, link-local or private address",
+		},
+		{
+			name:    "cloud metadata address",
+			webhook: models.Webhook{Name: "ticketing", URL: "http://169.254.169.254/latest/meta-data/"},
+			wantErr: "loopback, link-local or private address",
+		},
+		{
+			name:    "private address",
+			webhook: models.Webhook{Name: "ticketing", URL: "https://[fd00::1]/hook"},
+			wantErr: "loopback, link-local or private address",
+		},
+		{
+			name:    "other scheme",
+			webhook: models.Webhook{Name: "ticketing", URL: "file:///etc/passwd"},
+			wantErr: "absolute http or https URL",
+		},
+		{
+			name:    "unknown event type",
+			webhook: models.Webhook{Name: "ticketing", URL: "https://example.com/hook", EventTypes: []string{"host.*"}},
+			wantErr: `unknown event type "host.*"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			webhook := tt.webhook
+			err := services.Webhook.CreateWebhook(&webhook, testUserID, testUsername, testIP)
+			expectError(t, err, tt.wantErr)
+		})
+	}
+
+	webhook := &models.Webhook{Name: "ticketing", URL: "https://example.com/hook", Active: true}
+	if err := services.Webhook.CreateWebhook(webhook, testUserID, testUsername, testIP); err != nil {
+		t.Fatalf("CreateWebhook: %v", err)
+	}
+	if len(webhook.Secret) != 64 {
+		t.Errorf("expected a generated secret, got %q", webhook.Secret)
+	}
+}
+
+func TestChangesQueueWebhookDeliveries(t *testing.T) {
+	services, repos := newTestServices(t)
+
+	accounts := &models.Webhook{Name: "accounts", URL: "https://example.com/accounts", EventTypes: []string{"account.*"}, Active: true}
+	everything := &models.Webhook{Name: "everything", URL: "https://example.com/all", Active: true}
+	disabled := &models.Webhook{Name: "disabled", URL: "https://example.com/off", Active: false}
+	for _, webhook := range []*models.Webhook{accounts, everything, disabled} {
+		if err := services.Webhook.CreateWebhook(webhook, testUserID, testUsername, testIP); err != nil {
+			t.Fatalf("CreateWebhook(%s): %v", webhook.Name, err)
+		}
+	}
+
+	staff := mustCreateGroup(t, services, "staff", 1000, models.GroupTypePeople)
+	alice := mustCreateAccount(t, services, "alice", 1001, models.AccountTypePeople, 0)
+	alice.Firstname = "Alice"
+	if err := services.Account.UpdateAccount(alice, testUserID, testUsername, testIP); err != nil {
+		t.Fatalf("UpdateAccount: %v", err)
+	}
+	if err := services.Account.AssignAccountToGroup(alice.ID, staff.ID, testUserID, testUsername, testIP); err != nil {
+		t.Fatalf("AssignAccountToGroup: %v", err)
+	}
+
+	eventTypes := func(webhook *models.Webhook) []string {
+		deliveries, err := services.Webhook.GetDeliveries(webhook.ID, "", 0)
+		if err != nil {
+			t.Fatalf("GetDeliveries: %v", err)
+		}
+		types := []string{}
+		for i := len(deliveries) - 1; i >= 0; i-- {
+			types = append(types, deliveries[i].EventType)
+		}
+		return types
+	}
+
+	if got := eventTypes(accounts); len(got) != 2 || got[0] != models.EventAccountCreated || got[1] != models.EventAccountUpdated {
+		t.Errorf("account.* deliveries = %v", got)
+	}
+	if got := eventTypes(everything); len(got) != 4 || got[0] != models.EventGroupCreated || got[3] != models.EventMembershipAdded {
+		t.Errorf("unfiltered deliveries = %v", got)
+	}
+	if got := eventTypes(disabled); len(got) != 0 {
+		t.Errorf("disabled webhook deliveries = %v", got)
+	}
+
+	// The payload carries the structured change and points at the audit entry
+	deliveries, err := repos.Webhook.FindDeliveries(accounts.ID, models.DeliveryPending, 1)
+	if err != nil || len(deliveries) != 1 {
+		t.Fatalf("FindDeliveries = %v, %v", deliveries, err)
+	}
+	var event struct {
+		ID     uint              `json:"id"`
+		Type   string            `json:"type"`
+		Actor  models.EventActor `json:"actor"`
+		Before models.Account    `json:"before"`
+		After  models.Account    `json:"after"`
+	}
+	if err := json.Unmarshal([]byte(deliveries[0].Payload), &event); err != nil {
+		t.Fatalf("payload is not JSON: %v", err)
+	}
+	if event.Type != models.EventAccountUpdated || event.Before.Firstname != "" || event.After.Firstname != "Alice" {
+		t.Errorf("unexpected event %+v", event)
+	}
+	if event.Actor.Username != testUsername || event.ID != deliveries[0].EventID {
+		t.Errorf("unexpected actor or ID in %+v", event)
+	}
+	if entry, err := repos.Audit.FindByID(event.ID); err != nil || entry.Action != "update" {
+		t.Errorf("event ID %d does not point at the update audit entry: %v, %v", event.ID, entry, err)
+	}
+}
+
+func TestWebhookDeliveriesCommitWithTheChange(t *testing.T) {
+	services, repos := newSQLiteServices(t)
+
+	webhook := &models.Webhook{Name: "registry", URL: "https://example.com/all", EventTypes: []string{"account.*", "group.*", "membership.*"}, Active: true}
+	if err := services.Webhook.CreateWebhook(webhook, testUserID, testUsername, testIP); err != nil {
+		t.Fatalf("CreateWebhook: %v", err)
+	}
+	staff := mustCreateGroup(t, services, "staff", 1000, models.GroupTypePeople)
+	alice := mustCreateAccount(t, services, "alice", 1001, models.AccountTypePeople, staff.ID)
+
+	// When a delivery cannot be queued, the change and its audit entry are
+	// not saved either
+	failInserts(t, services, "webhook_deliveries")
+	err := services.Account.CreateAccount(&models.Account{Username: "bob", UnixUID: 1002, Type: models.AccountTypePeople}, testUserID, testUsername, testIP)
+	expectError(t, err, "failed to queue webhook delivery")
+	if _, err := services.Account.GetAccountByUsername("bob"); err == nil {
+		t.Error("account bob was saved without its webhook delivery")
+	}
+	staff.Description = "Everyone"
+	err = services.Group.UpdateGroup(staff, testUserID, testUsername, testIP)
+	expectError(t, err, "failed to queue webhook delivery")
+	if group, _ := services.Group.GetGroup(staff.ID); group.Description != "" {
+		t.Errorf("group description = %q, want the update rolled back", group.Description)
+	}
+	err = services.Account.AssignAccountToGroup(alice.ID, staff.ID, testUserID, testUsername, testIP)
+	expectError(t, err, "failed to queue webhook delivery")
+	if groups, _ := services.Account.GetAccountGroups(alice.ID); len(groups) != 0 {
+		t.Errorf("alice is in %+v, want the membership rolled back", groups)
+	}
+
+	if got := strings.Join(auditActions(t, repos, "account"), ","); got != "create" {
+		t.Errorf("account audit = %s", got)
+	}
+	if got := strings.Join(auditActions(t, repos, "group"), ","); got != "create" {
+		t.Errorf("group audit = %s", got)
+	}
+	deliveries, err := services.Webhook.GetDeliveries(webhook.ID, "", 0)
+	if err != nil || len(deliveries) != 2 {
+		t.Errorf("deliveries = %d, %v; want the group and account creations", len(deliveries), err)
+	}
+}
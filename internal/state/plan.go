@@ -0,0 +1,302 @@
+package state
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/home/unixify/internal/models"
+)
+
+// Action is the operation a change performs
+type Action string
+
+const (
+	ActionCreate Action = "create"
+	ActionUpdate Action = "update"
+	ActionDelete Action = "delete"
+)
+
+// Kind is the type of object a change applies to
+type Kind string
+
+const (
+	KindGroup       Kind = "group"
+	KindAccount     Kind = "account"
+	KindMembership  Kind = "membership"
+	KindReservation Kind = "reservation"
+)
+
+// Snapshot is the current content of the registry that a desired state is compared against
+type Snapshot struct {
+	Groups       []models.Group
+	Accounts     []models.Account
+	Memberships  []models.AccountGroup
+	Reservations []models.Reservation
+}
+
+// FieldChange describes a single attribute that an update modifies
+type FieldChange struct {
+	Field string `json:"field"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+// Change is one step of a plan
+type Change struct {
+	Action Action        `json:"action"`
+	Kind   Kind          `json:"kind"`
+	Name   string        `json:"name"`
+	ID     uint          `json:"id,omitempty"` // ID of the existing record for updates and deletes
+	Fields []FieldChange `json:"fields,omitempty"`
+
+	// Desired values used when the change is applied
+	Group       *GroupSpec       `json:"-"`
+	Account     *AccountSpec     `json:"-"`
+	Membership  *MembershipSpec  `json:"-"`
+	Reservation *ReservationSpec `json:"-"`
+}
+
+// Plan is the ordered list of changes needed to reach a desired state
+type Plan struct {
+	Changes []Change `json:"changes"`
+	Creates int      `json:"creates"`
+	Updates int      `json:"updates"`
+	Deletes int      `json:"deletes"`
+	Prune   bool     `json:"prune"`
+}
+
+// add appends a change and keeps the counters in sync
+func (p *Plan) add(change Change) {
+	switch change.Action {
+	case ActionCreate:
+		p.Creates++
+	case ActionUpdate:
+		p.Updates++
+	case ActionDelete:
+		p.Deletes++
+	}
+	p.Changes = append(p.Changes, change)
+}
+
+// IsEmpty reports whether the registry already matches the desired state
+func (p *Plan) IsEmpty() bool {
+	return len(p.Changes) == 0
+}
+
+// Diff compares a desired state against a snapshot of the registry.
+// Changes are ordered so they can be applied one after another: reservations,
+// groups and accounts are created or updated first, then memberships are added,
+// and with prune enabled undeclared memberships, accounts, groups and
+// reservations are deleted last.
+func Diff(desired *DesiredState, current *Snapshot, prune bool) (*Plan, error) {
+	plan := &Plan{Changes: []Change{}, Prune: prune}
+
+	groupsByName := make(map[string]models.Group)
+	groupNamesByID := make(map[uint]string)
+	for _, group := range current.Groups {
+		groupsByName[group.Groupname] = group
+		groupNamesByID[group.ID] = group.Groupname
+	}
+
+	accountsByName := make(map[string]models.Account)
+	accountNamesByID := make(map[uint]string)
+	for _, account := range current.Accounts {
+		accountsByName[account.Username] = account
+		accountNamesByID[account.ID] = account.Username
+	}
+
+	reservationsByName := make(map[string]models.Reservation)
+	for _, reservation := range current.Reservations {
+		reservationsByName[reservation.Name] = reservation
+	}
+
+	// Reservations
+	declaredReservations := make(map[string]bool)
+	for i := range desired.Reservations {
+		spec := &desired.Reservations[i]
+		declaredReservations[spec.Name] = true
+
+		existing, exists := reservationsByName[spec.Name]
+		if !exists {
+			plan.add(Change{Action: ActionCreate, Kind: KindReservation, Name: spec.Name, Reservation: spec,
+				Fields: []FieldChange{{Field: "range", To: fmt.Sprintf("%s %d-%d", spec.Kind, spec.Start, spec.End)}}})
+			continue
+		}
+
+		var fields []FieldChange
+		fields = compare(fields, "kind", existing.Kind, spec.Kind)
+		fields = compare(fields, "start", strconv.Itoa(existing.Start), strconv.Itoa(spec.Start))
+		fields = compare(fields, "end", strconv.Itoa(existing.End), strconv.Itoa(spec.End))
+		fields = compare(fields, "description", existing.Description, spec.Description)
+		if len(fields) > 0 {
+			plan.add(Change{Action: ActionUpdate, Kind: KindReservation, Name: spec.Name, ID: existing.ID, Fields: fields, Reservation: spec})
+		}
+	}
+
+	// Groups
+	declaredGroups := make(map[string]bool)
+	for i := range desired.Groups {
+		spec := &desired.Groups[i]
+		declaredGroups[spec.Groupname] = true
+
+		existing, exists := groupsByName[spec.Groupname]
+		if !exists {
+			plan.add(Change{Action: ActionCreate, Kind: KindGroup, Name: spec.Groupname, Group: spec,
+				Fields: []FieldChange{{Field: "gid", To: strconv.Itoa(spec.GID)}, {Field: "type", To: string(spec.Type)}}})
+			continue
+		}
+
+		var fields []FieldChange
+		fields = compare(fields, "gid", strconv.Itoa(existing.UnixGID), strconv.Itoa(spec.GID))
+		fields = compare(fields, "type", string(existing.Type), string(spec.Type))
+		fields = compare(fields, "description", existing.Description, spec.Description)
+		fields = compare(fields, "active", strconv.FormatBool(existing.Active), strconv.FormatBool(spec.IsActive()))
+		if len(fields) > 0 {
+			plan.add(Change{Action: ActionUpdate, Kind: KindGroup, Name: spec.Groupname, ID: existing.ID, Fields: fields, Group: spec})
+		}
+	}
+
+	// Accounts
+	declaredAccounts := make(map[string]bool)
+	for i := range desired.Accounts {
+		spec := &desired.Accounts[i]
+		declaredAccounts[spec.Username] = true
+
+		if spec.PrimaryGroup != "" && !declaredGroups[spec.PrimaryGroup] {
+			if _, exists := groupsByName[spec.PrimaryGroup]; !exists {
+				return nil, fmt.Errorf("account %s references unknown primary group %s", spec.Username, spec.PrimaryGroup)
+			}
+		}
+
+		existing, exists := accountsByName[spec.Username]
+		if !exists {
+			plan.add(Change{Action: ActionCreate, Kind: KindAccount, Name: spec.Username, Account: spec,
+				Fields: []FieldChange{{Field: "uid", To: strconv.Itoa(spec.UID)}, {Field: "type", To: string(spec.Type)}}})
+			continue
+		}
+
+		var fields []FieldChange
+		fields = compare(fields, "uid", strconv.Itoa(existing.UnixUID), strconv.Itoa(spec.UID))
+		fields = compare(fields, "type", string(existing.Type), string(spec.Type))
+		fields = compare(fields, "primary_group", groupNamesByID[existing.PrimaryGroupID], spec.PrimaryGroup)
+		fields = compare(fields, "firstname", existing.Firstname, spec.Firstname)
+		fields = compare(fields, "surname", existing.Surname, spec.Surname)
+		fields = compare(fields, "active", strconv.FormatBool(existing.Active), strconv.FormatBool(spec.IsActive()))
+		if len(fields) > 0 {
+			plan.add(Change{Action: ActionUpdate, Kind: KindAccount, Name: spec.Username, ID: existing.ID, Fields: fields, Account: spec})
+		}
+	}
+
+	// Memberships
+	currentMemberships := make(map[string]bool)
+	for _, membership := range current.Memberships {
+		key := MembershipSpec{Account: accountNamesByID[membership.AccountID], Group: groupNamesByID[membership.GroupID]}.key()
+		currentMemberships[key] = true
+	}
+
+	declaredMemberships := make(map[string]bool)
+	for i := range desired.Memberships {
+		spec := &desired.Memberships[i]
+		declaredMemberships[spec.key()] = true
+
+		if _, exists := accountsByName[spec.Account]; !exists && !declaredAccounts[spec.Account] {
+			return nil, fmt.Errorf("membership references unknown account %s", spec.Account)
+		}
+		if _, exists := groupsByName[spec.Group]; !exists && !declaredGroups[spec.Group] {
+			return nil, fmt.Errorf("membership references unknown group %s", spec.Group)
+		}
+
+		if !currentMemberships[spec.key()] {
+			plan.add(Change{Action: ActionCreate, Kind: KindMembership, Name: spec.Account + " -> " + spec.Group, Membership: spec})
+		}
+	}
+
+	if !prune {
+		return plan, nil
+	}
+
+	// Pruning removes everything that is not declared, dependents first
+	for _, membership := range current.Memberships {
+		spec := MembershipSpec{Account: accountNamesByID[membership.AccountID], Group: groupNamesByID[membership.GroupID]}
+		if spec.Account == "" || spec.Group == "" {
+			// Orphaned memberships are left for the doctor to repair
+			continue
+		}
+		if !declaredMemberships[spec.key()] {
+			plan.add(Change{Action: ActionDelete, Kind: KindMembership, Name: spec.Account + " -> " + spec.Group, ID: membership.ID, Membership: &spec})
+		}
+	}
+
+	for _, account := range sortedAccounts(current.Accounts) {
+		if !declaredAccounts[account.Username] {
+			plan.add(Change{Action: ActionDelete, Kind: KindAccount, Name: account.Username, ID: account.ID})
+		}
+	}
+
+	for _, group := range sortedGroups(current.Groups) {
+		if !declaredGroups[group.Groupname] {
+			plan.add(Change{Action: ActionDelete, Kind: KindGroup, Name: group.Groupname, ID: group.ID})
+		}
+	}
+
+	for _, reservation := range current.Reservations {
+		if !declaredReservations[reservation.Name] {
+			plan.add(Change{Action: ActionDelete, Kind: KindReservation, Name: reservation.Name, ID: reservation.ID})
+		}
+	}
+
+	return plan, nil
+}
+
+// Write prints the plan in a human-readable form
+func (p *Plan) Write(w io.Writer) error {
+	if p.IsEmpty() {
+		_, err := fmt.Fprintln(w, "No changes. The registry matches the desired state.")
+		return err
+	}
+
+	symbols := map[Action]string{ActionCreate: "+", ActionUpdate: "~", ActionDelete: "-"}
+	for _, change := range p.Changes {
+		if _, err := fmt.Fprintf(w, "%s %s %s\n", symbols[change.Action], change.Kind, change.Name); err != nil {
+			return err
+		}
+		for _, field := range change.Fields {
+			var err error
+			if change.Action == ActionCreate {
+				_, err = fmt.Fprintf(w, "    %s: %s\n", field.Field, field.To)
+			} else {
+				_, err = fmt.Fprintf(w, "    %s: %q -> %q\n", field.Field, field.From, field.To)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err := fmt.Fprintf(w, "\nPlan: %d to create, %d to update, %d to delete.\n", p.Creates, p.Updates, p.Deletes)
+	return err
+}
+
+// compare records a field change when the values differ
+func compare(fields []FieldChange, field, from, to string) []FieldChange {
+	if from == to {
+		return fields
+	}
+	return append(fields, FieldChange{Field: field, From: from, To: to})
+}
+
+// sortedAccounts returns accounts ordered by username for stable output
+func sortedAccounts(accounts []models.Account) []models.Account {
+	sorted := append([]models.Account(nil), accounts...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Username < sorted[j].Username })
+	return sorted
+}
+
+// sortedGroups returns groups ordered by groupname for stable output
+func sortedGroups(groups []models.Group) []models.Group {
+	sorted := append([]models.Group(nil), groups...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Groupname < sorted[j].Groupname })
+	return sorted
+}
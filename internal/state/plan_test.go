@@ -0,0 +1,209 @@
+package state
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/home/unixify/internal/models"
+)
+
+// registry is the snapshot most cases are compared against
+func registry() *Snapshot {
+	return &Snapshot{
+		Groups: []models.Group{
+			{ID: 1, Groupname: "staff", UnixGID: 1000, Type: models.GroupTypePeople, Active: true},
+			{ID: 2, Groupname: "web", UnixGID: 1001, Type: models.GroupTypePeople, Active: true},
+		},
+		Accounts: []models.Account{
+			{ID: 1, Username: "alice", UnixUID: 1001, Type: models.AccountTypePeople, PrimaryGroupID: 1, Active: true},
+			{ID: 2, Username: "old", UnixUID: 1002, Type: models.AccountTypePeople, Active: true},
+		},
+		Memberships: []models.AccountGroup{
+			{ID: 1, AccountID: 1, GroupID: 2},
+			{ID: 2, AccountID: 2, GroupID: 1},
+			{ID: 3, AccountID: 9, GroupID: 1}, // Orphaned: account 9 is gone
+		},
+		Reservations: []models.Reservation{
+			{ID: 1, Name: "legacy", Kind: "uid", Start: 5000, End: 5999},
+		},
+	}
+}
+
+// declared is a desired state that keeps staff and alice as they are
+func declared() *DesiredState {
+	return &DesiredState{
+		Groups:   []GroupSpec{{Groupname: "staff", GID: 1000, Type: models.GroupTypePeople}},
+		Accounts: []AccountSpec{{Username: "alice", UID: 1001, Type: models.AccountTypePeople, PrimaryGroup: "staff"}},
+	}
+}
+
+// steps summarizes a plan as "action kind name" lines
+func steps(plan *Plan) string {
+	lines := []string{}
+	for _, change := range plan.Changes {
+		lines = append(lines, string(change.Action)+" "+string(change.Kind)+" "+change.Name)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name    string
+		desired func() *DesiredState
+		current *Snapshot
+		prune   bool
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "creates dependencies first",
+			desired: func() *DesiredState {
+				return &DesiredState{
+					Memberships:  []MembershipSpec{{Account: "bob", Group: "dev"}},
+					Accounts:     []AccountSpec{{Username: "bob", UID: 2001, Type: models.AccountTypePeople, PrimaryGroup: "dev"}},
+					Groups:       []GroupSpec{{Groupname: "dev", GID: 2000, Type: models.GroupTypePeople}},
+					Reservations: []ReservationSpec{{Name: "batch", Kind: "uid", Start: 3000, End: 3999}},
+				}
+			},
+			current: &Snapshot{},
+			want: []string{
+				"create reservation batch",
+				"create group dev",
+				"create account bob",
+				"create membership bob -> dev",
+			},
+		},
+		{
+			name:    "matching state has no changes",
+			desired: declared,
+			current: registry(),
+			want:    []string{},
+		},
+		{
+			name: "updates before new memberships",
+			desired: func() *DesiredState {
+				desired := declared()
+				desired.Groups[0].GID = 1100
+				desired.Accounts[0].Surname = "Smith"
+				desired.Reservations = []ReservationSpec{{Name: "legacy", Kind: "uid", Start: 5000, End: 6999}}
+				desired.Memberships = []MembershipSpec{{Account: "alice", Group: "staff"}}
+				return desired
+			},
+			current: registry(),
+			want: []string{
+				"update reservation legacy",
+				"update group staff",
+				"update account alice",
+				"create membership alice -> staff",
+			},
+		},
+		{
+			name: "existing memberships are kept",
+			desired: func() *DesiredState {
+				desired := declared()
+				desired.Memberships = []MembershipSpec{{Account: "alice", Group: "web"}}
+				return desired
+			},
+			current: registry(),
+			want:    []string{},
+		},
+		{
+			name: "unknown primary group",
+			desired: func() *DesiredState {
+				desired := declared()
+				desired.Accounts[0].PrimaryGroup = "nobody"
+				return desired
+			},
+			current: registry(),
+			wantErr: "account alice references unknown primary group nobody",
+		},
+		{
+			name: "membership of an unknown account",
+			desired: func() *DesiredState {
+				desired := declared()
+				desired.Memberships = []MembershipSpec{{Account: "carol", Group: "staff"}}
+				return desired
+			},
+			current: registry(),
+			wantErr: "membership references unknown account carol",
+		},
+		{
+			name: "membership of an unknown group",
+			desired: func() *DesiredState {
+				desired := declared()
+				desired.Memberships = []MembershipSpec{{Account: "alice", Group: "ops"}}
+				return desired
+			},
+			current: registry(),
+			wantErr: "membership references unknown group ops",
+		},
+		{
+			name: "prune deletes memberships, accounts, groups, then reservations",
+			desired: func() *DesiredState {
+				desired := declared()
+				desired.Reservations = []ReservationSpec{{Name: "batch", Kind: "uid", Start: 3000, End: 3999}}
+				return desired
+			},
+			current: registry(),
+			prune:   true,
+			want: []string{
+				"create reservation batch",
+				"delete membership alice -> web",
+				"delete membership old -> staff",
+				"delete account old",
+				"delete group web",
+				"delete reservation legacy",
+			},
+		},
+		{
+			name:    "without prune nothing is deleted",
+			desired: func() *DesiredState { return &DesiredState{} },
+			current: registry(),
+			want:    []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, err := Diff(tt.desired(), tt.current, tt.prune)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("Diff error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Diff: %v", err)
+			}
+			if got, want := steps(plan), strings.Join(tt.want, "\n"); got != want {
+				t.Errorf("plan:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestDiffCountsAndFields(t *testing.T) {
+	desired := declared()
+	desired.Groups[0].GID = 1100
+	desired.Groups[0].Description = "Staff"
+	desired.Accounts = append(desired.Accounts, AccountSpec{Username: "bob", UID: 2001, Type: models.AccountTypePeople})
+
+	plan, err := Diff(desired, registry(), true)
+	if err != nil {
+		t.Fatalf("Diff: %v", err)
+	}
+	if plan.Creates != 1 || plan.Updates != 1 || plan.Deletes != 5 || !plan.Prune {
+		t.Errorf("plan counts = %d creates, %d updates, %d deletes", plan.Creates, plan.Updates, plan.Deletes)
+	}
+
+	update := plan.Changes[0]
+	want := []FieldChange{{Field: "gid", From: "1000", To: "1100"}, {Field: "description", From: "", To: "Staff"}}
+	if update.Action != ActionUpdate || update.ID != 1 || len(update.Fields) != len(want) {
+		t.Fatalf("first change = %+v", update)
+	}
+	for i, field := range want {
+		if update.Fields[i] != field {
+			t.Errorf("field %d = %+v, want %+v", i, update.Fields[i], field)
+		}
+	}
+}
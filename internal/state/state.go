@@ -0,0 +1,193 @@
+package state
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/home/unixify/internal/models"
+	"gopkg.in/yaml.v3"
+)
+
+// Format identifies the encoding of a desired-state document
+type Format string
+
+const (
+	FormatYAML Format = "yaml"
+	FormatJSON Format = "json"
+)
+
+// DesiredState is the declarative description of the registry that is kept in git
+type DesiredState struct {
+	Groups       []GroupSpec       `json:"groups" yaml:"groups"`
+	Accounts     []AccountSpec     `json:"accounts" yaml:"accounts"`
+	Memberships  []MembershipSpec  `json:"memberships" yaml:"memberships"`
+	Reservations []ReservationSpec `json:"reservations" yaml:"reservations"`
+}
+
+// GroupSpec describes a desired UNIX group
+type GroupSpec struct {
+	Groupname   string           `json:"groupname" yaml:"groupname"`
+	GID         int              `json:"gid" yaml:"gid"`
+	Type        models.GroupType `json:"type" yaml:"type"`
+	Description string           `json:"description" yaml:"description"`
+	Active      *bool            `json:"active,omitempty" yaml:"active,omitempty"` // Defaults to true
+}
+
+// AccountSpec describes a desired UNIX account
+type AccountSpec struct {
+	Username     string             `json:"username" yaml:"username"`
+	UID          int                `json:"uid" yaml:"uid"`
+	Type         models.AccountType `json:"type" yaml:"type"`
+	PrimaryGroup string             `json:"primary_group" yaml:"primary_group"` // Groupname of the primary group
+	Firstname    string             `json:"firstname" yaml:"firstname"`
+	Surname      string             `json:"surname" yaml:"surname"`
+	Active       *bool              `json:"active,omitempty" yaml:"active,omitempty"` // Defaults to true
+}
+
+// MembershipSpec describes a desired account/group membership by name
+type MembershipSpec struct {
+	Account string `json:"account" yaml:"account"`
+	Group   string `json:"group" yaml:"group"`
+}
+
+// ReservationSpec describes a desired UID or GID reservation
+type ReservationSpec struct {
+	Name        string `json:"name" yaml:"name"`
+	Kind        string `json:"kind" yaml:"kind"` // uid or gid
+	Start       int    `json:"start" yaml:"start"`
+	End         int    `json:"end" yaml:"end"`
+	Description string `json:"description" yaml:"description"`
+}
+
+// IsActive reports whether the group should be active
+func (g GroupSpec) IsActive() bool {
+	return g.Active == nil || *g.Active
+}
+
+// IsActive reports whether the account should be active
+func (a AccountSpec) IsActive() bool {
+	return a.Active == nil || *a.Active
+}
+
+// key returns the identity of a membership
+func (m MembershipSpec) key() string {
+	return m.Account + "/" + m.Group
+}
+
+// LoadFile reads a desired-state document, choosing the format by file extension
+func LoadFile(path string) (*DesiredState, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read desired state: %w", err)
+	}
+
+	format := FormatYAML
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		format = FormatJSON
+	}
+
+	return Parse(data, format)
+}
+
+// Parse decodes and validates a desired-state document
+func Parse(data []byte, format Format) (*DesiredState, error) {
+	var desired DesiredState
+
+	switch format {
+	case FormatJSON:
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&desired); err != nil {
+			return nil, fmt.Errorf("invalid JSON desired state: %w", err)
+		}
+	case FormatYAML:
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&desired); err != nil {
+			return nil, fmt.Errorf("invalid YAML desired state: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported desired state format: %s", format)
+	}
+
+	if err := desired.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &desired, nil
+}
+
+// Validate checks the document for missing fields and duplicate names
+func (d *DesiredState) Validate() error {
+	groups := make(map[string]bool)
+	gids := make(map[int]string)
+	for _, group := range d.Groups {
+		if group.Groupname == "" {
+			return fmt.Errorf("group with GID %d has no groupname", group.GID)
+		}
+		if group.Type == "" {
+			return fmt.Errorf("group %s has no type", group.Groupname)
+		}
+		if groups[group.Groupname] {
+			return fmt.Errorf("group %s is declared more than once", group.Groupname)
+		}
+		if other, exists := gids[group.GID]; exists {
+			return fmt.Errorf("groups %s and %s share GID %d", other, group.Groupname, group.GID)
+		}
+		groups[group.Groupname] = true
+		gids[group.GID] = group.Groupname
+	}
+
+	accounts := make(map[string]bool)
+	uids := make(map[int]string)
+	for _, account := range d.Accounts {
+		if account.Username == "" {
+			return fmt.Errorf("account with UID %d has no username", account.UID)
+		}
+		if account.Type == "" {
+			return fmt.Errorf("account %s has no type", account.Username)
+		}
+		if accounts[account.Username] {
+			return fmt.Errorf("account %s is declared more than once", account.Username)
+		}
+		if other, exists := uids[account.UID]; exists {
+			return fmt.Errorf("accounts %s and %s share UID %d", other, account.Username, account.UID)
+		}
+		accounts[account.Username] = true
+		uids[account.UID] = account.Username
+	}
+
+	memberships := make(map[string]bool)
+	for _, membership := range d.Memberships {
+		if membership.Account == "" || membership.Group == "" {
+			return fmt.Errorf("membership must name both an account and a group")
+		}
+		if memberships[membership.key()] {
+			return fmt.Errorf("membership of %s in %s is declared more than once", membership.Account, membership.Group)
+		}
+		memberships[membership.key()] = true
+	}
+
+	reservations := make(map[string]bool)
+	for _, reservation := range d.Reservations {
+		if reservation.Name == "" {
+			return fmt.Errorf("reservation %d-%d has no name", reservation.Start, reservation.End)
+		}
+		if reservation.Kind != models.ReservationKindUID && reservation.Kind != models.ReservationKindGID {
+			return fmt.Errorf("reservation %s has invalid kind %q (expected uid or gid)", reservation.Name, reservation.Kind)
+		}
+		if reservation.End < reservation.Start {
+			return fmt.Errorf("reservation %s ends before it starts", reservation.Name)
+		}
+		if reservations[reservation.Name] {
+			return fmt.Errorf("reservation %s is declared more than once", reservation.Name)
+		}
+		reservations[reservation.Name] = true
+	}
+
+	return nil
+}
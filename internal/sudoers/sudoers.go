@@ -0,0 +1,193 @@
+// Package sudoers validates the pieces of sudo rules and checks the syntax of
+// the sudoers files Unixify exports. It understands the subset of the sudoers
+// grammar that the exports use: comments and one user specification per line,
+// with a runas list, tags and a command list.
+package sudoers
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Tags sudo accepts in front of a command list
+var tags = map[string]bool{
+	"NOPASSWD": true, "PASSWD": true,
+	"NOEXEC": true, "EXEC": true,
+	"SETENV": true, "NOSETENV": true,
+	"LOG_INPUT": true, "NOLOG_INPUT": true,
+	"LOG_OUTPUT": true, "NOLOG_OUTPUT": true,
+	"MAIL": true, "NOMAIL": true,
+	"FOLLOW": true, "NOFOLLOW": true,
+	"INTERCEPT": true, "NOINTERCEPT": true,
+}
+
+var (
+	nameRe = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]*\$?$`)
+	idRe   = regexp.MustCompile(`^#[0-9]+$`)
+	hostRe = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.:/*-]*$`)
+	tagRe  = regexp.MustCompile(`^([A-Z_]+):\s*`)
+)
+
+// ValidUser reports whether item can appear in a user list: ALL, a user name,
+// #uid, %group, %#gid or +netgroup
+func ValidUser(item string) bool {
+	switch {
+	case item == "ALL":
+		return true
+	case strings.HasPrefix(item, "%#"):
+		return idRe.MatchString(item[1:])
+	case strings.HasPrefix(item, "%"), strings.HasPrefix(item, "+"):
+		return nameRe.MatchString(item[1:]) && item[1:] != "ALL"
+	case strings.HasPrefix(item, "#"):
+		return idRe.MatchString(item)
+	}
+	return nameRe.MatchString(item)
+}
+
+// ValidRunasGroup reports whether item can appear in the group part of a
+// runas list: ALL, a group name or #gid
+func ValidRunasGroup(item string) bool {
+	return item == "ALL" || idRe.MatchString(item) || nameRe.MatchString(item)
+}
+
+// ValidHost reports whether item can appear in a host list: ALL, a host name,
+// an IP address or network, or +netgroup
+func ValidHost(item string) bool {
+	if strings.HasPrefix(item, "+") {
+		return nameRe.MatchString(item[1:])
+	}
+	return hostRe.MatchString(item)
+}
+
+// ValidCommand reports whether a command can appear in a command list: ALL,
+// or an absolute path or sudoedit followed by arguments. Arguments may not
+// hold the characters sudoers would need escaped.
+func ValidCommand(command string) bool {
+	if command == "ALL" {
+		return true
+	}
+	fields := strings.Fields(command)
+	if len(fields) == 0 || strings.Join(fields, " ") != command {
+		return false
+	}
+	if !strings.HasPrefix(fields[0], "/") && fields[0] != "sudoedit" {
+		return false
+	}
+	if fields[0] == "sudoedit" && len(fields) < 2 {
+		return false
+	}
+	return !strings.ContainsAny(command, `,:=\()#"`+"\x00")
+}
+
+// Check checks the syntax of a sudoers file and returns the first error
+func Check(data []byte) error {
+	text := string(data)
+	if text != "" && !strings.HasSuffix(text, "\n") {
+		return fmt.Errorf("the file does not end with a newline")
+	}
+	for i, line := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+		if err := checkLine(line); err != nil {
+			return fmt.Errorf("line %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// checkLine checks one line of a sudoers file
+func checkLine(line string) error {
+	trimmed := strings.TrimSpace(line)
+	if trimmed == "" {
+		return nil
+	}
+	if strings.HasPrefix(trimmed, "#include") || strings.HasPrefix(trimmed, "@include") {
+		return fmt.Errorf("include directives are not supported")
+	}
+	if strings.HasPrefix(trimmed, "#") {
+		return nil
+	}
+	if strings.HasSuffix(trimmed, "\\") {
+		return fmt.Errorf("continuation lines are not supported")
+	}
+
+	// User_List Host_List = ...
+	left, right, ok := strings.Cut(trimmed, "=")
+	if !ok {
+		return fmt.Errorf("missing '='")
+	}
+	fields := strings.Fields(strings.ReplaceAll(left, ", ", ","))
+	if len(fields) != 2 {
+		return fmt.Errorf("expected a user list and a host list before '='")
+	}
+	if fields[0] == "Defaults" || strings.HasPrefix(fields[0], "Defaults") {
+		return fmt.Errorf("Defaults lines are not supported")
+	}
+	if err := checkList(fields[0], "user", ValidUser); err != nil {
+		return err
+	}
+	if err := checkList(fields[1], "host", ValidHost); err != nil {
+		return err
+	}
+	return checkCommandSpec(strings.TrimSpace(right))
+}
+
+// checkCommandSpec checks the part of a user specification after '='
+func checkCommandSpec(spec string) error {
+	// Runas list
+	if strings.HasPrefix(spec, "(") {
+		end := strings.Index(spec, ")")
+		if end < 0 {
+			return fmt.Errorf("unterminated runas list")
+		}
+		users, groups, hasGroups := strings.Cut(spec[1:end], ":")
+		users, groups = strings.TrimSpace(users), strings.TrimSpace(groups)
+		if users == "" && !hasGroups {
+			return fmt.Errorf("empty runas list")
+		}
+		if users != "" {
+			if err := checkList(strings.ReplaceAll(users, ", ", ","), "runas user", ValidUser); err != nil {
+				return err
+			}
+		}
+		if hasGroups {
+			if err := checkList(strings.ReplaceAll(groups, ", ", ","), "runas group", ValidRunasGroup); err != nil {
+				return err
+			}
+		}
+		spec = strings.TrimSpace(spec[end+1:])
+	}
+
+	// Tags
+	for {
+		match := tagRe.FindStringSubmatch(spec)
+		if match == nil {
+			break
+		}
+		if !tags[match[1]] {
+			return fmt.Errorf("unknown tag %s", match[1])
+		}
+		spec = spec[len(match[0]):]
+	}
+
+	// Command list
+	if spec == "" {
+		return fmt.Errorf("missing command list")
+	}
+	for _, command := range strings.Split(spec, ",") {
+		command = strings.TrimPrefix(strings.TrimSpace(command), "!")
+		if !ValidCommand(command) {
+			return fmt.Errorf("invalid command %q", command)
+		}
+	}
+	return nil
+}
+
+// checkList checks every item of a comma-separated list; items may be negated with !
+func checkList(list, kind string, valid func(string) bool) error {
+	for _, item := range strings.Split(list, ",") {
+		if !valid(strings.TrimPrefix(item, "!")) {
+			return fmt.Errorf("invalid %s %q", kind, item)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package sudoers
+
+import "testing"
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		ok   bool
+	}{
+		{"group rule", "%dba ALL = (root) NOPASSWD: /usr/bin/systemctl restart postgresql, /usr/bin/journalctl\n", true},
+		{"account with hosts and runas groups", "alice web1,+webservers = (www-data:adm) /usr/bin/tail -f /var/log/nginx/access.log\n", true},
+		{"comments and blank lines", "# Managed\n\n# rule\n%wheel ALL = ALL\n", true},
+		{"negated command", "bob ALL = ALL, !/usr/bin/su\n", true},
+		{"sudoedit", "bob ALL = sudoedit /etc/hosts\n", true},
+		{"missing newline", "%wheel ALL = ALL", false},
+		{"missing equals", "%wheel ALL ALL\n", false},
+		{"relative command", "%wheel ALL = vi\n", false},
+		{"unknown tag", "%wheel ALL = NOPASS: ALL\n", false},
+		{"bad user", "%my group ALL = ALL\n", false},
+		{"unescaped colon", "%wheel ALL = /bin/echo a:b\n", false},
+		{"unterminated runas", "%wheel ALL = (root ALL\n", false},
+		{"defaults", "Defaults env_reset\n", false},
+		{"include", "#includedir /etc/sudoers.d\n", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Check([]byte(tt.file))
+			if tt.ok && err != nil {
+				t.Errorf("Check(%q) = %v", tt.file, err)
+			}
+			if !tt.ok && err == nil {
+				t.Errorf("Check(%q) accepted", tt.file)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+// Package username turns a person's first name and surname into a username
+// following a template such as {f}{surname}
+package username
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// DefaultTemplates are suggested when no template is asked for
+var DefaultTemplates = []string{"{f}{surname}", "{firstname}{s}", "{firstname}_{surname}"}
+
+// Template fields
+var fields = map[string]func(firstname, surname string) string{
+	"f":         func(firstname, surname string) string { return initial(firstname) },
+	"firstname": func(firstname, surname string) string { return firstname },
+	"s":         func(firstname, surname string) string { return initial(surname) },
+	"surname":   func(firstname, surname string) string { return surname },
+}
+
+// initial returns the first letter of a transliterated name
+func initial(name string) string {
+	if name == "" {
+		return ""
+	}
+	return name[:1]
+}
+
+// Template is a parsed username template. Fields are written in braces:
+// {firstname} and {surname} for the whole names, {f} and {s} for their first
+// letters. Other text is copied as is.
+type Template struct {
+	source string
+	parts  []part
+}
+
+// part is literal text or a field of a template
+type part struct {
+	text  string
+	field string
+}
+
+// Parse parses a template
+func Parse(template string) (*Template, error) {
+	t := &Template{source: template}
+	rest := template
+	for rest != "" {
+		open := strings.IndexByte(rest, '{')
+		if open < 0 {
+			t.parts = append(t.parts, part{text: rest})
+			break
+		}
+		if open > 0 {
+			t.parts = append(t.parts, part{text: rest[:open]})
+		}
+		end := strings.IndexByte(rest[open:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("template %q: unclosed {", template)
+		}
+		field := rest[open+1 : open+end]
+		if _, ok := fields[field]; !ok {
+			return nil, fmt.Errorf("template %q: unknown field {%s}, use {f}, {firstname}, {s} or {surname}", template, field)
+		}
+		t.parts = append(t.parts, part{field: field})
+		rest = rest[open+end+1:]
+	}
+
+	hasField := false
+	for _, p := range t.parts {
+		hasField = hasField || p.field != ""
+	}
+	if !hasField {
+		return nil, fmt.Errorf("template %q has no fields", template)
+	}
+	return t, nil
+}
+
+// String returns the template as written
+func (t *Template) String() string {
+	return t.source
+}
+
+// Render fills in the template with the transliterated names
+func (t *Template) Render(firstname, surname string) (string, error) {
+	firstname, err := Transliterate(firstname)
+	if err != nil {
+		return "", err
+	}
+	surname, err = Transliterate(surname)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for _, p := range t.parts {
+		if p.field == "" {
+			b.WriteString(p.text)
+			continue
+		}
+		value := fields[p.field](firstname, surname)
+		if value == "" {
+			return "", fmt.Errorf("template %s needs a first name and surname with letters or digits", t.source)
+		}
+		b.WriteString(value)
+	}
+	return b.String(), nil
+}
+
+// transliterations spell letters outside ASCII with ASCII letters
+var transliterations = map[rune]string{
+	'ß': "ss", 'æ': "ae", 'œ': "oe", 'ø': "o", 'đ': "d", 'ð': "d", 'þ': "th",
+	'ł': "l", 'ı': "i", 'ħ': "h", 'ŧ': "t", 'ŋ': "ng", 'ĸ': "k",
+
+	// Cyrillic, as commonly romanized for Russian, with the letters of
+	// Ukrainian, Belarusian, Bulgarian, Serbian and Macedonian
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "yo",
+	'ж': "zh", 'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m",
+	'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u",
+	'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch",
+	'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu", 'я': "ya",
+	'є': "ye", 'і': "i", 'ї': "yi", 'ґ': "g", 'ў': "u", 'ђ': "dj", 'ј': "j",
+	'љ': "lj", 'њ': "nj", 'ћ': "c", 'џ': "dz", 'ѓ': "gj", 'ќ': "kj", 'ѕ': "dz",
+
+	// Greek, following ELOT 743 letter by letter
+	'α': "a", 'β': "v", 'γ': "g", 'δ': "d", 'ε': "e", 'ζ': "z", 'η': "i",
+	'θ': "th", 'ι': "i", 'κ': "k", 'λ': "l", 'μ': "m", 'ν': "n", 'ξ': "x",
+	'ο': "o", 'π': "p", 'ρ': "r", 'σ': "s", 'ς': "s", 'τ': "t", 'υ': "y",
+	'φ': "f", 'χ': "ch", 'ψ': "ps", 'ω': "o", 'ά': "a", 'έ': "e", 'ή': "i",
+	'ί': "i", 'ό': "o", 'ύ': "y", 'ώ': "o", 'ϊ': "i", 'ϋ': "y", 'ΐ': "i", 'ΰ': "y",
+}
+
+// decomposed are the Latin letters that are an ASCII letter with a
+// diacritic, keyed by that letter
+var decomposed = map[string]string{
+	"a": "àáâãäåāăą", "c": "çćĉċč", "d": "ď", "e": "èéêëēĕėęě", "g": "ĝğġģ",
+	"h": "ĥ", "i": "ìíîïĩīĭį", "j": "ĵ", "k": "ķ", "l": "ĺļľŀ", "n": "ñńņňŉ",
+	"o": "òóôõöōŏő", "r": "ŕŗř", "s": "śŝşšș", "t": "ţťț", "u": "ùúûüũūŭůűų",
+	"w": "ŵ", "y": "ýÿŷ", "z": "źżž",
+}
+
+func init() {
+	for ascii, letters := range decomposed {
+		for _, letter := range letters {
+			transliterations[letter] = ascii
+		}
+	}
+}
+
+// Transliterate lowercases a name and spells it with ASCII letters and
+// digits. Diacritics are dropped (José becomes jose), ligatures and special
+// letters are spelled out (Strauß becomes strauss), Cyrillic and Greek are
+// romanized (Юлия becomes yuliya, Γιώργος becomes giorgos), and everything
+// else, such as spaces, hyphens and apostrophes, is left out. Letters of
+// other scripts, such as Chinese, cannot be spelled this way, so no username
+// can be derived from names using them.
+func Transliterate(name string) (string, error) {
+	var b strings.Builder
+	previous := rune(0)
+	for _, r := range strings.ToLower(name) {
+		spelled, ok := transliterations[r]
+		switch {
+		case r >= 'a' && r <= 'z' || r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case (r == 'υ' || r == 'ύ') && previous == 'ο':
+			b.WriteString("u") // The Greek digraph ου is spelled ou
+		case ok:
+			b.WriteString(spelled)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			return "", fmt.Errorf("cannot derive a username from %q: %c cannot be spelled with ASCII letters", name, r)
+		}
+		previous = r
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,57 @@
+package username
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTemplate(t *testing.T) {
+	tests := []struct {
+		template, firstname, surname, want string
+	}{
+		{"{f}{surname}", "John", "Smith", "jsmith"},
+		{"{firstname}.{surname}", "José", "Müller", "jose.muller"},
+		{"{firstname}{s}", "Ægir", "Þórsson", "aegirt"},
+		{"{f}{surname}", "Mary Ann", "O'Brien-Strauß", "mobrienstrauss"},
+		{"x{f}{s}1", "Łukasz", "Żółć", "xlz1"},
+		{"{f}{surname}", "Дмитрий", "Иванов", "divanov"},
+		{"{firstname}_{surname}", "Юлия", "Щербакова", "yuliya_shcherbakova"},
+		{"{firstname}{s}", "Олександр", "Ґалаґан", "oleksandrg"},
+		{"{f}{surname}", "Љубица", "Ђорђевић", "ldjordjevic"},
+		{"{firstname}.{surname}", "Γιώργος", "Παπαδόπουλος", "giorgos.papadopoulos"},
+		{"{f}{surname}", "Ευάγγελος", "Θεοδωράκης", "etheodorakis"},
+	}
+	for _, tt := range tests {
+		template, err := Parse(tt.template)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.template, err)
+		}
+		got, err := template.Render(tt.firstname, tt.surname)
+		if err != nil || got != tt.want {
+			t.Errorf("%s with %s %s = %q, %v; want %q", tt.template, tt.firstname, tt.surname, got, err, tt.want)
+		}
+	}
+
+	for _, template := range []string{"{first}", "{f", "static", ""} {
+		if _, err := Parse(template); err == nil {
+			t.Errorf("Parse(%q) should fail", template)
+		}
+	}
+	// Names that give nothing, or use a script that cannot be spelled with
+	// ASCII letters, give no username
+	failures := []struct {
+		firstname, surname, want string
+	}{
+		{"李", "王", "cannot derive a username"},
+		{"Haruki", "村上", "cannot derive a username"},
+		{"محمد", "Ali", "cannot derive a username"},
+		{"דוד", "Cohen", "cannot derive a username"},
+		{"John", "'-", "needs a first name and surname"},
+	}
+	template, _ := Parse("{f}{surname}")
+	for _, tt := range failures {
+		if got, err := template.Render(tt.firstname, tt.surname); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Render(%s, %s) = %q, %v; want an error containing %q", tt.firstname, tt.surname, got, err, tt.want)
+		}
+	}
+}
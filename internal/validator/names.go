@@ -0,0 +1,178 @@
+package validator
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/home/unixify/internal/models"
+)
+
+// Field error codes
+const (
+	CodeRequired  = "required"
+	CodePattern   = "pattern"
+	CodeMaxLength = "max_length"
+	CodeReserved  = "reserved"
+	CodePrefix    = "prefix"
+)
+
+// FieldError is a validation failure of one input field
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// FieldErrors are the validation failures of an input; handlers return them
+// to clients field by field
+type FieldErrors []FieldError
+
+// Error joins the messages of the field errors
+func (e FieldErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, fieldError := range e {
+		messages = append(messages, fieldError.Message)
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Naming policy defaults
+const (
+	// DefaultNamePattern is the portable name set useradd accepts by default:
+	// lowercase letters, digits, underscores and hyphens, not starting with a
+	// digit or hyphen
+	DefaultNamePattern = `^[a-z_][a-z0-9_-]*$`
+	// DefaultNameMaxLength is the longest name utmp and most tools handle
+	DefaultNameMaxLength = 32
+)
+
+// DefaultReservedNames are names of the accounts and groups that distributions
+// create on every host. Groups that grant access, such as wheel and sudo, are
+// left out so the registry can manage their members.
+var DefaultReservedNames = []string{
+	"backup", "bin", "daemon", "disk", "games", "gnats", "irc", "kmem", "list",
+	"lp", "mail", "man", "news", "nobody", "nogroup", "proxy", "root", "shadow",
+	"sshd", "sync", "sys", "tty", "utmp", "uucp", "www-data",
+}
+
+// NamePolicy are the rules usernames and group names must follow
+type NamePolicy struct {
+	Pattern   *regexp.Regexp
+	MaxLength int
+	Reserved  []string
+	// Prefixes the names of accounts and groups of a type must start with;
+	// names of other types may not start with them
+	AccountPrefixes map[models.AccountType]string
+	GroupPrefixes   map[models.GroupType]string
+}
+
+// DefaultNamePolicy returns the policy used when nothing is configured
+func DefaultNamePolicy() NamePolicy {
+	return NamePolicy{
+		Pattern:         regexp.MustCompile(DefaultNamePattern),
+		MaxLength:       DefaultNameMaxLength,
+		Reserved:        DefaultReservedNames,
+		AccountPrefixes: map[models.AccountType]string{},
+		GroupPrefixes:   map[models.GroupType]string{},
+	}
+}
+
+// ValidateUsername checks the name of an account of the given type; it
+// returns FieldErrors for the username field
+func (p NamePolicy) ValidateUsername(name string, accountType models.AccountType) error {
+	prefixes := make(map[string]string, len(p.AccountPrefixes))
+	for t, prefix := range p.AccountPrefixes {
+		prefixes[string(t)] = prefix
+	}
+	return p.validate("username", "account", name, string(accountType), prefixes)
+}
+
+// ValidateGroupname checks the name of a group of the given type; it
+// returns FieldErrors for the groupname field
+func (p NamePolicy) ValidateGroupname(name string, groupType models.GroupType) error {
+	prefixes := make(map[string]string, len(p.GroupPrefixes))
+	for t, prefix := range p.GroupPrefixes {
+		prefixes[string(t)] = prefix
+	}
+	return p.validate("groupname", "group", name, string(groupType), prefixes)
+}
+
+// validate applies the policy to a name; prefixes are keyed by type
+func (p NamePolicy) validate(field, kind, name, nameType string, prefixes map[string]string) error {
+	if name == "" {
+		return FieldErrors{{Field: field, Code: CodeRequired, Message: fmt.Sprintf("%s is required", field)}}
+	}
+
+	var errs FieldErrors
+	if p.MaxLength > 0 && len(name) > p.MaxLength {
+		errs = append(errs, FieldError{Field: field, Code: CodeMaxLength,
+			Message: fmt.Sprintf("%s %q is longer than %d characters", field, name, p.MaxLength)})
+	}
+	if p.Pattern != nil && !p.Pattern.MatchString(name) {
+		errs = append(errs, FieldError{Field: field, Code: CodePattern,
+			Message: fmt.Sprintf("%s %q does not match %s", field, name, p.Pattern)})
+	}
+	for _, reserved := range p.Reserved {
+		if strings.EqualFold(name, reserved) {
+			errs = append(errs, FieldError{Field: field, Code: CodeReserved,
+				Message: fmt.Sprintf("%s %q is reserved", field, name)})
+			break
+		}
+	}
+
+	// The type's own prefix is required, the prefixes of other types are not
+	// allowed unless the own prefix covers them (db_ and db_admin_)
+	own := prefixes[nameType]
+	if own != "" && !strings.HasPrefix(name, own) {
+		errs = append(errs, FieldError{Field: field, Code: CodePrefix,
+			Message: fmt.Sprintf("%s %q must start with %s for %s %ss", field, name, own, nameType, kind)})
+	}
+	types := make([]string, 0, len(prefixes))
+	for t := range prefixes {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	for _, t := range types {
+		prefix := prefixes[t]
+		if t == nameType || prefix == "" || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if own != "" && strings.HasPrefix(name, own) && len(own) >= len(prefix) {
+			continue
+		}
+		errs = append(errs, FieldError{Field: field, Code: CodePrefix,
+			Message: fmt.Sprintf("%s %q starts with %s, which is reserved for %s %ss", field, name, prefix, t, kind)})
+		break
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// ParsePrefixes parses a comma-separated list of type=prefix pairs such as
+// service=svc_,database=db_
+func ParsePrefixes(spec string) (map[string]string, error) {
+	prefixes := make(map[string]string)
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		t, prefix, ok := strings.Cut(part, "=")
+		t, prefix = strings.TrimSpace(t), strings.TrimSpace(prefix)
+		if !ok || prefix == "" {
+			return nil, fmt.Errorf("invalid prefix %q: expected type=prefix", part)
+		}
+		switch models.AccountType(t) {
+		case models.AccountTypePeople, models.AccountTypeSystem, models.AccountTypeService, models.AccountTypeDatabase:
+		default:
+			return nil, fmt.Errorf("invalid prefix %q: unknown type %s", part, t)
+		}
+		prefixes[t] = prefix
+	}
+	return prefixes, nil
+}
@@ -0,0 +1,70 @@
+package validator
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/home/unixify/internal/models"
+)
+
+func TestNamePolicy(t *testing.T) {
+	policy := DefaultNamePolicy()
+	policy.AccountPrefixes[models.AccountTypeService] = "svc_"
+	policy.AccountPrefixes[models.AccountTypeDatabase] = "db_"
+
+	tests := []struct {
+		name        string
+		accountType models.AccountType
+		codes       string
+	}{
+		{"alice", models.AccountTypePeople, ""},
+		{"_build-01", models.AccountTypePeople, ""},
+		{"", models.AccountTypePeople, CodeRequired},
+		{"Bad Name", models.AccountTypePeople, CodePattern},
+		{"1alice", models.AccountTypePeople, CodePattern},
+		{strings.Repeat("a", 33), models.AccountTypePeople, CodeMaxLength},
+		{"Root", models.AccountTypePeople, CodePattern + "," + CodeReserved},
+		{"svc_backup", models.AccountTypeService, ""},
+		{"backup", models.AccountTypeService, CodeReserved + "," + CodePrefix},
+		{"svc_alice", models.AccountTypePeople, CodePrefix},
+		{"db_orders", models.AccountTypeDatabase, ""},
+	}
+	for _, tt := range tests {
+		err := policy.ValidateUsername(tt.name, tt.accountType)
+		var codes []string
+		var fields FieldErrors
+		if errors.As(err, &fields) {
+			for _, field := range fields {
+				if field.Field != "username" {
+					t.Errorf("%q: field = %s", tt.name, field.Field)
+				}
+				codes = append(codes, field.Code)
+			}
+		} else if err != nil {
+			t.Errorf("%q: unexpected error type %T", tt.name, err)
+		}
+		if got := strings.Join(codes, ","); got != tt.codes {
+			t.Errorf("ValidateUsername(%q, %s) codes = %q, want %q", tt.name, tt.accountType, got, tt.codes)
+		}
+	}
+
+	// A longer own prefix may start with another type's prefix
+	policy.GroupPrefixes[models.GroupTypeDatabase] = "db_"
+	policy.GroupPrefixes[models.GroupTypeService] = "db_svc_"
+	if err := policy.ValidateGroupname("db_svc_reports", models.GroupTypeService); err != nil {
+		t.Errorf("db_svc_reports: %v", err)
+	}
+	if err := policy.ValidateGroupname("db_svc_reports", models.GroupTypeDatabase); err == nil {
+		t.Error("db_svc_reports should be refused for database groups")
+	}
+
+	if _, err := ParsePrefixes("service=svc_, database=db_"); err != nil {
+		t.Errorf("ParsePrefixes: %v", err)
+	}
+	for _, spec := range []string{"service", "service=", "robots=r_"} {
+		if _, err := ParsePrefixes(spec); err == nil {
+			t.Errorf("ParsePrefixes(%q) should fail", spec)
+		}
+	}
+}
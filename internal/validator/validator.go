@@ -134,4 +134,33 @@ func IsValidAccountGroupAssignment(accountType models.AccountType, groupType mod
 	default:
 		return false
 	}
-}
\ No newline at end of file
+}
+
+// IDRange is an inclusive range of UIDs or GIDs
+type IDRange struct {
+	Name string
+	Min  int
+	Max  int
+}
+
+// Ranges lists the UID and GID ranges of every account and group type
+var Ranges = []IDRange{
+	{"system UID", MinSystemUID, MaxSystemUID},
+	{"people UID", MinUserUID, MaxUserUID},
+	{"service UID", MinServiceUID, MaxServiceUID},
+	{"database UID", MinDatabaseUID, MaxDatabaseUID},
+	{"system GID", MinSystemGID, MaxSystemGID},
+	{"people GID", MinUserGID, MaxUserGID},
+	{"service GID", MinServiceGID, MaxServiceGID},
+	{"database GID", MinDatabaseGID, MaxDatabaseGID},
+}
+
+// OverlappingRange returns the first range in Ranges that shares an ID with min-max
+func OverlappingRange(min, max int) (IDRange, bool) {
+	for _, r := range Ranges {
+		if min <= r.Max && max >= r.Min {
+			return r, true
+		}
+	}
+	return IDRange{}, false
+}
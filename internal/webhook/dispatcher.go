@@ -0,0 +1,197 @@
+// Package webhook delivers the queued registry events to webhook subscribers.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/home/unixify/internal/models"
+	"github.com/home/unixify/internal/repository"
+	"github.com/sirupsen/logrus"
+)
+
+// Headers sent with every delivery
+const (
+	HeaderEvent     = "X-Unixify-Event"
+	HeaderDelivery  = "X-Unixify-Delivery"
+	HeaderSignature = "X-Unixify-Signature"
+)
+
+// Dispatcher sends due deliveries from the queue and reschedules failed ones
+// with exponential backoff. Several dispatchers may share one queue; each
+// delivery attempt is claimed by exactly one of them.
+type Dispatcher struct {
+	store  repository.WebhookStore
+	client *http.Client
+	logger *logrus.Logger
+
+	// PollInterval is how often the queue is checked for due deliveries
+	PollInterval time.Duration
+	// MaxAttempts is how often a delivery is tried before it is marked failed
+	MaxAttempts int
+	// BaseDelay is the wait after the first failure; it doubles with every attempt
+	BaseDelay time.Duration
+	// MaxDelay caps the wait between attempts
+	MaxDelay time.Duration
+	// BatchSize is the number of deliveries sent per poll
+	BatchSize int
+	// Targets is where deliveries may be sent; the zero policy refuses
+	// non-public addresses
+	Targets TargetPolicy
+}
+
+// NewDispatcher creates a dispatcher with the default retry schedule
+func NewDispatcher(store repository.WebhookStore, logger *logrus.Logger) *Dispatcher {
+	d := &Dispatcher{
+		store:        store,
+		logger:       logger,
+		PollInterval: 5 * time.Second,
+		MaxAttempts:  10,
+		BaseDelay:    30 * time.Second,
+		MaxDelay:     time.Hour,
+		BatchSize:    50,
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		return d.Targets.DialContext(ctx, network, address)
+	}
+	d.client = &http.Client{Timeout: 10 * time.Second, Transport: transport}
+	return d
+}
+
+// Sign returns the signature header value for a payload: "sha256=" followed by
+// the hex HMAC-SHA256 of the body keyed with the webhook secret
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Run delivers due deliveries until the context is cancelled
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		d.DeliverDue()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DeliverDue sends one batch of due deliveries and returns how many were attempted
+func (d *Dispatcher) DeliverDue() int {
+	now := time.Now().UTC()
+	deliveries, err := d.store.FindDueDeliveries(now, d.BatchSize)
+	if err != nil {
+		d.logger.Errorf("Failed to load due webhook deliveries: %v", err)
+		return 0
+	}
+
+	attempted := 0
+	for i := range deliveries {
+		delivery := &deliveries[i]
+
+		// Hold the delivery for longer than a request can take, so a dispatcher
+		// that dies mid-attempt only delays it
+		claimed, err := d.store.ClaimDelivery(delivery, now.Add(d.client.Timeout+time.Minute))
+		if err != nil {
+			d.logger.Errorf("Failed to claim webhook delivery %d: %v", delivery.ID, err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		attempted++
+		d.attempt(delivery)
+		if err := d.store.UpdateDelivery(delivery); err != nil {
+			d.logger.Errorf("Failed to record webhook delivery %d: %v", delivery.ID, err)
+		}
+	}
+	return attempted
+}
+
+// attempt sends a claimed delivery and records the outcome on it
+func (d *Dispatcher) attempt(delivery *models.WebhookDelivery) {
+	webhook, err := d.store.FindByID(delivery.WebhookID)
+	if err != nil {
+		d.fail(delivery, 0, err.Error(), true)
+		return
+	}
+	if !webhook.Active {
+		d.fail(delivery, 0, "webhook is disabled", true)
+		return
+	}
+
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		d.fail(delivery, 0, err.Error(), true)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Unixify-Webhook")
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderDelivery, strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set(HeaderSignature, Sign(webhook.Secret, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		d.fail(delivery, 0, err.Error(), false)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		excerpt, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		d.fail(delivery, resp.StatusCode, fmt.Sprintf("HTTP %d: %s", resp.StatusCode, bytes.TrimSpace(excerpt)), false)
+		return
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	delivered := time.Now().UTC()
+	delivery.Status = models.DeliveryDelivered
+	delivery.ResponseCode = resp.StatusCode
+	delivery.LastError = ""
+	delivery.DeliveredAt = &delivered
+}
+
+// fail records a failed attempt and schedules the next one, unless the
+// delivery is out of attempts or cannot succeed
+func (d *Dispatcher) fail(delivery *models.WebhookDelivery, code int, message string, permanent bool) {
+	delivery.ResponseCode = code
+	delivery.LastError = message
+
+	if permanent || delivery.Attempts >= d.MaxAttempts {
+		delivery.Status = models.DeliveryFailed
+		d.logger.Warnf("Webhook delivery %d failed after %d attempts: %s", delivery.ID, delivery.Attempts, message)
+		return
+	}
+	delivery.NextAttemptAt = time.Now().UTC().Add(d.Backoff(delivery.Attempts))
+}
+
+// Backoff returns the wait after the given number of failed attempts
+func (d *Dispatcher) Backoff(attempts int) time.Duration {
+	delay := d.BaseDelay
+	for i := 1; i < attempts && delay < d.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > d.MaxDelay {
+		delay = d.MaxDelay
+	}
+	return delay
+}
@@ -0,0 +1,170 @@
+package webhook
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/home/unixify/internal/models"
+	"github.com/home/unixify/internal/repository/memory"
+	"github.com/sirupsen/logrus"
+)
+
+// newTestDispatcher returns a dispatcher over an in-memory queue that retries immediately
+func newTestDispatcher(t *testing.T) (*Dispatcher, *memory.WebhookRepository) {
+	t.Helper()
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	store := memory.NewStore().Webhooks()
+	dispatcher := NewDispatcher(store, logger)
+	dispatcher.BaseDelay = 0
+	dispatcher.MaxAttempts = 3
+	dispatcher.Targets = NewTargetPolicy([]string{"127.0.0.1"})
+	return dispatcher, store
+}
+
+// queue creates a webhook for url and one pending delivery for it
+func queue(t *testing.T, store *memory.WebhookRepository, url string) *models.WebhookDelivery {
+	t.Helper()
+	webhook := &models.Webhook{Name: "test", URL: url, Secret: "s3cret", Active: true}
+	if err := store.Create(webhook); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	delivery := &models.WebhookDelivery{
+		WebhookID:     webhook.ID,
+		EventID:       7,
+		EventType:     models.EventAccountCreated,
+		Payload:       `{"id":7,"type":"account.created"}`,
+		Status:        models.DeliveryPending,
+		NextAttemptAt: time.Now().UTC(),
+	}
+	if err := store.CreateDelivery(delivery); err != nil {
+		t.Fatalf("CreateDelivery: %v", err)
+	}
+	return delivery
+}
+
+// stored reloads the delivery log entry of a webhook
+func stored(t *testing.T, store *memory.WebhookRepository, delivery *models.WebhookDelivery) models.WebhookDelivery {
+	t.Helper()
+	deliveries, err := store.FindDeliveries(delivery.WebhookID, "", 0)
+	if err != nil || len(deliveries) != 1 {
+		t.Fatalf("FindDeliveries = %v, %v", deliveries, err)
+	}
+	return deliveries[0]
+}
+
+func TestDeliverySignedAndRecorded(t *testing.T) {
+	var received *http.Request
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	dispatcher, store := newTestDispatcher(t)
+	delivery := queue(t, store, server.URL)
+
+	if n := dispatcher.DeliverDue(); n != 1 {
+		t.Fatalf("DeliverDue attempted %d deliveries, want 1", n)
+	}
+	if string(body) != delivery.Payload {
+		t.Errorf("body = %s, want %s", body, delivery.Payload)
+	}
+	if got, want := received.Header.Get(HeaderSignature), Sign("s3cret", body); got != want {
+		t.Errorf("signature = %q, want %q", got, want)
+	}
+	if got := received.Header.Get(HeaderEvent); got != models.EventAccountCreated {
+		t.Errorf("event header = %q", got)
+	}
+
+	result := stored(t, store, delivery)
+	if result.Status != models.DeliveryDelivered || result.Attempts != 1 || result.ResponseCode != http.StatusNoContent || result.DeliveredAt == nil {
+		t.Errorf("unexpected delivery %+v", result)
+	}
+	if n := dispatcher.DeliverDue(); n != 0 {
+		t.Errorf("delivered deliveries were sent again")
+	}
+}
+
+func TestFailedDeliveryRetriesThenGivesUp(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		http.Error(w, "try later", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	dispatcher, store := newTestDispatcher(t)
+	delivery := queue(t, store, server.URL)
+
+	for i := 0; i < 5; i++ {
+		dispatcher.DeliverDue()
+	}
+	result := stored(t, store, delivery)
+	if calls != 3 || result.Attempts != 3 || result.Status != models.DeliveryFailed {
+		t.Errorf("after %d calls: %+v", calls, result)
+	}
+	if result.ResponseCode != http.StatusServiceUnavailable || result.LastError != "HTTP 503: try later" {
+		t.Errorf("unexpected error record %d %q", result.ResponseCode, result.LastError)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	dispatcher := NewDispatcher(nil, logrus.New())
+	want := map[int]time.Duration{1: 30 * time.Second, 2: time.Minute, 3: 2 * time.Minute, 9: time.Hour, 50: time.Hour}
+	for attempts, delay := range want {
+		if got := dispatcher.Backoff(attempts); got != delay {
+			t.Errorf("Backoff(%d) = %v, want %v", attempts, got, delay)
+		}
+	}
+}
+
+func TestTargetPolicy(t *testing.T) {
+	policy := NewTargetPolicy([]string{"hooks.internal", "10.1.0.0/16", "192.168.1.5"})
+	tests := []struct {
+		url     string
+		allowed bool
+	}{
+		{"https://example.com/hook", true},
+		{"https://93.184.216.34/hook", true},
+		{"http://hooks.internal/hook", true},
+		{"http://10.1.2.3/hook", true},
+		{"http://192.168.1.5/hook", true},
+		{"http://192.168.1.6/hook", false},
+		{"http://10.2.0.1/hook", false},
+		{"http://127.0.0.1/hook", false},
+		{"http://[::1]/hook", false},
+		{"http://localhost:8080/hook", false},
+		{"http://169.254.169.254/", false},
+		{"http://0.0.0.0/", false},
+		{"ftp://example.com/", false},
+	}
+	for _, tt := range tests {
+		if err := policy.CheckURL(tt.url); (err == nil) != tt.allowed {
+			t.Errorf("CheckURL(%s) = %v, want allowed %v", tt.url, err, tt.allowed)
+		}
+	}
+}
+
+func TestDeliveryToRefusedAddress(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("delivered to a refused address")
+	}))
+	defer server.Close()
+
+	dispatcher, store := newTestDispatcher(t)
+	dispatcher.Targets = NewTargetPolicy(nil)
+	delivery := queue(t, store, server.URL)
+	dispatcher.DeliverDue()
+
+	got := stored(t, store, delivery)
+	if got.Status == models.DeliveryDelivered || !strings.Contains(got.LastError, "non-public address") {
+		t.Errorf("delivery = %s with error %q, want it refused", got.Status, got.LastError)
+	}
+}
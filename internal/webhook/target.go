@@ -0,0 +1,102 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// TargetPolicy decides where webhooks may be delivered. Loopback,
+// link-local, private and other non-public addresses are refused, so a
+// webhook cannot reach services inside the network, unless their host name
+// or address is allowed explicitly.
+type TargetPolicy struct {
+	hosts    map[string]bool
+	networks []*net.IPNet
+}
+
+// NewTargetPolicy creates a policy that allows the given host names,
+// addresses and CIDR networks in addition to public addresses. Entries that
+// are not valid networks are taken as host names.
+func NewTargetPolicy(allowed []string) TargetPolicy {
+	policy := TargetPolicy{hosts: make(map[string]bool)}
+	for _, entry := range allowed {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if ip := net.ParseIP(entry); ip != nil {
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			entry = fmt.Sprintf("%s/%d", ip, bits)
+		}
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			policy.networks = append(policy.networks, network)
+			continue
+		}
+		policy.hosts[entry] = true
+	}
+	return policy
+}
+
+// CheckURL checks that a webhook URL is an absolute http or https URL
+// whose host is allowed. Host names are only resolved when delivering, so
+// a name that resolves to a refused address is caught then.
+func (p TargetPolicy) CheckURL(rawURL string) error {
+	target, err := url.Parse(rawURL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Hostname() == "" {
+		return fmt.Errorf("webhook URL must be an absolute http or https URL")
+	}
+	host := strings.ToLower(target.Hostname())
+	if p.hosts[host] {
+		return nil
+	}
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("webhook URL must not point at a loopback, link-local or private address")
+	}
+	if ip := net.ParseIP(host); ip != nil && !p.allowedIP(ip) {
+		return fmt.Errorf("webhook URL must not point at a loopback, link-local or private address")
+	}
+	return nil
+}
+
+// DialContext connects to a webhook, refusing addresses the policy does not
+// allow. Addresses are checked after resolving, so a public host name
+// cannot be pointed at an internal address.
+func (p TargetPolicy) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	if !p.hosts[strings.ToLower(host)] {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !p.allowedIP(ip) {
+				return fmt.Errorf("refusing to deliver to non-public address %s", host)
+			}
+			return nil
+		}
+	}
+	return dialer.DialContext(ctx, network, address)
+}
+
+// allowedIP reports whether webhooks may be delivered to an address
+func (p TargetPolicy) allowedIP(ip net.IP) bool {
+	for _, network := range p.networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified())
+}
@@ -47,13 +47,14 @@ function showSuccess(message) {
 }
 
 // Helper function for making API requests
-async function apiRequest(url, method = 'GET', data = null) {
+async function apiRequest(url, method = 'GET', data = null, headers = {}) {
     console.log(`Making ${method} request to ${url}`, data);
     
     const options = {
         method,
         headers: {
-            'Content-Type': 'application/json'
+            'Content-Type': 'application/json',
+            ...headers
         }
     };
     
@@ -61,6 +62,11 @@ async function apiRequest(url, method = 'GET', data = null) {
         options.body = JSON.stringify(data);
         console.log('Request body:', options.body);
     }
+
+    // Send the login token when there is one; auth.js is not on every page
+    if (typeof addAuthHeader === 'function') {
+        addAuthHeader(options);
+    }
     
     try {
         console.log('Fetch options:', options);
@@ -81,6 +87,11 @@ async function apiRequest(url, method = 'GET', data = null) {
             result = { message: text };
         }
         
+        // Guests are sent to log in when the server does not allow guest access
+        if (response.status === 401 && typeof getAuthToken === 'function' && !getAuthToken()) {
+            window.location.href = '/login';
+        }
+
         if (!response.ok) {
             console.error('Response not OK:', response.status, result);
             throw new Error(result.error || `Error: ${response.status} ${response.statusText}`);
@@ -26,6 +26,10 @@ document.addEventListener('DOMContentLoaded', function() {
     let auditTotalPages = 1;
     let auditPageSize = 10;
     
+    // ETags of the records open in the edit modals, sent back as If-Match
+    let editingAccountETag = null;
+    let editingGroupETag = null;
+    
     // Bootstrap modals
     let accountModal, groupModal, membershipModal, auditDetailModal;
     if (document.getElementById('accountModal')) {
@@ -44,7 +48,28 @@ document.addEventListener('DOMContentLoaded', function() {
     // Load accounts and groups on page load
     loadAccounts();
     loadGroups();
-    
+
+    // Reload the tables when the registry changes. Bursts of events (such as a
+    // desired-state apply) cause a single reload. The stream is read with fetch
+    // to send the login token, which EventSource cannot.
+    if (window.ReadableStream) {
+        const reloadTimers = {};
+        const reloadSoon = (load) => {
+            clearTimeout(reloadTimers[load.name]);
+            reloadTimers[load.name] = setTimeout(load, 250);
+        };
+        const handlers = {};
+        ['account.created', 'account.updated', 'account.deleted', 'membership.added', 'membership.removed'].forEach(type => {
+            handlers[type] = () => reloadSoon(loadAccounts);
+        });
+        ['group.created', 'group.updated', 'group.deleted'].forEach(type => {
+            handlers[type] = () => reloadSoon(loadGroups);
+        });
+        followEvents(`/api/events?section=${sectionType}`, type => {
+            if (handlers[type]) handlers[type]();
+        });
+    }
+
     // Load audit logs when the tab is clicked
     document.getElementById('audit-tab').addEventListener('shown.bs.tab', function() {
         loadAuditLogs();
@@ -332,15 +357,13 @@ document.addEventListener('DOMContentLoaded', function() {
                 groupsTableBody.innerHTML = '<tr><td colspan="6" class="text-center">Searching groups...</td></tr>';
             }
             
-            // Search for accounts and groups simultaneously
-            const [accounts, groups] = await Promise.all([
-                apiRequest(`/api/search/accounts?q=${encodeURIComponent(query)}`),
-                apiRequest(`/api/search/groups?q=${encodeURIComponent(query)}`)
-            ]);
+            // Search accounts and groups together, best match first
+            const results = await apiRequest(`/api/search?q=${encodeURIComponent(query)}&limit=100`);
             
             // Filter results by current section type
-            const filteredAccounts = accounts.filter(a => a.type.toLowerCase() === sectionType.toLowerCase());
-            const filteredGroups = groups.filter(g => g.type.toLowerCase() === sectionType.toLowerCase());
+            const inSection = results.filter(r => r.type.toLowerCase() === sectionType.toLowerCase());
+            const filteredAccounts = inSection.filter(r => r.kind === 'account').map(r => r.account);
+            const filteredGroups = inSection.filter(r => r.kind === 'group').map(r => r.group);
             
             // Display results
             renderAccountsTable(filteredAccounts);
@@ -392,7 +415,7 @@ document.addEventListener('DOMContentLoaded', function() {
                     <button type="button" class="btn btn-sm btn-primary edit-account" data-id="${account.id}" title="Edit">
                         <i class="bi bi-pencil"></i> Edit
                     </button>
-                    <button type="button" class="btn btn-sm btn-danger delete-account" data-id="${account.id}" title="Delete">
+                    <button type="button" class="btn btn-sm btn-danger delete-account" data-id="${account.id}" data-version="${account.version}" title="Delete">
                         <i class="bi bi-trash"></i> Delete
                     </button>
                     <button type="button" class="btn btn-sm btn-info groups-account" data-id="${account.id}" title="Manage Groups">
@@ -409,7 +432,7 @@ document.addEventListener('DOMContentLoaded', function() {
         });
         
         document.querySelectorAll('.delete-account').forEach(btn => {
-            btn.addEventListener('click', () => deleteAccount(btn.dataset.id));
+            btn.addEventListener('click', () => deleteAccount(btn.dataset.id, btn.dataset.version));
         });
         
         document.querySelectorAll('.groups-account').forEach(btn => {
@@ -449,7 +472,7 @@ document.addEventListener('DOMContentLoaded', function() {
                     <button type="button" class="btn btn-sm btn-primary edit-group" data-id="${group.id}" title="Edit">
                         <i class="bi bi-pencil"></i> Edit
                     </button>
-                    <button type="button" class="btn btn-sm btn-danger delete-group" data-id="${group.id}" title="Delete">
+                    <button type="button" class="btn btn-sm btn-danger delete-group" data-id="${group.id}" data-version="${group.version}" title="Delete">
                         <i class="bi bi-trash"></i> Delete
                     </button>
                     <button type="button" class="btn btn-sm btn-info members-group" data-id="${group.id}" title="Manage Members">
@@ -466,7 +489,7 @@ document.addEventListener('DOMContentLoaded', function() {
         });
         
         document.querySelectorAll('.delete-group').forEach(btn => {
-            btn.addEventListener('click', () => deleteGroup(btn.dataset.id));
+            btn.addEventListener('click', () => deleteGroup(btn.dataset.id, btn.dataset.version));
         });
         
         document.querySelectorAll('.members-group').forEach(btn => {
@@ -481,6 +504,7 @@ document.addEventListener('DOMContentLoaded', function() {
         document.getElementById('accountModalLabel').textContent = 'New Account';
         document.getElementById('accountForm').reset();
         document.getElementById('accountId').value = '';
+        editingAccountETag = null;
         
         // Clear any previous validation indicators
         const uidField = document.getElementById('uid');
@@ -606,6 +630,7 @@ document.addEventListener('DOMContentLoaded', function() {
         document.getElementById('groupModalLabel').textContent = 'New Group';
         document.getElementById('groupForm').reset();
         document.getElementById('groupId').value = '';
+        editingGroupETag = null;
         
         // Clear any previous validation indicators
         const gidField = document.getElementById('gid');
@@ -667,6 +692,7 @@ document.addEventListener('DOMContentLoaded', function() {
             
             document.getElementById('accountModalLabel').textContent = 'Edit Account';
             document.getElementById('accountId').value = account.id;
+            editingAccountETag = `"${account.version}"`;
             document.getElementById('uid').value = account.uid;
             document.getElementById('username').value = account.username;
             
@@ -707,6 +733,7 @@ document.addEventListener('DOMContentLoaded', function() {
             const group = await apiRequest(`/api/groups/${id}`);
             document.getElementById('groupModalLabel').textContent = 'Edit Group';
             document.getElementById('groupId').value = group.id;
+            editingGroupETag = `"${group.version}"`;
             document.getElementById('gid').value = group.gid;
             document.getElementById('groupname').value = group.groupname;
             
@@ -774,7 +801,7 @@ document.addEventListener('DOMContentLoaded', function() {
             let result;
             if (accountId) {
                 // Update existing account
-                result = await apiRequest(`/api/accounts/${accountId}`, 'PUT', accountData);
+                result = await apiRequest(`/api/accounts/${accountId}`, 'PUT', accountData, { 'If-Match': editingAccountETag });
                 showSuccess('Account updated successfully');
             } else {
                 // Create new account
@@ -827,7 +854,7 @@ document.addEventListener('DOMContentLoaded', function() {
             let result;
             if (groupId) {
                 // Update existing group
-                result = await apiRequest(`/api/groups/${groupId}`, 'PUT', groupData);
+                result = await apiRequest(`/api/groups/${groupId}`, 'PUT', groupData, { 'If-Match': editingGroupETag });
                 showSuccess('Group updated successfully');
             } else {
                 // Create new group
@@ -847,13 +874,13 @@ document.addEventListener('DOMContentLoaded', function() {
     }
     
     // Delete account
-    async function deleteAccount(id) {
+    async function deleteAccount(id, version) {
         if (!confirm('Are you sure you want to delete this account?')) {
             return;
         }
         
         try {
-            await apiRequest(`/api/accounts/${id}`, 'DELETE');
+            await apiRequest(`/api/accounts/${id}`, 'DELETE', null, { 'If-Match': `"${version}"` });
             showSuccess('Account deleted successfully');
             await loadAccounts();
         } catch (error) {
@@ -863,13 +890,13 @@ document.addEventListener('DOMContentLoaded', function() {
     }
     
     // Delete group
-    async function deleteGroup(id) {
+    async function deleteGroup(id, version) {
         if (!confirm('Are you sure you want to delete this group?')) {
             return;
         }
         
         try {
-            await apiRequest(`/api/groups/${id}`, 'DELETE');
+            await apiRequest(`/api/groups/${id}`, 'DELETE', null, { 'If-Match': `"${version}"` });
             showSuccess('Group deleted successfully');
             await loadGroups();
         } catch (error) {
@@ -1594,3 +1621,41 @@ document.addEventListener('DOMContentLoaded', function() {
         }
     }
 });
+
+// Follow a Server-Sent Events stream with the login token, calling onEvent
+// with each event type. Like EventSource, it reconnects after the stream ends
+// and resumes from the last event ID.
+async function followEvents(url, onEvent) {
+    let lastEventID = '';
+    for (;;) {
+        try {
+            const headers = lastEventID ? { 'Last-Event-ID': lastEventID } : {};
+            const response = await authFetch(url, { headers });
+            if (!response.ok) {
+                throw new Error(`Error: ${response.status} ${response.statusText}`);
+            }
+            const reader = response.body.getReader();
+            const decoder = new TextDecoder();
+            let buffer = '';
+            for (;;) {
+                const { value, done } = await reader.read();
+                if (done) break;
+                buffer += decoder.decode(value, { stream: true });
+                let end;
+                while ((end = buffer.indexOf('\n\n')) >= 0) {
+                    const message = buffer.slice(0, end);
+                    buffer = buffer.slice(end + 2);
+                    let type = '';
+                    message.split('\n').forEach(line => {
+                        if (line.startsWith('event: ')) type = line.slice(7);
+                        if (line.startsWith('id: ')) lastEventID = line.slice(4);
+                    });
+                    if (type) onEvent(type);
+                }
+            }
+        } catch (error) {
+            console.error('Event stream error:', error);
+        }
+        await new Promise(resolve => setTimeout(resolve, 5000));
+    }
+}